@@ -1,6 +1,7 @@
 package core
 
 import (
+	"github.com/kardolus/chatgpt-cli/agent/tools"
 	"github.com/kardolus/chatgpt-cli/agent/types"
 	"go.uber.org/zap"
 	"strings"
@@ -24,6 +25,15 @@ type BaseAgent struct {
 
 	Transcript    *TranscriptBuffer
 	PromptHistory *TranscriptBuffer
+
+	// Memory holds what earlier runs learned about the project; nil when disabled.
+	Memory tools.Memory
+
+	// PriorRuns are the earlier agent runs of the conversation, oldest first.
+	PriorRuns []types.PriorRun
+
+	// Delegation is set when the agent may hand goals to child agents.
+	Delegation bool
 }
 
 type BaseOption func(*BaseAgent)
@@ -41,6 +51,31 @@ func WithWorkDir(d string) BaseOption {
 	}
 }
 
+// WithMaxParallel sets how many independent plan steps may run at once.
+func WithMaxParallel(n int) BaseOption {
+	return func(b *BaseAgent) { b.Config.MaxParallel = n }
+}
+
+// WithMaxReplans sets how many times a failed plan may be revised.
+func WithMaxReplans(n int) BaseOption {
+	return func(b *BaseAgent) { b.Config.MaxReplans = n }
+}
+
+// WithMemory gives the agent the facts remembered about the project in earlier runs.
+func WithMemory(m tools.Memory) BaseOption {
+	return func(b *BaseAgent) { b.Memory = m }
+}
+
+// WithPriorRuns tells the agent what earlier runs in the same conversation did.
+func WithPriorRuns(runs []types.PriorRun) BaseOption {
+	return func(b *BaseAgent) { b.PriorRuns = runs }
+}
+
+// WithDelegation lets the agent hand goals to child agents with delegate steps.
+func WithDelegation(on bool) BaseOption {
+	return func(b *BaseAgent) { b.Delegation = on }
+}
+
 func WithHumanLogger(l *zap.SugaredLogger, sync func()) BaseOption {
 	return func(b *BaseAgent) {
 		if l != nil {
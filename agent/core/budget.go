@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"github.com/kardolus/chatgpt-cli/agent/types"
 	"go.uber.org/zap"
+	"sync"
 	"time"
 )
 
@@ -14,6 +15,7 @@ type Budget interface {
 	AllowTool(kind types.ToolKind, now time.Time) error
 	AllowIteration(now time.Time) error // NEW
 	ChargeLLMTokens(tokens int, now time.Time)
+	ChargeCost(usd float64, now time.Time)
 	Snapshot(now time.Time) BudgetSnapshot
 }
 
@@ -22,9 +24,11 @@ const (
 	BudgetKindShell      = "shell"
 	BudgetKindLLM        = "llm"
 	BudgetKindFiles      = "files"
+	BudgetKindHTTP       = "http"
 	BudgetKindLLMTokens  = "llm_tokens"
 	BudgetKindWallTime   = "wall_time"
 	BudgetKindIterations = "iterations"
+	BudgetKindCost       = "cost"
 )
 
 type BudgetLimits struct {
@@ -34,7 +38,9 @@ type BudgetLimits struct {
 	MaxShellCalls int
 	MaxLLMCalls   int
 	MaxFileOps    int
+	MaxHTTPCalls  int
 	MaxIterations int
+	MaxCostUSD    float64
 }
 
 type BudgetSnapshot struct {
@@ -45,11 +51,15 @@ type BudgetSnapshot struct {
 	ShellUsed      int
 	LLMUsed        int
 	FileOpsUsed    int
+	HTTPUsed       int
 	LLMTokensUsed  int
 	IterationsUsed int
+	CostUSD        float64
 }
 
+// DefaultBudget is safe for concurrent use, so steps that run in parallel can share it.
 type DefaultBudget struct {
+	mu     sync.Mutex
 	limits BudgetLimits
 
 	started   bool
@@ -59,8 +69,10 @@ type DefaultBudget struct {
 	shellUsed      int
 	llmUsed        int
 	fileOpsUsed    int
+	httpUsed       int
 	llmTokensUsed  int
 	iterationsUsed int
+	costUSD        float64
 }
 
 func NewDefaultBudget(limits BudgetLimits) *DefaultBudget {
@@ -68,17 +80,27 @@ func NewDefaultBudget(limits BudgetLimits) *DefaultBudget {
 }
 
 func (b *DefaultBudget) Start(now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.start(now)
+}
+
+func (b *DefaultBudget) start(now time.Time) {
 	b.started = true
 	b.startedAt = now
 	b.stepsUsed = 0
 	b.shellUsed = 0
 	b.llmUsed = 0
 	b.fileOpsUsed = 0
+	b.httpUsed = 0
 	b.llmTokensUsed = 0
 	b.iterationsUsed = 0
+	b.costUSD = 0
 }
 
 func (b *DefaultBudget) Snapshot(now time.Time) BudgetSnapshot {
+	b.mu.Lock()
+	defer b.mu.Unlock()
 	b.ensureStarted(now)
 
 	elapsed := now.Sub(b.startedAt)
@@ -94,12 +116,16 @@ func (b *DefaultBudget) Snapshot(now time.Time) BudgetSnapshot {
 		ShellUsed:      b.shellUsed,
 		LLMUsed:        b.llmUsed,
 		FileOpsUsed:    b.fileOpsUsed,
+		HTTPUsed:       b.httpUsed,
 		LLMTokensUsed:  b.llmTokensUsed,
 		IterationsUsed: b.iterationsUsed,
+		CostUSD:        b.costUSD,
 	}
 }
 
 func (b *DefaultBudget) ChargeLLMTokens(tokens int, now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
 	b.ensureStarted(now)
 	if tokens <= 0 {
 		return
@@ -107,7 +133,20 @@ func (b *DefaultBudget) ChargeLLMTokens(tokens int, now time.Time) {
 	b.llmTokensUsed += tokens
 }
 
+// ChargeCost adds what an LLM call cost; the next LLM call is refused once MaxCostUSD is spent.
+func (b *DefaultBudget) ChargeCost(usd float64, now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.ensureStarted(now)
+	if usd <= 0 {
+		return
+	}
+	b.costUSD += usd
+}
+
 func (b *DefaultBudget) AllowIteration(now time.Time) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
 	b.ensureStarted(now)
 
 	if err := b.checkWall(now); err != nil {
@@ -128,6 +167,8 @@ func (b *DefaultBudget) AllowIteration(now time.Time) error {
 }
 
 func (b *DefaultBudget) AllowStep(step types.Step, now time.Time) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
 	b.ensureStarted(now)
 
 	if err := b.checkWall(now); err != nil {
@@ -148,6 +189,8 @@ func (b *DefaultBudget) AllowStep(step types.Step, now time.Time) error {
 }
 
 func (b *DefaultBudget) AllowTool(kind types.ToolKind, now time.Time) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
 	b.ensureStarted(now)
 
 	if err := b.checkWall(now); err != nil {
@@ -175,6 +218,14 @@ func (b *DefaultBudget) AllowTool(kind types.ToolKind, now time.Time) error {
 				Message: "llm call budget exceeded",
 			}
 		}
+		if b.limits.MaxCostUSD > 0 && b.costUSD >= b.limits.MaxCostUSD {
+			return BudgetExceededError{
+				Kind:     BudgetKindCost,
+				LimitUSD: b.limits.MaxCostUSD,
+				UsedUSD:  b.costUSD,
+				Message:  "cost budget exceeded",
+			}
+		}
 		b.llmUsed++
 
 	case types.ToolFiles:
@@ -188,6 +239,23 @@ func (b *DefaultBudget) AllowTool(kind types.ToolKind, now time.Time) error {
 		}
 		b.fileOpsUsed++
 
+	case types.ToolHTTP:
+		if b.limits.MaxHTTPCalls > 0 && b.httpUsed+1 > b.limits.MaxHTTPCalls {
+			return BudgetExceededError{
+				Kind:    BudgetKindHTTP,
+				Limit:   b.limits.MaxHTTPCalls,
+				Used:    b.httpUsed,
+				Message: "http call budget exceeded",
+			}
+		}
+		b.httpUsed++
+
+	case types.ToolMemory:
+		// not budgeted: the memory caps its own size
+
+	case types.ToolDelegate:
+		// not budgeted: the child agent's own calls are
+
 	default:
 		return fmt.Errorf("unknown tool kind: %q", kind)
 	}
@@ -195,11 +263,68 @@ func (b *DefaultBudget) AllowTool(kind types.ToolKind, now time.Time) error {
 	return nil
 }
 
+// SubBudget is the budget of a child agent. It has limits of its own, and the tool calls
+// and tokens of the child also count against the parent budget. Steps and iterations only
+// count against the child, so a child starts with a fresh context.
+type SubBudget struct {
+	*DefaultBudget
+	parent Budget
+}
+
+func NewSubBudget(parent Budget, limits BudgetLimits) *SubBudget {
+	return &SubBudget{DefaultBudget: NewDefaultBudget(limits), parent: parent}
+}
+
+func (b *SubBudget) AllowTool(kind types.ToolKind, now time.Time) error {
+	if err := b.DefaultBudget.AllowTool(kind, now); err != nil {
+		return err
+	}
+	return b.parent.AllowTool(kind, now)
+}
+
+func (b *SubBudget) ChargeLLMTokens(tokens int, now time.Time) {
+	b.DefaultBudget.ChargeLLMTokens(tokens, now)
+	b.parent.ChargeLLMTokens(tokens, now)
+}
+
+func (b *SubBudget) ChargeCost(usd float64, now time.Time) {
+	b.DefaultBudget.ChargeCost(usd, now)
+	b.parent.ChargeCost(usd, now)
+}
+
+// CarveBudget returns the limits of a child agent: a share of what is left of every
+// limit of the parent, at least 1. Steps and iterations aren't shared, the child gets the
+// same limits as the parent. Cost isn't carved either: it is charged to the whole run, and
+// the parent budget checks it.
+func CarveBudget(parent BudgetSnapshot, share float64) BudgetLimits {
+	carve := func(limit, used int) int {
+		if limit <= 0 {
+			return 0
+		}
+		return max(1, int(float64(limit-used)*share))
+	}
+
+	l := parent.Limits
+	limits := BudgetLimits{
+		MaxSteps:      l.MaxSteps,
+		MaxIterations: l.MaxIterations,
+		MaxLLMTokens:  carve(l.MaxLLMTokens, parent.LLMTokensUsed),
+		MaxShellCalls: carve(l.MaxShellCalls, parent.ShellUsed),
+		MaxLLMCalls:   carve(l.MaxLLMCalls, parent.LLMUsed),
+		MaxFileOps:    carve(l.MaxFileOps, parent.FileOpsUsed),
+		MaxHTTPCalls:  carve(l.MaxHTTPCalls, parent.HTTPUsed),
+	}
+	if l.MaxWallTime > 0 {
+		limits.MaxWallTime = max(time.Second, time.Duration(float64(l.MaxWallTime-parent.Elapsed)*share))
+	}
+	return limits
+}
+
 func (b *DefaultBudget) ensureStarted(now time.Time) {
 	if b.started {
 		return
 	}
-	b.Start(now)
+	b.start(now)
 }
 
 func (b *DefaultBudget) checkWall(now time.Time) error {
@@ -220,19 +345,23 @@ func (b *DefaultBudget) checkWall(now time.Time) error {
 
 // BudgetExceededError is a typed error so the Agent/Planner can branch on it.
 type BudgetExceededError struct {
-	// "steps" | "shell" | "llm" | "files" | "llm_tokens" | "wall_time"
-	Kind    string
-	Limit   int
-	Used    int
-	LimitD  time.Duration
-	UsedD   time.Duration
-	Message string
+	// "steps" | "shell" | "llm" | "files" | "http" | "llm_tokens" | "wall_time" | "cost"
+	Kind     string
+	Limit    int
+	Used     int
+	LimitD   time.Duration
+	UsedD    time.Duration
+	LimitUSD float64
+	UsedUSD  float64
+	Message  string
 }
 
 func (e BudgetExceededError) Error() string {
 	switch e.Kind {
 	case BudgetKindWallTime:
 		return fmt.Sprintf("%s: limit=%s used=%s", e.Message, e.LimitD, e.UsedD)
+	case BudgetKindCost:
+		return fmt.Sprintf("%s: limit=$%.4f used=$%.4f", e.Message, e.LimitUSD, e.UsedUSD)
 	default:
 		return fmt.Sprintf("%s: kind=%s limit=%d used=%d", e.Message, e.Kind, e.Limit, e.Used)
 	}
@@ -4,6 +4,8 @@ import (
 	"errors"
 	"github.com/kardolus/chatgpt-cli/agent/core"
 	"github.com/kardolus/chatgpt-cli/agent/types"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -89,13 +91,14 @@ func testBudget(t *testing.T, when spec.G, it spec.S) {
 			Expect(s.IterationsUsed).To(Equal(0))
 		})
 
-		it("enforces MaxShellCalls / MaxLLMCalls / MaxFileOps independently", func() {
+		it("enforces MaxShellCalls / MaxLLMCalls / MaxFileOps / MaxHTTPCalls independently", func() {
 			t0 := time.Date(2026, 1, 13, 9, 0, 0, 0, time.UTC)
 
 			b := core.NewDefaultBudget(core.BudgetLimits{
 				MaxShellCalls: 1,
 				MaxLLMCalls:   2,
 				MaxFileOps:    1,
+				MaxHTTPCalls:  1,
 			})
 
 			Expect(b.AllowTool(types.ToolShell, t0)).To(Succeed())
@@ -114,10 +117,16 @@ func testBudget(t *testing.T, when spec.G, it spec.S) {
 			Expect(err).To(HaveOccurred())
 			Expect(err.Error()).To(ContainSubstring("file ops budget exceeded"))
 
+			Expect(b.AllowTool(types.ToolHTTP, t0)).To(Succeed())
+			err = b.AllowTool(types.ToolHTTP, t0)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("http call budget exceeded"))
+
 			s := b.Snapshot(t0)
 			Expect(s.ShellUsed).To(Equal(1))
 			Expect(s.LLMUsed).To(Equal(2))
 			Expect(s.FileOpsUsed).To(Equal(1))
+			Expect(s.HTTPUsed).To(Equal(1))
 			Expect(s.IterationsUsed).To(Equal(0))
 		})
 
@@ -364,5 +373,121 @@ func testBudget(t *testing.T, when spec.G, it spec.S) {
 			Expect(s.StepsUsed).To(Equal(1))
 			Expect(s.ShellUsed).To(Equal(1))
 		})
+
+		it("never hands out more than the limit to concurrent callers", func() {
+			t0 := time.Date(2026, 1, 13, 9, 0, 0, 0, time.UTC)
+
+			b := core.NewDefaultBudget(core.BudgetLimits{MaxShellCalls: 50})
+
+			var (
+				wg      sync.WaitGroup
+				allowed atomic.Int32
+			)
+			for i := 0; i < 100; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					if b.AllowTool(types.ToolShell, t0) == nil {
+						allowed.Add(1)
+					}
+					b.ChargeLLMTokens(1, t0)
+				}()
+			}
+			wg.Wait()
+
+			Expect(allowed.Load()).To(Equal(int32(50)))
+			s := b.Snapshot(t0)
+			Expect(s.ShellUsed).To(Equal(50))
+			Expect(s.LLMTokensUsed).To(Equal(100))
+		})
+		it("ChargeCost stops LLM calls once the cost budget is spent", func() {
+			t0 := time.Date(2026, 1, 13, 9, 0, 0, 0, time.UTC)
+
+			b := core.NewDefaultBudget(core.BudgetLimits{MaxCostUSD: 0.5})
+			Expect(b.AllowTool(types.ToolLLM, t0)).To(Succeed())
+
+			b.ChargeCost(0.3, t0)
+			b.ChargeCost(-1, t0)
+			Expect(b.AllowTool(types.ToolLLM, t0)).To(Succeed())
+			Expect(b.AllowTool(types.ToolShell, t0)).To(Succeed())
+
+			b.ChargeCost(0.25, t0)
+			Expect(b.Snapshot(t0).CostUSD).To(BeNumerically("~", 0.55, 1e-9))
+			Expect(b.AllowTool(types.ToolShell, t0)).To(Succeed())
+
+			err := b.AllowTool(types.ToolLLM, t0)
+			var be core.BudgetExceededError
+			Expect(errors.As(err, &be)).To(BeTrue())
+			Expect(be.Kind).To(Equal(core.BudgetKindCost))
+			Expect(err.Error()).To(ContainSubstring("limit=$0.5000 used=$0.5500"))
+		})
+	})
+
+	when("SubBudget", func() {
+		it("counts tool calls and tokens against itself and the parent", func() {
+			t0 := time.Date(2026, 1, 13, 9, 0, 0, 0, time.UTC)
+
+			parent := core.NewDefaultBudget(core.BudgetLimits{MaxShellCalls: 5, MaxSteps: 1})
+			b := core.NewSubBudget(parent, core.BudgetLimits{MaxShellCalls: 2, MaxSteps: 3})
+
+			Expect(b.AllowTool(types.ToolShell, t0)).To(Succeed())
+			Expect(b.AllowTool(types.ToolShell, t0)).To(Succeed())
+			Expect(b.AllowTool(types.ToolShell, t0)).To(MatchError(ContainSubstring("shell")))
+			b.ChargeLLMTokens(7, t0)
+			b.ChargeCost(0.25, t0)
+
+			Expect(b.AllowStep(types.Step{}, t0)).To(Succeed())
+			Expect(b.AllowStep(types.Step{}, t0)).To(Succeed())
+
+			s := parent.Snapshot(t0)
+			Expect(s.ShellUsed).To(Equal(2))
+			Expect(s.LLMTokensUsed).To(Equal(7))
+			Expect(s.CostUSD).To(Equal(0.25))
+			Expect(s.StepsUsed).To(Equal(0))
+		})
+
+		it("stops when the parent budget runs out", func() {
+			t0 := time.Date(2026, 1, 13, 9, 0, 0, 0, time.UTC)
+
+			parent := core.NewDefaultBudget(core.BudgetLimits{MaxLLMCalls: 1})
+			Expect(parent.AllowTool(types.ToolLLM, t0)).To(Succeed())
+
+			b := core.NewSubBudget(parent, core.BudgetLimits{MaxLLMCalls: 3})
+			err := b.AllowTool(types.ToolLLM, t0)
+
+			var be core.BudgetExceededError
+			Expect(errors.As(err, &be)).To(BeTrue())
+			Expect(be.Kind).To(Equal(core.BudgetKindLLM))
+		})
+	})
+
+	when("CarveBudget()", func() {
+		it("hands out a share of what is left, at least 1, and keeps unlimited limits", func() {
+			t0 := time.Date(2026, 1, 13, 9, 0, 0, 0, time.UTC)
+
+			parent := core.NewDefaultBudget(core.BudgetLimits{
+				MaxSteps:      10,
+				MaxIterations: 8,
+				MaxWallTime:   time.Minute,
+				MaxLLMCalls:   10,
+				MaxShellCalls: 2,
+				MaxLLMTokens:  1000,
+			})
+			for i := 0; i < 4; i++ {
+				Expect(parent.AllowTool(types.ToolLLM, t0)).To(Succeed())
+			}
+			Expect(parent.AllowTool(types.ToolShell, t0)).To(Succeed())
+			parent.ChargeLLMTokens(200, t0)
+
+			limits := core.CarveBudget(parent.Snapshot(t0.Add(20*time.Second)), 0.5)
+			Expect(limits).To(Equal(core.BudgetLimits{
+				MaxSteps:      10,
+				MaxIterations: 8,
+				MaxWallTime:   20 * time.Second,
+				MaxLLMCalls:   3,
+				MaxShellCalls: 1,
+				MaxLLMTokens:  400,
+			}))
+		})
 	})
 }
@@ -0,0 +1,52 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: github.com/kardolus/chatgpt-cli/agent/core (interfaces: Delegator)
+
+// Package core_test is a generated GoMock package.
+package core_test
+
+import (
+	context "context"
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+	core "github.com/kardolus/chatgpt-cli/agent/core"
+	types "github.com/kardolus/chatgpt-cli/agent/types"
+)
+
+// MockDelegator is a mock of Delegator interface.
+type MockDelegator struct {
+	ctrl     *gomock.Controller
+	recorder *MockDelegatorMockRecorder
+}
+
+// MockDelegatorMockRecorder is the mock recorder for MockDelegator.
+type MockDelegatorMockRecorder struct {
+	mock *MockDelegator
+}
+
+// NewMockDelegator creates a new mock instance.
+func NewMockDelegator(ctrl *gomock.Controller) *MockDelegator {
+	mock := &MockDelegator{ctrl: ctrl}
+	mock.recorder = &MockDelegatorMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockDelegator) EXPECT() *MockDelegatorMockRecorder {
+	return m.recorder
+}
+
+// Delegate mocks base method.
+func (m *MockDelegator) Delegate(arg0 context.Context, arg1 types.Config, arg2 types.Step) (core.DelegateResult, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Delegate", arg0, arg1, arg2)
+	ret0, _ := ret[0].(core.DelegateResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Delegate indicates an expected call of Delegate.
+func (mr *MockDelegatorMockRecorder) Delegate(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delegate", reflect.TypeOf((*MockDelegator)(nil).Delegate), arg0, arg1, arg2)
+}
@@ -34,6 +34,63 @@ func (m *MockFiles) EXPECT() *MockFilesMockRecorder {
 	return m.recorder
 }
 
+// Delete mocks base method.
+func (m *MockFiles) Delete(arg0 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Delete", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Delete indicates an expected call of Delete.
+func (mr *MockFilesMockRecorder) Delete(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockFiles)(nil).Delete), arg0)
+}
+
+// List mocks base method.
+func (m *MockFiles) List(arg0 string, arg1 int, arg2 string) (tools.ListResult, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "List", arg0, arg1, arg2)
+	ret0, _ := ret[0].(tools.ListResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// List indicates an expected call of List.
+func (mr *MockFilesMockRecorder) List(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockFiles)(nil).List), arg0, arg1, arg2)
+}
+
+// Mkdir mocks base method.
+func (m *MockFiles) Mkdir(arg0 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Mkdir", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Mkdir indicates an expected call of Mkdir.
+func (mr *MockFilesMockRecorder) Mkdir(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Mkdir", reflect.TypeOf((*MockFiles)(nil).Mkdir), arg0)
+}
+
+// Move mocks base method.
+func (m *MockFiles) Move(arg0, arg1 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Move", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Move indicates an expected call of Move.
+func (mr *MockFilesMockRecorder) Move(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Move", reflect.TypeOf((*MockFiles)(nil).Move), arg0, arg1)
+}
+
 // PatchFile mocks base method.
 func (m *MockFiles) PatchFile(arg0 string, arg1 []byte) (tools.PatchResult, error) {
 	m.ctrl.T.Helper()
@@ -64,6 +121,21 @@ func (mr *MockFilesMockRecorder) ReadFile(arg0 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReadFile", reflect.TypeOf((*MockFiles)(nil).ReadFile), arg0)
 }
 
+// ReadLines mocks base method.
+func (m *MockFiles) ReadLines(arg0 string, arg1, arg2 int) (tools.ReadResult, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReadLines", arg0, arg1, arg2)
+	ret0, _ := ret[0].(tools.ReadResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReadLines indicates an expected call of ReadLines.
+func (mr *MockFilesMockRecorder) ReadLines(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReadLines", reflect.TypeOf((*MockFiles)(nil).ReadLines), arg0, arg1, arg2)
+}
+
 // ReplaceBytesInFile mocks base method.
 func (m *MockFiles) ReplaceBytesInFile(arg0 string, arg1, arg2 []byte, arg3 int) (tools.ReplaceResult, error) {
 	m.ctrl.T.Helper()
@@ -79,6 +151,36 @@ func (mr *MockFilesMockRecorder) ReplaceBytesInFile(arg0, arg1, arg2, arg3 inter
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReplaceBytesInFile", reflect.TypeOf((*MockFiles)(nil).ReplaceBytesInFile), arg0, arg1, arg2, arg3)
 }
 
+// Search mocks base method.
+func (m *MockFiles) Search(arg0, arg1, arg2 string) (tools.SearchResult, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Search", arg0, arg1, arg2)
+	ret0, _ := ret[0].(tools.SearchResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Search indicates an expected call of Search.
+func (mr *MockFilesMockRecorder) Search(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Search", reflect.TypeOf((*MockFiles)(nil).Search), arg0, arg1, arg2)
+}
+
+// Stat mocks base method.
+func (m *MockFiles) Stat(arg0 string) (tools.StatResult, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Stat", arg0)
+	ret0, _ := ret[0].(tools.StatResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Stat indicates an expected call of Stat.
+func (mr *MockFilesMockRecorder) Stat(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Stat", reflect.TypeOf((*MockFiles)(nil).Stat), arg0)
+}
+
 // WriteFile mocks base method.
 func (m *MockFiles) WriteFile(arg0 string, arg1 []byte) error {
 	m.ctrl.T.Helper()
@@ -15,6 +15,9 @@ type Logs struct {
 	HumanPath string
 	DebugPath string
 
+	// DelegatesDir holds the transcripts of child agents and the delegation tree of the run.
+	DelegatesDir string
+
 	HumanLogger *zap.SugaredLogger
 	DebugLogger *zap.SugaredLogger
 
@@ -58,6 +61,12 @@ func NewLogs() (*Logs, error) {
 	humanPath := filepath.Join(dir, "agent.transcript.log")
 	debugPath := filepath.Join(dir, "agent.debug.jsonl")
 
+	// Child agents of an earlier run don't belong to this one.
+	delegatesDir := filepath.Join(dir, "delegates")
+	if err := os.RemoveAll(delegatesDir); err != nil {
+		return nil, err
+	}
+
 	humanSug, humanZap, humanFile, err := newFileLogger(humanPath, zapcore.InfoLevel, false /* json */)
 	if err != nil {
 		return nil, err
@@ -71,15 +80,16 @@ func NewLogs() (*Logs, error) {
 	}
 
 	return &Logs{
-		Dir:         dir,
-		HumanPath:   humanPath,
-		DebugPath:   debugPath,
-		HumanLogger: humanSug,
-		DebugLogger: debugSug,
-		HumanZap:    humanZap,
-		DebugZap:    debugZap,
-		humanFile:   humanFile,
-		debugFile:   debugFile,
+		Dir:          dir,
+		HumanPath:    humanPath,
+		DebugPath:    debugPath,
+		DelegatesDir: delegatesDir,
+		HumanLogger:  humanSug,
+		DebugLogger:  debugSug,
+		HumanZap:     humanZap,
+		DebugZap:     debugZap,
+		humanFile:    humanFile,
+		debugFile:    debugFile,
 	}, nil
 }
 
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"github.com/kardolus/chatgpt-cli/agent/types"
 	"go.uber.org/zap"
+	"net/url"
 	"path/filepath"
 	"strings"
 )
@@ -18,6 +19,8 @@ const (
 	PolicyKindShell          = "shell"
 	PolicyKindLLM            = "llm"
 	PolicyKindFiles          = "files"
+	PolicyKindHTTP           = "http"
+	PolicyKindDelegate       = "delegate"
 	PolicyKindPathEscape     = "path_escape"
 	PolicyKindShellExpansion = "shell_expansion"
 )
@@ -31,15 +34,34 @@ type PolicyLimits struct {
 	RestrictFilesToWorkDir bool
 	DeniedShellCommands    []string
 	AllowedFileOps         []string
+
+	// AllowedDomains lists the hosts http steps may reach; an entry also allows its
+	// subdomains and "*" allows any host. No entries means no host is allowed.
+	// AllowedHTTPMethods defaults to GET and HEAD.
+	AllowedDomains     []string
+	AllowedHTTPMethods []string
 }
 
+var (
+	// HTTPMethods lists the methods http steps may use.
+	HTTPMethods        = []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}
+	defaultHTTPMethods = []string{"GET", "HEAD"}
+)
+
 func NewDefaultPolicy(limits PolicyLimits) *DefaultPolicy {
 	return &DefaultPolicy{limits: limits}
 }
 
 func (p *DefaultPolicy) AllowStep(cfg types.Config, step types.Step) error {
+	return p.allowStep(cfg, step, true)
+}
+
+// allowStep checks that step is well-formed and stays in the work dir. The allow and deny
+// lists of the limits are skipped unless checkLists is set, so that policy rules can
+// override them.
+func (p *DefaultPolicy) allowStep(cfg types.Config, step types.Step, checkLists bool) error {
 	switch step.Type {
-	case types.ToolShell, types.ToolLLM, types.ToolFiles:
+	case types.ToolShell, types.ToolLLM, types.ToolFiles, types.ToolHTTP, types.ToolMemory, types.ToolDelegate:
 		// ok
 	default:
 		return PolicyDeniedError{
@@ -48,7 +70,7 @@ func (p *DefaultPolicy) AllowStep(cfg types.Config, step types.Step) error {
 		}
 	}
 
-	if len(p.limits.AllowedTools) > 0 && !containsTool(p.limits.AllowedTools, step.Type) {
+	if checkLists && len(p.limits.AllowedTools) > 0 && !containsTool(p.limits.AllowedTools, step.Type) {
 		return PolicyDeniedError{
 			Kind:   PolicyKindStepType,
 			Reason: fmt.Sprintf("tool not allowed: %s", step.Type),
@@ -61,7 +83,9 @@ func (p *DefaultPolicy) AllowStep(cfg types.Config, step types.Step) error {
 		if cmd == "" {
 			return PolicyDeniedError{Kind: PolicyKindShell, Reason: "shell step requires Command"}
 		}
-		if len(p.limits.DeniedShellCommands) > 0 && containsString(p.limits.DeniedShellCommands, cmd) {
+		// A denied command is denied under any path, e.g. /bin/rm or ./rm for rm.
+		if checkLists && len(p.limits.DeniedShellCommands) > 0 &&
+			(containsString(p.limits.DeniedShellCommands, cmd) || containsString(p.limits.DeniedShellCommands, filepath.Base(cmd))) {
 			return PolicyDeniedError{Kind: PolicyKindShell, Reason: fmt.Sprintf("shell command denied: %s", cmd)}
 		}
 
@@ -103,25 +127,109 @@ func (p *DefaultPolicy) AllowStep(cfg types.Config, step types.Step) error {
 					Reason: "replace requires Old pattern",
 				}
 			}
+		case "search":
+			if step.Pattern == "" {
+				return PolicyDeniedError{Kind: PolicyKindFiles, Reason: "search requires Pattern"}
+			}
+		case "move":
+			if strings.TrimSpace(step.Dest) == "" {
+				return PolicyDeniedError{Kind: PolicyKindFiles, Reason: "move requires Dest"}
+			}
 		}
 
-		if !fileOpAllowed(p.limits.AllowedFileOps, op) {
+		if checkLists && !fileOpAllowed(p.limits.AllowedFileOps, op) {
 			return PolicyDeniedError{Kind: PolicyKindFiles, Reason: fmt.Sprintf("file op not allowed: %s", op)}
 		}
 
 		if p.limits.RestrictFilesToWorkDir && cfg.WorkDir != "" {
-			if escapesWorkDir(cfg.WorkDir, step.Path) {
-				return PolicyDeniedError{
-					Kind:   PolicyKindPathEscape,
-					Reason: fmt.Sprintf("path escapes workdir: workdir=%q path=%q", cfg.WorkDir, step.Path),
+			for _, path := range stepPaths(step) {
+				if escapesWorkDir(cfg.WorkDir, path) {
+					return PolicyDeniedError{
+						Kind:   PolicyKindPathEscape,
+						Reason: fmt.Sprintf("path escapes workdir: workdir=%q path=%q", cfg.WorkDir, path),
+					}
 				}
 			}
 		}
+
+	case types.ToolHTTP:
+		method := HTTPMethod(step)
+		if !containsString(HTTPMethods, method) {
+			return PolicyDeniedError{Kind: PolicyKindHTTP, Reason: fmt.Sprintf("unsupported http method: %s", method)}
+		}
+		u, err := url.Parse(strings.TrimSpace(step.URL))
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+			return PolicyDeniedError{Kind: PolicyKindHTTP, Reason: fmt.Sprintf("http step requires an http(s) URL: %q", step.URL)}
+		}
+
+		if checkLists {
+			allowedMethods := p.limits.AllowedHTTPMethods
+			if len(allowedMethods) == 0 {
+				allowedMethods = defaultHTTPMethods
+			}
+			if !containsFold(allowedMethods, method) {
+				return PolicyDeniedError{Kind: PolicyKindHTTP, Reason: fmt.Sprintf("http method not allowed: %s", method)}
+			}
+			if !domainAllowed(p.limits.AllowedDomains, u.Hostname()) {
+				return PolicyDeniedError{Kind: PolicyKindHTTP, Reason: fmt.Sprintf("domain not allowed: %s", u.Hostname())}
+			}
+		}
+
+	case types.ToolDelegate:
+		if strings.TrimSpace(step.Goal) == "" {
+			return PolicyDeniedError{Kind: PolicyKindDelegate, Reason: "delegate step requires Goal"}
+		}
+		switch step.AgentMode {
+		case "", "react", "plan":
+		default:
+			return PolicyDeniedError{Kind: PolicyKindDelegate, Reason: fmt.Sprintf("unknown agent mode: %s", step.AgentMode)}
+		}
+		for _, k := range step.Tools {
+			switch k {
+			case types.ToolShell, types.ToolLLM, types.ToolFiles, types.ToolHTTP, types.ToolMemory, types.ToolDelegate:
+			default:
+				return PolicyDeniedError{Kind: PolicyKindDelegate, Reason: fmt.Sprintf("unknown tool: %s", k)}
+			}
+		}
 	}
 
 	return nil
 }
 
+// toolsPolicy only allows steps of some tools, on top of what its policy allows.
+type toolsPolicy struct {
+	Policy
+	tools []types.ToolKind
+}
+
+// RestrictTools returns a policy that denies the steps of tools not in kinds and leaves
+// the other steps to p. A child agent gets one when its parent narrows its tools.
+func RestrictTools(p Policy, kinds []types.ToolKind) Policy {
+	if len(kinds) == 0 {
+		return p
+	}
+	return toolsPolicy{Policy: p, tools: kinds}
+}
+
+func (p toolsPolicy) AllowStep(cfg types.Config, step types.Step) error {
+	if !containsTool(p.tools, step.Type) {
+		return PolicyDeniedError{
+			Kind:   PolicyKindStepType,
+			Reason: fmt.Sprintf("tool not allowed for this sub-agent: %s", step.Type),
+		}
+	}
+	return p.Policy.AllowStep(cfg, step)
+}
+
+// HTTPMethod returns the upper-cased method of an http step, GET when it has none.
+func HTTPMethod(step types.Step) string {
+	method := strings.ToUpper(strings.TrimSpace(step.Method))
+	if method == "" {
+		return "GET"
+	}
+	return method
+}
+
 // denyShellArgsOutsideWorkDir blocks absolute paths, ~, .., and any arg that would escape workdir.
 func denyShellArgsOutsideWorkDir(workdir string, args []string) error {
 	for _, raw := range args {
@@ -260,6 +368,27 @@ func escapesWorkDir(workdir, path string) bool {
 	return !strings.HasPrefix(full, prefix)
 }
 
+func containsFold(xs []string, s string) bool {
+	for _, x := range xs {
+		if strings.EqualFold(strings.TrimSpace(x), s) {
+			return true
+		}
+	}
+	return false
+}
+
+// domainAllowed reports whether host is one of the allowed domains or a subdomain of one.
+func domainAllowed(allowed []string, host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, d := range allowed {
+		d = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(d), "*."))
+		if d == "*" || host == d || strings.HasSuffix(host, "."+d) {
+			return true
+		}
+	}
+	return false
+}
+
 func fileOpAllowed(allowed []string, op string) bool {
 	if len(allowed) == 0 {
 		return true
@@ -267,9 +396,21 @@ func fileOpAllowed(allowed []string, op string) bool {
 	if containsString(allowed, op) {
 		return true
 	}
-	// If you can write arbitrary bytes, you can also patch/replace.
-	if (op == "patch" || op == "replace") && containsString(allowed, "write") {
+	// If you can write arbitrary bytes, you can also patch/replace and create directories.
+	if (op == "patch" || op == "replace" || op == "mkdir") && containsString(allowed, "write") {
+		return true
+	}
+	// Discovery only reveals what read already can. Move and delete must be listed.
+	if (op == "list" || op == "search" || op == "stat") && containsString(allowed, "read") {
 		return true
 	}
 	return false
 }
+
+// stepPaths returns the paths a file step touches: Path, and Dest for a move.
+func stepPaths(step types.Step) []string {
+	if strings.TrimSpace(step.Dest) != "" {
+		return []string{step.Path, step.Dest}
+	}
+	return []string{step.Path}
+}
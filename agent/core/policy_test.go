@@ -86,6 +86,17 @@ func testPolicy(t *testing.T, when spec.G, it spec.S) {
 				Expect(err.Error()).To(ContainSubstring("rm"))
 			})
 
+			it("denies denylisted shell commands run by path", func() {
+				p := core.NewDefaultPolicy(core.PolicyLimits{
+					DeniedShellCommands: []string{"rm"},
+				})
+
+				for _, cmd := range []string{"/bin/rm", "./rm", "../../usr/bin/rm"} {
+					err := p.AllowStep(types.Config{WorkDir: "/tmp"}, types.Step{Type: types.ToolShell, Command: cmd})
+					Expect(err).To(MatchError(ContainSubstring("shell command denied: "+cmd)), cmd)
+				}
+			})
+
 			it("allows shell commands not in denylist", func() {
 				p := core.NewDefaultPolicy(core.PolicyLimits{
 					DeniedShellCommands: []string{"rm"},
@@ -611,6 +622,132 @@ func testPolicy(t *testing.T, when spec.G, it spec.S) {
 				Expect(err).To(HaveOccurred())
 				Expect(err.Error()).To(ContainSubstring("file op not allowed"))
 			})
+
+			it("lets read imply list/search/stat and write imply mkdir, but requires move/delete to be listed", func() {
+				p := core.NewDefaultPolicy(core.PolicyLimits{
+					AllowedFileOps: []string{"read", "write"},
+				})
+				cfg := types.Config{WorkDir: "/tmp"}
+
+				for _, step := range []types.Step{
+					{Type: types.ToolFiles, Op: "list", Path: "."},
+					{Type: types.ToolFiles, Op: "search", Path: ".", Pattern: "TODO"},
+					{Type: types.ToolFiles, Op: "stat", Path: "a.txt"},
+					{Type: types.ToolFiles, Op: "mkdir", Path: "out"},
+				} {
+					Expect(p.AllowStep(cfg, step)).To(Succeed(), step.Op)
+				}
+
+				for _, step := range []types.Step{
+					{Type: types.ToolFiles, Op: "move", Path: "a.txt", Dest: "b.txt"},
+					{Type: types.ToolFiles, Op: "delete", Path: "a.txt"},
+				} {
+					Expect(p.AllowStep(cfg, step)).To(MatchError(ContainSubstring("file op not allowed: " + step.Op)))
+				}
+
+				p = core.NewDefaultPolicy(core.PolicyLimits{AllowedFileOps: []string{"write"}})
+				Expect(p.AllowStep(cfg, types.Step{Type: types.ToolFiles, Op: "list", Path: "."})).
+					To(MatchError(ContainSubstring("file op not allowed: list")))
+			})
+
+			it("denies search without Pattern and move without Dest", func() {
+				p := core.NewDefaultPolicy(core.PolicyLimits{})
+
+				Expect(p.AllowStep(types.Config{}, types.Step{Type: types.ToolFiles, Op: "search", Path: "."})).
+					To(MatchError(ContainSubstring("search requires Pattern")))
+				Expect(p.AllowStep(types.Config{}, types.Step{Type: types.ToolFiles, Op: "move", Path: "a.txt"})).
+					To(MatchError(ContainSubstring("move requires Dest")))
+			})
+
+			it("restricts the destination of a move to WorkDir", func() {
+				wd := t.TempDir()
+				p := core.NewDefaultPolicy(core.PolicyLimits{RestrictFilesToWorkDir: true})
+				cfg := types.Config{WorkDir: wd}
+
+				Expect(p.AllowStep(cfg, types.Step{Type: types.ToolFiles, Op: "move", Path: "a.txt", Dest: "sub/a.txt"})).To(Succeed())
+
+				err := p.AllowStep(cfg, types.Step{Type: types.ToolFiles, Op: "move", Path: "a.txt", Dest: "../a.txt"})
+				Expect(err).To(MatchError(ContainSubstring("path escapes workdir")))
+				Expect(err.Error()).To(ContainSubstring(`path="../a.txt"`))
+			})
+		})
+
+		when("HTTP steps", func() {
+			it("requires an http(s) URL and a known method", func() {
+				p := core.NewDefaultPolicy(core.PolicyLimits{AllowedDomains: []string{"*"}})
+
+				for _, u := range []string{"", "go.dev/doc", "file:///etc/passwd", "https://"} {
+					err := p.AllowStep(types.Config{}, types.Step{Type: types.ToolHTTP, URL: u})
+					Expect(err).To(MatchError(ContainSubstring("http step requires an http(s) URL")), u)
+				}
+
+				err := p.AllowStep(types.Config{}, types.Step{Type: types.ToolHTTP, Method: "TRACE", URL: "https://go.dev"})
+				Expect(err).To(MatchError(ContainSubstring("unsupported http method: TRACE")))
+			})
+
+			it("only reaches allowed domains and their subdomains", func() {
+				p := core.NewDefaultPolicy(core.PolicyLimits{AllowedDomains: []string{"go.dev", "*.example.com"}})
+
+				for _, u := range []string{"https://go.dev/doc", "https://pkg.go.dev/std", "http://api.example.com:8080/v1"} {
+					Expect(p.AllowStep(types.Config{}, types.Step{Type: types.ToolHTTP, URL: u})).To(Succeed(), u)
+				}
+				for _, u := range []string{"https://notgo.dev", "https://go.dev.evil.com", "https://example.org"} {
+					err := p.AllowStep(types.Config{}, types.Step{Type: types.ToolHTTP, URL: u})
+					Expect(err).To(MatchError(ContainSubstring("domain not allowed")), u)
+				}
+
+				err := core.NewDefaultPolicy(core.PolicyLimits{}).
+					AllowStep(types.Config{}, types.Step{Type: types.ToolHTTP, URL: "https://go.dev"})
+				Expect(err).To(MatchError(ContainSubstring("domain not allowed: go.dev")))
+			})
+
+			it("allows GET and HEAD unless other methods are listed", func() {
+				p := core.NewDefaultPolicy(core.PolicyLimits{AllowedDomains: []string{"go.dev"}})
+
+				Expect(p.AllowStep(types.Config{}, types.Step{Type: types.ToolHTTP, Method: "head", URL: "https://go.dev"})).To(Succeed())
+				Expect(p.AllowStep(types.Config{}, types.Step{Type: types.ToolHTTP, Method: "POST", URL: "https://go.dev"})).
+					To(MatchError(ContainSubstring("http method not allowed: POST")))
+
+				p = core.NewDefaultPolicy(core.PolicyLimits{AllowedDomains: []string{"go.dev"}, AllowedHTTPMethods: []string{"get", "post"}})
+				Expect(p.AllowStep(types.Config{}, types.Step{Type: types.ToolHTTP, Method: "POST", URL: "https://go.dev"})).To(Succeed())
+			})
+		})
+
+		when("delegate steps", func() {
+			it("requires a goal, a known mode and known tools", func() {
+				p := core.NewDefaultPolicy(core.PolicyLimits{})
+
+				Expect(p.AllowStep(types.Config{}, types.Step{Type: types.ToolDelegate, Goal: "fix the tests", AgentMode: "plan"})).To(Succeed())
+
+				err := p.AllowStep(types.Config{}, types.Step{Type: types.ToolDelegate, Goal: "  "})
+				Expect(err).To(MatchError(ContainSubstring("delegate step requires Goal")))
+
+				err = p.AllowStep(types.Config{}, types.Step{Type: types.ToolDelegate, Goal: "g", AgentMode: "swarm"})
+				Expect(err).To(MatchError(ContainSubstring("unknown agent mode: swarm")))
+
+				err = p.AllowStep(types.Config{}, types.Step{Type: types.ToolDelegate, Goal: "g", Tools: []types.ToolKind{"browser"}})
+				Expect(err).To(MatchError(ContainSubstring("unknown tool: browser")))
+			})
+		})
+	})
+
+	when("RestrictTools()", func() {
+		it("denies the tools the sub-agent didn't get and leaves the rest to the policy", func() {
+			p := core.RestrictTools(core.NewDefaultPolicy(core.PolicyLimits{
+				DeniedShellCommands: []string{"rm"},
+			}), []types.ToolKind{types.ToolShell, types.ToolLLM})
+
+			Expect(p.AllowStep(types.Config{}, types.Step{Type: types.ToolShell, Command: "ls"})).To(Succeed())
+			Expect(p.AllowStep(types.Config{}, types.Step{Type: types.ToolShell, Command: "rm"})).
+				To(MatchError(ContainSubstring("shell command denied")))
+
+			err := p.AllowStep(types.Config{}, types.Step{Type: types.ToolFiles, Op: "read", Path: "a.txt"})
+			Expect(err).To(MatchError(ContainSubstring("tool not allowed for this sub-agent: file")))
+		})
+
+		it("returns the policy as is without tools", func() {
+			inner := core.NewDefaultPolicy(core.PolicyLimits{})
+			Expect(core.RestrictTools(inner, nil)).To(BeIdenticalTo(inner))
 		})
 	})
 }
@@ -0,0 +1,456 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/kardolus/chatgpt-cli/agent/types"
+	"gopkg.in/yaml.v3"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+const (
+	ActionAllow = "allow"
+	ActionDeny  = "deny"
+	ActionAsk   = "ask"
+
+	PolicyKindRule = "rule"
+
+	// DecidedByBuiltin names the built-in policy in decisions about steps no rule matched.
+	DecidedByBuiltin = "built-in policy"
+)
+
+// PolicyRules is the content of an agent policy file. Rules are evaluated in order and the
+// first rule that matches a step decides. Steps that no rule matches get the Default
+// action, or go through the built-in policy when there is no default.
+//
+//	default: ask
+//	rules:
+//	  - name: tests
+//	    action: allow
+//	    command: go
+//	    args: test ./...
+//	  - action: deny
+//	    command: git
+//	    args: push*
+type PolicyRules struct {
+	Default string `yaml:"default"`
+	Rules   []Rule `yaml:"rules"`
+}
+
+// Rule matches steps by tool kind, by command, arguments or a regular expression over the
+// command line for shell steps, and by path and op for file steps. Empty fields match
+// anything.
+type Rule struct {
+	Name   string `yaml:"name"`
+	Action string `yaml:"action"`
+
+	Tool string `yaml:"tool"`
+
+	// Command globs match the command or its base name. Args globs match the arguments
+	// joined by spaces, where * also matches spaces; "" matches no arguments. Regex is
+	// matched against the whole command line.
+	Command Patterns `yaml:"command"`
+	Args    Patterns `yaml:"args"`
+	Regex   string   `yaml:"regex"`
+
+	// Path globs support **; a glob without a slash matches the base name. Paths inside the
+	// work dir are matched relative to it. Both paths of a move are matched.
+	Path Patterns `yaml:"path"`
+	Op   Patterns `yaml:"op"`
+
+	command, args, path []*regexp.Regexp
+	regex               *regexp.Regexp
+}
+
+// Patterns is a list of patterns that may be written as a single string.
+type Patterns []string
+
+func (p *Patterns) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*p = Patterns{node.Value}
+		return nil
+	}
+	var list []string
+	if err := node.Decode(&list); err != nil {
+		return err
+	}
+	*p = list
+	return nil
+}
+
+// PolicyDecision records how the policy decided on a step.
+type PolicyDecision struct {
+	Step   types.Step
+	Action string
+
+	// Rule is the rule that matched, "default" or DecidedByBuiltin.
+	Rule string
+
+	// Reason explains a denial.
+	Reason string
+}
+
+// LoadPolicyRules reads and validates a policy file.
+func LoadPolicyRules(path string) (*PolicyRules, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy file: %w", err)
+	}
+
+	rules, err := ParsePolicyRules(data)
+	if err != nil {
+		return nil, fmt.Errorf("policy file %s: %w", path, err)
+	}
+	return rules, nil
+}
+
+// ParsePolicyRules parses and validates the YAML of a policy file.
+func ParsePolicyRules(data []byte) (*PolicyRules, error) {
+	var rules PolicyRules
+
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&rules); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	rules.Default = strings.ToLower(strings.TrimSpace(rules.Default))
+	if rules.Default != "" && !isAction(rules.Default) {
+		return nil, fmt.Errorf("invalid default %q (expected allow|deny|ask)", rules.Default)
+	}
+
+	for i := range rules.Rules {
+		if err := rules.Rules[i].compile(); err != nil {
+			return nil, fmt.Errorf("%s: %w", rules.Rules[i].label(i), err)
+		}
+	}
+	return &rules, nil
+}
+
+// Decide returns the decision of the first matching rule, or of the default. The Rule of
+// the decision is empty when neither applies.
+func (r *PolicyRules) Decide(cfg types.Config, step types.Step) PolicyDecision {
+	for i := range r.Rules {
+		if r.Rules[i].matches(cfg, step) {
+			return PolicyDecision{Step: step, Action: r.Rules[i].Action, Rule: r.Rules[i].label(i)}
+		}
+	}
+	if r.Default != "" {
+		return PolicyDecision{Step: step, Action: r.Default, Rule: "default"}
+	}
+	return PolicyDecision{Step: step}
+}
+
+// RulePolicy applies a policy file on top of the checks of the DefaultPolicy. Steps that a
+// rule allows skip the tool, command and file op lists of the limits, but still have to be
+// well-formed and stay in the work dir. Decisions are made one at a time, so the asker and
+// the observer never run concurrently.
+type RulePolicy struct {
+	mu      sync.Mutex
+	rules   *PolicyRules
+	base    *DefaultPolicy
+	ask     func(step types.Step, rule string) (bool, error)
+	observe func(PolicyDecision)
+}
+
+type RulePolicyOption func(*RulePolicy)
+
+// WithAsker sets the function that asks the user about steps an ask rule matched. Without
+// one, those steps are denied.
+func WithAsker(ask func(step types.Step, rule string) (bool, error)) RulePolicyOption {
+	return func(p *RulePolicy) { p.ask = ask }
+}
+
+// WithDecisionObserver receives every decision, e.g. to explain them after a dry run.
+func WithDecisionObserver(observe func(PolicyDecision)) RulePolicyOption {
+	return func(p *RulePolicy) { p.observe = observe }
+}
+
+func NewRulePolicy(rules *PolicyRules, limits PolicyLimits, opts ...RulePolicyOption) *RulePolicy {
+	p := &RulePolicy{rules: rules, base: NewDefaultPolicy(limits)}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+func (p *RulePolicy) AllowStep(cfg types.Config, step types.Step) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	decision := p.rules.Decide(cfg, step)
+	err := p.decide(cfg, step, &decision)
+
+	if err != nil {
+		decision.Action = ActionDeny
+		decision.Reason = err.Error()
+		var pe PolicyDeniedError
+		if errors.As(err, &pe) {
+			decision.Reason = pe.Reason
+		}
+	}
+	if p.observe != nil {
+		p.observe(decision)
+	}
+	return err
+}
+
+func (p *RulePolicy) decide(cfg types.Config, step types.Step, decision *PolicyDecision) error {
+	switch decision.Action {
+	case ActionDeny:
+		return PolicyDeniedError{Kind: PolicyKindRule, Reason: "denied by " + decision.Rule}
+	case ActionAllow:
+		return p.base.allowStep(cfg, step, false)
+	case ActionAsk:
+		if err := p.base.allowStep(cfg, step, false); err != nil {
+			return err
+		}
+		if p.ask == nil {
+			return PolicyDeniedError{Kind: PolicyKindRule, Reason: decision.Rule + " requires confirmation"}
+		}
+		ok, err := p.ask(step, decision.Rule)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return PolicyDeniedError{Kind: PolicyKindRule, Reason: "declined by the user"}
+		}
+		return nil
+	default:
+		decision.Action = ActionAllow
+		decision.Rule = DecidedByBuiltin
+		return p.base.AllowStep(cfg, step)
+	}
+}
+
+// DescribeStep summarizes a step in one line, e.g. "shell: git push origin".
+func DescribeStep(step types.Step) string {
+	switch step.Type {
+	case types.ToolShell:
+		return strings.TrimSpace("shell: " + step.Command + " " + strings.Join(step.Args, " "))
+	case types.ToolFiles:
+		if step.Dest != "" {
+			return fmt.Sprintf("file %s: %s -> %s", step.Op, step.Path, step.Dest)
+		}
+		return fmt.Sprintf("file %s: %s", step.Op, step.Path)
+	case types.ToolLLM:
+		prompt := strings.Join(strings.Fields(step.Prompt), " ")
+		if len(prompt) > 60 {
+			prompt = prompt[:57] + "..."
+		}
+		return "llm: " + prompt
+	case types.ToolHTTP:
+		return fmt.Sprintf("http %s: %s", HTTPMethod(step), step.URL)
+	case types.ToolMemory:
+		return "memory: " + step.Fact
+	case types.ToolDelegate:
+		goal := strings.Join(strings.Fields(step.Goal), " ")
+		if len(goal) > 60 {
+			goal = goal[:57] + "..."
+		}
+		return "delegate: " + goal
+	default:
+		return string(step.Type)
+	}
+}
+
+func (r *Rule) compile() error {
+	r.Action = strings.ToLower(strings.TrimSpace(r.Action))
+	if !isAction(r.Action) {
+		return fmt.Errorf("invalid action %q (expected allow|deny|ask)", r.Action)
+	}
+
+	r.Tool = strings.ToLower(strings.TrimSpace(r.Tool))
+	switch r.Tool {
+	case "", string(types.ToolShell), string(types.ToolLLM), string(types.ToolFiles), string(types.ToolHTTP), string(types.ToolMemory), string(types.ToolDelegate):
+	case "files":
+		r.Tool = string(types.ToolFiles)
+	default:
+		return fmt.Errorf("invalid tool %q (expected shell|llm|file|http|memory|delegate)", r.Tool)
+	}
+
+	shellFields := len(r.Command) > 0 || r.Args != nil || r.Regex != ""
+	fileFields := len(r.Path) > 0 || len(r.Op) > 0
+	if shellFields && fileFields {
+		return errors.New("command, args and regex can't be combined with path and op")
+	}
+	if shellFields && r.Tool != "" && r.Tool != string(types.ToolShell) {
+		return fmt.Errorf("command, args and regex only apply to shell steps, not %s", r.Tool)
+	}
+	if fileFields && r.Tool != "" && r.Tool != string(types.ToolFiles) {
+		return fmt.Errorf("path and op only apply to file steps, not %s", r.Tool)
+	}
+
+	var err error
+	if r.command, err = compileGlobs(r.Command, true); err != nil {
+		return err
+	}
+	if r.args, err = compileGlobs(r.Args, false); err != nil {
+		return err
+	}
+	if r.path, err = compileGlobs(r.Path, true); err != nil {
+		return err
+	}
+	for i, op := range r.Op {
+		r.Op[i] = strings.ToLower(strings.TrimSpace(op))
+	}
+	if r.Regex != "" {
+		if r.regex, err = regexp.Compile(r.Regex); err != nil {
+			return fmt.Errorf("invalid regex: %w", err)
+		}
+	}
+	return nil
+}
+
+func (r *Rule) matches(cfg types.Config, step types.Step) bool {
+	if r.Tool != "" && r.Tool != string(step.Type) {
+		return false
+	}
+
+	if len(r.Command) > 0 || r.Args != nil || r.Regex != "" {
+		if step.Type != types.ToolShell {
+			return false
+		}
+		command := strings.TrimSpace(step.Command)
+		if len(r.command) > 0 && !r.matchCommand(command) {
+			return false
+		}
+		args := strings.Join(step.Args, " ")
+		if r.args != nil && !matchAny(r.args, args) {
+			return false
+		}
+		if r.regex != nil && !r.regex.MatchString(strings.TrimSpace(command+" "+args)) {
+			return false
+		}
+	}
+
+	if len(r.Path) > 0 || len(r.Op) > 0 {
+		if step.Type != types.ToolFiles {
+			return false
+		}
+		if len(r.Op) > 0 && !containsString(r.Op, strings.ToLower(strings.TrimSpace(step.Op))) {
+			return false
+		}
+		if len(r.path) > 0 && !r.matchPaths(cfg, step) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchCommand matches a command with a path only against the full name, so that an allow rule
+// for "git" doesn't allow "./git" from the workdir. Deny rules also match the base name, so that
+// denying "rm" covers "/bin/rm".
+func (r *Rule) matchCommand(command string) bool {
+	if matchAny(r.command, command) {
+		return true
+	}
+	return r.Action == ActionDeny && matchAny(r.command, filepath.Base(command))
+}
+
+// matchPaths matches both paths of a move. A deny rule needs only one of them to match,
+// other rules need both, so that a move can't carry a file out of or into a denied path.
+func (r *Rule) matchPaths(cfg types.Config, step types.Step) bool {
+	for _, path := range stepPaths(step) {
+		ok := matchPath(r.path, r.Path, relativePath(cfg.WorkDir, path))
+		if ok == (r.Action == ActionDeny) {
+			return ok
+		}
+	}
+	return r.Action != ActionDeny
+}
+
+func (r *Rule) label(i int) string {
+	if r.Name != "" {
+		return fmt.Sprintf("rule %d (%s)", i+1, r.Name)
+	}
+	return fmt.Sprintf("rule %d", i+1)
+}
+
+func isAction(s string) bool {
+	return s == ActionAllow || s == ActionDeny || s == ActionAsk
+}
+
+// compileGlobs turns globs into anchored regular expressions. With paths, * and ? stop at
+// a slash and ** matches across directories; otherwise * matches anything.
+func compileGlobs(globs []string, paths bool) ([]*regexp.Regexp, error) {
+	if globs == nil {
+		return nil, nil
+	}
+
+	result := make([]*regexp.Regexp, 0, len(globs))
+	for _, glob := range globs {
+		var sb strings.Builder
+		sb.WriteString("^")
+		for i := 0; i < len(glob); i++ {
+			switch c := glob[i]; {
+			case c == '*' && paths && strings.HasPrefix(glob[i:], "**/"):
+				sb.WriteString("(?:.*/)?")
+				i += 2
+			case c == '*' && paths && strings.HasPrefix(glob[i:], "**"):
+				sb.WriteString(".*")
+				i++
+			case c == '*' && paths:
+				sb.WriteString("[^/]*")
+			case c == '*':
+				sb.WriteString(".*")
+			case c == '?' && paths:
+				sb.WriteString("[^/]")
+			case c == '?':
+				sb.WriteString(".")
+			default:
+				sb.WriteString(regexp.QuoteMeta(string(c)))
+			}
+		}
+		sb.WriteString("$")
+
+		re, err := regexp.Compile(sb.String())
+		if err != nil {
+			return nil, fmt.Errorf("invalid glob %q: %w", glob, err)
+		}
+		result = append(result, re)
+	}
+	return result, nil
+}
+
+func matchAny(patterns []*regexp.Regexp, s string) bool {
+	for _, re := range patterns {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchPath(patterns []*regexp.Regexp, globs []string, path string) bool {
+	for i, re := range patterns {
+		target := path
+		if !strings.Contains(globs[i], "/") {
+			target = filepath.Base(path)
+		}
+		if re.MatchString(target) {
+			return true
+		}
+	}
+	return false
+}
+
+// relativePath returns path relative to workDir with forward slashes when it is inside,
+// and the cleaned path otherwise.
+func relativePath(workDir, path string) string {
+	path = filepath.Clean(path)
+	if workDir != "" && filepath.IsAbs(path) {
+		if wd, err := filepath.Abs(workDir); err == nil {
+			if rel, err := filepath.Rel(wd, path); err == nil && !strings.HasPrefix(rel, "..") {
+				path = rel
+			}
+		}
+	}
+	return filepath.ToSlash(path)
+}
@@ -0,0 +1,273 @@
+package core_test
+
+import (
+	"github.com/kardolus/chatgpt-cli/agent/core"
+	"github.com/kardolus/chatgpt-cli/agent/types"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+)
+
+func TestUnitRules(t *testing.T) {
+	spec.Run(t, "Testing policy rules", testRules, spec.Report(report.Terminal{}))
+}
+
+func testRules(t *testing.T, when spec.G, it spec.S) {
+	it.Before(func() {
+		RegisterTestingT(t)
+	})
+
+	shell := func(command string, args ...string) types.Step {
+		return types.Step{Type: types.ToolShell, Command: command, Args: args}
+	}
+	file := func(op, path string) types.Step {
+		return types.Step{Type: types.ToolFiles, Op: op, Path: path, Data: "x"}
+	}
+
+	mustParse := func(doc string) *core.PolicyRules {
+		rules, err := core.ParsePolicyRules([]byte(doc))
+		Expect(err).NotTo(HaveOccurred())
+		return rules
+	}
+
+	const example = `
+default: ask
+rules:
+  - name: tests
+    action: allow
+    command: go
+    args: test ./...
+  - action: allow
+    command: git
+    args: ["diff", "diff *"]
+  - name: no push
+    action: deny
+    command: git
+    args: push*
+`
+
+	when("ParsePolicyRules()", func() {
+		it("rejects invalid rules", func() {
+			for doc, msg := range map[string]string{
+				"rules: [{action: maybe}]":                    `rule 1: invalid action "maybe"`,
+				"default: sure":                               `invalid default "sure"`,
+				"rules: [{action: deny, tool: browser}]":      `invalid tool "browser"`,
+				"rules: [{action: deny, regex: '('}]":         "invalid regex",
+				"rules: [{action: deny, command: x, op: w}]":  "can't be combined",
+				"rules: [{action: deny, tool: llm, path: x}]": "only apply to file steps",
+				"rules: [{action: deny, commands: x}]":        "field commands not found",
+			} {
+				_, err := core.ParsePolicyRules([]byte(doc))
+				Expect(err).To(MatchError(ContainSubstring(msg)), doc)
+			}
+		})
+
+		it("accepts an empty file", func() {
+			rules := mustParse("")
+			Expect(rules.Rules).To(BeEmpty())
+		})
+	})
+
+	when("PolicyRules.Decide()", func() {
+		it("uses the first matching rule and falls back to the default", func() {
+			rules := mustParse(example)
+			cfg := types.Config{}
+
+			for step, want := range map[string]core.PolicyDecision{
+				"go test ./...":          {Action: core.ActionAllow, Rule: "rule 1 (tests)"},
+				"/usr/bin/go test ./...": {Action: core.ActionAsk, Rule: "default"},
+				"./go test ./...":        {Action: core.ActionAsk, Rule: "default"},
+				"/usr/bin/git push":      {Action: core.ActionDeny, Rule: "rule 3 (no push)"},
+				"git diff":               {Action: core.ActionAllow, Rule: "rule 2"},
+				"git diff --stat HEAD":   {Action: core.ActionAllow, Rule: "rule 2"},
+				"git push origin main":   {Action: core.ActionDeny, Rule: "rule 3 (no push)"},
+				"go build ./...":         {Action: core.ActionAsk, Rule: "default"},
+				"git status":             {Action: core.ActionAsk, Rule: "default"},
+			} {
+				command, args := splitCommand(step)
+				decision := rules.Decide(cfg, shell(command, args...))
+				Expect(decision.Action).To(Equal(want.Action), step)
+				Expect(decision.Rule).To(Equal(want.Rule), step)
+			}
+		})
+
+		it("matches an empty args pattern only without arguments", func() {
+			rules := mustParse(`rules: [{action: deny, command: ls, args: ""}]`)
+
+			Expect(rules.Decide(types.Config{}, shell("ls")).Action).To(Equal(core.ActionDeny))
+			Expect(rules.Decide(types.Config{}, shell("ls", "-l")).Rule).To(BeEmpty())
+		})
+
+		it("matches the command line against a regex", func() {
+			rules := mustParse(`rules: [{action: deny, regex: 'rm\s+-rf'}]`)
+
+			Expect(rules.Decide(types.Config{}, shell("rm", "-rf", "build")).Action).To(Equal(core.ActionDeny))
+			Expect(rules.Decide(types.Config{}, shell("rm", "build")).Rule).To(BeEmpty())
+			Expect(rules.Decide(types.Config{}, types.Step{Type: types.ToolLLM, Prompt: "rm -rf"}).Rule).To(BeEmpty())
+		})
+
+		it("matches file steps by path and op", func() {
+			rules := mustParse(`
+rules:
+  - action: deny
+    path: ["**/*.pem", ".git/**"]
+  - action: allow
+    tool: files
+    op: [read, patch]
+    path: src/**
+  - action: deny
+    tool: file
+`)
+			cfg := types.Config{WorkDir: "/repo"}
+
+			for _, tc := range []struct {
+				step types.Step
+				rule string
+			}{
+				{file("read", "keys/server.pem"), "rule 1"},
+				{file("read", "server.pem"), "rule 1"},
+				{file("write", "/repo/.git/config"), "rule 1"},
+				{file("read", "src/a/b.go"), "rule 2"},
+				{file("patch", "/repo/src/main.go"), "rule 2"},
+				{file("write", "src/main.go"), "rule 3"},
+				{file("read", "docs/README.md"), "rule 3"},
+			} {
+				Expect(rules.Decide(cfg, tc.step).Rule).To(Equal(tc.rule), tc.step.Op+" "+tc.step.Path)
+			}
+			Expect(rules.Decide(cfg, shell("cat", "server.pem")).Rule).To(BeEmpty())
+		})
+
+		it("matches both paths of a move", func() {
+			rules := mustParse(`
+rules:
+  - action: deny
+    path: "*.pem"
+  - action: allow
+    path: src/**
+`)
+			move := func(from, to string) types.Step {
+				return types.Step{Type: types.ToolFiles, Op: "move", Path: from, Dest: to}
+			}
+
+			Expect(rules.Decide(types.Config{}, move("key.pem", "src/key.txt")).Rule).To(Equal("rule 1"))
+			Expect(rules.Decide(types.Config{}, move("src/a.txt", "src/key.pem")).Rule).To(Equal("rule 1"))
+			Expect(rules.Decide(types.Config{}, move("src/a.go", "src/b/a.go")).Rule).To(Equal("rule 2"))
+			Expect(rules.Decide(types.Config{}, move("src/a.go", "tmp/a.go")).Rule).To(BeEmpty())
+		})
+	})
+
+	when("RulePolicy.AllowStep()", func() {
+		var (
+			rules     *core.PolicyRules
+			decisions []core.PolicyDecision
+			asked     []string
+			answer    bool
+			limits    core.PolicyLimits
+		)
+
+		newPolicy := func() *core.RulePolicy {
+			return core.NewRulePolicy(rules, limits,
+				core.WithAsker(func(step types.Step, rule string) (bool, error) {
+					asked = append(asked, core.DescribeStep(step))
+					return answer, nil
+				}),
+				core.WithDecisionObserver(func(d core.PolicyDecision) {
+					decisions = append(decisions, d)
+				}),
+			)
+		}
+
+		it.Before(func() {
+			rules = mustParse(example)
+			decisions, asked, answer = nil, nil, false
+			limits = core.PolicyLimits{DeniedShellCommands: []string{"go"}}
+		})
+
+		it("allows, denies and asks according to the rules", func() {
+			p := newPolicy()
+			cfg := types.Config{}
+
+			// An allow rule overrides the denied shell commands of the limits.
+			Expect(p.AllowStep(cfg, shell("go", "test", "./..."))).To(Succeed())
+
+			err := p.AllowStep(cfg, shell("git", "push"))
+			var pe core.PolicyDeniedError
+			Expect(err).To(BeAssignableToTypeOf(pe))
+			Expect(err).To(MatchError(ContainSubstring("kind=rule reason=denied by rule 3 (no push)")))
+
+			err = p.AllowStep(cfg, shell("make"))
+			Expect(err).To(MatchError(ContainSubstring("declined by the user")))
+			answer = true
+			Expect(p.AllowStep(cfg, shell("make"))).To(Succeed())
+			Expect(asked).To(Equal([]string{"shell: make", "shell: make"}))
+
+			Expect(decisions).To(HaveLen(4))
+			Expect(decisions[0].Action).To(Equal(core.ActionAllow))
+			Expect(decisions[1].Action).To(Equal(core.ActionDeny))
+			Expect(decisions[2].Action).To(Equal(core.ActionDeny))
+			Expect(decisions[2].Reason).To(Equal("declined by the user"))
+			Expect(decisions[3].Action).To(Equal(core.ActionAsk))
+			Expect(decisions[3].Rule).To(Equal("default"))
+		})
+
+		it("keeps the structural and work dir checks for allowed steps", func() {
+			dir := t.TempDir()
+			limits.RestrictFilesToWorkDir = true
+			rules = mustParse(`rules: [{action: allow}]`)
+			p := newPolicy()
+			cfg := types.Config{WorkDir: dir}
+
+			Expect(p.AllowStep(cfg, file("read", filepath.Join(dir, "a.txt")))).To(Succeed())
+			Expect(p.AllowStep(cfg, file("read", filepath.Join(os.TempDir(), "..", "etc", "passwd")))).
+				To(MatchError(ContainSubstring("path escapes workdir")))
+			Expect(p.AllowStep(cfg, shell("cat", "$HOME"))).To(MatchError(ContainSubstring("expansion")))
+			Expect(p.AllowStep(cfg, types.Step{Type: types.ToolLLM})).To(MatchError(ContainSubstring("requires Prompt")))
+		})
+
+		it("uses the built-in policy when no rule matches and there is no default", func() {
+			rules = mustParse(`rules: [{action: deny, command: rm}]`)
+			p := newPolicy()
+
+			Expect(p.AllowStep(types.Config{}, shell("go", "vet"))).To(MatchError(ContainSubstring("shell command denied: go")))
+			Expect(p.AllowStep(types.Config{}, shell("ls"))).To(Succeed())
+			Expect(decisions[1].Rule).To(Equal(core.DecidedByBuiltin))
+		})
+
+		it("lets an http rule replace the domain allow-list but not the URL checks", func() {
+			rules = mustParse(`rules: [{action: ask, tool: http}]`)
+			answer = true
+			p := newPolicy()
+
+			Expect(p.AllowStep(types.Config{}, types.Step{Type: types.ToolHTTP, URL: "https://go.dev/doc"})).To(Succeed())
+			Expect(asked).To(Equal([]string{"http GET: https://go.dev/doc"}))
+			Expect(p.AllowStep(types.Config{}, types.Step{Type: types.ToolHTTP, URL: "ftp://go.dev"})).
+				To(MatchError(ContainSubstring("requires an http(s) URL")))
+		})
+
+		it("denies ask rules without an asker", func() {
+			p := core.NewRulePolicy(rules, core.PolicyLimits{})
+
+			Expect(p.AllowStep(types.Config{}, shell("make"))).To(MatchError(ContainSubstring("default requires confirmation")))
+		})
+	})
+
+	when("LoadPolicyRules()", func() {
+		it("names the file in errors", func() {
+			path := filepath.Join(t.TempDir(), "policy.yaml")
+			Expect(os.WriteFile(path, []byte("rules: [{action: nope}]"), 0o644)).To(Succeed())
+
+			_, err := core.LoadPolicyRules(path)
+			Expect(err).To(MatchError(ContainSubstring(path + `: rule 1: invalid action "nope"`)))
+		})
+	})
+}
+
+func splitCommand(line string) (string, []string) {
+	fields := strings.Fields(line)
+	return fields[0], fields[1:]
+}
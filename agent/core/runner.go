@@ -2,6 +2,7 @@ package core
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/kardolus/chatgpt-cli/agent/tools"
 	"github.com/kardolus/chatgpt-cli/agent/types"
@@ -16,6 +17,28 @@ type Tools struct {
 	Shell tools.Shell
 	LLM   tools.LLM
 	Files tools.Files
+	HTTP  tools.HTTP
+
+	// Memory is nil unless project memory is enabled.
+	Memory tools.Memory
+
+	// Delegate is nil when the agent may not hand goals to child agents.
+	Delegate Delegator
+}
+
+// Delegator hands the goal of a delegate step to a child agent.
+type Delegator interface {
+	Delegate(ctx context.Context, cfg types.Config, step types.Step) (DelegateResult, error)
+}
+
+// DelegateResult is what a child agent hands back: its answer and the effects of its
+// steps. ID names the child in the run artifacts, e.g. "1.2" for the second child of the
+// first one.
+type DelegateResult struct {
+	ID      string
+	Mode    string
+	Answer  string
+	Effects types.Effects
 }
 
 type Runner interface {
@@ -61,6 +84,12 @@ func (r *DefaultRunner) RunStep(ctx context.Context, cfg types.Config, step type
 				tr = appendPolicyError(buildLLMStartTranscript(step.Prompt), err)
 			case types.ToolFiles:
 				tr = appendPolicyError(buildFileStartTranscript(step), err)
+			case types.ToolHTTP:
+				tr = appendPolicyError(buildHTTPStartTranscript(step), err)
+			case types.ToolMemory:
+				tr = appendPolicyError(buildMemoryTranscript(step), err)
+			case types.ToolDelegate:
+				tr = appendPolicyError(buildDelegateStartTranscript(step), err)
 			default:
 				tr = appendPolicyError(buildUnsupportedStepTranscript(step), err)
 			}
@@ -219,6 +248,23 @@ func (r *DefaultRunner) RunStep(ctx context.Context, cfg types.Config, step type
 
 		switch strings.ToLower(strings.TrimSpace(step.Op)) {
 		case "read":
+			if step.StartLine > 0 || step.EndLine > 0 {
+				readRes, err := r.tools.Files.ReadLines(step.Path, step.StartLine, step.EndLine)
+				if err != nil {
+					tr := buildFileStartTranscript(step)
+					return softStepError(r, start, step, tr, err), nil
+				}
+
+				tr := buildFileReadRangeTranscript(step.Path, readRes)
+				return types.StepResult{
+					Step:       step,
+					Outcome:    types.OutcomeOK,
+					Output:     readRes.Content,
+					Transcript: limitTranscript(tr, transcriptMaxBytes),
+					Duration:   r.clock.Now().Sub(start),
+				}, nil
+			}
+
 			b, err := r.tools.Files.ReadFile(step.Path)
 			if err != nil {
 				// SOFT FAIL
@@ -236,6 +282,130 @@ func (r *DefaultRunner) RunStep(ctx context.Context, cfg types.Config, step type
 				Duration:   r.clock.Now().Sub(start),
 			}, nil
 
+		case "list":
+			listRes, err := r.tools.Files.List(step.Path, step.Depth, step.Glob)
+			if err != nil {
+				tr := buildFileStartTranscript(step)
+				return softStepError(r, start, step, tr, err), nil
+			}
+
+			out := formatListing(listRes)
+			tr := buildFileOutputTranscript(step, out)
+			return types.StepResult{
+				Step:       step,
+				Outcome:    types.OutcomeOK,
+				Output:     out,
+				Transcript: limitTranscript(tr, transcriptMaxBytes),
+				Duration:   r.clock.Now().Sub(start),
+			}, nil
+
+		case "search":
+			if step.Pattern == "" {
+				err := fmt.Errorf("file search requires Pattern")
+				tr := buildFileStartTranscript(step)
+				return softStepError(r, start, step, tr, err), nil
+			}
+
+			searchRes, err := r.tools.Files.Search(step.Path, step.Pattern, step.Glob)
+			if err != nil {
+				tr := buildFileStartTranscript(step)
+				return softStepError(r, start, step, tr, err), nil
+			}
+
+			out := formatSearchMatches(searchRes)
+			tr := buildFileOutputTranscript(step, out)
+			return types.StepResult{
+				Step:       step,
+				Outcome:    types.OutcomeOK,
+				Output:     out,
+				Transcript: limitTranscript(tr, transcriptMaxBytes),
+				Duration:   r.clock.Now().Sub(start),
+			}, nil
+
+		case "stat":
+			statRes, err := r.tools.Files.Stat(step.Path)
+			if err != nil {
+				tr := buildFileStartTranscript(step)
+				return softStepError(r, start, step, tr, err), nil
+			}
+
+			kind := "file"
+			if statRes.IsDir {
+				kind = "dir"
+			}
+			out := fmt.Sprintf("path=%s type=%s size=%d mode=%s modified=%s",
+				step.Path, kind, statRes.Size, statRes.Mode, statRes.ModTime.UTC().Format(time.RFC3339))
+			tr := buildFileOutputTranscript(step, out)
+			return types.StepResult{
+				Step:       step,
+				Outcome:    types.OutcomeOK,
+				Output:     out,
+				Transcript: limitTranscript(tr, transcriptMaxBytes),
+				Duration:   r.clock.Now().Sub(start),
+			}, nil
+
+		case "mkdir":
+			if err := r.tools.Files.Mkdir(step.Path); err != nil {
+				tr := buildFileStartTranscript(step)
+				return softStepError(r, start, step, tr, err), nil
+			}
+
+			out := fmt.Sprintf("created directory %s", step.Path)
+			return types.StepResult{
+				Step:       step,
+				Outcome:    types.OutcomeOK,
+				Output:     out,
+				Transcript: limitTranscript(buildFileOutputTranscript(step, out), transcriptMaxBytes),
+				Duration:   r.clock.Now().Sub(start),
+				Effects: []types.StepEffect{
+					effect("file.mkdir", step.Path, 0, nil),
+				},
+			}, nil
+
+		case "move":
+			if strings.TrimSpace(step.Dest) == "" {
+				err := fmt.Errorf("file move requires Dest")
+				tr := buildFileStartTranscript(step)
+				return softStepError(r, start, step, tr, err), nil
+			}
+
+			if err := r.tools.Files.Move(step.Path, step.Dest); err != nil {
+				tr := buildFileStartTranscript(step)
+				return softStepError(r, start, step, tr, err), nil
+			}
+
+			out := fmt.Sprintf("moved %s to %s", step.Path, step.Dest)
+			return types.StepResult{
+				Step:       step,
+				Outcome:    types.OutcomeOK,
+				Output:     out,
+				Transcript: limitTranscript(buildFileOutputTranscript(step, out), transcriptMaxBytes),
+				Duration:   r.clock.Now().Sub(start),
+				Effects: []types.StepEffect{
+					effect("file.move", step.Path, 0, map[string]any{
+						"dest": step.Dest,
+					}),
+				},
+			}, nil
+
+		case "delete":
+			if err := r.tools.Files.Delete(step.Path); err != nil {
+				tr := buildFileStartTranscript(step)
+				return softStepError(r, start, step, tr, err), nil
+			}
+
+			out := fmt.Sprintf("deleted %s", step.Path)
+			return types.StepResult{
+				Step:       step,
+				Outcome:    types.OutcomeOK,
+				Output:     out,
+				Transcript: limitTranscript(buildFileOutputTranscript(step, out), transcriptMaxBytes),
+				Duration:   r.clock.Now().Sub(start),
+				Effects: []types.StepEffect{
+					effect("file.delete", step.Path, 0, nil),
+				},
+			}, nil
+
 		case "write":
 			if step.Data == "" {
 				err := fmt.Errorf("file write requires Data")
@@ -328,6 +498,144 @@ func (r *DefaultRunner) RunStep(ctx context.Context, cfg types.Config, step type
 			return softStepError(r, start, step, tr, err), nil
 		}
 
+	case types.ToolHTTP:
+		// HARD STOP: tool budget gate
+		if err := r.budget.AllowTool(types.ToolHTTP, start); err != nil {
+			tr := appendBudgetError(buildHTTPStartTranscript(step), err)
+			return types.StepResult{
+				Step:       step,
+				Outcome:    types.OutcomeError,
+				Transcript: limitTranscript(tr, transcriptMaxBytes),
+				Duration:   r.clock.Now().Sub(start),
+				Output:     err.Error(),
+			}, err
+		}
+
+		res, err := r.tools.HTTP.Fetch(ctx, tools.HTTPRequest{
+			Method:  HTTPMethod(step),
+			URL:     step.URL,
+			Headers: step.Headers,
+			Body:    step.Body,
+		})
+		if err != nil {
+			// SOFT FAIL: agent can fix the URL or try another source
+			tr := buildHTTPStartTranscript(step)
+			return softStepError(r, start, step, tr, err), nil
+		}
+
+		outcome := types.OutcomeOK
+		if res.Status < 200 || res.Status >= 300 {
+			outcome = types.OutcomeError // soft, like a failing shell command
+		}
+
+		out := formatHTTPResult(res)
+		return types.StepResult{
+			Step:       step,
+			Outcome:    outcome,
+			Output:     out,
+			Transcript: limitTranscript(buildHTTPTranscript(step, res, out), transcriptMaxBytes),
+			Duration:   r.clock.Now().Sub(start),
+			Effects: []types.StepEffect{
+				effect("http.request", "", len(step.Body), map[string]any{
+					"method": HTTPMethod(step),
+					"url":    step.URL,
+					"status": res.Status,
+					"bytes":  res.Bytes,
+				}),
+			},
+		}, nil
+
+	case types.ToolMemory:
+		tr := buildMemoryTranscript(step)
+		if r.tools.Memory == nil {
+			// SOFT FAIL: the agent can go on without remembering
+			return softStepError(r, start, step, tr, errors.New("project memory is not enabled (agent.memory_enabled)")), nil
+		}
+		if err := r.budget.AllowTool(types.ToolMemory, start); err != nil {
+			return types.StepResult{
+				Step:       step,
+				Outcome:    types.OutcomeError,
+				Transcript: limitTranscript(appendBudgetError(tr, err), transcriptMaxBytes),
+				Duration:   r.clock.Now().Sub(start),
+				Output:     err.Error(),
+			}, err
+		}
+
+		res, err := r.tools.Memory.Remember(step.Fact)
+		if err != nil {
+			return softStepError(r, start, step, tr, err), nil
+		}
+
+		out := "remembered"
+		if !res.Added {
+			out = "already remembered"
+		}
+		if res.Dropped > 0 {
+			out += fmt.Sprintf(" (forgot the %d oldest facts to stay under the size cap)", res.Dropped)
+		}
+		return types.StepResult{
+			Step:       step,
+			Outcome:    types.OutcomeOK,
+			Output:     out,
+			Transcript: limitTranscript(tr+out+"\n", transcriptMaxBytes),
+			Duration:   r.clock.Now().Sub(start),
+			Effects: []types.StepEffect{
+				effect("memory.remember", "", len(step.Fact), map[string]any{
+					"added":   res.Added,
+					"dropped": res.Dropped,
+					"facts":   res.Facts,
+				}),
+			},
+		}, nil
+
+	case types.ToolDelegate:
+		tr := buildDelegateStartTranscript(step)
+		if r.tools.Delegate == nil {
+			// SOFT FAIL: the agent has to do the work itself
+			return softStepError(r, start, step, tr, errors.New("delegation is not available here (agent.max_delegation_depth)")), nil
+		}
+		if err := r.budget.AllowTool(types.ToolDelegate, start); err != nil {
+			return types.StepResult{
+				Step:       step,
+				Outcome:    types.OutcomeError,
+				Transcript: limitTranscript(appendBudgetError(tr, err), transcriptMaxBytes),
+				Duration:   r.clock.Now().Sub(start),
+				Output:     err.Error(),
+			}, err
+		}
+
+		res, err := r.tools.Delegate.Delegate(ctx, cfg, step)
+		effects := append([]types.StepEffect{
+			effect("agent.delegate", "", 0, map[string]any{
+				"id":      res.ID,
+				"mode":    res.Mode,
+				"effects": len(res.Effects),
+			}),
+		}, res.Effects...)
+
+		if err != nil {
+			// SOFT FAIL: the parent decides what to do without the child; what the child
+			// already changed is still reported
+			out := fmt.Sprintf("sub-agent %s failed: %v", res.ID, err)
+			return types.StepResult{
+				Step:       step,
+				Outcome:    types.OutcomeError,
+				Output:     out,
+				Transcript: limitTranscript(buildDelegateTranscript(res, out), transcriptMaxBytes),
+				Duration:   r.clock.Now().Sub(start),
+				Effects:    effects,
+			}, nil
+		}
+
+		return types.StepResult{
+			Step:       step,
+			Outcome:    types.OutcomeOK,
+			Output:     res.Answer,
+			Transcript: limitTranscript(buildDelegateTranscript(res, res.Answer), transcriptMaxBytes),
+			Duration:   r.clock.Now().Sub(start),
+			Effects:    effects,
+		}, nil
+
 	default:
 		// SOFT FAIL: agent can correct tool type
 		err := fmt.Errorf("unsupported step type: %s", step.Type)
@@ -397,6 +705,36 @@ func buildDryRunTranscript(cfg types.Config, step types.Step) string {
 			)
 
 		case "read":
+			if step.StartLine > 0 || step.EndLine > 0 {
+				return fmt.Sprintf(
+					"[dry-run][file] op=%q path=%q lines=%d-%d\n",
+					step.Op, step.Path, step.StartLine, step.EndLine,
+				)
+			}
+			return fmt.Sprintf(
+				"[dry-run][file] op=%q path=%q\n",
+				step.Op, step.Path,
+			)
+
+		case "list":
+			return fmt.Sprintf(
+				"[dry-run][file] op=%q path=%q depth=%d glob=%q\n",
+				step.Op, step.Path, step.Depth, step.Glob,
+			)
+
+		case "search":
+			return fmt.Sprintf(
+				"[dry-run][file] op=%q path=%q pattern=%q glob=%q\n",
+				step.Op, step.Path, step.Pattern, step.Glob,
+			)
+
+		case "move":
+			return fmt.Sprintf(
+				"[dry-run][file] op=%q path=%q dest=%q\n",
+				step.Op, step.Path, step.Dest,
+			)
+
+		case "stat", "mkdir", "delete":
 			return fmt.Sprintf(
 				"[dry-run][file] op=%q path=%q\n",
 				step.Op, step.Path,
@@ -407,6 +745,15 @@ func buildDryRunTranscript(cfg types.Config, step types.Step) string {
 			return fmt.Sprintf("[dry-run][file] op=%q path=%q data_len=%d\n", step.Op, step.Path, len(step.Data))
 		}
 
+	case types.ToolHTTP:
+		return fmt.Sprintf("[dry-run][http] method=%q url=%q body_len=%d\n", HTTPMethod(step), step.URL, len(step.Body))
+
+	case types.ToolMemory:
+		return fmt.Sprintf("[dry-run][memory] fact=%q\n", step.Fact)
+
+	case types.ToolDelegate:
+		return fmt.Sprintf("[dry-run][delegate] mode=%q tools=%v goal=%q\n", delegateMode(step), step.Tools, step.Goal)
+
 	default:
 		return fmt.Sprintf("[dry-run] step_type=%q\n", step.Type)
 	}
@@ -521,6 +868,63 @@ func buildFileReadTranscript(path, content string) string {
 	return b.String()
 }
 
+func buildFileReadRangeTranscript(path string, res tools.ReadResult) string {
+	var b strings.Builder
+	_, _ = fmt.Fprintf(&b, "[file] op=%q path=%q lines=%d-%d total_lines=%d\n", "read", path, res.StartLine, res.EndLine, res.TotalLines)
+	b.WriteString("content:\n")
+	b.WriteString(res.Content)
+	if res.Content != "" && !strings.HasSuffix(res.Content, "\n") {
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+func buildFileOutputTranscript(step types.Step, output string) string {
+	var b strings.Builder
+	_, _ = fmt.Fprintf(&b, "[file] op=%q path=%q\n", step.Op, step.Path)
+	b.WriteString(output)
+	if output != "" && !strings.HasSuffix(output, "\n") {
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// formatListing renders one entry per line, directories with a trailing slash.
+func formatListing(res tools.ListResult) string {
+	if len(res.Entries) == 0 {
+		return "(no entries)"
+	}
+
+	var b strings.Builder
+	for _, e := range res.Entries {
+		if e.IsDir {
+			_, _ = fmt.Fprintf(&b, "%s/\n", e.Path)
+		} else {
+			_, _ = fmt.Fprintf(&b, "%s (%d bytes)\n", e.Path, e.Size)
+		}
+	}
+	if res.Truncated {
+		_, _ = fmt.Fprintf(&b, "(truncated after %d entries, narrow the glob or depth)\n", len(res.Entries))
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// formatSearchMatches renders the matches like grep -n.
+func formatSearchMatches(res tools.SearchResult) string {
+	if len(res.Matches) == 0 {
+		return fmt.Sprintf("no matches in %d file(s)", res.FilesScanned)
+	}
+
+	var b strings.Builder
+	for _, m := range res.Matches {
+		_, _ = fmt.Fprintf(&b, "%s:%d: %s\n", m.Path, m.Line, m.Text)
+	}
+	if res.Truncated {
+		_, _ = fmt.Fprintf(&b, "(truncated after %d matches, narrow the pattern or glob)\n", len(res.Matches))
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
 func buildFileWriteTranscript(path, data string) string {
 	var b strings.Builder
 	_, _ = fmt.Fprintf(&b, "[file] op=%q path=%q\n", "write", path)
@@ -529,6 +933,67 @@ func buildFileWriteTranscript(path, data string) string {
 	return b.String()
 }
 
+func buildHTTPStartTranscript(step types.Step) string {
+	return fmt.Sprintf("[http:start] method=%q url=%q body_len=%d\n", HTTPMethod(step), step.URL, len(step.Body))
+}
+
+func buildMemoryTranscript(step types.Step) string {
+	return fmt.Sprintf("[memory] fact=%q\n", step.Fact)
+}
+
+func buildDelegateStartTranscript(step types.Step) string {
+	return fmt.Sprintf("[delegate:start] mode=%q tools=%v goal=%q\n", delegateMode(step), step.Tools, step.Goal)
+}
+
+// buildDelegateTranscript only has what the child hands back; its own transcript is kept
+// apart in the run artifacts.
+func buildDelegateTranscript(res DelegateResult, output string) string {
+	var b strings.Builder
+	_, _ = fmt.Fprintf(&b, "[delegate] id=%s mode=%q effects=%d\n", res.ID, res.Mode, len(res.Effects))
+	b.WriteString("answer:\n")
+	b.WriteString(output)
+	if output != "" && !strings.HasSuffix(output, "\n") {
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+func delegateMode(step types.Step) string {
+	if step.AgentMode == "" {
+		return "react"
+	}
+	return step.AgentMode
+}
+
+func buildHTTPTranscript(step types.Step, res tools.HTTPResult, output string) string {
+	var b strings.Builder
+	_, _ = fmt.Fprintf(&b, "[http] method=%q url=%q\n", HTTPMethod(step), step.URL)
+	_, _ = fmt.Fprintf(&b, "status=%d content_type=%q bytes=%d\n", res.Status, res.ContentType, res.Bytes)
+	b.WriteString("body:\n")
+	b.WriteString(output)
+	if output != "" && !strings.HasSuffix(output, "\n") {
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// formatHTTPResult is what the agent observes: the body, with the status in front unless
+// the request succeeded.
+func formatHTTPResult(res tools.HTTPResult) string {
+	var b strings.Builder
+	switch {
+	case res.Location != "" && res.Status >= 300 && res.Status < 400:
+		_, _ = fmt.Fprintf(&b, "status %d: redirected to %s (redirects are not followed)\n", res.Status, res.Location)
+	case res.Status < 200 || res.Status >= 300:
+		_, _ = fmt.Fprintf(&b, "status %d\n", res.Status)
+	}
+	b.WriteString(res.Body)
+	if res.Truncated {
+		_, _ = fmt.Fprintf(&b, "\n(truncated, the response has %d bytes)", res.Bytes)
+	}
+	return b.String()
+}
+
 func buildUnsupportedStepTranscript(step types.Step) string {
 	return fmt.Sprintf("[unsupported] step_type=%q\n", step.Type)
 }
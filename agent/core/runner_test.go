@@ -8,6 +8,7 @@ import (
 	"github.com/kardolus/chatgpt-cli/agent/tools"
 	"github.com/kardolus/chatgpt-cli/agent/types"
 	"github.com/sclevine/spec/report"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -22,6 +23,9 @@ import (
 //go:generate mockgen -destination=budgetmocks_test.go -package=core_test github.com/kardolus/chatgpt-cli/agent/core Budget
 //go:generate mockgen -destination=filemocks_test.go -package=core_test github.com/kardolus/chatgpt-cli/agent/tools Files
 //go:generate mockgen -destination=policymocks_test.go -package=core_test github.com/kardolus/chatgpt-cli/agent/core Policy
+//go:generate mockgen -destination=httpmocks_test.go -package=core_test github.com/kardolus/chatgpt-cli/agent/tools HTTP
+//go:generate mockgen -destination=runnermocks_test.go -package=core_test github.com/kardolus/chatgpt-cli/agent/core Runner
+//go:generate mockgen -destination=delegatormocks_test.go -package=core_test github.com/kardolus/chatgpt-cli/agent/core Delegator
 
 func TestUnitRunner(t *testing.T) {
 	spec.Run(t, "Testing the runner", testRunner, spec.Report(report.Terminal{}))
@@ -34,6 +38,7 @@ func testRunner(t *testing.T, when spec.G, it spec.S) {
 		mockShell  *MockShell
 		mockLLM    *MockLLM
 		mockFiles  *MockFiles
+		mockHTTP   *MockHTTP
 		mockBudget *MockBudget
 		mockPolicy *MockPolicy
 
@@ -49,6 +54,7 @@ func testRunner(t *testing.T, when spec.G, it spec.S) {
 		mockShell = NewMockShell(mockCtrl)
 		mockLLM = NewMockLLM(mockCtrl)
 		mockFiles = NewMockFiles(mockCtrl)
+		mockHTTP = NewMockHTTP(mockCtrl)
 		mockBudget = NewMockBudget(mockCtrl)
 		mockPolicy = NewMockPolicy(mockCtrl)
 
@@ -56,6 +62,7 @@ func testRunner(t *testing.T, when spec.G, it spec.S) {
 			Shell: mockShell,
 			LLM:   mockLLM,
 			Files: mockFiles,
+			HTTP:  mockHTTP,
 		}
 
 		subject = core.NewDefaultRunner(agentTools, mockClock, mockBudget, mockPolicy)
@@ -443,7 +450,7 @@ func testRunner(t *testing.T, when spec.G, it spec.S) {
 			cfg := types.Config{DryRun: false, WorkDir: "/tmp"}
 			step := types.Step{
 				Type: types.ToolFiles,
-				Op:   "delete",
+				Op:   "chmod",
 				Path: "/tmp/a.txt",
 			}
 
@@ -1177,6 +1184,384 @@ func testRunner(t *testing.T, when spec.G, it spec.S) {
 			Expect(res.Duration).To(Equal(dur))
 			Expect(res.Transcript).To(ContainSubstring("[budget]"))
 		})
+
+		it("reads a line range with ReadLines", func() {
+			expectDuration(mockClock, 5*time.Millisecond)
+
+			cfg := types.Config{DryRun: false}
+			step := types.Step{Type: types.ToolFiles, Op: "read", Path: "/tmp/a.go", StartLine: 10, EndLine: 12}
+
+			expectAllowStep(mockBudget, step)
+			expectAllowPolicy(mockPolicy, cfg, step)
+			expectAllowTool(mockBudget, types.ToolFiles)
+
+			mockFiles.EXPECT().ReadFile(gomock.Any()).Times(0)
+			mockFiles.EXPECT().ReadLines("/tmp/a.go", 10, 12).
+				Return(tools.ReadResult{Content: "a\nb\nc\n", StartLine: 10, EndLine: 12, TotalLines: 40}, nil).
+				Times(1)
+
+			res, err := subject.RunStep(context.Background(), cfg, step)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(res.Outcome).To(Equal(types.OutcomeOK))
+			Expect(res.Output).To(Equal("a\nb\nc\n"))
+			Expect(res.Transcript).To(ContainSubstring("lines=10-12 total_lines=40"))
+			expectNoEffects(res)
+		})
+
+		it("lists and searches files without side effects", func() {
+			expectDuration(mockClock, 5*time.Millisecond)
+
+			cfg := types.Config{DryRun: false}
+			list := types.Step{Type: types.ToolFiles, Op: "list", Path: "/repo", Depth: 2, Glob: "*.go"}
+			search := types.Step{Type: types.ToolFiles, Op: "search", Path: "/repo", Pattern: "func main", Glob: "*.go"}
+
+			for _, step := range []types.Step{list, search} {
+				expectAllowStep(mockBudget, step)
+				expectAllowPolicy(mockPolicy, cfg, step)
+			}
+			mockBudget.EXPECT().AllowTool(types.ToolFiles, gomock.Any()).Return(nil).Times(2)
+
+			mockFiles.EXPECT().List("/repo", 2, "*.go").Return(tools.ListResult{
+				Entries: []tools.ListEntry{{Path: "cmd", IsDir: true}, {Path: "cmd/main.go", Size: 42}},
+			}, nil).Times(1)
+			mockFiles.EXPECT().Search("/repo", "func main", "*.go").Return(tools.SearchResult{
+				Matches:      []tools.SearchMatch{{Path: "/repo/cmd/main.go", Line: 3, Text: "func main() {"}},
+				FilesScanned: 1,
+				Truncated:    true,
+			}, nil).Times(1)
+
+			res, err := subject.RunStep(context.Background(), cfg, list)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res.Output).To(Equal("cmd/\ncmd/main.go (42 bytes)"))
+			expectNoEffects(res)
+
+			res, err = subject.RunStep(context.Background(), cfg, search)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res.Output).To(HavePrefix("/repo/cmd/main.go:3: func main() {\n"))
+			Expect(res.Output).To(ContainSubstring("truncated after 1 matches"))
+			expectNoEffects(res)
+		})
+
+		it("returns OutcomeError (no error) when search is missing Pattern and does not invoke Search", func() {
+			expectDuration(mockClock, 5*time.Millisecond)
+
+			cfg := types.Config{DryRun: false}
+			step := types.Step{Type: types.ToolFiles, Op: "search", Path: "/repo"}
+
+			expectAllowStep(mockBudget, step)
+			expectAllowPolicy(mockPolicy, cfg, step)
+			expectAllowTool(mockBudget, types.ToolFiles)
+			mockFiles.EXPECT().Search(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+
+			res, err := subject.RunStep(context.Background(), cfg, step)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res.Outcome).To(Equal(types.OutcomeError))
+			Expect(res.Output).To(ContainSubstring("file search requires Pattern"))
+		})
+
+		it("records effects for mkdir, move and delete", func() {
+			expectDuration(mockClock, 5*time.Millisecond)
+
+			cfg := types.Config{DryRun: false}
+			mkdir := types.Step{Type: types.ToolFiles, Op: "mkdir", Path: "/repo/out"}
+			move := types.Step{Type: types.ToolFiles, Op: "move", Path: "/repo/a.txt", Dest: "/repo/out/a.txt"}
+			del := types.Step{Type: types.ToolFiles, Op: "delete", Path: "/repo/b.txt"}
+
+			for _, step := range []types.Step{mkdir, move, del} {
+				expectAllowStep(mockBudget, step)
+				expectAllowPolicy(mockPolicy, cfg, step)
+			}
+			mockBudget.EXPECT().AllowTool(types.ToolFiles, gomock.Any()).Return(nil).Times(3)
+
+			mockFiles.EXPECT().Mkdir("/repo/out").Return(nil).Times(1)
+			mockFiles.EXPECT().Move("/repo/a.txt", "/repo/out/a.txt").Return(nil).Times(1)
+			mockFiles.EXPECT().Delete("/repo/b.txt").Return(nil).Times(1)
+
+			res, err := subject.RunStep(context.Background(), cfg, mkdir)
+			Expect(err).NotTo(HaveOccurred())
+			expectOneEffect(res, "file.mkdir", "/repo/out", 0)
+
+			res, err = subject.RunStep(context.Background(), cfg, move)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res.Output).To(Equal("moved /repo/a.txt to /repo/out/a.txt"))
+			expectOneEffect(res, "file.move", "/repo/a.txt", 0)
+			Expect(res.Effects[0].Meta["dest"]).To(Equal("/repo/out/a.txt"))
+
+			res, err = subject.RunStep(context.Background(), cfg, del)
+			Expect(err).NotTo(HaveOccurred())
+			expectOneEffect(res, "file.delete", "/repo/b.txt", 0)
+		})
+
+		it("returns OutcomeError (no error) when delete errors and records no effect", func() {
+			expectDuration(mockClock, 5*time.Millisecond)
+
+			cfg := types.Config{DryRun: false}
+			step := types.Step{Type: types.ToolFiles, Op: "delete", Path: "/repo/dir"}
+
+			expectAllowStep(mockBudget, step)
+			expectAllowPolicy(mockPolicy, cfg, step)
+			expectAllowTool(mockBudget, types.ToolFiles)
+
+			delErr := errors.New("delete /repo/dir: only empty directories can be deleted")
+			mockFiles.EXPECT().Delete("/repo/dir").Return(delErr).Times(1)
+
+			res, err := subject.RunStep(context.Background(), cfg, step)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res.Outcome).To(Equal(types.OutcomeError))
+			Expect(res.Output).To(Equal(delErr.Error()))
+			expectFileStartTranscript(res, step)
+			expectNoEffects(res)
+		})
+
+		it("dry-run move does not invoke Move", func() {
+			expectDuration(mockClock, 5*time.Millisecond)
+
+			cfg := types.Config{DryRun: true}
+			step := types.Step{Type: types.ToolFiles, Op: "move", Path: "a.txt", Dest: "b.txt"}
+
+			expectAllowStep(mockBudget, step)
+			expectAllowPolicy(mockPolicy, cfg, step)
+			mockFiles.EXPECT().Move(gomock.Any(), gomock.Any()).Times(0)
+
+			res, err := subject.RunStep(context.Background(), cfg, step)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res.Outcome).To(Equal(types.OutcomeDryRun))
+			Expect(res.Transcript).To(Equal(`[dry-run][file] op="move" path="a.txt" dest="b.txt"` + "\n"))
+		})
+
+		it("fetches a URL and records the request as an effect", func() {
+			expectDuration(mockClock, 5*time.Millisecond)
+
+			cfg := types.Config{DryRun: false}
+			step := types.Step{
+				Type:    types.ToolHTTP,
+				URL:     "https://go.dev/doc",
+				Headers: map[string]string{"Accept": "text/html"},
+			}
+
+			expectAllowStep(mockBudget, step)
+			expectAllowPolicy(mockPolicy, cfg, step)
+			expectAllowTool(mockBudget, types.ToolHTTP)
+
+			mockHTTP.EXPECT().Fetch(gomock.Any(), tools.HTTPRequest{
+				Method:  "GET",
+				URL:     "https://go.dev/doc",
+				Headers: map[string]string{"Accept": "text/html"},
+			}).Return(tools.HTTPResult{Status: 200, ContentType: "text/html", Body: "Documentation", Bytes: 9000, Truncated: true}, nil).Times(1)
+
+			res, err := subject.RunStep(context.Background(), cfg, step)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res.Outcome).To(Equal(types.OutcomeOK))
+			Expect(res.Output).To(Equal("Documentation\n(truncated, the response has 9000 bytes)"))
+			Expect(res.Transcript).To(ContainSubstring(`[http] method="GET" url="https://go.dev/doc"`))
+			Expect(res.Transcript).To(ContainSubstring(`status=200 content_type="text/html" bytes=9000`))
+			expectOneEffect(res, "http.request", "", 0)
+			Expect(res.Effects[0].Meta["status"]).To(Equal(200))
+		})
+
+		it("returns OutcomeError (no error) for non-2xx responses and redirects", func() {
+			expectDuration(mockClock, 5*time.Millisecond)
+
+			cfg := types.Config{DryRun: false}
+			missing := types.Step{Type: types.ToolHTTP, URL: "https://go.dev/missing"}
+			moved := types.Step{Type: types.ToolHTTP, Method: "head", URL: "https://go.dev/old"}
+
+			for _, step := range []types.Step{missing, moved} {
+				expectAllowStep(mockBudget, step)
+				expectAllowPolicy(mockPolicy, cfg, step)
+			}
+			mockBudget.EXPECT().AllowTool(types.ToolHTTP, gomock.Any()).Return(nil).Times(2)
+
+			mockHTTP.EXPECT().Fetch(gomock.Any(), gomock.Any()).Return(tools.HTTPResult{Status: 404, Body: "not found"}, nil).Times(1)
+			mockHTTP.EXPECT().Fetch(gomock.Any(), tools.HTTPRequest{Method: "HEAD", URL: "https://go.dev/old"}).
+				Return(tools.HTTPResult{Status: 301, Location: "https://go.dev/new"}, nil).Times(1)
+
+			res, err := subject.RunStep(context.Background(), cfg, missing)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res.Outcome).To(Equal(types.OutcomeError))
+			Expect(res.Output).To(Equal("status 404\nnot found"))
+
+			res, err = subject.RunStep(context.Background(), cfg, moved)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res.Outcome).To(Equal(types.OutcomeError))
+			Expect(res.Output).To(Equal("status 301: redirected to https://go.dev/new (redirects are not followed)\n"))
+		})
+
+		it("returns OutcomeError (no error) when the request fails", func() {
+			expectDuration(mockClock, 5*time.Millisecond)
+
+			cfg := types.Config{DryRun: false}
+			step := types.Step{Type: types.ToolHTTP, URL: "https://go.dev"}
+
+			expectAllowStep(mockBudget, step)
+			expectAllowPolicy(mockPolicy, cfg, step)
+			expectAllowTool(mockBudget, types.ToolHTTP)
+			mockHTTP.EXPECT().Fetch(gomock.Any(), gomock.Any()).Return(tools.HTTPResult{}, errors.New("connection refused")).Times(1)
+
+			res, err := subject.RunStep(context.Background(), cfg, step)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res.Outcome).To(Equal(types.OutcomeError))
+			Expect(res.Output).To(Equal("connection refused"))
+			Expect(res.Transcript).To(ContainSubstring(`[http:start] method="GET" url="https://go.dev"`))
+			expectNoEffects(res)
+		})
+
+		it("hard-stops when the http budget is exhausted and does not fetch", func() {
+			expectDuration(mockClock, 5*time.Millisecond)
+
+			cfg := types.Config{DryRun: false}
+			step := types.Step{Type: types.ToolHTTP, URL: "https://go.dev"}
+
+			expectAllowStep(mockBudget, step)
+			expectAllowPolicy(mockPolicy, cfg, step)
+			budgetErr := core.BudgetExceededError{Kind: core.BudgetKindHTTP, Limit: 1, Used: 1, Message: "http call budget exceeded"}
+			mockBudget.EXPECT().AllowTool(types.ToolHTTP, gomock.Any()).Return(budgetErr).Times(1)
+			mockHTTP.EXPECT().Fetch(gomock.Any(), gomock.Any()).Times(0)
+
+			res, err := subject.RunStep(context.Background(), cfg, step)
+			Expect(err).To(MatchError(budgetErr))
+			Expect(res.Outcome).To(Equal(types.OutcomeError))
+			Expect(res.Transcript).To(ContainSubstring("[budget] http call budget exceeded"))
+		})
+
+		it("remembers a fact in the project memory", func() {
+			expectDuration(mockClock, 5*time.Millisecond)
+
+			mem := tools.NewFileMemory(filepath.Join(t.TempDir(), "memory.md"), "/project", 0)
+			agentTools.Memory = mem
+			subject = core.NewDefaultRunner(agentTools, mockClock, mockBudget, mockPolicy)
+
+			cfg := types.Config{DryRun: false}
+			step := types.Step{Type: types.ToolMemory, Fact: "tests run with make test"}
+
+			for range 2 {
+				expectAllowStep(mockBudget, step)
+				expectAllowPolicy(mockPolicy, cfg, step)
+			}
+			mockBudget.EXPECT().AllowTool(types.ToolMemory, gomock.Any()).Return(nil).Times(2)
+
+			res, err := subject.RunStep(context.Background(), cfg, step)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res.Outcome).To(Equal(types.OutcomeOK))
+			Expect(res.Output).To(Equal("remembered"))
+			Expect(res.Transcript).To(ContainSubstring(`[memory] fact="tests run with make test"`))
+			expectOneEffect(res, "memory.remember", "", len(step.Fact))
+
+			res, err = subject.RunStep(context.Background(), cfg, step)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res.Output).To(Equal("already remembered"))
+
+			facts, err := mem.Facts()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(facts).To(Equal([]string{"tests run with make test"}))
+		})
+
+		it("returns OutcomeError (no error) when the project memory is disabled", func() {
+			expectDuration(mockClock, 5*time.Millisecond)
+
+			cfg := types.Config{DryRun: false}
+			step := types.Step{Type: types.ToolMemory, Fact: "fact"}
+
+			expectAllowStep(mockBudget, step)
+			expectAllowPolicy(mockPolicy, cfg, step)
+
+			res, err := subject.RunStep(context.Background(), cfg, step)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res.Outcome).To(Equal(types.OutcomeError))
+			Expect(res.Output).To(ContainSubstring("project memory is not enabled"))
+			expectNoEffects(res)
+		})
+
+		it("hands a delegate step to a sub-agent and returns its answer and effects", func() {
+			expectDuration(mockClock, 5*time.Millisecond)
+
+			mockDelegator := NewMockDelegator(mockCtrl)
+			agentTools.Delegate = mockDelegator
+			subject = core.NewDefaultRunner(agentTools, mockClock, mockBudget, mockPolicy)
+
+			cfg := types.Config{DryRun: false}
+			step := types.Step{Type: types.ToolDelegate, Goal: "fix the failing test", Tools: []types.ToolKind{types.ToolShell}}
+
+			expectAllowStep(mockBudget, step)
+			expectAllowPolicy(mockPolicy, cfg, step)
+			mockBudget.EXPECT().AllowTool(types.ToolDelegate, gomock.Any()).Return(nil)
+			mockDelegator.EXPECT().Delegate(gomock.Any(), cfg, step).Return(core.DelegateResult{
+				ID:      "1",
+				Mode:    "react",
+				Answer:  "fixed the off-by-one in parse.go",
+				Effects: types.Effects{{Kind: "file.write", Path: "parse.go", Bytes: 42}},
+			}, nil)
+
+			res, err := subject.RunStep(context.Background(), cfg, step)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res.Outcome).To(Equal(types.OutcomeOK))
+			Expect(res.Output).To(Equal("fixed the off-by-one in parse.go"))
+			Expect(res.Transcript).To(ContainSubstring(`[delegate] id=1 mode="react" effects=1`))
+
+			Expect(res.Effects).To(HaveLen(2))
+			Expect(res.Effects[0].Kind).To(Equal("agent.delegate"))
+			Expect(res.Effects[0].Meta).To(HaveKeyWithValue("id", "1"))
+			Expect(res.Effects[1].Path).To(Equal("parse.go"))
+		})
+
+		it("returns OutcomeError (no error) with the effects so far when the sub-agent fails", func() {
+			expectDuration(mockClock, 5*time.Millisecond)
+
+			mockDelegator := NewMockDelegator(mockCtrl)
+			agentTools.Delegate = mockDelegator
+			subject = core.NewDefaultRunner(agentTools, mockClock, mockBudget, mockPolicy)
+
+			cfg := types.Config{DryRun: false}
+			step := types.Step{Type: types.ToolDelegate, Goal: "g", AgentMode: "plan"}
+
+			expectAllowStep(mockBudget, step)
+			expectAllowPolicy(mockPolicy, cfg, step)
+			mockBudget.EXPECT().AllowTool(types.ToolDelegate, gomock.Any()).Return(nil)
+			mockDelegator.EXPECT().Delegate(gomock.Any(), cfg, step).Return(core.DelegateResult{
+				ID:      "2",
+				Mode:    "plan",
+				Effects: types.Effects{{Kind: "shell.exec"}},
+			}, errors.New("llm budget exceeded"))
+
+			res, err := subject.RunStep(context.Background(), cfg, step)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res.Outcome).To(Equal(types.OutcomeError))
+			Expect(res.Output).To(Equal("sub-agent 2 failed: llm budget exceeded"))
+			Expect(res.Effects).To(HaveLen(2))
+		})
+
+		it("returns OutcomeError (no error) when delegation is not available", func() {
+			expectDuration(mockClock, 5*time.Millisecond)
+
+			cfg := types.Config{DryRun: false}
+			step := types.Step{Type: types.ToolDelegate, Goal: "g"}
+
+			expectAllowStep(mockBudget, step)
+			expectAllowPolicy(mockPolicy, cfg, step)
+
+			res, err := subject.RunStep(context.Background(), cfg, step)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res.Outcome).To(Equal(types.OutcomeError))
+			Expect(res.Output).To(ContainSubstring("delegation is not available here"))
+			expectNoEffects(res)
+		})
+
+		it("dry-run http does not fetch", func() {
+			expectDuration(mockClock, 5*time.Millisecond)
+
+			cfg := types.Config{DryRun: true}
+			step := types.Step{Type: types.ToolHTTP, Method: "POST", URL: "https://api.example.com/items", Body: "{}"}
+
+			expectAllowStep(mockBudget, step)
+			expectAllowPolicy(mockPolicy, cfg, step)
+			mockHTTP.EXPECT().Fetch(gomock.Any(), gomock.Any()).Times(0)
+
+			res, err := subject.RunStep(context.Background(), cfg, step)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res.Outcome).To(Equal(types.OutcomeDryRun))
+			Expect(res.Transcript).To(Equal(`[dry-run][http] method="POST" url="https://api.example.com/items" body_len=2` + "\n"))
+		})
 	})
 }
 
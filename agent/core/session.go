@@ -0,0 +1,106 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"github.com/kardolus/chatgpt-cli/agent/types"
+	"strings"
+	"sync"
+)
+
+// maxSummarizedEffects caps the lines SummarizeEffects returns.
+const maxSummarizedEffects = 20
+
+// EffectRecorder is a Runner that keeps the effects of every step it runs, so the effects
+// of a whole run can be recorded once it is done.
+type EffectRecorder struct {
+	Runner
+
+	mu      sync.Mutex
+	effects types.Effects
+}
+
+func NewEffectRecorder(r Runner) *EffectRecorder {
+	return &EffectRecorder{Runner: r}
+}
+
+func (r *EffectRecorder) RunStep(ctx context.Context, cfg types.Config, step types.Step) (types.StepResult, error) {
+	res, err := r.Runner.RunStep(ctx, cfg, step)
+
+	r.mu.Lock()
+	r.effects = append(r.effects, res.Effects...)
+	r.mu.Unlock()
+
+	return res, err
+}
+
+// Effects returns the effects recorded so far and starts over.
+func (r *EffectRecorder) Effects() types.Effects {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	out := r.effects
+	r.effects = nil
+	return out
+}
+
+// SummarizeEffects describes effects one per line, e.g. "file.write main.go" or
+// "shell.exec go test ./... (exit 1)", without repeating lines and keeping at most
+// maxSummarizedEffects of them.
+func SummarizeEffects(effects types.Effects) []string {
+	var out []string
+	seen := map[string]bool{}
+	skipped := 0
+
+	for _, e := range effects {
+		line := describeEffect(e)
+		if seen[line] {
+			continue
+		}
+		seen[line] = true
+
+		if len(out) == maxSummarizedEffects {
+			skipped++
+			continue
+		}
+		out = append(out, line)
+	}
+
+	if skipped > 0 {
+		out = append(out, fmt.Sprintf("... and %d more", skipped))
+	}
+	return out
+}
+
+func describeEffect(e types.StepEffect) string {
+	switch e.Kind {
+	case "shell.exec":
+		cmd := strings.TrimSpace(fmt.Sprint(e.Meta["cmd"]))
+		if args, ok := e.Meta["args"].([]string); ok && len(args) > 0 {
+			cmd += " " + strings.Join(args, " ")
+		}
+		line := clip(e.Kind+" "+cmd, 160)
+		if code, ok := e.Meta["exitCode"].(int); ok && code != 0 {
+			line += fmt.Sprintf(" (exit %d)", code)
+		}
+		return line
+	case "file.move":
+		return fmt.Sprintf("%s %s -> %v", e.Kind, e.Path, e.Meta["dest"])
+	case "agent.delegate":
+		return fmt.Sprintf("%s %v (%v)", e.Kind, e.Meta["id"], e.Meta["mode"])
+	case "http.request":
+		return clip(fmt.Sprintf("%s %v %v (status %v)", e.Kind, e.Meta["method"], e.Meta["url"], e.Meta["status"]), 200)
+	}
+
+	if e.Path != "" {
+		return e.Kind + " " + e.Path
+	}
+	return e.Kind
+}
+
+func clip(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
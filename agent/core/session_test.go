@@ -0,0 +1,88 @@
+package core_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/kardolus/chatgpt-cli/agent/core"
+	"github.com/kardolus/chatgpt-cli/agent/types"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/gomega"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+)
+
+func TestUnitSession(t *testing.T) {
+	spec.Run(t, "Testing agent sessions", testSession, spec.Report(report.Terminal{}))
+}
+
+func testSession(t *testing.T, when spec.G, it spec.S) {
+	it.Before(func() {
+		RegisterTestingT(t)
+	})
+
+	when("EffectRecorder", func() {
+		it("keeps the effects of every step, including failed ones, until they are taken", func() {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			runner := NewMockRunner(ctrl)
+			write := types.StepEffect{Kind: "file.write", Path: "main.go", Bytes: 10}
+			exec := types.StepEffect{Kind: "shell.exec", Meta: map[string]any{"cmd": "go", "args": []string{"test"}, "exitCode": 1}}
+
+			runner.EXPECT().RunStep(gomock.Any(), gomock.Any(), gomock.Any()).
+				Return(types.StepResult{Outcome: types.OutcomeOK, Effects: types.Effects{write}}, nil)
+			runner.EXPECT().RunStep(gomock.Any(), gomock.Any(), gomock.Any()).
+				Return(types.StepResult{Outcome: types.OutcomeError, Effects: types.Effects{exec}}, errors.New("boom"))
+
+			subject := core.NewEffectRecorder(runner)
+
+			_, err := subject.RunStep(context.Background(), types.Config{}, types.Step{})
+			Expect(err).NotTo(HaveOccurred())
+			_, err = subject.RunStep(context.Background(), types.Config{}, types.Step{})
+			Expect(err).To(MatchError("boom"))
+
+			Expect(subject.Effects()).To(Equal(types.Effects{write, exec}))
+			Expect(subject.Effects()).To(BeEmpty())
+		})
+	})
+
+	when("SummarizeEffects()", func() {
+		it("describes each effect on one line without repeats", func() {
+			lines := core.SummarizeEffects(types.Effects{
+				{Kind: "file.write", Path: "main.go", Bytes: 10},
+				{Kind: "file.patch", Path: "main.go"},
+				{Kind: "file.write", Path: "main.go", Bytes: 12},
+				{Kind: "file.move", Path: "a.go", Meta: map[string]any{"dest": "b.go"}},
+				{Kind: "shell.exec", Meta: map[string]any{"cmd": "go", "args": []string{"test", "./..."}, "exitCode": 0}},
+				{Kind: "shell.exec", Meta: map[string]any{"cmd": "go", "args": []string{"vet"}, "exitCode": 2}},
+				{Kind: "http.request", Meta: map[string]any{"method": "GET", "url": "https://go.dev", "status": 200}},
+				{Kind: "memory.remember"},
+			})
+
+			Expect(lines).To(Equal([]string{
+				"file.write main.go",
+				"file.patch main.go",
+				"file.move a.go -> b.go",
+				"shell.exec go test ./...",
+				"shell.exec go vet (exit 2)",
+				"http.request GET https://go.dev (status 200)",
+				"memory.remember",
+			}))
+		})
+
+		it("keeps the first 20 lines", func() {
+			var effects types.Effects
+			for i := range 25 {
+				effects = append(effects, types.StepEffect{Kind: "file.write", Path: fmt.Sprintf("f%d.go", i)})
+			}
+
+			lines := core.SummarizeEffects(effects)
+			Expect(lines).To(HaveLen(21))
+			Expect(lines[19]).To(Equal("file.write f19.go"))
+			Expect(lines[20]).To(Equal("... and 5 more"))
+		})
+	})
+}
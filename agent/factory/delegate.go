@@ -0,0 +1,247 @@
+package factory
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/kardolus/chatgpt-cli/agent/core"
+	"github.com/kardolus/chatgpt-cli/agent/planexec"
+	"github.com/kardolus/chatgpt-cli/agent/types"
+	"go.uber.org/zap"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// DelegateBudgetShare is the share of what is left of the parent's budget a child gets.
+	DelegateBudgetShare = 0.5
+
+	// DefaultMaxDelegationDepth only lets the agent the user started delegate.
+	DefaultMaxDelegationDepth = 1
+
+	delegationTreeFile = "tree.json"
+)
+
+// DelegationNode is a child agent in the delegation tree of a run.
+type DelegationNode struct {
+	ID         string           `json:"id"`
+	Parent     string           `json:"parent,omitempty"`
+	Mode       string           `json:"mode"`
+	Goal       string           `json:"goal"`
+	Tools      []types.ToolKind `json:"tools,omitempty"`
+	Answer     string           `json:"answer,omitempty"`
+	Error      string           `json:"error,omitempty"`
+	Effects    []string         `json:"effects,omitempty"`
+	Duration   string           `json:"duration,omitempty"`
+	Transcript string           `json:"transcript,omitempty"`
+}
+
+// Delegator runs delegate steps with child agents built like the parent: same clock, LLM,
+// tools and base options, a share of the parent's budget and the parent's policy,
+// narrowed to the tools the step lists. A child only hands back its answer and effects;
+// its transcript goes to the artifacts dir along with the delegation tree.
+type Delegator struct {
+	deps       Deps
+	tools      core.Tools
+	policy     core.Policy
+	opts       []core.BaseOption
+	newPlanner func(core.Budget) planexec.Planner
+	maxDepth   int
+	dir        string
+
+	id    string // of the agent delegating, "" for the one the user started
+	depth int
+	tree  *delegationTree
+
+	mu       sync.Mutex
+	children int
+}
+
+type DelegatorOption func(*Delegator)
+
+// WithPlanner lets children run in plan mode with a planner made for their budget.
+func WithPlanner(f func(core.Budget) planexec.Planner) DelegatorOption {
+	return func(d *Delegator) { d.newPlanner = f }
+}
+
+// WithChildOptions sets the base options of every child, e.g. WithMaxParallel.
+func WithChildOptions(opts ...core.BaseOption) DelegatorOption {
+	return func(d *Delegator) { d.opts = opts }
+}
+
+// WithMaxDepth sets how deep children may delegate in turn; 1 means children can't.
+func WithMaxDepth(n int) DelegatorOption {
+	return func(d *Delegator) { d.maxDepth = n }
+}
+
+// WithArtifactsDir keeps the transcripts of the children and the delegation tree in dir.
+func WithArtifactsDir(dir string) DelegatorOption {
+	return func(d *Delegator) { d.dir = dir }
+}
+
+// NewDelegator returns the delegator of the agent with the given deps, tools and policy.
+// deps needs a Clock, an LLM and the Budget of the parent.
+func NewDelegator(deps Deps, tools core.Tools, policy core.Policy, opts ...DelegatorOption) *Delegator {
+	d := &Delegator{
+		deps:     deps,
+		tools:    tools,
+		policy:   policy,
+		maxDepth: DefaultMaxDelegationDepth,
+		tree:     &delegationTree{},
+	}
+	for _, o := range opts {
+		o(d)
+	}
+	return d
+}
+
+func (d *Delegator) Delegate(ctx context.Context, cfg types.Config, step types.Step) (core.DelegateResult, error) {
+	d.mu.Lock()
+	d.children++
+	id := strconv.Itoa(d.children)
+	d.mu.Unlock()
+	if d.id != "" {
+		id = d.id + "." + id
+	}
+
+	res := core.DelegateResult{ID: id, Mode: step.AgentMode}
+	if res.Mode == "" {
+		res.Mode = "react"
+	}
+
+	clk := d.deps.Clock
+	start := clk.Now()
+	budget := core.NewSubBudget(d.deps.Budget, core.CarveBudget(d.deps.Budget.Snapshot(start), DelegateBudgetShare))
+
+	tools := d.tools
+	tools.Delegate = nil
+	if d.depth+1 < d.maxDepth {
+		child := d.childOf(id)
+		child.deps.Budget = budget
+		tools.Delegate = child
+	}
+	recorder := core.NewEffectRecorder(core.NewDefaultRunner(tools, clk, budget, core.RestrictTools(d.policy, step.Tools)))
+
+	deps := Deps{Clock: clk, LLM: d.deps.LLM, Runner: recorder, Budget: budget}
+	mode := ModeReAct
+	if res.Mode == "plan" {
+		if d.newPlanner == nil {
+			return res, errors.New("sub-agents can't run in plan mode here")
+		}
+		mode = ModePlanExecute
+		deps.Planner = d.newPlanner(budget)
+	}
+
+	// The child logs to its own transcript only; the parent sees its answer.
+	base := core.NewBaseAgent(clk)
+	for _, o := range d.opts {
+		o(base)
+	}
+	base.Config.WorkDir = cfg.WorkDir
+	base.Config.DryRun = cfg.DryRun
+	base.Out = zap.NewNop().Sugar()
+	base.SyncOut = nil
+	base.Debug = base.Debug.With("agent", id)
+	base.PriorRuns = nil
+	base.Delegation = tools.Delegate != nil
+
+	if err := validateDepsForMode(mode, deps); err != nil {
+		return res, err
+	}
+	agent, err := newAgent(mode, deps, base)
+	if err != nil {
+		return res, err
+	}
+
+	node := d.tree.add(DelegationNode{ID: id, Parent: d.id, Mode: res.Mode, Goal: step.Goal, Tools: step.Tools})
+
+	answer, err := agent.RunAgentGoal(ctx, step.Goal)
+	res.Answer = answer
+	res.Effects = recorder.Effects()
+
+	d.tree.finish(node, func(n *DelegationNode) {
+		n.Answer = answer
+		if err != nil {
+			n.Error = err.Error()
+		}
+		n.Effects = core.SummarizeEffects(res.Effects)
+		n.Duration = clk.Now().Sub(start).Round(time.Millisecond).String()
+		if d.dir != "" {
+			n.Transcript = transcriptFile(id)
+		}
+	})
+	// best-effort: the artifacts don't decide the run
+	if werr := d.writeArtifacts(id, base.Transcript.String()); werr != nil {
+		base.Debug.Warnf("writing the sub-agent artifacts: %v", werr)
+	}
+
+	return res, err
+}
+
+// childOf returns the delegator the child id gets, sharing the tree of this one.
+func (d *Delegator) childOf(id string) *Delegator {
+	return &Delegator{
+		deps:       d.deps,
+		tools:      d.tools,
+		policy:     d.policy,
+		opts:       d.opts,
+		newPlanner: d.newPlanner,
+		maxDepth:   d.maxDepth,
+		dir:        d.dir,
+		id:         id,
+		depth:      d.depth + 1,
+		tree:       d.tree,
+	}
+}
+
+// Tree returns the children started so far, in the order they started.
+func (d *Delegator) Tree() []DelegationNode {
+	d.tree.mu.Lock()
+	defer d.tree.mu.Unlock()
+	return append([]DelegationNode(nil), d.tree.nodes...)
+}
+
+func (d *Delegator) writeArtifacts(id, transcript string) error {
+	if d.dir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(d.dir, 0o700); err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(filepath.Join(d.dir, transcriptFile(id)), []byte(transcript), 0o644); err != nil {
+		return err
+	}
+
+	b, err := json.MarshalIndent(d.Tree(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(d.dir, delegationTreeFile), b, 0o644)
+}
+
+func transcriptFile(id string) string {
+	return fmt.Sprintf("agent-%s.transcript.log", id)
+}
+
+type delegationTree struct {
+	mu    sync.Mutex
+	nodes []DelegationNode
+}
+
+func (t *delegationTree) add(n DelegationNode) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.nodes = append(t.nodes, n)
+	return len(t.nodes) - 1
+}
+
+func (t *delegationTree) finish(i int, update func(*DelegationNode)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	update(&t.nodes[i])
+}
@@ -0,0 +1,145 @@
+package factory_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/kardolus/chatgpt-cli/agent/core"
+	"github.com/kardolus/chatgpt-cli/agent/factory"
+	"github.com/kardolus/chatgpt-cli/agent/tools"
+	"github.com/kardolus/chatgpt-cli/agent/types"
+	"github.com/kardolus/chatgpt-cli/internal/fsio"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/gomega"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+)
+
+//go:generate mockgen -destination=llmmocks_test.go -package=factory_test github.com/kardolus/chatgpt-cli/agent/tools LLM
+
+func TestUnitDelegator(t *testing.T) {
+	spec.Run(t, "Testing the delegator", testDelegator, spec.Report(report.Terminal{}))
+}
+
+func testDelegator(t *testing.T, when spec.G, it spec.S) {
+	var (
+		mockCtrl *gomock.Controller
+		mockLLM  *MockLLM
+
+		workDir   string
+		artifacts string
+		budget    *core.DefaultBudget
+		subject   *factory.Delegator
+	)
+
+	it.Before(func() {
+		RegisterTestingT(t)
+
+		mockCtrl = gomock.NewController(t)
+		mockLLM = NewMockLLM(mockCtrl)
+
+		workDir = t.TempDir()
+		artifacts = filepath.Join(t.TempDir(), "delegates")
+		budget = core.NewDefaultBudget(core.BudgetLimits{MaxIterations: 5, MaxLLMCalls: 10})
+
+		agentTools := core.Tools{
+			LLM:   mockLLM,
+			Files: tools.NewFSIOFileOps(fsio.NewRealReader(fsio.DefaultBufferSize), &fsio.RealWriter{}),
+		}
+		subject = factory.NewDelegator(
+			factory.Deps{Clock: core.NewRealClock(), LLM: mockLLM, Budget: budget},
+			agentTools,
+			core.NewDefaultPolicy(core.PolicyLimits{}),
+			factory.WithArtifactsDir(artifacts),
+		)
+	})
+
+	it.After(func() {
+		mockCtrl.Finish()
+	})
+
+	when("Delegate()", func() {
+		it("runs a child agent and hands back only its answer and effects", func() {
+			path := filepath.Join(workDir, "notes.txt")
+			gomock.InOrder(
+				mockLLM.EXPECT().Complete(gomock.Any(), gomock.Any()).
+					DoAndReturn(func(_ context.Context, prompt string) (string, int, error) {
+						Expect(prompt).To(ContainSubstring("USER: write the notes"))
+						Expect(prompt).NotTo(ContainSubstring("delegate"))
+						return fmt.Sprintf(`{"thought":"t","action_type":"tool","tool":"file","op":"write","path":%q,"data":"hi"}`, path), 3, nil
+					}),
+				mockLLM.EXPECT().Complete(gomock.Any(), gomock.Any()).
+					Return(`{"thought":"done","action_type":"answer","final_answer":"wrote notes.txt"}`, 2, nil),
+			)
+
+			res, err := subject.Delegate(context.Background(), types.Config{WorkDir: workDir}, types.Step{
+				Type: types.ToolDelegate,
+				Goal: "write the notes",
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res.ID).To(Equal("1"))
+			Expect(res.Mode).To(Equal("react"))
+			Expect(res.Answer).To(Equal("wrote notes.txt"))
+			Expect(res.Effects).To(HaveLen(1))
+			Expect(res.Effects[0].Path).To(Equal(path))
+
+			b, err := os.ReadFile(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(b)).To(Equal("hi"))
+
+			s := budget.Snapshot(time.Now())
+			Expect(s.LLMUsed).To(Equal(2))
+			Expect(s.LLMTokensUsed).To(Equal(5))
+			Expect(s.IterationsUsed).To(Equal(0))
+
+			transcript, err := os.ReadFile(filepath.Join(artifacts, "agent-1.transcript.log"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(transcript)).To(ContainSubstring("write the notes"))
+
+			var tree []factory.DelegationNode
+			b, err = os.ReadFile(filepath.Join(artifacts, "tree.json"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(json.Unmarshal(b, &tree)).To(Succeed())
+			Expect(tree).To(HaveLen(1))
+			Expect(tree[0].ID).To(Equal("1"))
+			Expect(tree[0].Answer).To(Equal("wrote notes.txt"))
+			Expect(tree[0].Transcript).To(Equal("agent-1.transcript.log"))
+		})
+
+		it("keeps the child to the tools of the step", func() {
+			path := filepath.Join(workDir, "notes.txt")
+			mockLLM.EXPECT().Complete(gomock.Any(), gomock.Any()).
+				Return(fmt.Sprintf(`{"thought":"t","action_type":"tool","tool":"file","op":"write","path":%q,"data":"hi"}`, path), 1, nil)
+
+			res, err := subject.Delegate(context.Background(), types.Config{WorkDir: workDir}, types.Step{
+				Type:  types.ToolDelegate,
+				Goal:  "write the notes",
+				Tools: []types.ToolKind{types.ToolLLM},
+			})
+			Expect(err).To(MatchError(ContainSubstring("tool not allowed for this sub-agent: file")))
+			Expect(res.Effects).To(BeEmpty())
+			Expect(subject.Tree()[0].Error).To(ContainSubstring("tool not allowed"))
+
+			_, err = os.Stat(path)
+			Expect(os.IsNotExist(err)).To(BeTrue())
+		})
+
+		it("numbers the children and fails plan mode without a planner", func() {
+			mockLLM.EXPECT().Complete(gomock.Any(), gomock.Any()).
+				Return(`{"thought":"done","action_type":"answer","final_answer":"ok"}`, 1, nil)
+
+			_, err := subject.Delegate(context.Background(), types.Config{}, types.Step{Type: types.ToolDelegate, Goal: "a"})
+			Expect(err).NotTo(HaveOccurred())
+
+			res, err := subject.Delegate(context.Background(), types.Config{}, types.Step{Type: types.ToolDelegate, Goal: "b", AgentMode: "plan"})
+			Expect(err).To(MatchError(ContainSubstring("plan mode")))
+			Expect(res.ID).To(Equal("2"))
+			Expect(subject.Tree()).To(HaveLen(1))
+		})
+	})
+}
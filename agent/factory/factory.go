@@ -69,7 +69,10 @@ func New(mode Mode, deps Deps, baseOpts ...core.BaseOption) (Agent, error) {
 	for _, o := range baseOpts {
 		o(base)
 	}
+	return newAgent(mode, deps, base)
+}
 
+func newAgent(mode Mode, deps Deps, base *core.BaseAgent) (Agent, error) {
 	switch mode {
 	case ModePlanExecute:
 		return &planexec.PlanExecuteAgent{BaseAgent: base, Planner: deps.Planner, Runner: deps.Runner}, nil
@@ -0,0 +1,51 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: github.com/kardolus/chatgpt-cli/agent/tools (interfaces: LLM)
+
+// Package factory_test is a generated GoMock package.
+package factory_test
+
+import (
+	context "context"
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockLLM is a mock of LLM interface.
+type MockLLM struct {
+	ctrl     *gomock.Controller
+	recorder *MockLLMMockRecorder
+}
+
+// MockLLMMockRecorder is the mock recorder for MockLLM.
+type MockLLMMockRecorder struct {
+	mock *MockLLM
+}
+
+// NewMockLLM creates a new mock instance.
+func NewMockLLM(ctrl *gomock.Controller) *MockLLM {
+	mock := &MockLLM{ctrl: ctrl}
+	mock.recorder = &MockLLMMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockLLM) EXPECT() *MockLLMMockRecorder {
+	return m.recorder
+}
+
+// Complete mocks base method.
+func (m *MockLLM) Complete(arg0 context.Context, arg1 string) (string, int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Complete", arg0, arg1)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(int)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// Complete indicates an expected call of Complete.
+func (mr *MockLLMMockRecorder) Complete(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Complete", reflect.TypeOf((*MockLLM)(nil).Complete), arg0, arg1)
+}
@@ -78,6 +78,18 @@ func (mr *MockBudgetMockRecorder) AllowTool(arg0, arg1 interface{}) *gomock.Call
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AllowTool", reflect.TypeOf((*MockBudget)(nil).AllowTool), arg0, arg1)
 }
 
+// ChargeCost mocks base method.
+func (m *MockBudget) ChargeCost(arg0 float64, arg1 time.Time) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "ChargeCost", arg0, arg1)
+}
+
+// ChargeCost indicates an expected call of ChargeCost.
+func (mr *MockBudgetMockRecorder) ChargeCost(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ChargeCost", reflect.TypeOf((*MockBudget)(nil).ChargeCost), arg0, arg1)
+}
+
 // ChargeLLMTokens mocks base method.
 func (m *MockBudget) ChargeLLMTokens(arg0 int, arg1 time.Time) {
 	m.ctrl.T.Helper()
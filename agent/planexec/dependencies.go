@@ -0,0 +1,175 @@
+package planexec
+
+import (
+	"fmt"
+	"github.com/kardolus/chatgpt-cli/agent/types"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+var (
+	reStepID = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+	// matches: .ByID.lint or (index .ByID "lint")
+	reByIDField = regexp.MustCompile(`\.ByID\.([A-Za-z_][A-Za-z0-9_]*)`)
+	reByIDIndex = regexp.MustCompile(`index +\.ByID +"([^"]*)"`)
+)
+
+// stepDependencies returns the indexes of the steps every step waits for. Steps of a plan
+// that doesn't use DependsOn wait for the step before them, as they always have. Otherwise
+// a step waits for the steps it lists in DependsOn and for the steps whose results its
+// templates use. Steps before from already ran and wait for nothing.
+func stepDependencies(steps []types.Step, from int) ([][]int, error) {
+	ids := map[string]int{}
+	graph := false
+	for i, s := range steps {
+		if s.DependsOn != nil {
+			graph = true
+		}
+		if s.ID == "" {
+			continue
+		}
+		if !reStepID.MatchString(s.ID) {
+			return nil, fmt.Errorf("step %d: invalid id %q (use letters, digits and underscores)", i, s.ID)
+		}
+		if j, ok := ids[s.ID]; ok {
+			return nil, fmt.Errorf("step %d: id %q is already used by step %d", i, s.ID, j)
+		}
+		ids[s.ID] = i
+	}
+
+	deps := make([][]int, len(steps))
+	for i := from; i < len(steps); i++ {
+		s := steps[i]
+		seen := map[int]bool{}
+		add := func(j int) {
+			if !seen[j] {
+				seen[j] = true
+				deps[i] = append(deps[i], j)
+			}
+		}
+
+		if !graph && i > 0 {
+			add(i - 1)
+		}
+		for _, id := range s.DependsOn {
+			j, ok := ids[strings.TrimSpace(id)]
+			if !ok {
+				return nil, fmt.Errorf("step %d depends on unknown step %q", i, id)
+			}
+			if j == i {
+				return nil, fmt.Errorf("step %d depends on itself", i)
+			}
+			add(j)
+		}
+
+		for _, tpl := range stepTemplates(s) {
+			for _, m := range reResultsIndex.FindAllStringSubmatch(tpl, -1) {
+				if j, err := strconv.Atoi(m[1]); err == nil && j < i {
+					add(j)
+				}
+			}
+			for _, id := range referencedIDs(tpl) {
+				j, ok := ids[id]
+				if !ok {
+					return nil, fmt.Errorf("step %d uses the result of unknown step %q", i, id)
+				}
+				if j == i {
+					return nil, fmt.Errorf("step %d uses its own result", i)
+				}
+				add(j)
+			}
+		}
+	}
+
+	if cycle := findCycle(steps, deps); cycle != "" {
+		return nil, fmt.Errorf("steps depend on each other: %s", cycle)
+	}
+	return deps, nil
+}
+
+// findCycle returns the steps of a dependency cycle, e.g. "a -> b -> a" when a depends on b
+// and b on a, or "".
+func findCycle(steps []types.Step, deps [][]int) string {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make([]int, len(steps))
+	var path []int
+
+	var visit func(i int) string
+	visit = func(i int) string {
+		state[i] = visiting
+		path = append(path, i)
+		for _, j := range deps[i] {
+			switch state[j] {
+			case visiting:
+				var names []string
+				for k := slices.Index(path, j); k < len(path); k++ {
+					names = append(names, stepName(steps, path[k]))
+				}
+				return strings.Join(append(names, stepName(steps, j)), " -> ")
+			case unvisited:
+				if cycle := visit(j); cycle != "" {
+					return cycle
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		state[i] = visited
+		return ""
+	}
+
+	for i := range steps {
+		if state[i] == unvisited {
+			if cycle := visit(i); cycle != "" {
+				return cycle
+			}
+		}
+	}
+	return ""
+}
+
+func stepName(steps []types.Step, i int) string {
+	if steps[i].ID != "" {
+		return steps[i].ID
+	}
+	return fmt.Sprintf("step %d", i)
+}
+
+func referencedIDs(tpl string) []string {
+	if !containsTemplateMarker(tpl) || !strings.Contains(tpl, ".ByID") {
+		return nil
+	}
+	var ids []string
+	for _, re := range []*regexp.Regexp{reByIDField, reByIDIndex} {
+		for _, m := range re.FindAllStringSubmatch(tpl, -1) {
+			ids = append(ids, m[1])
+		}
+	}
+	return ids
+}
+
+// stepTemplates returns the fields of a step that ApplyTemplate renders.
+func stepTemplates(s types.Step) []string {
+	fields := []string{s.Description}
+	switch s.Type {
+	case types.ToolShell:
+		fields = append(fields, s.Command)
+		fields = append(fields, s.Args...)
+	case types.ToolLLM:
+		fields = append(fields, s.Prompt)
+	case types.ToolFiles:
+		fields = append(fields, s.Op, s.Path, s.Data, s.Pattern, s.Dest)
+	case types.ToolHTTP:
+		fields = append(fields, s.URL, s.Body)
+		for _, v := range s.Headers {
+			fields = append(fields, v)
+		}
+	}
+	return fields
+}
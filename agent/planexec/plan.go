@@ -15,13 +15,32 @@ import (
 	"strconv"
 	"strings"
 	"text/template"
+	"unicode/utf8"
 )
 
 // matches: (index .Results 0) or (index .Results 12)
 var reResultsIndex = regexp.MustCompile(`\( *index +\.Results +([0-9]+) *\)`)
 
+// maxStepRetries caps the retries a planner can ask for on a single step.
+const maxStepRetries = 3
+
 type Planner interface {
 	Plan(ctx context.Context, goal string) (types.Plan, error)
+
+	// Replan revises a plan after a step failed. The revised plan starts with the completed
+	// steps, in the order of req.Completed, followed by the steps that still have to run.
+	Replan(ctx context.Context, req ReplanRequest) (types.Plan, error)
+}
+
+// ReplanRequest is what a planner gets to revise a failed plan.
+type ReplanRequest struct {
+	Goal string
+	Plan types.Plan
+
+	Completed []types.StepResult // finished steps in plan order, Step being the rendered step
+	Failed    types.StepResult   // the step that failed, after its retries
+	Err       error              // the runner error of the failed step, if any
+	Pending   []types.Step       // steps that did not run because of the failure
 }
 
 type LoggingPlanner struct {
@@ -68,6 +87,21 @@ func (p *LoggingPlanner) Plan(ctx context.Context, goal string) (types.Plan, err
 	return plan, nil
 }
 
+func (p *LoggingPlanner) Replan(ctx context.Context, req ReplanRequest) (types.Plan, error) {
+	p.log.Debugf("Planner: replan completed=%d failed=%q", len(req.Completed), req.Failed.Step.Description)
+
+	plan, err := p.inner.Replan(ctx, req)
+	if err != nil {
+		p.log.Debugf("Planner: replan error=%v", err)
+		return types.Plan{}, err
+	}
+
+	p.writeNormalized(plan)
+
+	p.log.Debugf("Planner: replan ok steps=%d", len(plan.Steps))
+	return plan, nil
+}
+
 func (p *LoggingPlanner) writeNormalized(plan types.Plan) {
 	if p.normalizedPath == "" {
 		return
@@ -142,6 +176,118 @@ func (p *DefaultPlanner) Plan(ctx context.Context, goal string) (types.Plan, err
 	return plan, nil
 }
 
+func (p *DefaultPlanner) Replan(ctx context.Context, req ReplanRequest) (types.Plan, error) {
+	goal := strings.TrimSpace(req.Goal)
+	if goal == "" {
+		return types.Plan{}, errors.New("missing goal")
+	}
+
+	now := p.clock.Now()
+
+	if err := p.budget.AllowTool(types.ToolLLM, now); err != nil {
+		return types.Plan{}, err
+	}
+
+	raw, tokens, err := p.llm.Complete(ctx, buildPlanningPrompt(goal)+buildReplanPrompt(req))
+	if err != nil {
+		return types.Plan{}, err
+	}
+
+	if p.onRaw != nil {
+		p.onRaw(raw)
+	}
+
+	p.budget.ChargeLLMTokens(tokens, now)
+
+	remainder, err := parsePlanJSON(raw, goal)
+	if err != nil {
+		return types.Plan{}, err
+	}
+	if len(remainder.Steps) == 0 {
+		return types.Plan{}, errors.New("planner returned no steps to recover from the failure")
+	}
+
+	plan := types.Plan{Goal: goal}
+	for _, res := range req.Completed {
+		plan.Steps = append(plan.Steps, res.Step)
+	}
+	plan.Steps = append(plan.Steps, remainder.Steps...)
+
+	if err := validateSteps(plan, len(req.Completed)); err != nil {
+		return types.Plan{}, err
+	}
+
+	return plan, nil
+}
+
+const (
+	replanOutputMaxBytes     = 2000
+	replanTranscriptMaxBytes = 4000
+)
+
+func buildReplanPrompt(req ReplanRequest) string {
+	var b strings.Builder
+
+	b.WriteString(`
+REPLANNING (IMPORTANT):
+A step of the plan for this goal failed. Return a plan with ONLY the steps that still have to run to reach the goal:
+- Do NOT repeat the completed steps; their results are kept.
+- Fix the cause of the failure (e.g. a wrong path or command) or work around it.
+- If the goal cannot be reached, return steps that explain why (e.g. an llm step).
+`)
+
+	if len(req.Completed) == 0 {
+		b.WriteString("\nNo steps completed. Your steps are numbered from 0.\n")
+	} else {
+		b.WriteString("\nCompleted steps, available to templates as (index .Results N) and, when they have an id, as .ByID.<id>:\n")
+		for i, res := range req.Completed {
+			_, _ = fmt.Fprintf(&b, "[%d] %s outcome=%s\n", i, describeReplanStep(res.Step), res.Outcome)
+			if out := strings.TrimSpace(res.Output); out != "" {
+				_, _ = fmt.Fprintf(&b, "    output: %s\n", clipText(out, replanOutputMaxBytes))
+			}
+		}
+		_, _ = fmt.Fprintf(&b, "Your steps are numbered from %d, so (index .Results %d) is your first step.\n",
+			len(req.Completed), len(req.Completed))
+	}
+
+	_, _ = fmt.Fprintf(&b, "\nFailed step:\n%s\n", describeReplanStep(req.Failed.Step))
+	if req.Err != nil {
+		_, _ = fmt.Fprintf(&b, "error: %v\n", req.Err)
+	}
+	if tr := strings.TrimSpace(req.Failed.Transcript); tr != "" {
+		_, _ = fmt.Fprintf(&b, "transcript:\n%s\n", clipText(tr, replanTranscriptMaxBytes))
+	}
+
+	if len(req.Pending) > 0 {
+		b.WriteString("\nSteps of the failed plan that did not run:\n")
+		for _, s := range req.Pending {
+			_, _ = fmt.Fprintf(&b, "- %s\n", describeReplanStep(s))
+		}
+	}
+
+	return b.String()
+}
+
+func describeReplanStep(s types.Step) string {
+	desc := fmt.Sprintf("%q (%s)", s.Description, core.DescribeStep(s))
+	if s.ID != "" {
+		desc = "id=" + s.ID + " " + desc
+	}
+	return desc
+}
+
+// clipText keeps the start of s, marking the cut.
+func clipText(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	cut := max
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return s[:cut] + "…(truncated)"
+}
+
 func buildPlanningPrompt(goal string) string {
 	return fmt.Sprintf(`
 You are a planning module for a CLI agent. Convert the user's goal into an explicit plan.
@@ -161,7 +307,11 @@ Return JSON matching this schema:
   "goal": "string",
   "steps": [
     {
-      "type": "%s" | "%s" | "%s",
+      "id": "string",
+      "depends_on": ["string", "..."],
+      "retries": 0,
+      "on_error": "abort" | "continue" | "replan",
+      "type": "%s" | "%s" | "%s" | "%s",
       "description": "string",
 
       // %s-only:
@@ -172,9 +322,21 @@ Return JSON matching this schema:
       "prompt": "string",
 
       // %s-only:
-      "op": "read" | "write",
+      "op": "read" | "write" | "list" | "search" | "stat" | "mkdir" | "move" | "delete",
       "path": "string",
-      "data": "string"
+      "data": "string",
+      "start_line": 0,
+      "end_line": 0,
+      "pattern": "string",
+      "glob": "string",
+      "depth": 0,
+      "dest": "string",
+
+      // %s-only:
+      "method": "GET",
+      "url": "string",
+      "headers": {"string": "string"},
+      "body": "string"
     }
   ]
 }
@@ -183,12 +345,19 @@ Core rules:
 - Keep steps minimal.
 - Prefer %s steps for concrete actions.
 - Use %s steps for reasoning/summarization based on prior results.
-- Use %s steps only for explicit reads/writes.
+- Use %s steps for reads, writes and finding files; prefer them over shell ls/find/grep.
+- Use %s steps to read documentation or call HTTP APIs; never shell out to curl or wget.
 - Every step must have a non-empty description.
 - You MAY include Go template expressions like {{ ... }} in any string field; they will be rendered later.
 
 FILE TOOL SEMANTICS (IMPORTANT):
-- "op":"read" returns the full current file content as Output.
+- "op":"read" returns the full current file content as Output, or only lines
+  "start_line" through "end_line" (1-based, inclusive) when they are set.
+- "op":"list" lists the directory "path", "depth" levels deep (default 1), optionally only names matching "glob".
+- "op":"search" returns the lines matching the regular expression "pattern" in "path" (a file, or every file
+  under a directory whose name matches "glob") as "path:line: text".
+- "op":"stat" describes "path"; "op":"mkdir" creates the directory "path".
+- "op":"move" moves "path" to "dest" and never overwrites; "op":"delete" deletes a file or an empty directory.
 - "op":"write" OVERWRITES THE ENTIRE FILE CONTENT with "data".
 - There is NO append mode and NO in-place edit mode.
 - Therefore, for "modify a line or two", plan MUST do:
@@ -220,6 +389,22 @@ Template rules:
   - {{ (index .Results 1).Output }}
 - Prefer using .Output unless you explicitly need raw stdout/stderr.
 
+Step ids and dependencies:
+- "id" is optional; use short names made of letters, digits and underscores, unique in the plan.
+- Steps with an id can be referenced by name, which is preferred over indexes:
+  - {{ .ByID.lint.Output }}
+- Without "depends_on", steps run one after the other.
+- When ANY step has "depends_on", steps run as soon as the steps they depend on are done,
+  possibly at the same time. Give every step "depends_on" then, using [] for steps that
+  need nothing, e.g. reading several files or running lint and tests.
+- A step that uses the result of another step in a template always waits for it.
+
+Failures:
+- "retries" (0-3) runs a failing step again; use it for flaky commands or network calls.
+- "on_error" says what happens when a step still fails: "abort" stops the run, "continue" keeps going with the
+  failed result (e.g. for a lint step whose findings you summarize), and "replan" (the default) lets you revise the
+  remaining steps.
+
 Examples:
 
 1) Shell + summarize:
@@ -264,13 +449,15 @@ SELF-CHECK BEFORE RESPONDING:
 - Does it contain NO markdown or backticks?
 If any answer is "no", fix it before returning.
 `,
-		types.ToolShell, types.ToolLLM, types.ToolFiles,
+		types.ToolShell, types.ToolLLM, types.ToolFiles, types.ToolHTTP,
 		types.ToolShell,
 		types.ToolLLM,
 		types.ToolFiles,
+		types.ToolHTTP,
 		types.ToolShell,
 		types.ToolLLM,
 		types.ToolFiles,
+		types.ToolHTTP,
 		types.ToolShell,
 		types.ToolLLM,
 		types.ToolFiles,
@@ -286,8 +473,12 @@ type planJSON struct {
 }
 
 type stepJSON struct {
-	Type        string `json:"type"`
-	Description string `json:"description"`
+	ID          string   `json:"id,omitempty"`
+	DependsOn   []string `json:"depends_on,omitempty"`
+	Retries     int      `json:"retries,omitempty"`
+	OnError     string   `json:"on_error,omitempty"`
+	Type        string   `json:"type"`
+	Description string   `json:"description"`
 
 	Command string   `json:"command,omitempty"`
 	Args    []string `json:"args,omitempty"`
@@ -297,6 +488,18 @@ type stepJSON struct {
 	Op   string `json:"op,omitempty"`
 	Path string `json:"path,omitempty"`
 	Data string `json:"data,omitempty"`
+
+	StartLine int    `json:"start_line,omitempty"`
+	EndLine   int    `json:"end_line,omitempty"`
+	Pattern   string `json:"pattern,omitempty"`
+	Glob      string `json:"glob,omitempty"`
+	Depth     int    `json:"depth,omitempty"`
+	Dest      string `json:"dest,omitempty"`
+
+	Method  string            `json:"method,omitempty"`
+	URL     string            `json:"url,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    string            `json:"body,omitempty"`
 }
 
 func parsePlanJSON(raw string, fallbackGoal string) (types.Plan, error) {
@@ -324,6 +527,10 @@ func parsePlanJSON(raw string, fallbackGoal string) (types.Plan, error) {
 		if err != nil {
 			return types.Plan{}, err
 		}
+		step.ID = strings.TrimSpace(s.ID)
+		step.DependsOn = s.DependsOn
+		step.Retries = s.Retries
+		step.OnError = types.OnError(strings.TrimSpace(strings.ToLower(s.OnError)))
 		out.Steps = append(out.Steps, step)
 	}
 
@@ -394,12 +601,38 @@ func convertStepJSON(s stepJSON) (types.Step, error) {
 		if path == "" {
 			return types.Step{}, errors.New("file step missing path")
 		}
+		if op == "search" && s.Pattern == "" {
+			return types.Step{}, errors.New("file search step missing pattern")
+		}
+		if op == "move" && strings.TrimSpace(s.Dest) == "" {
+			return types.Step{}, errors.New("file move step missing dest")
+		}
 		return types.Step{
 			Type:        types.ToolFiles,
 			Description: desc,
 			Op:          op,
 			Path:        path,
 			Data:        s.Data,
+			StartLine:   s.StartLine,
+			EndLine:     s.EndLine,
+			Pattern:     s.Pattern,
+			Glob:        s.Glob,
+			Depth:       s.Depth,
+			Dest:        strings.TrimSpace(s.Dest),
+		}, nil
+
+	case string(types.ToolHTTP): // "http"
+		url := strings.TrimSpace(s.URL)
+		if url == "" {
+			return types.Step{}, errors.New("http step missing url")
+		}
+		return types.Step{
+			Type:        types.ToolHTTP,
+			Description: desc,
+			Method:      strings.ToUpper(strings.TrimSpace(s.Method)),
+			URL:         url,
+			Headers:     s.Headers,
+			Body:        s.Body,
 		}, nil
 
 	default:
@@ -408,6 +641,12 @@ func convertStepJSON(s stepJSON) (types.Step, error) {
 }
 
 func validatePlan(p types.Plan) error {
+	return validateSteps(p, 0)
+}
+
+// validateSteps validates a plan whose steps before from already ran, which is the case
+// for revised plans.
+func validateSteps(p types.Plan, from int) error {
 	if strings.TrimSpace(p.Goal) == "" {
 		return errors.New("plan missing goal")
 	}
@@ -415,7 +654,8 @@ func validatePlan(p types.Plan) error {
 		return errors.New("plan has no steps")
 	}
 
-	for i, s := range p.Steps {
+	for i := from; i < len(p.Steps); i++ {
+		s := p.Steps[i]
 		if strings.TrimSpace(s.Description) == "" {
 			return fmt.Errorf("step %d missing description", i)
 		}
@@ -435,20 +675,36 @@ func validatePlan(p types.Plan) error {
 			if strings.TrimSpace(s.Path) == "" {
 				return fmt.Errorf("step %d files missing path", i)
 			}
+		case types.ToolHTTP:
+			if strings.TrimSpace(s.URL) == "" {
+				return fmt.Errorf("step %d http missing url", i)
+			}
 		default:
 			return fmt.Errorf("step %d has unknown type %q", i, s.Type)
 		}
+		if s.Retries < 0 || s.Retries > maxStepRetries {
+			return fmt.Errorf("step %d retries must be between 0 and %d", i, maxStepRetries)
+		}
+		switch s.OnError {
+		case "", types.OnErrorAbort, types.OnErrorContinue, types.OnErrorReplan:
+		default:
+			return fmt.Errorf("step %d has unknown on_error %q (expected continue|abort|replan)", i, s.OnError)
+		}
+	}
+
+	if err := validateTemplates(p, from); err != nil {
+		return err
 	}
 
-	if err := validateTemplates(p); err != nil {
+	if _, err := stepDependencies(p.Steps, from); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-func validateTemplates(p types.Plan) error {
-	for i := range p.Steps {
+func validateTemplates(p types.Plan, from int) error {
+	for i := from; i < len(p.Steps); i++ {
 		s := p.Steps[i]
 
 		if err := validateTemplateField(i, "description", s.Description); err != nil {
@@ -481,6 +737,25 @@ func validateTemplates(p types.Plan) error {
 			if err := validateTemplateField(i, "data", s.Data); err != nil {
 				return err
 			}
+			if err := validateTemplateField(i, "pattern", s.Pattern); err != nil {
+				return err
+			}
+			if err := validateTemplateField(i, "dest", s.Dest); err != nil {
+				return err
+			}
+
+		case types.ToolHTTP:
+			if err := validateTemplateField(i, "url", s.URL); err != nil {
+				return err
+			}
+			if err := validateTemplateField(i, "body", s.Body); err != nil {
+				return err
+			}
+			for k, v := range s.Headers {
+				if err := validateTemplateField(i, fmt.Sprintf("headers[%s]", k), v); err != nil {
+					return err
+				}
+			}
 
 		default:
 			return fmt.Errorf("step %d has unknown type %q", i, s.Type)
@@ -526,6 +801,10 @@ func validateTemplateField(stepIndex int, field string, s string) error {
 
 type NaivePlanner struct{}
 
+func (p *NaivePlanner) Replan(ctx context.Context, req ReplanRequest) (types.Plan, error) {
+	return types.Plan{}, errors.New("naive planner cannot replan")
+}
+
 func (p *NaivePlanner) Plan(ctx context.Context, goal string) (types.Plan, error) {
 	// Stub: good enough for wiring + tests.
 	// Later: call a.client to generate this.
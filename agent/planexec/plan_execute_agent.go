@@ -2,9 +2,11 @@ package planexec
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/kardolus/chatgpt-cli/agent/core"
 	"github.com/kardolus/chatgpt-cli/agent/types"
+	"slices"
 	"strings"
 	"unicode"
 )
@@ -62,89 +64,365 @@ func (a *PlanExecuteAgent) RunAgentGoal(ctx context.Context, goal string) (strin
 
 	dbg.Debugf("plan goal=%q steps=%d", plan.Goal, len(plan.Steps))
 
-	execCtx := types.ExecContext{Goal: goal, Plan: plan, Results: nil}
+	deps, err := stepDependencies(plan.Steps, 0)
+	if err != nil {
+		dbg.Errorf("invalid step dependencies: %v", err)
+		a.AddTranscript(fmt.Sprintf("[plan:error] %v\n", err))
+		return "", err
+	}
+
+	execCtx := types.ExecContext{
+		Goal:    goal,
+		Plan:    plan,
+		Results: make([]types.StepResult, len(plan.Steps)),
+		ByID:    map[string]types.StepResult{},
+	}
+	done := make([]bool, len(plan.Steps))
 
 	out.Infof("Goal: %s", plan.Goal)
 	out.Infof("Mode: Plan-and-Execute (plan first, then run tools)\n")
 
 	a.AddTranscript(fmt.Sprintf("[plan] goal=%q steps=%d\n", plan.Goal, len(plan.Steps)))
-	for i, s := range plan.Steps {
-		a.AddTranscript(fmt.Sprintf("[plan-step %d/%d] type=%s desc=%q\n", i+1, len(plan.Steps), s.Type, s.Description))
+	a.describeSteps(plan, 0)
+
+	for replans := 0; ; replans++ {
+		failed, err := a.runSteps(ctx, plan, deps, &execCtx, done)
+		if err == nil {
+			break
+		}
+		if failed == nil || !a.shouldReplan(failed.rendered, replans) {
+			return "", err
+		}
+
+		revised, rerr := a.replan(ctx, plan, execCtx, done, *failed, replans)
+		if rerr != nil {
+			return "", err
+		}
+		plan = revised.plan
+		deps = revised.deps
+		execCtx = revised.execCtx
+		done = revised.done
+	}
+
+	var final string
+	for _, res := range execCtx.Results {
+		if res.Output != "" && res.Outcome != types.OutcomeError {
+			final = res.Output
+		}
+	}
+
+	result := strings.TrimRightFunc(final, unicode.IsSpace)
+	out.Infof("\nResult: %s\n", result)
+	dbg.Debugf("final (trimmed): %q", result)
+
+	a.AddTranscript(fmt.Sprintf("[final]\n%s\n", result))
+	return result, nil
+}
+
+type stepDone struct {
+	index    int
+	rendered types.Step
+	res      types.StepResult
+	err      error
+}
+
+// runSteps starts every step that isn't done and whose dependencies are, in plan order and
+// at most Config.MaxParallel at a time, and records the results in execCtx and done. After
+// the first failure it starts no more steps, cancels the running ones and waits for them.
+// The failed step is returned along with the error when a revised plan could recover from it.
+func (a *PlanExecuteAgent) runSteps(ctx context.Context, plan types.Plan, deps [][]int, execCtx *types.ExecContext, done []bool) (*stepDone, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	parallel := max(a.Config.MaxParallel, 1)
+	started := slices.Clone(done)
+	finished := make(chan stepDone)
+	running := 0
+
+	var (
+		failure error
+		failed  *stepDone
+	)
+	for {
+		for i := 0; failure == nil && running < parallel && i < len(plan.Steps); i++ {
+			if started[i] || !allDone(deps[i], done) {
+				continue
+			}
+
+			rendered, err := a.renderStep(i, plan.Steps[i], *execCtx)
+			if err != nil {
+				failure = err
+				cancel()
+				break
+			}
+
+			started[i] = true
+			running++
+			go func(i int, rendered types.Step) {
+				res, err := a.runWithRetries(ctx, i, len(plan.Steps), rendered)
+				finished <- stepDone{index: i, rendered: rendered, res: res, err: err}
+			}(i, rendered)
+		}
+
+		if running == 0 {
+			return failed, failure
+		}
+
+		d := <-finished
+		running--
+
+		if failure != nil && (d.err != nil || d.res.Outcome == types.OutcomeError) {
+			// a step that was cancelled after another one failed
+			if strings.TrimSpace(d.res.Transcript) != "" {
+				a.AddTranscript(d.res.Transcript)
+			}
+			continue
+		}
+
+		res, err := a.finishStep(d, len(plan.Steps))
+		if err != nil {
+			failure = err
+			if !isStop(d.err) {
+				failed = &d
+			}
+			cancel()
+			continue
+		}
+
+		// steps that still finished after a failure are kept for a revised plan
+		res.Step = d.rendered
+		done[d.index] = true
+		execCtx.Results[d.index] = res
+		if id := plan.Steps[d.index].ID; id != "" {
+			execCtx.ByID[id] = res
+		}
+	}
+}
+
+// runWithRetries runs a step once more for each of its retries while it fails. Budget and
+// policy stops aren't retried.
+func (a *PlanExecuteAgent) runWithRetries(ctx context.Context, i, n int, step types.Step) (types.StepResult, error) {
+	for attempt := 1; ; attempt++ {
+		res, err := a.Runner.RunStep(ctx, a.Config, step)
+		failed := err != nil || res.Outcome == types.OutcomeError
+		if !failed || isStop(err) || attempt > step.Retries || ctx.Err() != nil {
+			return res, err
+		}
+
+		a.Out.Warnf("Step %d failed, retrying (%d/%d): %s", i+1, attempt, step.Retries, step.Description)
+		a.Debug.Debugf("retry step=%d attempt=%d err=%v transcript=%q", i+1, attempt, err, res.Transcript)
+		if strings.TrimSpace(res.Transcript) != "" {
+			a.AddTranscript(res.Transcript)
+		}
+		a.AddTranscript(fmt.Sprintf("[step %d/%d][retry %d/%d] %s\n", i+1, n, attempt, step.Retries, step.Description))
+	}
+}
+
+func isStop(err error) bool {
+	var be core.BudgetExceededError
+	var pe core.PolicyDeniedError
+	return errors.As(err, &be) || errors.As(err, &pe)
+}
+
+// shouldReplan says whether the plan is revised after the step failed.
+func (a *PlanExecuteAgent) shouldReplan(step types.Step, replans int) bool {
+	if step.OnError == types.OnErrorAbort || a.Config.MaxReplans <= 0 {
+		return false
 	}
+	if replans >= a.Config.MaxReplans {
+		a.Out.Warnf("No replans left (max_replans=%d)", a.Config.MaxReplans)
+		a.AddTranscript(fmt.Sprintf("[replan] none left (max_replans=%d)\n", a.Config.MaxReplans))
+		return false
+	}
+	return true
+}
+
+type revisedRun struct {
+	plan    types.Plan
+	deps    [][]int
+	execCtx types.ExecContext
+	done    []bool
+}
 
+// replan asks the planner to revise the plan after failed and sets up the revised plan, in
+// which the completed steps come first and are done.
+func (a *PlanExecuteAgent) replan(ctx context.Context, plan types.Plan, execCtx types.ExecContext, done []bool, failed stepDone, replans int) (revisedRun, error) {
+	out := a.Out
+	dbg := a.Debug
+
+	req := ReplanRequest{Goal: execCtx.Goal, Plan: plan, Err: failed.err}
+	req.Failed = failed.res
+	req.Failed.Step = failed.rendered
 	for i, s := range plan.Steps {
+		switch {
+		case done[i]:
+			req.Completed = append(req.Completed, execCtx.Results[i])
+		case i != failed.index:
+			req.Pending = append(req.Pending, s)
+		}
+	}
+
+	out.Infof("Replanning (%d/%d) after: %s", replans+1, a.Config.MaxReplans, failed.rendered.Description)
+	a.AddTranscript(fmt.Sprintf("[replan %d/%d] failed=%q completed=%d\n", replans+1, a.Config.MaxReplans, failed.rendered.Description, len(req.Completed)))
+
+	k := len(req.Completed)
+
+	revised, err := a.Planner.Replan(ctx, req)
+	if err == nil && len(revised.Steps) <= k {
+		err = errors.New("the revised plan has no steps to run")
+	}
+	var deps [][]int
+	if err == nil {
+		deps, err = stepDependencies(revised.Steps, k)
+	}
+	if err != nil {
+		out.Errorf("Replanning failed: %v", err)
+		dbg.Errorf("replan failed: %v", err)
+		a.AddTranscript(fmt.Sprintf("[replan:error] %v\n", err))
+		return revisedRun{}, err
+	}
+
+	run := revisedRun{
+		plan: revised,
+		deps: deps,
+		execCtx: types.ExecContext{
+			Goal:    execCtx.Goal,
+			Plan:    revised,
+			Results: make([]types.StepResult, len(revised.Steps)),
+			ByID:    map[string]types.StepResult{},
+		},
+		done: make([]bool, len(revised.Steps)),
+	}
+	for i, res := range req.Completed {
+		run.execCtx.Results[i] = res
+		if res.Step.ID != "" {
+			run.execCtx.ByID[res.Step.ID] = res
+		}
+		run.done[i] = true
+	}
+
+	dbg.Debugf("revised plan steps=%d completed=%d", len(revised.Steps), k)
+	a.describeSteps(revised, k)
+	return run, nil
+}
+
+// describeSteps logs the steps of plan from from on.
+func (a *PlanExecuteAgent) describeSteps(plan types.Plan, from int) {
+	out := a.Out
+	n := len(plan.Steps)
+
+	for i := from; i < n; i++ {
+		s := plan.Steps[i]
+		line := fmt.Sprintf("[plan-step %d/%d] type=%s desc=%q", i+1, n, s.Type, s.Description)
+		if s.ID != "" {
+			line += fmt.Sprintf(" id=%q", s.ID)
+		}
+		if len(s.DependsOn) > 0 {
+			line += fmt.Sprintf(" depends_on=%v", s.DependsOn)
+		}
+		a.AddTranscript(line + "\n")
+	}
+
+	for i := from; i < n; i++ {
+		s := plan.Steps[i]
 		switch s.Type {
 		case types.ToolShell:
-			out.Infof("Step %d/%d: %s (shell %s %v)", i+1, len(plan.Steps), s.Description, s.Command, s.Args)
+			out.Infof("Step %d/%d: %s (shell %s %v)", i+1, n, s.Description, s.Command, s.Args)
 		case types.ToolLLM:
-			out.Infof("Step %d/%d: %s (llm prompt_len=%d)", i+1, len(plan.Steps), s.Description, len(s.Prompt))
+			out.Infof("Step %d/%d: %s (llm prompt_len=%d)", i+1, n, s.Description, len(s.Prompt))
 		case types.ToolFiles:
-			out.Infof("Step %d/%d: %s (file op=%q path=%q)", i+1, len(plan.Steps), s.Description, s.Op, s.Path)
+			out.Infof("Step %d/%d: %s (file op=%q path=%q)", i+1, n, s.Description, s.Op, s.Path)
+		case types.ToolHTTP:
+			out.Infof("Step %d/%d: %s (http %s %s)", i+1, n, s.Description, core.HTTPMethod(s), s.URL)
 		default:
-			out.Infof("Step %d/%d: %s (type=%q)", i+1, len(plan.Steps), s.Description, s.Type)
+			out.Infof("Step %d/%d: %s (type=%q)", i+1, n, s.Description, s.Type)
 		}
 	}
 	out.Info("")
+}
 
-	var final string
-	for i, step := range plan.Steps {
-		rendered, err := ApplyTemplate(step, execCtx)
-		if err != nil {
-			out.Errorf("Template render failed (step %d): %s: %v", i+1, step.Description, err)
-			dbg.Errorf("template render failed step=%d desc=%q err=%v", i+1, step.Description, err)
-			a.AddTranscript(fmt.Sprintf("[template:error][step %d] %v\n", i+1, err))
-			return "", err
-		}
+func (a *PlanExecuteAgent) renderStep(i int, step types.Step, execCtx types.ExecContext) (types.Step, error) {
+	n := len(execCtx.Plan.Steps)
 
-		dbg.Debugf("rendered step %d/%d: %+v", i+1, len(plan.Steps), rendered)
-		a.AddTranscript(fmt.Sprintf("[step %d/%d][start] %s\n", i+1, len(plan.Steps), rendered.Description))
+	rendered, err := ApplyTemplate(step, execCtx)
+	if err != nil {
+		a.Out.Errorf("Template render failed (step %d): %s: %v", i+1, step.Description, err)
+		a.Debug.Errorf("template render failed step=%d desc=%q err=%v", i+1, step.Description, err)
+		a.AddTranscript(fmt.Sprintf("[template:error][step %d] %v\n", i+1, err))
+		return types.Step{}, err
+	}
 
-		res, err := a.Runner.RunStep(ctx, a.Config, rendered)
-		if err != nil {
-			if core.IsBudgetStop(err, out) || core.IsPolicyStop(err, out) {
-				dbg.Errorf("stop error step=%d desc=%q err=%v", i+1, rendered.Description, err)
-				if strings.TrimSpace(res.Transcript) != "" {
-					a.AddTranscript(res.Transcript)
-				}
-				return "", err
-			}
+	a.Debug.Debugf("rendered step %d/%d: %+v", i+1, n, rendered)
+	a.AddTranscript(fmt.Sprintf("[step %d/%d][start] %s\n", i+1, n, rendered.Description))
+	return rendered, nil
+}
 
-			out.Errorf("Step failed: %s: %v", rendered.Description, err)
-			dbg.Errorf("step failed step=%d desc=%q err=%v transcript=%q", i+1, rendered.Description, err, res.Transcript)
+// finishStep logs a finished step and returns the result to record, or the error that ends
+// the run. Failed steps whose OnError is continue are recorded with an error outcome.
+func (a *PlanExecuteAgent) finishStep(d stepDone, n int) (types.StepResult, error) {
+	out := a.Out
+	dbg := a.Debug
+	i, rendered, res := d.index, d.rendered, d.res
+
+	if d.err != nil {
+		if core.IsBudgetStop(d.err, out) || core.IsPolicyStop(d.err, out) {
+			dbg.Errorf("stop error step=%d desc=%q err=%v", i+1, rendered.Description, d.err)
 			if strings.TrimSpace(res.Transcript) != "" {
 				a.AddTranscript(res.Transcript)
 			}
-			return "", err
+			return res, d.err
 		}
 
-		out.Infof("Step %d finished in %s (outcome=%s)", i+1, res.Duration, res.Outcome)
-
+		out.Errorf("Step failed: %s: %v", rendered.Description, d.err)
+		dbg.Errorf("step failed step=%d desc=%q err=%v transcript=%q", i+1, rendered.Description, d.err, res.Transcript)
 		if strings.TrimSpace(res.Transcript) != "" {
 			a.AddTranscript(res.Transcript)
-			dbg.Debugf("step %d transcript:\n%s", i+1, res.Transcript)
 		}
-
-		if res.Outcome == types.OutcomeError {
-			if res.Transcript != "" {
-				out.Errorf("Step failed: %s\n%s", rendered.Description, res.Transcript)
+		if rendered.OnError == types.OnErrorContinue {
+			res.Outcome = types.OutcomeError
+			if res.Output == "" {
+				res.Output = d.err.Error()
 			}
-			dbg.Errorf("step outcome error step=%d desc=%q", i+1, rendered.Description)
-			a.AddTranscript(fmt.Sprintf("[step %d/%d][outcome=error] %s\n", i+1, len(plan.Steps), rendered.Description))
-			return "", fmt.Errorf("step failed: %s", rendered.Description)
+			a.continueAfter(i, n, rendered)
+			return res, nil
 		}
+		return res, d.err
+	}
 
-		if res.Output != "" {
-			final = res.Output
-		}
+	out.Infof("Step %d finished in %s (outcome=%s)", i+1, res.Duration, res.Outcome)
 
-		execCtx.Results = append(execCtx.Results, res)
-		a.AddTranscript(fmt.Sprintf("[step %d/%d][outcome=%s] duration=%s\n", i+1, len(plan.Steps), res.Outcome, res.Duration))
+	if strings.TrimSpace(res.Transcript) != "" {
+		a.AddTranscript(res.Transcript)
+		dbg.Debugf("step %d transcript:\n%s", i+1, res.Transcript)
 	}
 
-	result := strings.TrimRightFunc(final, unicode.IsSpace)
-	out.Infof("\nResult: %s\n", result)
-	dbg.Debugf("final (trimmed): %q", result)
+	if res.Outcome == types.OutcomeError {
+		if res.Transcript != "" {
+			out.Errorf("Step failed: %s\n%s", rendered.Description, res.Transcript)
+		}
+		dbg.Errorf("step outcome error step=%d desc=%q", i+1, rendered.Description)
+		a.AddTranscript(fmt.Sprintf("[step %d/%d][outcome=error] %s\n", i+1, n, rendered.Description))
+		if rendered.OnError == types.OnErrorContinue {
+			a.continueAfter(i, n, rendered)
+			return res, nil
+		}
+		return res, fmt.Errorf("step failed: %s", rendered.Description)
+	}
 
-	a.AddTranscript(fmt.Sprintf("[final]\n%s\n", result))
-	return result, nil
+	a.AddTranscript(fmt.Sprintf("[step %d/%d][outcome=%s] duration=%s\n", i+1, n, res.Outcome, res.Duration))
+	return res, nil
+}
+
+func (a *PlanExecuteAgent) continueAfter(i, n int, step types.Step) {
+	a.Out.Warnf("Continuing after failed step %d: %s", i+1, step.Description)
+	a.AddTranscript(fmt.Sprintf("[step %d/%d][on_error=continue] %s\n", i+1, n, step.Description))
+}
+
+func allDone(deps []int, done []bool) bool {
+	for _, j := range deps {
+		if !done[j] {
+			return false
+		}
+	}
+	return true
 }
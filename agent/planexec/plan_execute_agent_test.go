@@ -7,6 +7,8 @@ import (
 	"github.com/kardolus/chatgpt-cli/agent/planexec"
 	"github.com/kardolus/chatgpt-cli/agent/types"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -645,6 +647,244 @@ func testPlanExecuteAgent(t *testing.T, when spec.G, it spec.S) {
 			// And should include your truncation banner (whatever you used in transcript_buffer)
 			Expect(ts).To(ContainSubstring("…(truncated)"))
 		})
+
+		when("steps declare depends_on", func() {
+			plan := types.Plan{
+				Goal: goal,
+				Steps: []types.Step{
+					{ID: "lint", DependsOn: []string{}, Type: types.ToolShell, Description: "lint", Command: "go", Args: []string{"vet"}},
+					{ID: "test", DependsOn: []string{}, Type: types.ToolShell, Description: "test", Command: "go", Args: []string{"test"}},
+					{ID: "report", DependsOn: []string{"lint", "test"}, Type: types.ToolLLM, Description: "report",
+						Prompt: "{{ .ByID.lint.Output }} and {{ .ByID.test.Output }}"},
+				},
+			}
+
+			it("runs independent steps concurrently and renders results by id", func() {
+				mockPlanner.EXPECT().Plan(gomock.Any(), goal).Return(plan, nil)
+
+				// lint and test only finish once both have started
+				var started sync.WaitGroup
+				started.Add(2)
+				shell := func(_ context.Context, _ types.Config, s types.Step) (types.StepResult, error) {
+					started.Done()
+					started.Wait()
+					return types.StepResult{Step: s, Outcome: types.OutcomeOK, Output: s.ID + " ok"}, nil
+				}
+				mockRunner.EXPECT().RunStep(gomock.Any(), gomock.Any(), plan.Steps[0]).DoAndReturn(shell)
+				mockRunner.EXPECT().RunStep(gomock.Any(), gomock.Any(), plan.Steps[1]).DoAndReturn(shell)
+				mockRunner.EXPECT().
+					RunStep(gomock.Any(), gomock.Any(), gomock.Any()).
+					DoAndReturn(func(_ context.Context, _ types.Config, s types.Step) (types.StepResult, error) {
+						Expect(s.Prompt).To(Equal("lint ok and test ok"))
+						return types.StepResult{Step: s, Outcome: types.OutcomeOK, Output: "all good"}, nil
+					})
+
+				subject := planexec.NewPlanExecuteAgent(mockClock, mockPlanner, mockRunner, core.WithMaxParallel(2))
+
+				res, err := subject.RunAgentGoal(context.Background(), goal)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(res).To(Equal("all good"))
+				Expect(subject.TranscriptString()).To(ContainSubstring(`id="report" depends_on=[lint test]`))
+			})
+
+			it("runs one step at a time without parallelism", func() {
+				mockPlanner.EXPECT().Plan(gomock.Any(), goal).Return(plan, nil)
+
+				var running, peak int32
+				mockRunner.EXPECT().
+					RunStep(gomock.Any(), gomock.Any(), gomock.Any()).
+					DoAndReturn(func(_ context.Context, _ types.Config, s types.Step) (types.StepResult, error) {
+						n := atomic.AddInt32(&running, 1)
+						defer atomic.AddInt32(&running, -1)
+						if n > atomic.LoadInt32(&peak) {
+							atomic.StoreInt32(&peak, n)
+						}
+						time.Sleep(time.Millisecond)
+						return types.StepResult{Step: s, Outcome: types.OutcomeOK, Output: s.ID}, nil
+					}).
+					Times(3)
+
+				subject := planexec.NewPlanExecuteAgent(mockClock, mockPlanner, mockRunner)
+
+				_, err := subject.RunAgentGoal(context.Background(), goal)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(atomic.LoadInt32(&peak)).To(Equal(int32(1)))
+			})
+
+			it("cancels running steps and starts no dependents after a failure", func() {
+				mockPlanner.EXPECT().Plan(gomock.Any(), goal).Return(plan, nil)
+
+				mockRunner.EXPECT().
+					RunStep(gomock.Any(), gomock.Any(), plan.Steps[0]).
+					Return(types.StepResult{Step: plan.Steps[0], Outcome: types.OutcomeError, Transcript: "vet failed"}, nil)
+				mockRunner.EXPECT().
+					RunStep(gomock.Any(), gomock.Any(), plan.Steps[1]).
+					DoAndReturn(func(ctx context.Context, _ types.Config, s types.Step) (types.StepResult, error) {
+						<-ctx.Done()
+						return types.StepResult{Step: s}, ctx.Err()
+					})
+				mockRunner.EXPECT().RunStep(gomock.Any(), gomock.Any(), plan.Steps[2]).Times(0)
+
+				subject := planexec.NewPlanExecuteAgent(mockClock, mockPlanner, mockRunner, core.WithMaxParallel(4))
+
+				_, err := subject.RunAgentGoal(context.Background(), goal)
+				Expect(err).To(MatchError("step failed: lint"))
+			})
+
+			it("rejects plans whose steps depend on each other", func() {
+				cyclic := types.Plan{
+					Goal: goal,
+					Steps: []types.Step{
+						{ID: "a", DependsOn: []string{"b"}, Type: types.ToolLLM, Description: "a", Prompt: "a"},
+						{ID: "b", DependsOn: []string{"a"}, Type: types.ToolLLM, Description: "b", Prompt: "b"},
+					},
+				}
+				mockPlanner.EXPECT().Plan(gomock.Any(), goal).Return(cyclic, nil)
+				mockRunner.EXPECT().RunStep(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+
+				subject := planexec.NewPlanExecuteAgent(mockClock, mockPlanner, mockRunner)
+
+				_, err := subject.RunAgentGoal(context.Background(), goal)
+				Expect(err).To(MatchError("steps depend on each other: a -> b -> a"))
+			})
+		})
+
+		when("a step fails", func() {
+			ok := func(_ context.Context, _ types.Config, s types.Step) (types.StepResult, error) {
+				return types.StepResult{Step: s, Outcome: types.OutcomeOK, Output: s.Description + " ok"}, nil
+			}
+			fail := types.StepResult{Outcome: types.OutcomeError, Transcript: "exit 1"}
+
+			it("retries it", func() {
+				plan := types.Plan{Goal: goal, Steps: []types.Step{
+					{Type: types.ToolShell, Description: "flaky", Command: "curl", Retries: 2},
+				}}
+				mockPlanner.EXPECT().Plan(gomock.Any(), goal).Return(plan, nil)
+				gomock.InOrder(
+					mockRunner.EXPECT().RunStep(gomock.Any(), gomock.Any(), plan.Steps[0]).Return(fail, nil),
+					mockRunner.EXPECT().RunStep(gomock.Any(), gomock.Any(), plan.Steps[0]).DoAndReturn(ok),
+				)
+
+				subject := planexec.NewPlanExecuteAgent(mockClock, mockPlanner, mockRunner)
+
+				res, err := subject.RunAgentGoal(context.Background(), goal)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(res).To(Equal("flaky ok"))
+				Expect(subject.TranscriptString()).To(ContainSubstring("[step 1/1][retry 1/2] flaky"))
+			})
+
+			it("does not retry budget stops", func() {
+				plan := types.Plan{Goal: goal, Steps: []types.Step{
+					{Type: types.ToolShell, Description: "one", Command: "ls", Retries: 3},
+				}}
+				stop := core.BudgetExceededError{Kind: core.BudgetKindSteps, Limit: 1, Used: 1, Message: "step budget exceeded"}
+				mockPlanner.EXPECT().Plan(gomock.Any(), goal).Return(plan, nil)
+				mockRunner.EXPECT().RunStep(gomock.Any(), gomock.Any(), gomock.Any()).Return(types.StepResult{}, stop).Times(1)
+
+				subject := planexec.NewPlanExecuteAgent(mockClock, mockPlanner, mockRunner, core.WithMaxReplans(2))
+
+				_, err := subject.RunAgentGoal(context.Background(), goal)
+				Expect(err).To(MatchError(stop))
+			})
+
+			it("continues when on_error is continue", func() {
+				plan := types.Plan{Goal: goal, Steps: []types.Step{
+					{ID: "lint", Type: types.ToolShell, Description: "lint", Command: "vet", OnError: types.OnErrorContinue},
+					{Type: types.ToolLLM, Description: "report", Prompt: "{{ .ByID.lint.Outcome }}"},
+				}}
+				mockPlanner.EXPECT().Plan(gomock.Any(), goal).Return(plan, nil)
+				mockRunner.EXPECT().RunStep(gomock.Any(), gomock.Any(), plan.Steps[0]).Return(fail, nil)
+				mockRunner.EXPECT().
+					RunStep(gomock.Any(), gomock.Any(), gomock.Any()).
+					DoAndReturn(func(ctx context.Context, cfg types.Config, s types.Step) (types.StepResult, error) {
+						Expect(s.Prompt).To(Equal("error"))
+						return ok(ctx, cfg, s)
+					})
+
+				subject := planexec.NewPlanExecuteAgent(mockClock, mockPlanner, mockRunner)
+
+				res, err := subject.RunAgentGoal(context.Background(), goal)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(res).To(Equal("report ok"))
+			})
+
+			it("replans the remaining steps and keeps the completed results", func() {
+				plan := types.Plan{Goal: goal, Steps: []types.Step{
+					{ID: "read", Type: types.ToolFiles, Description: "read", Op: "read", Path: "a.txt"},
+					{Type: types.ToolShell, Description: "build", Command: "make"},
+					{Type: types.ToolLLM, Description: "summarize", Prompt: "sum"},
+				}}
+				fixed := types.Step{Type: types.ToolLLM, Description: "explain", Prompt: "why {{ .ByID.read.Output }}"}
+
+				mockPlanner.EXPECT().Plan(gomock.Any(), goal).Return(plan, nil)
+				mockPlanner.EXPECT().
+					Replan(gomock.Any(), gomock.Any()).
+					DoAndReturn(func(_ context.Context, req planexec.ReplanRequest) (types.Plan, error) {
+						Expect(req.Goal).To(Equal(goal))
+						Expect(req.Completed).To(HaveLen(1))
+						Expect(req.Completed[0].Step).To(Equal(plan.Steps[0]))
+						Expect(req.Failed.Step).To(Equal(plan.Steps[1]))
+						Expect(req.Failed.Transcript).To(Equal("exit 1"))
+						Expect(req.Pending).To(Equal(plan.Steps[2:]))
+						return types.Plan{Goal: goal, Steps: []types.Step{req.Completed[0].Step, fixed}}, nil
+					})
+
+				gomock.InOrder(
+					mockRunner.EXPECT().RunStep(gomock.Any(), gomock.Any(), plan.Steps[0]).DoAndReturn(ok),
+					mockRunner.EXPECT().RunStep(gomock.Any(), gomock.Any(), plan.Steps[1]).Return(fail, nil),
+					mockRunner.EXPECT().
+						RunStep(gomock.Any(), gomock.Any(), gomock.Any()).
+						DoAndReturn(func(ctx context.Context, cfg types.Config, s types.Step) (types.StepResult, error) {
+							Expect(s.Prompt).To(Equal("why read ok"))
+							return ok(ctx, cfg, s)
+						}),
+				)
+
+				subject := planexec.NewPlanExecuteAgent(mockClock, mockPlanner, mockRunner, core.WithMaxReplans(1))
+
+				res, err := subject.RunAgentGoal(context.Background(), goal)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(res).To(Equal("explain ok"))
+				Expect(subject.TranscriptString()).To(ContainSubstring(`[replan 1/1] failed="build" completed=1`))
+			})
+
+			it("stops when no replans are left or on_error is abort", func() {
+				plan := types.Plan{Goal: goal, Steps: []types.Step{
+					{Type: types.ToolShell, Description: "build", Command: "make"},
+				}}
+				mockPlanner.EXPECT().Plan(gomock.Any(), goal).Return(plan, nil)
+				mockPlanner.EXPECT().Replan(gomock.Any(), gomock.Any()).Return(plan, nil)
+				mockRunner.EXPECT().RunStep(gomock.Any(), gomock.Any(), plan.Steps[0]).Return(fail, nil).Times(2)
+
+				subject := planexec.NewPlanExecuteAgent(mockClock, mockPlanner, mockRunner, core.WithMaxReplans(1))
+
+				_, err := subject.RunAgentGoal(context.Background(), goal)
+				Expect(err).To(MatchError("step failed: build"))
+				Expect(subject.TranscriptString()).To(ContainSubstring("[replan] none left (max_replans=1)"))
+
+				plan.Steps[0].OnError = types.OnErrorAbort
+				mockPlanner.EXPECT().Plan(gomock.Any(), goal).Return(plan, nil)
+				mockRunner.EXPECT().RunStep(gomock.Any(), gomock.Any(), plan.Steps[0]).Return(fail, nil)
+
+				_, err = subject.RunAgentGoal(context.Background(), goal)
+				Expect(err).To(MatchError("step failed: build"))
+			})
+
+			it("returns the step error when replanning fails", func() {
+				plan := types.Plan{Goal: goal, Steps: []types.Step{
+					{Type: types.ToolShell, Description: "build", Command: "make"},
+				}}
+				mockPlanner.EXPECT().Plan(gomock.Any(), goal).Return(plan, nil)
+				mockPlanner.EXPECT().Replan(gomock.Any(), gomock.Any()).Return(types.Plan{}, fmt.Errorf("planner down"))
+				mockRunner.EXPECT().RunStep(gomock.Any(), gomock.Any(), plan.Steps[0]).Return(fail, nil)
+
+				subject := planexec.NewPlanExecuteAgent(mockClock, mockPlanner, mockRunner, core.WithMaxReplans(3))
+
+				_, err := subject.RunAgentGoal(context.Background(), goal)
+				Expect(err).To(MatchError("step failed: build"))
+				Expect(subject.TranscriptString()).To(ContainSubstring("[replan:error] planner down"))
+			})
+		})
 	})
 }
 
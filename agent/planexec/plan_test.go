@@ -297,6 +297,89 @@ func testDefaultPlanner(t *testing.T, when spec.G, it spec.S) {
 		})
 	})
 
+	when("llm plans the richer file ops", func() {
+		it("carries the line range, pattern, glob, depth and dest", func() {
+			clock.EXPECT().Now().Return(now)
+			budget.EXPECT().AllowTool(types.ToolLLM, now).Return(nil)
+
+			raw := `{
+          "goal": "x",
+          "steps": [
+            { "type": "file", "description": "List", "op": "list", "path": ".", "depth": 2, "glob": "*.go" },
+            { "type": "file", "description": "Find", "op": "search", "path": ".", "pattern": "TODO" },
+            { "type": "file", "description": "Read", "op": "read", "path": "a.go", "start_line": 5, "end_line": 9 },
+            { "type": "file", "description": "Move", "op": "move", "path": "a.go", "dest": " b.go " }
+          ]
+        }`
+
+			llm.EXPECT().Complete(gomock.Any(), gomock.Any()).Return(raw, 7, nil)
+			budget.EXPECT().ChargeLLMTokens(7, now)
+
+			plan, err := planner.Plan(ctx, "x")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(plan.Steps).To(HaveLen(4))
+			Expect(plan.Steps[0].Depth).To(Equal(2))
+			Expect(plan.Steps[0].Glob).To(Equal("*.go"))
+			Expect(plan.Steps[1].Pattern).To(Equal("TODO"))
+			Expect(plan.Steps[2].StartLine).To(Equal(5))
+			Expect(plan.Steps[2].EndLine).To(Equal(9))
+			Expect(plan.Steps[3].Dest).To(Equal("b.go"))
+		})
+
+		it("rejects a move without dest", func() {
+			clock.EXPECT().Now().Return(now)
+			budget.EXPECT().AllowTool(types.ToolLLM, now).Return(nil)
+
+			raw := `{"goal": "x", "steps": [{ "type": "file", "description": "Move", "op": "move", "path": "a.go" }]}`
+			llm.EXPECT().Complete(gomock.Any(), gomock.Any()).Return(raw, 7, nil)
+			budget.EXPECT().ChargeLLMTokens(7, now)
+
+			_, err := planner.Plan(ctx, "x")
+			Expect(err).To(MatchError(ContainSubstring("file move step missing dest")))
+		})
+	})
+
+	when("llm plans an http step", func() {
+		it("carries the method, url, headers and body", func() {
+			clock.EXPECT().Now().Return(now)
+			budget.EXPECT().AllowTool(types.ToolLLM, now).Return(nil)
+
+			raw := `{
+          "goal": "x",
+          "steps": [
+            { "type": "http", "description": "Create", "method": "post", "url": " https://api.example.com/items ",
+              "headers": {"Content-Type": "application/json"}, "body": "{}" }
+          ]
+        }`
+
+			llm.EXPECT().Complete(gomock.Any(), gomock.Any()).Return(raw, 7, nil)
+			budget.EXPECT().ChargeLLMTokens(7, now)
+
+			plan, err := planner.Plan(ctx, "x")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(plan.Steps).To(Equal([]types.Step{{
+				Type:        types.ToolHTTP,
+				Description: "Create",
+				Method:      "POST",
+				URL:         "https://api.example.com/items",
+				Headers:     map[string]string{"Content-Type": "application/json"},
+				Body:        "{}",
+			}}))
+		})
+
+		it("rejects an http step without url", func() {
+			clock.EXPECT().Now().Return(now)
+			budget.EXPECT().AllowTool(types.ToolLLM, now).Return(nil)
+
+			raw := `{"goal": "x", "steps": [{ "type": "http", "description": "Fetch" }]}`
+			llm.EXPECT().Complete(gomock.Any(), gomock.Any()).Return(raw, 7, nil)
+			budget.EXPECT().ChargeLLMTokens(7, now)
+
+			_, err := planner.Plan(ctx, "x")
+			Expect(err).To(MatchError(ContainSubstring("http step missing url")))
+		})
+	})
+
 	when("llm returns fenced non-json", func() {
 		it("still returns parse error", func() {
 			clock.EXPECT().Now().Return(now)
@@ -344,5 +427,160 @@ func testDefaultPlanner(t *testing.T, when spec.G, it spec.S) {
 			Expect(plan.Steps).To(HaveLen(2))
 			Expect(plan.Steps[1].Type).To(Equal(types.ToolLLM))
 		})
+
+		when("steps have ids and depends_on", func() {
+			plan := func(raw string) (types.Plan, error) {
+				clock.EXPECT().Now().Return(now)
+				budget.EXPECT().AllowTool(types.ToolLLM, now).Return(nil)
+				llm.EXPECT().Complete(gomock.Any(), gomock.Any()).Return(raw, 10, nil)
+				budget.EXPECT().ChargeLLMTokens(10, now)
+				return planner.Plan(ctx, "x")
+			}
+
+			it("keeps ids and dependencies", func() {
+				p, err := plan(`{
+				"goal": "x",
+				"steps": [
+					{"id": "lint", "depends_on": [], "type": "shell", "description": "Lint", "command": "go", "args": ["vet"]},
+					{"id": "test", "depends_on": [], "type": "shell", "description": "Test", "command": "go", "args": ["test"]},
+					{"id": "report", "depends_on": ["lint"], "type": "llm", "description": "Report",
+					 "prompt": "{{ .ByID.lint.Output }} {{ .ByID.test.Output }}"}
+				]
+			}`)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(p.Steps[0].ID).To(Equal("lint"))
+				Expect(p.Steps[0].DependsOn).To(BeEmpty())
+				Expect(p.Steps[0].DependsOn).NotTo(BeNil())
+				Expect(p.Steps[2].DependsOn).To(Equal([]string{"lint"}))
+			})
+
+			it("rejects unknown steps", func() {
+				_, err := plan(`{"goal": "x", "steps": [
+				{"id": "a", "depends_on": ["b"], "type": "llm", "description": "A", "prompt": "a"}
+			]}`)
+				Expect(err).To(MatchError(ContainSubstring(`step 0 depends on unknown step "b"`)))
+			})
+
+			it("rejects templates that use unknown ids", func() {
+				_, err := plan(`{"goal": "x", "steps": [
+				{"id": "a", "type": "llm", "description": "A", "prompt": "{{ .ByID.b.Output }}"}
+			]}`)
+				Expect(err).To(MatchError(ContainSubstring(`step 0 uses the result of unknown step "b"`)))
+			})
+
+			it("rejects duplicate and invalid ids", func() {
+				_, err := plan(`{"goal": "x", "steps": [
+				{"id": "a", "type": "llm", "description": "A", "prompt": "a"},
+				{"id": "a", "type": "llm", "description": "B", "prompt": "b"}
+			]}`)
+				Expect(err).To(MatchError(ContainSubstring(`step 1: id "a" is already used by step 0`)))
+
+				_, err = plan(`{"goal": "x", "steps": [
+				{"id": "run-tests", "type": "llm", "description": "A", "prompt": "a"}
+			]}`)
+				Expect(err).To(MatchError(ContainSubstring(`step 0: invalid id "run-tests"`)))
+			})
+
+			it("rejects cycles", func() {
+				_, err := plan(`{"goal": "x", "steps": [
+				{"id": "a", "depends_on": ["c"], "type": "llm", "description": "A", "prompt": "a"},
+				{"id": "b", "depends_on": ["a"], "type": "llm", "description": "B", "prompt": "b"},
+				{"id": "c", "depends_on": [], "type": "llm", "description": "C", "prompt": "{{ .ByID.b.Output }}"}
+			]}`)
+				Expect(err).To(MatchError(ContainSubstring("steps depend on each other: a -> c -> b -> a")))
+			})
+		})
+	})
+
+	when("steps have retries and on_error", func() {
+		it("keeps them and rejects invalid values", func() {
+			clock.EXPECT().Now().Return(now).Times(3)
+			budget.EXPECT().AllowTool(types.ToolLLM, now).Return(nil).Times(3)
+			budget.EXPECT().ChargeLLMTokens(1, now).Times(3)
+			gomock.InOrder(
+				llm.EXPECT().Complete(gomock.Any(), gomock.Any()).Return(`{"goal": "x", "steps": [
+					{"type": "shell", "description": "Lint", "command": "go", "args": ["vet"], "retries": 2, "on_error": "Continue"}
+				]}`, 1, nil),
+				llm.EXPECT().Complete(gomock.Any(), gomock.Any()).Return(`{"goal": "x", "steps": [
+					{"type": "shell", "description": "Lint", "command": "go", "retries": 9}
+				]}`, 1, nil),
+				llm.EXPECT().Complete(gomock.Any(), gomock.Any()).Return(`{"goal": "x", "steps": [
+					{"type": "shell", "description": "Lint", "command": "go", "on_error": "ignore"}
+				]}`, 1, nil),
+			)
+
+			plan, err := planner.Plan(ctx, "x")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(plan.Steps[0].Retries).To(Equal(2))
+			Expect(plan.Steps[0].OnError).To(Equal(types.OnErrorContinue))
+
+			_, err = planner.Plan(ctx, "x")
+			Expect(err).To(MatchError("step 0 retries must be between 0 and 3"))
+
+			_, err = planner.Plan(ctx, "x")
+			Expect(err).To(MatchError(`step 0 has unknown on_error "ignore" (expected continue|abort|replan)`))
+		})
+	})
+
+	when("Replan()", func() {
+		req := planexec.ReplanRequest{
+			Goal: "fix the build",
+			Completed: []types.StepResult{{
+				Step:    types.Step{ID: "read", Type: types.ToolFiles, Description: "Read main", Op: "read", Path: "main.go"},
+				Outcome: types.OutcomeOK,
+				Output:  "package main",
+			}},
+			Failed: types.StepResult{
+				Step:       types.Step{Type: types.ToolShell, Description: "Build", Command: "go", Args: []string{"build"}},
+				Outcome:    types.OutcomeError,
+				Transcript: "main.go:3: undefined: foo",
+			},
+			Pending: []types.Step{{Type: types.ToolLLM, Description: "Summarize", Prompt: "done"}},
+		}
+
+		it("sends the completed results and the failure and keeps the completed steps first", func() {
+			clock.EXPECT().Now().Return(now)
+			budget.EXPECT().AllowTool(types.ToolLLM, now).Return(nil)
+			budget.EXPECT().ChargeLLMTokens(20, now)
+			llm.EXPECT().
+				Complete(gomock.Any(), gomock.Any()).
+				DoAndReturn(func(_ context.Context, prompt string) (string, int, error) {
+					Expect(prompt).To(ContainSubstring("REPLANNING"))
+					Expect(prompt).To(ContainSubstring(`[0] id=read "Read main" (file read: main.go) outcome=ok`))
+					Expect(prompt).To(ContainSubstring("output: package main"))
+					Expect(prompt).To(ContainSubstring("Your steps are numbered from 1"))
+					Expect(prompt).To(ContainSubstring("main.go:3: undefined: foo"))
+					Expect(prompt).To(ContainSubstring(`- "Summarize" (llm: done)`))
+					return `{"goal": "fix the build", "steps": [
+						{"type": "llm", "description": "Fix", "prompt": "fix {{ .ByID.read.Output }}"},
+						{"type": "shell", "description": "Build again", "command": "go", "args": ["build"]}
+					]}`, 20, nil
+				})
+
+			plan, err := planner.Replan(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(plan.Goal).To(Equal("fix the build"))
+			Expect(plan.Steps).To(HaveLen(3))
+			Expect(plan.Steps[0]).To(Equal(req.Completed[0].Step))
+			Expect(plan.Steps[1].Description).To(Equal("Fix"))
+		})
+
+		it("rejects revisions without steps or with references to later results", func() {
+			clock.EXPECT().Now().Return(now).Times(2)
+			budget.EXPECT().AllowTool(types.ToolLLM, now).Return(nil).Times(2)
+			budget.EXPECT().ChargeLLMTokens(1, now).Times(2)
+			gomock.InOrder(
+				llm.EXPECT().Complete(gomock.Any(), gomock.Any()).Return(`{"goal": "x", "steps": []}`, 1, nil),
+				llm.EXPECT().Complete(gomock.Any(), gomock.Any()).Return(`{"goal": "x", "steps": [
+					{"type": "llm", "description": "Fix", "prompt": "{{ (index .Results 1).Output }}"}
+				]}`, 1, nil),
+			)
+
+			_, err := planner.Replan(ctx, req)
+			Expect(err).To(MatchError("planner returned no steps to recover from the failure"))
+
+			_, err = planner.Replan(ctx, req)
+			Expect(err).To(MatchError(ContainSubstring("step 1 prompt: template references .Results[1]")))
+		})
 	})
 }
@@ -9,6 +9,7 @@ import (
 	reflect "reflect"
 
 	gomock "github.com/golang/mock/gomock"
+	planexec "github.com/kardolus/chatgpt-cli/agent/planexec"
 	types "github.com/kardolus/chatgpt-cli/agent/types"
 )
 
@@ -49,3 +50,18 @@ func (mr *MockPlannerMockRecorder) Plan(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Plan", reflect.TypeOf((*MockPlanner)(nil).Plan), arg0, arg1)
 }
+
+// Replan mocks base method.
+func (m *MockPlanner) Replan(arg0 context.Context, arg1 planexec.ReplanRequest) (types.Plan, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Replan", arg0, arg1)
+	ret0, _ := ret[0].(types.Plan)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Replan indicates an expected call of Replan.
+func (mr *MockPlannerMockRecorder) Replan(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Replan", reflect.TypeOf((*MockPlanner)(nil).Replan), arg0, arg1)
+}
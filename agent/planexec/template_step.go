@@ -49,6 +49,34 @@ func ApplyTemplate(step types.Step, ctx types.ExecContext) (types.Step, error) {
 		if err != nil {
 			return types.Step{}, fmt.Errorf("render Data: %w", err)
 		}
+		step.Pattern, err = renderMaybe(step.Pattern, ctx)
+		if err != nil {
+			return types.Step{}, fmt.Errorf("render Pattern: %w", err)
+		}
+		step.Dest, err = renderMaybe(step.Dest, ctx)
+		if err != nil {
+			return types.Step{}, fmt.Errorf("render Dest: %w", err)
+		}
+
+	case types.ToolHTTP:
+		step.URL, err = renderMaybe(step.URL, ctx)
+		if err != nil {
+			return types.Step{}, fmt.Errorf("render URL: %w", err)
+		}
+		step.Body, err = renderMaybe(step.Body, ctx)
+		if err != nil {
+			return types.Step{}, fmt.Errorf("render Body: %w", err)
+		}
+		if len(step.Headers) > 0 {
+			headers := make(map[string]string, len(step.Headers))
+			for k, v := range step.Headers {
+				headers[k], err = renderMaybe(v, ctx)
+				if err != nil {
+					return types.Step{}, fmt.Errorf("render Headers[%s]: %w", k, err)
+				}
+			}
+			step.Headers = headers
+		}
 	}
 
 	return step, nil
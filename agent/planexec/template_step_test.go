@@ -97,6 +97,25 @@ func testTemplateStep(t *testing.T, when spec.G, it spec.S) {
 			Expect(out.Data).To(Equal("payload=x"))
 		})
 
+		it("renders http URL/Body/Headers without changing the original headers", func() {
+			headers := map[string]string{"Authorization": "Bearer {{.Goal}}"}
+			step := types.Step{
+				Type:        types.ToolHTTP,
+				Description: "fetch",
+				URL:         "https://example.com/{{.Goal}}",
+				Body:        `{"q":"{{.Goal}}"}`,
+				Headers:     headers,
+			}
+
+			out, err := planexec.ApplyTemplate(step, types.ExecContext{Goal: "x"})
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(out.URL).To(Equal("https://example.com/x"))
+			Expect(out.Body).To(Equal(`{"q":"x"}`))
+			Expect(out.Headers).To(Equal(map[string]string{"Authorization": "Bearer x"}))
+			Expect(headers["Authorization"]).To(Equal("Bearer {{.Goal}}"))
+		})
+
 		it("errors when a referenced key is missing (missingkey=error)", func() {
 			step := types.Step{
 				Type:        types.ToolLLM,
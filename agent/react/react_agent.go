@@ -38,19 +38,33 @@ func NewReActAgent(llm tools.LLM, runner core.Runner, budget core.Budget, clock
 }
 
 type reActAction struct {
-	Thought     string   `json:"thought"`
-	ActionType  string   `json:"action_type"` // "tool" or "answer"
-	Tool        string   `json:"tool,omitempty"`
-	Command     string   `json:"command,omitempty"`
-	Args        []string `json:"args,omitempty"`
-	Prompt      string   `json:"prompt,omitempty"`
-	Op          string   `json:"op,omitempty"`
-	Path        string   `json:"path,omitempty"`
-	Data        string   `json:"data,omitempty"`
-	Old         string   `json:"old,omitempty"`
-	New         string   `json:"new,omitempty"`
-	N           int      `json:"n,omitempty"`
-	FinalAnswer string   `json:"final_answer,omitempty"`
+	Thought     string            `json:"thought"`
+	ActionType  string            `json:"action_type"` // "tool" or "answer"
+	Tool        string            `json:"tool,omitempty"`
+	Command     string            `json:"command,omitempty"`
+	Args        []string          `json:"args,omitempty"`
+	Prompt      string            `json:"prompt,omitempty"`
+	Op          string            `json:"op,omitempty"`
+	Path        string            `json:"path,omitempty"`
+	Data        string            `json:"data,omitempty"`
+	Old         string            `json:"old,omitempty"`
+	New         string            `json:"new,omitempty"`
+	N           int               `json:"n,omitempty"`
+	StartLine   int               `json:"start_line,omitempty"`
+	EndLine     int               `json:"end_line,omitempty"`
+	Pattern     string            `json:"pattern,omitempty"`
+	Glob        string            `json:"glob,omitempty"`
+	Depth       int               `json:"depth,omitempty"`
+	Dest        string            `json:"dest,omitempty"`
+	Method      string            `json:"method,omitempty"`
+	URL         string            `json:"url,omitempty"`
+	Headers     map[string]string `json:"headers,omitempty"`
+	Body        string            `json:"body,omitempty"`
+	Fact        string            `json:"fact,omitempty"`
+	Goal        string            `json:"goal,omitempty"`
+	Mode        string            `json:"mode,omitempty"`
+	Tools       []string          `json:"tools,omitempty"`
+	FinalAnswer string            `json:"final_answer,omitempty"`
 }
 
 func (a *ReActAgent) RunAgentGoal(ctx context.Context, goal string) (string, error) {
@@ -77,9 +91,17 @@ func (a *ReActAgent) RunAgentGoal(ctx context.Context, goal string) (string, err
 		a.Transcript.Reset()
 	}
 
+	if len(a.PriorRuns) > 0 {
+		a.AddHistory(formatPriorRuns(a.PriorRuns))
+		a.AddTranscriptf("[session] prior_runs=%d\n", len(a.PriorRuns))
+	}
+
 	a.AddHistory(fmt.Sprintf("USER: %s", goal))
 	a.AddTranscript(fmt.Sprintf("[goal]\n%s\n", goal))
 
+	memory := a.memoryPrompt()
+	delegate := a.delegatePrompt(memory)
+
 	for i := 0; ; i++ {
 		now := a.Clock.Now()
 
@@ -103,7 +125,7 @@ func (a *ReActAgent) RunAgentGoal(ctx context.Context, goal string) (string, err
 			return "", err
 		}
 
-		prompt := buildReActPromptFromHistory(a.History(), a.promptStateLine())
+		prompt := buildReActPromptFromHistory(a.History(), a.promptStateLine(), memory, delegate)
 		dbg.Debugf("react iteration %d prompt_len=%d", i+1, len(prompt))
 
 		a.AddTranscriptf("[iteration %d][prompt]\n%s\n", i+1, prompt)
@@ -274,15 +296,118 @@ func (a *ReActAgent) RunAgentGoal(ctx context.Context, goal string) (string, err
 	}
 }
 
-func buildReActPromptFromHistory(history string, stateLine string) string {
+const (
+	maxPriorRuns        = 5
+	maxPriorGoalBytes   = 500
+	maxPriorAnswerBytes = 1000
+)
+
+// formatPriorRuns compacts the earlier runs of the conversation into the history, so a
+// follow-up like "now add tests for that" knows what "that" is. Only the latest
+// maxPriorRuns are kept.
+func formatPriorRuns(runs []types.PriorRun) string {
+	skipped := 0
+	if len(runs) > maxPriorRuns {
+		skipped = len(runs) - maxPriorRuns
+		runs = runs[skipped:]
+	}
+
+	var b strings.Builder
+	b.WriteString("EARLIER RUNS (same conversation, oldest first; their effects are already done):\n")
+	if skipped > 0 {
+		_, _ = fmt.Fprintf(&b, "(%d older runs omitted)\n", skipped)
+	}
+	for i, r := range runs {
+		_, _ = fmt.Fprintf(&b, "RUN %d USER: %s\n", i+1, truncateForDisplay(r.Goal, maxPriorGoalBytes))
+		_, _ = fmt.Fprintf(&b, "RUN %d ANSWER: %s\n", i+1, truncateForDisplay(r.Answer, maxPriorAnswerBytes))
+		if len(r.Effects) == 0 {
+			_, _ = fmt.Fprintf(&b, "RUN %d SIDE_EFFECTS: none\n", i+1)
+			continue
+		}
+		_, _ = fmt.Fprintf(&b, "RUN %d SIDE_EFFECTS:\n", i+1)
+		for _, e := range r.Effects {
+			_, _ = fmt.Fprintf(&b, "- %s\n", e)
+		}
+	}
+	return strings.TrimRightFunc(b.String(), unicode.IsSpace)
+}
+
+func buildReActPromptFromHistory(history string, stateLine string, memory reActMemory, delegate string) string {
 	history = strings.TrimSpace(history)
 	if history == "" {
-		return buildReActPrompt(nil, stateLine)
+		return buildReActPrompt(nil, stateLine, memory, delegate)
 	}
-	return buildReActPrompt([]string{history}, stateLine)
+	return buildReActPrompt([]string{history}, stateLine, memory, delegate)
+}
+
+// reActMemory is the project memory part of the prompt; both fields are empty when the
+// memory is disabled.
+type reActMemory struct {
+	tool  string
+	facts string
 }
 
-func buildReActPrompt(conversation []string, stateLine string) string {
+// memoryPrompt loads the facts remembered in earlier runs. A memory that can't be read is
+// skipped rather than failing the run.
+func (a *ReActAgent) memoryPrompt() reActMemory {
+	if a.Memory == nil {
+		return reActMemory{}
+	}
+
+	facts, err := a.Memory.Facts()
+	if err != nil {
+		a.Out.Warnf("Skipping project memory: %v", err)
+		facts = nil
+	}
+	a.Debug.Debugf("project memory facts=%d", len(facts))
+	a.AddTranscriptf("[memory] facts=%d\n", len(facts))
+
+	m := reActMemory{tool: fmt.Sprintf(`
+5. %s - Remember a fact about this project for future runs
+   Fields: "fact" (string, one short sentence)
+   - remember durable facts you had to find out, e.g. how to build or test the project, where code lives, conventions
+   - do NOT remember secrets, the user's goal, or anything that only matters for this task
+   - only remember facts you verified with an observation
+`, types.ToolMemory)}
+
+	if len(facts) == 0 {
+		m.facts = "Project memory: empty, nothing was remembered yet.\n\n"
+		return m
+	}
+
+	var b strings.Builder
+	b.WriteString("Project memory (facts remembered in earlier runs; trust them unless an observation contradicts them):\n")
+	for _, f := range facts {
+		_, _ = fmt.Fprintf(&b, "- %s\n", f)
+	}
+	b.WriteString("\n")
+	m.facts = b.String()
+	return m
+}
+
+// delegatePrompt documents the delegate tool, numbered after the memory tool; it is empty
+// when the agent may not delegate.
+func (a *ReActAgent) delegatePrompt(memory reActMemory) string {
+	if !a.Delegation {
+		return ""
+	}
+
+	n := 5
+	if memory.tool != "" {
+		n = 6
+	}
+	return fmt.Sprintf(`
+%d. %s - Hand a self-contained sub-task to a sub-agent with a fresh context
+   Fields: "goal" (string), "mode" (OPTIONAL "react" or "plan"), "tools" (OPTIONAL array, e.g. ["file", "shell"])
+   - use it for big, separable parts of the goal, e.g. "write tests for the parser package", to keep your own context small
+   - the sub-agent does NOT see this conversation: the goal must say everything it needs to know
+   - only its final answer and side effects come back to you
+   - "tools" narrows what it may use; it never gets more than you have
+   - it spends your budget, so do simple steps yourself
+`, n, types.ToolDelegate)
+}
+
+func buildReActPrompt(conversation []string, stateLine string, memory reActMemory, delegate string) string {
 	history := strings.Join(conversation, "\n\n")
 	stateLine = strings.TrimSpace(stateLine)
 
@@ -296,13 +421,37 @@ You have access to these tools:
 2. llm - Request reasoning or summarization
    Fields: "prompt" (string)
 
-3. file - Read or modify files
+3. file - Find, read or modify files
    Fields:
-   - "op": "read" | "write" | "patch" | "replace"
+   - "op": "read" | "write" | "patch" | "replace" | "list" | "search" | "stat" | "mkdir" | "move" | "delete"
    - "path": string
 
    For op="read":
-   - returns ENTIRE file contents as text
+   - returns the file contents as text, the ENTIRE file unless a range is given
+   - "start_line", "end_line": int OPTIONAL (1-based, inclusive; 0 = start/end of file)
+
+   For op="list":
+   - lists the entries of the directory "path" (directories end with "/")
+   - "depth": int OPTIONAL (levels to descend, default 1)
+   - "glob": string OPTIONAL (only names matching it, e.g. "*.go")
+
+   For op="search":
+   - "pattern": string REQUIRED (regular expression)
+   - "glob": string OPTIONAL (only files whose name matches it)
+   - searches the file "path" or every file under the directory "path"
+   - returns matching lines as "path:line: text"
+
+   For op="stat":
+   - returns the type, size, mode and modification time of "path"
+
+   For op="mkdir":
+   - creates the directory "path" and its parents
+
+   For op="move":
+   - "dest": string REQUIRED; moves "path" to "dest" (never overwrites)
+
+   For op="delete":
+   - deletes the file or EMPTY directory "path"
 
    For op="write":
    - "data": string REQUIRED
@@ -319,8 +468,20 @@ You have access to these tools:
      - n <= 0 means replace all occurrences
      - n > 0 means replace first n occurrences
 
+4. http - Fetch a web page or call an HTTP API
+   Fields:
+   - "url": string REQUIRED (http or https)
+   - "method": string OPTIONAL (default "GET")
+   - "headers": object OPTIONAL
+   - "body": string OPTIONAL
+   - HTML pages are returned as readable text; long responses are truncated
+   - only allowed domains can be reached; redirects are reported, not followed
+   - use it instead of curl or wget
+%s%s
 IMPORTANT FILE SEMANTICS:
-- file op="read" returns the ENTIRE file contents as text.
+- file op="read" returns the ENTIRE file contents as text unless "start_line"/"end_line" narrow it.
+- Prefer op="list" and op="search" over shell commands like ls, find or grep.
+- For large files, search first, then read only the line range you need.
 - file op="write" OVERWRITES the ENTIRE file with exactly "data".
   It does NOT append. It does NOT merge. It replaces the whole file.
 - Therefore: if you want to make a small change to an existing file, you MUST:
@@ -373,7 +534,7 @@ FOR USING A TOOL:
 {
   "thought": "your reasoning about what to do next",
   "action_type": "tool",
-  "tool": "%s" | "%s" | "%s",
+  "tool": "%s" | "%s" | "%s" | "%s",
 
   // shell fields:
   "command": "...",
@@ -383,16 +544,34 @@ FOR USING A TOOL:
   "prompt": "...",
 
   // file fields:
-  "op": "read" | "write" | "patch" | "replace",
+  "op": "read" | "write" | "patch" | "replace" | "list" | "search" | "stat" | "mkdir" | "move" | "delete",
   "path": "...",
 
+  // read (optional range):
+  "start_line": 0,
+  "end_line": 0,
+
+  // list/search:
+  "depth": 0,       // OPTIONAL for list
+  "glob": "...",    // OPTIONAL for list and search
+  "pattern": "...", // REQUIRED for search
+
+  // move:
+  "dest": "...",    // REQUIRED for move
+
   // write/patch:
   "data": "...",  // REQUIRED for write and patch; MUST be non-empty for write
 
   // replace:
   "old": "...",   // REQUIRED for replace
   "new": "...",   // REQUIRED for replace
-  "n": 0          // OPTIONAL for replace
+  "n": 0,         // OPTIONAL for replace
+
+  // http fields (fetch documentation or call an API; HTML is returned as text):
+  "method": "GET", // OPTIONAL, defaults to GET
+  "url": "https://...",
+  "headers": {},   // OPTIONAL
+  "body": "..."    // OPTIONAL
 }
 
 FOR FINAL ANSWER:
@@ -411,7 +590,7 @@ CRITICAL RULES:
 - You MUST include "action_type" in every response.
 - Do NOT invent alternative schemas (e.g., {"text":...}, {"content":...}, {"result":...} are INVALID).
 - Allowed top-level keys are STRICT:
-  - For action_type="tool": thought, action_type, tool, command, args, prompt, op, path, data, old, new, n
+  - For action_type="tool": thought, action_type, tool, command, args, prompt, op, path, data, old, new, n, start_line, end_line, pattern, glob, depth, dest, method, url, headers, body, fact, goal, mode, tools
   - For action_type="answer": thought, action_type, final_answer
   - No other top-level keys are permitted.
 - Include only fields relevant to your chosen tool
@@ -465,7 +644,7 @@ This is invalid because:
   - It does not include action_type.
   - It breaks the ReAct protocol.
 
-State:
+%sState:
 
 %s
 
@@ -473,7 +652,7 @@ Conversation history:
 
 %s
 
-What's your next step?`, types.ToolShell, types.ToolLLM, types.ToolFiles, stateLine, history)
+What's your next step?`, memory.tool, delegate, types.ToolShell, types.ToolLLM, types.ToolFiles, types.ToolHTTP, memory.facts, stateLine, history)
 }
 
 func parseReActResponse(raw string) (reActAction, error) {
@@ -615,6 +794,25 @@ func convertReActActionToStep(action reActAction) (types.Step, error) {
 				return types.Step{}, errors.New("file write requires data")
 			}
 		case "read":
+			step.StartLine = action.StartLine
+			step.EndLine = action.EndLine
+		case "list":
+			step.Depth = action.Depth
+			step.Glob = action.Glob
+		case "search":
+			if action.Pattern == "" {
+				return types.Step{}, errors.New("file search requires pattern")
+			}
+			step.Pattern = action.Pattern
+			step.Glob = action.Glob
+		case "move":
+			dest := strings.TrimSpace(action.Dest)
+			if dest == "" {
+				return types.Step{}, errors.New("file move requires dest")
+			}
+			step.Dest = dest
+			step.Description = fmt.Sprintf("File move: %s -> %s", path, dest)
+		case "stat", "mkdir", "delete":
 			// ok
 		default:
 			return types.Step{}, fmt.Errorf("unsupported file op: %q", op)
@@ -622,6 +820,65 @@ func convertReActActionToStep(action reActAction) (types.Step, error) {
 
 		return step, nil
 
+	case types.ToolHTTP:
+		url := strings.TrimSpace(action.URL)
+		if url == "" {
+			return types.Step{}, errors.New("http tool requires url")
+		}
+		method := strings.ToUpper(strings.TrimSpace(action.Method))
+		if method == "" {
+			method = "GET"
+		}
+		return types.Step{
+			Type:        types.ToolHTTP,
+			Description: fmt.Sprintf("HTTP %s %s", method, url),
+			Method:      method,
+			URL:         url,
+			Headers:     action.Headers,
+			Body:        action.Body,
+		}, nil
+
+	case types.ToolMemory:
+		fact := strings.TrimSpace(action.Fact)
+		if fact == "" {
+			return types.Step{}, errors.New("memory tool requires fact")
+		}
+		return types.Step{
+			Type:        types.ToolMemory,
+			Description: "Remember: " + fact,
+			Fact:        fact,
+		}, nil
+
+	case types.ToolDelegate:
+		goal := strings.TrimSpace(action.Goal)
+		if goal == "" {
+			return types.Step{}, errors.New("delegate tool requires goal")
+		}
+		mode := strings.ToLower(strings.TrimSpace(action.Mode))
+		switch mode {
+		case "", "react", "plan":
+		default:
+			return types.Step{}, fmt.Errorf("delegate mode must be react or plan, not %q", action.Mode)
+		}
+		var kinds []types.ToolKind
+		for _, t := range action.Tools {
+			switch k := types.ToolKind(strings.ToLower(strings.TrimSpace(t))); k {
+			case types.ToolShell, types.ToolLLM, types.ToolFiles, types.ToolHTTP, types.ToolMemory, types.ToolDelegate:
+				kinds = append(kinds, k)
+			case "files":
+				kinds = append(kinds, types.ToolFiles)
+			default:
+				return types.Step{}, fmt.Errorf("delegate tools has unknown tool %q", t)
+			}
+		}
+		return types.Step{
+			Type:        types.ToolDelegate,
+			Description: "Delegate: " + goal,
+			Goal:        goal,
+			AgentMode:   mode,
+			Tools:       kinds,
+		}, nil
+
 	default:
 		return types.Step{}, fmt.Errorf("unknown tool: %q", action.Tool)
 	}
@@ -758,8 +1015,38 @@ func signatureForAction(a reActAction) actionSig {
 			return actionSig{tool: string(types.ToolFiles), key: fmt.Sprintf("%s:%s len=%d:%q", op, path, len(diff), prefix)}
 		}
 
+		switch op {
+		case "read":
+			if a.StartLine > 0 || a.EndLine > 0 {
+				return actionSig{tool: string(types.ToolFiles), key: fmt.Sprintf("%s:%s lines=%d-%d", op, path, a.StartLine, a.EndLine)}
+			}
+		case "list":
+			return actionSig{tool: string(types.ToolFiles), key: fmt.Sprintf("%s:%s depth=%d glob=%q", op, path, a.Depth, a.Glob)}
+		case "search":
+			return actionSig{tool: string(types.ToolFiles), key: fmt.Sprintf("%s:%s pattern=%q glob=%q", op, path, a.Pattern, a.Glob)}
+		case "move":
+			return actionSig{tool: string(types.ToolFiles), key: fmt.Sprintf("%s:%s dest=%s", op, path, a.Dest)}
+		}
+
 		return actionSig{tool: string(types.ToolFiles), key: op + ":" + path}
 
+	case types.ToolHTTP:
+		method := strings.ToUpper(strings.TrimSpace(a.Method))
+		if method == "" {
+			method = "GET"
+		}
+		body := a.Body
+		if len(body) > 80 {
+			body = body[:80]
+		}
+		return actionSig{tool: string(types.ToolHTTP), key: fmt.Sprintf("%s %s body=%q", method, strings.TrimSpace(a.URL), body)}
+
+	case types.ToolMemory:
+		return actionSig{tool: string(types.ToolMemory), key: strings.ToLower(strings.Join(strings.Fields(a.Fact), " "))}
+
+	case types.ToolDelegate:
+		return actionSig{tool: string(types.ToolDelegate), key: strings.Join(strings.Fields(a.Goal), " ")}
+
 	case types.ToolShell:
 		cmd := strings.TrimSpace(a.Command)
 		args := normalizeArgs(a.Args)
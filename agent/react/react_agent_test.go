@@ -6,7 +6,10 @@ import (
 	"fmt"
 	"github.com/kardolus/chatgpt-cli/agent/core"
 	"github.com/kardolus/chatgpt-cli/agent/react"
+	"github.com/kardolus/chatgpt-cli/agent/tools"
 	"github.com/kardolus/chatgpt-cli/agent/types"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -907,6 +910,230 @@ func testReActAgent(t *testing.T, when spec.G, it spec.S) {
 		})
 	})
 
+	when("LLM uses file search and a ranged read", func() {
+		it("converts the pattern, glob and line range into the steps", func() {
+			for _, raw := range []string{
+				`{"thought":"find it","action_type":"tool","tool":"file","op":"search","path":".","pattern":"func Foo","glob":"*.go"}`,
+				`{"thought":"read it","action_type":"tool","tool":"file","op":"read","path":"a.go","start_line":10,"end_line":30}`,
+				`{"thought":"tidy","action_type":"tool","tool":"file","op":"move","path":"a.go","dest":"pkg/a.go"}`,
+			} {
+				budget.EXPECT().AllowIteration(now).Return(nil)
+				budget.EXPECT().Snapshot(now).Return(core.BudgetSnapshot{})
+				budget.EXPECT().AllowTool(types.ToolLLM, now).Return(nil)
+				llm.EXPECT().Complete(gomock.Any(), gomock.Any()).Return(raw, 1, nil)
+				budget.EXPECT().ChargeLLMTokens(1, now)
+			}
+
+			var steps []types.Step
+			runner.EXPECT().RunStep(gomock.Any(), gomock.Any(), gomock.Any()).
+				DoAndReturn(func(_ context.Context, _ types.Config, step types.Step) (types.StepResult, error) {
+					steps = append(steps, step)
+					return types.StepResult{Outcome: types.OutcomeOK, Output: "ok"}, nil
+				}).Times(3)
+
+			budget.EXPECT().AllowIteration(now).Return(nil)
+			budget.EXPECT().Snapshot(now).Return(core.BudgetSnapshot{})
+			budget.EXPECT().AllowTool(types.ToolLLM, now).Return(nil)
+			llm.EXPECT().Complete(gomock.Any(), gomock.Any()).Return(`{"thought":"done","action_type":"answer","final_answer":"ok"}`, 1, nil)
+			budget.EXPECT().ChargeLLMTokens(1, now)
+
+			_, err := reactAgent.RunAgentGoal(ctx, "Find Foo")
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(steps).To(HaveLen(3))
+			Expect(steps[0].Op).To(Equal("search"))
+			Expect(steps[0].Pattern).To(Equal("func Foo"))
+			Expect(steps[0].Glob).To(Equal("*.go"))
+			Expect(steps[1].StartLine).To(Equal(10))
+			Expect(steps[1].EndLine).To(Equal(30))
+			Expect(steps[2].Dest).To(Equal("pkg/a.go"))
+		})
+	})
+
+	when("LLM uses the http tool", func() {
+		it("converts the request into an http step", func() {
+			budget.EXPECT().AllowIteration(now).Return(nil)
+			budget.EXPECT().Snapshot(now).Return(core.BudgetSnapshot{})
+			budget.EXPECT().AllowTool(types.ToolLLM, now).Return(nil)
+			llm.EXPECT().Complete(gomock.Any(), gomock.Any()).
+				Return(`{"thought":"read the docs","action_type":"tool","tool":"http","url":"https://go.dev/doc","headers":{"Accept":"text/html"}}`, 1, nil)
+			budget.EXPECT().ChargeLLMTokens(1, now)
+
+			var step types.Step
+			runner.EXPECT().RunStep(gomock.Any(), gomock.Any(), gomock.Any()).
+				DoAndReturn(func(_ context.Context, _ types.Config, s types.Step) (types.StepResult, error) {
+					step = s
+					return types.StepResult{Outcome: types.OutcomeOK, Output: "Documentation"}, nil
+				})
+
+			budget.EXPECT().AllowIteration(now).Return(nil)
+			budget.EXPECT().Snapshot(now).Return(core.BudgetSnapshot{})
+			budget.EXPECT().AllowTool(types.ToolLLM, now).Return(nil)
+			llm.EXPECT().Complete(gomock.Any(), gomock.Any()).Return(`{"thought":"done","action_type":"answer","final_answer":"ok"}`, 1, nil)
+			budget.EXPECT().ChargeLLMTokens(1, now)
+
+			_, err := reactAgent.RunAgentGoal(ctx, "Read the Go docs")
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(step.Type).To(Equal(types.ToolHTTP))
+			Expect(step.Method).To(Equal("GET"))
+			Expect(step.URL).To(Equal("https://go.dev/doc"))
+			Expect(step.Headers).To(Equal(map[string]string{"Accept": "text/html"}))
+		})
+	})
+
+	when("earlier runs of the conversation are known", func() {
+		it("puts their goals, answers and effects ahead of the new goal", func() {
+			reactAgent = react.NewReActAgent(llm, runner, budget, clock, core.WithPriorRuns([]types.PriorRun{
+				{Goal: "add a Sum function", Answer: "Added Sum to math.go", Effects: []string{"file.write math.go"}},
+				{Goal: "what does Sum do?", Answer: "It adds numbers"},
+			}))
+
+			budget.EXPECT().AllowIteration(now).Return(nil)
+			budget.EXPECT().Snapshot(now).Return(core.BudgetSnapshot{})
+			budget.EXPECT().AllowTool(types.ToolLLM, now).Return(nil)
+			var prompt string
+			llm.EXPECT().Complete(gomock.Any(), gomock.Any()).
+				DoAndReturn(func(_ context.Context, p string) (string, int, error) {
+					prompt = p
+					return `{"thought":"done","action_type":"answer","final_answer":"ok"}`, 1, nil
+				})
+			budget.EXPECT().ChargeLLMTokens(1, now)
+
+			_, err := reactAgent.RunAgentGoal(ctx, "now also add tests for that")
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(prompt).To(ContainSubstring("EARLIER RUNS"))
+			Expect(prompt).To(ContainSubstring("RUN 1 USER: add a Sum function\nRUN 1 ANSWER: Added Sum to math.go\nRUN 1 SIDE_EFFECTS:\n- file.write math.go"))
+			Expect(prompt).To(ContainSubstring("RUN 2 SIDE_EFFECTS: none"))
+			Expect(strings.Index(prompt, "RUN 2 ANSWER")).To(BeNumerically("<", strings.Index(prompt, "USER: now also add tests for that")))
+			Expect(reactAgent.Transcript.String()).To(ContainSubstring("[session] prior_runs=2"))
+		})
+	})
+
+	when("project memory is enabled", func() {
+		it("shows the remembered facts and converts memory actions into memory steps", func() {
+			mem := tools.NewFileMemory(filepath.Join(t.TempDir(), "memory.md"), "/project", 0)
+			_, err := mem.Remember("tests run with make test")
+			Expect(err).NotTo(HaveOccurred())
+			reactAgent = react.NewReActAgent(llm, runner, budget, clock, core.WithMemory(mem))
+
+			budget.EXPECT().AllowIteration(now).Return(nil)
+			budget.EXPECT().Snapshot(now).Return(core.BudgetSnapshot{})
+			budget.EXPECT().AllowTool(types.ToolLLM, now).Return(nil)
+			var prompt string
+			llm.EXPECT().Complete(gomock.Any(), gomock.Any()).
+				DoAndReturn(func(_ context.Context, p string) (string, int, error) {
+					prompt = p
+					return `{"thought":"worth keeping","action_type":"tool","tool":"memory","fact":"lint with make lint"}`, 1, nil
+				})
+			budget.EXPECT().ChargeLLMTokens(1, now)
+
+			var step types.Step
+			runner.EXPECT().RunStep(gomock.Any(), gomock.Any(), gomock.Any()).
+				DoAndReturn(func(_ context.Context, _ types.Config, s types.Step) (types.StepResult, error) {
+					step = s
+					return types.StepResult{Outcome: types.OutcomeOK, Output: "remembered"}, nil
+				})
+
+			budget.EXPECT().AllowIteration(now).Return(nil)
+			budget.EXPECT().Snapshot(now).Return(core.BudgetSnapshot{})
+			budget.EXPECT().AllowTool(types.ToolLLM, now).Return(nil)
+			llm.EXPECT().Complete(gomock.Any(), gomock.Any()).Return(`{"thought":"done","action_type":"answer","final_answer":"ok"}`, 1, nil)
+			budget.EXPECT().ChargeLLMTokens(1, now)
+
+			_, err = reactAgent.RunAgentGoal(ctx, "Set up the project")
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(prompt).To(ContainSubstring("Project memory"))
+			Expect(prompt).To(ContainSubstring("- tests run with make test"))
+			Expect(step.Type).To(Equal(types.ToolMemory))
+			Expect(step.Fact).To(Equal("lint with make lint"))
+		})
+
+		it("does not offer the memory tool when memory is disabled", func() {
+			budget.EXPECT().AllowIteration(now).Return(nil)
+			budget.EXPECT().Snapshot(now).Return(core.BudgetSnapshot{})
+			budget.EXPECT().AllowTool(types.ToolLLM, now).Return(nil)
+			var prompt string
+			llm.EXPECT().Complete(gomock.Any(), gomock.Any()).
+				DoAndReturn(func(_ context.Context, p string) (string, int, error) {
+					prompt = p
+					return `{"thought":"done","action_type":"answer","final_answer":"ok"}`, 1, nil
+				})
+			budget.EXPECT().ChargeLLMTokens(1, now)
+
+			_, err := reactAgent.RunAgentGoal(ctx, "Set up the project")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(prompt).NotTo(ContainSubstring("Project memory"))
+		})
+	})
+
+	when("delegation is enabled", func() {
+		it("offers the delegate tool and converts delegate actions into delegate steps", func() {
+			reactAgent = react.NewReActAgent(llm, runner, budget, clock, core.WithDelegation(true))
+
+			budget.EXPECT().AllowIteration(now).Return(nil)
+			budget.EXPECT().Snapshot(now).Return(core.BudgetSnapshot{})
+			budget.EXPECT().AllowTool(types.ToolLLM, now).Return(nil)
+			var prompt string
+			llm.EXPECT().Complete(gomock.Any(), gomock.Any()).
+				DoAndReturn(func(_ context.Context, p string) (string, int, error) {
+					prompt = p
+					return `{"thought":"separable","action_type":"tool","tool":"delegate","goal":"write tests for parser","mode":"Plan","tools":["files","shell"]}`, 1, nil
+				})
+			budget.EXPECT().ChargeLLMTokens(1, now)
+
+			var step types.Step
+			runner.EXPECT().RunStep(gomock.Any(), gomock.Any(), gomock.Any()).
+				DoAndReturn(func(_ context.Context, _ types.Config, s types.Step) (types.StepResult, error) {
+					step = s
+					return types.StepResult{Outcome: types.OutcomeOK, Output: "added parser_test.go"}, nil
+				})
+
+			budget.EXPECT().AllowIteration(now).Return(nil)
+			budget.EXPECT().Snapshot(now).Return(core.BudgetSnapshot{})
+			budget.EXPECT().AllowTool(types.ToolLLM, now).Return(nil)
+			var followUp string
+			llm.EXPECT().Complete(gomock.Any(), gomock.Any()).
+				DoAndReturn(func(_ context.Context, p string) (string, int, error) {
+					followUp = p
+					return `{"thought":"done","action_type":"answer","final_answer":"ok"}`, 1, nil
+				})
+			budget.EXPECT().ChargeLLMTokens(1, now)
+
+			_, err := reactAgent.RunAgentGoal(ctx, "Test the parser")
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(prompt).To(ContainSubstring("5. delegate - Hand a self-contained sub-task to a sub-agent"))
+			Expect(step).To(Equal(types.Step{
+				Type:        types.ToolDelegate,
+				Description: "Delegate: write tests for parser",
+				Goal:        "write tests for parser",
+				AgentMode:   "plan",
+				Tools:       []types.ToolKind{types.ToolFiles, types.ToolShell},
+			}))
+			Expect(followUp).To(ContainSubstring("added parser_test.go"))
+		})
+
+		it("does not offer the delegate tool when delegation is disabled", func() {
+			budget.EXPECT().AllowIteration(now).Return(nil)
+			budget.EXPECT().Snapshot(now).Return(core.BudgetSnapshot{})
+			budget.EXPECT().AllowTool(types.ToolLLM, now).Return(nil)
+			var prompt string
+			llm.EXPECT().Complete(gomock.Any(), gomock.Any()).
+				DoAndReturn(func(_ context.Context, p string) (string, int, error) {
+					prompt = p
+					return `{"thought":"done","action_type":"answer","final_answer":"ok"}`, 1, nil
+				})
+			budget.EXPECT().ChargeLLMTokens(1, now)
+
+			_, err := reactAgent.RunAgentGoal(ctx, "Test the parser")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(prompt).NotTo(ContainSubstring("delegate"))
+		})
+	})
+
 	when("LLM uses file patch without data", func() {
 		it("injects error observation and lets LLM recover", func() {
 			// Iteration 1: invalid patch
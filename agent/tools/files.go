@@ -1,13 +1,26 @@
 package tools
 
 import (
+	"bufio"
 	"bytes"
 	"fmt"
 	"github.com/kardolus/chatgpt-cli/agent/utils"
+	"io/fs"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
 
 	"github.com/kardolus/chatgpt-cli/internal/fsio"
 )
 
+const (
+	maxListEntries    = 1000
+	maxSearchMatches  = 200
+	maxSearchFileSize = 1 << 20
+	maxSearchLineLen  = 240
+)
+
 type PatchResult struct {
 	Hunks int
 }
@@ -17,11 +30,58 @@ type ReplaceResult struct {
 	Replaced         int
 }
 
+type ReadResult struct {
+	Content    string
+	StartLine  int
+	EndLine    int
+	TotalLines int
+}
+
+type ListEntry struct {
+	Path  string // relative to the listed directory, with forward slashes
+	IsDir bool
+	Size  int64
+}
+
+type ListResult struct {
+	Entries   []ListEntry
+	Truncated bool
+}
+
+type SearchMatch struct {
+	Path string
+	Line int
+	Text string
+}
+
+type SearchResult struct {
+	Matches      []SearchMatch
+	FilesScanned int
+	Truncated    bool
+}
+
+type StatResult struct {
+	Path    string
+	IsDir   bool
+	Size    int64
+	Mode    fs.FileMode
+	ModTime time.Time
+}
+
 type Files interface {
 	ReadFile(path string) ([]byte, error)
+	ReadLines(path string, start, end int) (ReadResult, error)
 	WriteFile(path string, data []byte) error
 	PatchFile(path string, unifiedDiff []byte) (PatchResult, error)
 	ReplaceBytesInFile(path string, old, new []byte, n int) (ReplaceResult, error)
+
+	List(path string, depth int, glob string) (ListResult, error)
+	Search(path, pattern, glob string) (SearchResult, error)
+	Stat(path string) (StatResult, error)
+
+	Mkdir(path string) error
+	Move(src, dst string) error
+	Delete(path string) error
 }
 
 type FSIOFileOps struct {
@@ -119,3 +179,214 @@ func (f FSIOFileOps) ReplaceBytesInFile(path string, old, new []byte, n int) (Re
 
 	return ReplaceResult{OccurrencesFound: found, Replaced: replaced}, nil
 }
+
+// ReadLines returns the lines start through end of a file, counting from 1. A start of 0
+// reads from the beginning and an end of 0 (or past the last line) reads to the end.
+func (f FSIOFileOps) ReadLines(path string, start, end int) (ReadResult, error) {
+	b, err := f.ReadFile(path)
+	if err != nil {
+		return ReadResult{}, err
+	}
+
+	lines := strings.SplitAfter(string(b), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	total := len(lines)
+	if total == 0 {
+		return ReadResult{}, nil
+	}
+
+	if start <= 0 {
+		start = 1
+	}
+	if end <= 0 || end > total {
+		end = total
+	}
+	if start > total {
+		return ReadResult{TotalLines: total}, fmt.Errorf("read %s: start line %d is past the end of the file (%d lines)", path, start, total)
+	}
+	if end < start {
+		return ReadResult{TotalLines: total}, fmt.Errorf("read %s: end line %d is before start line %d", path, end, start)
+	}
+
+	return ReadResult{
+		Content:    strings.Join(lines[start-1:end], ""),
+		StartLine:  start,
+		EndLine:    end,
+		TotalLines: total,
+	}, nil
+}
+
+// List returns the entries under path, depth levels deep (0 and 1 = its direct entries).
+// Entries whose name doesn't match glob are left out, but their directories are still
+// walked. The .git directory is skipped.
+func (f FSIOFileOps) List(path string, depth int, glob string) (ListResult, error) {
+	if depth <= 0 {
+		depth = 1
+	}
+	if err := checkGlob(glob); err != nil {
+		return ListResult{}, err
+	}
+
+	var res ListResult
+	err := f.r.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == path {
+			if !d.IsDir() {
+				res.Entries = append(res.Entries, listEntry(filepath.Base(p), d))
+			}
+			return nil
+		}
+		if d.IsDir() && d.Name() == ".git" {
+			return filepath.SkipDir
+		}
+
+		rel, err := filepath.Rel(path, p)
+		if err != nil {
+			return err
+		}
+		if glob == "" || matchGlob(glob, d.Name()) {
+			if len(res.Entries) == maxListEntries {
+				res.Truncated = true
+				return filepath.SkipAll
+			}
+			res.Entries = append(res.Entries, listEntry(rel, d))
+		}
+
+		if d.IsDir() && strings.Count(filepath.ToSlash(rel), "/")+1 >= depth {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		return res, fmt.Errorf("list %s: %w", path, err)
+	}
+	return res, nil
+}
+
+// Search returns the lines matching the regular expression pattern in path, or in the
+// files under it whose name matches glob. Binary and large files are skipped.
+func (f FSIOFileOps) Search(path, pattern, glob string) (SearchResult, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return SearchResult{}, fmt.Errorf("search %s: invalid pattern: %w", path, err)
+	}
+	if err := checkGlob(glob); err != nil {
+		return SearchResult{}, err
+	}
+
+	var res SearchResult
+	err = f.r.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if p != path && d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if p != path && glob != "" && !matchGlob(glob, d.Name()) {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil || !info.Mode().IsRegular() || info.Size() > maxSearchFileSize {
+			return nil
+		}
+		b, err := f.ReadFile(p)
+		if err != nil || bytes.IndexByte(b, 0) >= 0 {
+			return nil
+		}
+		res.FilesScanned++
+
+		scanner := bufio.NewScanner(bytes.NewReader(b))
+		scanner.Buffer(make([]byte, 0, 64*1024), maxSearchFileSize)
+		for line := 1; scanner.Scan(); line++ {
+			text := scanner.Text()
+			if !re.MatchString(text) {
+				continue
+			}
+			if len(res.Matches) == maxSearchMatches {
+				res.Truncated = true
+				return filepath.SkipAll
+			}
+			if len(text) > maxSearchLineLen {
+				text = text[:maxSearchLineLen] + "..."
+			}
+			res.Matches = append(res.Matches, SearchMatch{Path: filepath.ToSlash(p), Line: line, Text: text})
+		}
+		return nil
+	})
+	if err != nil {
+		return res, fmt.Errorf("search %s: %w", path, err)
+	}
+	return res, nil
+}
+
+func (f FSIOFileOps) Stat(path string) (StatResult, error) {
+	info, err := f.r.Stat(path)
+	if err != nil {
+		return StatResult{}, err
+	}
+	return StatResult{
+		Path:    path,
+		IsDir:   info.IsDir(),
+		Size:    info.Size(),
+		Mode:    info.Mode(),
+		ModTime: info.ModTime(),
+	}, nil
+}
+
+func (f FSIOFileOps) Mkdir(path string) error {
+	return f.w.MkdirAll(path, 0o755)
+}
+
+// Move renames src to dst, creating the parent directories of dst. It refuses to
+// overwrite an existing dst.
+func (f FSIOFileOps) Move(src, dst string) error {
+	if _, err := f.r.Stat(src); err != nil {
+		return err
+	}
+	if _, err := f.r.Lstat(dst); err == nil {
+		return fmt.Errorf("move %s: %s already exists", src, dst)
+	}
+	if err := f.w.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+	return f.w.Rename(src, dst)
+}
+
+// Delete removes a file or an empty directory.
+func (f FSIOFileOps) Delete(path string) error {
+	err := f.w.Remove(path)
+	if err != nil {
+		if info, statErr := f.r.Stat(path); statErr == nil && info.IsDir() {
+			return fmt.Errorf("delete %s: only empty directories can be deleted", path)
+		}
+	}
+	return err
+}
+
+func listEntry(rel string, d fs.DirEntry) ListEntry {
+	entry := ListEntry{Path: filepath.ToSlash(rel), IsDir: d.IsDir()}
+	if info, err := d.Info(); err == nil && !d.IsDir() {
+		entry.Size = info.Size()
+	}
+	return entry
+}
+
+func checkGlob(glob string) error {
+	if _, err := filepath.Match(glob, ""); err != nil {
+		return fmt.Errorf("invalid glob %q: %w", glob, err)
+	}
+	return nil
+}
+
+func matchGlob(glob, name string) bool {
+	ok, err := filepath.Match(glob, name)
+	return err == nil && ok
+}
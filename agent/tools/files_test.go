@@ -0,0 +1,198 @@
+package tools_test
+
+import (
+	"errors"
+	"github.com/golang/mock/gomock"
+	"github.com/kardolus/chatgpt-cli/agent/tools"
+	"github.com/kardolus/chatgpt-cli/internal/fsio"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+)
+
+func TestUnitFiles(t *testing.T) {
+	spec.Run(t, "Testing the file tool", testFiles, spec.Report(report.Terminal{}))
+}
+
+func testFiles(t *testing.T, when spec.G, it spec.S) {
+	var (
+		dir     string
+		subject tools.FSIOFileOps
+	)
+
+	write := func(rel, content string) string {
+		path := filepath.Join(dir, rel)
+		Expect(os.MkdirAll(filepath.Dir(path), 0o755)).To(Succeed())
+		Expect(os.WriteFile(path, []byte(content), 0o644)).To(Succeed())
+		return path
+	}
+
+	it.Before(func() {
+		RegisterTestingT(t)
+		dir = t.TempDir()
+		subject = tools.NewFSIOFileOps(fsio.NewRealReader(fsio.DefaultBufferSize), &fsio.RealWriter{})
+	})
+
+	when("ReadLines()", func() {
+		it("returns the requested range", func() {
+			path := write("a.txt", "one\ntwo\nthree\nfour")
+
+			res, err := subject.ReadLines(path, 2, 3)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res).To(Equal(tools.ReadResult{Content: "two\nthree\n", StartLine: 2, EndLine: 3, TotalLines: 4}))
+
+			res, err = subject.ReadLines(path, 3, 0)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res.Content).To(Equal("three\nfour"))
+			Expect(res.EndLine).To(Equal(4))
+		})
+
+		it("rejects ranges past the end", func() {
+			path := write("a.txt", "one\ntwo\n")
+
+			_, err := subject.ReadLines(path, 5, 0)
+			Expect(err).To(MatchError(ContainSubstring("start line 5 is past the end of the file (2 lines)")))
+
+			_, err = subject.ReadLines(path, 2, 1)
+			Expect(err).To(MatchError(ContainSubstring("end line 1 is before start line 2")))
+		})
+	})
+
+	when("List()", func() {
+		it("honours depth and glob and skips .git", func() {
+			write("main.go", "package main")
+			write("README.md", "# hi")
+			write("pkg/a.go", "package pkg")
+			write("pkg/deep/b.go", "package deep")
+			write(".git/config", "[core]")
+
+			res, err := subject.List(dir, 1, "")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(paths(res)).To(Equal([]string{"README.md", "main.go", "pkg/"}))
+
+			res, err = subject.List(dir, 3, "*.go")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(paths(res)).To(Equal([]string{"main.go", "pkg/a.go", "pkg/deep/b.go"}))
+			Expect(res.Entries[0].Size).To(Equal(int64(12)))
+		})
+
+		it("rejects invalid globs", func() {
+			_, err := subject.List(dir, 1, "[")
+			Expect(err).To(MatchError(ContainSubstring(`invalid glob "["`)))
+		})
+	})
+
+	when("Search()", func() {
+		it("returns matching lines with line numbers", func() {
+			write("a.go", "package a\n\nfunc Foo() {}\n")
+			write("b.txt", "Foo in text\n")
+			write("bin.dat", "Foo\x00")
+
+			res, err := subject.Search(dir, `Foo\b`, "*.go")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res.Matches).To(Equal([]tools.SearchMatch{
+				{Path: filepath.ToSlash(filepath.Join(dir, "a.go")), Line: 3, Text: "func Foo() {}"},
+			}))
+
+			res, err = subject.Search(dir, "Foo", "")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res.Matches).To(HaveLen(2))
+			Expect(res.FilesScanned).To(Equal(2))
+		})
+
+		it("rejects invalid patterns", func() {
+			_, err := subject.Search(dir, "(", "")
+			Expect(err).To(MatchError(ContainSubstring("invalid pattern")))
+		})
+	})
+
+	when("Mkdir(), Move() and Delete()", func() {
+		it("creates, moves and deletes", func() {
+			src := write("a.txt", "a")
+			out := filepath.Join(dir, "out", "nested")
+
+			Expect(subject.Mkdir(out)).To(Succeed())
+			stat, err := subject.Stat(out)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(stat.IsDir).To(BeTrue())
+
+			dst := filepath.Join(out, "a.txt")
+			Expect(subject.Move(src, dst)).To(Succeed())
+			Expect(src).NotTo(BeAnExistingFile())
+			Expect(dst).To(BeAnExistingFile())
+
+			Expect(subject.Delete(out)).To(MatchError(ContainSubstring("only empty directories can be deleted")))
+			Expect(subject.Delete(dst)).To(Succeed())
+			Expect(subject.Delete(out)).To(Succeed())
+		})
+
+		it("does not overwrite on move", func() {
+			src := write("a.txt", "a")
+			dst := write("b.txt", "b")
+
+			Expect(subject.Move(src, dst)).To(MatchError(ContainSubstring("already exists")))
+			Expect(os.ReadFile(dst)).To(Equal([]byte("b")))
+		})
+	})
+
+	when("the file system is not the real one", func() {
+		var (
+			ctrl   *gomock.Controller
+			reader *MockReader
+			writer *MockWriter
+		)
+
+		it.Before(func() {
+			ctrl = gomock.NewController(t)
+			reader = NewMockReader(ctrl)
+			writer = NewMockWriter(ctrl)
+			subject = tools.NewFSIOFileOps(reader, writer)
+		})
+
+		it.After(func() {
+			ctrl.Finish()
+		})
+
+		it("walks, stats and changes files only through the reader and writer", func() {
+			walkErr := errors.New("walk failed")
+			reader.EXPECT().WalkDir("/src", gomock.Any()).Return(walkErr).Times(2)
+			reader.EXPECT().Stat("/src/a.txt").Return(nil, os.ErrNotExist)
+			writer.EXPECT().MkdirAll("/out", os.FileMode(0o755)).Return(nil)
+			writer.EXPECT().Remove("/src/a.txt").Return(nil)
+
+			_, err := subject.List("/src", 1, "")
+			Expect(err).To(MatchError(walkErr))
+			_, err = subject.Search("/src", "x", "")
+			Expect(err).To(MatchError(walkErr))
+			_, err = subject.Stat("/src/a.txt")
+			Expect(err).To(MatchError(os.ErrNotExist))
+			Expect(subject.Mkdir("/out")).To(Succeed())
+			Expect(subject.Delete("/src/a.txt")).To(Succeed())
+		})
+
+		it("moves through the writer", func() {
+			reader.EXPECT().Stat("/src/a.txt").Return(nil, nil)
+			reader.EXPECT().Lstat("/out/a.txt").Return(nil, os.ErrNotExist)
+			writer.EXPECT().MkdirAll("/out", os.FileMode(0o755)).Return(nil)
+			writer.EXPECT().Rename("/src/a.txt", "/out/a.txt").Return(nil)
+
+			Expect(subject.Move("/src/a.txt", "/out/a.txt")).To(Succeed())
+		})
+	})
+}
+
+func paths(res tools.ListResult) []string {
+	var out []string
+	for _, e := range res.Entries {
+		p := e.Path
+		if e.IsDir {
+			p += "/"
+		}
+		out = append(out, p)
+	}
+	return out
+}
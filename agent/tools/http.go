@@ -0,0 +1,120 @@
+package tools
+
+import (
+	"context"
+	"github.com/kardolus/chatgpt-cli/api/http"
+	"github.com/kardolus/chatgpt-cli/internal/document"
+	"mime"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const DefaultHTTPMaxBytes = 50_000
+
+// readFactor is how many times the byte budget is read of a response. HTML shrinks a lot when
+// converted to text, so more than the budget is needed, but never the whole of a huge response.
+const readFactor = 4
+
+type HTTPRequest struct {
+	Method  string
+	URL     string
+	Headers map[string]string
+	Body    string
+}
+
+type HTTPResult struct {
+	Status      int
+	ContentType string
+	Location    string // set on redirects, which aren't followed
+
+	// Body is the response body, converted to text for HTML and cut at the byte budget.
+	Body      string
+	Bytes     int // size of the response body, from Content-Length or what was read
+	Truncated bool
+}
+
+type HTTP interface {
+	Fetch(ctx context.Context, req HTTPRequest) (HTTPResult, error)
+}
+
+type CallerHTTP struct {
+	caller   http.Caller
+	maxBytes int
+}
+
+// NewCallerHTTP returns an HTTP tool on top of caller that keeps at most maxBytes of
+// every response. A maxBytes of 0 uses DefaultHTTPMaxBytes.
+func NewCallerHTTP(caller http.Caller, maxBytes int) *CallerHTTP {
+	if maxBytes <= 0 {
+		maxBytes = DefaultHTTPMaxBytes
+	}
+	return &CallerHTTP{caller: caller, maxBytes: maxBytes}
+}
+
+func (h *CallerHTTP) Fetch(ctx context.Context, req HTTPRequest) (HTTPResult, error) {
+	if err := ctx.Err(); err != nil {
+		return HTTPResult{}, err
+	}
+
+	method := strings.ToUpper(strings.TrimSpace(req.Method))
+	if method == "" {
+		method = "GET"
+	}
+
+	resp, err := h.caller.Request(ctx, method, req.URL, []byte(req.Body), req.Headers, int64(h.maxBytes)*readFactor)
+	if err != nil {
+		return HTTPResult{}, err
+	}
+
+	res := HTTPResult{
+		Status:      resp.Status,
+		ContentType: header(resp.Headers, "Content-Type"),
+		Location:    header(resp.Headers, "Location"),
+		Bytes:       len(resp.Body),
+	}
+	if n, err := strconv.Atoi(header(resp.Headers, "Content-Length")); err == nil && n > res.Bytes {
+		res.Bytes = n
+	}
+
+	body := string(resp.Body)
+	if isHTML(res.ContentType, resp.Body) {
+		if text, err := document.HTMLText(resp.Body); err == nil {
+			body = text
+		}
+	}
+	res.Body, res.Truncated = truncateUTF8(body, h.maxBytes)
+	res.Truncated = res.Truncated || resp.Truncated
+
+	return res, nil
+}
+
+func header(headers map[string]string, key string) string {
+	for k, v := range headers {
+		if strings.EqualFold(k, key) {
+			return v
+		}
+	}
+	return ""
+}
+
+func isHTML(contentType string, body []byte) bool {
+	if contentType != "" {
+		mediaType, _, err := mime.ParseMediaType(contentType)
+		return err == nil && (mediaType == "text/html" || mediaType == "application/xhtml+xml")
+	}
+	head := strings.ToLower(strings.TrimSpace(string(body[:min(len(body), 512)])))
+	return strings.HasPrefix(head, "<!doctype html") || strings.HasPrefix(head, "<html")
+}
+
+// truncateUTF8 cuts s to at most max bytes without splitting a rune.
+func truncateUTF8(s string, max int) (string, bool) {
+	if len(s) <= max {
+		return s, false
+	}
+	cut := max
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return s[:cut], true
+}
@@ -0,0 +1,119 @@
+package tools_test
+
+import (
+	"context"
+	"github.com/kardolus/chatgpt-cli/agent/tools"
+	"github.com/kardolus/chatgpt-cli/api/http"
+	"github.com/kardolus/chatgpt-cli/config"
+	stdhttp "net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+)
+
+func TestUnitHTTP(t *testing.T) {
+	spec.Run(t, "Testing the http tool", testHTTP, spec.Report(report.Terminal{}))
+}
+
+func testHTTP(t *testing.T, when spec.G, it spec.S) {
+	var server *httptest.Server
+
+	it.Before(func() {
+		RegisterTestingT(t)
+
+		mux := stdhttp.NewServeMux()
+		mux.HandleFunc("/page", func(w stdhttp.ResponseWriter, r *stdhttp.Request) {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			_, _ = w.Write([]byte(`<html><head><title>x</title><script>var a</script></head>` +
+				`<body><h1>Install</h1><p>Run <code>go install</code>.</p></body></html>`))
+		})
+		mux.HandleFunc("/json", func(w stdhttp.ResponseWriter, r *stdhttp.Request) {
+			Expect(r.Method).To(Equal(stdhttp.MethodPost))
+			Expect(r.Header.Get("Authorization")).To(BeEmpty())
+			Expect(r.Header.Get("Accept")).To(Equal("application/json"))
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"items":["é","b"]}`))
+		})
+		mux.HandleFunc("/big", func(w stdhttp.ResponseWriter, r *stdhttp.Request) {
+			w.Header().Set("Content-Length", strconv.Itoa(1<<20))
+			_, _ = w.Write([]byte(strings.Repeat("a", 1<<20)))
+		})
+		mux.HandleFunc("/old", func(w stdhttp.ResponseWriter, r *stdhttp.Request) {
+			stdhttp.Redirect(w, r, "/page", stdhttp.StatusMovedPermanently)
+		})
+		server = httptest.NewServer(mux)
+	})
+
+	it.After(func() {
+		server.Close()
+	})
+
+	newSubject := func(maxBytes int) *tools.CallerHTTP {
+		caller := http.New(config.Config{APIKey: "secret", AuthHeader: "Authorization", AuthTokenPrefix: "Bearer "})
+		return tools.NewCallerHTTP(caller, maxBytes)
+	}
+
+	when("Fetch()", func() {
+		it("converts HTML to readable text", func() {
+			res, err := newSubject(0).Fetch(context.Background(), tools.HTTPRequest{URL: server.URL + "/page"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res.Status).To(Equal(200))
+			Expect(res.Body).To(Equal("Install\n\nRun go install."))
+			Expect(res.Truncated).To(BeFalse())
+		})
+
+		it("sends the method, headers and body without the API key", func() {
+			res, err := newSubject(0).Fetch(context.Background(), tools.HTTPRequest{
+				Method:  "post",
+				URL:     server.URL + "/json",
+				Headers: map[string]string{"Accept": "application/json"},
+				Body:    `{"q":1}`,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res.ContentType).To(Equal("application/json"))
+			Expect(res.Body).To(Equal(`{"items":["é","b"]}`))
+		})
+
+		it("truncates the body to the byte budget without splitting characters", func() {
+			res, err := newSubject(12).Fetch(context.Background(), tools.HTTPRequest{
+				Method:  "POST",
+				URL:     server.URL + "/json",
+				Headers: map[string]string{"Accept": "application/json"},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res.Body).To(Equal(`{"items":["`))
+			Expect(res.Truncated).To(BeTrue())
+			Expect(res.Bytes).To(Equal(len(`{"items":["é","b"]}`)))
+		})
+
+		it("reads only a few times the byte budget of a large response", func() {
+			res, err := newSubject(100).Fetch(context.Background(), tools.HTTPRequest{URL: server.URL + "/big"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res.Body).To(Equal(strings.Repeat("a", 100)))
+			Expect(res.Truncated).To(BeTrue())
+			Expect(res.Bytes).To(Equal(1 << 20))
+		})
+
+		it("reports redirects instead of following them", func() {
+			res, err := newSubject(0).Fetch(context.Background(), tools.HTTPRequest{URL: server.URL + "/old"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res.Status).To(Equal(stdhttp.StatusMovedPermanently))
+			Expect(res.Location).To(Equal("/page"))
+		})
+
+		it("fails for unreachable hosts and cancelled contexts", func() {
+			_, err := newSubject(0).Fetch(context.Background(), tools.HTTPRequest{URL: strings.Replace(server.URL, "http", "htp", 1)})
+			Expect(err).To(HaveOccurred())
+
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			_, err = newSubject(0).Fetch(ctx, tools.HTTPRequest{URL: server.URL + "/page"})
+			Expect(err).To(MatchError(context.Canceled))
+		})
+	})
+}
@@ -15,22 +15,10 @@ type ClientLLM struct {
 
 func NewClientLLM(c *apiclient.Client) *ClientLLM { return &ClientLLM{c: c} }
 
+// Complete keeps agent internals out of the thread. Parallel plan steps share the client, so
+// every call gets its own request state.
 func (l *ClientLLM) Complete(ctx context.Context, prompt string) (string, int, error) {
-	// save
-	prevOmit := l.c.Config.OmitHistory
-	prevTemp := l.c.Config.Temperature
-
-	// set for agent internals
-	l.c.Config.OmitHistory = true
-	l.c.Config.Temperature = 0
-
-	// restore no matter what
-	defer func() {
-		l.c.Config.OmitHistory = prevOmit
-		l.c.Config.Temperature = prevTemp
-	}()
-
-	out, tokens, err := l.c.Query(ctx, prompt)
+	out, tokens, err := l.c.QueryWithoutHistory(ctx, prompt)
 	if err != nil {
 		return "", 0, err
 	}
@@ -0,0 +1,113 @@
+package tools_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/kardolus/chatgpt-cli/agent/tools"
+	"github.com/kardolus/chatgpt-cli/api"
+	apiclient "github.com/kardolus/chatgpt-cli/api/client"
+	"github.com/kardolus/chatgpt-cli/api/http"
+	"github.com/kardolus/chatgpt-cli/config"
+	"github.com/kardolus/chatgpt-cli/history"
+	"io"
+	stdhttp "net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+)
+
+func TestUnitLLM(t *testing.T) {
+	spec.Run(t, "Testing the llm tool", testLLM, spec.Report(report.Terminal{}))
+}
+
+func testLLM(t *testing.T, when spec.G, it spec.S) {
+	it.Before(func() {
+		RegisterTestingT(t)
+	})
+
+	when("Complete()", func() {
+		it("keeps parallel calls apart and out of the thread", func() {
+			var (
+				mu       sync.Mutex
+				requests []api.CompletionsRequest
+			)
+			server := httptest.NewServer(stdhttp.HandlerFunc(func(w stdhttp.ResponseWriter, r *stdhttp.Request) {
+				b, _ := io.ReadAll(r.Body)
+				var req api.CompletionsRequest
+				_ = json.Unmarshal(b, &req)
+
+				mu.Lock()
+				requests = append(requests, req)
+				mu.Unlock()
+
+				time.Sleep(10 * time.Millisecond)
+				prompt := req.Messages[len(req.Messages)-1].Content
+				_, _ = fmt.Fprintf(w, `{"choices":[{"message":{"role":"assistant","content":"re: %s"}}],"usage":{"total_tokens":3}}`, prompt)
+			}))
+			defer server.Close()
+
+			store := &threadStore{}
+			cfg := config.Config{
+				Model:           "gpt-4o",
+				URL:             server.URL,
+				CompletionsPath: "/v1/chat/completions",
+				ContextWindow:   8192,
+				Temperature:     0.7,
+				Role:            "You are a helpful assistant.",
+			}
+			c := apiclient.New(http.RealCallerFactory, store, &apiclient.RealTime{}, nil, nil, cfg)
+			llm := tools.NewClientLLM(c)
+
+			var wg sync.WaitGroup
+			answers := make([]string, 8)
+			for i := range answers {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					out, tokens, err := llm.Complete(context.Background(), fmt.Sprintf("step %d", i))
+					Expect(err).NotTo(HaveOccurred())
+					Expect(tokens).To(Equal(3))
+					answers[i] = out
+				}(i)
+			}
+			wg.Wait()
+
+			for i, answer := range answers {
+				Expect(answer).To(Equal(fmt.Sprintf("re: step %d", i)))
+			}
+			Expect(requests).To(HaveLen(len(answers)))
+			for _, req := range requests {
+				Expect(req.Messages).To(HaveLen(1))
+				Expect(req.Messages[0].Role).To(Equal("user"))
+				Expect(req.Temperature).To(BeZero())
+			}
+
+			Expect(c.Config.OmitHistory).To(BeFalse())
+			Expect(c.Config.Temperature).To(Equal(0.7))
+			Expect(c.History).To(BeEmpty())
+			Expect(store.writes).To(BeZero())
+		})
+	})
+}
+
+type threadStore struct {
+	mu     sync.Mutex
+	writes int
+}
+
+func (s *threadStore) Read() ([]history.History, error)             { return nil, nil }
+func (s *threadStore) ReadThread(string) ([]history.History, error) { return nil, nil }
+func (s *threadStore) SetThread(string)                             {}
+func (s *threadStore) GetThread() string                            { return "default" }
+func (s *threadStore) Write([]history.History) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.writes++
+	return nil
+}
@@ -0,0 +1,162 @@
+package tools
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const (
+	DefaultMemoryMaxBytes = 4000
+	MaxMemoryFactBytes    = 500
+
+	memoryDir = "agent-memory"
+)
+
+type MemoryResult struct {
+	Added   bool // false when the fact was already remembered
+	Dropped int  // oldest facts dropped to stay under the size cap
+	Facts   int
+}
+
+// Memory holds facts an agent learned about a project, like its build and test commands.
+type Memory interface {
+	Facts() ([]string, error)
+	Remember(fact string) (MemoryResult, error)
+	Clear() error
+}
+
+// FileMemory keeps the facts of one project as a Markdown list, oldest first.
+type FileMemory struct {
+	mu       sync.Mutex
+	path     string
+	project  string
+	maxBytes int
+}
+
+// NewFileMemory returns a memory stored at path for the project in dir. The facts are capped
+// at maxBytes in total, 0 meaning DefaultMemoryMaxBytes.
+func NewFileMemory(path, dir string, maxBytes int) *FileMemory {
+	if maxBytes <= 0 {
+		maxBytes = DefaultMemoryMaxBytes
+	}
+	return &FileMemory{path: path, project: dir, maxBytes: maxBytes}
+}
+
+// MemoryPath returns where the memory of the project in dir lives: file if set, relative
+// to dir, and otherwise a file under cacheHome named after the absolute path of dir.
+func MemoryPath(file, dir, cacheHome string) (string, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	if file = strings.TrimSpace(file); file != "" {
+		if filepath.IsAbs(file) {
+			return file, nil
+		}
+		return filepath.Join(abs, file), nil
+	}
+	sum := sha256.Sum256([]byte(abs))
+	return filepath.Join(cacheHome, memoryDir, hex.EncodeToString(sum[:8])+".md"), nil
+}
+
+func (m *FileMemory) Path() string {
+	return m.path
+}
+
+func (m *FileMemory) Facts() ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.read()
+}
+
+func (m *FileMemory) Remember(fact string) (MemoryResult, error) {
+	fact = strings.Join(strings.Fields(fact), " ")
+	if fact == "" {
+		return MemoryResult{}, errors.New("empty fact")
+	}
+	if len(fact) > MaxMemoryFactBytes {
+		return MemoryResult{}, fmt.Errorf("fact is too long (%d bytes, max %d)", len(fact), MaxMemoryFactBytes)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	facts, err := m.read()
+	if err != nil {
+		return MemoryResult{}, err
+	}
+
+	for _, f := range facts {
+		if strings.EqualFold(f, fact) {
+			return MemoryResult{Facts: len(facts)}, nil
+		}
+	}
+
+	facts = append(facts, fact)
+	res := MemoryResult{Added: true}
+	for len(facts) > 1 && factsSize(facts) > m.maxBytes {
+		facts = facts[1:]
+		res.Dropped++
+	}
+	res.Facts = len(facts)
+
+	return res, m.write(facts)
+}
+
+func (m *FileMemory) Clear() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := os.Remove(m.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (m *FileMemory) read() ([]string, error) {
+	b, err := os.ReadFile(m.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var facts []string
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	for sc.Scan() {
+		if fact, ok := strings.CutPrefix(strings.TrimSpace(sc.Text()), "- "); ok && strings.TrimSpace(fact) != "" {
+			facts = append(facts, strings.TrimSpace(fact))
+		}
+	}
+	return facts, sc.Err()
+}
+
+func (m *FileMemory) write(facts []string) error {
+	var b strings.Builder
+	_, _ = fmt.Fprintf(&b, "# Agent memory for %s\n\n", m.project)
+	for _, f := range facts {
+		_, _ = fmt.Fprintf(&b, "- %s\n", f)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(m.path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(m.path, []byte(b.String()), 0o644)
+}
+
+func factsSize(facts []string) int {
+	n := 0
+	for _, f := range facts {
+		n += len(f) + 1
+	}
+	return n
+}
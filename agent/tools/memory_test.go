@@ -0,0 +1,129 @@
+package tools_test
+
+import (
+	"github.com/kardolus/chatgpt-cli/agent/tools"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+)
+
+func TestUnitMemory(t *testing.T) {
+	spec.Run(t, "Testing the project memory", testMemory, spec.Report(report.Terminal{}))
+}
+
+func testMemory(t *testing.T, when spec.G, it spec.S) {
+	var (
+		dir  string
+		path string
+	)
+
+	it.Before(func() {
+		RegisterTestingT(t)
+		dir = t.TempDir()
+		path = filepath.Join(dir, "memory", "facts.md")
+	})
+
+	when("Remember()", func() {
+		it("stores facts in order and reads them back", func() {
+			mem := tools.NewFileMemory(path, "/work/project", 0)
+
+			res, err := mem.Remember("  tests run with   go test ./... ")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res).To(Equal(tools.MemoryResult{Added: true, Facts: 1}))
+
+			_, err = mem.Remember("lint with golangci-lint")
+			Expect(err).NotTo(HaveOccurred())
+
+			facts, err := tools.NewFileMemory(path, "/work/project", 0).Facts()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(facts).To(Equal([]string{"tests run with go test ./...", "lint with golangci-lint"}))
+
+			b, err := os.ReadFile(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(b)).To(HavePrefix("# Agent memory for /work/project\n\n- tests run with"))
+		})
+
+		it("does not store a fact twice", func() {
+			mem := tools.NewFileMemory(path, dir, 0)
+
+			_, err := mem.Remember("Build with make")
+			Expect(err).NotTo(HaveOccurred())
+			res, err := mem.Remember("build WITH make")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res).To(Equal(tools.MemoryResult{Facts: 1}))
+		})
+
+		it("forgets the oldest facts once over the size cap", func() {
+			mem := tools.NewFileMemory(path, dir, 25)
+
+			for _, f := range []string{"fact one", "fact two", "fact three"} {
+				_, err := mem.Remember(f)
+				Expect(err).NotTo(HaveOccurred())
+			}
+			res, err := mem.Remember("fact four")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res.Added).To(BeTrue())
+			Expect(res.Dropped).To(Equal(1))
+
+			facts, err := mem.Facts()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(facts).To(Equal([]string{"fact three", "fact four"}))
+		})
+
+		it("rejects empty and oversized facts", func() {
+			mem := tools.NewFileMemory(path, dir, 0)
+
+			_, err := mem.Remember("   ")
+			Expect(err).To(MatchError("empty fact"))
+
+			_, err = mem.Remember(strings.Repeat("x", tools.MaxMemoryFactBytes+1))
+			Expect(err).To(MatchError(ContainSubstring("fact is too long")))
+
+			_, err = os.Stat(path)
+			Expect(os.IsNotExist(err)).To(BeTrue())
+		})
+	})
+
+	when("Clear()", func() {
+		it("removes the memory and tolerates a missing file", func() {
+			mem := tools.NewFileMemory(path, dir, 0)
+			_, err := mem.Remember("fact")
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(mem.Clear()).To(Succeed())
+			Expect(mem.Clear()).To(Succeed())
+
+			facts, err := mem.Facts()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(facts).To(BeEmpty())
+		})
+	})
+
+	when("MemoryPath()", func() {
+		it("keeps a file per project under the cache home", func() {
+			a, err := tools.MemoryPath("", filepath.Join(dir, "a"), "/cache")
+			Expect(err).NotTo(HaveOccurred())
+			b, err := tools.MemoryPath("", filepath.Join(dir, "b"), "/cache")
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(filepath.Dir(a)).To(Equal(filepath.Join("/cache", "agent-memory")))
+			Expect(a).To(HaveSuffix(".md"))
+			Expect(a).NotTo(Equal(b))
+		})
+
+		it("resolves a configured file against the project", func() {
+			p, err := tools.MemoryPath(".agent/memory.md", dir, "/cache")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(p).To(Equal(filepath.Join(dir, ".agent", "memory.md")))
+
+			p, err = tools.MemoryPath("/abs/memory.md", dir, "/cache")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(p).To(Equal("/abs/memory.md"))
+		})
+	})
+}
@@ -11,6 +11,10 @@ const (
 	ToolShell ToolKind = "shell"
 	ToolLLM   ToolKind = "llm"
 	ToolFiles ToolKind = "file"
+	ToolHTTP  ToolKind = "http"
+
+	ToolMemory   ToolKind = "memory"
+	ToolDelegate ToolKind = "delegate"
 )
 
 type OutcomeKind string
@@ -21,10 +25,25 @@ const (
 	OutcomeError  OutcomeKind = "error"
 )
 
+// OnError says what plan mode does when a step still fails after its retries.
+type OnError string
+
+const (
+	OnErrorAbort    OnError = "abort"    // stop the run
+	OnErrorContinue OnError = "continue" // keep the failed result and run the remaining steps
+	OnErrorReplan   OnError = "replan"   // ask the planner to revise the remaining steps
+)
+
 type Config struct {
 	MaxSteps int
 	DryRun   bool
 	WorkDir  string
+
+	// MaxParallel is how many independent plan steps may run at once (<= 1 = one at a time)
+	MaxParallel int
+
+	// MaxReplans is how many times a failed plan may be revised (0 = never)
+	MaxReplans int
 }
 
 type Plan struct {
@@ -37,6 +56,17 @@ type Step struct {
 
 	Description string
 
+	// Plan mode: ID names the step for DependsOn and for .ByID in templates. A plan whose
+	// steps declare DependsOn runs them as soon as their dependencies are done instead of
+	// one after the other.
+	ID        string
+	DependsOn []string
+
+	// Plan mode: Retries is how many more times a failed step runs. OnError defaults to
+	// replanning while replans are left and to aborting otherwise.
+	Retries int
+	OnError OnError
+
 	// Shell
 	Command string
 	Args    []string
@@ -55,12 +85,45 @@ type Step struct {
 	Old string
 	New string
 	N   int
+
+	// For read: 1-based inclusive line range, 0 = from the start / to the end
+	StartLine int
+	EndLine   int
+
+	// For list: Glob filters entry names and Depth limits recursion (0 = 1 level).
+	// For search: Pattern is a regular expression, Glob filters file names.
+	Pattern string
+	Glob    string
+	Depth   int
+
+	// For move:
+	Dest string
+
+	// HTTP: Method defaults to GET
+	Method  string
+	URL     string
+	Headers map[string]string
+	Body    string
+
+	// Memory: a fact to remember about the project
+	Fact string
+
+	// Delegate: Goal is handed to a child agent running in AgentMode ("react" or "plan",
+	// default react). Tools narrows the tools the child may use; none means the same as
+	// the parent.
+	Goal      string
+	AgentMode string
+	Tools     []ToolKind
 }
 
 type ExecContext struct {
-	Goal    string
-	Plan    Plan
+	Goal string
+	Plan Plan
+
+	// Results holds the result of every finished step at its index in the plan, ByID the
+	// results of finished steps with an ID.
 	Results []StepResult
+	ByID    map[string]StepResult
 }
 
 type StepResult struct {
@@ -81,7 +144,7 @@ type Result struct {
 }
 
 type StepEffect struct {
-	Kind  string         // "file.write" | "file.patch" | "file.replace" | "shell.exec" | ...
+	Kind  string         // "file.write" | "file.patch" | "file.replace" | "file.move" | "shell.exec" | "http.request" | "memory.remember" | "agent.delegate" | ...
 	Path  string         // for file ops
 	Bytes int            // for writes (optional)
 	Meta  map[string]any // extra stats, like hunks, replaced count, exit code, etc.
@@ -89,6 +152,14 @@ type StepEffect struct {
 
 type Effects []StepEffect
 
+// PriorRun is an earlier agent run in the same conversation. Effects holds one short line
+// per side effect, e.g. "file.write main.go".
+type PriorRun struct {
+	Goal    string
+	Answer  string
+	Effects []string
+}
+
 func (e Effects) HasKind(kind string) bool {
 	for _, eff := range e {
 		if eff.Kind == kind {
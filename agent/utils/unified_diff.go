@@ -123,11 +123,11 @@ func ParseUnifiedDiff(unified []byte) ([]diffHunk, error) {
 		lineNo++
 		line := sc.Bytes() // no trailing '\n'
 
-		// Ignore common non-hunk headers.
-		if bytes.HasPrefix(line, []byte("diff ")) ||
+		// Ignore common non-hunk headers. Inside a hunk, "--- x" is a removed "-- x" line.
+		if cur == nil && (bytes.HasPrefix(line, []byte("diff ")) ||
 			bytes.HasPrefix(line, []byte("index ")) ||
 			bytes.HasPrefix(line, []byte("--- ")) ||
-			bytes.HasPrefix(line, []byte("+++ ")) {
+			bytes.HasPrefix(line, []byte("+++ "))) {
 			continue
 		}
 
@@ -40,6 +40,21 @@ func testUnifiedDiff(t *testing.T, when spec.G, it spec.S) {
 			Expect(string(out)).To(Equal("a\nx\nb\n"))
 		})
 
+		it("treats '--- ' inside a hunk as a removed line, not a header", func() {
+			orig := []byte("-- comment\nselect 1;\n")
+			diff := []byte(
+				"--- a/q.sql\n" +
+					"+++ b/q.sql\n" +
+					"@@ -1,2 +1,1 @@\n" +
+					"--- comment\n" +
+					" select 1;\n",
+			)
+
+			out, err := utils.ApplyUnifiedDiff(orig, diff)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(out)).To(Equal("select 1;\n"))
+		})
+
 		it("errors on context mismatch", func() {
 			orig := []byte("a\nc\n")
 			diff := []byte(
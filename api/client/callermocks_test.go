@@ -5,6 +5,7 @@
 package client_test
 
 import (
+	context "context"
 	reflect "reflect"
 
 	gomock "github.com/golang/mock/gomock"
@@ -93,3 +94,34 @@ func (mr *MockCallerMockRecorder) PostWithHeadersResponse(arg0, arg1, arg2 inter
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PostWithHeadersResponse", reflect.TypeOf((*MockCaller)(nil).PostWithHeadersResponse), arg0, arg1, arg2)
 }
+
+// Request mocks base method.
+func (m *MockCaller) Request(arg0 context.Context, arg1, arg2 string, arg3 []byte, arg4 map[string]string, arg5 int64) (api.HTTPResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Request", arg0, arg1, arg2, arg3, arg4, arg5)
+	ret0, _ := ret[0].(api.HTTPResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Request indicates an expected call of Request.
+func (mr *MockCallerMockRecorder) Request(arg0, arg1, arg2, arg3, arg4, arg5 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Request", reflect.TypeOf((*MockCaller)(nil).Request), arg0, arg1, arg2, arg3, arg4, arg5)
+}
+
+// StreamResponse mocks base method.
+func (m *MockCaller) StreamResponse(arg0 string, arg1 []byte) ([]byte, api.TokenUsage, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "StreamResponse", arg0, arg1)
+	ret0, _ := ret[0].([]byte)
+	ret1, _ := ret[1].(api.TokenUsage)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// StreamResponse indicates an expected call of StreamResponse.
+func (mr *MockCallerMockRecorder) StreamResponse(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StreamResponse", reflect.TypeOf((*MockCaller)(nil).StreamResponse), arg0, arg1)
+}
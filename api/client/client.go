@@ -5,6 +5,7 @@ import (
 	"github.com/kardolus/chatgpt-cli/config"
 	"github.com/kardolus/chatgpt-cli/history"
 	"github.com/kardolus/chatgpt-cli/internal/fsio"
+	"github.com/kardolus/chatgpt-cli/internal/usage"
 	"time"
 )
 
@@ -34,6 +35,7 @@ type Client struct {
 	timer        Timer
 	reader       fsio.Reader
 	writer       fsio.Writer
+	onUsage      []func(usage.Record)
 }
 
 func New(callerFactory http.CallerFactory, hs history.Store, t Timer, r fsio.Reader, w fsio.Writer, cfg config.Config) *Client {
@@ -63,3 +65,11 @@ func (c *Client) WithTransport(transport MCPTransport) *Client {
 	c.transport = transport
 	return c
 }
+
+// OnUsage adds a function that is told the tokens and cost of every request, e.g. to keep
+// them in a ledger, until the returned function removes it.
+func (c *Client) OnUsage(f func(usage.Record)) (remove func()) {
+	c.onUsage = append(c.onUsage, f)
+	i := len(c.onUsage) - 1
+	return func() { c.onUsage[i] = nil }
+}
@@ -71,6 +71,7 @@ func testClient(t *testing.T, when spec.G, it spec.S) {
 	testMedia(t, when, it)
 	testLLM(t, when, it)
 	testCapabilities(t, when, it)
+	testRealtime(t, when, it)
 }
 
 func newClientFactory(mhs *MockStore) *clientFactory {
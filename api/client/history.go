@@ -10,6 +10,10 @@ import (
 const (
 	MaxTokenBufferPercentage = 20
 	SystemRole               = "system"
+
+	// mediaPartTokens is a rough token cost for an image or audio part, roughly what a
+	// high-detail 1024x1024 image costs.
+	mediaPartTokens = 765
 )
 
 // ProvideContext adds custom context to the client's history by converting the
@@ -25,6 +29,84 @@ func (c *Client) ProvideContext(context string) {
 	c.History = append(c.History, historyEntries...)
 }
 
+// ProvideFileContext adds each block as a single user message. Unlike ProvideContext
+// the text is kept verbatim, so file contents keep their line breaks and indentation.
+func (c *Client) ProvideFileContext(blocks []string) {
+	c.initHistory()
+	for _, block := range blocks {
+		c.History = append(c.History, history.History{
+			Message: api.Message{
+				Role:    UserRole,
+				Content: block,
+			},
+			Timestamp: c.timer.Now(),
+		})
+	}
+}
+
+// SwitchThread points the client at a different thread. The in-memory history is
+// dropped so that the next query loads the target thread from the store.
+func (c *Client) SwitchThread(thread string) {
+	c.Config.Thread = thread
+	c.historyStore.SetThread(thread)
+	c.History = nil
+}
+
+// SetRole replaces the system role for the rest of the session.
+func (c *Client) SetRole(role string) {
+	c.Config.Role = role
+	if len(c.History) > 0 {
+		c.History[0].Content = role
+	}
+}
+
+// DropLastExchange removes the most recent user query and any assistant replies
+// that followed it, persists the result and returns the removed query. It
+// returns false when the thread has no user query to drop.
+func (c *Client) DropLastExchange() (string, bool) {
+	c.initHistory()
+
+	i := len(c.History) - 1
+	for i > 0 && c.History[i].Role != UserRole {
+		i--
+	}
+	if i <= 0 {
+		return "", false
+	}
+
+	query := api.ContentText(c.History[i].Content)
+	c.History = c.History[:i]
+
+	if !c.Config.OmitHistory {
+		_ = c.historyStore.Write(c.History)
+	}
+
+	return query, true
+}
+
+// LastResponse returns the most recent assistant message in the current thread.
+func (c *Client) LastResponse() (string, bool) {
+	c.initHistory()
+
+	for i := len(c.History) - 1; i > 0; i-- {
+		if c.History[i].Role != AssistantRole {
+			continue
+		}
+		if s, ok := c.History[i].Content.(string); ok {
+			return s, true
+		}
+	}
+	return "", false
+}
+
+// HistoryTokens returns the approximate token count of the current thread, as used
+// for sliding-window truncation.
+func (c *Client) HistoryTokens() int {
+	c.initHistory()
+	tokens, _ := countTokens(c.History)
+	return tokens
+}
+
 func (c *Client) createHistoryEntriesFromString(input string) []history.History {
 	var result []history.History
 
@@ -95,13 +177,14 @@ func (c *Client) truncateHistory() {
 	c.History = append(c.History[:1], c.History[index+1:]...)
 }
 
-func (c *Client) updateHistory(response string) {
+func (c *Client) updateHistory(response string, tokens int) {
 	c.History = append(c.History, history.History{
 		Message: api.Message{
 			Role:    AssistantRole,
 			Content: response,
 		},
 		Timestamp: c.timer.Now(),
+		Tokens:    tokens,
 	})
 
 	if !c.Config.OmitHistory {
@@ -109,6 +192,34 @@ func (c *Client) updateHistory(response string) {
 	}
 }
 
+// recordExchange adds a query and its outcome to the history for requests that don't go
+// through the chat endpoint, such as transcriptions and images, so --show-history lists them.
+func (c *Client) recordExchange(query, response string) {
+	c.initHistory()
+
+	c.History = append(c.History, history.History{
+		Message: api.Message{
+			Role:    UserRole,
+			Content: query,
+		},
+		Timestamp: c.timer.Now(),
+	})
+
+	c.History = append(c.History, history.History{
+		Message: api.Message{
+			Role:    AssistantRole,
+			Content: response,
+		},
+		Timestamp: c.timer.Now(),
+	})
+
+	c.truncateHistory()
+
+	if !c.Config.OmitHistory {
+		_ = c.historyStore.Write(c.History)
+	}
+}
+
 func calculateEffectiveContextWindow(window int, bufferPercentage int) int {
 	adjustedPercentage := 100 - bufferPercentage
 	effectiveContextWindow := (window * adjustedPercentage) / 100
@@ -121,7 +232,7 @@ func countTokens(entries []history.History) (int, []int) {
 
 	for _, entry := range entries {
 		charCount, wordCount := 0, 0
-		words := strings.Fields(entry.Content.(string))
+		words := strings.Fields(api.ContentText(entry.Content))
 		wordCount += len(words)
 
 		for _, word := range words {
@@ -131,6 +242,13 @@ func countTokens(entries []history.History) (int, []int) {
 		// This is a simple approximation; actual token count may differ.
 		// You can adjust this based on your language and the specific tokenizer used by the model.
 		tokenCountForMessage := (charCount + wordCount) / 2
+		if parts, ok := api.ContentParts(entry.Content); ok {
+			for _, part := range parts {
+				if part.Type != api.TextPartType {
+					tokenCountForMessage += mediaPartTokens
+				}
+			}
+		}
 		result += tokenCountForMessage
 		rolling = append(rolling, tokenCountForMessage)
 	}
@@ -66,5 +66,108 @@ func testHistory(t *testing.T, when spec.G, it spec.S) {
 				Expect(contextMessage.Content).To(Equal(chatContext))
 			})
 		})
+
+		when("ProvideFileContext()", func() {
+			it("adds every block verbatim as its own user message", func() {
+				subject := factory.buildClientWithoutConfig()
+
+				mockHistoryStore.EXPECT().Read().Return(nil, nil).Times(1)
+				mockTimer.EXPECT().Now().Return(time.Time{}).AnyTimes()
+
+				blocks := []string{
+					"<file path=\"a.go\">\nfunc a() {\n\treturn\n}\n</file>",
+					"<file path=\"b.txt\">\nb\n</file>",
+				}
+				subject.ProvideFileContext(blocks)
+
+				Expect(subject.History).To(HaveLen(3))
+				Expect(subject.History[1].Role).To(Equal(client.UserRole))
+				Expect(subject.History[1].Content).To(Equal(blocks[0]))
+				Expect(subject.History[2].Content).To(Equal(blocks[1]))
+			})
+		})
+
+		when("SwitchThread()", func() {
+			it("updates the store and drops the in-memory history", func() {
+				subject := factory.buildClientWithoutConfig()
+				subject.History = []history.History{{Message: api.Message{Role: client.SystemRole}}}
+
+				mockHistoryStore.EXPECT().SetThread("other").Times(1)
+
+				subject.SwitchThread("other")
+
+				Expect(subject.Config.Thread).To(Equal("other"))
+				Expect(subject.History).To(BeNil())
+			})
+		})
+
+		when("SetRole()", func() {
+			it("updates the config and the system message", func() {
+				subject := factory.buildClientWithoutConfig()
+				subject.History = []history.History{{Message: api.Message{Role: client.SystemRole, Content: "old"}}}
+
+				subject.SetRole("new")
+
+				Expect(subject.Config.Role).To(Equal("new"))
+				Expect(subject.History[0].Content).To(Equal("new"))
+			})
+		})
+
+		when("LastResponse()", func() {
+			it("returns the most recent assistant message", func() {
+				subject := factory.buildClientWithoutConfig()
+				subject.History = []history.History{
+					{Message: api.Message{Role: client.SystemRole, Content: "role"}},
+					{Message: api.Message{Role: client.UserRole, Content: "q1"}},
+					{Message: api.Message{Role: client.AssistantRole, Content: "a1"}},
+					{Message: api.Message{Role: client.UserRole, Content: "q2"}},
+				}
+
+				response, ok := subject.LastResponse()
+				Expect(ok).To(BeTrue())
+				Expect(response).To(Equal("a1"))
+			})
+
+			it("returns false for a thread without answers", func() {
+				subject := factory.buildClientWithoutConfig()
+				subject.History = []history.History{
+					{Message: api.Message{Role: client.SystemRole, Content: "role"}},
+				}
+
+				_, ok := subject.LastResponse()
+				Expect(ok).To(BeFalse())
+			})
+		})
+
+		when("DropLastExchange()", func() {
+			it("removes the last query with its replies and persists the result", func() {
+				subject := factory.buildClientWithoutConfig()
+				subject.History = []history.History{
+					{Message: api.Message{Role: client.SystemRole, Content: "role"}},
+					{Message: api.Message{Role: client.UserRole, Content: "first"}},
+					{Message: api.Message{Role: client.AssistantRole, Content: "one"}},
+					{Message: api.Message{Role: client.UserRole, Content: "second"}},
+					{Message: api.Message{Role: client.AssistantRole, Content: "two"}},
+				}
+
+				mockHistoryStore.EXPECT().Write(subject.History[:3]).Return(nil).Times(1)
+
+				query, ok := subject.DropLastExchange()
+				Expect(ok).To(BeTrue())
+				Expect(query).To(Equal("second"))
+				Expect(subject.History).To(HaveLen(3))
+			})
+
+			it("returns false when there is no query to drop", func() {
+				subject := factory.buildClientWithoutConfig()
+				subject.History = []history.History{
+					{Message: api.Message{Role: client.SystemRole, Content: "role"}},
+				}
+
+				_, ok := subject.DropLastExchange()
+				Expect(ok).To(BeFalse())
+				Expect(subject.History).To(HaveLen(1))
+			})
+		})
 	})
 }
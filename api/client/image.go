@@ -0,0 +1,272 @@
+package client
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/kardolus/chatgpt-cli/api"
+	"github.com/kardolus/chatgpt-cli/internal"
+	"io"
+	"mime/multipart"
+	"net/textproto"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// GenerateImage sends a prompt to the configured image generation model (e.g., gpt-image-1)
+// and writes the resulting image to the specified output path.
+//
+// The method performs the following steps:
+//  1. Sends a POST request to the image generation endpoint with the provided prompt and the
+//     size, quality, n, background and output_format set in the image config.
+//  2. Parses the response and extracts the base64-encoded images.
+//  3. Decodes the image bytes and writes them to the given outputPath. When more than one image
+//     is returned they are numbered: out-1.png, out-2.png and so on.
+//  4. Records the prompt and the written files in the thread history.
+//
+// Parameters:
+//   - inputText: The prompt describing the image to be generated.
+//   - outputPath: The file path where the generated image (e.g., .png) will be saved.
+//
+// Returns:
+//   - An error if any part of the request, decoding, or file writing fails.
+func (c *Client) GenerateImage(inputText, outputPath string) error {
+	req := api.Draw{
+		Model:        c.Config.Model,
+		Prompt:       inputText,
+		Size:         c.Config.Image.Size,
+		Quality:      c.Config.Image.Quality,
+		N:            c.Config.Image.N,
+		Background:   c.Config.Image.Background,
+		OutputFormat: c.Config.Image.OutputFormat,
+	}
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	endpoint := c.getEndpoint(c.Config.ImageGenerationsPath)
+	c.printRequestDebugInfo(endpoint, body, nil)
+
+	respBytes, err := c.Caller.Post(endpoint, body, false)
+	if err != nil {
+		return fmt.Errorf("API request failed: %w", err)
+	}
+
+	paths, err := c.writeImages(respBytes, outputPath)
+	if err != nil {
+		return err
+	}
+
+	c.recordExchange("[draw] "+inputText, savedImagesMessage(paths))
+	return nil
+}
+
+// EditImage edits one or more input images using a text prompt and writes the result to the specified output path.
+//
+// This method sends a multipart/form-data POST request to the image editing endpoint
+// (typically OpenAI's /v1/images/edits). The request includes:
+//   - The image files to edit or use as references; several are sent as image[].
+//   - An optional mask, a PNG whose fully transparent areas mark where the first image should be edited.
+//   - A text prompt describing how the image should be modified.
+//   - The model ID (e.g., gpt-image-1) and the size, quality, n, background and output_format
+//     set in the image config.
+//
+// The response is expected to contain base64-encoded images, which are decoded and written to the outputPath,
+// numbered when there is more than one. The prompt and the written files are recorded in the thread history.
+//
+// Parameters:
+//   - inputText: A text prompt describing the desired modifications to the image.
+//   - inputPaths: The file paths to the source images (must be a supported format: PNG, JPEG, or WebP).
+//   - maskPath: The file path to the mask, or an empty string for none.
+//   - outputPath: The file path where the edited image will be saved.
+//
+// Returns:
+//   - An error if any step of the process fails: reading the files, building the request, sending it,
+//     decoding the response, or writing the output image.
+//
+// Example:
+//
+//	err := client.EditImage("Add a rainbow in the sky", []string{"input.png"}, "", "output.png")
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+func (c *Client) EditImage(inputText string, inputPaths []string, maskPath, outputPath string) error {
+	endpoint := c.getEndpoint(c.Config.ImageEditsPath)
+
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+
+	field := "image"
+	if len(inputPaths) > 1 {
+		field = "image[]"
+	}
+	for _, inputPath := range inputPaths {
+		if err := c.addImagePart(writer, field, inputPath); err != nil {
+			return err
+		}
+	}
+
+	if maskPath != "" {
+		if err := c.addImagePart(writer, "mask", maskPath); err != nil {
+			return fmt.Errorf("mask: %w", err)
+		}
+	}
+
+	if err := writer.WriteField("prompt", inputText); err != nil {
+		return fmt.Errorf("failed to add prompt: %w", err)
+	}
+	if err := writer.WriteField("model", c.Config.Model); err != nil {
+		return fmt.Errorf("failed to add model: %w", err)
+	}
+
+	options := [][2]string{
+		{"size", c.Config.Image.Size},
+		{"quality", c.Config.Image.Quality},
+		{"background", c.Config.Image.Background},
+		{"output_format", c.Config.Image.OutputFormat},
+	}
+	if c.Config.Image.N > 0 {
+		options = append(options, [2]string{"n", strconv.Itoa(c.Config.Image.N)})
+	}
+	for _, option := range options {
+		if option[1] == "" {
+			continue
+		}
+		if err := writer.WriteField(option[0], option[1]); err != nil {
+			return fmt.Errorf("failed to add %s: %w", option[0], err)
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("failed to close multipart writer: %w", err)
+	}
+
+	c.printRequestDebugInfo(endpoint, buf.Bytes(), map[string]string{
+		"Content-Type": writer.FormDataContentType(),
+	})
+
+	respBytes, err := c.Caller.PostWithHeaders(endpoint, buf.Bytes(), map[string]string{
+		c.Config.AuthHeader:           fmt.Sprintf("%s %s", c.Config.AuthTokenPrefix, c.Config.APIKey),
+		internal.HeaderContentTypeKey: writer.FormDataContentType(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to edit image: %w", err)
+	}
+
+	paths, err := c.writeImages(respBytes, outputPath)
+	if err != nil {
+		return err
+	}
+
+	var names []string
+	for _, inputPath := range inputPaths {
+		names = append(names, filepath.Base(inputPath))
+	}
+	query := fmt.Sprintf("[edit %s] %s", strings.Join(names, ", "), inputText)
+	if maskPath != "" {
+		query = fmt.Sprintf("[edit %s, mask %s] %s", strings.Join(names, ", "), filepath.Base(maskPath), inputText)
+	}
+
+	c.recordExchange(query, savedImagesMessage(paths))
+	return nil
+}
+
+func (c *Client) addImagePart(writer *multipart.Writer, field, path string) error {
+	file, err := c.reader.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open input image: %w", err)
+	}
+	defer file.Close()
+
+	mimeType, err := c.getMimeTypeFromFileContent(path)
+	if err != nil {
+		return fmt.Errorf("failed to detect MIME type: %w", err)
+	}
+	if !strings.HasPrefix(mimeType, "image/") {
+		return fmt.Errorf("unsupported MIME type: %s", mimeType)
+	}
+
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`, field, filepath.Base(path)))
+	header.Set("Content-Type", mimeType)
+
+	part, err := writer.CreatePart(header)
+	if err != nil {
+		return fmt.Errorf("failed to create image part: %w", err)
+	}
+	if _, err := io.Copy(part, file); err != nil {
+		return fmt.Errorf("failed to copy image data: %w", err)
+	}
+	return nil
+}
+
+// writeImages decodes the base64 images of an images API response and writes them to
+// outputPath, numbering the files when there is more than one. It returns the paths written.
+func (c *Client) writeImages(respBytes []byte, outputPath string) ([]string, error) {
+	var response struct {
+		Data []struct {
+			B64 string `json:"b64_json"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(respBytes, &response); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	if len(response.Data) == 0 {
+		return nil, fmt.Errorf("no image data returned")
+	}
+
+	images := make([][]byte, len(response.Data))
+	for i, data := range response.Data {
+		decoded, err := base64.StdEncoding.DecodeString(data.B64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode base64 image: %w", err)
+		}
+		images[i] = decoded
+	}
+
+	var paths []string
+	for i, image := range images {
+		path := outputPath
+		if len(images) > 1 {
+			path = numberedPath(outputPath, i+1)
+		}
+
+		if err := c.writeImageFile(path, image); err != nil {
+			return paths, err
+		}
+		paths = append(paths, path)
+
+		c.printResponseDebugInfo([]byte(fmt.Sprintf("[image] %d bytes written to %s", len(image), path)))
+	}
+	return paths, nil
+}
+
+func (c *Client) writeImageFile(path string, data []byte) error {
+	outFile, err := c.writer.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %w", err)
+	}
+	defer outFile.Close()
+
+	if err := c.writer.Write(outFile, data); err != nil {
+		return fmt.Errorf("failed to write image: %w", err)
+	}
+	return nil
+}
+
+// numberedPath inserts the number before the extension: out.png becomes out-2.png.
+func numberedPath(path string, n int) string {
+	ext := filepath.Ext(path)
+	return fmt.Sprintf("%s-%d%s", strings.TrimSuffix(path, ext), n, ext)
+}
+
+func savedImagesMessage(paths []string) string {
+	if len(paths) == 1 {
+		return "Saved the image to " + paths[0]
+	}
+	return fmt.Sprintf("Saved %d images: %s", len(paths), strings.Join(paths, ", "))
+}
@@ -7,13 +7,14 @@ import (
 	"fmt"
 	"github.com/kardolus/chatgpt-cli/api"
 	"github.com/kardolus/chatgpt-cli/history"
+	"net/url"
 	"sort"
 	"strings"
 )
 
 const (
 	ErrEmptyResponse   = "empty response"
-	ErrRealTime        = "model %q requires the Realtime API (WebSocket/WebRTC) and is not supported yet"
+	ErrRealTime        = "model %q only works over the Realtime API, use it in a realtime session"
 	ErrWebSearch       = "model %q is not compatible with the web search feature"
 	SearchModelPattern = "-search"
 	gptPrefix          = "gpt"
@@ -23,6 +24,7 @@ const (
 	realTimePattern    = "realtime"
 	messageType        = "message"
 	outputTextType     = "output_text"
+	openAIHost         = "api.openai.com"
 )
 
 // ListModels retrieves a list of all available models from the OpenAI API.
@@ -85,8 +87,14 @@ func (c *Client) ListModels() ([]string, error) {
 //   - error: An error if the request fails or the response is invalid.
 func (c *Client) Query(ctx context.Context, input string) (string, int, error) {
 	c.prepareQuery(input)
+	if err := c.attachMedia(ctx); err != nil {
+		return "", 0, err
+	}
+	if err := c.checkCost(); err != nil {
+		return "", 0, err
+	}
 
-	body, err := c.createBody(ctx, false)
+	body, err := c.createBody(false)
 	if err != nil {
 		return "", 0, err
 	}
@@ -115,6 +123,7 @@ func (c *Client) Query(ctx context.Context, input string) (string, int, error) {
 			return "", 0, err
 		}
 		tokensUsed = res.Usage.TotalTokens
+		c.recordUsage(res.Usage)
 
 		for _, output := range res.Output {
 			if output.Type != messageType {
@@ -137,6 +146,7 @@ func (c *Client) Query(ctx context.Context, input string) (string, int, error) {
 			return "", 0, err
 		}
 		tokensUsed = res.Usage.TotalTokens
+		c.recordUsage(res.Usage.TokenUsage())
 
 		if len(res.Choices) == 0 {
 			return "", tokensUsed, errors.New("no responses returned")
@@ -149,45 +159,65 @@ func (c *Client) Query(ctx context.Context, input string) (string, int, error) {
 		}
 	}
 
-	c.updateHistory(response)
+	c.updateHistory(response, tokensUsed)
 
 	return response, tokensUsed, nil
 }
 
+// QueryWithoutHistory answers a single input at temperature 0 without reading or writing the
+// thread. It works on a copy of the client, so it can be called concurrently, e.g. by agent
+// steps running in parallel.
+func (c *Client) QueryWithoutHistory(ctx context.Context, input string) (string, int, error) {
+	isolated := *c
+	isolated.Config.OmitHistory = true
+	isolated.Config.Temperature = 0
+	isolated.History = nil
+
+	return isolated.Query(ctx, input)
+}
+
 // Stream sends a query to the API and processes the response as a stream.
 //
 // It takes a context `ctx` and an input string, constructs a request body, and makes a POST API call.
 // The context allows for request scoping, timeouts, and cancellation handling.
 //
-// The method creates a request body with the input and calls the API using the `Post` method.
-// The actual processing of the streamed response is handled inside the `Post` method.
+// The method creates a request body with the input and calls the API using the `StreamResponse` method.
+// The actual processing of the streamed response is handled inside the `StreamResponse` method.
 //
 // Parameters:
 //   - ctx: A context.Context that controls request cancellation and deadlines.
 //   - input: The query string to send to the API.
 //
 // Returns:
+//   - int: The total number of tokens used, or 0 when the API did not report usage at the end of the stream.
 //   - error: An error if the request fails or the response is invalid.
-func (c *Client) Stream(ctx context.Context, input string) error {
+func (c *Client) Stream(ctx context.Context, input string) (int, error) {
 	c.prepareQuery(input)
+	if err := c.attachMedia(ctx); err != nil {
+		return 0, err
+	}
+	if err := c.checkCost(); err != nil {
+		return 0, err
+	}
 
-	body, err := c.createBody(ctx, true)
+	body, err := c.createBody(true)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
 	endpoint := c.getChatEndpoint()
 
 	c.printRequestDebugInfo(endpoint, body, nil)
 
-	result, err := c.Caller.Post(endpoint, body, true)
+	result, usage, err := c.Caller.StreamResponse(endpoint, body)
 	if err != nil {
-		return err
+		return 0, err
 	}
+	c.recordUsage(usage)
 
-	c.updateHistory(string(result))
+	c.updateHistory(string(result), usage.TotalTokens)
 
-	return nil
+	return usage.TotalTokens, nil
 }
 
 func (c *Client) addQuery(query string) {
@@ -203,7 +233,7 @@ func (c *Client) addQuery(query string) {
 	c.truncateHistory()
 }
 
-func (c *Client) createBody(ctx context.Context, stream bool) ([]byte, error) {
+func (c *Client) createBody(stream bool) ([]byte, error) {
 	caps := GetCapabilities(c.Config.Model)
 
 	if caps.IsRealtime {
@@ -214,22 +244,22 @@ func (c *Client) createBody(ctx context.Context, stream bool) ([]byte, error) {
 		return nil, fmt.Errorf(ErrWebSearch, c.Config.Model)
 	}
 
-	if caps.UsesResponsesAPI || c.Config.Web {
-		req, err := c.createResponsesRequest(ctx, stream)
+	if c.usesResponsesAPI() {
+		req, err := c.createResponsesRequest(stream)
 		if err != nil {
 			return nil, err
 		}
 		return json.Marshal(req)
 	}
 
-	req, err := c.createCompletionsRequest(ctx, stream)
+	req, err := c.createCompletionsRequest(stream)
 	if err != nil {
 		return nil, err
 	}
 	return json.Marshal(req)
 }
 
-func (c *Client) createCompletionsRequest(ctx context.Context, stream bool) (*api.CompletionsRequest, error) {
+func (c *Client) createCompletionsRequest(stream bool) (*api.CompletionsRequest, error) {
 	var messages []api.Message
 	caps := GetCapabilities(c.Config.Model)
 
@@ -240,11 +270,6 @@ func (c *Client) createCompletionsRequest(ctx context.Context, stream bool) (*ap
 		messages = append(messages, item.Message)
 	}
 
-	messages, err := c.appendMediaMessages(ctx, messages)
-	if err != nil {
-		return nil, err
-	}
-
 	req := &api.CompletionsRequest{
 		Messages:         messages,
 		Model:            c.Config.Model,
@@ -254,6 +279,9 @@ func (c *Client) createCompletionsRequest(ctx context.Context, stream bool) (*ap
 		Seed:             c.Config.Seed,
 		Stream:           stream,
 	}
+	if stream && c.wantsStreamUsage() {
+		req.StreamOptions = &api.StreamOptions{IncludeUsage: true}
+	}
 
 	if caps.SupportsTemperature {
 		req.Temperature = c.Config.Temperature
@@ -265,7 +293,7 @@ func (c *Client) createCompletionsRequest(ctx context.Context, stream bool) (*ap
 	return req, nil
 }
 
-func (c *Client) createResponsesRequest(ctx context.Context, stream bool) (*api.ResponsesRequest, error) {
+func (c *Client) createResponsesRequest(stream bool) (*api.ResponsesRequest, error) {
 	var messages []api.Message
 	caps := GetCapabilities(c.Config.Model)
 
@@ -273,12 +301,11 @@ func (c *Client) createResponsesRequest(ctx context.Context, stream bool) (*api.
 		if caps.OmitFirstSystemMsg && index == 0 {
 			continue
 		}
-		messages = append(messages, item.Message)
-	}
-
-	messages, err := c.appendMediaMessages(ctx, messages)
-	if err != nil {
-		return nil, err
+		message := item.Message
+		if parts, ok := api.ContentParts(message.Content); ok {
+			message.Content = api.ToInputParts(parts)
+		}
+		messages = append(messages, message)
 	}
 
 	req := &api.ResponsesRequest{
@@ -308,6 +335,10 @@ func (c *Client) createResponsesRequest(ctx context.Context, stream bool) (*api.
 	return req, nil
 }
 
+func (c *Client) usesResponsesAPI() bool {
+	return GetCapabilities(c.Config.Model).UsesResponsesAPI || c.Config.Web
+}
+
 func (c *Client) getChatEndpoint() string {
 	caps := GetCapabilities(c.Config.Model)
 
@@ -347,6 +378,19 @@ func (c *Client) processResponse(raw []byte, v interface{}) error {
 	return nil
 }
 
+// wantsStreamUsage tells whether to ask for the usage of streamed completions. Not every
+// compatible server accepts stream_options, so by default only the OpenAI API is asked.
+func (c *Client) wantsStreamUsage() bool {
+	switch strings.ToLower(strings.TrimSpace(c.Config.StreamUsage)) {
+	case "on", "true":
+		return true
+	case "off", "false":
+		return false
+	}
+	u, err := url.Parse(c.Config.URL)
+	return err == nil && u.Hostname() == openAIHost
+}
+
 type ModelCapabilities struct {
 	SupportsTemperature bool
 	SupportsTopP        bool
@@ -2,16 +2,21 @@ package client_test
 
 import (
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/golang/mock/gomock"
 	"github.com/kardolus/chatgpt-cli/api"
 	"github.com/kardolus/chatgpt-cli/api/client"
+	config2 "github.com/kardolus/chatgpt-cli/config"
 	"github.com/kardolus/chatgpt-cli/history"
+	"github.com/kardolus/chatgpt-cli/internal"
+	"github.com/kardolus/chatgpt-cli/internal/usage"
 	"github.com/kardolus/chatgpt-cli/test"
 
 	. "github.com/onsi/gomega"
@@ -236,6 +241,7 @@ func testLLM(t *testing.T, when spec.G, it spec.S) {
 								Role:    client.AssistantRole,
 								Content: answer,
 							},
+							Tokens: tokens,
 						}))
 					}
 
@@ -529,6 +535,92 @@ func testLLM(t *testing.T, when spec.G, it spec.S) {
 				})
 			})
 
+			when("usage is observed", func() {
+				var cfg config2.Config
+
+				it.Before(func() {
+					cfg = MockConfig()
+					cfg.OmitHistory = true
+					cfg.Usage.Team = "search"
+					mockHistoryStore.EXPECT().Read().Times(0)
+				})
+
+				it("reports the tokens and cost of a request", func() {
+					cfg.Model = "gpt-4o"
+					subject := client.New(mockCallerFactory, mockHistoryStore, mockTimer, mockReader, mockWriter, cfg)
+
+					now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+					mockTimer.EXPECT().Now().Return(now).AnyTimes()
+					mockHistoryStore.EXPECT().GetThread().Return("mock-thread")
+					mockCaller.EXPECT().
+						Post(gomock.Any(), gomock.Any(), false).
+						Return([]byte(`{
+						  "choices": [{ "index": 0, "message": { "role": "assistant", "content": "ok" } }],
+						  "usage": {
+						    "prompt_tokens": 1000, "completion_tokens": 200, "total_tokens": 1200,
+						    "prompt_tokens_details": { "cached_tokens": 400 },
+						    "completion_tokens_details": { "reasoning_tokens": 50 }
+						  }
+						}`), nil)
+
+					var records []usage.Record
+					remove := subject.OnUsage(func(r usage.Record) { records = append(records, r) })
+
+					_, tokens, err := subject.Query(context.Background(), query)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(tokens).To(Equal(1200))
+
+					Expect(records).To(HaveLen(1))
+					Expect(records[0].Time).To(Equal(now))
+					Expect(records[0].Model).To(Equal("gpt-4o"))
+					Expect(records[0].Thread).To(Equal("mock-thread"))
+					Expect(records[0].Team).To(Equal("search"))
+					Expect(records[0].Tokens).To(Equal(usage.Tokens{Input: 1000, CachedInput: 400, Output: 200, Reasoning: 50}))
+					Expect(records[0].Priced).To(BeTrue())
+					Expect(records[0].CostUSD).To(BeNumerically("~", (600*2.5+400*1.25+200*10)/1e6, 1e-12))
+
+					remove()
+					mockCaller.EXPECT().Post(gomock.Any(), gomock.Any(), false).
+						Return([]byte(`{"choices": [{ "message": { "role": "assistant", "content": "ok" } }]}`), nil)
+					_, _, err = subject.Query(context.Background(), query)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(records).To(HaveLen(1))
+				})
+
+				it("refuses a request that could cost more than max_cost_usd", func() {
+					cfg.Model = "gpt-4"
+					cfg.MaxTokens = 10_000
+					cfg.MaxCostUSD = 0.5
+					subject := client.New(mockCallerFactory, mockHistoryStore, mockTimer, mockReader, mockWriter, cfg)
+
+					mockTimer.EXPECT().Now().Return(time.Time{}).AnyTimes()
+					mockCaller.EXPECT().Post(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+
+					_, _, err := subject.Query(context.Background(), query)
+					Expect(err).To(MatchError(ContainSubstring("over max_cost_usd ($0.5000)")))
+				})
+
+				it("refuses a request to a model without a price when max_cost_usd is set", func() {
+					cfg.Model = "llama3:70b"
+					cfg.MaxCostUSD = 1
+					subject := client.New(mockCallerFactory, mockHistoryStore, mockTimer, mockReader, mockWriter, cfg)
+
+					mockTimer.EXPECT().Now().Return(time.Time{}).AnyTimes()
+					mockCaller.EXPECT().Post(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+
+					_, _, err := subject.Query(context.Background(), query)
+					Expect(err).To(MatchError(fmt.Sprintf(client.ErrNoPrice, "llama3:70b")))
+
+					cfg.Usage.Prices = map[string]usage.Price{"llama3:70b": {Input: 0.1, Output: 0.1}}
+					subject = client.New(mockCallerFactory, mockHistoryStore, mockTimer, mockReader, mockWriter, cfg)
+					mockCaller.EXPECT().Post(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).
+						Return([]byte(`{"choices": [{ "message": { "role": "assistant", "content": "ok" } }]}`), nil)
+
+					_, _, err = subject.Query(context.Background(), query)
+					Expect(err).NotTo(HaveOccurred())
+				})
+			})
+
 			when("the model is o1-pro or gpt-5", func() {
 				models := []string{"o1-pro", "gpt-5"}
 
@@ -682,6 +774,226 @@ func testLLM(t *testing.T, when spec.G, it spec.S) {
 			})
 		})
 
+		when("Query() with media", func() {
+			const (
+				firstImage  = "https://example.com/first.png"
+				secondImage = "https://example.com/second.png"
+			)
+
+			var png = []byte("\x89PNG\r\n\x1a\n")
+
+			completion := func(text string) []byte {
+				raw, err := json.Marshal(api.CompletionsResponse{
+					Choices: []api.Choice{{Message: api.Message{Role: client.AssistantRole, Content: text}}},
+				})
+				Expect(err).NotTo(HaveOccurred())
+				return raw
+			}
+
+			it("sends the query and all images as parts of one user message and keeps them in the history", func() {
+				factory.withoutHistory()
+				subject := factory.buildClientWithoutConfig()
+				subject.Config.ContextWindow = 8192
+
+				mockTimer.EXPECT().Now().Return(time.Time{}).AnyTimes()
+
+				ctx := context.WithValue(context.Background(), internal.ImagePathKey, []string{firstImage, secondImage})
+				ctx = context.WithValue(ctx, internal.BinaryDataKey, png)
+
+				mockCaller.EXPECT().
+					Post(subject.Config.URL+subject.Config.CompletionsPath, gomock.Any(), false).
+					DoAndReturn(func(_ string, body []byte, _ bool) ([]byte, error) {
+						var req struct {
+							Messages []struct {
+								Role    string          `json:"role"`
+								Content json.RawMessage `json:"content"`
+							} `json:"messages"`
+						}
+						Expect(json.Unmarshal(body, &req)).To(Succeed())
+						Expect(req.Messages).To(HaveLen(2))
+						Expect(req.Messages[1].Role).To(Equal(client.UserRole))
+
+						var parts []api.ContentPart
+						Expect(json.Unmarshal(req.Messages[1].Content, &parts)).To(Succeed())
+						Expect(parts).To(HaveLen(4))
+						Expect(parts[0]).To(Equal(api.ContentPart{Type: api.TextPartType, Text: query}))
+						Expect(parts[1].Type).To(Equal(api.ImagePartType))
+						Expect(parts[1].ImageURL.URL).To(HavePrefix("data:image/png;base64,"))
+						Expect(parts[2].ImageURL.URL).To(Equal(firstImage))
+						Expect(parts[3].ImageURL.URL).To(Equal(secondImage))
+						return completion("two screenshots"), nil
+					})
+
+				mockHistoryStore.EXPECT().Write(gomock.Any()).DoAndReturn(func(h []history.History) error {
+					Expect(h).To(HaveLen(3))
+					parts, ok := api.ContentParts(h[1].Content)
+					Expect(ok).To(BeTrue())
+					Expect(parts).To(Equal([]api.ContentPart{
+						{Type: api.TextPartType, Text: query},
+						{Type: api.ImagePartType, ImageURL: &api.ImageURL{URL: "data:image/png;base64," + base64.StdEncoding.EncodeToString(png)}},
+						{Type: api.ImagePartType, ImageURL: &api.ImageURL{URL: firstImage}},
+						{Type: api.ImagePartType, ImageURL: &api.ImageURL{URL: secondImage}},
+					}))
+					return nil
+				})
+
+				_, _, err := subject.Query(ctx, query)
+				Expect(err).NotTo(HaveOccurred())
+
+				parts, _ := api.ContentParts(subject.History[1].Content)
+				Expect(parts[1].ImageURL.URL).To(HavePrefix("data:image/png;base64,"))
+			})
+
+			it("returns an error when the query that the media belongs to didn't fit", func() {
+				factory.withoutHistory()
+				subject := factory.buildClientWithoutConfig()
+
+				mockTimer.EXPECT().Now().Return(time.Time{}).AnyTimes()
+				mockCaller.EXPECT().Post(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+
+				ctx := context.WithValue(context.Background(), internal.ImagePathKey, firstImage)
+				_, _, err := subject.Query(ctx, strings.Repeat("too long ", 100))
+				Expect(err).To(MatchError(client.ErrNoMediaQuery))
+			})
+
+			when("a PDF is piped in", func() {
+				pdf := []byte("%PDF-1.4\n" +
+					"1 0 obj << /Type /Catalog /Pages 2 0 R >> endobj\n" +
+					"2 0 obj << /Type /Pages /Kids [3 0 R] /Count 1 >> endobj\n" +
+					"3 0 obj << /Type /Page /Parent 2 0 R /Contents 4 0 R >> endobj\n" +
+					"4 0 obj << /Length 34 >> stream\nBT (Payment due in 30 days) Tj ET\nendstream endobj\n" +
+					"%%EOF\n")
+
+				it("sends it as an input_file to Responses API models", func() {
+					factory.withoutHistory()
+					subject := factory.buildClientWithoutConfig()
+					subject.Config.Model = "gpt-5"
+					subject.Config.ContextWindow = 8192
+
+					mockTimer.EXPECT().Now().Return(time.Time{}).AnyTimes()
+					mockHistoryStore.EXPECT().Write(gomock.Any())
+
+					raw, _ := json.Marshal(api.ResponsesResponse{
+						Output: []api.Output{{
+							Type:    "message",
+							Content: []api.Content{{Type: "output_text", Text: "30 days"}},
+						}},
+					})
+
+					mockCaller.EXPECT().
+						Post(subject.Config.URL+subject.Config.ResponsesPath, gomock.Any(), false).
+						DoAndReturn(func(_ string, body []byte, _ bool) ([]byte, error) {
+							var req struct {
+								Input []struct {
+									Content json.RawMessage `json:"content"`
+								} `json:"input"`
+							}
+							Expect(json.Unmarshal(body, &req)).To(Succeed())
+
+							var parts []api.InputPart
+							Expect(json.Unmarshal(req.Input[1].Content, &parts)).To(Succeed())
+							Expect(parts).To(HaveLen(2))
+							Expect(parts[1].Type).To(Equal(api.InputFileType))
+							Expect(parts[1].Filename).To(Equal("input.pdf"))
+							Expect(parts[1].FileData).To(HavePrefix("data:application/pdf;base64,"))
+							return raw, nil
+						})
+
+					ctx := context.WithValue(context.Background(), internal.BinaryDataKey, pdf)
+					_, _, err := subject.Query(ctx, "when is payment due?")
+					Expect(err).NotTo(HaveOccurred())
+				})
+
+				it("sends the extracted text to Chat Completions models", func() {
+					factory.withoutHistory()
+					subject := factory.buildClientWithoutConfig()
+					subject.Config.ContextWindow = 8192
+
+					mockTimer.EXPECT().Now().Return(time.Time{}).AnyTimes()
+					mockHistoryStore.EXPECT().Write(gomock.Any())
+
+					mockCaller.EXPECT().
+						Post(subject.Config.URL+subject.Config.CompletionsPath, gomock.Any(), false).
+						DoAndReturn(func(_ string, body []byte, _ bool) ([]byte, error) {
+							var req struct {
+								Messages []struct {
+									Content json.RawMessage `json:"content"`
+								} `json:"messages"`
+							}
+							Expect(json.Unmarshal(body, &req)).To(Succeed())
+
+							var parts []api.ContentPart
+							Expect(json.Unmarshal(req.Messages[1].Content, &parts)).To(Succeed())
+							Expect(parts).To(HaveLen(2))
+							Expect(parts[1].Type).To(Equal(api.TextPartType))
+							Expect(parts[1].Text).To(Equal("<document type=\"application/pdf\">\nPayment due in 30 days\n</document>"))
+							return completion("30 days"), nil
+						})
+
+					ctx := context.WithValue(context.Background(), internal.BinaryDataKey, pdf)
+					_, _, err := subject.Query(ctx, "when is payment due?")
+					Expect(err).NotTo(HaveOccurred())
+				})
+			})
+
+			it("converts stored parts to input_text and input_image for the Responses API", func() {
+				stored := []interface{}{
+					map[string]interface{}{"type": "text", "text": "look at these"},
+					map[string]interface{}{"type": "image_url", "image_url": map[string]interface{}{"url": firstImage}},
+				}
+				factory.withHistory([]history.History{
+					{Message: api.Message{Role: client.SystemRole, Content: "role"}},
+					{Message: api.Message{Role: client.UserRole, Content: stored}},
+					{Message: api.Message{Role: client.AssistantRole, Content: "seen"}},
+				})
+				subject := factory.buildClientWithoutConfig()
+				subject.Config.Model = "gpt-5"
+				subject.Config.ContextWindow = 8192
+
+				mockTimer.EXPECT().Now().Return(time.Time{}).AnyTimes()
+				mockHistoryStore.EXPECT().Write(gomock.Any())
+
+				raw, _ := json.Marshal(api.ResponsesResponse{
+					Output: []api.Output{{
+						Type:    "message",
+						Content: []api.Content{{Type: "output_text", Text: "the second one"}},
+					}},
+				})
+
+				ctx := context.WithValue(context.Background(), internal.ImagePathKey, secondImage)
+
+				mockCaller.EXPECT().
+					Post(subject.Config.URL+subject.Config.ResponsesPath, gomock.Any(), false).
+					DoAndReturn(func(_ string, body []byte, _ bool) ([]byte, error) {
+						var req struct {
+							Input []struct {
+								Role    string          `json:"role"`
+								Content json.RawMessage `json:"content"`
+							} `json:"input"`
+						}
+						Expect(json.Unmarshal(body, &req)).To(Succeed())
+						Expect(req.Input).To(HaveLen(4))
+
+						var earlier, current []api.InputPart
+						Expect(json.Unmarshal(req.Input[1].Content, &earlier)).To(Succeed())
+						Expect(json.Unmarshal(req.Input[3].Content, &current)).To(Succeed())
+
+						Expect(earlier).To(Equal([]api.InputPart{
+							{Type: api.InputTextType, Text: "look at these"},
+							{Type: api.InputImageType, ImageURL: firstImage},
+						}))
+						Expect(current).To(Equal([]api.InputPart{
+							{Type: api.InputTextType, Text: "which one?"},
+							{Type: api.InputImageType, ImageURL: secondImage},
+						}))
+						return raw, nil
+					})
+
+				_, _, err := subject.Query(ctx, "which one?")
+				Expect(err).NotTo(HaveOccurred())
+			})
+		})
+
 		when("Stream()", func() {
 			var (
 				body     []byte
@@ -699,12 +1011,12 @@ func testLLM(t *testing.T, when spec.G, it spec.S) {
 
 				errorMsg := "error message"
 				mockCaller.EXPECT().
-					Post(subject.Config.URL+subject.Config.CompletionsPath, body, true).
-					Return(nil, errors.New(errorMsg))
+					StreamResponse(subject.Config.URL+subject.Config.CompletionsPath, body).
+					Return(nil, api.TokenUsage{}, errors.New(errorMsg))
 
 				mockTimer.EXPECT().Now().Return(time.Time{}).Times(2)
 
-				err := subject.Stream(context.Background(), query)
+				_, err := subject.Stream(context.Background(), query)
 				Expect(err).To(HaveOccurred())
 				Expect(err.Error()).To(Equal(errorMsg))
 			})
@@ -718,16 +1030,83 @@ func testLLM(t *testing.T, when spec.G, it spec.S) {
 				config.Model = realtimeModel
 
 				mockCaller.EXPECT().
-					Post(gomock.Any(), gomock.Any(), gomock.Any()).
+					StreamResponse(gomock.Any(), gomock.Any()).
 					Times(0)
 
 				mockTimer.EXPECT().Now().Return(time.Time{}).Times(2)
 
-				err := subject.Stream(context.Background(), query)
+				_, err := subject.Stream(context.Background(), query)
 				Expect(err).To(HaveOccurred())
 				Expect(err.Error()).To(ContainSubstring("realtime"))
 			})
 
+			it("reports the usage sent at the end of the stream", func() {
+				cfg := MockConfig()
+				cfg.OmitHistory = true
+				cfg.Model = "gpt-4o"
+				cfg.URL = "https://api.openai.com"
+				subject := client.New(mockCallerFactory, mockHistoryStore, mockTimer, mockReader, mockWriter, cfg)
+
+				var streamUsage api.TokenUsage
+				streamUsage.InputTokens = 1000
+				streamUsage.OutputTokens = 100
+				streamUsage.TotalTokens = 1100
+
+				mockTimer.EXPECT().Now().Return(time.Time{}).AnyTimes()
+				mockHistoryStore.EXPECT().GetThread().Return("")
+				mockCaller.EXPECT().
+					StreamResponse(gomock.Any(), gomock.Any()).
+					DoAndReturn(func(_ string, body []byte) ([]byte, api.TokenUsage, error) {
+						var req api.CompletionsRequest
+						Expect(json.Unmarshal(body, &req)).To(Succeed())
+						Expect(req.StreamOptions).To(Equal(&api.StreamOptions{IncludeUsage: true}))
+						return []byte("ok"), streamUsage, nil
+					})
+
+				var records []usage.Record
+				subject.OnUsage(func(r usage.Record) { records = append(records, r) })
+
+				tokens, err := subject.Stream(context.Background(), query)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(tokens).To(Equal(1100))
+				Expect(records).To(HaveLen(1))
+				Expect(records[0].Thread).To(Equal("mock-thread"))
+				Expect(records[0].Tokens).To(Equal(usage.Tokens{Input: 1000, Output: 100}))
+				Expect(records[0].CostUSD).To(BeNumerically("~", (1000*2.5+100*10)/1e6, 1e-12))
+			})
+
+			it("asks other servers for the stream usage only when stream_usage is on", func() {
+				for _, tc := range []struct {
+					url, setting string
+					want         bool
+				}{
+					{"https://api.mock-openai.com", "", false},
+					{"https://api.mock-openai.com", "auto", false},
+					{"https://api.mock-openai.com", "on", true},
+					{"https://api.openai.com", "", true},
+					{"https://api.openai.com", "off", false},
+				} {
+					cfg := MockConfig()
+					cfg.OmitHistory = true
+					cfg.URL = tc.url
+					cfg.StreamUsage = tc.setting
+					subject := client.New(mockCallerFactory, mockHistoryStore, mockTimer, mockReader, mockWriter, cfg)
+
+					mockTimer.EXPECT().Now().Return(time.Time{}).AnyTimes()
+					mockCaller.EXPECT().
+						StreamResponse(gomock.Any(), gomock.Any()).
+						DoAndReturn(func(_ string, body []byte) ([]byte, api.TokenUsage, error) {
+							var req api.CompletionsRequest
+							Expect(json.Unmarshal(body, &req)).To(Succeed())
+							Expect(req.StreamOptions != nil).To(Equal(tc.want), tc.url+" "+tc.setting)
+							return []byte("ok"), api.TokenUsage{}, nil
+						})
+
+					_, err := subject.Stream(context.Background(), query)
+					Expect(err).NotTo(HaveOccurred())
+				}
+			})
+
 			when("a valid http response is received", func() {
 				const answer = "answer"
 
@@ -736,9 +1115,14 @@ func testLLM(t *testing.T, when spec.G, it spec.S) {
 					body, err = createBody(messages, true)
 					Expect(err).NotTo(HaveOccurred())
 
+					var usage api.TokenUsage
+					usage.InputTokens = 10
+					usage.OutputTokens = 2
+					usage.TotalTokens = 12
+
 					mockCaller.EXPECT().
-						Post(subject.Config.URL+subject.Config.CompletionsPath, expectedBody, true).
-						Return([]byte(answer), nil)
+						StreamResponse(subject.Config.URL+subject.Config.CompletionsPath, expectedBody).
+						Return([]byte(answer), usage, nil)
 
 					mockTimer.EXPECT().Now().Return(time.Time{}).AnyTimes()
 
@@ -754,10 +1138,12 @@ func testLLM(t *testing.T, when spec.G, it spec.S) {
 							Role:    client.AssistantRole,
 							Content: answer,
 						},
+						Tokens: 12,
 					}))
 
-					err := subject.Stream(context.Background(), query)
+					tokens, err := subject.Stream(context.Background(), query)
 					Expect(err).NotTo(HaveOccurred())
+					Expect(tokens).To(Equal(12))
 				}
 
 				it("returns the expected result for an empty history", func() {
@@ -1,18 +1,14 @@
 package client
 
 import (
-	"bytes"
 	"context"
 	"encoding/base64"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/kardolus/chatgpt-cli/api"
-	"github.com/kardolus/chatgpt-cli/history"
 	"github.com/kardolus/chatgpt-cli/internal"
-	"io"
-	"mime/multipart"
+	"github.com/kardolus/chatgpt-cli/internal/document"
 	stdhttp "net/http"
-	"net/textproto"
 	"net/url"
 	"path/filepath"
 	"strings"
@@ -22,307 +18,77 @@ const (
 	audioType    = "input_audio"
 	imageContent = "data:%s;base64,%s"
 	imageURLType = "image_url"
+	pipedPDFName = "input.pdf"
 	httpScheme   = "http"
 	httpsScheme  = "https"
-)
-
-// EditImage edits an input image using a text prompt and writes the modified image to the specified output path.
-//
-// This method sends a multipart/form-data POST request to the image editing endpoint
-// (typically OpenAI's /v1/images/edits). The request includes:
-//   - The image file to edit.
-//   - A text prompt describing how the image should be modified.
-//   - The model ID (e.g., gpt-image-1).
-//
-// The response is expected to contain a base64-encoded image, which is decoded and written to the outputPath.
-//
-// Parameters:
-//   - inputText: A text prompt describing the desired modifications to the image.
-//   - inputPath: The file path to the source image (must be a supported format: PNG, JPEG, or WebP).
-//   - outputPath: The file path where the edited image will be saved.
-//
-// Returns:
-//   - An error if any step of the process fails: reading the file, building the request, sending it,
-//     decoding the response, or writing the output image.
-//
-// Example:
-//
-//	err := client.EditImage("Add a rainbow in the sky", "input.png", "output.png")
-//	if err != nil {
-//	    log.Fatal(err)
-//	}
-func (c *Client) EditImage(inputText, inputPath, outputPath string) error {
-	endpoint := c.getEndpoint(c.Config.ImageEditsPath)
-
-	file, err := c.reader.Open(inputPath)
-	if err != nil {
-		return fmt.Errorf("failed to open input image: %w", err)
-	}
-	defer file.Close()
-
-	var buf bytes.Buffer
-	writer := multipart.NewWriter(&buf)
-
-	mimeType, err := c.getMimeTypeFromFileContent(inputPath)
-	if err != nil {
-		return fmt.Errorf("failed to detect MIME type: %w", err)
-	}
-	if !strings.HasPrefix(mimeType, "image/") {
-		return fmt.Errorf("unsupported MIME type: %s", mimeType)
-	}
-
-	header := make(textproto.MIMEHeader)
-	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="image"; filename="%s"`, filepath.Base(inputPath)))
-	header.Set("Content-Type", mimeType)
-
-	part, err := writer.CreatePart(header)
-	if err != nil {
-		return fmt.Errorf("failed to create image part: %w", err)
-	}
-	if _, err := io.Copy(part, file); err != nil {
-		return fmt.Errorf("failed to copy image data: %w", err)
-	}
-
-	if err := writer.WriteField("prompt", inputText); err != nil {
-		return fmt.Errorf("failed to add prompt: %w", err)
-	}
-	if err := writer.WriteField("model", c.Config.Model); err != nil {
-		return fmt.Errorf("failed to add model: %w", err)
-	}
-
-	if err := writer.Close(); err != nil {
-		return fmt.Errorf("failed to close multipart writer: %w", err)
-	}
-
-	c.printRequestDebugInfo(endpoint, buf.Bytes(), map[string]string{
-		"Content-Type": writer.FormDataContentType(),
-	})
-
-	respBytes, err := c.Caller.PostWithHeaders(endpoint, buf.Bytes(), map[string]string{
-		c.Config.AuthHeader:           fmt.Sprintf("%s %s", c.Config.AuthTokenPrefix, c.Config.APIKey),
-		internal.HeaderContentTypeKey: writer.FormDataContentType(),
-	})
-	if err != nil {
-		return fmt.Errorf("failed to edit image: %w", err)
-	}
 
-	// Parse the JSON and extract b64_json
-	var response struct {
-		Data []struct {
-			B64 string `json:"b64_json"`
-		} `json:"data"`
-	}
-	if err := json.Unmarshal(respBytes, &response); err != nil {
-		return fmt.Errorf("failed to decode response: %w", err)
-	}
-	if len(response.Data) == 0 {
-		return fmt.Errorf("no image data returned")
-	}
+	ErrNoMediaQuery = "there is no query to attach the media to, it may not fit in the context window"
+)
 
-	imgBytes, err := base64.StdEncoding.DecodeString(response.Data[0].B64)
-	if err != nil {
-		return fmt.Errorf("failed to decode base64 image: %w", err)
+// attachMedia turns the pending query into a multimodal message when the context
+// carries images, audio or piped binary data. The query text comes first, followed by
+// the media in the order given, and the result is kept in the history of the client so
+// follow-up questions in the same session can refer back to it.
+func (c *Client) attachMedia(ctx context.Context) error {
+	parts, err := c.mediaParts(ctx)
+	if err != nil || len(parts) == 0 {
+		return err
 	}
 
-	outFile, err := c.writer.Create(outputPath)
-	if err != nil {
-		return fmt.Errorf("failed to create output file: %w", err)
+	last := len(c.History) - 1
+	if last < 0 || c.History[last].Role != UserRole {
+		return errors.New(ErrNoMediaQuery)
 	}
-	defer outFile.Close()
 
-	if err := c.writer.Write(outFile, imgBytes); err != nil {
-		return fmt.Errorf("failed to write image: %w", err)
+	if text := api.ContentText(c.History[last].Content); text != "" {
+		parts = append([]api.ContentPart{{Type: api.TextPartType, Text: text}}, parts...)
 	}
+	c.History[last].Content = parts
 
-	c.printResponseDebugInfo([]byte(fmt.Sprintf("[image] %d bytes written to %s", len(imgBytes), outputPath)))
 	return nil
 }
 
-// GenerateImage sends a prompt to the configured image generation model (e.g., gpt-image-1)
-// and writes the resulting image to the specified output path.
-//
-// The method performs the following steps:
-//  1. Sends a POST request to the image generation endpoint with the provided prompt.
-//  2. Parses the response and extracts the base64-encoded image data.
-//  3. Decodes the image bytes and writes them to the given outputPath.
-//  4. Logs the number of bytes written using debug output.
-//
-// Parameters:
-//   - inputText: The prompt describing the image to be generated.
-//   - outputPath: The file path where the generated image (e.g., .png) will be saved.
-//
-// Returns:
-//   - An error if any part of the request, decoding, or file writing fails.
-func (c *Client) GenerateImage(inputText, outputPath string) error {
-	req := api.Draw{
-		Model:  c.Config.Model,
-		Prompt: inputText,
-	}
-
-	return c.postAndWriteBinaryOutput(
-		c.getEndpoint(c.Config.ImageGenerationsPath),
-		req,
-		outputPath,
-		"image",
-		func(respBytes []byte) ([]byte, error) {
-			var response struct {
-				Data []struct {
-					B64 string `json:"b64_json"`
-				} `json:"data"`
-			}
-			if err := json.Unmarshal(respBytes, &response); err != nil {
-				return nil, fmt.Errorf("failed to decode response: %w", err)
-			}
-			if len(response.Data) == 0 {
-				return nil, fmt.Errorf("no image data returned")
-			}
-			decoded, err := base64.StdEncoding.DecodeString(response.Data[0].B64)
-			if err != nil {
-				return nil, fmt.Errorf("failed to decode base64 image: %w", err)
-			}
-			return decoded, nil
-		},
-	)
-}
-
-// SynthesizeSpeech converts the given input text into speech using the configured TTS model,
-// and writes the resulting audio to the specified output file.
-//
-// The audio format is inferred from the output file's extension (e.g., "mp3", "wav") and sent
-// as the "response_format" in the request to the OpenAI speech synthesis endpoint.
-//
-// Parameters:
-//   - inputText: The text to synthesize into speech.
-//   - outputPath: The path to the output audio file. The file extension determines the response format.
-//
-// Returns an error if the request fails, the response cannot be written, or the file cannot be created.
-func (c *Client) SynthesizeSpeech(inputText, outputPath string) error {
-	req := api.Speech{
-		Model:          c.Config.Model,
-		Voice:          c.Config.Voice,
-		Input:          inputText,
-		ResponseFormat: getExtension(outputPath),
-	}
-	return c.postAndWriteBinaryOutput(c.getEndpoint(c.Config.SpeechPath), req, outputPath, "binary", nil)
-}
-
-// Transcribe uploads an audio file to the OpenAI transcription endpoint and returns the transcribed text.
-//
-// It reads the audio file from the provided `audioPath`, creates a multipart/form-data request with the model name
-// and the audio file, and sends it to the endpoint defined by the `TranscriptionsPath` in the client config.
-// The method expects a JSON response containing a "text" field with the transcription result.
-//
-// Parameters:
-//   - audioPath: The local file path to the audio file to be transcribed.
-//
-// Returns:
-//   - string: The transcribed text from the audio file.
-//   - error: An error if the file can't be read, the request fails, or the response is invalid.
-//
-// This method supports formats like mp3, mp4, mpeg, mpga, m4a, wav, and webm, depending on API compatibility.
-func (c *Client) Transcribe(audioPath string) (string, error) {
-	c.initHistory()
-
-	file, err := c.reader.Open(audioPath)
-	if err != nil {
-		return "", fmt.Errorf("failed to open audio file: %w", err)
-	}
-	defer file.Close()
-
-	var buf bytes.Buffer
-	writer := multipart.NewWriter(&buf)
-
-	_ = writer.WriteField("model", c.Config.Model)
-
-	part, err := writer.CreateFormFile("file", filepath.Base(audioPath))
-	if err != nil {
-		return "", err
-	}
-	if _, err := io.Copy(part, file); err != nil {
-		return "", err
-	}
-
-	if err := writer.Close(); err != nil {
-		return "", err
-	}
-
-	endpoint := c.getEndpoint(c.Config.TranscriptionsPath)
-	headers := map[string]string{
-		internal.HeaderContentTypeKey: writer.FormDataContentType(),
-		c.Config.AuthHeader:           fmt.Sprintf("%s %s", c.Config.AuthTokenPrefix, c.Config.APIKey),
-	}
-
-	c.printRequestDebugInfo(endpoint, buf.Bytes(), headers)
-
-	raw, err := c.Caller.PostWithHeaders(endpoint, buf.Bytes(), headers)
-	if err != nil {
-		return "", err
-	}
-
-	c.printResponseDebugInfo(raw)
+func (c *Client) mediaParts(ctx context.Context) ([]api.ContentPart, error) {
+	var parts []api.ContentPart
 
-	var res struct {
-		Text string `json:"text"`
-	}
-	if err := json.Unmarshal(raw, &res); err != nil {
-		return "", fmt.Errorf("failed to parse transcription: %w", err)
-	}
-
-	c.History = append(c.History, history.History{
-		Message: api.Message{
-			Role:    UserRole,
-			Content: fmt.Sprintf("[transcribe] %s", filepath.Base(audioPath)),
-		},
-		Timestamp: c.timer.Now(),
-	})
-
-	c.History = append(c.History, history.History{
-		Message: api.Message{
-			Role:    AssistantRole,
-			Content: res.Text,
-		},
-		Timestamp: c.timer.Now(),
-	})
-
-	c.truncateHistory()
-
-	if !c.Config.OmitHistory {
-		_ = c.historyStore.Write(c.History)
-	}
-
-	return res.Text, nil
-}
-
-func (c *Client) appendMediaMessages(ctx context.Context, messages []api.Message) ([]api.Message, error) {
 	if data, ok := ctx.Value(internal.BinaryDataKey).([]byte); ok {
-		content, err := c.createImageContentFromBinary(data)
+		part, err := c.createPartFromBinary(data)
 		if err != nil {
 			return nil, err
 		}
-		messages = append(messages, api.Message{
-			Role:    UserRole,
-			Content: []api.ImageContent{content},
-		})
-	} else if path, ok := ctx.Value(internal.ImagePathKey).(string); ok {
-		content, err := c.createImageContentFromURLOrFile(path)
+		parts = append(parts, part)
+	}
+
+	for _, path := range pathsFromContext(ctx, internal.ImagePathKey) {
+		part, err := c.createImagePartFromURLOrFile(path)
 		if err != nil {
 			return nil, err
 		}
-		messages = append(messages, api.Message{
-			Role:    UserRole,
-			Content: []api.ImageContent{content},
-		})
-	} else if path, ok := ctx.Value(internal.AudioPathKey).(string); ok {
-		content, err := c.createAudioContentFromFile(path)
+		parts = append(parts, part)
+	}
+
+	for _, path := range pathsFromContext(ctx, internal.AudioPathKey) {
+		part, err := c.createAudioPartFromFile(path)
 		if err != nil {
 			return nil, err
 		}
-		messages = append(messages, api.Message{
-			Role:    UserRole,
-			Content: []api.AudioContent{content},
-		})
+		parts = append(parts, part)
+	}
+
+	return parts, nil
+}
+
+// pathsFromContext accepts either a single path or a list of paths under key.
+func pathsFromContext(ctx context.Context, key interface{}) []string {
+	switch v := ctx.Value(key).(type) {
+	case string:
+		if v != "" {
+			return []string{v}
+		}
+	case []string:
+		return v
 	}
-	return messages, nil
+	return nil
 }
 
 func (c *Client) base64Encode(path string) (string, error) {
@@ -334,80 +100,92 @@ func (c *Client) base64Encode(path string) (string, error) {
 	return base64.StdEncoding.EncodeToString(imageData), nil
 }
 
-func (c *Client) createAudioContentFromFile(audio string) (api.AudioContent, error) {
-
+func (c *Client) createAudioPartFromFile(audio string) (api.ContentPart, error) {
 	format, err := c.detectAudioFormat(audio)
 	if err != nil {
-		return api.AudioContent{}, err
+		return api.ContentPart{}, err
 	}
 
 	encodedAudio, err := c.base64Encode(audio)
 	if err != nil {
-		return api.AudioContent{}, err
+		return api.ContentPart{}, err
 	}
 
-	return api.AudioContent{
+	return api.ContentPart{
 		Type: audioType,
-		InputAudio: api.InputAudio{
+		InputAudio: &api.InputAudio{
 			Data:   encodedAudio,
 			Format: format,
 		},
 	}, nil
 }
 
-func (c *Client) createImageContentFromBinary(binary []byte) (api.ImageContent, error) {
+// createPartFromBinary routes piped binary data by its MIME type. PDFs are sent as
+// files when the model uses the Responses API; otherwise the text of PDF, DOCX and
+// HTML documents is extracted locally and sent as text. Anything else is sent as an
+// image.
+func (c *Client) createPartFromBinary(binary []byte) (api.ContentPart, error) {
+	kind := document.Detect(binary)
+
+	switch kind {
+	case document.KindPDF, document.KindDOCX, document.KindHTML:
+		if kind == document.KindPDF && c.usesResponsesAPI() {
+			encoded := base64.StdEncoding.EncodeToString(binary)
+			return api.ContentPart{
+				Type: api.FilePartType,
+				File: &api.File{
+					Filename: pipedPDFName,
+					FileData: fmt.Sprintf(imageContent, document.MimePDF, encoded),
+				},
+			}, nil
+		}
+
+		text, err := document.ToText(binary)
+		if err != nil {
+			return api.ContentPart{}, err
+		}
+		return api.ContentPart{
+			Type: api.TextPartType,
+			Text: fmt.Sprintf("<document type=%q>\n%s\n</document>", kind.MimeType(), text),
+		}, nil
+	}
+
+	return c.createImagePartFromBinary(binary)
+}
+
+func (c *Client) createImagePartFromBinary(binary []byte) (api.ContentPart, error) {
 	mime, err := getMimeTypeFromBytes(binary)
 	if err != nil {
-		return api.ImageContent{}, err
+		return api.ContentPart{}, err
 	}
 
 	encoded := base64.StdEncoding.EncodeToString(binary)
-	content := api.ImageContent{
-		Type: imageURLType,
-		ImageURL: struct {
-			URL string `json:"url"`
-		}{
-			URL: fmt.Sprintf(imageContent, mime, encoded),
-		},
-	}
-
-	return content, nil
+	return imagePart(fmt.Sprintf(imageContent, mime, encoded)), nil
 }
 
-func (c *Client) createImageContentFromURLOrFile(image string) (api.ImageContent, error) {
-	var content api.ImageContent
-
+func (c *Client) createImagePartFromURLOrFile(image string) (api.ContentPart, error) {
 	if isValidURL(image) {
-		content = api.ImageContent{
-			Type: imageURLType,
-			ImageURL: struct {
-				URL string `json:"url"`
-			}{
-				URL: image,
-			},
-		}
-	} else {
-		mime, err := c.getMimeTypeFromFileContent(image)
-		if err != nil {
-			return content, err
-		}
+		return imagePart(image), nil
+	}
 
-		encodedImage, err := c.base64Encode(image)
-		if err != nil {
-			return content, err
-		}
+	mime, err := c.getMimeTypeFromFileContent(image)
+	if err != nil {
+		return api.ContentPart{}, err
+	}
 
-		content = api.ImageContent{
-			Type: imageURLType,
-			ImageURL: struct {
-				URL string `json:"url"`
-			}{
-				URL: fmt.Sprintf(imageContent, mime, encodedImage),
-			},
-		}
+	encodedImage, err := c.base64Encode(image)
+	if err != nil {
+		return api.ContentPart{}, err
 	}
 
-	return content, nil
+	return imagePart(fmt.Sprintf(imageContent, mime, encodedImage)), nil
+}
+
+func imagePart(url string) api.ContentPart {
+	return api.ContentPart{
+		Type:     imageURLType,
+		ImageURL: &api.ImageURL{URL: url},
+	}
 }
 
 func (c *Client) detectAudioFormat(path string) (string, error) {
@@ -470,40 +248,6 @@ func (c *Client) getMimeTypeFromFileContent(path string) (string, error) {
 	return mimeType, nil
 }
 
-func (c *Client) postAndWriteBinaryOutput(endpoint string, requestBody interface{}, outputPath, debugLabel string, transform func([]byte) ([]byte, error)) error {
-	body, err := json.Marshal(requestBody)
-	if err != nil {
-		return fmt.Errorf("failed to marshal request: %w", err)
-	}
-
-	c.printRequestDebugInfo(endpoint, body, nil)
-
-	respBytes, err := c.Caller.Post(endpoint, body, false)
-	if err != nil {
-		return fmt.Errorf("API request failed: %w", err)
-	}
-
-	if transform != nil {
-		respBytes, err = transform(respBytes)
-		if err != nil {
-			return err
-		}
-	}
-
-	outFile, err := c.writer.Create(outputPath)
-	if err != nil {
-		return fmt.Errorf("failed to create output file: %w", err)
-	}
-	defer outFile.Close()
-
-	if err := c.writer.Write(outFile, respBytes); err != nil {
-		return fmt.Errorf("failed to write %s: %w", debugLabel, err)
-	}
-
-	c.printResponseDebugInfo([]byte(fmt.Sprintf("[%s] %d bytes written to %s", debugLabel, len(respBytes), outputPath)))
-	return nil
-}
-
 func getExtension(path string) string {
 	ext := filepath.Ext(path) // e.g. ".mp4"
 	if ext != "" {
@@ -4,17 +4,22 @@ package client_test
 import (
 	"bytes"
 	"encoding/base64"
+	"encoding/binary"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/golang/mock/gomock"
 	"github.com/kardolus/chatgpt-cli/api"
 	"github.com/kardolus/chatgpt-cli/api/client"
+	config2 "github.com/kardolus/chatgpt-cli/config"
 	"github.com/kardolus/chatgpt-cli/history"
 
 	. "github.com/onsi/gomega"
@@ -100,6 +105,80 @@ func testMedia(t *testing.T, when spec.G, it spec.S) {
 				err = subject.SynthesizeSpeech(inputText, fileName)
 				Expect(err).NotTo(HaveOccurred())
 			})
+
+			it("splits long text at sentences and joins the audio in order", func() {
+				subject.Config.SpeechSpeed = 1.25
+				subject.Config.SpeechInstructions = "Speak calmly."
+
+				first := strings.Repeat("a", 3000) + ". "
+				second := strings.Repeat("b", 3000) + "."
+
+				mockCaller.EXPECT().Post(subject.Config.URL+subject.Config.SpeechPath, gomock.Any(), false).
+					Times(2).
+					DoAndReturn(func(_ string, body []byte, _ bool) ([]byte, error) {
+						var req api.Speech
+						Expect(json.Unmarshal(body, &req)).To(Succeed())
+						Expect(req.ResponseFormat).To(Equal("wav"))
+						Expect(req.Speed).To(Equal(1.25))
+						Expect(req.Instructions).To(Equal("Speak calmly."))
+
+						if req.Input == first {
+							return wavBytes(1, 2), nil
+						}
+						Expect(req.Input).To(Equal(second))
+						return wavBytes(3), nil
+					})
+
+				file, err := os.Open(os.DevNull)
+				Expect(err).NotTo(HaveOccurred())
+				defer file.Close()
+
+				mockWriter.EXPECT().Create("speech.wav").Return(file, nil)
+				mockWriter.EXPECT().Write(file, wavBytes(1, 2, 3)).Return(nil)
+
+				Expect(subject.SynthesizeSpeech(first+second, "speech.wav")).To(Succeed())
+			})
+
+			it("refuses to join long text into formats that can't be concatenated", func() {
+				err := subject.SynthesizeSpeech(strings.Repeat("word ", 1000), "speech.flac")
+				Expect(err).To(MatchError(ContainSubstring("too long")))
+			})
+		})
+
+		when("AnswerSpeaker", func() {
+			it("speaks the sentences of an answer in order and skips code", func() {
+				var out bytes.Buffer
+				var spoken []string
+
+				speaker := client.NewAnswerSpeaker(&out, func(text string) ([]byte, error) {
+					return []byte(text), nil
+				}, func(audio []byte) error {
+					spoken = append(spoken, string(audio))
+					return nil
+				})
+
+				answer := []string{"Sure! Here is **the** fix", ". Run it:\n", "```go\nfmt.Println(1)\n```\n", "See [the docs](https://go.dev)."}
+				for _, chunk := range answer {
+					_, err := speaker.Write([]byte(chunk))
+					Expect(err).NotTo(HaveOccurred())
+				}
+				Expect(speaker.Flush()).To(Succeed())
+
+				Expect(out.String()).To(Equal(strings.Join(answer, "")))
+				Expect(spoken).To(Equal([]string{"Sure!", "Here is the fix.", "Run it:", "See the docs."}))
+			})
+
+			it("returns the first error once the answer is done", func() {
+				speaker := client.NewAnswerSpeaker(io.Discard, func(text string) ([]byte, error) {
+					return nil, errors.New("synthesis failed")
+				}, func([]byte) error {
+					return nil
+				})
+
+				_, err := speaker.Write([]byte("Hello. World."))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(speaker.Flush()).To(MatchError("synthesis failed"))
+			})
 		})
 
 		when("GenerateImage()", func() {
@@ -200,9 +279,52 @@ func testMedia(t *testing.T, when spec.G, it spec.S) {
 				mockWriter.EXPECT().Create(outputFile).Return(file, nil)
 				mockWriter.EXPECT().Write(file, []byte("image-bytes")).Return(nil)
 
+				now := time.Now()
+				mockHistoryStore.EXPECT().Read().Return(nil, nil)
+				mockTimer.EXPECT().Now().Return(now).Times(3)
+				mockHistoryStore.EXPECT().Write([]history.History{
+					{Message: api.Message{Role: client.SystemRole, Content: subject.Config.Role}, Timestamp: now},
+					{Message: api.Message{Role: client.UserRole, Content: "[draw] " + inputText}, Timestamp: now},
+					{Message: api.Message{Role: client.AssistantRole, Content: "Saved the image to " + outputFile}, Timestamp: now},
+				})
+
 				err = subject.GenerateImage(inputText, outputFile)
 				Expect(err).NotTo(HaveOccurred())
 			})
+
+			it("sends the image options and numbers the files when several images are drawn", func() {
+				subject.Config.Image = config2.ImageConfig{Size: "1024x1536", Quality: "high", N: 2, Background: "transparent", OutputFormat: "png"}
+
+				file, err := os.Open(os.DevNull)
+				Expect(err).NotTo(HaveOccurred())
+				defer file.Close()
+
+				first := base64.StdEncoding.EncodeToString([]byte("first"))
+				second := base64.StdEncoding.EncodeToString([]byte("second"))
+				mockCaller.EXPECT().
+					Post(subject.Config.URL+subject.Config.ImageGenerationsPath, gomock.Any(), false).
+					DoAndReturn(func(_ string, body []byte, _ bool) ([]byte, error) {
+						var req api.Draw
+						Expect(json.Unmarshal(body, &req)).To(Succeed())
+						Expect(req).To(Equal(api.Draw{
+							Model: subject.Config.Model, Prompt: inputText, Size: "1024x1536", Quality: "high",
+							N: 2, Background: "transparent", OutputFormat: "png",
+						}))
+						return []byte(fmt.Sprintf(`{"data":[{"b64_json":"%s"},{"b64_json":"%s"}]}`, first, second)), nil
+					})
+
+				mockWriter.EXPECT().Create("dog-1.png").Return(file, nil)
+				mockWriter.EXPECT().Write(file, []byte("first")).Return(nil)
+				mockWriter.EXPECT().Create("dog-2.png").Return(file, nil)
+				mockWriter.EXPECT().Write(file, []byte("second")).Return(nil)
+
+				mockHistoryStore.EXPECT().Read().Return(nil, nil)
+				mockTimer.EXPECT().Now().AnyTimes()
+				mockHistoryStore.EXPECT().Write(gomock.Any())
+
+				Expect(subject.GenerateImage(inputText, outputFile)).To(Succeed())
+				Expect(subject.History[len(subject.History)-1].Content).To(Equal("Saved 2 images: dog-1.png, dog-2.png"))
+			})
 		})
 
 		when("EditImage()", func() {
@@ -229,7 +351,7 @@ func testMedia(t *testing.T, when spec.G, it spec.S) {
 			it("returns error when input file can't be opened", func() {
 				mockReader.EXPECT().Open(inputFile).Return(nil, errors.New(errorText))
 
-				err := subject.EditImage(inputText, inputFile, outputFile)
+				err := subject.EditImage(inputText, []string{inputFile}, "", outputFile)
 				Expect(err).To(HaveOccurred())
 				Expect(err.Error()).To(ContainSubstring("failed to open input image"))
 			})
@@ -239,7 +361,7 @@ func testMedia(t *testing.T, when spec.G, it spec.S) {
 				mockReader.EXPECT().Open(inputFile).Return(file, nil).Times(2)
 				mockReader.EXPECT().ReadBufferFromFile(file).Return([]byte("not an image"), nil)
 
-				err := subject.EditImage(inputText, inputFile, outputFile)
+				err := subject.EditImage(inputText, []string{inputFile}, "", outputFile)
 				Expect(err).To(HaveOccurred())
 				Expect(err.Error()).To(ContainSubstring("unsupported MIME type"))
 			})
@@ -257,7 +379,7 @@ func testMedia(t *testing.T, when spec.G, it spec.S) {
 					PostWithHeaders(gomock.Any(), gomock.Any(), gomock.Any()).
 					Return(nil, errors.New(errorText))
 
-				err := subject.EditImage(inputText, inputFile, outputFile)
+				err := subject.EditImage(inputText, []string{inputFile}, "", outputFile)
 				Expect(err).To(HaveOccurred())
 				Expect(err.Error()).To(ContainSubstring("failed to edit image"))
 			})
@@ -277,7 +399,7 @@ func testMedia(t *testing.T, when spec.G, it spec.S) {
 					PostWithHeaders(gomock.Any(), gomock.Any(), gomock.Any()).
 					Return(invalidResp, nil)
 
-				err := subject.EditImage(inputText, inputFile, outputFile)
+				err := subject.EditImage(inputText, []string{inputFile}, "", outputFile)
 				Expect(err).To(HaveOccurred())
 				Expect(err.Error()).To(ContainSubstring("failed to decode base64 image"))
 			})
@@ -299,8 +421,51 @@ func testMedia(t *testing.T, when spec.G, it spec.S) {
 				mockWriter.EXPECT().Create(outputFile).Return(file, nil)
 				mockWriter.EXPECT().Write(file, imageBytes).Return(nil)
 
-				err := subject.EditImage(inputText, inputFile, outputFile)
+				mockHistoryStore.EXPECT().Read().Return(nil, nil)
+				mockTimer.EXPECT().Now().AnyTimes()
+				mockHistoryStore.EXPECT().Write(gomock.Any())
+
+				subject.Config.ContextWindow = 8192
+				err := subject.EditImage(inputText, []string{inputFile}, "", outputFile)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(subject.History[len(subject.History)-2].Content).To(Equal("[edit dog.png] " + inputText))
+			})
+
+			it("sends several reference images and the mask", func() {
+				for _, path := range []string{"dog.png", "hat.png", "mask.png"} {
+					mockReader.EXPECT().Open(path).DoAndReturn(func(string) (*os.File, error) {
+						return openDummy(), nil
+					}).Times(2)
+				}
+				mockReader.EXPECT().
+					ReadBufferFromFile(gomock.AssignableToTypeOf(&os.File{})).
+					Return([]byte("\x89PNG\r\n\x1a\n"), nil).
+					Times(3)
+
+				subject.Config.Image.Size = "1024x1024"
+				mockCaller.EXPECT().
+					PostWithHeaders(subject.Config.URL+subject.Config.ImageEditsPath, gomock.Any(), gomock.Any()).
+					DoAndReturn(func(_ string, body []byte, _ map[string]string) ([]byte, error) {
+						Expect(string(body)).To(ContainSubstring(`name="image[]"; filename="dog.png"`))
+						Expect(string(body)).To(ContainSubstring(`name="image[]"; filename="hat.png"`))
+						Expect(string(body)).To(ContainSubstring(`name="mask"; filename="mask.png"`))
+						Expect(string(body)).To(ContainSubstring("name=\"size\"\r\n\r\n1024x1024"))
+						Expect(string(body)).NotTo(ContainSubstring(`name="quality"`))
+						return respBytes, nil
+					})
+
+				file := openDummy()
+				mockWriter.EXPECT().Create(outputFile).Return(file, nil)
+				mockWriter.EXPECT().Write(file, imageBytes).Return(nil)
+
+				mockHistoryStore.EXPECT().Read().Return(nil, nil)
+				mockTimer.EXPECT().Now().AnyTimes()
+				mockHistoryStore.EXPECT().Write(gomock.Any())
+
+				subject.Config.ContextWindow = 8192
+				err := subject.EditImage(inputText, []string{"dog.png", "hat.png"}, "mask.png", outputFile)
 				Expect(err).NotTo(HaveOccurred())
+				Expect(subject.History[len(subject.History)-2].Content).To(Equal("[edit dog.png, hat.png, mask mask.png] " + inputText))
 			})
 		})
 
@@ -411,10 +576,145 @@ func testMedia(t *testing.T, when spec.G, it spec.S) {
 				Expect(err).NotTo(HaveOccurred())
 				Expect(text).To(Equal(transcribedText))
 			})
+
+			it("sends the format, language and prompt and returns the transcript as is", func() {
+				subject := factory.buildClientWithoutConfig()
+				subject.Config.Transcription.Format = client.TranscriptSRT
+				subject.Config.Transcription.Language = "nl"
+				subject.Config.Transcription.Prompt = "Kubernetes, etcd"
+
+				mockHistoryStore.EXPECT().Read().Return(nil, nil)
+				mockTimer.EXPECT().Now().AnyTimes()
+				mockHistoryStore.EXPECT().Write(gomock.Any())
+
+				file, err := os.Open(os.DevNull)
+				Expect(err).NotTo(HaveOccurred())
+				defer file.Close()
+				mockReader.EXPECT().Open(audioPath).Return(file, nil)
+
+				srt := "1\n00:00:00,000 --> 00:00:01,500\nHallo.\n\n"
+				mockCaller.EXPECT().
+					PostWithHeaders(subject.Config.URL+subject.Config.TranscriptionsPath, gomock.Any(), gomock.Any()).
+					DoAndReturn(func(_ string, body []byte, _ map[string]string) ([]byte, error) {
+						Expect(string(body)).To(ContainSubstring("name=\"response_format\"\r\n\r\nsrt"))
+						Expect(string(body)).To(ContainSubstring("name=\"language\"\r\n\r\nnl"))
+						Expect(string(body)).To(ContainSubstring("name=\"prompt\"\r\n\r\nKubernetes, etcd"))
+						return []byte(srt), nil
+					})
+
+				text, err := subject.Transcribe(audioPath)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(text).To(Equal(srt))
+			})
+
+			it("splits long WAV recordings at silences and shifts the timestamps of later chunks", func() {
+				subject := factory.buildClientWithoutConfig()
+				subject.Config.Transcription.ChunkSeconds = 1
+
+				mockHistoryStore.EXPECT().Read().Return(nil, nil)
+				mockTimer.EXPECT().Now().AnyTimes()
+				mockHistoryStore.EXPECT().Write(gomock.Any())
+
+				// 0.8s of speech, 0.3s of silence and 0.6s of speech: cut in the silence at 0.825s.
+				wavPath := writeWAV(t, 800*time.Millisecond, -300*time.Millisecond, 600*time.Millisecond)
+				file, err := os.Open(wavPath)
+				Expect(err).NotTo(HaveOccurred())
+				defer file.Close()
+				mockReader.EXPECT().Open("meeting.wav").Return(file, nil)
+
+				mockCaller.EXPECT().
+					PostWithHeaders(subject.Config.URL+subject.Config.TranscriptionsPath, gomock.Any(), gomock.Any()).
+					Times(2).
+					DoAndReturn(func(_ string, body []byte, _ map[string]string) ([]byte, error) {
+						Expect(string(body)).To(ContainSubstring("name=\"response_format\"\r\n\r\nverbose_json"))
+						if bytes.Contains(body, []byte(`filename="meeting.part1.wav"`)) {
+							return []byte(`{"language":"english","duration":0.825,"text":" Hello there.","segments":[{"id":0,"start":0,"end":0.8,"text":" Hello there."}]}`), nil
+						}
+						Expect(string(body)).To(ContainSubstring(`filename="meeting.part2.wav"`))
+						return []byte(`{"language":"english","duration":0.875,"text":" General Kenobi.","segments":[{"id":0,"start":0.1,"end":0.8,"text":" General Kenobi."}]}`), nil
+					})
+
+				subject.Config.Transcription.Format = client.TranscriptSRT
+				text, err := subject.Transcribe("meeting.wav")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(text).To(Equal("1\n00:00:00,000 --> 00:00:00,800\nHello there.\n\n" +
+					"2\n00:00:00,925 --> 00:00:01,625\nGeneral Kenobi.\n\n"))
+				Expect(subject.History[len(subject.History)-1].Content).To(Equal("Hello there. General Kenobi."))
+			})
+
+			it("writes the transcript in the format of the output file", func() {
+				subject := factory.buildClientWithoutConfig()
+
+				mockHistoryStore.EXPECT().Read().Return(nil, nil)
+				mockTimer.EXPECT().Now().AnyTimes()
+				mockHistoryStore.EXPECT().Write(gomock.Any())
+
+				file, err := os.Open(os.DevNull)
+				Expect(err).NotTo(HaveOccurred())
+				defer file.Close()
+				mockReader.EXPECT().Open(audioPath).Return(file, nil)
+
+				vtt := []byte("WEBVTT\n\n00:00:00.000 --> 00:00:01.500\nHello.\n\n")
+				mockCaller.EXPECT().
+					PostWithHeaders(subject.Config.URL+subject.Config.TranscriptionsPath, gomock.Any(), gomock.Any()).
+					DoAndReturn(func(_ string, body []byte, _ map[string]string) ([]byte, error) {
+						Expect(string(body)).To(ContainSubstring("name=\"response_format\"\r\n\r\nvtt"))
+						return vtt, nil
+					})
+				mockWriter.EXPECT().Create("out.vtt").Return(file, nil)
+				mockWriter.EXPECT().Write(file, vtt).Return(nil)
+
+				Expect(subject.TranscribeToFile(audioPath, "out.vtt")).To(Succeed())
+			})
 		})
 	})
 }
 
+// writeWAV stores 16-bit mono audio at 8kHz: a tone for every positive duration and
+// silence for every negative one.
+func writeWAV(t *testing.T, parts ...time.Duration) string {
+	var samples []int16
+	for _, p := range parts {
+		for i := 0; i < int(p.Abs().Seconds()*8000); i++ {
+			var v int16
+			if p > 0 {
+				v = int16(8000 * math.Sin(2*math.Pi*440*float64(i)/8000))
+			}
+			samples = append(samples, v)
+		}
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("RIFF")
+	_ = binary.Write(&buf, binary.LittleEndian, uint32(36+2*len(samples)))
+	buf.WriteString("WAVEfmt ")
+	for _, v := range []any{uint32(16), uint16(1), uint16(1), uint32(8000), uint32(16000), uint16(2), uint16(16)} {
+		_ = binary.Write(&buf, binary.LittleEndian, v)
+	}
+	buf.WriteString("data")
+	_ = binary.Write(&buf, binary.LittleEndian, uint32(2*len(samples)))
+	_ = binary.Write(&buf, binary.LittleEndian, samples)
+
+	path := filepath.Join(t.TempDir(), "meeting.wav")
+	Expect(os.WriteFile(path, buf.Bytes(), 0644)).To(Succeed())
+	return path
+}
+
+// wavBytes returns a 16-bit mono WAV file holding the given samples.
+func wavBytes(samples ...int16) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("RIFF")
+	_ = binary.Write(&buf, binary.LittleEndian, uint32(36+2*len(samples)))
+	buf.WriteString("WAVEfmt ")
+	for _, v := range []any{uint32(16), uint16(1), uint16(1), uint32(24000), uint32(48000), uint16(2), uint16(16)} {
+		_ = binary.Write(&buf, binary.LittleEndian, v)
+	}
+	buf.WriteString("data")
+	_ = binary.Write(&buf, binary.LittleEndian, uint32(2*len(samples)))
+	_ = binary.Write(&buf, binary.LittleEndian, samples)
+	return buf.Bytes()
+}
+
 func openDummy() *os.File {
 	// Use os.Pipe to get an *os.File without needing a real disk file.
 	r, w, _ := os.Pipe()
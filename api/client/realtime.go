@@ -0,0 +1,181 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"github.com/kardolus/chatgpt-cli/api"
+	"github.com/kardolus/chatgpt-cli/api/realtime"
+	"github.com/kardolus/chatgpt-cli/internal"
+	"github.com/kardolus/chatgpt-cli/internal/audio"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// RealtimeSession is a conversation with a realtime model over the WebSocket transport of
+// the Realtime API. The thread is replayed when the session opens and every turn is
+// recorded in it, so the conversation can be continued with any other model.
+type RealtimeSession struct {
+	client      *Client
+	session     *realtime.Session
+	audioOutput string
+	turns       int
+}
+
+// OpenRealtime connects to the Realtime API with the configured realtime model. When
+// audioOutput is set, spoken answers are requested as well and saved as WAV files: the
+// first answer to audioOutput, the next ones numbered (answer-2.wav, answer-3.wav, ...).
+func (c *Client) OpenRealtime(ctx context.Context, audioOutput string) (*RealtimeSession, error) {
+	if audioOutput != "" && getExtension(audioOutput) != "wav" {
+		return nil, fmt.Errorf("realtime answers are saved as WAV, use a .wav output file instead of %s", audioOutput)
+	}
+
+	endpoint, err := c.realtimeEndpoint()
+	if err != nil {
+		return nil, err
+	}
+
+	header := http.Header{}
+	if c.Config.APIKey != "" {
+		header.Set(c.Config.AuthHeader, c.Config.AuthTokenPrefix+c.Config.APIKey)
+	}
+	header.Set(internal.HeaderUserAgentKey, c.Config.UserAgent)
+	for key, value := range c.Config.CustomHeaders {
+		header.Set(key, value)
+	}
+
+	var tlsConfig *tls.Config
+	if c.Config.SkipTLSVerify {
+		tlsConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+
+	c.printRequestDebugInfo(endpoint, nil, nil)
+
+	session, err := realtime.Dial(ctx, realtime.Options{
+		URL:          endpoint,
+		Header:       header,
+		TLSConfig:    tlsConfig,
+		Instructions: c.Config.Role,
+		Voice:        c.Config.Voice,
+		Audio:        audioOutput != "",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open realtime session: %w", err)
+	}
+
+	if !c.Config.OmitHistory {
+		c.initHistory()
+		for _, entry := range c.History {
+			text := api.ContentText(entry.Content)
+			if text == "" || (entry.Role != UserRole && entry.Role != AssistantRole) {
+				continue
+			}
+			if err := session.AddMessage(entry.Role, text); err != nil {
+				_ = session.Close()
+				return nil, fmt.Errorf("failed to replay the thread: %w", err)
+			}
+		}
+	}
+
+	return &RealtimeSession{client: c, session: session, audioOutput: audioOutput}, nil
+}
+
+// Send sends the input, along with any WAV files under internal.AudioPathKey in the context,
+// and writes the answer to out as it streams in. It returns the answer and the tokens used.
+func (r *RealtimeSession) Send(ctx context.Context, input string, out io.Writer) (string, int, error) {
+	c := r.client
+
+	if len(pathsFromContext(ctx, internal.ImagePathKey)) > 0 {
+		return "", 0, errors.New("realtime sessions don't take images")
+	}
+
+	pcm, err := c.realtimeAudio(ctx)
+	if err != nil {
+		return "", 0, err
+	}
+
+	c.prepareQuery(input)
+
+	resp, err := r.session.Respond(ctx, input, pcm, out)
+	if err != nil {
+		return "", 0, err
+	}
+	c.printResponseDebugInfo([]byte(resp.Text))
+
+	c.updateHistory(resp.Text, resp.Tokens)
+
+	r.turns++
+	if r.audioOutput != "" && len(resp.Audio) > 0 {
+		path := r.audioOutput
+		if r.turns > 1 {
+			path = numberedPath(path, r.turns)
+		}
+
+		data := audio.EncodePCM16(resp.Audio, 1, realtime.SampleRate)
+		if err := c.writeAudioFile(path, data); err != nil {
+			return resp.Text, resp.Tokens, err
+		}
+		c.printResponseDebugInfo([]byte(fmt.Sprintf("[audio] %d bytes written to %s", len(data), path)))
+	}
+
+	return resp.Text, resp.Tokens, nil
+}
+
+// Close ends the session.
+func (r *RealtimeSession) Close() error {
+	return r.session.Close()
+}
+
+// realtimeEndpoint turns the realtime path into a ws:// or wss:// URL for the configured model.
+func (c *Client) realtimeEndpoint() (string, error) {
+	u, err := url.Parse(c.getEndpoint(c.Config.RealtimePath))
+	if err != nil {
+		return "", fmt.Errorf("invalid realtime endpoint: %w", err)
+	}
+
+	switch u.Scheme {
+	case "https":
+		u.Scheme = "wss"
+	case "http":
+		u.Scheme = "ws"
+	}
+
+	query := u.Query()
+	query.Set("model", c.Config.Model)
+	u.RawQuery = query.Encode()
+
+	return u.String(), nil
+}
+
+// realtimeAudio converts the audio files in the context to the PCM format of the Realtime API.
+func (c *Client) realtimeAudio(ctx context.Context) ([]byte, error) {
+	var pcm []byte
+	for _, path := range pathsFromContext(ctx, internal.AudioPathKey) {
+		data, err := c.reader.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		wav, err := audio.ParseWAV(data)
+		if err != nil {
+			return nil, fmt.Errorf("realtime sessions take WAV audio, %s: %w", path, err)
+		}
+		pcm = append(pcm, wav.PCM16(realtime.SampleRate)...)
+	}
+	return pcm, nil
+}
+
+func (c *Client) writeAudioFile(path string, data []byte) error {
+	outFile, err := c.writer.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %w", err)
+	}
+	defer outFile.Close()
+
+	if err := c.writer.Write(outFile, data); err != nil {
+		return fmt.Errorf("failed to write audio: %w", err)
+	}
+	return nil
+}
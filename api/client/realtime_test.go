@@ -0,0 +1,189 @@
+package client_test
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	stdhttp "net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/kardolus/chatgpt-cli/api"
+	"github.com/kardolus/chatgpt-cli/history"
+	"github.com/kardolus/chatgpt-cli/internal"
+	"github.com/kardolus/chatgpt-cli/internal/audio"
+	"github.com/kardolus/chatgpt-cli/internal/websocket"
+
+	. "github.com/onsi/gomega"
+	"github.com/sclevine/spec"
+)
+
+func testRealtime(t *testing.T, when spec.G, it spec.S) {
+	var (
+		server *httptest.Server
+		mu     sync.Mutex
+		events []api.RealtimeEvent
+		query  string
+	)
+
+	it.Before(func() {
+		mu.Lock()
+		events = nil
+		query = ""
+		mu.Unlock()
+
+		audioDelta := base64.StdEncoding.EncodeToString([]byte{1, 0, 2, 0})
+		replies := []string{
+			`{"type":"response.audio_transcript.delta","delta":"Hi "}`,
+			`{"type":"response.audio_transcript.delta","delta":"there"}`,
+			`{"type":"response.audio.delta","delta":"` + audioDelta + `"}`,
+			`{"type":"response.done","response":{"status":"completed","usage":{"total_tokens":12}}}`,
+		}
+
+		server = httptest.NewServer(stdhttp.HandlerFunc(func(w stdhttp.ResponseWriter, r *stdhttp.Request) {
+			mu.Lock()
+			query = r.URL.String()
+			mu.Unlock()
+
+			conn, err := websocket.Accept(w, r)
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+
+			for {
+				_, data, err := conn.ReadMessage()
+				if err != nil {
+					return
+				}
+				var event api.RealtimeEvent
+				_ = json.Unmarshal(data, &event)
+
+				mu.Lock()
+				events = append(events, event)
+				mu.Unlock()
+
+				if event.Type == "response.create" {
+					for _, reply := range replies {
+						_ = conn.WriteMessage(websocket.TextMessage, []byte(reply))
+					}
+				}
+			}
+		}))
+	})
+
+	it.After(func() {
+		server.Close()
+	})
+
+	when("OpenRealtime()", func() {
+		it("replays the thread, records every turn and saves the spoken answers", func() {
+			subject := factory.buildClientWithoutConfig()
+			subject.Config.URL = server.URL
+			subject.Config.RealtimePath = "/v1/realtime"
+			subject.Config.Model = "gpt-realtime"
+			subject.Config.ContextWindow = 8192
+
+			factory.withHistory([]history.History{
+				{Message: api.Message{Role: "system", Content: "old role"}},
+				{Message: api.Message{Role: "user", Content: "Earlier question"}},
+				{Message: api.Message{Role: "assistant", Content: "Earlier answer"}},
+			})
+			mockTimer.EXPECT().Now().Return(time.Time{}).AnyTimes()
+			mockHistoryStore.EXPECT().Write(gomock.Any()).Times(2)
+
+			first, second := openDummy(), openDummy()
+			pcm := audio.EncodePCM16([]byte{1, 0, 2, 0}, 1, 24000)
+			mockWriter.EXPECT().Create("answer.wav").Return(first, nil)
+			mockWriter.EXPECT().Write(first, pcm).Return(nil)
+			mockWriter.EXPECT().Create("answer-2.wav").Return(second, nil)
+			mockWriter.EXPECT().Write(second, pcm).Return(nil)
+
+			session, err := subject.OpenRealtime(context.Background(), "answer.wav")
+			Expect(err).NotTo(HaveOccurred())
+			defer session.Close()
+
+			var out []byte
+			writer := writerFunc(func(p []byte) (int, error) {
+				out = append(out, p...)
+				return len(p), nil
+			})
+
+			answer, tokens, err := session.Send(context.Background(), "Hello", writer)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(answer).To(Equal("Hi there"))
+			Expect(tokens).To(Equal(12))
+			Expect(string(out)).To(Equal("Hi there"))
+
+			_, _, err = session.Send(context.Background(), "Again", writer)
+			Expect(err).NotTo(HaveOccurred())
+
+			last := len(subject.History) - 1
+			Expect(subject.History[last-1].Content).To(Equal("Again"))
+			Expect(subject.History[last].Content).To(Equal("Hi there"))
+
+			mu.Lock()
+			defer mu.Unlock()
+			Expect(query).To(Equal("/v1/realtime?model=gpt-realtime"))
+			Expect(events[0].Type).To(Equal("session.update"))
+			Expect(events[0].Session.Instructions).To(Equal("You are a test assistant."))
+			Expect(events[0].Session.Voice).To(Equal("mock-voice"))
+			Expect(events[0].Session.Modalities).To(Equal([]string{"text", "audio"}))
+			Expect(events[1].Item.Content[0].Text).To(Equal("Earlier question"))
+			Expect(events[2].Item.Content[0].Text).To(Equal("Earlier answer"))
+			Expect(events[3].Item.Content[0].Text).To(Equal("Hello"))
+			Expect(events[4].Type).To(Equal("response.create"))
+		})
+
+		it("sends audio files as PCM and refuses other formats", func() {
+			subject := factory.buildClientWithoutConfig()
+			subject.Config.URL = server.URL
+			subject.Config.RealtimePath = "/v1/realtime"
+			subject.Config.OmitHistory = true
+
+			wav := wavBytes(100, 200)
+			mockReader.EXPECT().ReadFile("question.wav").Return(wav, nil)
+			mockReader.EXPECT().ReadFile("question.mp3").Return([]byte("ID3"), nil)
+			mockTimer.EXPECT().Now().Return(time.Time{}).AnyTimes()
+
+			session, err := subject.OpenRealtime(context.Background(), "")
+			Expect(err).NotTo(HaveOccurred())
+			defer session.Close()
+
+			ctx := context.WithValue(context.Background(), internal.AudioPathKey, []string{"question.wav"})
+			_, _, err = session.Send(ctx, "", nil)
+			Expect(err).NotTo(HaveOccurred())
+
+			ctx = context.WithValue(context.Background(), internal.AudioPathKey, []string{"question.mp3"})
+			_, _, err = session.Send(ctx, "", nil)
+			Expect(err).To(MatchError(ContainSubstring("WAV")))
+
+			parsed, err := audio.ParseWAV(wav)
+			Expect(err).NotTo(HaveOccurred())
+
+			mu.Lock()
+			defer mu.Unlock()
+			Expect(events[0].Session.Modalities).To(Equal([]string{"text"}))
+			Expect(events[1].Item.Content).To(Equal([]api.RealtimeContent{{
+				Type:  "input_audio",
+				Audio: base64.StdEncoding.EncodeToString(parsed.PCM16(24000)),
+			}}))
+		})
+
+		it("only saves answers as WAV", func() {
+			subject := factory.buildClientWithoutConfig()
+
+			_, err := subject.OpenRealtime(context.Background(), "answer.mp3")
+			Expect(err).To(MatchError(ContainSubstring(".wav")))
+		})
+	})
+}
+
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	return f(p)
+}
@@ -0,0 +1,382 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/kardolus/chatgpt-cli/api"
+	"github.com/kardolus/chatgpt-cli/internal/audio"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// maxSpeechInput is the character limit of the speech endpoint.
+	maxSpeechInput = 4096
+
+	// speakerQueueSize bounds the sentences waiting to be spoken before writes block.
+	speakerQueueSize = 256
+
+	sentenceEnd = ".!?…"
+)
+
+var markdownLink = regexp.MustCompile(`!?\[([^\]]*)\]\([^)]*\)`)
+
+// SynthesizeSpeech converts the given input text into speech using the configured TTS model,
+// and writes the resulting audio to the specified output file.
+//
+// The audio format is inferred from the output file's extension (e.g., "mp3", "wav") and sent
+// as the "response_format" in the request to the OpenAI speech synthesis endpoint. The configured
+// speed and instructions are sent along.
+//
+// Text longer than the input limit of the endpoint is split at sentence boundaries. The pieces
+// are synthesized concurrently and joined, in order, into a single wav, mp3, opus, aac or pcm file.
+//
+// Parameters:
+//   - inputText: The text to synthesize into speech.
+//   - outputPath: The path to the output audio file. The file extension determines the response format.
+//
+// Returns an error if the request fails, the response cannot be written, or the file cannot be created.
+func (c *Client) SynthesizeSpeech(inputText, outputPath string) error {
+	data, err := c.synthesize(c.Config.Model, inputText, getExtension(outputPath))
+	if err != nil {
+		return err
+	}
+
+	outFile, err := c.writer.Create(outputPath)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %w", err)
+	}
+	defer outFile.Close()
+
+	if err := c.writer.Write(outFile, data); err != nil {
+		return fmt.Errorf("failed to write binary: %w", err)
+	}
+
+	c.printResponseDebugInfo([]byte(fmt.Sprintf("[binary] %d bytes written to %s", len(data), outputPath)))
+	return nil
+}
+
+// Speak synthesizes the text as a wav file for playback, using the speech model rather than
+// the chat model so that answers can be read aloud.
+func (c *Client) Speak(text string) ([]byte, error) {
+	return c.synthesize(c.Config.SpeechModel, text, "wav")
+}
+
+func (c *Client) synthesize(model, text, format string) ([]byte, error) {
+	pieces := splitSpeechText(text, maxSpeechInput)
+	if len(pieces) <= 1 {
+		return c.postSpeech(model, text, format)
+	}
+
+	// The endpoint defaults to mp3 when no format is given.
+	join := map[string]func([][]byte) ([]byte, error){
+		"":     joinMP3,
+		"mp3":  joinMP3,
+		"wav":  audio.JoinWAV,
+		"opus": audio.JoinOgg,
+		"aac":  joinBytes,
+		"pcm":  joinBytes,
+	}[format]
+	if join == nil {
+		return nil, fmt.Errorf("text of %d characters is too long for a single %s file, use wav, mp3, opus, aac or pcm", utf8.RuneCountInString(text), format)
+	}
+
+	parts := make([][]byte, len(pieces))
+	errs := make([]error, len(pieces))
+	sem := make(chan struct{}, defaultConcurrency)
+
+	var wg sync.WaitGroup
+	for i, piece := range pieces {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			parts[i], errs[i] = c.postSpeech(model, piece, format)
+		}()
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			return nil, fmt.Errorf("part %d of %d: %w", i+1, len(pieces), err)
+		}
+	}
+
+	return join(parts)
+}
+
+func (c *Client) postSpeech(model, text, format string) ([]byte, error) {
+	req := api.Speech{
+		Model:          model,
+		Voice:          c.Config.Voice,
+		Input:          text,
+		ResponseFormat: format,
+		Speed:          c.Config.SpeechSpeed,
+		Instructions:   c.Config.SpeechInstructions,
+	}
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	endpoint := c.getEndpoint(c.Config.SpeechPath)
+	c.printRequestDebugInfo(endpoint, body, nil)
+
+	data, err := c.Caller.Post(endpoint, body, false)
+	if err != nil {
+		return nil, fmt.Errorf("API request failed: %w", err)
+	}
+	return data, nil
+}
+
+func joinMP3(parts [][]byte) ([]byte, error) {
+	return audio.JoinMP3(parts), nil
+}
+
+func joinBytes(parts [][]byte) ([]byte, error) {
+	var out []byte
+	for _, part := range parts {
+		out = append(out, part...)
+	}
+	return out, nil
+}
+
+// splitSpeechText packs whole sentences into pieces of at most limit characters. Sentences
+// that are longer by themselves are cut between words.
+func splitSpeechText(text string, limit int) []string {
+	if utf8.RuneCountInString(text) <= limit {
+		return []string{text}
+	}
+
+	var pieces []string
+	var current strings.Builder
+	flush := func() {
+		if strings.TrimSpace(current.String()) != "" {
+			pieces = append(pieces, current.String())
+		}
+		current.Reset()
+	}
+
+	for _, sentence := range splitSentences(text) {
+		if utf8.RuneCountInString(current.String())+utf8.RuneCountInString(sentence) > limit {
+			flush()
+		}
+		for utf8.RuneCountInString(sentence) > limit {
+			cut := cutBeforeLimit(sentence, limit)
+			current.WriteString(sentence[:cut])
+			flush()
+			sentence = sentence[cut:]
+		}
+		current.WriteString(sentence)
+	}
+	flush()
+
+	return pieces
+}
+
+// splitSentences splits text after sentence-ending punctuation followed by whitespace and
+// after every newline. The pieces keep their trailing spaces, so they join back into text.
+func splitSentences(text string) []string {
+	var sentences []string
+	start := 0
+
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		i += size
+
+		if r != '\n' && !(strings.ContainsRune(sentenceEnd, r) && i < len(text) && unicode.IsSpace(rune(text[i]))) {
+			continue
+		}
+		for i < len(text) && text[i] == ' ' {
+			i++
+		}
+		sentences = append(sentences, text[start:i])
+		start = i
+	}
+
+	if start < len(text) {
+		sentences = append(sentences, text[start:])
+	}
+	return sentences
+}
+
+// sentenceEnded reports whether the last piece returned by splitSentences is a complete
+// sentence rather than the start of one.
+func sentenceEnded(s string) bool {
+	if strings.HasSuffix(s, "\n") {
+		return true
+	}
+	trimmed := strings.TrimRight(s, " ")
+	r, _ := utf8.DecodeLastRuneInString(trimmed)
+	return trimmed != s && strings.ContainsRune(sentenceEnd, r)
+}
+
+// cutBeforeLimit returns the byte offset of the last space within the first limit characters
+// of s, or of the limit itself when there is none.
+func cutBeforeLimit(s string, limit int) int {
+	offset, n, lastSpace := 0, 0, -1
+	for i, r := range s {
+		if n == limit {
+			offset = i
+			break
+		}
+		if unicode.IsSpace(r) {
+			lastSpace = i + utf8.RuneLen(r)
+		}
+		n++
+	}
+	if lastSpace > 0 {
+		return lastSpace
+	}
+	return offset
+}
+
+// AnswerSpeaker reads streamed answers aloud while passing them on to the underlying writer.
+// Complete sentences are synthesized concurrently as they arrive and played back in order;
+// code blocks and markdown markup are not spoken. Flush, which the caller invokes at the end
+// of every streamed answer, waits until the answer has been spoken.
+type AnswerSpeaker struct {
+	out        io.Writer
+	synthesize func(text string) ([]byte, error)
+	play       func(audio []byte) error
+
+	pending strings.Builder
+	inCode  bool
+	queue   chan chan speech
+	done    chan error
+	sem     chan struct{}
+}
+
+type speech struct {
+	audio []byte
+	err   error
+}
+
+// NewAnswerSpeaker returns a writer that copies to out and speaks what passes through it,
+// typically using Client.Speak and an audio player.
+func NewAnswerSpeaker(out io.Writer, synthesize func(text string) ([]byte, error), play func(audio []byte) error) *AnswerSpeaker {
+	return &AnswerSpeaker{out: out, synthesize: synthesize, play: play}
+}
+
+func (s *AnswerSpeaker) Write(p []byte) (int, error) {
+	n, err := s.out.Write(p)
+	if err != nil {
+		return n, err
+	}
+
+	s.pending.Write(p)
+	text := s.pending.String()
+	sentences := splitSentences(text)
+
+	// The last sentence may still be incomplete.
+	last := sentences[len(sentences)-1]
+	if !sentenceEnded(last) {
+		sentences = sentences[:len(sentences)-1]
+	} else {
+		last = ""
+	}
+
+	for _, sentence := range sentences {
+		s.say(sentence)
+	}
+	s.pending.Reset()
+	s.pending.WriteString(last)
+
+	return n, nil
+}
+
+// Flush flushes the underlying writer, speaks the rest of the answer and waits for the
+// playback to finish. It returns the first error of the synthesis or playback.
+func (s *AnswerSpeaker) Flush() error {
+	var err error
+	if f, ok := s.out.(interface{ Flush() error }); ok {
+		err = f.Flush()
+	}
+
+	s.say(s.pending.String())
+	s.pending.Reset()
+	s.inCode = false
+
+	if s.queue == nil {
+		return err
+	}
+
+	close(s.queue)
+	if speakErr := <-s.done; err == nil {
+		err = speakErr
+	}
+	s.queue = nil
+	return err
+}
+
+func (s *AnswerSpeaker) say(sentence string) {
+	trimmed := strings.TrimSpace(sentence)
+	if strings.HasPrefix(trimmed, "```") {
+		s.inCode = !s.inCode
+		return
+	}
+	if s.inCode {
+		return
+	}
+
+	text := speakable(trimmed)
+	if text == "" {
+		return
+	}
+
+	if s.queue == nil {
+		s.start()
+	}
+
+	result := make(chan speech, 1)
+	s.queue <- result
+	go func(sem chan struct{}) {
+		sem <- struct{}{}
+		defer func() { <-sem }()
+
+		data, err := s.synthesize(text)
+		result <- speech{audio: data, err: err}
+	}(s.sem)
+}
+
+// start launches the player, which plays the synthesized sentences in the order they were queued.
+func (s *AnswerSpeaker) start() {
+	s.queue = make(chan chan speech, speakerQueueSize)
+	s.done = make(chan error, 1)
+	s.sem = make(chan struct{}, defaultConcurrency)
+
+	go func(queue chan chan speech) {
+		var first error
+		for result := range queue {
+			r := <-result
+			if r.err == nil {
+				r.err = s.play(r.audio)
+			}
+			if r.err != nil && first == nil {
+				first = r.err
+			}
+		}
+		s.done <- first
+	}(s.queue)
+}
+
+// speakable strips the markdown markup from a line of an answer. It returns an empty string
+// when nothing worth saying is left.
+func speakable(line string) string {
+	line = strings.TrimLeft(line, "#>*-+ \t")
+	line = markdownLink.ReplaceAllString(line, "$1")
+	line = strings.NewReplacer("**", "", "__", "", "`", "", "~~", "").Replace(line)
+	line = strings.TrimSpace(line)
+
+	if strings.IndexFunc(line, func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) }) < 0 {
+		return ""
+	}
+	return line
+}
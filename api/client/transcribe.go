@@ -0,0 +1,342 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/kardolus/chatgpt-cli/api"
+	"github.com/kardolus/chatgpt-cli/internal"
+	"github.com/kardolus/chatgpt-cli/internal/audio"
+	"io"
+	"math"
+	"mime/multipart"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	TranscriptJSON        = "json"
+	TranscriptText        = "text"
+	TranscriptVerboseJSON = "verbose_json"
+	TranscriptSRT         = "srt"
+	TranscriptVTT         = "vtt"
+
+	// maxTranscriptionUpload stays just below the 25MB limit of the transcriptions endpoint.
+	maxTranscriptionUpload = 24 << 20
+	defaultChunkSeconds    = 600
+	defaultConcurrency     = 4
+)
+
+// TranscriptFormatForPath returns the transcript format matching the extension of an
+// output file, or an empty string when the extension doesn't name one.
+func TranscriptFormatForPath(path string) string {
+	switch strings.ToLower(getExtension(path)) {
+	case "srt":
+		return TranscriptSRT
+	case "vtt":
+		return TranscriptVTT
+	case "json":
+		return TranscriptVerboseJSON
+	case "txt":
+		return TranscriptText
+	}
+	return ""
+}
+
+// Transcribe uploads an audio file to the OpenAI transcription endpoint and returns the transcript.
+//
+// The transcript is returned in the response_format set in the transcription config (json, text,
+// verbose_json, srt or vtt); json yields the plain text. The configured language and prompt are
+// passed along with the file.
+//
+// WAV recordings that are longer than the configured chunk length, or too large for a single
+// upload, are split at silences. The chunks are transcribed concurrently and stitched back
+// together with their timestamps shifted to the position of the chunk in the recording.
+//
+// Parameters:
+//   - audioPath: The local file path to the audio file to be transcribed.
+//
+// Returns:
+//   - string: The transcript in the configured format.
+//   - error: An error if the file can't be read, the request fails, or the response is invalid.
+//
+// This method supports formats like mp3, mp4, mpeg, mpga, m4a, wav, and webm, depending on API compatibility.
+func (c *Client) Transcribe(audioPath string) (string, error) {
+	c.initHistory()
+
+	file, err := c.reader.Open(audioPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to open audio file: %w", err)
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return "", fmt.Errorf("failed to read audio file: %w", err)
+	}
+
+	var transcript, text string
+	if chunks := c.splitAudio(data); len(chunks) > 1 {
+		transcript, text, err = c.transcribeChunks(filepath.Base(audioPath), chunks)
+	} else {
+		transcript, text, err = c.transcribeFile(filepath.Base(audioPath), data)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	c.recordExchange(fmt.Sprintf("[transcribe] %s", filepath.Base(audioPath)), text)
+
+	return transcript, nil
+}
+
+// TranscribeToFile transcribes an audio file and writes the transcript to outputPath. The
+// extension of the output file (.srt, .vtt, .json or .txt) selects the transcript format,
+// other extensions use the configured one.
+func (c *Client) TranscribeToFile(audioPath, outputPath string) error {
+	if format := TranscriptFormatForPath(outputPath); format != "" {
+		c.Config.Transcription.Format = format
+	}
+
+	transcript, err := c.Transcribe(audioPath)
+	if err != nil {
+		return err
+	}
+
+	outFile, err := c.writer.Create(outputPath)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %w", err)
+	}
+	defer outFile.Close()
+
+	if err := c.writer.Write(outFile, []byte(transcript)); err != nil {
+		return fmt.Errorf("failed to write transcript: %w", err)
+	}
+	return nil
+}
+
+// splitAudio returns the chunks of a WAV recording that needs splitting, or nil when the
+// file can be uploaded as is.
+func (c *Client) splitAudio(data []byte) []audio.Chunk {
+	if !audio.IsWAV(data) {
+		return nil
+	}
+
+	wav, err := audio.ParseWAV(data)
+	if err != nil {
+		return nil
+	}
+
+	seconds := c.Config.Transcription.ChunkSeconds
+	if seconds <= 0 {
+		seconds = defaultChunkSeconds
+	}
+	maxLength := time.Duration(seconds) * time.Second
+	if bySize := time.Duration(maxTranscriptionUpload/wav.ByteRate()) * time.Second; bySize < maxLength {
+		maxLength = bySize
+	}
+
+	if wav.Duration() <= maxLength {
+		return nil
+	}
+	return wav.Split(maxLength)
+}
+
+// transcribeFile uploads a single file in the configured format. It returns the transcript
+// and its plain text for the history.
+func (c *Client) transcribeFile(name string, data []byte) (string, string, error) {
+	format := c.transcriptFormat()
+
+	raw, err := c.postTranscription(name, data, format)
+	if err != nil {
+		return "", "", err
+	}
+
+	switch format {
+	case TranscriptJSON, TranscriptVerboseJSON:
+		var res api.Transcription
+		if err := json.Unmarshal(raw, &res); err != nil {
+			return "", "", fmt.Errorf("failed to parse transcription: %w", err)
+		}
+		if format == TranscriptJSON {
+			return res.Text, res.Text, nil
+		}
+		return string(raw), res.Text, nil
+	default:
+		return string(raw), string(raw), nil
+	}
+}
+
+// transcribeChunks uploads the chunks of a split recording concurrently and stitches the
+// results together in order.
+func (c *Client) transcribeChunks(name string, chunks []audio.Chunk) (string, string, error) {
+	format := c.transcriptFormat()
+
+	// Timestamps are only returned by verbose_json, the subtitle formats are rendered locally.
+	chunkFormat := TranscriptVerboseJSON
+	if format == TranscriptJSON || format == TranscriptText {
+		chunkFormat = TranscriptJSON
+	}
+
+	concurrency := c.Config.Transcription.Concurrency
+	if concurrency <= 0 {
+		concurrency = defaultConcurrency
+	}
+
+	base := strings.TrimSuffix(name, filepath.Ext(name))
+	results := make([]api.Transcription, len(chunks))
+	errs := make([]error, len(chunks))
+	sem := make(chan struct{}, concurrency)
+
+	var wg sync.WaitGroup
+	for i, chunk := range chunks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			raw, err := c.postTranscription(fmt.Sprintf("%s.part%d.wav", base, i+1), chunk.Data, chunkFormat)
+			if err != nil {
+				errs[i] = fmt.Errorf("chunk %d of %d: %w", i+1, len(chunks), err)
+				return
+			}
+			if err := json.Unmarshal(raw, &results[i]); err != nil {
+				errs[i] = fmt.Errorf("failed to parse transcription of chunk %d: %w", i+1, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return "", "", err
+		}
+	}
+
+	merged := stitchTranscriptions(results, chunks)
+
+	switch format {
+	case TranscriptVerboseJSON:
+		out, err := json.MarshalIndent(merged, "", "  ")
+		if err != nil {
+			return "", "", err
+		}
+		return string(out), merged.Text, nil
+	case TranscriptSRT:
+		return formatSRT(merged.Segments), merged.Text, nil
+	case TranscriptVTT:
+		return formatVTT(merged.Segments), merged.Text, nil
+	default:
+		return merged.Text, merged.Text, nil
+	}
+}
+
+func (c *Client) postTranscription(name string, data []byte, format string) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+
+	_ = writer.WriteField("model", c.Config.Model)
+	if format != TranscriptJSON {
+		_ = writer.WriteField("response_format", format)
+	}
+	if c.Config.Transcription.Language != "" {
+		_ = writer.WriteField("language", c.Config.Transcription.Language)
+	}
+	if c.Config.Transcription.Prompt != "" {
+		_ = writer.WriteField("prompt", c.Config.Transcription.Prompt)
+	}
+
+	part, err := writer.CreateFormFile("file", name)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := part.Write(data); err != nil {
+		return nil, err
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	endpoint := c.getEndpoint(c.Config.TranscriptionsPath)
+	headers := map[string]string{
+		internal.HeaderContentTypeKey: writer.FormDataContentType(),
+		c.Config.AuthHeader:           fmt.Sprintf("%s %s", c.Config.AuthTokenPrefix, c.Config.APIKey),
+	}
+
+	c.printRequestDebugInfo(endpoint, buf.Bytes(), headers)
+
+	raw, err := c.Caller.PostWithHeaders(endpoint, buf.Bytes(), headers)
+	if err != nil {
+		return nil, err
+	}
+
+	c.printResponseDebugInfo(raw)
+
+	return raw, nil
+}
+
+func (c *Client) transcriptFormat() string {
+	if c.Config.Transcription.Format == "" {
+		return TranscriptJSON
+	}
+	return c.Config.Transcription.Format
+}
+
+// stitchTranscriptions joins the transcripts of consecutive chunks, shifting every segment by
+// the start of its chunk and renumbering them.
+func stitchTranscriptions(parts []api.Transcription, chunks []audio.Chunk) api.Transcription {
+	var merged api.Transcription
+	var texts []string
+
+	for i, part := range parts {
+		offset := chunks[i].Start.Seconds()
+
+		if merged.Language == "" {
+			merged.Language = part.Language
+		}
+		if text := strings.TrimSpace(part.Text); text != "" {
+			texts = append(texts, text)
+		}
+		for _, seg := range part.Segments {
+			seg.ID = len(merged.Segments)
+			seg.Start += offset
+			seg.End += offset
+			merged.Segments = append(merged.Segments, seg)
+		}
+		if part.Duration > 0 {
+			merged.Duration = offset + part.Duration
+		}
+	}
+
+	merged.Text = strings.Join(texts, " ")
+	return merged
+}
+
+func formatSRT(segments []api.TranscriptionSegment) string {
+	var sb strings.Builder
+	for i, seg := range segments {
+		fmt.Fprintf(&sb, "%d\n%s --> %s\n%s\n\n", i+1,
+			formatTimestamp(seg.Start, ","), formatTimestamp(seg.End, ","), strings.TrimSpace(seg.Text))
+	}
+	return sb.String()
+}
+
+func formatVTT(segments []api.TranscriptionSegment) string {
+	var sb strings.Builder
+	sb.WriteString("WEBVTT\n\n")
+	for _, seg := range segments {
+		fmt.Fprintf(&sb, "%s --> %s\n%s\n\n",
+			formatTimestamp(seg.Start, "."), formatTimestamp(seg.End, "."), strings.TrimSpace(seg.Text))
+	}
+	return sb.String()
+}
+
+// formatTimestamp renders seconds as HH:MM:SS followed by the separator and milliseconds.
+func formatTimestamp(seconds float64, sep string) string {
+	ms := int64(math.Round(seconds * 1000))
+	return fmt.Sprintf("%02d:%02d:%02d%s%03d", ms/3600000, ms/60000%60, ms/1000%60, sep, ms%1000)
+}
@@ -0,0 +1,63 @@
+package client
+
+import (
+	"fmt"
+	"github.com/kardolus/chatgpt-cli/api"
+	"github.com/kardolus/chatgpt-cli/internal/usage"
+)
+
+const (
+	ErrNoPrice  = "max_cost_usd is set but model %q has no price, add one under usage.prices"
+	ErrOverCost = "this request could cost up to $%.4f, over max_cost_usd ($%.4f); lower max_tokens or start a new thread"
+)
+
+// checkCost refuses a request that could cost more than max_cost_usd: the approximate input
+// tokens of the thread plus max_tokens of output, at the price of the model.
+func (c *Client) checkCost() error {
+	limit := c.Config.MaxCostUSD
+	if limit <= 0 {
+		return nil
+	}
+
+	price, ok := usage.NewPrices(c.Config.Usage.Prices).Lookup(c.Config.Model)
+	if !ok {
+		return fmt.Errorf(ErrNoPrice, c.Config.Model)
+	}
+
+	input, _ := countTokens(c.History)
+	if cost := price.Cost(usage.Tokens{Input: input, Output: c.Config.MaxTokens}); cost > limit {
+		return fmt.Errorf(ErrOverCost, cost, limit)
+	}
+	return nil
+}
+
+// recordUsage tells the OnUsage functions what a request used.
+func (c *Client) recordUsage(u api.TokenUsage) {
+	observed := false
+	for _, f := range c.onUsage {
+		observed = observed || f != nil
+	}
+	if !observed {
+		return
+	}
+
+	r := usage.NewRecord(usage.NewPrices(c.Config.Usage.Prices), c.timer.Now(), c.Config.Model, usage.Tokens{
+		Input:       u.InputTokens,
+		CachedInput: u.InputTokensDetails.CachedTokens,
+		Output:      u.OutputTokens,
+		Reasoning:   u.OutputTokensDetails.ReasoningTokens,
+	})
+	r.Thread = c.Config.Thread
+	if c.historyStore != nil {
+		if thread := c.historyStore.GetThread(); thread != "" {
+			r.Thread = thread
+		}
+	}
+	r.Team = c.Config.Usage.Team
+
+	for _, f := range c.onUsage {
+		if f != nil {
+			f(r)
+		}
+	}
+}
@@ -1,6 +1,9 @@
 package api
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"strings"
+)
 
 // Float64 is a custom type that wraps float64 and implements a custom YAML marshaller.
 type Float64 float64
@@ -14,15 +17,21 @@ func (f Float64) MarshalJSON() ([]byte, error) {
 }
 
 type CompletionsRequest struct {
-	Model            string    `json:"model"`
-	Temperature      float64   `json:"temperature,omitempty"`
-	TopP             float64   `json:"top_p,omitempty"`
-	FrequencyPenalty float64   `json:"frequency_penalty,omitempty"`
-	MaxTokens        int       `json:"max_completion_tokens"`
-	PresencePenalty  float64   `json:"presence_penalty,omitempty"`
-	Messages         []Message `json:"messages"`
-	Stream           bool      `json:"stream"`
-	Seed             int       `json:"seed,omitempty"`
+	Model            string         `json:"model"`
+	Temperature      float64        `json:"temperature,omitempty"`
+	TopP             float64        `json:"top_p,omitempty"`
+	FrequencyPenalty float64        `json:"frequency_penalty,omitempty"`
+	MaxTokens        int            `json:"max_completion_tokens"`
+	PresencePenalty  float64        `json:"presence_penalty,omitempty"`
+	Messages         []Message      `json:"messages"`
+	Stream           bool           `json:"stream"`
+	StreamOptions    *StreamOptions `json:"stream_options,omitempty"`
+	Seed             int            `json:"seed,omitempty"`
+}
+
+// StreamOptions asks for the usage of a streamed completion, sent in a last chunk without choices.
+type StreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
 }
 
 type Message struct {
@@ -42,6 +51,72 @@ type InputAudio struct {
 	Format string `json:"format"`
 }
 
+const (
+	TextPartType  = "text"
+	ImagePartType = "image_url"
+	AudioPartType = "input_audio"
+	FilePartType  = "file"
+)
+
+// ContentPart is one element of a multimodal message. A user message can mix several
+// text, image and audio parts; this is the Chat Completions shape, which is also the
+// shape stored in the thread history.
+type ContentPart struct {
+	Type       string      `json:"type"`
+	Text       string      `json:"text,omitempty"`
+	ImageURL   *ImageURL   `json:"image_url,omitempty"`
+	InputAudio *InputAudio `json:"input_audio,omitempty"`
+	File       *File       `json:"file,omitempty"`
+}
+
+type ImageURL struct {
+	URL string `json:"url"`
+}
+
+// File carries a document, such as a PDF, as a base64 data URL.
+type File struct {
+	Filename string `json:"filename,omitempty"`
+	FileData string `json:"file_data,omitempty"`
+}
+
+// ContentParts returns the parts of a message content. Besides []ContentPart it accepts
+// the generic form produced when a history file is decoded into an interface{}.
+func ContentParts(content interface{}) ([]ContentPart, bool) {
+	switch v := content.(type) {
+	case []ContentPart:
+		return v, true
+	case []interface{}:
+		raw, err := json.Marshal(v)
+		if err != nil {
+			return nil, false
+		}
+		var parts []ContentPart
+		if err := json.Unmarshal(raw, &parts); err != nil {
+			return nil, false
+		}
+		return parts, true
+	}
+	return nil, false
+}
+
+// ContentText returns the text of a message content. For multimodal content the text
+// parts are joined and the media parts are left out.
+func ContentText(content interface{}) string {
+	if s, ok := content.(string); ok {
+		return s
+	}
+
+	parts, _ := ContentParts(content)
+
+	var texts []string
+	for _, p := range parts {
+		if p.Type == TextPartType && p.Text != "" {
+			texts = append(texts, p.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
 type ImageContent struct {
 	Type     string `json:"type"`
 	ImageURL struct {
@@ -59,9 +134,26 @@ type CompletionsResponse struct {
 }
 
 type Usage struct {
-	PromptTokens     int `json:"prompt_tokens"`
-	CompletionTokens int `json:"completion_tokens"`
-	TotalTokens      int `json:"total_tokens"`
+	PromptTokens        int `json:"prompt_tokens"`
+	PromptTokensDetails struct {
+		CachedTokens int `json:"cached_tokens"`
+	} `json:"prompt_tokens_details"`
+	CompletionTokens        int `json:"completion_tokens"`
+	CompletionTokensDetails struct {
+		ReasoningTokens int `json:"reasoning_tokens"`
+	} `json:"completion_tokens_details"`
+	TotalTokens int `json:"total_tokens"`
+}
+
+// TokenUsage returns the usage in the shape of the Responses API.
+func (u Usage) TokenUsage() TokenUsage {
+	var t TokenUsage
+	t.InputTokens = u.PromptTokens
+	t.InputTokensDetails.CachedTokens = u.PromptTokensDetails.CachedTokens
+	t.OutputTokens = u.CompletionTokens
+	t.OutputTokensDetails.ReasoningTokens = u.CompletionTokensDetails.ReasoningTokens
+	t.TotalTokens = u.TotalTokens
+	return t
 }
 
 type Choice struct {
@@ -84,6 +176,7 @@ type Data struct {
 		Index        int                    `json:"index"`
 		FinishReason string                 `json:"finish_reason"`
 	} `json:"choices"`
+	Usage *Usage `json:"usage,omitempty"`
 }
 
 type ErrorResponse struct {
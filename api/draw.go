@@ -1,6 +1,11 @@
 package api
 
 type Draw struct {
-	Model  string `json:"model"`
-	Prompt string `json:"prompt"`
+	Model        string `json:"model"`
+	Prompt       string `json:"prompt"`
+	Size         string `json:"size,omitempty"`
+	Quality      string `json:"quality,omitempty"`
+	N            int    `json:"n,omitempty"`
+	Background   string `json:"background,omitempty"`
+	OutputFormat string `json:"output_format,omitempty"`
 }
@@ -3,6 +3,7 @@ package http
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"crypto/tls"
 	"encoding/json"
 	"fmt"
@@ -28,14 +29,54 @@ const (
 
 type Caller interface {
 	Post(url string, body []byte, stream bool) ([]byte, error)
+	StreamResponse(url string, body []byte) ([]byte, api.TokenUsage, error)
 	PostWithHeaders(url string, body []byte, headers map[string]string) ([]byte, error)
 	Get(url string) ([]byte, error)
 	PostWithHeadersResponse(url string, body []byte, headers map[string]string) (api.HTTPResponse, error)
+	Request(ctx context.Context, method, url string, body []byte, headers map[string]string, maxBytes int64) (api.HTTPResponse, error)
+}
+
+// StatusError is returned for a response with a non-2xx status. Body holds what the server
+// sent, usually an OpenAI error object, so it can be passed on as is.
+type StatusError struct {
+	Status  int
+	Message string
+	Body    []byte
+}
+
+func (e *StatusError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf(errHTTPStatus, e.Status)
+	}
+	return fmt.Sprintf(errHTTP, e.Status, e.Message)
+}
+
+// newStatusError reads the body of a failed response and the message of its error object.
+func newStatusError(resp *http.Response) *StatusError {
+	statusErr := &StatusError{Status: resp.StatusCode}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return statusErr
+	}
+	statusErr.Body = body
+
+	var errorData api.ErrorResponse
+	if err := json.Unmarshal(body, &errorData); err == nil {
+		statusErr.Message = errorData.Error.Message
+	}
+	return statusErr
 }
 
 type RestCaller struct {
 	client *http.Client
 	config config.Config
+	output io.Writer
+}
+
+// flusher is implemented by output writers that buffer, such as the markdown renderer.
+type flusher interface {
+	Flush() error
 }
 
 // Ensure RestCaller implements Caller interface
@@ -62,6 +103,12 @@ func RealCallerFactory(cfg config.Config) Caller {
 	return New(cfg)
 }
 
+// WithOutput sets the writer streamed responses are printed to. Defaults to os.Stdout.
+func (r *RestCaller) WithOutput(w io.Writer) *RestCaller {
+	r.output = w
+	return r
+}
+
 func (r *RestCaller) Get(url string) ([]byte, error) {
 	return r.doRequest(http.MethodGet, url, nil, false)
 }
@@ -70,6 +117,39 @@ func (r *RestCaller) Post(url string, body []byte, stream bool) ([]byte, error)
 	return r.doRequest(http.MethodPost, url, body, stream)
 }
 
+// StreamResponse POSTs the body and prints the streamed answer as it arrives, like Post with
+// stream set. It also returns the usage sent at the end of the stream, which is zero when the
+// API didn't send one.
+func (r *RestCaller) StreamResponse(url string, body []byte) ([]byte, api.TokenUsage, error) {
+	return r.doRequestWithUsage(http.MethodPost, url, body, true)
+}
+
+// PostStream POSTs the body and copies the raw response (typically an SSE stream) to w
+// as it arrives, without interpreting it. Non-2xx responses are returned as errors
+// before anything is written to w. Cancelling ctx ends the request.
+func (r *RestCaller) PostStream(ctx context.Context, url string, body []byte, w io.Writer) error {
+	req, err := r.newRequest(ctx, http.MethodPost, url, body)
+	if err != nil {
+		return fmt.Errorf(errFailedToCreateRequest, err)
+	}
+
+	response, err := r.client.Do(req)
+	if err != nil {
+		return fmt.Errorf(errFailedToMakeRequest, err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return newStatusError(response)
+	}
+
+	if _, err := io.Copy(w, response.Body); err != nil {
+		return fmt.Errorf(errFailedToRead, err)
+	}
+
+	return nil
+}
+
 func (r *RestCaller) PostWithHeaders(url string, body []byte, headers map[string]string) ([]byte, error) {
 	req, err := http.NewRequest(http.MethodPost, url, bytes.NewBuffer(body))
 	if err != nil {
@@ -162,15 +242,80 @@ func (r *RestCaller) PostWithHeadersResponse(url string, body []byte, headers ma
 	return out, nil
 }
 
-func (r *RestCaller) ProcessResponse(reader io.Reader, writer io.Writer, endpoint string) []byte {
+// Request sends a request to a host other than the API: only the given headers are set,
+// so the API key isn't sent along. Responses of any status are returned without an error
+// and redirects aren't followed, leaving both to the caller. At most maxBytes of the body
+// are read (0 reads it all), so a huge response can't fill up memory.
+func (r *RestCaller) Request(ctx context.Context, method, url string, body []byte, headers map[string]string, maxBytes int64) (api.HTTPResponse, error) {
+	client := http.DefaultClient
+	if r.client != nil {
+		client = r.client
+	}
+	noRedirects := *client
+	noRedirects.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	var reader io.Reader
+	if len(body) > 0 {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, reader)
+	if err != nil {
+		return api.HTTPResponse{}, fmt.Errorf(errFailedToCreateRequest, err)
+	}
+	if r.config.UserAgent != "" {
+		req.Header.Set(internal.HeaderUserAgentKey, r.config.UserAgent)
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := noRedirects.Do(req)
+	if err != nil {
+		return api.HTTPResponse{}, fmt.Errorf(errFailedToMakeRequest, err)
+	}
+	defer resp.Body.Close()
+
+	var bodyReader io.Reader = resp.Body
+	if maxBytes > 0 {
+		bodyReader = io.LimitReader(resp.Body, maxBytes+1)
+	}
+	respBody, err := io.ReadAll(bodyReader)
+	if err != nil {
+		return api.HTTPResponse{}, fmt.Errorf(errFailedToRead, err)
+	}
+	truncated := maxBytes > 0 && int64(len(respBody)) > maxBytes
+	if truncated {
+		respBody = respBody[:maxBytes]
+	}
+
+	outHeaders := map[string]string{}
+	for k, vals := range resp.Header {
+		if len(vals) == 0 {
+			continue
+		}
+		outHeaders[k] = strings.Join(vals, ", ")
+	}
+
+	return api.HTTPResponse{Status: resp.StatusCode, Headers: outHeaders, Body: respBody, Truncated: truncated}, nil
+}
+
+// ProcessResponse prints a streamed answer to writer and returns it along with the usage
+// reported by the stream: the response.completed event of the Responses API, or the last
+// chunk of a Chat Completions stream requested with stream_options.include_usage.
+func (r *RestCaller) ProcessResponse(reader io.Reader, writer io.Writer, endpoint string) ([]byte, api.TokenUsage) {
 	if strings.Contains(endpoint, r.config.ResponsesPath) {
 		return r.processResponsesSSE(reader, writer)
 	}
 	return r.processLegacy(reader, writer)
 }
 
-func (r *RestCaller) processLegacy(reader io.Reader, writer io.Writer) []byte {
-	var result []byte
+func (r *RestCaller) processLegacy(reader io.Reader, writer io.Writer) ([]byte, api.TokenUsage) {
+	var (
+		result []byte
+		usage  api.TokenUsage
+	)
 	sugar := zap.S()
 	sugar.Debugln("\nResponse\n")
 
@@ -204,14 +349,18 @@ func (r *RestCaller) processLegacy(reader io.Reader, writer io.Writer) []byte {
 					result = append(result, content...)
 				}
 			}
+			if data.Usage != nil {
+				usage = data.Usage.TokenUsage()
+			}
 		}
 	}
-	return result
+	return result, usage
 }
 
-func (r *RestCaller) processResponsesSSE(reader io.Reader, writer io.Writer) []byte {
+func (r *RestCaller) processResponsesSSE(reader io.Reader, writer io.Writer) ([]byte, api.TokenUsage) {
 	var (
 		result   []byte
+		usage    api.TokenUsage
 		curEvent string
 		done     bool
 		sugar    = zap.S()
@@ -254,6 +403,7 @@ func (r *RestCaller) processResponsesSSE(reader io.Reader, writer io.Writer) []b
 					Choices []struct {
 						Delta map[string]any `json:"delta"`
 					} `json:"choices"`
+					Usage *api.Usage `json:"usage"`
 				}
 				if err := json.Unmarshal([]byte(payload), &legacy); err != nil {
 					_, _ = fmt.Fprintf(writer, "Error: %s\n", err.Error())
@@ -265,6 +415,9 @@ func (r *RestCaller) processResponsesSSE(reader io.Reader, writer io.Writer) []b
 						result = append(result, s...)
 					}
 				}
+				if legacy.Usage != nil {
+					usage = legacy.Usage.TokenUsage()
+				}
 				continue
 			}
 
@@ -273,7 +426,8 @@ func (r *RestCaller) processResponsesSSE(reader io.Reader, writer io.Writer) []b
 				Delta    string `json:"delta"` // response.output_text.delta
 				Text     string `json:"text"`  // response.output_text.done/content_part.done (optional)
 				Response struct {
-					Status string `json:"status"`
+					Status string         `json:"status"`
+					Usage  api.TokenUsage `json:"usage"`
 				} `json:"response"`
 			}
 			if err := json.Unmarshal([]byte(payload), &env); err != nil {
@@ -292,6 +446,7 @@ func (r *RestCaller) processResponsesSSE(reader io.Reader, writer io.Writer) []b
 					_, _ = writer.Write([]byte("\n"))
 					result = append(result, '\n')
 				}
+				usage = env.Response.Usage
 				done = true
 			default:
 				// ignore other SSE types
@@ -302,49 +457,59 @@ func (r *RestCaller) processResponsesSSE(reader io.Reader, writer io.Writer) []b
 			break
 		}
 	}
-	return result
+	return result, usage
 }
 
 func (r *RestCaller) doRequest(method, url string, body []byte, stream bool) ([]byte, error) {
-	req, err := r.newRequest(method, url, body)
+	result, _, err := r.doRequestWithUsage(method, url, body, stream)
+	return result, err
+}
+
+func (r *RestCaller) doRequestWithUsage(method, url string, body []byte, stream bool) ([]byte, api.TokenUsage, error) {
+	var usage api.TokenUsage
+
+	req, err := r.newRequest(context.Background(), method, url, body)
 	if err != nil {
-		return nil, fmt.Errorf(errFailedToCreateRequest, err)
+		return nil, usage, fmt.Errorf(errFailedToCreateRequest, err)
 	}
 
 	response, err := r.client.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf(errFailedToMakeRequest, err)
+		return nil, usage, fmt.Errorf(errFailedToMakeRequest, err)
 	}
 	defer response.Body.Close()
 
 	if response.StatusCode < 200 || response.StatusCode >= 300 {
-		errorResponse, err := io.ReadAll(response.Body)
-		if err != nil {
-			return nil, fmt.Errorf(errHTTPStatus, response.StatusCode)
-		}
-
-		var errorData api.ErrorResponse
-		if err := json.Unmarshal(errorResponse, &errorData); err != nil {
-			return nil, fmt.Errorf(errHTTPStatus, response.StatusCode)
+		statusErr := newStatusError(response)
+		if statusErr.Message == "" {
+			return nil, usage, statusErr
 		}
-
-		return errorResponse, fmt.Errorf(errHTTP, response.StatusCode, errorData.Error.Message)
+		return statusErr.Body, usage, statusErr
 	}
 
 	if stream {
-		return r.ProcessResponse(response.Body, os.Stdout, url), nil
+		out := r.output
+		if out == nil {
+			out = os.Stdout
+		}
+
+		result, usage := r.ProcessResponse(response.Body, out, url)
+		if f, ok := out.(flusher); ok {
+			_ = f.Flush()
+		}
+		return result, usage, nil
 	}
 
 	result, err := io.ReadAll(response.Body)
 	if err != nil {
-		return nil, fmt.Errorf(errFailedToRead, err)
+		return nil, usage, fmt.Errorf(errFailedToRead, err)
 	}
 
-	return result, nil
+	return result, usage, nil
 }
 
-func (r *RestCaller) newRequest(method, url string, body []byte) (*http.Request, error) {
-	req, err := http.NewRequest(method, url, bytes.NewBuffer(body))
+func (r *RestCaller) newRequest(ctx context.Context, method, url string, body []byte) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewBuffer(body))
 	if err != nil {
 		return nil, err
 	}
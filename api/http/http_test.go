@@ -2,11 +2,14 @@ package http_test
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"io"
 	stdhttp "net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/kardolus/chatgpt-cli/api/http"
 	chatgpthttp "github.com/kardolus/chatgpt-cli/api/http"
@@ -35,17 +38,33 @@ func testHTTP(t *testing.T, when spec.G, it spec.S) {
 			buf := &bytes.Buffer{}
 			// legacy works via both branches; use a non-responses endpoint to
 			// ensure we exercise the original/legacy code path.
-			subject.ProcessResponse(strings.NewReader(legacyStream), buf, "/v1/chat/completions")
+			result, usage := subject.ProcessResponse(strings.NewReader(legacyStream), buf, "/v1/chat/completions")
 			output := buf.String()
 			Expect(output).To(Equal("a b c\n"))
+			Expect(string(result)).To(Equal("a b c\n"))
+			Expect(usage.InputTokens).To(Equal(9))
+			Expect(usage.InputTokensDetails.CachedTokens).To(Equal(4))
+			Expect(usage.OutputTokens).To(Equal(3))
+			Expect(usage.TotalTokens).To(Equal(12))
 		})
 
 		it("parses a GPT-5 SSE stream when endpoint is /v1/responses", func() {
 			buf := &bytes.Buffer{}
-			subject.ProcessResponse(strings.NewReader(gpt5Stream), buf, responsesPath)
+			_, usage := subject.ProcessResponse(strings.NewReader(gpt5Stream), buf, responsesPath)
 			output := buf.String()
 			// deltas are "a", " b", " c" then response.completed -> newline
 			Expect(output).To(Equal("a b c\n"))
+			Expect(usage.InputTokens).To(Equal(20))
+			Expect(usage.OutputTokens).To(Equal(7))
+			Expect(usage.OutputTokensDetails.ReasoningTokens).To(Equal(5))
+			Expect(usage.TotalTokens).To(Equal(27))
+		})
+
+		it("reports no usage when the stream has none", func() {
+			stream := strings.Replace(legacyStream, `"usage"`, `"ignored"`, 1)
+
+			_, usage := subject.ProcessResponse(strings.NewReader(stream), &bytes.Buffer{}, "/v1/chat/completions")
+			Expect(usage.TotalTokens).To(BeZero())
 		})
 
 		it("throws an error when the legacy json is invalid", func() {
@@ -134,6 +153,91 @@ func testHTTP(t *testing.T, when spec.G, it spec.S) {
 		})
 	})
 
+	when("WithOutput()", func() {
+		it("streams to the configured writer and flushes it at the end", func() {
+			t.Parallel()
+
+			server := httptest.NewServer(stdhttp.HandlerFunc(func(w stdhttp.ResponseWriter, r *stdhttp.Request) {
+				_, _ = w.Write([]byte(legacyStream))
+			}))
+			defer server.Close()
+
+			out := &flushingBuffer{}
+			subject := chatgpthttp.New(config.Config{ResponsesPath: responsesPath}).WithOutput(out)
+
+			result, err := subject.Post(server.URL+"/v1/chat/completions", []byte(`{}`), true)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(result)).To(Equal("a b c\n"))
+			Expect(out.String()).To(Equal("a b c\n"))
+			Expect(out.flushed).To(Equal(1))
+		})
+	})
+
+	when("StreamResponse()", func() {
+		it("prints the answer and returns it with the usage of the stream", func() {
+			t.Parallel()
+
+			server := httptest.NewServer(stdhttp.HandlerFunc(func(w stdhttp.ResponseWriter, r *stdhttp.Request) {
+				Expect(r.Method).To(Equal(stdhttp.MethodPost))
+				_, _ = w.Write([]byte(gpt5Stream))
+			}))
+			defer server.Close()
+
+			out := &flushingBuffer{}
+			subject := chatgpthttp.New(config.Config{ResponsesPath: responsesPath}).WithOutput(out)
+
+			result, usage, err := subject.StreamResponse(server.URL+responsesPath, []byte(`{}`))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(result)).To(Equal("a b c\n"))
+			Expect(out.String()).To(Equal("a b c\n"))
+			Expect(usage.TotalTokens).To(Equal(27))
+		})
+	})
+
+	when("PostStream()", func() {
+		it("copies the raw upstream stream to the writer", func() {
+			t.Parallel()
+
+			server := httptest.NewServer(stdhttp.HandlerFunc(func(w stdhttp.ResponseWriter, r *stdhttp.Request) {
+				Expect(r.Method).To(Equal(stdhttp.MethodPost))
+				Expect(r.Header.Get("Authorization")).To(Equal("Bearer key"))
+
+				w.Header().Set("Content-Type", "text/event-stream")
+				_, _ = w.Write([]byte(legacyStream))
+			}))
+			defer server.Close()
+
+			subject := chatgpthttp.New(config.Config{APIKey: "key", AuthHeader: "Authorization", AuthTokenPrefix: "Bearer "})
+
+			var buf bytes.Buffer
+			err := subject.PostStream(context.Background(), server.URL, []byte(`{"stream":true}`), &buf)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(buf.String()).To(Equal(legacyStream))
+		})
+
+		it("returns an error and writes nothing on non-2xx", func() {
+			t.Parallel()
+
+			server := httptest.NewServer(stdhttp.HandlerFunc(func(w stdhttp.ResponseWriter, r *stdhttp.Request) {
+				w.WriteHeader(stdhttp.StatusTooManyRequests)
+				_, _ = w.Write([]byte(`{"error":{"message":"slow down"}}`))
+			}))
+			defer server.Close()
+
+			subject := chatgpthttp.New(config.Config{})
+
+			var buf bytes.Buffer
+			err := subject.PostStream(context.Background(), server.URL, []byte(`{}`), &buf)
+			Expect(err).To(MatchError("http status 429: slow down"))
+			Expect(buf.Len()).To(BeZero())
+
+			var statusErr *chatgpthttp.StatusError
+			Expect(errors.As(err, &statusErr)).To(BeTrue())
+			Expect(statusErr.Status).To(Equal(stdhttp.StatusTooManyRequests))
+			Expect(string(statusErr.Body)).To(Equal(`{"error":{"message":"slow down"}}`))
+		})
+	})
+
 	when("PostWithHeaders()", func() {
 		it("attaches headers and returns the response body on success", func() {
 			t.Parallel()
@@ -229,6 +333,93 @@ func testHTTP(t *testing.T, when spec.G, it spec.S) {
 			Expect(v).To(Equal("sid-rotated"))
 		})
 	})
+
+	when("Request()", func() {
+		it("sends only the given headers and returns any status without an error", func() {
+			server := httptest.NewServer(stdhttp.HandlerFunc(func(w stdhttp.ResponseWriter, r *stdhttp.Request) {
+				Expect(r.Method).To(Equal(stdhttp.MethodPut))
+				Expect(r.Header.Get("Authorization")).To(BeEmpty())
+				Expect(r.Header.Get("X-Custom")).To(BeEmpty())
+				Expect(r.Header.Get("X-Test")).To(Equal("abc"))
+				Expect(r.Header.Get("User-Agent")).To(Equal("chatgpt-cli"))
+				body, _ := io.ReadAll(r.Body)
+				Expect(string(body)).To(Equal("payload"))
+
+				w.Header().Set("Content-Type", "text/plain")
+				w.WriteHeader(stdhttp.StatusTeapot)
+				_, _ = w.Write([]byte("short and stout"))
+			}))
+			defer server.Close()
+
+			subject := chatgpthttp.New(config.Config{
+				APIKey:          "secret",
+				AuthHeader:      "Authorization",
+				AuthTokenPrefix: "Bearer ",
+				UserAgent:       "chatgpt-cli",
+				CustomHeaders:   map[string]string{"X-Custom": "1"},
+			})
+
+			resp, err := subject.Request(context.Background(), stdhttp.MethodPut, server.URL, []byte("payload"), map[string]string{"X-Test": "abc"}, 0)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.Status).To(Equal(stdhttp.StatusTeapot))
+			Expect(resp.Headers["Content-Type"]).To(Equal("text/plain"))
+			Expect(string(resp.Body)).To(Equal("short and stout"))
+			Expect(resp.Truncated).To(BeFalse())
+		})
+
+		it("reads no more than maxBytes of the body", func() {
+			server := httptest.NewServer(stdhttp.HandlerFunc(func(w stdhttp.ResponseWriter, r *stdhttp.Request) {
+				chunk := bytes.Repeat([]byte("x"), 64*1024)
+				for i := 0; i < 256; i++ {
+					if _, err := w.Write(chunk); err != nil {
+						return
+					}
+				}
+			}))
+			defer server.Close()
+
+			resp, err := subject.Request(context.Background(), stdhttp.MethodGet, server.URL, nil, nil, 10)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(resp.Body)).To(Equal("xxxxxxxxxx"))
+			Expect(resp.Truncated).To(BeTrue())
+
+			resp, err = subject.Request(context.Background(), stdhttp.MethodGet, server.URL, nil, nil, 16*1024*1024)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.Body).To(HaveLen(16 * 1024 * 1024))
+			Expect(resp.Truncated).To(BeFalse())
+		})
+
+		it("gives up when the context is done", func() {
+			release := make(chan struct{})
+			server := httptest.NewServer(stdhttp.HandlerFunc(func(w stdhttp.ResponseWriter, r *stdhttp.Request) {
+				select {
+				case <-r.Context().Done():
+				case <-release:
+				}
+			}))
+			defer server.Close()
+			defer close(release)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+
+			_, err := subject.Request(ctx, stdhttp.MethodGet, server.URL, nil, nil, 0)
+			Expect(err).To(MatchError(ContainSubstring("context deadline exceeded")))
+		})
+
+		it("does not follow redirects", func() {
+			server := httptest.NewServer(stdhttp.HandlerFunc(func(w stdhttp.ResponseWriter, r *stdhttp.Request) {
+				Expect(r.URL.Path).To(Equal("/old"))
+				stdhttp.Redirect(w, r, "https://elsewhere.example/new", stdhttp.StatusFound)
+			}))
+			defer server.Close()
+
+			resp, err := subject.Request(context.Background(), stdhttp.MethodGet, server.URL+"/old", nil, nil, 0)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.Status).To(Equal(stdhttp.StatusFound))
+			Expect(resp.Headers["Location"]).To(Equal("https://elsewhere.example/new"))
+		})
+	})
 }
 
 const legacyStream = `
@@ -242,6 +433,8 @@ data: {"id":"id-4","object":"chat.completion.chunk","created":4,"model":"model-1
 
 data: {"id":"id-5","object":"chat.completion.chunk","created":5,"model":"model-1","choices":[{"delta":{},"index":0,"finish_reason":"stop"}]}
 
+data: {"id":"id-6","object":"chat.completion.chunk","created":6,"model":"model-1","choices":[],"usage":{"prompt_tokens":9,"completion_tokens":3,"total_tokens":12,"prompt_tokens_details":{"cached_tokens":4}}}
+
 data: [DONE]
 `
 
@@ -266,7 +459,7 @@ event: response.output_text.delta
 data: {"type":"response.output_text.delta","item_id":"msg_1","output_index":0,"content_index":0,"delta":" c"}
 
 event: response.completed
-data: {"type":"response.completed","response":{"status":"completed"}}
+data: {"type":"response.completed","response":{"status":"completed","usage":{"input_tokens":20,"output_tokens":7,"output_tokens_details":{"reasoning_tokens":5},"total_tokens":27}}}
 `
 
 func TestUnitCustomHeaders(t *testing.T) {
@@ -415,3 +608,13 @@ func headerGetCI(h map[string]string, key string) (string, bool) {
 	}
 	return "", false
 }
+
+type flushingBuffer struct {
+	bytes.Buffer
+	flushed int
+}
+
+func (f *flushingBuffer) Flush() error {
+	f.flushed++
+	return nil
+}
@@ -0,0 +1,641 @@
+package proxy
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kardolus/chatgpt-cli/api"
+	chatgpthttp "github.com/kardolus/chatgpt-cli/api/http"
+	"github.com/kardolus/chatgpt-cli/config"
+	"github.com/kardolus/chatgpt-cli/internal"
+)
+
+const (
+	ChatCompletionsRoute = "/v1/chat/completions"
+	ResponsesRoute       = "/v1/responses"
+	ModelsRoute          = "/v1/models"
+	UsageRoute           = "/v1/usage"
+
+	CallerHeader = "X-Caller"
+	CacheHeader  = "X-Cache"
+
+	errorTypeProxy   = "proxy_error"
+	errorTypeRequest = "invalid_request_error"
+
+	loopbackHost = "127.0.0.1"
+
+	// DefaultCacheEntries and DefaultCacheBytes bound the response cache. The least
+	// recently used responses are evicted first.
+	DefaultCacheEntries = 1000
+	DefaultCacheBytes   = 64 << 20
+
+	// maxRequestBytes leaves room for a few base64 images or documents in a request.
+	maxRequestBytes = 32 << 20
+
+	// maxEventBytes is the largest streamed event the proxy reads the usage from.
+	maxEventBytes = 1 << 20
+)
+
+// Upstream is the subset of http.RestCaller the proxy forwards through. The
+// RestCaller injects the auth header, user agent and custom_headers, so callers
+// of the proxy never need to hold an API key.
+type Upstream interface {
+	Get(url string) ([]byte, error)
+	Post(url string, body []byte, stream bool) ([]byte, error)
+	PostStream(ctx context.Context, url string, body []byte, w io.Writer) error
+}
+
+// Usage holds the token accounting for a single caller.
+type Usage struct {
+	Requests         int `json:"requests"`
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+type Server struct {
+	cfg      config.Config
+	upstream Upstream
+	now      func() time.Time
+
+	mu         sync.Mutex
+	cache      map[string]*list.Element
+	lru        *list.List
+	cacheBytes int
+	maxEntries int
+	maxBytes   int
+	usage      map[string]*Usage
+}
+
+type cacheEntry struct {
+	key     string
+	body    []byte
+	expires time.Time
+}
+
+func New(cfg config.Config, upstream Upstream) *Server {
+	return &Server{
+		cfg:        cfg,
+		upstream:   upstream,
+		now:        time.Now,
+		cache:      make(map[string]*list.Element),
+		lru:        list.New(),
+		maxEntries: DefaultCacheEntries,
+		maxBytes:   DefaultCacheBytes,
+		usage:      make(map[string]*Usage),
+	}
+}
+
+// WithClock replaces the clock used for cache expiry.
+func (s *Server) WithClock(now func() time.Time) *Server {
+	s.now = now
+	return s
+}
+
+// WithCacheLimits replaces the number of responses and the total size in bytes the
+// response cache holds at most.
+func (s *Server) WithCacheLimits(entries, bytes int) *Server {
+	s.maxEntries = entries
+	s.maxBytes = bytes
+	return s
+}
+
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(ChatCompletionsRoute, s.forward(s.cfg.CompletionsPath))
+	mux.HandleFunc(ResponsesRoute, s.forward(s.cfg.ResponsesPath))
+	mux.HandleFunc(ModelsRoute, s.handleModels)
+	mux.HandleFunc(UsageRoute, s.handleUsage)
+
+	if s.cfg.Proxy.Token == "" {
+		return mux
+	}
+	return s.authenticate(mux)
+}
+
+// ListenAndServe serves the proxy on the address ListenAddr returns for addr.
+func (s *Server) ListenAndServe(addr string) error {
+	addr, err := s.ListenAddr(addr)
+	if err != nil {
+		return err
+	}
+
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	return srv.ListenAndServe()
+}
+
+// ListenAddr returns the address to listen on for addr. An address without a host, such
+// as ":8080" or "8080", listens on the loopback interface only. Anyone who can reach the
+// proxy spends the configured API key, so other hosts require proxy.token.
+func (s *Server) ListenAddr(addr string) (string, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		host, port = "", strings.TrimPrefix(addr, ":")
+	}
+	if host == "" {
+		host = loopbackHost
+	}
+	addr = net.JoinHostPort(host, port)
+
+	if !isLoopback(host) && s.cfg.Proxy.Token == "" {
+		return "", fmt.Errorf("serving on %s makes your API key available to the network, set proxy.token first", addr)
+	}
+	return addr, nil
+}
+
+// authenticate only lets requests through that send proxy.token as a bearer token, the
+// way OpenAI clients send their API key.
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	want := []byte("Bearer " + s.cfg.Proxy.Token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got := []byte(r.Header.Get("Authorization"))
+		if subtle.ConstantTimeCompare(got, want) != 1 {
+			writeError(w, http.StatusUnauthorized, errorTypeRequest, "missing or invalid proxy token")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Usage returns a snapshot of the token accounting, keyed by caller.
+func (s *Server) Usage() map[string]Usage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make(map[string]Usage, len(s.usage))
+	for k, v := range s.usage {
+		out[k] = *v
+	}
+	return out
+}
+
+func (s *Server) forward(path string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeError(w, http.StatusMethodNotAllowed, errorTypeRequest, "method not allowed")
+			return
+		}
+
+		raw, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestBytes))
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(w, http.StatusRequestEntityTooLarge, errorTypeRequest, fmt.Sprintf("request body larger than %d MB", maxRequestBytes>>20))
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusBadRequest, errorTypeRequest, fmt.Sprintf("failed to read request: %s", err))
+			return
+		}
+
+		var body map[string]interface{}
+		if err := json.Unmarshal(raw, &body); err != nil {
+			writeError(w, http.StatusBadRequest, errorTypeRequest, fmt.Sprintf("invalid JSON body: %s", err))
+			return
+		}
+
+		s.applyModel(body)
+
+		// The proxy asks for usage in streamed chat completions to account for it. When the
+		// client didn't ask for it, the extra usage chunk is not passed on.
+		stream, _ := body["stream"].(bool)
+		injectedUsage := false
+		if stream && path == s.cfg.CompletionsPath {
+			if _, ok := body["stream_options"]; !ok {
+				body["stream_options"] = map[string]interface{}{"include_usage": true}
+				injectedUsage = true
+			}
+		}
+
+		payload, err := json.Marshal(body)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, errorTypeProxy, err.Error())
+			return
+		}
+
+		url := s.cfg.URL + path
+		caller := callerID(r)
+
+		if stream {
+			s.forwardStream(w, r, url, payload, caller, injectedUsage)
+			return
+		}
+
+		key := cacheKey(path, payload)
+		if cached, ok := s.cached(key); ok {
+			s.record(caller, Usage{Requests: 1})
+			w.Header().Set(internal.HeaderContentTypeKey, internal.HeaderContentTypeValue)
+			w.Header().Set(CacheHeader, "HIT")
+			_, _ = w.Write(cached)
+			return
+		}
+
+		resp, err := s.upstream.Post(url, payload, false)
+		if err != nil {
+			writeUpstreamError(w, err)
+			return
+		}
+
+		usage := parseUsage(resp)
+		usage.Requests = 1
+		s.record(caller, usage)
+		s.store(key, resp)
+
+		w.Header().Set(internal.HeaderContentTypeKey, internal.HeaderContentTypeValue)
+		if s.cfg.Proxy.Cache {
+			w.Header().Set(CacheHeader, "MISS")
+		}
+		_, _ = w.Write(resp)
+	}
+}
+
+// forwardStream passes the upstream stream on as it arrives, without the usage-only chunk
+// when dropUsage is set. A client that disconnects cancels the upstream request.
+func (s *Server) forwardStream(w http.ResponseWriter, r *http.Request, url string, payload []byte, caller string, dropUsage bool) {
+	out := &sseWriter{w: w}
+	relay := &eventRelay{w: out, dropUsage: dropUsage}
+
+	err := s.upstream.PostStream(r.Context(), url, payload, relay)
+	if err != nil && !out.started && len(relay.event) == 0 {
+		writeUpstreamError(w, err)
+		return
+	}
+	if flushErr := relay.flush(); err != nil || flushErr != nil {
+		return
+	}
+
+	usage := relay.usage
+	usage.Requests = 1
+	s.record(caller, usage)
+}
+
+func (s *Server) handleModels(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, errorTypeRequest, "method not allowed")
+		return
+	}
+
+	raw, err := s.upstream.Get(s.cfg.URL + s.cfg.ModelsPath)
+	if err != nil {
+		writeUpstreamError(w, err)
+		return
+	}
+
+	var models api.ListModelsResponse
+	if err := json.Unmarshal(raw, &models); err != nil {
+		writeError(w, http.StatusBadGateway, errorTypeProxy, fmt.Sprintf("failed to decode models: %s", err))
+		return
+	}
+
+	aliases := make([]string, 0, len(s.cfg.Proxy.ModelAliases))
+	for alias := range s.cfg.Proxy.ModelAliases {
+		aliases = append(aliases, alias)
+	}
+	sort.Strings(aliases)
+
+	for _, alias := range aliases {
+		models.Data = append(models.Data, api.Model{
+			Id:      alias,
+			Object:  "model",
+			OwnedBy: "proxy",
+			Parent:  stringPtr(s.cfg.Proxy.ModelAliases[alias]),
+		})
+	}
+
+	writeJSON(w, http.StatusOK, models)
+}
+
+func (s *Server) handleUsage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, errorTypeRequest, "method not allowed")
+		return
+	}
+	writeJSON(w, http.StatusOK, s.Usage())
+}
+
+// applyModel resolves aliases and falls back to the configured model when the
+// client did not send one.
+func (s *Server) applyModel(body map[string]interface{}) {
+	model, _ := body["model"].(string)
+	if model == "" {
+		model = s.cfg.Model
+	}
+	if target, ok := s.cfg.Proxy.ModelAliases[model]; ok {
+		model = target
+	}
+	body["model"] = model
+}
+
+func (s *Server) cached(key string) ([]byte, bool) {
+	if !s.cfg.Proxy.Cache {
+		return nil, false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	elem, ok := s.cache[key]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*cacheEntry)
+	if !s.now().Before(entry.expires) {
+		s.evict(elem)
+		return nil, false
+	}
+	s.lru.MoveToFront(elem)
+	return entry.body, true
+}
+
+// store caches body under key. Expired responses are dropped first, then the least
+// recently used ones until the cache is within its limits again.
+func (s *Server) store(key string, body []byte) {
+	if !s.cfg.Proxy.Cache || s.cfg.Proxy.CacheTTL <= 0 || len(body) > s.maxBytes {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if elem, ok := s.cache[key]; ok {
+		s.evict(elem)
+	}
+	s.cache[key] = s.lru.PushFront(&cacheEntry{
+		key:     key,
+		body:    body,
+		expires: s.now().Add(time.Duration(s.cfg.Proxy.CacheTTL) * time.Second),
+	})
+	s.cacheBytes += len(body)
+
+	now := s.now()
+	for elem := s.lru.Back(); elem != nil; {
+		prev := elem.Prev()
+		if !now.Before(elem.Value.(*cacheEntry).expires) {
+			s.evict(elem)
+		}
+		elem = prev
+	}
+	for s.lru.Len() > s.maxEntries || s.cacheBytes > s.maxBytes {
+		s.evict(s.lru.Back())
+	}
+}
+
+func (s *Server) evict(elem *list.Element) {
+	entry := s.lru.Remove(elem).(*cacheEntry)
+	delete(s.cache, entry.key)
+	s.cacheBytes -= len(entry.body)
+}
+
+func (s *Server) record(caller string, u Usage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cur, ok := s.usage[caller]
+	if !ok {
+		cur = &Usage{}
+		s.usage[caller] = cur
+	}
+	cur.Requests += u.Requests
+	cur.PromptTokens += u.PromptTokens
+	cur.CompletionTokens += u.CompletionTokens
+	cur.TotalTokens += u.TotalTokens
+}
+
+// sseWriter sends the event-stream headers on first write and flushes after
+// every chunk so clients see tokens as they arrive.
+type sseWriter struct {
+	w       http.ResponseWriter
+	started bool
+}
+
+func (s *sseWriter) Write(p []byte) (int, error) {
+	if !s.started {
+		s.w.Header().Set(internal.HeaderContentTypeKey, "text/event-stream")
+		s.w.Header().Set("Cache-Control", "no-cache")
+		s.w.WriteHeader(http.StatusOK)
+		s.started = true
+	}
+
+	n, err := s.w.Write(p)
+	if f, ok := s.w.(http.Flusher); ok {
+		f.Flush()
+	}
+	return n, err
+}
+
+// rawUsage covers both the Chat Completions (prompt/completion) and the
+// Responses API (input/output) usage shapes.
+type rawUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	InputTokens      int `json:"input_tokens"`
+	OutputTokens     int `json:"output_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+func (u *rawUsage) toUsage() Usage {
+	if u == nil {
+		return Usage{}
+	}
+	out := Usage{
+		PromptTokens:     u.PromptTokens + u.InputTokens,
+		CompletionTokens: u.CompletionTokens + u.OutputTokens,
+		TotalTokens:      u.TotalTokens,
+	}
+	if out.TotalTokens == 0 {
+		out.TotalTokens = out.PromptTokens + out.CompletionTokens
+	}
+	return out
+}
+
+type usageEnvelope struct {
+	Usage    *rawUsage `json:"usage"`
+	Response struct {
+		Usage *rawUsage `json:"usage"`
+	} `json:"response"`
+}
+
+func parseUsage(raw []byte) Usage {
+	var env usageEnvelope
+	if err := json.Unmarshal(raw, &env); err != nil {
+		return Usage{}
+	}
+	if env.Usage != nil {
+		return env.Usage.toUsage()
+	}
+	return env.Response.Usage.toUsage()
+}
+
+// eventRelay passes an SSE stream on one event at a time and keeps the last usage block
+// it sees: the final chunk for Chat Completions, response.completed for the Responses API.
+// Only the event being received is held in memory; an event beyond maxEventBytes is
+// passed on as it arrives and not looked into. With dropUsage set, the chat completion
+// chunk that only carries the usage is kept back.
+type eventRelay struct {
+	w         io.Writer
+	event     []byte
+	oversize  bool
+	dropUsage bool
+	usage     Usage
+}
+
+func (e *eventRelay) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		line := p
+		if i := bytes.IndexByte(p, '\n'); i >= 0 {
+			line = p[:i+1]
+		}
+		p = p[len(line):]
+
+		if e.oversize {
+			if _, err := e.w.Write(line); err != nil {
+				return 0, err
+			}
+		} else {
+			e.event = append(e.event, line...)
+		}
+
+		switch {
+		case isEventEnd(line):
+			if err := e.flush(); err != nil {
+				return 0, err
+			}
+		case !e.oversize && len(e.event) > maxEventBytes:
+			e.oversize = true
+			if _, err := e.w.Write(e.event); err != nil {
+				return 0, err
+			}
+			e.event = e.event[:0]
+		}
+	}
+	return n, nil
+}
+
+// flush passes the event received so far on, recording its usage.
+func (e *eventRelay) flush() error {
+	if e.oversize {
+		e.oversize = false
+		return nil
+	}
+	if len(e.event) == 0 {
+		return nil
+	}
+
+	defer func() { e.event = e.event[:0] }()
+
+	u, usageOnly, ok := eventUsage(e.event)
+	if ok {
+		e.usage = u
+	}
+	if usageOnly && e.dropUsage {
+		return nil
+	}
+	_, err := e.w.Write(e.event)
+	return err
+}
+
+// isEventEnd tells whether line is the blank line that ends an SSE event.
+func isEventEnd(line []byte) bool {
+	return len(bytes.TrimRight(line, "\r\n")) == 0 && bytes.HasSuffix(line, []byte("\n"))
+}
+
+// eventUsage returns the usage in the data lines of an SSE event, if there is one, and
+// whether the event is a chat completion chunk without choices that only carries it.
+func eventUsage(event []byte) (Usage, bool, bool) {
+	for _, line := range strings.Split(string(event), "\n") {
+		line = strings.TrimRight(line, "\r")
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		payload := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if payload == "" || payload == "[DONE]" {
+			continue
+		}
+		if u := parseUsage([]byte(payload)); u.TotalTokens > 0 {
+			var chunk struct {
+				Choices []json.RawMessage `json:"choices"`
+			}
+			usageOnly := json.Unmarshal([]byte(payload), &chunk) == nil && chunk.Choices != nil && len(chunk.Choices) == 0
+			return u, usageOnly, true
+		}
+	}
+	return Usage{}, false, false
+}
+
+func callerID(r *http.Request) string {
+	if id := strings.TrimSpace(r.Header.Get(CallerHeader)); id != "" {
+		return id
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func cacheKey(path string, body []byte) string {
+	sum := sha256.Sum256(append([]byte(path+"\n"), body...))
+	return hex.EncodeToString(sum[:])
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set(internal.HeaderContentTypeKey, internal.HeaderContentTypeValue)
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, errType, msg string) {
+	var resp api.ErrorResponse
+	resp.Error.Message = msg
+	resp.Error.Type = errType
+	writeJSON(w, status, resp)
+}
+
+// writeUpstreamError passes an error response of the upstream API on with its status and
+// body, so clients see the same errors they would get from it directly. Only a failure to
+// reach the upstream is reported as a 502.
+func writeUpstreamError(w http.ResponseWriter, err error) {
+	var statusErr *chatgpthttp.StatusError
+	if !errors.As(err, &statusErr) {
+		writeError(w, http.StatusBadGateway, errorTypeProxy, err.Error())
+		return
+	}
+
+	if len(statusErr.Body) == 0 || !json.Valid(statusErr.Body) {
+		writeError(w, statusErr.Status, errorTypeProxy, err.Error())
+		return
+	}
+	w.Header().Set(internal.HeaderContentTypeKey, internal.HeaderContentTypeValue)
+	w.WriteHeader(statusErr.Status)
+	_, _ = w.Write(statusErr.Body)
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
@@ -0,0 +1,432 @@
+package proxy_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	stdhttp "net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	chatgpthttp "github.com/kardolus/chatgpt-cli/api/http"
+	"github.com/kardolus/chatgpt-cli/api/proxy"
+	"github.com/kardolus/chatgpt-cli/config"
+	. "github.com/onsi/gomega"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+)
+
+func TestUnitProxy(t *testing.T) {
+	spec.Run(t, "Testing the proxy server", testProxy, spec.Report(report.Terminal{}))
+}
+
+func testProxy(t *testing.T, when spec.G, it spec.S) {
+	var (
+		upstream *httptest.Server
+		server   *httptest.Server
+		subject  *proxy.Server
+		cfg      config.Config
+		received []map[string]interface{}
+		headers  []stdhttp.Header
+		reply    string
+		now      time.Time
+	)
+
+	it.Before(func() {
+		RegisterTestingT(t)
+
+		received = nil
+		headers = nil
+		reply = `{"id":"1","usage":{"prompt_tokens":3,"completion_tokens":4,"total_tokens":7}}`
+		now = time.Unix(1700000000, 0)
+
+		upstream = httptest.NewServer(stdhttp.HandlerFunc(func(w stdhttp.ResponseWriter, r *stdhttp.Request) {
+			headers = append(headers, r.Header.Clone())
+
+			if r.Method == stdhttp.MethodGet {
+				_, _ = w.Write([]byte(`{"object":"list","data":[{"id":"gpt-4o","object":"model"}]}`))
+				return
+			}
+
+			raw, _ := io.ReadAll(r.Body)
+			var body map[string]interface{}
+			Expect(json.Unmarshal(raw, &body)).To(Succeed())
+			received = append(received, body)
+
+			if body["stream"] == true {
+				w.Header().Set("Content-Type", "text/event-stream")
+				_, _ = w.Write([]byte(reply))
+				return
+			}
+			_, _ = w.Write([]byte(reply))
+		}))
+
+		cfg = config.Config{
+			APIKey:          "secret",
+			AuthHeader:      "Authorization",
+			AuthTokenPrefix: "Bearer ",
+			Model:           "gpt-4o",
+			URL:             upstream.URL,
+			CompletionsPath: "/v1/chat/completions",
+			ResponsesPath:   "/v1/responses",
+			ModelsPath:      "/v1/models",
+			CustomHeaders:   map[string]string{"X-Team": "cli"},
+			Proxy: config.ProxyConfig{
+				ModelAliases: map[string]string{"fast": "gpt-4o-mini"},
+			},
+		}
+	})
+
+	it.After(func() {
+		if server != nil {
+			server.Close()
+		}
+		upstream.Close()
+	})
+
+	start := func() {
+		subject = proxy.New(cfg, chatgpthttp.New(cfg)).WithClock(func() time.Time { return now })
+		server = httptest.NewServer(subject.Handler())
+	}
+
+	post := func(path, body, caller string) *stdhttp.Response {
+		req, err := stdhttp.NewRequest(stdhttp.MethodPost, server.URL+path, strings.NewReader(body))
+		Expect(err).NotTo(HaveOccurred())
+		if caller != "" {
+			req.Header.Set(proxy.CallerHeader, caller)
+		}
+		resp, err := stdhttp.DefaultClient.Do(req)
+		Expect(err).NotTo(HaveOccurred())
+		return resp
+	}
+
+	readBody := func(resp *stdhttp.Response) string {
+		defer resp.Body.Close()
+		raw, err := io.ReadAll(resp.Body)
+		Expect(err).NotTo(HaveOccurred())
+		return string(raw)
+	}
+
+	when("forwarding chat completions", func() {
+		it("injects credentials and custom headers and resolves model aliases", func() {
+			start()
+
+			resp := post(proxy.ChatCompletionsRoute, `{"model":"fast","messages":[]}`, "")
+			Expect(resp.StatusCode).To(Equal(stdhttp.StatusOK))
+			Expect(readBody(resp)).To(Equal(reply))
+
+			Expect(received).To(HaveLen(1))
+			Expect(received[0]["model"]).To(Equal("gpt-4o-mini"))
+			Expect(headers[0].Get("Authorization")).To(Equal("Bearer secret"))
+			Expect(headers[0].Get("X-Team")).To(Equal("cli"))
+		})
+
+		it("falls back to the configured model", func() {
+			start()
+
+			resp := post(proxy.ChatCompletionsRoute, `{"messages":[]}`, "")
+			_ = readBody(resp)
+
+			Expect(received[0]["model"]).To(Equal("gpt-4o"))
+		})
+
+		it("accounts tokens per caller", func() {
+			start()
+
+			_ = readBody(post(proxy.ChatCompletionsRoute, `{"messages":[]}`, "alice"))
+			_ = readBody(post(proxy.ChatCompletionsRoute, `{"messages":[]}`, "alice"))
+			_ = readBody(post(proxy.ChatCompletionsRoute, `{"messages":[]}`, "bob"))
+
+			usage := subject.Usage()
+			Expect(usage["alice"]).To(Equal(proxy.Usage{Requests: 2, PromptTokens: 6, CompletionTokens: 8, TotalTokens: 14}))
+			Expect(usage["bob"]).To(Equal(proxy.Usage{Requests: 1, PromptTokens: 3, CompletionTokens: 4, TotalTokens: 7}))
+
+			resp, err := stdhttp.Get(server.URL + proxy.UsageRoute)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(readBody(resp)).To(ContainSubstring(`"alice":{"requests":2,"prompt_tokens":6,"completion_tokens":8,"total_tokens":14}`))
+		})
+
+		it("returns a 400 for invalid JSON", func() {
+			start()
+
+			resp := post(proxy.ChatCompletionsRoute, `not json`, "")
+			Expect(resp.StatusCode).To(Equal(stdhttp.StatusBadRequest))
+			Expect(readBody(resp)).To(ContainSubstring("invalid_request_error"))
+			Expect(received).To(BeEmpty())
+		})
+
+		it("refuses request bodies beyond the size limit", func() {
+			start()
+
+			resp := post(proxy.ChatCompletionsRoute, `{"messages":"`+strings.Repeat("a", 33<<20)+`"}`, "")
+			Expect(resp.StatusCode).To(Equal(stdhttp.StatusRequestEntityTooLarge))
+			Expect(readBody(resp)).To(ContainSubstring("invalid_request_error"))
+			Expect(received).To(BeEmpty())
+		})
+
+		it("passes upstream errors on with their status and body", func() {
+			const apiError = `{"error":{"message":"slow down","type":"rate_limit_exceeded"}}`
+			upstream.Close()
+			upstream = httptest.NewServer(stdhttp.HandlerFunc(func(w stdhttp.ResponseWriter, r *stdhttp.Request) {
+				w.WriteHeader(stdhttp.StatusTooManyRequests)
+				_, _ = w.Write([]byte(apiError))
+			}))
+			cfg.URL = upstream.URL
+			start()
+
+			for _, req := range []string{`{"messages":[]}`, `{"stream":true}`} {
+				resp := post(proxy.ChatCompletionsRoute, req, "")
+				Expect(resp.StatusCode).To(Equal(stdhttp.StatusTooManyRequests), req)
+				Expect(resp.Header.Get("Content-Type")).To(Equal("application/json"))
+				Expect(readBody(resp)).To(Equal(apiError))
+			}
+
+			resp, err := stdhttp.Get(server.URL + proxy.ModelsRoute)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.StatusCode).To(Equal(stdhttp.StatusTooManyRequests))
+			Expect(readBody(resp)).To(Equal(apiError))
+		})
+
+		it("returns a 502 when the upstream can't be reached", func() {
+			upstream.Close()
+			start()
+
+			resp := post(proxy.ChatCompletionsRoute, `{"messages":[]}`, "")
+			Expect(resp.StatusCode).To(Equal(stdhttp.StatusBadGateway))
+			body := readBody(resp)
+			Expect(body).To(ContainSubstring("failed to make request"))
+			Expect(body).To(ContainSubstring("proxy_error"))
+		})
+	})
+
+	when("the response cache is enabled", func() {
+		it.Before(func() {
+			cfg.Proxy.Cache = true
+			cfg.Proxy.CacheTTL = 60
+		})
+
+		it("serves identical requests from the cache until the TTL expires", func() {
+			start()
+
+			first := post(proxy.ChatCompletionsRoute, `{"messages":[{"role":"user","content":"hi"}]}`, "")
+			Expect(first.Header.Get(proxy.CacheHeader)).To(Equal("MISS"))
+			_ = readBody(first)
+
+			second := post(proxy.ChatCompletionsRoute, `{"messages":[{"role":"user","content":"hi"}]}`, "")
+			Expect(second.Header.Get(proxy.CacheHeader)).To(Equal("HIT"))
+			Expect(readBody(second)).To(Equal(reply))
+			Expect(received).To(HaveLen(1))
+
+			now = now.Add(61 * time.Second)
+
+			third := post(proxy.ChatCompletionsRoute, `{"messages":[{"role":"user","content":"hi"}]}`, "")
+			Expect(third.Header.Get(proxy.CacheHeader)).To(Equal("MISS"))
+			_ = readBody(third)
+			Expect(received).To(HaveLen(2))
+		})
+
+		it("evicts the least recently used responses beyond its limits", func() {
+			start()
+			subject.WithCacheLimits(2, proxy.DefaultCacheBytes)
+
+			ask := func(content string) string {
+				resp := post(proxy.ChatCompletionsRoute, `{"messages":[{"role":"user","content":"`+content+`"}]}`, "")
+				_ = readBody(resp)
+				return resp.Header.Get(proxy.CacheHeader)
+			}
+
+			Expect(ask("a")).To(Equal("MISS"))
+			Expect(ask("b")).To(Equal("MISS"))
+			Expect(ask("a")).To(Equal("HIT"))
+			Expect(ask("c")).To(Equal("MISS"))
+
+			Expect(ask("a")).To(Equal("HIT"))
+			Expect(ask("b")).To(Equal("MISS"))
+			Expect(received).To(HaveLen(4))
+		})
+
+		it("does not cache responses larger than its byte limit", func() {
+			start()
+			subject.WithCacheLimits(proxy.DefaultCacheEntries, len(reply)-1)
+
+			_ = readBody(post(proxy.ChatCompletionsRoute, `{"messages":[]}`, ""))
+			resp := post(proxy.ChatCompletionsRoute, `{"messages":[]}`, "")
+			_ = readBody(resp)
+			Expect(resp.Header.Get(proxy.CacheHeader)).To(Equal("MISS"))
+		})
+
+		it("does not cache streaming requests", func() {
+			reply = "data: {\"choices\":[{\"delta\":{\"content\":\"a\"}}]}\n\ndata: [DONE]\n\n"
+			start()
+
+			_ = readBody(post(proxy.ChatCompletionsRoute, `{"stream":true}`, ""))
+			_ = readBody(post(proxy.ChatCompletionsRoute, `{"stream":true}`, ""))
+			Expect(received).To(HaveLen(2))
+		})
+	})
+
+	when("streaming", func() {
+		it("passes chat completion SSE through and records usage from the final chunk", func() {
+			content := "data: {\"choices\":[{\"delta\":{\"content\":\"a\"}}]}\n\n"
+			usage := "data: {\"choices\":[],\"usage\":{\"prompt_tokens\":5,\"completion_tokens\":1,\"total_tokens\":6}}\n\n"
+			reply = content + usage + "data: [DONE]\n\n"
+			start()
+
+			resp := post(proxy.ChatCompletionsRoute, `{"stream":true}`, "svc")
+			Expect(resp.StatusCode).To(Equal(stdhttp.StatusOK))
+			Expect(resp.Header.Get("Content-Type")).To(Equal("text/event-stream"))
+			Expect(readBody(resp)).To(Equal(content+"data: [DONE]\n\n"), "the usage chunk the client didn't ask for is dropped")
+
+			Expect(received[0]["stream_options"]).To(Equal(map[string]interface{}{"include_usage": true}))
+			Expect(subject.Usage()["svc"]).To(Equal(proxy.Usage{Requests: 1, PromptTokens: 5, CompletionTokens: 1, TotalTokens: 6}))
+
+			resp = post(proxy.ChatCompletionsRoute, `{"stream":true,"stream_options":{"include_usage":true}}`, "svc")
+			Expect(readBody(resp)).To(Equal(reply))
+			Expect(subject.Usage()["svc"].TotalTokens).To(Equal(12))
+		})
+
+		it("reads usage from events that arrive in pieces and passes large events on unchanged", func() {
+			reply = "data: {\"choices\":[{\"delta\":{\"content\":\"" + strings.Repeat("a", 2<<20) + "\"}}]}\n\n" +
+				"data: {\"choices\":[],\"usage\":{\"prompt_tokens\":5,\"completion_tokens\":1,\"total_tokens\":6}}\n\n" +
+				"data: [DONE]\n\n"
+			chunked := httptest.NewServer(stdhttp.HandlerFunc(func(w stdhttp.ResponseWriter, r *stdhttp.Request) {
+				w.Header().Set("Content-Type", "text/event-stream")
+				for rest := reply; rest != ""; {
+					n := min(len(rest), 7)
+					if len(rest) > 200 {
+						n = min(64<<10, len(rest)-200)
+					}
+					_, _ = w.Write([]byte(rest[:n]))
+					w.(stdhttp.Flusher).Flush()
+					rest = rest[n:]
+				}
+			}))
+			defer chunked.Close()
+			cfg.URL = chunked.URL
+			start()
+
+			resp := post(proxy.ChatCompletionsRoute, `{"stream":true,"stream_options":{"include_usage":true}}`, "svc")
+			Expect(readBody(resp) == reply).To(BeTrue())
+			Expect(subject.Usage()["svc"]).To(Equal(proxy.Usage{Requests: 1, PromptTokens: 5, CompletionTokens: 1, TotalTokens: 6}))
+		})
+
+		it("cancels the upstream request when the client goes away", func() {
+			cancelled := make(chan struct{})
+			slow := httptest.NewServer(stdhttp.HandlerFunc(func(w stdhttp.ResponseWriter, r *stdhttp.Request) {
+				w.Header().Set("Content-Type", "text/event-stream")
+				_, _ = w.Write([]byte("data: {\"choices\":[{\"delta\":{\"content\":\"a\"}}]}\n\n"))
+				w.(stdhttp.Flusher).Flush()
+				select {
+				case <-r.Context().Done():
+					close(cancelled)
+				case <-time.After(5 * time.Second):
+				}
+			}))
+			defer slow.Close()
+			cfg.URL = slow.URL
+			start()
+
+			resp := post(proxy.ChatCompletionsRoute, `{"stream":true}`, "")
+			line, err := bufio.NewReader(resp.Body).ReadString('\n')
+			Expect(err).NotTo(HaveOccurred())
+			Expect(line).To(HavePrefix("data:"))
+			Expect(resp.Body.Close()).To(Succeed())
+
+			Eventually(cancelled, 5*time.Second).Should(BeClosed())
+		})
+
+		it("records usage from response.completed on the responses endpoint", func() {
+			reply = "event: response.output_text.delta\n" +
+				"data: {\"type\":\"response.output_text.delta\",\"delta\":\"a\"}\n\n" +
+				"event: response.completed\n" +
+				"data: {\"type\":\"response.completed\",\"response\":{\"status\":\"completed\",\"usage\":{\"input_tokens\":2,\"output_tokens\":3,\"total_tokens\":5}}}\n\n"
+			start()
+
+			resp := post(proxy.ResponsesRoute, `{"stream":true,"input":"hi"}`, "svc")
+			Expect(readBody(resp)).To(Equal(reply))
+
+			Expect(received[0]).NotTo(HaveKey("stream_options"))
+			Expect(subject.Usage()["svc"]).To(Equal(proxy.Usage{Requests: 1, PromptTokens: 2, CompletionTokens: 3, TotalTokens: 5}))
+		})
+	})
+
+	when("listing models", func() {
+		it("appends the configured aliases", func() {
+			start()
+
+			resp, err := stdhttp.Get(server.URL + proxy.ModelsRoute)
+			Expect(err).NotTo(HaveOccurred())
+			body := readBody(resp)
+
+			Expect(body).To(ContainSubstring(`"id":"gpt-4o"`))
+			Expect(body).To(ContainSubstring(`"id":"fast"`))
+			Expect(body).To(ContainSubstring(`"parent":"gpt-4o-mini"`))
+		})
+
+		it("rejects non-GET methods", func() {
+			start()
+
+			resp := post(proxy.ModelsRoute, `{}`, "")
+			Expect(resp.StatusCode).To(Equal(stdhttp.StatusMethodNotAllowed))
+			_ = readBody(resp)
+		})
+	})
+
+	when("proxy.token is set", func() {
+		it.Before(func() {
+			cfg.Proxy.Token = "shared"
+		})
+
+		it("only serves requests with the token as bearer token", func() {
+			start()
+
+			for auth, want := range map[string]int{
+				"":                    stdhttp.StatusUnauthorized,
+				"Bearer wrong":        stdhttp.StatusUnauthorized,
+				"shared":              stdhttp.StatusUnauthorized,
+				"Bearer shared":       stdhttp.StatusOK,
+				"Bearer sharedsuffix": stdhttp.StatusUnauthorized,
+			} {
+				req, err := stdhttp.NewRequest(stdhttp.MethodGet, server.URL+proxy.UsageRoute, nil)
+				Expect(err).NotTo(HaveOccurred())
+				if auth != "" {
+					req.Header.Set("Authorization", auth)
+				}
+				resp, err := stdhttp.DefaultClient.Do(req)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(resp.StatusCode).To(Equal(want), auth)
+				_ = readBody(resp)
+			}
+		})
+	})
+
+	when("ListenAddr()", func() {
+		it("listens on the loopback interface when no host is given", func() {
+			subject := proxy.New(cfg, chatgpthttp.New(cfg))
+
+			for addr, want := range map[string]string{
+				":8080":          "127.0.0.1:8080",
+				"8080":           "127.0.0.1:8080",
+				"localhost:8080": "localhost:8080",
+				"[::1]:8080":     "[::1]:8080",
+			} {
+				got, err := subject.ListenAddr(addr)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(got).To(Equal(want), addr)
+			}
+		})
+
+		it("requires a token to serve beyond localhost", func() {
+			_, err := proxy.New(cfg, chatgpthttp.New(cfg)).ListenAddr("0.0.0.0:8080")
+			Expect(err).To(MatchError(ContainSubstring("set proxy.token")))
+			Expect(proxy.New(cfg, chatgpthttp.New(cfg)).ListenAndServe("0.0.0.0:0")).To(MatchError(ContainSubstring("set proxy.token")))
+
+			cfg.Proxy.Token = "shared"
+			addr, err := proxy.New(cfg, chatgpthttp.New(cfg)).ListenAddr("0.0.0.0:8080")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(addr).To(Equal("0.0.0.0:8080"))
+		})
+	})
+}
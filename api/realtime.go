@@ -0,0 +1,53 @@
+package api
+
+import "encoding/json"
+
+// RealtimeEvent is a client or server event of the Realtime API. Only the fields used by
+// text sessions with optional audio are modeled; unknown events are skipped by type.
+type RealtimeEvent struct {
+	Type     string            `json:"type"`
+	EventID  string            `json:"event_id,omitempty"`
+	Session  *RealtimeSession  `json:"session,omitempty"`
+	Item     *RealtimeItem     `json:"item,omitempty"`
+	Response *RealtimeResponse `json:"response,omitempty"`
+	Delta    string            `json:"delta,omitempty"`
+	Error    *RealtimeError    `json:"error,omitempty"`
+}
+
+type RealtimeSession struct {
+	Modalities        []string `json:"modalities,omitempty"`
+	Instructions      string   `json:"instructions,omitempty"`
+	Voice             string   `json:"voice,omitempty"`
+	InputAudioFormat  string   `json:"input_audio_format,omitempty"`
+	OutputAudioFormat string   `json:"output_audio_format,omitempty"`
+}
+
+type RealtimeItem struct {
+	Type    string            `json:"type"`
+	Role    string            `json:"role"`
+	Content []RealtimeContent `json:"content"`
+}
+
+type RealtimeContent struct {
+	Type  string `json:"type"`
+	Text  string `json:"text,omitempty"`
+	Audio string `json:"audio,omitempty"`
+}
+
+type RealtimeResponse struct {
+	Status        string          `json:"status,omitempty"`
+	StatusDetails json.RawMessage `json:"status_details,omitempty"`
+	Usage         *RealtimeUsage  `json:"usage,omitempty"`
+}
+
+type RealtimeUsage struct {
+	TotalTokens  int `json:"total_tokens"`
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+type RealtimeError struct {
+	Type    string `json:"type"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
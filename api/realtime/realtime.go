@@ -0,0 +1,217 @@
+// Package realtime holds conversations with realtime models over the WebSocket transport
+// of the Realtime API. A Session keeps its conversation on the server, so every turn only
+// sends the new message.
+package realtime
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/kardolus/chatgpt-cli/api"
+	"github.com/kardolus/chatgpt-cli/internal/websocket"
+)
+
+const (
+	// SampleRate is the rate of the 16-bit mono PCM audio exchanged with the server.
+	SampleRate = 24000
+
+	BetaHeader      = "OpenAI-Beta"
+	BetaHeaderValue = "realtime=v1"
+
+	// cancelGrace is how long a cancelled response may take to wind down before the
+	// connection is abandoned.
+	cancelGrace = 5 * time.Second
+
+	audioFormat = "pcm16"
+)
+
+type Options struct {
+	URL       string
+	Header    http.Header
+	TLSConfig *tls.Config
+
+	Instructions string
+	Voice        string
+
+	// Audio asks for spoken answers next to the text.
+	Audio bool
+}
+
+// Response is one answer of the model.
+type Response struct {
+	Text   string
+	Audio  []byte
+	Tokens int
+}
+
+type Session struct {
+	conn *websocket.Conn
+}
+
+// Dial connects to the Realtime API and configures the session.
+func Dial(ctx context.Context, opts Options) (*Session, error) {
+	header := opts.Header.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	header.Set(BetaHeader, BetaHeaderValue)
+
+	conn, err := websocket.Dial(ctx, opts.URL, header, opts.TLSConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	modalities := []string{"text"}
+	if opts.Audio {
+		modalities = append(modalities, "audio")
+	}
+
+	s := &Session{conn: conn}
+	err = s.send(api.RealtimeEvent{
+		Type: "session.update",
+		Session: &api.RealtimeSession{
+			Modalities:        modalities,
+			Instructions:      opts.Instructions,
+			Voice:             opts.Voice,
+			InputAudioFormat:  audioFormat,
+			OutputAudioFormat: audioFormat,
+		},
+	})
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// AddMessage adds a message to the conversation without asking for an answer, which is
+// how earlier turns of a thread are replayed.
+func (s *Session) AddMessage(role, text string) error {
+	contentType := "input_text"
+	if role == "assistant" {
+		contentType = "text"
+	}
+	return s.addItem(role, api.RealtimeContent{Type: contentType, Text: text})
+}
+
+// Respond sends a user message, text and/or 16-bit mono PCM audio at SampleRate, and asks
+// for an answer. Text deltas are written to out as they arrive. Cancelling ctx cancels the
+// answer and returns the context's error.
+func (s *Session) Respond(ctx context.Context, text string, audio []byte, out io.Writer) (Response, error) {
+	var content []api.RealtimeContent
+	if text != "" {
+		content = append(content, api.RealtimeContent{Type: "input_text", Text: text})
+	}
+	if len(audio) > 0 {
+		content = append(content, api.RealtimeContent{Type: "input_audio", Audio: base64.StdEncoding.EncodeToString(audio)})
+	}
+	if len(content) == 0 {
+		return Response{}, errors.New("nothing to send")
+	}
+
+	if err := s.addItem("user", content...); err != nil {
+		return Response{}, err
+	}
+	if err := s.send(api.RealtimeEvent{Type: "response.create"}); err != nil {
+		return Response{}, err
+	}
+
+	cancelled := make(chan struct{})
+	stop := context.AfterFunc(ctx, func() {
+		defer close(cancelled)
+		_ = s.conn.SetDeadline(time.Now().Add(cancelGrace))
+		_ = s.send(api.RealtimeEvent{Type: "response.cancel"})
+	})
+	defer func() {
+		if !stop() {
+			<-cancelled
+			_ = s.conn.SetDeadline(time.Time{})
+		}
+	}()
+
+	resp, err := s.receive(out)
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return resp, ctxErr
+	}
+	return resp, err
+}
+
+// Close ends the session.
+func (s *Session) Close() error {
+	return s.conn.Close()
+}
+
+func (s *Session) receive(out io.Writer) (Response, error) {
+	var (
+		resp Response
+		text strings.Builder
+	)
+
+	for {
+		_, data, err := s.conn.ReadMessage()
+		if err != nil {
+			return resp, err
+		}
+
+		var event api.RealtimeEvent
+		if err := json.Unmarshal(data, &event); err != nil {
+			return resp, fmt.Errorf("failed to decode realtime event: %w", err)
+		}
+
+		switch event.Type {
+		case "response.text.delta", "response.output_text.delta",
+			"response.audio_transcript.delta", "response.output_audio_transcript.delta":
+			text.WriteString(event.Delta)
+			if out != nil {
+				if _, err := io.WriteString(out, event.Delta); err != nil {
+					return resp, err
+				}
+			}
+		case "response.audio.delta", "response.output_audio.delta":
+			chunk, err := base64.StdEncoding.DecodeString(event.Delta)
+			if err != nil {
+				return resp, fmt.Errorf("failed to decode audio delta: %w", err)
+			}
+			resp.Audio = append(resp.Audio, chunk...)
+		case "response.done":
+			resp.Text = text.String()
+			if r := event.Response; r != nil {
+				if r.Usage != nil {
+					resp.Tokens = r.Usage.TotalTokens
+				}
+				if r.Status == "failed" || r.Status == "incomplete" {
+					return resp, fmt.Errorf("response %s: %s", r.Status, r.StatusDetails)
+				}
+			}
+			return resp, nil
+		case "error":
+			if event.Error == nil {
+				return resp, errors.New("realtime API error")
+			}
+			return resp, fmt.Errorf("realtime API error: %s", event.Error.Message)
+		}
+	}
+}
+
+func (s *Session) addItem(role string, content ...api.RealtimeContent) error {
+	return s.send(api.RealtimeEvent{
+		Type: "conversation.item.create",
+		Item: &api.RealtimeItem{Type: "message", Role: role, Content: content},
+	})
+}
+
+func (s *Session) send(event api.RealtimeEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return s.conn.WriteMessage(websocket.TextMessage, data)
+}
@@ -0,0 +1,223 @@
+package realtime_test
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kardolus/chatgpt-cli/api"
+	"github.com/kardolus/chatgpt-cli/api/realtime"
+	"github.com/kardolus/chatgpt-cli/internal/websocket"
+	. "github.com/onsi/gomega"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+)
+
+func TestUnitRealtime(t *testing.T) {
+	spec.Run(t, "Testing the realtime session", testRealtime, spec.Report(report.Terminal{}))
+}
+
+// fakeServer records the client events and answers every response.create with the
+// events in replies, up to the first empty one. Cancellations are acknowledged.
+type fakeServer struct {
+	*httptest.Server
+
+	mu      sync.Mutex
+	header  http.Header
+	events  []api.RealtimeEvent
+	replies []string
+}
+
+func newFakeServer(replies ...string) *fakeServer {
+	f := &fakeServer{replies: replies}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		f.header = r.Header.Clone()
+		f.mu.Unlock()
+
+		conn, err := websocket.Accept(w, r)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+
+			var event api.RealtimeEvent
+			_ = json.Unmarshal(data, &event)
+
+			f.mu.Lock()
+			f.events = append(f.events, event)
+			replies := f.replies
+			f.mu.Unlock()
+
+			switch event.Type {
+			case "response.cancel":
+				replies = []string{`{"type":"response.done","response":{"status":"cancelled"}}`}
+			case "response.create":
+			default:
+				continue
+			}
+			for _, reply := range replies {
+				if reply == "" {
+					break
+				}
+				_ = conn.WriteMessage(websocket.TextMessage, []byte(reply))
+			}
+		}
+	}))
+	return f
+}
+
+func (f *fakeServer) url() string {
+	return "ws" + strings.TrimPrefix(f.URL, "http") + "/v1/realtime?model=gpt-realtime"
+}
+
+func (f *fakeServer) reply(replies ...string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.replies = replies
+}
+
+func (f *fakeServer) received() []api.RealtimeEvent {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]api.RealtimeEvent(nil), f.events...)
+}
+
+func testRealtime(t *testing.T, when spec.G, it spec.S) {
+	it.Before(func() {
+		RegisterTestingT(t)
+	})
+
+	when("Respond()", func() {
+		it("configures the session, sends the message and streams the answer", func() {
+			server := newFakeServer(
+				`{"type":"response.created"}`,
+				`{"type":"response.text.delta","delta":"Hello"}`,
+				`{"type":"response.text.delta","delta":" there"}`,
+				`{"type":"response.done","response":{"status":"completed","usage":{"total_tokens":42}}}`,
+			)
+			defer server.Close()
+
+			session, err := realtime.Dial(context.Background(), realtime.Options{
+				URL:          server.url(),
+				Header:       http.Header{"Authorization": {"Bearer key"}},
+				Instructions: "Be brief.",
+				Voice:        "nova",
+			})
+			Expect(err).NotTo(HaveOccurred())
+			defer session.Close()
+
+			Expect(session.AddMessage("assistant", "Earlier answer")).To(Succeed())
+
+			var out strings.Builder
+			resp, err := session.Respond(context.Background(), "Hi", nil, &out)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(out.String()).To(Equal("Hello there"))
+			Expect(resp.Text).To(Equal("Hello there"))
+			Expect(resp.Tokens).To(Equal(42))
+
+			server.mu.Lock()
+			Expect(server.header.Get("Authorization")).To(Equal("Bearer key"))
+			Expect(server.header.Get(realtime.BetaHeader)).To(Equal(realtime.BetaHeaderValue))
+			server.mu.Unlock()
+
+			events := server.received()
+			Expect(events).To(HaveLen(4))
+			Expect(events[0].Type).To(Equal("session.update"))
+			Expect(events[0].Session.Modalities).To(Equal([]string{"text"}))
+			Expect(events[0].Session.Instructions).To(Equal("Be brief."))
+			Expect(events[0].Session.Voice).To(Equal("nova"))
+			Expect(events[1].Item.Role).To(Equal("assistant"))
+			Expect(events[1].Item.Content).To(Equal([]api.RealtimeContent{{Type: "text", Text: "Earlier answer"}}))
+			Expect(events[2].Type).To(Equal("conversation.item.create"))
+			Expect(events[2].Item.Role).To(Equal("user"))
+			Expect(events[2].Item.Content).To(Equal([]api.RealtimeContent{{Type: "input_text", Text: "Hi"}}))
+			Expect(events[3].Type).To(Equal("response.create"))
+		})
+
+		it("sends audio input and collects the spoken answer and its transcript", func() {
+			audio := base64.StdEncoding.EncodeToString([]byte{1, 2, 3, 4})
+			server := newFakeServer(
+				`{"type":"response.audio_transcript.delta","delta":"Spoken"}`,
+				`{"type":"response.audio.delta","delta":"`+audio+`"}`,
+				`{"type":"response.audio.delta","delta":"`+audio+`"}`,
+				`{"type":"response.done","response":{"status":"completed"}}`,
+			)
+			defer server.Close()
+
+			session, err := realtime.Dial(context.Background(), realtime.Options{URL: server.url(), Audio: true})
+			Expect(err).NotTo(HaveOccurred())
+			defer session.Close()
+
+			resp, err := session.Respond(context.Background(), "", []byte{9, 8}, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.Text).To(Equal("Spoken"))
+			Expect(resp.Audio).To(Equal([]byte{1, 2, 3, 4, 1, 2, 3, 4}))
+
+			events := server.received()
+			Expect(events[0].Session.Modalities).To(Equal([]string{"text", "audio"}))
+			Expect(events[1].Item.Content).To(Equal([]api.RealtimeContent{{Type: "input_audio", Audio: base64.StdEncoding.EncodeToString([]byte{9, 8})}}))
+		})
+
+		it("returns error events and failed responses", func() {
+			server := newFakeServer(`{"type":"error","error":{"type":"invalid_request_error","message":"Invalid voice"}}`)
+			defer server.Close()
+
+			session, err := realtime.Dial(context.Background(), realtime.Options{URL: server.url()})
+			Expect(err).NotTo(HaveOccurred())
+			defer session.Close()
+
+			_, err = session.Respond(context.Background(), "Hi", nil, nil)
+			Expect(err).To(MatchError(ContainSubstring("Invalid voice")))
+
+			server.reply(`{"type":"response.done","response":{"status":"failed","status_details":{"error":{"message":"boom"}}}}`)
+			_, err = session.Respond(context.Background(), "Hi", nil, nil)
+			Expect(err).To(MatchError(ContainSubstring("boom")))
+		})
+
+		it("cancels the answer when the context is done and keeps the session usable", func() {
+			server := newFakeServer(`{"type":"response.text.delta","delta":"Long"}`, "")
+			defer server.Close()
+
+			session, err := realtime.Dial(context.Background(), realtime.Options{URL: server.url()})
+			Expect(err).NotTo(HaveOccurred())
+			defer session.Close()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+
+			_, err = session.Respond(ctx, "Tell me a story", nil, nil)
+			Expect(err).To(MatchError(context.DeadlineExceeded))
+			Expect(server.received()[3].Type).To(Equal("response.cancel"))
+
+			server.reply(`{"type":"response.text.delta","delta":"Short"}`, `{"type":"response.done"}`)
+			resp, err := session.Respond(context.Background(), "Shorter please", nil, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.Text).To(Equal("Short"))
+		})
+
+		it("refuses an empty message", func() {
+			server := newFakeServer()
+			defer server.Close()
+
+			session, err := realtime.Dial(context.Background(), realtime.Options{URL: server.url()})
+			Expect(err).NotTo(HaveOccurred())
+			defer session.Close()
+
+			_, err = session.Respond(context.Background(), "", nil, nil)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+}
@@ -4,6 +4,9 @@ type HTTPResponse struct {
 	Status  int
 	Headers map[string]string
 	Body    []byte
+
+	// Truncated is set when the body was cut at the read limit of the request.
+	Truncated bool
 }
 
 type ResponsesRequest struct {
@@ -17,6 +20,50 @@ type ResponsesRequest struct {
 	Tools           []Tool    `json:"tools,omitempty"`
 }
 
+const (
+	InputTextType  = "input_text"
+	InputImageType = "input_image"
+	InputFileType  = "input_file"
+)
+
+// InputPart is the Responses API counterpart of ContentPart. Images are referenced by a
+// plain image_url string and files are inlined instead of nested in an object.
+type InputPart struct {
+	Type       string      `json:"type"`
+	Text       string      `json:"text,omitempty"`
+	ImageURL   string      `json:"image_url,omitempty"`
+	Filename   string      `json:"filename,omitempty"`
+	FileData   string      `json:"file_data,omitempty"`
+	InputAudio *InputAudio `json:"input_audio,omitempty"`
+}
+
+// ToInputParts converts Chat Completions content parts to Responses API input parts.
+func ToInputParts(parts []ContentPart) []InputPart {
+	out := make([]InputPart, 0, len(parts))
+	for _, p := range parts {
+		switch p.Type {
+		case TextPartType:
+			out = append(out, InputPart{Type: InputTextType, Text: p.Text})
+		case ImagePartType:
+			part := InputPart{Type: InputImageType}
+			if p.ImageURL != nil {
+				part.ImageURL = p.ImageURL.URL
+			}
+			out = append(out, part)
+		case FilePartType:
+			part := InputPart{Type: InputFileType}
+			if p.File != nil {
+				part.Filename = p.File.Filename
+				part.FileData = p.File.FileData
+			}
+			out = append(out, part)
+		default:
+			out = append(out, InputPart{Type: p.Type, Text: p.Text, InputAudio: p.InputAudio})
+		}
+	}
+	return out
+}
+
 type Tool struct {
 	Type              string `json:"type"`
 	SearchContextSize string `json:"search_context_size"`
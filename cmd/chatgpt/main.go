@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bufio"
 	"context"
 	"errors"
 	"fmt"
@@ -11,15 +12,22 @@ import (
 	"github.com/kardolus/chatgpt-cli/agent/types"
 	"github.com/kardolus/chatgpt-cli/api"
 	"github.com/kardolus/chatgpt-cli/cache"
+	"github.com/kardolus/chatgpt-cli/internal/document"
 	"github.com/kardolus/chatgpt-cli/internal/fsio"
+	"github.com/kardolus/chatgpt-cli/internal/markdown"
+	"github.com/kardolus/chatgpt-cli/internal/secrets"
+	"github.com/kardolus/chatgpt-cli/internal/templates"
+	"github.com/kardolus/chatgpt-cli/internal/usage"
 	"io"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/kardolus/chatgpt-cli/api/client"
 	"github.com/kardolus/chatgpt-cli/api/http"
+	"github.com/kardolus/chatgpt-cli/api/proxy"
 	"github.com/kardolus/chatgpt-cli/cmd/chatgpt/utils"
 	"github.com/kardolus/chatgpt-cli/internal"
 	"github.com/spf13/pflag"
@@ -49,16 +57,35 @@ var (
 	listThreads     bool
 	hasPipe         bool
 	useSpeak        bool
+	speakAnswer     bool
 	useDraw         bool
 	agentMode       string
 	agentEnabled    bool
+	policyExplain   bool
+	agentMemory     string
+	usageReport     bool
+	usageSince      string
 	promptFile      string
+	templateName    string
+	templateVars    []string
+	listTemplates   bool
+	runDoctor       bool
+	login           bool
+	logout          bool
+	secretName      string
+	contextFiles    []string
+	contextDirs     []string
 	roleFile        string
-	imageFile       string
-	audioFile       string
+	imageFiles      []string
+	audioFiles      []string
+	transcribeFile  string
 	outputFile      string
+	maskFile        string
 	threadName      string
 	ServiceURL      string
+	serveAddr       string
+	extractCode     string
+	applyCode       bool
 	shell           string
 	mcpEndpoint     string
 	mcpTool         string
@@ -67,6 +94,8 @@ var (
 	paramsList      []string
 	paramsJSON      string
 	cfg             config.Config
+	projectConfig   *config.ProjectConfig
+	trustProject    bool
 )
 
 type ConfigMetadata struct {
@@ -83,6 +112,9 @@ var configMetadata = []ConfigMetadata{
 	{"thread", "set-thread", "default", "Set a new active thread by specifying the thread name"},
 	{"api_key", "set-api-key", "", "Set the API key for authentication"},
 	{"api_key_file", "set-api-key-file", "", "Load the API key from a file"},
+	{"api_key_command", "set-api-key-command", "", "Run a credential helper command that prints the API key"},
+	{"api_key_command_ttl", "set-api-key-command-ttl", 300, "Seconds to cache the output of credential helper commands"},
+	{"secret_backend", "set-secret-backend", "", "Where --login stores secrets (secret-service|keyctl, empty to detect)"},
 	{"role", "set-role", "You are a helpful assistant.", "Set the role of the AI assistant"},
 	{"url", "set-url", "https://api.openai.com", "Set the API base URL"},
 	{"completions_path", "set-completions-path", "/v1/chat/completions", "Set the completions API endpoint"},
@@ -92,6 +124,7 @@ var configMetadata = []ConfigMetadata{
 	{"image_generations_path", "set-image-generations-path", "/v1/images/generations", "Set the image generation API endpoint"},
 	{"image_edits_path", "set-image-edits-path", "/v1/images/edits", "Set the image edits API endpoint"},
 	{"models_path", "set-models-path", "/v1/models", "Set the models API endpoint"},
+	{"realtime_path", "set-realtime-path", "/v1/realtime", "Set the Realtime API WebSocket endpoint"},
 	{"auth_header", "set-auth-header", "Authorization", "Set the authorization header"},
 	{"auth_token_prefix", "set-auth-token-prefix", "Bearer ", "Set the authorization token prefix"},
 	{"command_prompt", "set-command-prompt", "[%datetime] [Q%counter] [%usage]", "Set the command prompt format for interactive mode"},
@@ -109,12 +142,20 @@ var configMetadata = []ConfigMetadata{
 	{"skip_tls_verify", "set-skip-tls-verify", false, "Skip TLS certificate verification"},
 	{"http_timeout", "set-http-timeout", 60, "Set the HTTP client timeout in seconds (0 for no timeout)"},
 	{"multiline", "set-multiline", false, "Enables multiline mode while in interactive mode"},
+	{"render_markdown", "set-render-markdown", true, "Render markdown output when writing to a terminal"},
 	{"seed", "set-seed", 0, "Sets the seed for deterministic sampling (Beta)"},
 	{"name", "set-name", "openai", "The prefix for environment variable overrides"},
 	{"effort", "set-effort", "low", "Set the reasoning effort"},
 	{"web", "set-web", false, "Enable web search"},
 	{"web_context_size", "set-web-context-size", "low", "Set the context size for web search"},
+	{"stream_usage", "set-stream-usage", "auto", "Ask for token usage in streams (auto|on|off, auto only asks api.openai.com)"},
 	{"voice", "set-voice", "nova", "Set the voice used by tts models"},
+	{"speech_model", "set-speech-model", "gpt-4o-mini-tts", "Set the tts model used to read answers aloud"},
+	{"speech_speed", "set-speech-speed", 0.0, "Set the speed of generated speech, 0.25 to 4.0 (0 for the model default)"},
+	{"speech_instructions", "set-speech-instructions", "", "Instructions for the tone and style of generated speech"},
+	{"max_cost_usd", "set-max-cost-usd", 0.0, "Refuse requests that could cost more than this many USD (0=unlimited)"},
+	{"usage.ledger", "set-usage-ledger", true, "Record the tokens and cost of every request in the usage ledger"},
+	{"usage.team", "set-usage-team", "", "Team recorded with every request in the usage ledger"},
 	{"agent.mode", "set-agent-mode", "react", "Default agent mode (react|plan)"},
 	{"agent.max_steps", "set-agent-max-steps", 10, "Max steps (plan mode)"},
 	{"agent.max_iterations", "set-agent-max-iterations", 10, "Max iterations (react mode)"},
@@ -122,15 +163,40 @@ var configMetadata = []ConfigMetadata{
 	{"agent.max_shell_calls", "set-agent-max-shell-calls", 0, "Max shell calls (0=unlimited)"},
 	{"agent.max_llm_calls", "set-agent-max-llm-calls", 10, "Max LLM calls (0=unlimited)"},
 	{"agent.max_file_ops", "set-agent-max-file-ops", 0, "Max file ops (0=unlimited)"},
+	{"agent.max_http_calls", "set-agent-max-http-calls", 0, "Max HTTP calls (0=unlimited)"},
 	{"agent.max_llm_tokens", "set-agent-max-llm-tokens", 0, "Max LLM tokens (0=unlimited)"},
+	{"agent.max_cost_usd", "set-agent-max-cost-usd", 0.0, "Max USD the LLM calls of an agent run may cost (0=unlimited)"},
 	{"agent.allowed_tools", "set-agent-allowed-tools", []string{"shell", "llm", "files"}, "Allowed tools for agent"},
 	{"agent.denied_shell_commands", "set-agent-denied-shell-commands", []string{"rm", "sudo", "dd", "mkfs", "shutdown", "reboot"}, "Denied shell commands"},
 	{"agent.allowed_file_ops", "set-agent-allowed-file-ops", []string{"read", "write"}, "Allowed file ops"},
 	{"agent.restrict_files_to_work_dir", "set-agent-restrict-files-to-work-dir", true, "Restrict file ops to workdir"},
+	{"agent.max_parallel_steps", "set-agent-max-parallel-steps", 4, "Independent plan steps the agent may run at once"},
+	{"agent.max_replans", "set-agent-max-replans", 2, "Times a failed plan may be revised by the planner (0 = never)"},
+	{"agent.memory_enabled", "set-agent-memory-enabled", false, "Let the agent remember facts about the project across runs"},
+	{"agent.memory_file", "set-agent-memory-file", "", "File holding the agent memory, relative to the work dir (default: under the cache home)"},
+	{"agent.memory_max_bytes", "set-agent-memory-max-bytes", tools.DefaultMemoryMaxBytes, "Size cap of the agent memory; the oldest facts are forgotten first"},
+	{"agent.max_delegation_depth", "set-agent-max-delegation-depth", 0, "How deep agents may hand sub-goals to child agents (0 = no delegation)"},
 	{"agent.write_plan_json", "set-agent-write-plan-json", true, "Write plan.json in plan mode"},
 	{"agent.plan_json_path", "set-agent-plan-json-path", "", "Override plan.json path"},
 	{"agent.work_dir", "set-agent-work-dir", ".", "Agent working directory (default: .)"},
 	{"agent.dry_run", "set-agent-dry-run", false, "Agent dry-run (no side effects)"},
+	{"agent.policy_file", "set-agent-policy-file", "", "YAML file with ordered allow/deny/ask rules for agent steps"},
+	{"agent.allowed_domains", "set-agent-allowed-domains", []string{}, "Domains the agent's http tool may reach (subdomains included)"},
+	{"agent.allowed_http_methods", "set-agent-allowed-http-methods", []string{"GET", "HEAD"}, "HTTP methods the agent's http tool may use"},
+	{"agent.max_http_response_bytes", "set-agent-max-http-response-bytes", tools.DefaultHTTPMaxBytes, "Bytes of an HTTP response the agent keeps"},
+	{"proxy.cache", "set-proxy-cache", false, "Cache non-streaming responses in --serve mode"},
+	{"proxy.cache_ttl", "set-proxy-cache-ttl", 300, "Proxy response cache TTL in seconds"},
+	{"proxy.token", "set-proxy-token", "", "Bearer token clients of --serve must send (required beyond localhost)"},
+	{"transcription.format", "set-transcription-format", "json", "Transcript format (json|text|verbose_json|srt|vtt)"},
+	{"transcription.language", "set-transcription-language", "", "Language of the audio to transcribe (ISO-639-1)"},
+	{"transcription.prompt", "set-transcription-prompt", "", "Prompt guiding the transcription style and vocabulary"},
+	{"transcription.chunk_seconds", "set-transcription-chunk-seconds", 600, "Split WAV recordings longer than this many seconds"},
+	{"transcription.concurrency", "set-transcription-concurrency", 4, "Number of chunks transcribed in parallel"},
+	{"image.size", "set-image-size", "", "Size of drawn images, e.g. 1024x1024, 1536x1024 or auto"},
+	{"image.quality", "set-image-quality", "", "Quality of drawn images (low|medium|high|auto)"},
+	{"image.n", "set-image-n", 0, "Number of images to draw (written as out-1.png, out-2.png, ...)"},
+	{"image.background", "set-image-background", "", "Background of drawn images (transparent|opaque|auto)"},
+	{"image.output_format", "set-image-output-format", "", "File format of drawn images (png|jpeg|webp)"},
 	{"user_agent", "set-user-agent", "chatgpt-cli", "Set the User-Agent in request header"},
 }
 
@@ -257,14 +323,7 @@ func run(cmd *cobra.Command, args []string) error {
 			targetThread = cfg.Thread
 		}
 
-		store, err := history.New()
-		if err != nil {
-			return err
-		}
-
-		h := history.NewHistory(store)
-
-		output, err := h.Print(targetThread)
+		output, err := printThread(targetThread)
 		if err != nil {
 			return err
 		}
@@ -286,10 +345,30 @@ func run(cmd *cobra.Command, args []string) error {
 		viper.Set("role", role)
 	}
 
+	if listTemplates {
+		return printTemplates()
+	}
+
+	var templatePrompt string
+	if templateName != "" {
+		prompt, err := applyTemplate(cmd, templateName, templateVars)
+		if err != nil {
+			return err
+		}
+		templatePrompt = prompt
+	}
+
 	if showConfig {
 		allSettings := viper.AllSettings()
 
-		configBytes, err := yaml.Marshal(allSettings)
+		var userSettings map[string]interface{}
+		if path := viper.ConfigFileUsed(); path != "" {
+			userSettings, _ = config.ReadSettings(path)
+		}
+
+		configBytes, err := config.AnnotateSources(allSettings, func(key string) string {
+			return "# " + configSource(cmd, key, userSettings)
+		})
 		if err != nil {
 			return fmt.Errorf("failed to marshal config: %w", err)
 		}
@@ -298,16 +377,50 @@ func run(cmd *cobra.Command, args []string) error {
 		return nil
 	}
 
-	if cfg.APIKey == "" {
-		if cfg.APIKeyFile == "" {
-			return errors.New("API key is required. Provide it via --set-api-key, --set-api-key-file, env var, or config file")
+	if cmd.Flag("agent-memory").Changed {
+		return manageAgentMemory(cfg, agentMemory)
+	}
+
+	if usageReport {
+		return printUsageReport(usageSince)
+	}
+
+	secretResolver, err := utils.NewSecretResolver(cfg)
+	if err != nil {
+		return err
+	}
+
+	if runDoctor {
+		return doctor(secretResolver)
+	}
+
+	if login || logout {
+		return manageSecret(secretResolver, login)
+	}
+
+	apiKey, err := utils.ResolveAPIKey(context.Background(), cfg, secretResolver)
+	if err != nil {
+		return err
+	}
+	cfg.APIKey = apiKey
+
+	if cmd.Flag("serve").Changed {
+		if ServiceURL != "" {
+			cfg.URL = ServiceURL
+		}
+
+		if cfg.Proxy.Token, err = secretResolver.Expand(context.Background(), cfg.Proxy.Token); err != nil {
+			return fmt.Errorf("proxy.token: %w", err)
 		}
 
-		key, err := config.ReadAPIKeyFile(cfg.APIKeyFile)
+		srv := proxy.New(cfg, http.New(cfg))
+		addr, err := srv.ListenAddr(serveAddr)
 		if err != nil {
 			return err
 		}
-		cfg.APIKey = key
+
+		sugar.Infof("Serving OpenAI-compatible API on %s (upstream %s)", addr, cfg.URL)
+		return srv.ListenAndServe(addr)
 	}
 
 	ctx := context.Background()
@@ -332,12 +445,66 @@ func run(cmd *cobra.Command, args []string) error {
 		}
 	}
 
-	c := client.New(http.RealCallerFactory, hs, &client.RealTime{}, fsio.NewRealReader(fsio.DefaultBufferSize), &fsio.RealWriter{}, cfg)
+	renderMarkdown := cfg.RenderMarkdown && isTerminal(os.Stdout)
+
+	var c *client.Client
+
+	var play func([]byte) error
+	if speakAnswer {
+		player, err := utils.AudioPlayer()
+		if err != nil {
+			return err
+		}
+		// The stream output can't return errors to the caller, report them as they happen.
+		play = func(audio []byte) error {
+			if err := player(audio); err != nil {
+				_, _ = fmt.Fprintln(os.Stderr, "Error:", err)
+			}
+			return nil
+		}
+	}
+
+	callerFactory := http.RealCallerFactory
+	if renderMarkdown || speakAnswer {
+		callerFactory = func(cfg config.Config) http.Caller {
+			var out io.Writer = os.Stdout
+			if renderMarkdown {
+				out = markdown.NewRenderer(os.Stdout, readline.GetScreenWidth())
+			}
+			if speakAnswer {
+				out = client.NewAnswerSpeaker(out, func(text string) ([]byte, error) {
+					audio, err := c.Speak(text)
+					if err != nil {
+						_, _ = fmt.Fprintln(os.Stderr, "Error:", err)
+					}
+					return audio, err
+				}, play)
+			}
+			return http.New(cfg).WithOutput(out)
+		}
+	}
+
+	render := func(s string) string {
+		if !renderMarkdown {
+			return s
+		}
+		return strings.TrimRight(markdown.Render(s, readline.GetScreenWidth()), "\n")
+	}
+
+	c = client.New(callerFactory, hs, &client.RealTime{}, fsio.NewRealReader(fsio.DefaultBufferSize), &fsio.RealWriter{}, cfg)
 
 	if ServiceURL != "" {
 		c = c.WithServiceURL(ServiceURL)
 	}
 
+	if cfg.Usage.Ledger {
+		recordUsage, err := newUsageLedger()
+		if err != nil {
+			return err
+		}
+		c.OnUsage(recordUsage)
+	}
+
 	if cmd.Flag("prompt").Changed {
 		prompt, err := utils.FileToString(promptFile)
 		if err != nil {
@@ -346,16 +513,40 @@ func run(cmd *cobra.Command, args []string) error {
 		c.ProvideContext(prompt)
 	}
 
-	if cmd.Flag("image").Changed {
-		ctx = context.WithValue(ctx, internal.ImagePathKey, imageFile)
+	if templatePrompt != "" {
+		c.ProvideContext(templatePrompt)
+	}
+
+	if len(contextFiles) > 0 || len(contextDirs) > 0 {
+		paths, err := utils.CollectFiles(contextFiles, contextDirs)
+		if err != nil {
+			return err
+		}
+
+		fc := utils.BuildFileContext(paths, utils.FileContextBudget(cfg.ContextWindow))
+		for _, skipped := range fc.Skipped {
+			_, _ = fmt.Fprintf(os.Stderr, "Skipping %s\n", skipped)
+		}
+		for _, truncated := range fc.Truncated {
+			_, _ = fmt.Fprintf(os.Stderr, "Truncated %s to fit the context window\n", truncated)
+		}
+		c.ProvideFileContext(fc.Blocks)
+	}
+
+	// In interactive mode the media goes with the first query only, see replSession.
+	if len(imageFiles) > 0 && !interactiveMode {
+		ctx = context.WithValue(ctx, internal.ImagePathKey, imageFiles)
 	}
 
-	if cmd.Flag("audio").Changed {
-		ctx = context.WithValue(ctx, internal.AudioPathKey, audioFile)
+	if len(audioFiles) > 0 && !interactiveMode {
+		ctx = context.WithValue(ctx, internal.AudioPathKey, audioFiles)
 	}
 
 	if cmd.Flag("transcribe").Changed {
-		text, err := c.Transcribe(audioFile)
+		if cmd.Flag("output").Changed {
+			return c.TranscribeToFile(transcribeFile, outputFile)
+		}
+		text, err := c.Transcribe(transcribeFile)
 		if err != nil {
 			return err
 		}
@@ -378,6 +569,12 @@ func run(cmd *cobra.Command, args []string) error {
 		} else {
 			chatContext = string(pipeContent)
 
+			if document.Detect(pipeContent) == document.KindHTML {
+				if text, err := document.HTMLText(pipeContent); err == nil {
+					chatContext = text
+				}
+			}
+
 			if strings.Trim(chatContext, "\n ") != "" {
 				hasPipe = true
 			}
@@ -402,6 +599,7 @@ func run(cmd *cobra.Command, args []string) error {
 		sugar.Warnf("Warning: config.yaml doesn't exist in %s, create it\n", tmp)
 	}
 
+	requestedQueryMode := queryMode
 	if !client.GetCapabilities(c.Config.Model).SupportsStreaming {
 		queryMode = true
 	}
@@ -418,6 +616,11 @@ func run(cmd *cobra.Command, args []string) error {
 		if err != nil {
 			return err
 		}
+		for k, v := range headers {
+			if headers[k], err = secretResolver.Expand(ctx, v); err != nil {
+				return fmt.Errorf("--mcp-header %s: %w", k, err)
+			}
+		}
 
 		mcp := api.MCPRequest{
 			Endpoint: mcpEndpoint,
@@ -455,9 +658,7 @@ func run(cmd *cobra.Command, args []string) error {
 			return err
 		}
 
-		sessionsDir := filepath.Join(cacheHome, "mcp", "sessions")
-
-		store := cache.NewFileStore(sessionsDir)
+		store := cache.NewFileStore(utils.MCPSessionsDir(cacheHome))
 		sessionStore := cache.New(store)
 
 		transport := client.NewSessionTransport(base, sessionStore)
@@ -474,44 +675,83 @@ func run(cmd *cobra.Command, args []string) error {
 		}
 	}
 
-	if agentEnabled {
-		mode, err := resolveAgentMode(agentMode, cfg.Agent.Mode)
+	if cmd.Flag("extract-code").Changed || applyCode {
+		response, err := responseForCode(ctx, c, args)
 		if err != nil {
 			return err
 		}
 
-		goal, err := buildAgentGoal(chatContext, args)
+		if applyCode {
+			return applyPatches(response)
+		}
+
+		blocks := utils.FilterCodeBlocks(utils.ExtractCodeBlocks(response), extractCode)
+		if len(blocks) == 0 {
+			return errors.New("no matching code blocks in the response")
+		}
+		for i, block := range blocks {
+			if i > 0 {
+				fmt.Println()
+			}
+			fmt.Print(block.Code)
+		}
+		return nil
+	}
+
+	if agentEnabled {
+		mode, err := utils.ResolveAgentMode(agentMode, cfg.Agent.Mode)
 		if err != nil {
 			return err
 		}
 
-		answer, err := runAgent(ctx, c, cfg, mode, goal)
+		var store history.Store
+		if hs != nil && !cfg.OmitHistory {
+			store = hs
+		}
+		session, err := newAgentSession(c, cfg, mode, store)
 		if err != nil {
 			return err
 		}
 
-		// write ONE history interaction (you said you already created the helper)
-		if hs != nil && !cfg.OmitHistory {
-			if err := appendAgentRunToHistory(hs, cfg.Role, goal, answer); err != nil {
-				return err
-			}
+		if interactiveMode {
+			return runAgentInteractive(ctx, session, chatContext, args)
 		}
 
-		return nil
+		goal, err := buildAgentGoal(chatContext, args)
+		if err != nil {
+			return err
+		}
+		return session.run(ctx, goal)
 	}
 
 	if interactiveMode {
 		sugar.Infof(
 			"Entering interactive mode. Using thread '%s'. Multiline mode is %s.\n"+
-				"Commands: 'clear' (clear screen), 'multiline' (toggle multiline input), 'exit' or Ctrl+C (quit).\n\n",
+				"Commands: '/help' (slash commands), 'clear' (clear screen), 'multiline' (toggle multiline input), 'exit' or Ctrl+C (quit).\n\n",
 			hs.GetThread(),
 			boolToOnOff(cfg.Multiline),
 		)
 
+		var modelIDs []string
+		completer := utils.NewSlashCompleter(
+			func() []string {
+				threads, _ := config.NewManager(config.NewStore()).ListThreads()
+				return threads
+			},
+			func() []string {
+				if modelIDs == nil {
+					models, _ := c.ListModels()
+					modelIDs = utils.ModelIDs(models)
+				}
+				return modelIDs
+			},
+		)
+
 		var readlineCfg *readline.Config
 		if cfg.OmitHistory || cfg.AutoCreateNewThread || newThread {
 			readlineCfg = &readline.Config{
-				Prompt: "",
+				Prompt:       "",
+				AutoComplete: completer,
 			}
 		} else {
 			store, err := history.New()
@@ -530,8 +770,9 @@ func run(cmd *cobra.Command, args []string) error {
 				return err
 			}
 			readlineCfg = &readline.Config{
-				Prompt:      "",
-				HistoryFile: historyFile,
+				Prompt:       "",
+				HistoryFile:  historyFile,
+				AutoComplete: completer,
 			}
 		}
 
@@ -542,6 +783,16 @@ func run(cmd *cobra.Command, args []string) error {
 
 		defer rl.Close()
 
+		// Realtime models keep the conversation on one WebSocket for the whole session.
+		var rt *client.RealtimeSession
+		if client.GetCapabilities(c.Config.Model).IsRealtime {
+			rt, err = c.OpenRealtime(ctx, outputFile)
+			if err != nil {
+				return err
+			}
+			defer rt.Close()
+		}
+
 		commandPrompt := func(counter, usage int) string {
 			return utils.FormatPrompt(c.Config.CommandPrompt, counter, usage, time.Now())
 		}
@@ -550,10 +801,11 @@ func run(cmd *cobra.Command, args []string) error {
 		outputColor, outPutReset := utils.ColorToAnsi(c.Config.OutputPromptColor)
 
 		multiline := cfg.Multiline
+		session := &replSession{client: c, pendingImages: imageFiles, pendingAudio: audioFiles}
 
-		qNum, usage := 1, 0
+		qNum := 1
 		for {
-			rl.SetPrompt(commandPrompt(qNum, usage))
+			rl.SetPrompt(commandPrompt(qNum, session.usage))
 
 			fmt.Print(cmdColor)
 			input, err := readInput(rl, &multiline)
@@ -564,61 +816,542 @@ func run(cmd *cobra.Command, args []string) error {
 				return nil
 			}
 
-			fmtOutputPrompt := utils.FormatPrompt(c.Config.OutputPrompt, qNum, usage, time.Now())
+			if name, arg, ok := utils.ParseSlashCommand(input); ok {
+				next, err := session.handleSlashCommand(name, arg)
+				if err != nil {
+					sugar.Infoln("Error:", err)
+					continue
+				}
+				if next == "" {
+					continue
+				}
+				input = next
+			}
+
+			queryCtx := ctx
+			if len(session.pendingImages) > 0 {
+				queryCtx = context.WithValue(queryCtx, internal.ImagePathKey, session.pendingImages)
+				session.pendingImages = nil
+			}
+			if len(session.pendingAudio) > 0 {
+				queryCtx = context.WithValue(queryCtx, internal.AudioPathKey, session.pendingAudio)
+				session.pendingAudio = nil
+			}
+			session.lastInput = input
+
+			fmtOutputPrompt := utils.FormatPrompt(c.Config.OutputPrompt, qNum, session.usage, time.Now())
 
-			if queryMode {
-				result, qUsage, err := c.Query(ctx, input)
+			if rt != nil {
+				fmt.Print(outputColor + fmtOutputPrompt)
+				_, qUsage, err := rt.Send(queryCtx, input, os.Stdout)
+				fmt.Print(outPutReset)
+				if err != nil {
+					_, _ = fmt.Fprintln(os.Stderr, "\nError:", err)
+				} else {
+					sugar.Infof("\n\n")
+					session.usage += qUsage
+					qNum++
+				}
+			} else if requestedQueryMode || !client.GetCapabilities(c.Config.Model).SupportsStreaming {
+				result, qUsage, err := c.Query(queryCtx, input)
 				if err != nil {
 					sugar.Infoln("Error:", err)
 				} else {
-					sugar.Infof("%s%s%s\n\n", outputColor, fmtOutputPrompt+result, outPutReset)
-					usage += qUsage
+					sugar.Infof("%s%s%s\n\n", outputColor, fmtOutputPrompt+render(result), outPutReset)
+					session.usage += qUsage
 					qNum++
 				}
 			} else {
 				fmt.Print(outputColor + fmtOutputPrompt)
-				if err := c.Stream(ctx, input); err != nil {
+				if qUsage, err := c.Stream(queryCtx, input); err != nil {
 					_, _ = fmt.Fprintln(os.Stderr, "Error:", err)
 				} else {
 					sugar.Infoln()
+					session.usage += qUsage
 					qNum++
 				}
 				fmt.Print(outPutReset)
 			}
 		}
-	} else {
-		if len(args) == 0 && !hasPipe {
-			return errors.New("you must specify your query or provide input via a pipe")
+	} else {
+		if len(args) == 0 && !hasPipe && templatePrompt == "" {
+			return errors.New("you must specify your query or provide input via a pipe")
+		}
+
+		if cmd.Flag("speak").Changed && cmd.Flag("output").Changed {
+			return c.SynthesizeSpeech(chatContext+strings.Join(args, " "), outputFile)
+		}
+
+		if cmd.Flag("draw").Changed && cmd.Flag("output").Changed {
+			if cmd.Flag("image").Changed {
+				return c.EditImage(chatContext+strings.Join(args, " "), imageFiles, maskFile, outputFile)
+			}
+			if maskFile != "" {
+				return errors.New("--mask needs the image to edit, pass it with --image")
+			}
+			return c.GenerateImage(chatContext+strings.Join(args, " "), outputFile)
+		}
+
+		if client.GetCapabilities(c.Config.Model).IsRealtime {
+			return realtimeQuery(ctx, c, strings.Join(args, " "), outputFile)
+		}
+
+		if queryMode {
+			result, usage, err := c.Query(ctx, strings.Join(args, " "))
+			if err != nil {
+				return err
+			}
+			sugar.Infoln(render(result))
+
+			if c.Config.TrackTokenUsage {
+				sugar.Infof("\n[Token Usage: %d]\n", usage)
+			}
+		} else {
+			usage, err := c.Stream(ctx, strings.Join(args, " "))
+			if err != nil {
+				return err
+			}
+
+			if c.Config.TrackTokenUsage {
+				sugar.Infof("\n[Token Usage: %d]\n", usage)
+			}
+		}
+	}
+	return nil
+}
+
+// realtimeQuery answers a single query over a realtime session, streaming the answer.
+func realtimeQuery(ctx context.Context, c *client.Client, input, audioOutput string) error {
+	sugar := zap.S()
+
+	rt, err := c.OpenRealtime(ctx, audioOutput)
+	if err != nil {
+		return err
+	}
+	defer rt.Close()
+
+	_, usage, err := rt.Send(ctx, input, os.Stdout)
+	if err != nil {
+		return err
+	}
+	sugar.Infoln()
+
+	if c.Config.TrackTokenUsage {
+		sugar.Infof("\n[Token Usage: %d]\n", usage)
+	}
+	return nil
+}
+
+// applyTemplate renders the named template with the --var values. The model, role and
+// temperature of its front-matter apply unless they were given on the command line.
+func applyTemplate(cmd *cobra.Command, name string, pairs []string) (string, error) {
+	dir, err := templates.Dir()
+	if err != nil {
+		return "", err
+	}
+
+	tpl, err := templates.Load(dir, name)
+	if err != nil {
+		return "", err
+	}
+
+	vars, err := templates.ParseVars(pairs)
+	if err != nil {
+		return "", err
+	}
+
+	prompt, err := tpl.Render(vars)
+	if err != nil {
+		return "", err
+	}
+
+	if tpl.Model != "" && !cmd.Flag("model").Changed {
+		cfg.Model = tpl.Model
+		viper.Set("model", tpl.Model)
+	}
+	if tpl.Role != "" && !cmd.Flag("role").Changed && !cmd.Flag("role-file").Changed {
+		cfg.Role = tpl.Role
+		viper.Set("role", tpl.Role)
+	}
+	if tpl.Temperature != nil && !cmd.Flag("temperature").Changed {
+		cfg.Temperature = *tpl.Temperature
+		viper.Set("temperature", *tpl.Temperature)
+	}
+
+	return prompt, nil
+}
+
+// doctor validates the user and project configuration and prints a health report. It
+// returns an error when a check fails so that scripts can rely on the exit code.
+func doctor(secretResolver *secrets.Resolver) error {
+	configHome, err := internal.GetConfigHome()
+	if err != nil {
+		return err
+	}
+	dataHome, err := internal.GetDataHome()
+	if err != nil {
+		return err
+	}
+	cacheHome, err := internal.GetCacheHome()
+	if err != nil {
+		return err
+	}
+
+	configPath := viper.ConfigFileUsed()
+	if configPath == "" {
+		configName := "config"
+		if modelTarget != "" {
+			configName += "." + modelTarget
+		}
+		configPath = filepath.Join(configHome, configName+".yaml")
+	}
+	cfg.Agent.PolicyFile = agentPolicyPath(cfg.Agent.PolicyFile)
+
+	d := utils.Doctor{
+		Config:     cfg,
+		ConfigPath: configPath,
+		DataHome:   dataHome,
+		CacheHome:  cacheHome,
+		Secrets:    secretResolver,
+	}
+	if projectConfig != nil {
+		d.ProjectConfigPath = projectConfig.Path
+		d.ProjectTrusted = projectConfig.Trusted
+	}
+
+	report := d.Run(context.Background())
+	zap.S().Infoln(report.String())
+
+	if n := report.Count(utils.SeverityError); n > 0 {
+		return fmt.Errorf("doctor found %d problem(s)", n)
+	}
+	return nil
+}
+
+// manageSecret stores the secret named by --secret, or the API key, in the secret backend
+// for --login and removes it for --logout.
+func manageSecret(resolver *secrets.Resolver, store bool) error {
+	if resolver.Backend == nil {
+		_, err := secrets.Open(cfg.SecretBackend)
+		return err
+	}
+
+	account, what := secretName, "secret "+secretName
+	if account == "" {
+		account, what = cfg.Name, "API key for "+cfg.Name
+	}
+
+	if !store {
+		if err := resolver.Backend.Delete(account); err != nil {
+			return err
+		}
+		if secretName == "" && cfg.APIKeyCommand != "" {
+			if err := resolver.Forget(cfg.APIKeyCommand); err != nil {
+				return err
+			}
+		}
+		zap.S().Infof("Removed the %s from %s", what, resolver.Backend.Name())
+		return nil
+	}
+
+	secret, err := readSecret(fmt.Sprintf("Enter the %s: ", what))
+	if err != nil {
+		return err
+	}
+	if secret == "" {
+		return errors.New("nothing to store, the secret is empty")
+	}
+
+	if err := resolver.Backend.Set(account, secret); err != nil {
+		return err
+	}
+	zap.S().Infof("Stored the %s in %s", what, resolver.Backend.Name())
+	return nil
+}
+
+// readSecret prompts for a secret without echoing it, or reads it from piped input.
+func readSecret(prompt string) (string, error) {
+	if !isTerminal(os.Stdin) {
+		data, err := io.ReadAll(os.Stdin)
+		return strings.TrimSpace(string(data)), err
+	}
+
+	rl, err := readline.New("")
+	if err != nil {
+		return "", err
+	}
+	defer rl.Close()
+
+	secret, err := rl.ReadPassword(prompt)
+	return strings.TrimSpace(string(secret)), err
+}
+
+func printTemplates() error {
+	sugar := zap.S()
+
+	dir, err := templates.Dir()
+	if err != nil {
+		return err
+	}
+
+	list, err := templates.List(dir)
+	if err != nil {
+		return err
+	}
+
+	if len(list) == 0 {
+		sugar.Infof("No templates found in %s\n", dir)
+		return nil
+	}
+
+	sugar.Infoln("Available templates:")
+	for _, tpl := range list {
+		line := "- " + tpl.Name
+		if vars, err := tpl.Variables(); err == nil && len(vars) > 0 {
+			line += " (" + strings.Join(vars, ", ") + ")"
+		}
+		if tpl.Description != "" {
+			line += ": " + tpl.Description
+		}
+		sugar.Infoln(line)
+	}
+	return nil
+}
+
+type replSession struct {
+	client        *client.Client
+	lastInput     string
+	pendingImages []string
+	pendingAudio  []string
+	usage         int
+}
+
+// handleSlashCommand runs a slash command from the interactive loop. It returns a
+// non-empty query when the command produced input that should be sent to the model.
+func (s *replSession) handleSlashCommand(name, arg string) (string, error) {
+	sugar := zap.S()
+	c := s.client
+
+	switch name {
+	case utils.SlashHelp:
+		sugar.Infoln(utils.SlashCommandHelp())
+	case utils.SlashModel:
+		if arg == "" {
+			sugar.Infof("Current model: %s\n", c.Config.Model)
+			return "", nil
+		}
+		c.Config.Model = arg
+		sugar.Infof("Switched to model %s\n", arg)
+	case utils.SlashThread:
+		if arg == "" {
+			sugar.Infof("Current thread: %s\n", c.Config.Thread)
+			return "", nil
+		}
+		c.SwitchThread(arg)
+		sugar.Infof("Switched to thread %s\n", arg)
+	case utils.SlashNew:
+		thread := internal.GenerateUniqueSlug(utils.InteractivePrefix)
+		c.SwitchThread(thread)
+		sugar.Infof("Started new thread %s\n", thread)
+	case utils.SlashHistory:
+		out, err := printThread(c.Config.Thread)
+		if err != nil {
+			return "", err
+		}
+		sugar.Infoln(out)
+	case utils.SlashSave:
+		if arg == "" {
+			return "", errors.New("usage: /save <path>")
+		}
+		out, err := printThread(c.Config.Thread)
+		if err != nil {
+			return "", err
+		}
+		if err := os.WriteFile(arg, []byte(out), 0o600); err != nil {
+			return "", err
+		}
+		sugar.Infof("Saved thread %s to %s\n", c.Config.Thread, arg)
+	case utils.SlashRetry:
+		query, ok := c.DropLastExchange()
+		if !ok {
+			return "", errors.New("nothing to retry")
+		}
+		return query, nil
+	case utils.SlashEdit:
+		if s.lastInput == "" {
+			return "", errors.New("no previous query to edit")
+		}
+		edited, err := utils.EditInEditor(s.lastInput)
+		if err != nil {
+			return "", err
+		}
+		if edited == "" {
+			sugar.Infoln("Empty query, nothing sent.")
+		}
+		return edited, nil
+	case utils.SlashFile:
+		if arg == "" {
+			return "", errors.New("usage: /file <path>")
+		}
+		paths, err := utils.CollectFiles([]string{arg}, nil)
+		if err != nil {
+			return "", err
+		}
+		fc := utils.BuildFileContext(paths, utils.FileContextBudget(c.Config.ContextWindow))
+		for _, skipped := range fc.Skipped {
+			sugar.Infof("Skipping %s\n", skipped)
+		}
+		for _, truncated := range fc.Truncated {
+			sugar.Infof("Truncated %s to fit the context window\n", truncated)
+		}
+		c.ProvideFileContext(fc.Blocks)
+		sugar.Infof("Attached %d file(s) from %s\n", len(fc.Blocks), arg)
+	case utils.SlashImage:
+		if arg == "" {
+			return "", errors.New("usage: /image <path|url>")
+		}
+		s.pendingImages = append(s.pendingImages, arg)
+		sugar.Infof("Image %s will be sent with the next query (%d attached)\n", arg, len(s.pendingImages))
+	case utils.SlashCopy:
+		response, ok := c.LastResponse()
+		if !ok {
+			return "", errors.New("no previous answer in this thread")
+		}
+		blocks := utils.ExtractCodeBlocks(response)
+
+		n := 1
+		if arg != "" {
+			var err error
+			if n, err = strconv.Atoi(arg); err != nil {
+				return "", fmt.Errorf("invalid block number %q", arg)
+			}
+		}
+		if n < 1 || n > len(blocks) {
+			return "", fmt.Errorf("the last answer has %d code block(s)", len(blocks))
 		}
 
-		if cmd.Flag("speak").Changed && cmd.Flag("output").Changed {
-			return c.SynthesizeSpeech(chatContext+strings.Join(args, " "), outputFile)
+		fmt.Print(utils.OSC52(blocks[n-1].Code))
+		sugar.Infof("Copied code block %d to the clipboard\n", n)
+	case utils.SlashTokens:
+		sugar.Infof("Session usage: %d tokens. Thread context: ~%d tokens of %d.\n",
+			s.usage, c.HistoryTokens(), c.Config.ContextWindow)
+	case utils.SlashSystem:
+		if arg == "" {
+			sugar.Infof("System role: %s\n", c.Config.Role)
+			return "", nil
 		}
+		c.SetRole(arg)
+		sugar.Infoln("System role updated.")
+	}
 
-		if cmd.Flag("draw").Changed && cmd.Flag("output").Changed {
-			if cmd.Flag("image").Changed {
-				return c.EditImage(chatContext+strings.Join(args, " "), imageFile, outputFile)
-			}
-			return c.GenerateImage(chatContext+strings.Join(args, " "), outputFile)
+	return "", nil
+}
+
+// responseForCode returns the answer --extract-code and --apply operate on: the answer
+// to the query if one was given, otherwise the last answer in the thread.
+func responseForCode(ctx context.Context, c *client.Client, args []string) (string, error) {
+	if len(args) > 0 || hasPipe {
+		result, _, err := c.Query(ctx, strings.Join(args, " "))
+		return result, err
+	}
+
+	response, ok := c.LastResponse()
+	if !ok {
+		return "", fmt.Errorf("no previous response in thread %q", c.Config.Thread)
+	}
+	return response, nil
+}
+
+func applyPatches(response string) error {
+	sugar := zap.S()
+
+	patches, err := utils.FindPatches(response)
+	if err != nil {
+		return err
+	}
+	if len(patches) == 0 {
+		return errors.New("no unified diffs or path-annotated code blocks in the response")
+	}
+
+	root, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+
+	in, err := openConfirmInput()
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	reader := bufio.NewReader(in)
+
+	for _, p := range patches {
+		target, err := utils.ResolvePatchPath(root, p.Path)
+		if err != nil {
+			return err
 		}
 
-		if queryMode {
-			result, usage, err := c.Query(ctx, strings.Join(args, " "))
-			if err != nil {
+		mode := os.FileMode(0o644)
+		orig, err := os.ReadFile(target)
+		if err != nil {
+			if !os.IsNotExist(err) {
 				return err
 			}
-			sugar.Infoln(result)
-
-			if c.Config.TrackTokenUsage {
-				sugar.Infof("\n[Token Usage: %d]\n", usage)
+			if p.Diff != "" && !p.NewFile {
+				return fmt.Errorf("cannot apply diff: %s does not exist", p.Path)
 			}
-		} else if err := c.Stream(ctx, strings.Join(args, " ")); err != nil {
+		} else if info, err := os.Stat(target); err == nil {
+			mode = info.Mode().Perm()
+		}
+
+		updated, err := p.Apply(orig)
+		if err != nil {
+			return fmt.Errorf("failed to apply changes to %s: %w", p.Path, err)
+		}
+
+		sugar.Infoln(p.Preview())
+		fmt.Printf("Apply changes to %s? [y/N] ", p.Path)
+
+		answer, _ := reader.ReadString('\n')
+		if a := strings.ToLower(strings.TrimSpace(answer)); a != "y" && a != "yes" {
+			sugar.Infof("Skipped %s\n", p.Path)
+			continue
+		}
+
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(target, updated, mode); err != nil {
 			return err
 		}
+		sugar.Infof("Applied %s\n", p.Path)
 	}
+
 	return nil
 }
 
+// openConfirmInput returns a reader for y/N prompts. It uses the controlling terminal
+// when stdin is a pipe.
+func openConfirmInput() (io.ReadCloser, error) {
+	if isTerminal(os.Stdin) {
+		return io.NopCloser(os.Stdin), nil
+	}
+
+	tty, err := os.Open("/dev/tty")
+	if err != nil {
+		return nil, errors.New("a terminal is needed to confirm changes")
+	}
+	return tty, nil
+}
+
+func printThread(thread string) (string, error) {
+	store, err := history.New()
+	if err != nil {
+		return "", err
+	}
+	return history.NewHistory(store).Print(thread)
+}
+
 func boolToOnOff(b bool) string {
 	if b {
 		return "ON"
@@ -653,6 +1386,30 @@ func initConfig(rootCmd *cobra.Command) (config.Config, error) {
 		}
 	}
 
+	// A .chatgpt-cli.yaml in the working directory or above overlays the user config. Its agent
+	// settings only apply to projects the user trusts in their own config or with --trust-project.
+	trusted := func(dir string) bool {
+		return trustProject || config.IsTrustedDir(dir, viper.GetStringSlice("trusted_projects"))
+	}
+	if wd, err := os.Getwd(); err == nil {
+		if projectConfig, err = config.LoadProjectConfig(wd, trusted); err != nil {
+			return config.Config{}, err
+		}
+	}
+	if projectConfig != nil {
+		if len(projectConfig.Ignored) > 0 {
+			_, _ = fmt.Fprintf(os.Stderr, "Warning: ignoring %s in %s, a project config may only set %s\n",
+				strings.Join(projectConfig.Ignored, ", "), projectConfig.Path, strings.Join(config.ProjectKeys, ", "))
+		}
+		if len(projectConfig.Untrusted) > 0 {
+			_, _ = fmt.Fprintf(os.Stderr, "Warning: ignoring %s in %s, trust the project with --trust-project or trusted_projects first\n",
+				strings.Join(projectConfig.Untrusted, ", "), projectConfig.Path)
+		}
+		if err := viper.MergeConfigMap(projectConfig.Settings); err != nil {
+			return config.Config{}, fmt.Errorf("failed to apply %s: %w", projectConfig.Path, err)
+		}
+	}
+
 	// Retrieve the name from Viper to set the environment prefix.
 	envPrefix := viper.GetString("name")
 	viper.SetEnvPrefix(envPrefix)
@@ -666,6 +1423,30 @@ func initConfig(rootCmd *cobra.Command) (config.Config, error) {
 	return createConfigFromViper(), nil
 }
 
+// configSource tells where the value of key comes from, following the precedence of
+// flags > env > project > user > defaults.
+func configSource(cmd *cobra.Command, key string, userSettings map[string]interface{}) string {
+	if flag := cmd.Flag(toAliasFlagName(key)); flag != nil && flag.Changed {
+		return "flag"
+	}
+	if key == "role" && cmd.Flag("role-file").Changed {
+		return "flag"
+	}
+
+	env := strings.ToUpper(viper.GetEnvPrefix() + "_" + key)
+	if _, ok := os.LookupEnv(env); ok {
+		return "env " + env
+	}
+
+	if projectConfig != nil && config.HasKey(projectConfig.Settings, key) {
+		return "project " + projectConfig.Path
+	}
+	if config.HasKey(userSettings, key) {
+		return "user " + viper.ConfigFileUsed()
+	}
+	return "default"
+}
+
 func readConfigWithComments(configPath string) (*yaml.Node, error) {
 	data, err := os.ReadFile(configPath)
 	if err != nil {
@@ -767,7 +1548,7 @@ func setShellTitle(title string) error {
 	return nil
 }
 
-func appendAgentRunToHistory(store history.Store, systemRole, goal, answer string) error {
+func appendAgentRunToHistory(store history.Store, systemRole, goal, answer string, run *history.AgentRun) error {
 	thread := store.GetThread()
 
 	entries, err := store.ReadThread(thread)
@@ -801,6 +1582,7 @@ func appendAgentRunToHistory(store history.Store, systemRole, goal, answer strin
 		history.History{
 			Message:   api.Message{Role: "assistant", Content: answer},
 			Timestamp: now,
+			Agent:     run,
 		},
 	)
 
@@ -809,25 +1591,99 @@ func appendAgentRunToHistory(store history.Store, systemRole, goal, answer strin
 	return store.Write(entries)
 }
 
-func resolveAgentMode(flagMode, cfgMode string) (string, error) {
-	mode := strings.ToLower(strings.TrimSpace(flagMode))
-	if mode == "" {
-		mode = strings.ToLower(strings.TrimSpace(cfgMode))
+// agentSession runs the agent goals of one conversation. Every run is told what the
+// earlier runs in the thread did, and is recorded in the thread along with its effects.
+type agentSession struct {
+	client *client.Client
+	cfg    config.Config
+	mode   string
+	store  history.Store // nil when history is off
+	runs   []types.PriorRun
+}
+
+func newAgentSession(c *client.Client, cfg config.Config, mode string, store history.Store) (*agentSession, error) {
+	s := &agentSession{client: c, cfg: cfg, mode: mode, store: store}
+	if store == nil {
+		return s, nil
+	}
+
+	entries, err := store.ReadThread(store.GetThread())
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
 	}
-	if mode == "" {
-		mode = "react"
+	s.runs = utils.PriorAgentRuns(entries)
+	return s, nil
+}
+
+func (s *agentSession) run(ctx context.Context, goal string) error {
+	answer, effects, err := runAgent(ctx, s.client, s.cfg, s.mode, goal, s.runs)
+	if err != nil {
+		return err
 	}
 
-	// allow some aliases, normalize to "react" or "plan"
-	switch mode {
-	case "react":
-		return "react", nil
-	case "plan":
-		return "plan", nil
-	case "plan_execute", "plan-execute":
-		return "plan", nil
-	default:
-		return "", fmt.Errorf("unknown agent mode %q (expected react|plan)", mode)
+	run := types.PriorRun{Goal: goal, Answer: answer, Effects: core.SummarizeEffects(effects)}
+	s.runs = append(s.runs, run)
+
+	if s.store == nil {
+		return nil
+	}
+	return appendAgentRunToHistory(s.store, s.cfg.Role, goal, answer, &history.AgentRun{Mode: s.mode, Effects: run.Effects})
+}
+
+// runAgentInteractive keeps one agent session alive across prompts, so a prompt can build
+// on what the agent did for the ones before it. A goal given on the command line runs
+// first.
+func runAgentInteractive(ctx context.Context, session *agentSession, chatContext string, args []string) error {
+	sugar := zap.S()
+
+	thread := session.cfg.Thread
+	if session.store != nil {
+		thread = session.store.GetThread()
+	}
+	sugar.Infof(
+		"Entering interactive agent mode (%s). Using thread '%s'. Each prompt is a new goal that builds on the earlier runs.\n"+
+			"Commands: 'clear' (clear screen), 'multiline' (toggle multiline input), 'exit' or Ctrl+C (quit).\n\n",
+		session.mode, thread,
+	)
+
+	if goal, err := buildAgentGoal(chatContext, args); err == nil {
+		if err := session.run(ctx, goal); err != nil {
+			sugar.Infoln("Error:", err)
+		}
+	}
+
+	rl, err := readline.NewEx(&readline.Config{Prompt: ""})
+	if err != nil {
+		return err
+	}
+	defer rl.Close()
+
+	cmdColor, cmdReset := utils.ColorToAnsi(session.cfg.CommandPromptColor)
+	multiline := session.cfg.Multiline
+
+	qNum := 1
+	for {
+		rl.SetPrompt(utils.FormatPrompt(session.cfg.CommandPrompt, qNum, 0, time.Now()))
+
+		fmt.Print(cmdColor)
+		input, err := readInput(rl, &multiline)
+		fmt.Print(cmdReset)
+
+		if err == io.EOF {
+			sugar.Infoln("Bye!")
+			return nil
+		}
+
+		goal := strings.TrimSpace(input)
+		if goal == "" {
+			continue
+		}
+
+		if err := session.run(ctx, goal); err != nil {
+			sugar.Infoln("Error:", err)
+			continue
+		}
+		qNum++
 	}
 }
 
@@ -847,29 +1703,93 @@ func buildAgentGoal(chatContext string, args []string) (string, error) {
 	return goal, nil
 }
 
-func runAgent(ctx context.Context, c *client.Client, cfg config.Config, mode string, goal string) (string, error) {
+// runAgent runs goal and returns the answer along with the effects of the run. priorRuns
+// are the earlier runs of the conversation.
+func runAgent(ctx context.Context, c *client.Client, cfg config.Config, mode string, goal string, priorRuns []types.PriorRun) (string, types.Effects, error) {
+	if err := utils.CheckAgentCost(cfg); err != nil {
+		return "", nil, err
+	}
+
 	clk := core.NewRealClock()
 	llm := tools.NewClientLLM(c)
 
-	tools, err := buildAgentTools(llm)
+	tools, err := buildAgentTools(llm, c.Caller, cfg.Agent.MaxHTTPResponseBytes)
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
 
-	policy, err := buildAgentPolicy(cfg)
+	var policyOpts []core.RulePolicyOption
+	if policyExplain {
+		// Explain what the policy decides without side effects or questions.
+		cfg.Agent.DryRun = true
+		var decisions []core.PolicyDecision
+		policyOpts = append(policyOpts,
+			core.WithAsker(func(types.Step, string) (bool, error) { return true, nil }),
+			core.WithDecisionObserver(func(d core.PolicyDecision) { decisions = append(decisions, d) }),
+		)
+		defer func() { printPolicyDecisions(decisions) }()
+	}
+
+	policy, err := buildAgentPolicy(cfg, policyOpts...)
 	if err != nil {
-		return "", err
+		return "", nil, err
+	}
+
+	var memOpts []core.BaseOption
+	if cfg.Agent.MemoryEnabled {
+		mem, err := openAgentMemory(cfg)
+		if err != nil {
+			return "", nil, err
+		}
+		tools.Memory = mem
+		memOpts = append(memOpts, core.WithMemory(mem))
 	}
 
-	budget := core.NewDefaultBudget(utils.BudgetLimitsFromConfig(cfg))
-	runner := core.NewDefaultRunner(tools, clk, budget, policy)
+	limits := utils.BudgetLimitsFromConfig(cfg)
+	if limits.MaxWallTime > 0 {
+		// The budget is only checked between steps; the deadline also aborts a step in flight,
+		// such as a slow HTTP fetch.
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, limits.MaxWallTime)
+		defer cancel()
+	}
+
+	budget := core.NewDefaultBudget(limits)
+	defer c.OnUsage(func(r usage.Record) { budget.ChargeCost(r.CostUSD, clk.Now()) })()
 
 	logs, err := core.NewLogs()
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
 	defer logs.Close()
 
+	// Options children share with the agent the user started.
+	childOpts := []core.BaseOption{
+		core.WithMaxParallel(cfg.Agent.MaxParallelSteps),
+		core.WithMaxReplans(cfg.Agent.MaxReplans),
+
+		// Debug: JSONL file only (already JSON encoder in logs.go)
+		core.WithDebugLogger(logs.DebugLogger, func() {
+			_ = logs.DebugZap.Sync()
+		}),
+	}
+	childOpts = append(childOpts, memOpts...)
+
+	if cfg.Agent.MaxDelegationDepth > 0 {
+		tools.Delegate = factory.NewDelegator(
+			factory.Deps{Clock: clk, LLM: llm, Budget: budget},
+			tools,
+			policy,
+			factory.WithPlanner(func(b core.Budget) planexec.Planner {
+				return planexec.NewDefaultPlanner(llm, b, clk)
+			}),
+			factory.WithChildOptions(childOpts...),
+			factory.WithMaxDepth(cfg.Agent.MaxDelegationDepth),
+			factory.WithArtifactsDir(logs.DelegatesDir),
+		)
+	}
+	runner := core.NewEffectRecorder(core.NewDefaultRunner(tools, clk, budget, policy))
+
 	// Tee human output: terminal + transcript file.
 	// zap.L() uses the global logger core (terminal), logs.HumanZap.Core() writes to transcript file.
 	humanTeeZap := zap.New(zapcore.NewTee(
@@ -881,18 +1801,16 @@ func runAgent(ctx context.Context, c *client.Client, cfg config.Config, mode str
 	baseOpts := []core.BaseOption{
 		core.WithWorkDir(cfg.Agent.WorkDir),
 		core.WithDryRun(cfg.Agent.DryRun),
+		core.WithPriorRuns(priorRuns),
+		core.WithDelegation(tools.Delegate != nil),
 
 		// Human (transcript): terminal + file
 		core.WithHumanLogger(humanTeeSug, func() {
 			// best-effort sync
 			_ = humanTeeZap.Sync()
 		}),
-
-		// Debug: JSONL file only (already JSON encoder in logs.go)
-		core.WithDebugLogger(logs.DebugLogger, func() {
-			_ = logs.DebugZap.Sync()
-		}),
 	}
+	baseOpts = append(baseOpts, childOpts...)
 
 	switch mode {
 	case "react":
@@ -903,9 +1821,10 @@ func runAgent(ctx context.Context, c *client.Client, cfg config.Config, mode str
 			Budget: budget,
 		}, baseOpts...)
 		if err != nil {
-			return "", err
+			return "", nil, err
 		}
-		return a.RunAgentGoal(ctx, goal)
+		answer, err := a.RunAgentGoal(ctx, goal)
+		return answer, runner.Effects(), err
 
 	case "plan":
 		var planner planexec.Planner = planexec.NewDefaultPlanner(
@@ -934,16 +1853,17 @@ func runAgent(ctx context.Context, c *client.Client, cfg config.Config, mode str
 			Budget:  budget,
 		}, baseOpts...)
 		if err != nil {
-			return "", err
+			return "", nil, err
 		}
-		return a.RunAgentGoal(ctx, goal)
+		answer, err := a.RunAgentGoal(ctx, goal)
+		return answer, runner.Effects(), err
 
 	default:
-		return "", fmt.Errorf("internal error: unsupported mode %q", mode)
+		return "", nil, fmt.Errorf("internal error: unsupported mode %q", mode)
 	}
 }
 
-func buildAgentTools(llm tools.LLM) (core.Tools, error) {
+func buildAgentTools(llm tools.LLM, caller http.Caller, maxHTTPBytes int) (core.Tools, error) {
 	sh := tools.NewExecShellRunner()
 	r := fsio.NewRealReader(fsio.DefaultBufferSize)
 	w := &fsio.RealWriter{}
@@ -953,21 +1873,172 @@ func buildAgentTools(llm tools.LLM) (core.Tools, error) {
 		Shell: sh,
 		LLM:   llm,
 		Files: files,
+		HTTP:  tools.NewCallerHTTP(caller, maxHTTPBytes),
+	}, nil
+}
+
+// newUsageLedger returns a function that keeps a usage record in the ledger under the data
+// home. The ledger never fails a request: errors are reported and the record is dropped.
+func newUsageLedger() (func(usage.Record), error) {
+	path, err := usage.LedgerPath()
+	if err != nil {
+		return nil, err
+	}
+	ledger := usage.NewLedger(path)
+
+	return func(r usage.Record) {
+		if err := ledger.Append(r); err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "Error recording usage: %v\n", err)
+		}
 	}, nil
 }
 
-func buildAgentPolicy(cfg config.Config) (core.Policy, error) {
-	allowedTools, err := parseToolKinds(cfg.Agent.AllowedTools)
+func printUsageReport(since string) error {
+	from, err := usage.ParseSince(since, time.Now())
+	if err != nil {
+		return err
+	}
+
+	path, err := usage.LedgerPath()
+	if err != nil {
+		return err
+	}
+	records, err := usage.NewLedger(path).Records(from)
+	if err != nil {
+		return err
+	}
+
+	var report strings.Builder
+	if err := usage.WriteReport(&report, records); err != nil {
+		return err
+	}
+	zap.S().Info(report.String())
+	return nil
+}
+
+func manageAgentMemory(cfg config.Config, action string) error {
+	sugar := zap.S()
+
+	mem, err := openAgentMemory(cfg)
+	if err != nil {
+		return err
+	}
+
+	switch strings.ToLower(strings.TrimSpace(action)) {
+	case "show":
+		facts, err := mem.Facts()
+		if err != nil {
+			return err
+		}
+		if !cfg.Agent.MemoryEnabled {
+			sugar.Infoln("Agent memory is disabled (set agent.memory_enabled to true to enable it)")
+		}
+		if len(facts) == 0 {
+			sugar.Infof("Nothing remembered yet (%s)", mem.Path())
+			return nil
+		}
+		sugar.Infof("Agent memory (%s):", mem.Path())
+		for _, f := range facts {
+			sugar.Infof("- %s", f)
+		}
+		return nil
+	case "clear":
+		if err := mem.Clear(); err != nil {
+			return err
+		}
+		sugar.Infof("Cleared the agent memory (%s)", mem.Path())
+		return nil
+	default:
+		return fmt.Errorf("invalid --agent-memory %q (expected show|clear)", action)
+	}
+}
+
+// openAgentMemory returns the project memory of the agent work dir.
+func openAgentMemory(cfg config.Config) (*tools.FileMemory, error) {
+	dir, err := filepath.Abs(cfg.Agent.WorkDir)
+	if err != nil {
+		return nil, err
+	}
+	cacheHome, err := internal.GetCacheHome()
+	if err != nil {
+		return nil, err
+	}
+	path, err := tools.MemoryPath(cfg.Agent.MemoryFile, dir, cacheHome)
+	if err != nil {
+		return nil, err
+	}
+	return tools.NewFileMemory(path, dir, cfg.Agent.MemoryMaxBytes), nil
+}
+
+func buildAgentPolicy(cfg config.Config, opts ...core.RulePolicyOption) (core.Policy, error) {
+	allowedTools, err := utils.ParseToolKinds(cfg.Agent.AllowedTools)
 	if err != nil {
 		return nil, err
 	}
 
-	return core.NewDefaultPolicy(core.PolicyLimits{
+	limits := core.PolicyLimits{
 		AllowedTools:           allowedTools,
 		DeniedShellCommands:    cfg.Agent.DeniedShellCommands,
 		AllowedFileOps:         cfg.Agent.AllowedFileOps,
 		RestrictFilesToWorkDir: cfg.Agent.RestrictFilesToWorkDir,
-	}), nil
+		AllowedDomains:         cfg.Agent.AllowedDomains,
+		AllowedHTTPMethods:     cfg.Agent.AllowedHTTPMethods,
+	}
+
+	rules := &core.PolicyRules{}
+	if path := agentPolicyPath(cfg.Agent.PolicyFile); path != "" {
+		if rules, err = core.LoadPolicyRules(path); err != nil {
+			return nil, err
+		}
+	} else if len(opts) == 0 {
+		return core.NewDefaultPolicy(limits), nil
+	}
+
+	opts = append([]core.RulePolicyOption{core.WithAsker(confirmAgentStep)}, opts...)
+	return core.NewRulePolicy(rules, limits, opts...), nil
+}
+
+// agentPolicyPath resolves a relative policy file set by the project configuration
+// against the directory of that file. The project only gets to pick the rules when the
+// user trusts it, its agent settings are dropped otherwise.
+func agentPolicyPath(path string) string {
+	path = strings.TrimSpace(path)
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	if projectConfig != nil && projectConfig.Trusted && config.HasKey(projectConfig.Settings, "agent.policy_file") {
+		return filepath.Join(filepath.Dir(projectConfig.Path), path)
+	}
+	return path
+}
+
+func confirmAgentStep(step types.Step, rule string) (bool, error) {
+	in, err := openConfirmInput()
+	if err != nil {
+		return false, err
+	}
+	defer in.Close()
+
+	fmt.Printf("Allow %s (%s)? [y/N] ", core.DescribeStep(step), rule)
+	answer, _ := bufio.NewReader(in).ReadString('\n')
+	a := strings.ToLower(strings.TrimSpace(answer))
+	return a == "y" || a == "yes", nil
+}
+
+func printPolicyDecisions(decisions []core.PolicyDecision) {
+	sugar := zap.S()
+	sugar.Infoln("\nPolicy decisions:")
+	if len(decisions) == 0 {
+		sugar.Infoln("  no steps were checked")
+		return
+	}
+	for i, d := range decisions {
+		line := fmt.Sprintf("  %d. %-5s %s  [%s]", i+1, d.Action, core.DescribeStep(d.Step), d.Rule)
+		if d.Reason != "" {
+			line += ": " + d.Reason
+		}
+		sugar.Infoln(line)
+	}
 }
 
 func toAliasFlagName(viperKey string) string {
@@ -1092,29 +2163,47 @@ func setCustomHelp(rootCmd *cobra.Command) {
 		printFlagWithPadding("-q, --query", "Use query mode instead of stream mode")
 		printFlagWithPadding("-i, --interactive", "Use interactive mode")
 		printFlagWithPadding("-p, --prompt", "Provide a prompt file for context")
+		printFlagWithPadding("--template", "Use a prompt template from the prompts directory")
+		printFlagWithPadding("--var", "Set a template variable as name=value (repeatable)")
+		printFlagWithPadding("--list-templates", "List the prompt templates")
+		printFlagWithPadding("--file", "Attach a file or glob as context (repeatable)")
+		printFlagWithPadding("--dir", "Attach a directory as context, honoring .gitignore (repeatable)")
 		printFlagWithPadding("-n, --new-thread", "Create a new thread with a random name and target it")
 		printFlagWithPadding("-c, --config", "Display the configuration")
+		printFlagWithPadding("--doctor", "Validate the configuration and check the CLI's directories")
+		printFlagWithPadding("--login", "Store the API key, or the --secret, in the OS keyring")
+		printFlagWithPadding("--logout", "Remove the API key, or the --secret, from the OS keyring")
+		printFlagWithPadding("--secret", "Name of the secret for --login/--logout, referenced as ${keyring:name}")
 		printFlagWithPadding("-v, --version", "Display the version information")
 		printFlagWithPadding("-l, --list-models", "List available models")
 		printFlagWithPadding("--list-threads", "List available threads")
 		printFlagWithPadding("--delete-thread", "Delete the specified thread (supports wildcards)")
 		printFlagWithPadding("--clear-history", "Clear the history of the current thread")
 		printFlagWithPadding("--show-history [thread]", "Show the human-readable conversation history")
-		printFlagWithPadding("--image", "Upload an image from the specified local path or URL")
-		printFlagWithPadding("--audio", "Upload an audio file (mp3 or wav)")
+		printFlagWithPadding("--image", "Upload an image from a local path or URL (repeatable)")
+		printFlagWithPadding("--audio", "Upload an audio file, mp3 or wav (repeatable)")
 		printFlagWithPadding("--transcribe", "Transcribe an audio file")
 		printFlagWithPadding("--speak", "Use text-to-speech")
-		printFlagWithPadding("--draw", "Draw an image")
-		printFlagWithPadding("--output", "The output audio file for text-to-speech")
+		printFlagWithPadding("--speak-answer", "Read streamed answers aloud as they arrive")
+		printFlagWithPadding("--draw", "Draw an image, or edit the --image files")
+		printFlagWithPadding("--mask", "PNG mask whose transparent areas mark what --draw may edit")
+		printFlagWithPadding("--output", "The output file for text-to-speech, images, transcripts (.srt, .vtt, .json, .txt) or realtime answers (.wav)")
 		printFlagWithPadding("--role-file", "Set the system role from the specified file")
 		printFlagWithPadding("--debug", "Print debug messages")
 		printFlagWithPadding("--agent", "Enable agent mode")
+		printFlagWithPadding("--agent-policy-explain", "With --agent, dry-run and report which policy rule decided each step")
+		printFlagWithPadding("--agent-memory show|clear", "Show or forget what the agent remembers about the work dir")
+		printFlagWithPadding("--usage-report", "Report tokens and cost by day, model, thread and team")
+		printFlagWithPadding("--since", "With --usage-report, only usage since a day (2006-01-02) or a duration (7d, 12h)")
 		printFlagWithPadding("--target", "Load configuration from config.<target>.yaml")
 		printFlagWithPadding("--mcp", "MCP endpoint URL (e.g. http://localhost:3333)")
 		printFlagWithPadding("--mcp-tool", "Tool name to call on the MCP server")
 		printFlagWithPadding("--mcp-header", "HTTP header for MCP call (repeatable, 'Key: Value')")
 		printFlagWithPadding("--mcp-param", "Key-value pair as key=value. Can be specified multiple times")
 		printFlagWithPadding("--mcp-params", "Provide parameters as a raw JSON string")
+		printFlagWithPadding("--extract-code[=lang]", "Print only the code blocks of the last response")
+		printFlagWithPadding("--apply", "Apply diffs or path-annotated code blocks from the last response")
+		printFlagWithPadding("--serve", "Serve an OpenAI-compatible proxy on the given address (e.g. :8080)")
 		printFlagWithPadding("--set-completions", "Generate autocompletion script for your current shell")
 		sugar.Infoln()
 
@@ -1150,18 +2239,29 @@ func setupFlags(rootCmd *cobra.Command) {
 	rootCmd.PersistentFlags().BoolVarP(&queryMode, "query", "q", false, "Use query mode instead of stream mode")
 	rootCmd.PersistentFlags().BoolVar(&clearHistory, "clear-history", false, "Clear all prior conversation context for the current thread")
 	rootCmd.PersistentFlags().BoolVarP(&showConfig, "config", "c", false, "Display the configuration")
+	rootCmd.PersistentFlags().BoolVar(&runDoctor, "doctor", false, "Validate the configuration and check the CLI's directories")
+	rootCmd.PersistentFlags().BoolVar(&login, "login", false, "Store the API key, or the --secret, in the OS keyring")
+	rootCmd.PersistentFlags().BoolVar(&logout, "logout", false, "Remove the API key, or the --secret, from the OS keyring")
+	rootCmd.PersistentFlags().StringVar(&secretName, "secret", "", "Name of the secret for --login/--logout, referenced as ${keyring:name}")
 	rootCmd.PersistentFlags().BoolVarP(&showVersion, "version", "v", false, "Display the version information")
 	rootCmd.PersistentFlags().BoolVarP(&showDebug, "debug", "", false, "Enable debug mode")
 	rootCmd.PersistentFlags().BoolVarP(&newThread, "new-thread", "n", false, "Create a new thread with a random name and target it")
 	rootCmd.PersistentFlags().BoolVarP(&listModels, "list-models", "l", false, "List available models")
 	rootCmd.PersistentFlags().BoolVarP(&useSpeak, "speak", "", false, "Use text-to-speak")
+	rootCmd.PersistentFlags().BoolVar(&speakAnswer, "speak-answer", false, "Read streamed answers aloud as they arrive")
 	rootCmd.PersistentFlags().BoolVarP(&useDraw, "draw", "", false, "Draw an image")
 	rootCmd.PersistentFlags().StringVarP(&promptFile, "prompt", "p", "", "Provide a prompt file")
+	rootCmd.PersistentFlags().StringVar(&templateName, "template", "", "Use a prompt template from the prompts directory")
+	rootCmd.PersistentFlags().StringArrayVar(&templateVars, "var", []string{}, "Set a template variable as name=value (repeatable)")
+	rootCmd.PersistentFlags().BoolVar(&listTemplates, "list-templates", false, "List the prompt templates")
+	rootCmd.PersistentFlags().StringArrayVar(&contextFiles, "file", []string{}, "Attach a file or glob (supports **) as context (repeatable)")
+	rootCmd.PersistentFlags().StringArrayVar(&contextDirs, "dir", []string{}, "Attach a directory as context, honoring .gitignore (repeatable)")
 	rootCmd.PersistentFlags().StringVarP(&roleFile, "role-file", "", "", "Provide a role file")
-	rootCmd.PersistentFlags().StringVarP(&imageFile, "image", "", "", "Provide an image from a local path or URL")
-	rootCmd.PersistentFlags().StringVarP(&outputFile, "output", "", "", "Provide an output file for text-to-speech")
-	rootCmd.PersistentFlags().StringVarP(&audioFile, "audio", "", "", "Provide an audio file from a local path")
-	rootCmd.PersistentFlags().StringVarP(&audioFile, "transcribe", "", "", "Provide an audio file from a local path")
+	rootCmd.PersistentFlags().StringArrayVar(&imageFiles, "image", []string{}, "Provide an image from a local path or URL (repeatable)")
+	rootCmd.PersistentFlags().StringVar(&maskFile, "mask", "", "Provide a PNG mask for editing an image with --draw")
+	rootCmd.PersistentFlags().StringVarP(&outputFile, "output", "", "", "Provide an output file for text-to-speech, images, transcripts or realtime answers")
+	rootCmd.PersistentFlags().StringArrayVar(&audioFiles, "audio", []string{}, "Provide an audio file from a local path (repeatable)")
+	rootCmd.PersistentFlags().StringVarP(&transcribeFile, "transcribe", "", "", "Provide an audio file from a local path")
 	rootCmd.PersistentFlags().BoolVarP(&listThreads, "list-threads", "", false, "List available threads")
 	rootCmd.PersistentFlags().StringVar(&threadName, "delete-thread", "", "Delete the specified thread")
 	rootCmd.PersistentFlags().BoolVar(&showHistory, "show-history", false, "Show the human-readable conversation history")
@@ -1173,6 +2273,15 @@ func setupFlags(rootCmd *cobra.Command) {
 	rootCmd.PersistentFlags().StringArrayVar(&paramsList, "mcp-param", []string{}, "Key-value pair as key=value. Can be specified multiple times")
 	rootCmd.PersistentFlags().StringVar(&paramsJSON, "mcp-params", "", "Provide parameters as a raw JSON string")
 	rootCmd.PersistentFlags().BoolVar(&agentEnabled, "agent", false, "Run agent (experimental)")
+	rootCmd.PersistentFlags().BoolVar(&policyExplain, "agent-policy-explain", false, "Dry-run the agent and report which policy rule decided each step")
+	rootCmd.PersistentFlags().BoolVar(&trustProject, "trust-project", false, "Apply the agent settings of the project .chatgpt-cli.yaml for this run")
+	rootCmd.PersistentFlags().StringVar(&agentMemory, "agent-memory", "", "Show or clear the agent memory of the work dir (show|clear)")
+	rootCmd.PersistentFlags().BoolVar(&usageReport, "usage-report", false, "Report tokens and cost by day, model, thread and team")
+	rootCmd.PersistentFlags().StringVar(&usageSince, "since", "", "With --usage-report, only usage since a day (2006-01-02) or a duration (7d, 12h)")
+	rootCmd.PersistentFlags().StringVar(&serveAddr, "serve", "", "Serve an OpenAI-compatible proxy on the given address")
+	rootCmd.PersistentFlags().StringVar(&extractCode, "extract-code", "", "Print only the fenced code blocks of the last response (optionally --extract-code=<lang>)")
+	rootCmd.PersistentFlags().Lookup("extract-code").NoOptDefVal = utils.AnyLanguage
+	rootCmd.PersistentFlags().BoolVar(&applyCode, "apply", false, "Apply the diffs or path-annotated code blocks of the last response")
 }
 
 func setupConfigFlags(rootCmd *cobra.Command, meta ConfigMetadata) {
@@ -1208,33 +2317,52 @@ func isNonConfigSetter(name string) bool {
 
 func isGeneralFlag(name string) bool {
 	var generalFlags = map[string]bool{
-		"query":           true,
-		"interactive":     true,
-		"config":          true,
-		"version":         true,
-		"new-thread":      true,
-		"list-models":     true,
-		"list-threads":    true,
-		"clear-history":   true,
-		"delete-thread":   true,
-		"show-history":    true,
-		"prompt":          true,
-		"agent":           true,
-		"set-completions": true,
-		"help":            true,
-		"role-file":       true,
-		"image":           true,
-		"audio":           true,
-		"speak":           true,
-		"draw":            true,
-		"output":          true,
-		"transcribe":      true,
-		"mcp":             true,
-		"mcp-header":      true,
-		"mcp-param":       true,
-		"mcp-params":      true,
-		"mcp-tool":        true,
-		"target":          true,
+		"query":                true,
+		"interactive":          true,
+		"config":               true,
+		"doctor":               true,
+		"login":                true,
+		"logout":               true,
+		"secret":               true,
+		"version":              true,
+		"new-thread":           true,
+		"list-models":          true,
+		"list-threads":         true,
+		"clear-history":        true,
+		"delete-thread":        true,
+		"show-history":         true,
+		"prompt":               true,
+		"template":             true,
+		"var":                  true,
+		"list-templates":       true,
+		"file":                 true,
+		"dir":                  true,
+		"agent":                true,
+		"agent-policy-explain": true,
+		"agent-memory":         true,
+		"usage-report":         true,
+		"trust-project":        true,
+		"since":                true,
+		"set-completions":      true,
+		"help":                 true,
+		"role-file":            true,
+		"image":                true,
+		"audio":                true,
+		"speak":                true,
+		"speak-answer":         true,
+		"draw":                 true,
+		"output":               true,
+		"mask":                 true,
+		"transcribe":           true,
+		"mcp":                  true,
+		"mcp-header":           true,
+		"mcp-param":            true,
+		"mcp-params":           true,
+		"mcp-tool":             true,
+		"target":               true,
+		"serve":                true,
+		"extract-code":         true,
+		"apply":                true,
 	}
 
 	return generalFlags[name]
@@ -1325,11 +2453,24 @@ func syncFlag(cmd *cobra.Command, meta ConfigMetadata, alias string) error {
 	return nil
 }
 
+// usagePricesFromViper reads the usage.prices table, e.g. {"my-model": {"input": 1, "output": 4}}.
+func usagePricesFromViper() map[string]usage.Price {
+	var prices map[string]usage.Price
+	if err := viper.UnmarshalKey("usage.prices", &prices); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Ignoring usage.prices: %v\n", err)
+		return nil
+	}
+	return prices
+}
+
 func createConfigFromViper() config.Config {
 	return config.Config{
 		Name:                 viper.GetString("name"),
 		APIKey:               viper.GetString("api_key"),
 		APIKeyFile:           viper.GetString("api_key_file"),
+		APIKeyCommand:        viper.GetString("api_key_command"),
+		APIKeyCommandTTL:     viper.GetInt("api_key_command_ttl"),
+		SecretBackend:        viper.GetString("secret_backend"),
 		Model:                viper.GetString("model"),
 		MaxTokens:            viper.GetInt("max_tokens"),
 		ContextWindow:        viper.GetInt("context_window"),
@@ -1348,6 +2489,7 @@ func createConfigFromViper() config.Config {
 		ImageGenerationsPath: viper.GetString("image_generations_path"),
 		ImageEditsPath:       viper.GetString("image_edits_path"),
 		ModelsPath:           viper.GetString("models_path"),
+		RealtimePath:         viper.GetString("realtime_path"),
 		AuthHeader:           viper.GetString("auth_header"),
 		AuthTokenPrefix:      viper.GetString("auth_token_prefix"),
 		CommandPrompt:        viper.GetString("command_prompt"),
@@ -1360,13 +2502,25 @@ func createConfigFromViper() config.Config {
 		SkipTLSVerify:        viper.GetBool("skip_tls_verify"),
 		HTTPTimeout:          viper.GetInt("http_timeout"),
 		Multiline:            viper.GetBool("multiline"),
+		RenderMarkdown:       viper.GetBool("render_markdown"),
 		Seed:                 viper.GetInt("seed"),
 		Effort:               viper.GetString("effort"),
 		Web:                  viper.GetBool("web"),
 		WebContextSize:       viper.GetString("web_context_size"),
+		StreamUsage:          viper.GetString("stream_usage"),
 		Voice:                viper.GetString("voice"),
+		SpeechModel:          viper.GetString("speech_model"),
+		SpeechSpeed:          viper.GetFloat64("speech_speed"),
+		SpeechInstructions:   viper.GetString("speech_instructions"),
 		UserAgent:            viper.GetString("user_agent"),
 		CustomHeaders:        viper.GetStringMapString("custom_headers"),
+		TrustedProjects:      viper.GetStringSlice("trusted_projects"),
+		MaxCostUSD:           viper.GetFloat64("max_cost_usd"),
+		Usage: config.UsageConfig{
+			Ledger: viper.GetBool("usage.ledger"),
+			Team:   viper.GetString("usage.team"),
+			Prices: usagePricesFromViper(),
+		},
 		Agent: config.AgentConfig{
 			Mode:          viper.GetString("agent.mode"),
 			WorkDir:       viper.GetString("agent.work_dir"),
@@ -1377,53 +2531,53 @@ func createConfigFromViper() config.Config {
 			MaxShellCalls: viper.GetInt("agent.max_shell_calls"),
 			MaxLLMCalls:   viper.GetInt("agent.max_llm_calls"),
 			MaxFileOps:    viper.GetInt("agent.max_file_ops"),
+			MaxHTTPCalls:  viper.GetInt("agent.max_http_calls"),
 			MaxLLMTokens:  viper.GetInt("agent.max_llm_tokens"),
+			MaxCostUSD:    viper.GetFloat64("agent.max_cost_usd"),
 
 			AllowedTools:           viper.GetStringSlice("agent.allowed_tools"),
 			DeniedShellCommands:    viper.GetStringSlice("agent.denied_shell_commands"),
 			AllowedFileOps:         viper.GetStringSlice("agent.allowed_file_ops"),
 			RestrictFilesToWorkDir: viper.GetBool("agent.restrict_files_to_work_dir"),
+			PolicyFile:             viper.GetString("agent.policy_file"),
 
-			WritePlanJSON: viper.GetBool("agent.write_plan_json"),
-			PlanJSONPath:  viper.GetString("agent.plan_json_path"),
-		},
-	}
-}
-
-func parseToolKinds(in []string) ([]types.ToolKind, error) {
-	out := make([]types.ToolKind, 0, len(in))
-	seen := map[types.ToolKind]bool{}
+			AllowedDomains:       viper.GetStringSlice("agent.allowed_domains"),
+			AllowedHTTPMethods:   viper.GetStringSlice("agent.allowed_http_methods"),
+			MaxHTTPResponseBytes: viper.GetInt("agent.max_http_response_bytes"),
 
-	for _, raw := range in {
-		s := strings.ToLower(strings.TrimSpace(raw))
-		if s == "" {
-			continue
-		}
+			MaxParallelSteps: viper.GetInt("agent.max_parallel_steps"),
+			MaxReplans:       viper.GetInt("agent.max_replans"),
 
-		var k types.ToolKind
-		switch s {
-		case "shell":
-			k = types.ToolShell
-		case "llm":
-			k = types.ToolLLM
-		case "files", "file":
-			k = types.ToolFiles
-		default:
-			return nil, fmt.Errorf("unknown agent.allowed_tools entry %q (expected shell|llm|files)", raw)
-		}
+			MemoryEnabled:  viper.GetBool("agent.memory_enabled"),
+			MemoryFile:     viper.GetString("agent.memory_file"),
+			MemoryMaxBytes: viper.GetInt("agent.memory_max_bytes"),
 
-		if !seen[k] {
-			seen[k] = true
-			out = append(out, k)
-		}
-	}
+			MaxDelegationDepth: viper.GetInt("agent.max_delegation_depth"),
 
-	// If config is empty, decide your behavior. I’d rather error than silently allow all.
-	if len(out) == 0 {
-		return nil, errors.New("agent.allowed_tools is empty (expected at least one of shell|llm|files)")
+			WritePlanJSON: viper.GetBool("agent.write_plan_json"),
+			PlanJSONPath:  viper.GetString("agent.plan_json_path"),
+		},
+		Proxy: config.ProxyConfig{
+			ModelAliases: viper.GetStringMapString("proxy.model_aliases"),
+			Cache:        viper.GetBool("proxy.cache"),
+			CacheTTL:     viper.GetInt("proxy.cache_ttl"),
+			Token:        viper.GetString("proxy.token"),
+		},
+		Transcription: config.TranscriptionConfig{
+			Format:       viper.GetString("transcription.format"),
+			Language:     viper.GetString("transcription.language"),
+			Prompt:       viper.GetString("transcription.prompt"),
+			ChunkSeconds: viper.GetInt("transcription.chunk_seconds"),
+			Concurrency:  viper.GetInt("transcription.concurrency"),
+		},
+		Image: config.ImageConfig{
+			Size:         viper.GetString("image.size"),
+			Quality:      viper.GetString("image.quality"),
+			N:            viper.GetInt("image.n"),
+			Background:   viper.GetString("image.background"),
+			OutputFormat: viper.GetString("image.output_format"),
+		},
 	}
-
-	return out, nil
 }
 
 func fileExists(filename string) bool {
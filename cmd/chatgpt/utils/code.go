@@ -0,0 +1,294 @@
+package utils
+
+import (
+	"bufio"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	agentutils "github.com/kardolus/chatgpt-cli/agent/utils"
+)
+
+const (
+	// AnyLanguage is the --extract-code value used when no language is given.
+	AnyLanguage = "*"
+	devNull     = "/dev/null"
+)
+
+var (
+	rePathAnnotation = regexp.MustCompile("^[\\s*_`#]*(?:path|file(?:name)?):\\s*`?([^`\\s*]+)`?[\\s*_]*$")
+	reHunkHeader     = regexp.MustCompile(`(?m)^@@ -\d+(?:,\d+)? \+\d+(?:,\d+)? @@`)
+)
+
+type CodeBlock struct {
+	Lang string
+	Path string
+	Code string
+}
+
+// FilePatch is a change to a single file: either a unified diff or, for path-annotated
+// blocks, the full new content.
+type FilePatch struct {
+	Path    string
+	Diff    string
+	Content string
+	NewFile bool
+}
+
+// ExtractCodeBlocks returns the fenced code blocks in text in order of appearance. A
+// block is annotated with a path when its info string contains "path:<p>" or
+// "path=<p>", or when the line right before the fence reads "path: <p>".
+func ExtractCodeBlocks(text string) []CodeBlock {
+	var (
+		blocks   []CodeBlock
+		cur      *CodeBlock
+		body     []string
+		fence    string
+		lastLine string
+	)
+
+	sc := bufio.NewScanner(strings.NewReader(text))
+	sc.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+
+	for sc.Scan() {
+		line := strings.TrimSuffix(sc.Text(), "\r")
+		trimmed := strings.TrimSpace(line)
+
+		if cur != nil {
+			if strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]) == "" {
+				cur.Code = strings.Join(body, "\n")
+				if len(body) > 0 {
+					cur.Code += "\n"
+				}
+				blocks = append(blocks, *cur)
+				cur, body = nil, nil
+				continue
+			}
+			body = append(body, line)
+			continue
+		}
+
+		for _, marker := range []string{"```", "~~~"} {
+			if !strings.HasPrefix(trimmed, marker) {
+				continue
+			}
+			n := len(trimmed) - len(strings.TrimLeft(trimmed, marker[:1]))
+			fence = trimmed[:n]
+			cur = &CodeBlock{}
+
+			for i, field := range strings.Fields(trimmed[n:]) {
+				switch {
+				case strings.HasPrefix(field, "path:") || strings.HasPrefix(field, "path="):
+					cur.Path = field[len("path:"):]
+				case i == 0 && strings.Contains(field, ":"):
+					// ```go:main.go
+					cur.Lang, cur.Path, _ = strings.Cut(field, ":")
+				case i == 0:
+					cur.Lang = field
+				}
+			}
+			cur.Lang = strings.ToLower(cur.Lang)
+
+			if cur.Path == "" {
+				if m := rePathAnnotation.FindStringSubmatch(lastLine); m != nil {
+					cur.Path = m[1]
+				}
+			}
+			break
+		}
+
+		if trimmed != "" {
+			lastLine = trimmed
+		}
+	}
+
+	// an unterminated fence (e.g. a truncated answer) still counts
+	if cur != nil {
+		cur.Code = strings.Join(body, "\n") + "\n"
+		blocks = append(blocks, *cur)
+	}
+
+	return blocks
+}
+
+// FilterCodeBlocks keeps the blocks tagged with lang. AnyLanguage and "" keep all.
+func FilterCodeBlocks(blocks []CodeBlock, lang string) []CodeBlock {
+	lang = strings.ToLower(strings.TrimSpace(lang))
+	if lang == "" || lang == AnyLanguage {
+		return blocks
+	}
+
+	var out []CodeBlock
+	for _, b := range blocks {
+		if b.Lang == lang {
+			out = append(out, b)
+		}
+	}
+	return out
+}
+
+// FindPatches collects the changes described by a response: unified diffs (fenced or
+// bare) and path-annotated code blocks.
+func FindPatches(text string) ([]FilePatch, error) {
+	var patches []FilePatch
+
+	blocks := ExtractCodeBlocks(text)
+	for _, b := range blocks {
+		if isUnifiedDiff(b.Code) {
+			p, err := SplitUnifiedDiff(b.Code, b.Path)
+			if err != nil {
+				return nil, err
+			}
+			patches = append(patches, p...)
+			continue
+		}
+		if b.Path != "" {
+			patches = append(patches, FilePatch{Path: b.Path, Content: b.Code})
+		}
+	}
+
+	if len(blocks) == 0 && isUnifiedDiff(text) {
+		return SplitUnifiedDiff(text, "")
+	}
+
+	return patches, nil
+}
+
+// SplitUnifiedDiff splits a (possibly multi-file) unified diff into one patch per file.
+// fallbackPath is used when the diff has no ---/+++ headers.
+func SplitUnifiedDiff(diff, fallbackPath string) ([]FilePatch, error) {
+	var (
+		patches []FilePatch
+		cur     *FilePatch
+		oldPath string
+		body    strings.Builder
+	)
+
+	flush := func() {
+		if cur != nil {
+			cur.Diff = body.String()
+			patches = append(patches, *cur)
+		}
+		cur = nil
+		body.Reset()
+	}
+
+	lines := strings.SplitAfter(diff, "\n")
+	for i, line := range lines {
+		trimmed := strings.TrimRight(line, "\r\n")
+
+		// a removed line starting with "-- " looks like a header; only treat it as one
+		// when it is followed by the matching +++ line
+		isHeader := strings.HasPrefix(trimmed, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ ")
+
+		switch {
+		case strings.HasPrefix(trimmed, "diff "):
+			flush()
+			continue
+		case isHeader:
+			flush()
+			oldPath = diffPath(trimmed[4:])
+			continue
+		case strings.HasPrefix(trimmed, "+++ ") && i > 0 && strings.HasPrefix(lines[i-1], "--- "):
+			flush()
+			newPath := diffPath(trimmed[4:])
+			cur = &FilePatch{Path: newPath, NewFile: oldPath == devNull}
+			if newPath == devNull {
+				return nil, fmt.Errorf("deleting files is not supported (%s)", oldPath)
+			}
+			continue
+		case strings.HasPrefix(trimmed, "index "):
+			continue
+		}
+
+		if cur == nil {
+			if !strings.HasPrefix(trimmed, "@@") {
+				continue
+			}
+			if fallbackPath == "" {
+				return nil, errors.New("unified diff has no file header and no path annotation")
+			}
+			cur = &FilePatch{Path: fallbackPath}
+		}
+		body.WriteString(line)
+	}
+	flush()
+
+	return patches, nil
+}
+
+// Apply returns the new content of the file given its current content.
+func (p FilePatch) Apply(orig []byte) ([]byte, error) {
+	if p.Diff == "" {
+		return []byte(p.Content), nil
+	}
+
+	if p.NewFile {
+		var sb strings.Builder
+		for _, line := range strings.SplitAfter(p.Diff, "\n") {
+			if strings.HasPrefix(line, "+") {
+				sb.WriteString(line[1:])
+			}
+		}
+		return []byte(sb.String()), nil
+	}
+
+	return agentutils.ApplyUnifiedDiff(orig, []byte(p.Diff))
+}
+
+// Preview renders the change for a confirmation prompt.
+func (p FilePatch) Preview() string {
+	if p.Diff != "" {
+		return fmt.Sprintf("--- %s\n+++ %s\n%s", p.Path, p.Path, p.Diff)
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("+++ %s (full content)\n", p.Path))
+	for _, line := range strings.SplitAfter(p.Content, "\n") {
+		if line != "" {
+			sb.WriteString("+" + line)
+		}
+	}
+	return sb.String()
+}
+
+// ResolvePatchPath resolves path against root and rejects paths that escape it.
+func ResolvePatchPath(root, path string) (string, error) {
+	if filepath.IsAbs(path) {
+		return "", fmt.Errorf("refusing to patch absolute path %q", path)
+	}
+
+	full := filepath.Join(root, path)
+	rel, err := filepath.Rel(root, full)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("refusing to patch %q outside of %s", path, root)
+	}
+	return full, nil
+}
+
+// OSC52 returns the terminal escape sequence that puts text on the system clipboard.
+func OSC52(text string) string {
+	return "\033]52;c;" + base64.StdEncoding.EncodeToString([]byte(text)) + "\a"
+}
+
+func isUnifiedDiff(s string) bool {
+	return reHunkHeader.MatchString(s)
+}
+
+// diffPath strips the a/ b/ prefixes and any trailing timestamp from a ---/+++ header.
+func diffPath(s string) string {
+	if i := strings.IndexByte(s, '\t'); i >= 0 {
+		s = s[:i]
+	}
+	s = strings.TrimSpace(s)
+	if s == devNull {
+		return s
+	}
+	if strings.HasPrefix(s, "a/") || strings.HasPrefix(s, "b/") {
+		s = s[2:]
+	}
+	return s
+}
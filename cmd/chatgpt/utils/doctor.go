@@ -0,0 +1,558 @@
+package utils
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/kardolus/chatgpt-cli/agent/core"
+	"github.com/kardolus/chatgpt-cli/agent/types"
+	"github.com/kardolus/chatgpt-cli/cache"
+	"github.com/kardolus/chatgpt-cli/config"
+	"github.com/kardolus/chatgpt-cli/internal/secrets"
+	"github.com/kardolus/chatgpt-cli/internal/usage"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+const doctorHTTPTimeout = 5 * time.Second
+
+// FileOps lists the operations the agent's file tool supports.
+var FileOps = []string{"read", "write", "patch", "replace", "list", "search", "stat", "mkdir", "move", "delete"}
+
+type Severity int
+
+const (
+	SeverityOK Severity = iota
+	SeverityWarning
+	SeverityError
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityWarning:
+		return "warn"
+	case SeverityError:
+		return "error"
+	default:
+		return "ok"
+	}
+}
+
+// Finding is the outcome of a single --doctor check.
+type Finding struct {
+	Severity Severity
+	Check    string
+	Message  string
+}
+
+type DoctorReport []Finding
+
+// Count returns the number of findings with the given severity.
+func (r DoctorReport) Count(severity Severity) int {
+	n := 0
+	for _, f := range r {
+		if f.Severity == severity {
+			n++
+		}
+	}
+	return n
+}
+
+func (r DoctorReport) String() string {
+	var sb strings.Builder
+	for _, f := range r {
+		sb.WriteString(fmt.Sprintf("%-7s %-13s %s\n", "["+f.Severity.String()+"]", f.Check, f.Message))
+	}
+
+	errs, warnings := r.Count(SeverityError), r.Count(SeverityWarning)
+	if errs == 0 && warnings == 0 {
+		sb.WriteString("\nNo problems found.")
+	} else {
+		sb.WriteString(fmt.Sprintf("\n%s, %s.", plural(errs, "error"), plural(warnings, "warning")))
+	}
+	return sb.String()
+}
+
+// Doctor validates the configuration and reports on the directories the CLI writes to.
+type Doctor struct {
+	Config config.Config
+
+	// ConfigPath is the user configuration file, which may not exist. ProjectConfigPath is
+	// the .chatgpt-cli.yaml in effect, if any, and ProjectTrusted tells whether its agent
+	// settings apply.
+	ConfigPath        string
+	ProjectConfigPath string
+	ProjectTrusted    bool
+
+	DataHome  string
+	CacheHome string
+
+	// Secrets resolves references in api_key and finds the key stored with --login.
+	Secrets *secrets.Resolver
+
+	// LookupEnv defaults to os.LookupEnv and HTTPClient to a client with a short timeout.
+	LookupEnv  func(string) (string, bool)
+	HTTPClient *http.Client
+}
+
+// Run performs all checks.
+func (d Doctor) Run(ctx context.Context) DoctorReport {
+	var report DoctorReport
+
+	report = append(report, d.checkConfigFile("config", d.ConfigPath)...)
+	if d.ProjectConfigPath != "" {
+		report = append(report, d.checkConfigFile("project", d.ProjectConfigPath)...)
+		report = append(report, d.checkProjectTrust()...)
+	}
+	report = append(report, d.checkEnvironment()...)
+	report = append(report, d.checkColors()...)
+	report = append(report, d.checkAPIKey(ctx)...)
+	report = append(report, d.checkURL(ctx))
+	report = append(report, d.checkAgent()...)
+	report = append(report, d.checkUsage()...)
+	report = append(report, checkDir("history", d.DataHome))
+	report = append(report, checkDir("cache", d.CacheHome))
+	report = append(report, checkMCPSessions(MCPSessionsDir(d.CacheHome))...)
+
+	return report
+}
+
+// MCPSessionsDir is where the MCP session IDs are cached.
+func MCPSessionsDir(cacheHome string) string {
+	return filepath.Join(cacheHome, "mcp", "sessions")
+}
+
+func (d Doctor) checkConfigFile(check, path string) []Finding {
+	if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+		return []Finding{{SeverityOK, check, fmt.Sprintf("%s does not exist, using the defaults", path)}}
+	}
+
+	settings, err := config.ReadSettings(path)
+	if err != nil {
+		return []Finding{{SeverityError, check, err.Error()}}
+	}
+
+	issues := config.Validate(settings)
+	if len(issues) == 0 {
+		return []Finding{{SeverityOK, check, path + " is valid"}}
+	}
+
+	var findings []Finding
+	for _, issue := range issues {
+		findings = append(findings, Finding{SeverityError, check, issue.String()})
+	}
+	return findings
+}
+
+// checkProjectTrust tells which agent settings the project config changes, since they decide
+// what the agent may do on this machine.
+func (d Doctor) checkProjectTrust() []Finding {
+	settings, err := config.ReadSettings(d.ProjectConfigPath)
+	if err != nil {
+		return nil
+	}
+
+	var keys []string
+	for _, key := range config.TrustedProjectKeys {
+		keys = append(keys, leafKeys(settings[key], key)...)
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	sort.Strings(keys)
+
+	if !d.ProjectTrusted {
+		return []Finding{{SeverityWarning, "project", fmt.Sprintf(
+			"ignoring %s: the project is not trusted (use --trust-project or add it to trusted_projects)",
+			strings.Join(keys, ", "))}}
+	}
+	return []Finding{{SeverityWarning, "project", "the trusted project sets " + strings.Join(keys, ", ")}}
+}
+
+// leafKeys returns the dotted keys of the values in a nested settings map.
+func leafKeys(value interface{}, prefix string) []string {
+	nested, ok := value.(map[string]interface{})
+	if !ok {
+		if value == nil {
+			return nil
+		}
+		return []string{prefix}
+	}
+
+	var keys []string
+	for key, v := range nested {
+		keys = append(keys, leafKeys(v, prefix+"."+key)...)
+	}
+	return keys
+}
+
+func (d Doctor) checkEnvironment() []Finding {
+	lookup := d.LookupEnv
+	if lookup == nil {
+		lookup = os.LookupEnv
+	}
+
+	var findings []Finding
+	for _, issue := range config.ValidateEnvironment(d.Config.Name, lookup) {
+		findings = append(findings, Finding{SeverityError, "env", issue.Message})
+	}
+	return findings
+}
+
+func (d Doctor) checkColors() []Finding {
+	var findings []Finding
+	for key, color := range map[string]string{
+		"command_prompt_color": d.Config.CommandPromptColor,
+		"output_prompt_color":  d.Config.OutputPromptColor,
+	} {
+		if code, _ := ColorToAnsi(color); color != "" && code == "" {
+			findings = append(findings, Finding{SeverityError, "colors",
+				fmt.Sprintf("%s: invalid color %q (expected red, green, yellow, blue or magenta)", key, color)})
+		}
+	}
+	if len(findings) == 0 {
+		return []Finding{{SeverityOK, "colors", "prompt colors are valid"}}
+	}
+	sortFindings(findings)
+	return findings
+}
+
+func (d Doctor) checkAPIKey(ctx context.Context) []Finding {
+	cfg := d.Config
+	resolver := d.Secrets
+	if resolver == nil {
+		resolver = &secrets.Resolver{}
+	}
+
+	var findings []Finding
+	switch {
+	case cfg.APIKey != "":
+		if _, err := resolver.Expand(ctx, cfg.APIKey); err != nil {
+			return []Finding{{SeverityError, "api key", "api_key: " + err.Error()}}
+		}
+		findings = append(findings, Finding{SeverityOK, "api key", "API key is set"})
+	case cfg.APIKeyFile != "":
+		if _, err := config.ReadAPIKeyFile(cfg.APIKeyFile); err != nil {
+			return []Finding{{SeverityError, "api key", fmt.Sprintf("api_key_file %s: %v", cfg.APIKeyFile, err)}}
+		}
+		findings = append(findings, Finding{SeverityOK, "api key", fmt.Sprintf("api_key_file %s is readable", cfg.APIKeyFile)})
+	case cfg.APIKeyCommand != "":
+		// Credential helpers may prompt, so they are not run here.
+		findings = append(findings, Finding{SeverityOK, "api key", fmt.Sprintf("api_key_command %q provides the API key", cfg.APIKeyCommand)})
+	default:
+		if _, err := resolver.Lookup(cfg.Name); err != nil {
+			return []Finding{{SeverityError, "api key",
+				fmt.Sprintf("no API key, set %s_API_KEY, api_key, api_key_file or api_key_command, or run --login", strings.ToUpper(cfg.Name))}}
+		}
+		return []Finding{{SeverityOK, "api key", "API key is stored in " + resolver.Backend.Name()}}
+	}
+
+	var ignored []string
+	if cfg.APIKey != "" && cfg.APIKeyFile != "" {
+		ignored = append(ignored, "api_key_file")
+	}
+	if (cfg.APIKey != "" || cfg.APIKeyFile != "") && cfg.APIKeyCommand != "" {
+		ignored = append(ignored, "api_key_command")
+	}
+	if len(ignored) > 0 {
+		findings = append(findings, Finding{SeverityWarning, "api key",
+			fmt.Sprintf("the API key is set in more than one way, %s is ignored", strings.Join(ignored, " and "))})
+	}
+	return findings
+}
+
+// checkURL only checks that the server answers, any HTTP status will do.
+func (d Doctor) checkURL(ctx context.Context) Finding {
+	url := d.Config.URL
+	if url == "" {
+		return Finding{SeverityError, "url", "url is empty"}
+	}
+
+	client := d.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: doctorHTTPTimeout}
+		if d.Config.SkipTLSVerify {
+			client.Transport = &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return Finding{SeverityError, "url", fmt.Sprintf("invalid url %q: %v", url, err)}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return Finding{SeverityError, "url", fmt.Sprintf("%s is unreachable: %v", url, err)}
+	}
+	_ = resp.Body.Close()
+
+	return Finding{SeverityOK, "url", fmt.Sprintf("%s is reachable (%s)", url, resp.Status)}
+}
+
+func (d Doctor) checkUsage() []Finding {
+	var findings []Finding
+	fail := func(severity Severity, format string, args ...interface{}) {
+		findings = append(findings, Finding{severity, "usage", fmt.Sprintf(format, args...)})
+	}
+
+	models := make([]string, 0, len(d.Config.Usage.Prices))
+	for model := range d.Config.Usage.Prices {
+		models = append(models, model)
+	}
+	sort.Strings(models)
+	for _, model := range models {
+		if p := d.Config.Usage.Prices[model]; p.Input < 0 || p.CachedInput < 0 || p.Output < 0 || p.Reasoning < 0 {
+			fail(SeverityError, "usage.prices.%s has a negative price", model)
+		}
+	}
+
+	_, priced := usage.NewPrices(d.Config.Usage.Prices).Lookup(d.Config.Model)
+	if d.Config.MaxCostUSD < 0 {
+		fail(SeverityError, "max_cost_usd is negative (0 means unlimited)")
+	} else if d.Config.MaxCostUSD > 0 && !priced {
+		fail(SeverityError, "max_cost_usd is set but model %s has no price, so every request is refused; add it under usage.prices", d.Config.Model)
+	}
+	if d.Config.Agent.MaxCostUSD < 0 {
+		fail(SeverityError, "agent.max_cost_usd is negative (0 means unlimited)")
+	} else if d.Config.Agent.MaxCostUSD > 0 && !priced {
+		fail(SeverityError, "agent.max_cost_usd is set but model %s has no price, so agent runs are refused; add it under usage.prices", d.Config.Model)
+	}
+
+	return findings
+}
+
+func (d Doctor) checkAgent() []Finding {
+	agent := d.Config.Agent
+
+	var findings []Finding
+	fail := func(severity Severity, format string, args ...interface{}) {
+		findings = append(findings, Finding{severity, "agent", fmt.Sprintf(format, args...)})
+	}
+
+	if _, err := ResolveAgentMode("", agent.Mode); err != nil {
+		fail(SeverityError, "agent.mode: %v", err)
+	}
+	allowedTools, err := ParseToolKinds(agent.AllowedTools)
+	if err != nil {
+		fail(SeverityError, "%v", err)
+	}
+	for _, op := range agent.AllowedFileOps {
+		if !contains(FileOps, strings.ToLower(strings.TrimSpace(op))) {
+			fail(SeverityError, "unknown agent.allowed_file_ops entry %q (expected %s)", op, strings.Join(FileOps, "|"))
+		}
+	}
+	for _, method := range agent.AllowedHTTPMethods {
+		if !contains(core.HTTPMethods, strings.ToUpper(strings.TrimSpace(method))) {
+			fail(SeverityError, "unknown agent.allowed_http_methods entry %q (expected %s)", method, strings.Join(core.HTTPMethods, "|"))
+		}
+	}
+	for _, domain := range agent.AllowedDomains {
+		if strings.ContainsAny(domain, ":/ ") {
+			fail(SeverityError, "agent.allowed_domains entry %q should be a host name, like example.com", domain)
+		}
+	}
+
+	for key, value := range map[string]int{
+		"max_steps":               agent.MaxSteps,
+		"max_iterations":          agent.MaxIterations,
+		"max_wall_time":           agent.MaxWallTime,
+		"max_shell_calls":         agent.MaxShellCalls,
+		"max_llm_calls":           agent.MaxLLMCalls,
+		"max_file_ops":            agent.MaxFileOps,
+		"max_http_calls":          agent.MaxHTTPCalls,
+		"max_llm_tokens":          agent.MaxLLMTokens,
+		"max_http_response_bytes": agent.MaxHTTPResponseBytes,
+	} {
+		if value < 0 {
+			fail(SeverityError, "agent.%s is negative (0 means unlimited)", key)
+		}
+	}
+	if agent.MaxParallelSteps < 0 {
+		fail(SeverityError, "agent.max_parallel_steps is negative (0 or 1 runs plan steps one at a time)")
+	}
+	if agent.MaxReplans < 0 {
+		fail(SeverityError, "agent.max_replans is negative (0 means never)")
+	}
+	if agent.MemoryMaxBytes < 0 {
+		fail(SeverityError, "agent.memory_max_bytes is negative (0 means the default)")
+	}
+	if agent.MaxDelegationDepth < 0 {
+		fail(SeverityError, "agent.max_delegation_depth is negative (0 means no delegation)")
+	}
+	if agent.MemoryEnabled && len(allowedTools) > 0 && !slices.Contains(allowedTools, types.ToolMemory) {
+		fail(SeverityWarning, "agent.memory_enabled is on but agent.allowed_tools doesn't list memory, so no new facts are remembered")
+	}
+	if agent.MaxDelegationDepth == 0 && slices.Contains(allowedTools, types.ToolDelegate) {
+		fail(SeverityWarning, "agent.allowed_tools lists delegate but agent.max_delegation_depth is 0, so the agent can't delegate")
+	}
+
+	if agent.WorkDir != "" {
+		if info, err := os.Stat(agent.WorkDir); err != nil || !info.IsDir() {
+			fail(SeverityError, "agent.work_dir %s is not a directory", agent.WorkDir)
+		}
+	} else if agent.RestrictFilesToWorkDir {
+		fail(SeverityWarning, "agent.restrict_files_to_work_dir has no effect while agent.work_dir is empty")
+	}
+
+	if agent.PolicyFile != "" {
+		if _, err := core.LoadPolicyRules(agent.PolicyFile); err != nil {
+			fail(SeverityError, "%v", err)
+		}
+	}
+
+	if agent.PlanJSONPath != "" && !agent.WritePlanJSON {
+		fail(SeverityWarning, "agent.plan_json_path is set but agent.write_plan_json is off")
+	}
+
+	if len(findings) == 0 {
+		return []Finding{{SeverityOK, "agent", "agent settings are consistent"}}
+	}
+	sortFindings(findings)
+	return findings
+}
+
+func checkDir(check, dir string) Finding {
+	info, err := os.Stat(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return Finding{SeverityOK, check, dir + " does not exist yet"}
+	}
+	if err != nil {
+		return Finding{SeverityError, check, err.Error()}
+	}
+	if !info.IsDir() {
+		return Finding{SeverityError, check, dir + " is not a directory"}
+	}
+
+	probe, err := os.CreateTemp(dir, ".doctor-*")
+	if err != nil {
+		return Finding{SeverityError, check, fmt.Sprintf("%s is not writable: %v", dir, err)}
+	}
+	_ = probe.Close()
+	_ = os.Remove(probe.Name())
+
+	var files int
+	var size int64
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			files++
+			size += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return Finding{SeverityWarning, check, fmt.Sprintf("%s: %v", dir, err)}
+	}
+
+	return Finding{SeverityOK, check, fmt.Sprintf("%s, %s, %s", dir, plural(files, "file"), formatSize(size))}
+}
+
+// checkMCPSessions reads every cached session entry. Unreadable entries and temporary files
+// left behind by an interrupted write are reported so they can be removed.
+func checkMCPSessions(dir string) []Finding {
+	const check = "mcp sessions"
+
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return []Finding{{SeverityOK, check, "no cached MCP sessions"}}
+	}
+	if err != nil {
+		return []Finding{{SeverityError, check, err.Error()}}
+	}
+
+	var sessions, corrupt, leftovers int
+	var lastUsed time.Time
+	for _, e := range entries {
+		name := e.Name()
+		switch {
+		case e.IsDir():
+			continue
+		case strings.HasSuffix(name, ".tmp"):
+			leftovers++
+		case strings.HasSuffix(name, ".json"):
+			data, err := os.ReadFile(filepath.Join(dir, name))
+			var entry cache.Entry
+			if err == nil {
+				err = json.Unmarshal(data, &entry)
+			}
+			if err != nil || entry.SessionID == "" {
+				corrupt++
+				continue
+			}
+			sessions++
+			if entry.UpdatedAt.After(lastUsed) {
+				lastUsed = entry.UpdatedAt
+			}
+		}
+	}
+
+	message := fmt.Sprintf("%s in %s", plural(sessions, "cached session"), dir)
+	if sessions > 0 {
+		message += ", last used " + lastUsed.Local().Format(time.DateTime)
+	}
+	findings := []Finding{{SeverityOK, check, message}}
+
+	if corrupt > 0 {
+		findings = append(findings, Finding{SeverityWarning, check,
+			fmt.Sprintf("%s can't be read and should be removed", plural(corrupt, "entry"))})
+	}
+	if leftovers > 0 {
+		findings = append(findings, Finding{SeverityWarning, check,
+			fmt.Sprintf("%s left behind by interrupted writes", plural(leftovers, "temporary file"))})
+	}
+	return findings
+}
+
+// sortFindings keeps the output of checks that iterate over maps stable.
+func sortFindings(findings []Finding) {
+	sort.Slice(findings, func(i, j int) bool {
+		return findings[i].Message < findings[j].Message
+	})
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func plural(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	if strings.HasSuffix(noun, "y") {
+		return fmt.Sprintf("%d %sies", n, strings.TrimSuffix(noun, "y"))
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(size)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,519 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/kardolus/chatgpt-cli/internal/document"
+)
+
+const (
+	gitDir        = ".git"
+	gitignoreFile = ".gitignore"
+
+	// MaxContextFileSize caps how much of a single file is read before budgeting.
+	// MaxContextDocumentSize caps PDF and DOCX files, which are read whole to get their text.
+	MaxContextFileSize     = 4 * 1024 * 1024
+	MaxContextDocumentSize = 32 * 1024 * 1024
+
+	docxExt = ".docx"
+)
+
+// FileContext is the result of BuildFileContext: one delimited block per included file
+// plus the files that were left out or shortened.
+type FileContext struct {
+	Blocks    []string
+	Skipped   []string
+	Truncated []string
+}
+
+// FileContextBudget is the share of the context window attached files may use.
+func FileContextBudget(contextWindow int) int {
+	return contextWindow / 2
+}
+
+// CollectFiles expands --file patterns and walks --dir roots. Patterns support the
+// usual glob syntax plus "**" for any number of directories. Files matched by a
+// .gitignore are skipped, except when a --file pattern names them literally. The
+// result is de-duplicated and keeps the order in which files were found.
+func CollectFiles(patterns, dirs []string) ([]string, error) {
+	var (
+		out     []string
+		seen    = map[string]bool{}
+		ignores = newIgnoreSet()
+	)
+
+	add := func(path string) {
+		path = filepath.Clean(path)
+		if !seen[path] {
+			seen[path] = true
+			out = append(out, path)
+		}
+	}
+
+	for _, pattern := range patterns {
+		if !hasGlobMeta(pattern) {
+			info, err := os.Stat(pattern)
+			if err != nil {
+				return nil, err
+			}
+			if info.IsDir() {
+				dirs = append(dirs, pattern)
+				continue
+			}
+			add(pattern)
+			continue
+		}
+
+		matches, err := expandGlob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no files match %q", pattern)
+		}
+		root := globRoot(pattern)
+		for _, m := range matches {
+			if info, err := os.Stat(m); err != nil || info.IsDir() {
+				continue
+			}
+			if rel, err := filepath.Rel(root, m); err == nil && ignores.ignored(root, filepath.ToSlash(rel), false) {
+				continue
+			}
+			add(m)
+		}
+	}
+
+	for _, dir := range dirs {
+		err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if path == dir {
+				return nil
+			}
+			if d.IsDir() && d.Name() == gitDir {
+				return filepath.SkipDir
+			}
+
+			rel, err := filepath.Rel(dir, path)
+			if err != nil {
+				return err
+			}
+			if ignores.ignored(dir, filepath.ToSlash(rel), d.IsDir()) {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if d.Type().IsRegular() {
+				add(path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return out, nil
+}
+
+// BuildFileContext reads the files and turns each into a delimited block. PDF, DOCX and
+// HTML pages are converted to text; other binary and unreadable files are skipped. Text files
+// are cut at MaxContextFileSize. When budget (in estimated tokens) is positive, it is
+// shared fairly: small files are kept whole and the remainder is split between the
+// larger ones, which are truncated in the middle.
+func BuildFileContext(paths []string, budget int) FileContext {
+	type entry struct {
+		path    string
+		content string
+		tokens  int
+		cut     bool
+	}
+
+	var (
+		result  FileContext
+		entries []*entry
+	)
+
+	for _, path := range paths {
+		data, cut, err := readContextFile(path)
+		if err != nil {
+			result.Skipped = append(result.Skipped, fmt.Sprintf("%s (%v)", path, err))
+			continue
+		}
+		content := string(data)
+		if IsBinary(data) {
+			switch document.Detect(data) {
+			case document.KindPDF, document.KindDOCX:
+				text, err := document.ToText(data)
+				if err != nil {
+					result.Skipped = append(result.Skipped, fmt.Sprintf("%s (%v)", path, err))
+					continue
+				}
+				content = text
+			default:
+				result.Skipped = append(result.Skipped, path+" (binary)")
+				continue
+			}
+		} else if document.Detect(data) == document.KindHTML {
+			if text, err := document.HTMLText(data); err == nil {
+				content = text
+			}
+		}
+		if cut {
+			content = strings.ToValidUTF8(content, "") + "\n" + cutMarker()
+		}
+		entries = append(entries, &entry{path: path, content: content, tokens: EstimateTokens(content), cut: cut})
+	}
+
+	limits := make(map[*entry]int, len(entries))
+	if budget > 0 {
+		bySize := append([]*entry(nil), entries...)
+		sort.SliceStable(bySize, func(i, j int) bool { return bySize[i].tokens < bySize[j].tokens })
+
+		remaining := budget
+		for i, e := range bySize {
+			share := remaining / (len(bySize) - i)
+			if e.tokens <= share {
+				remaining -= e.tokens
+				continue
+			}
+			limits[e] = share
+			remaining -= share
+		}
+	}
+
+	for _, e := range entries {
+		content := e.content
+		limit, limited := limits[e]
+		if limited {
+			content = TruncateToTokens(content, limit)
+		}
+		if limited || e.cut {
+			result.Truncated = append(result.Truncated, e.path)
+		}
+		result.Blocks = append(result.Blocks, FileBlock(e.path, content))
+	}
+
+	return result
+}
+
+// FileBlock wraps the content of a file in delimiters that carry its path.
+func FileBlock(path, content string) string {
+	if content != "" && !strings.HasSuffix(content, "\n") {
+		content += "\n"
+	}
+	return fmt.Sprintf("<file path=%q>\n%s</file>", filepath.ToSlash(path), content)
+}
+
+// EstimateTokens uses the same approximation as the client's history truncation.
+func EstimateTokens(s string) int {
+	return tokenUnits(s) / 2
+}
+
+// tokenUnits is twice the token estimate; unlike EstimateTokens it adds up exactly.
+func tokenUnits(s string) int {
+	words := strings.Fields(s)
+	chars := 0
+	for _, w := range words {
+		chars += utf8.RuneCountInString(w)
+	}
+	return chars + len(words)
+}
+
+// TruncateToTokens keeps the head and the tail of s (two thirds / one third of the
+// limit) and replaces the middle with a marker noting how many lines were dropped.
+func TruncateToTokens(s string, limit int) string {
+	if EstimateTokens(s) <= limit {
+		return s
+	}
+
+	lines := strings.SplitAfter(s, "\n")
+	units := 2*limit - tokenUnits(omittedMarker(len(lines)))
+
+	headUnits := units * 2 / 3
+	head, used := 0, 0
+	for head < len(lines) {
+		t := tokenUnits(lines[head])
+		if used+t > headUnits {
+			break
+		}
+		used += t
+		head++
+	}
+
+	tail, used := len(lines), 0
+	for tail > head {
+		t := tokenUnits(lines[tail-1])
+		if used+t > units-headUnits {
+			break
+		}
+		used += t
+		tail--
+	}
+
+	var sb strings.Builder
+	sb.WriteString(strings.Join(lines[:head], ""))
+	if head > 0 && !strings.HasSuffix(lines[head-1], "\n") {
+		sb.WriteString("\n")
+	}
+	sb.WriteString(omittedMarker(tail - head))
+	sb.WriteString(strings.Join(lines[tail:], ""))
+	return sb.String()
+}
+
+func omittedMarker(lines int) string {
+	return fmt.Sprintf("[... %d lines omitted to fit the context window ...]\n", lines)
+}
+
+func cutMarker() string {
+	return fmt.Sprintf("[... rest of the file omitted, it is larger than %d MB ...]\n", MaxContextFileSize>>20)
+}
+
+// readContextFile reads a file for BuildFileContext. Files up to MaxContextFileSize and
+// documents up to MaxContextDocumentSize are read whole. Of larger text files only the
+// first MaxContextFileSize bytes are read, and cut is set; larger documents are an error,
+// since their text can't be extracted from a part.
+func readContextFile(path string) (data []byte, cut bool, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, false, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, false, err
+	}
+	if info.Size() <= MaxContextFileSize {
+		data, err := io.ReadAll(f)
+		return data, false, err
+	}
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(f, head)
+	if err != nil {
+		return nil, false, err
+	}
+	head = head[:n]
+
+	if isDocument(path, head) {
+		if info.Size() > MaxContextDocumentSize {
+			return nil, false, fmt.Errorf("document larger than %d MB", MaxContextDocumentSize>>20)
+		}
+		rest, err := io.ReadAll(f)
+		return append(head, rest...), false, err
+	}
+
+	rest, err := io.ReadAll(io.LimitReader(f, MaxContextFileSize-int64(n)))
+	return append(head, rest...), true, err
+}
+
+// isDocument tells from the first bytes, and the extension for DOCX, whether a file is a
+// PDF or DOCX document.
+func isDocument(path string, head []byte) bool {
+	switch document.Detect(head) {
+	case document.KindPDF:
+		return true
+	case document.KindUnknown, document.KindDOCX:
+		return strings.EqualFold(filepath.Ext(path), docxExt) && bytes.HasPrefix(head, []byte("PK\x03\x04"))
+	}
+	return false
+}
+
+func hasGlobMeta(s string) bool {
+	return strings.ContainsAny(s, "*?[")
+}
+
+// globRoot returns the directory part of a pattern before its first wildcard.
+func globRoot(pattern string) string {
+	parts := strings.Split(filepath.ToSlash(pattern), "/")
+	var static []string
+	for _, p := range parts {
+		if hasGlobMeta(p) {
+			break
+		}
+		static = append(static, p)
+	}
+	if len(static) == len(parts) {
+		static = static[:len(static)-1]
+	}
+	root := strings.Join(static, "/")
+	if root == "" {
+		if strings.HasPrefix(pattern, "/") {
+			return "/"
+		}
+		return "."
+	}
+	return filepath.FromSlash(root)
+}
+
+func expandGlob(pattern string) ([]string, error) {
+	if !strings.Contains(pattern, "**") {
+		return filepath.Glob(pattern)
+	}
+
+	root := globRoot(pattern)
+	re, err := regexp.Compile("^" + globToRegex(strings.TrimPrefix(filepath.ToSlash(pattern), "./")) + "$")
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []string
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && d.Name() == gitDir {
+			return filepath.SkipDir
+		}
+		if !d.IsDir() && re.MatchString(strings.TrimPrefix(filepath.ToSlash(path), "./")) {
+			matches = append(matches, path)
+		}
+		return nil
+	})
+	return matches, err
+}
+
+// globToRegex converts a gitignore-style glob to a regular expression.
+func globToRegex(glob string) string {
+	var sb strings.Builder
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch {
+		case strings.HasPrefix(glob[i:], "**/"):
+			sb.WriteString("(.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "/**") && i+3 == len(glob):
+			sb.WriteString("(/.*)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			sb.WriteString(".*")
+			i++
+		case c == '*':
+			sb.WriteString("[^/]*")
+		case c == '?':
+			sb.WriteString("[^/]")
+		case c == '[':
+			j := strings.IndexByte(glob[i:], ']')
+			if j < 0 {
+				sb.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+j]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			sb.WriteString("[" + class + "]")
+			i += j
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return sb.String()
+}
+
+type ignoreRule struct {
+	re      *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+func parseGitignore(data string) []ignoreRule {
+	var rules []ignoreRule
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimRight(line, " \r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		var rule ignoreRule
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		}
+		line = strings.TrimPrefix(line, `\`)
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimSuffix(line, "/")
+		}
+
+		anchored := strings.Contains(line, "/")
+		line = strings.TrimPrefix(line, "/")
+
+		expr := globToRegex(line)
+		if !anchored {
+			expr = "(.*/)?" + expr
+		}
+
+		re, err := regexp.Compile("^" + expr + "$")
+		if err != nil {
+			continue
+		}
+		rule.re = re
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// ignoreSet loads .gitignore files lazily and answers whether a path is ignored.
+type ignoreSet struct {
+	cache map[string][]ignoreRule
+}
+
+func newIgnoreSet() *ignoreSet {
+	return &ignoreSet{cache: map[string][]ignoreRule{}}
+}
+
+func (s *ignoreSet) rules(dir string) []ignoreRule {
+	if rules, ok := s.cache[dir]; ok {
+		return rules
+	}
+	data, _ := os.ReadFile(filepath.Join(dir, gitignoreFile))
+	rules := parseGitignore(string(data))
+	s.cache[dir] = rules
+	return rules
+}
+
+// ignored reports whether rel (slash-separated, relative to root) is excluded by the
+// .gitignore files in root or any directory between root and rel. As in git, a file
+// inside an excluded directory cannot be re-included.
+func (s *ignoreSet) ignored(root, rel string, isDir bool) bool {
+	if rel == "." || rel == "" {
+		return false
+	}
+	parts := strings.Split(rel, "/")
+
+	for k := 1; k <= len(parts); k++ {
+		dir := k < len(parts) || isDir
+		excluded := false
+
+		for i := 0; i < k; i++ {
+			base := filepath.Join(append([]string{root}, parts[:i]...)...)
+			sub := strings.Join(parts[i:k], "/")
+			for _, r := range s.rules(base) {
+				if r.dirOnly && !dir {
+					continue
+				}
+				if r.re.MatchString(sub) {
+					excluded = !r.negate
+				}
+			}
+		}
+
+		if excluded {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,53 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+// audioPlayers are the command line players tried for --speak-answer, each followed by
+// the arguments that go before the file to play.
+var audioPlayers = [][]string{
+	{"afplay"},
+	{"paplay"},
+	{"aplay", "-q"},
+	{"ffplay", "-nodisp", "-autoexit", "-loglevel", "quiet"},
+	{"mpv", "--really-quiet", "--no-video"},
+}
+
+// AudioPlayer returns a function that plays wav audio with the first player found on the
+// PATH, blocking until playback has finished.
+func AudioPlayer() (func(audio []byte) error, error) {
+	for _, player := range audioPlayers {
+		path, err := exec.LookPath(player[0])
+		if err != nil {
+			continue
+		}
+
+		args := player[1:]
+		return func(audio []byte) error {
+			f, err := os.CreateTemp("", "chatgpt-speech-*.wav")
+			if err != nil {
+				return err
+			}
+			defer os.Remove(f.Name())
+
+			if _, err := f.Write(audio); err != nil {
+				_ = f.Close()
+				return err
+			}
+			if err := f.Close(); err != nil {
+				return err
+			}
+
+			if out, err := exec.Command(path, append(args, f.Name())...).CombinedOutput(); err != nil {
+				return fmt.Errorf("%s failed: %w: %s", player[0], err, out)
+			}
+			return nil
+		}, nil
+	}
+
+	return nil, errors.New("no audio player found, install one of afplay, paplay, aplay, ffplay or mpv")
+}
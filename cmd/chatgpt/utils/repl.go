@@ -0,0 +1,181 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/chzyer/readline"
+)
+
+const (
+	SlashModel   = "/model"
+	SlashThread  = "/thread"
+	SlashNew     = "/new"
+	SlashHistory = "/history"
+	SlashRetry   = "/retry"
+	SlashEdit    = "/edit"
+	SlashFile    = "/file"
+	SlashImage   = "/image"
+	SlashSave    = "/save"
+	SlashCopy    = "/copy"
+	SlashTokens  = "/tokens"
+	SlashSystem  = "/system"
+	SlashHelp    = "/help"
+
+	DefaultEditor = "vi"
+)
+
+type SlashCommand struct {
+	Name        string
+	Args        string
+	Description string
+}
+
+// SlashCommands lists the commands understood by the interactive loop, in the order
+// they are shown by /help.
+var SlashCommands = []SlashCommand{
+	{SlashModel, "[name]", "Show or switch the model for this session"},
+	{SlashThread, "[name]", "Show or switch the current thread"},
+	{SlashNew, "", "Start a new thread with a random name"},
+	{SlashHistory, "", "Show the history of the current thread"},
+	{SlashRetry, "", "Drop the last answer and ask the last query again"},
+	{SlashEdit, "", "Open $EDITOR on the last query and send the result"},
+	{SlashFile, "<path|glob>", "Attach files or a directory as context"},
+	{SlashImage, "<path|url>", "Attach an image to the next query"},
+	{SlashSave, "<path>", "Save the current thread history to a file"},
+	{SlashCopy, "[n]", "Copy code block n (default 1) of the last answer to the clipboard"},
+	{SlashTokens, "", "Show token usage for this session and thread"},
+	{SlashSystem, "[role]", "Show or replace the system role"},
+	{SlashHelp, "", "Show this help"},
+}
+
+// ParseSlashCommand splits a known slash command from its argument. Lines that do
+// not start with a known command are returned with ok set to false so they can be
+// sent as a regular query.
+func ParseSlashCommand(line string) (name, arg string, ok bool) {
+	line = strings.TrimSpace(line)
+	if !strings.HasPrefix(line, "/") {
+		return "", "", false
+	}
+
+	name, arg, _ = strings.Cut(line, " ")
+	for _, c := range SlashCommands {
+		if c.Name == name {
+			return name, strings.TrimSpace(arg), true
+		}
+	}
+	return "", "", false
+}
+
+func SlashCommandHelp() string {
+	var sb strings.Builder
+	sb.WriteString("Commands:\n")
+	for _, c := range SlashCommands {
+		usage := strings.TrimSpace(c.Name + " " + c.Args)
+		sb.WriteString(fmt.Sprintf("  %-22s %s\n", usage, c.Description))
+	}
+	sb.WriteString(fmt.Sprintf("  %-22s %s\n", "clear", "Clear the screen"))
+	sb.WriteString(fmt.Sprintf("  %-22s %s\n", "multiline", "Toggle multiline input"))
+	sb.WriteString(fmt.Sprintf("  %-22s %s", "exit", "Quit (or Ctrl+C)"))
+	return sb.String()
+}
+
+// NewSlashCompleter builds the readline completer for slash commands. Thread names and
+// model IDs are looked up lazily through the provided callbacks; paths are completed
+// for the commands that take a file.
+func NewSlashCompleter(threads, models func() []string) *readline.PrefixCompleter {
+	items := make([]readline.PrefixCompleterInterface, 0, len(SlashCommands))
+
+	for _, c := range SlashCommands {
+		switch c.Name {
+		case SlashThread:
+			items = append(items, readline.PcItem(c.Name, readline.PcItemDynamic(func(string) []string {
+				return threads()
+			})))
+		case SlashModel:
+			items = append(items, readline.PcItem(c.Name, readline.PcItemDynamic(func(string) []string {
+				return models()
+			})))
+		case SlashFile, SlashImage, SlashSave:
+			items = append(items, readline.PcItem(c.Name, readline.PcItemDynamic(completePath)))
+		default:
+			items = append(items, readline.PcItem(c.Name))
+		}
+	}
+
+	return readline.NewPrefixCompleter(items...)
+}
+
+// ModelIDs strips the list markers added by client.ListModels.
+func ModelIDs(list []string) []string {
+	out := make([]string, 0, len(list))
+	for _, m := range list {
+		m = strings.TrimPrefix(m, "- ")
+		m = strings.TrimPrefix(m, "* ")
+		m = strings.TrimSuffix(m, " (current)")
+		out = append(out, m)
+	}
+	return out
+}
+
+// EditInEditor writes initial to a temporary file, opens it with $EDITOR (falling back
+// to vi) and returns the edited content with surrounding whitespace trimmed.
+func EditInEditor(initial string) (string, error) {
+	editor := os.Getenv("EDITOR")
+	if editor == "" {
+		editor = DefaultEditor
+	}
+
+	f, err := os.CreateTemp("", "chatgpt-edit-*.md")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.WriteString(initial); err != nil {
+		_ = f.Close()
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+
+	parts := strings.Fields(editor)
+	if len(parts) == 0 {
+		return "", errors.New("EDITOR is empty")
+	}
+
+	cmd := exec.Command(parts[0], append(parts[1:], f.Name())...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("editor %q failed: %w", editor, err)
+	}
+
+	out, err := os.ReadFile(f.Name())
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func completePath(line string) []string {
+	_, arg, _ := strings.Cut(strings.TrimSpace(line), " ")
+
+	matches, err := filepath.Glob(arg + "*")
+	if err != nil {
+		return nil
+	}
+
+	for i, m := range matches {
+		if info, err := os.Stat(m); err == nil && info.IsDir() {
+			matches[i] = m + string(filepath.Separator)
+		}
+	}
+	return matches
+}
@@ -0,0 +1,48 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"github.com/kardolus/chatgpt-cli/config"
+	"github.com/kardolus/chatgpt-cli/internal/secrets"
+	"time"
+)
+
+const APIKeyRequired = "API key is required. Provide it via --set-api-key, --set-api-key-file, --set-api-key-command, --login, env var, or config file"
+
+// NewSecretResolver returns a resolver for the configured secret backend, or for the one
+// that is available when none is configured. The kernel keyring, where there is one, caches
+// the output of credential helpers.
+func NewSecretResolver(cfg config.Config) (*secrets.Resolver, error) {
+	resolver := &secrets.Resolver{TTL: time.Duration(cfg.APIKeyCommandTTL) * time.Second}
+
+	backend, err := secrets.Open(cfg.SecretBackend)
+	if err != nil && cfg.SecretBackend != "" {
+		return nil, err
+	}
+	resolver.Backend = backend
+
+	if keyring, err := secrets.NewKeyctl(); err == nil {
+		resolver.Cache = keyring
+	}
+	return resolver, nil
+}
+
+// ResolveAPIKey returns the API key from api_key, which may reference a secret, from
+// api_key_file, from api_key_command or from the secret stored with --login, in that order.
+func ResolveAPIKey(ctx context.Context, cfg config.Config, resolver *secrets.Resolver) (string, error) {
+	switch {
+	case cfg.APIKey != "":
+		return resolver.Expand(ctx, cfg.APIKey)
+	case cfg.APIKeyFile != "":
+		return config.ReadAPIKeyFile(cfg.APIKeyFile)
+	case cfg.APIKeyCommand != "":
+		return resolver.Command(ctx, cfg.APIKeyCommand)
+	}
+
+	key, err := resolver.Lookup(cfg.Name)
+	if errors.Is(err, secrets.ErrNotFound) {
+		return "", errors.New(APIKeyRequired)
+	}
+	return key, err
+}
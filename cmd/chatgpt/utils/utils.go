@@ -5,8 +5,12 @@ import (
 	"errors"
 	"fmt"
 	"github.com/kardolus/chatgpt-cli/agent/core"
+	"github.com/kardolus/chatgpt-cli/agent/types"
+	"github.com/kardolus/chatgpt-cli/api"
 	"github.com/kardolus/chatgpt-cli/config"
+	"github.com/kardolus/chatgpt-cli/history"
 	"github.com/kardolus/chatgpt-cli/internal"
+	"github.com/kardolus/chatgpt-cli/internal/usage"
 	"os"
 	"path/filepath"
 	"strings"
@@ -27,6 +31,18 @@ const (
 	CommandPrefix          = "cmd_"
 )
 
+// CheckAgentCost refuses an agent run whose cost budget can't be kept because the model has
+// no price, since its calls would be charged nothing.
+func CheckAgentCost(cfg config.Config) error {
+	if cfg.Agent.MaxCostUSD <= 0 {
+		return nil
+	}
+	if _, ok := usage.NewPrices(cfg.Usage.Prices).Lookup(cfg.Model); !ok {
+		return fmt.Errorf("agent.max_cost_usd is set but model %q has no price, add one under usage.prices", cfg.Model)
+	}
+	return nil
+}
+
 func BudgetLimitsFromConfig(cfg config.Config) core.BudgetLimits {
 	return core.BudgetLimits{
 		MaxIterations: cfg.Agent.MaxIterations,
@@ -34,8 +50,96 @@ func BudgetLimitsFromConfig(cfg config.Config) core.BudgetLimits {
 		MaxShellCalls: cfg.Agent.MaxShellCalls,
 		MaxLLMCalls:   cfg.Agent.MaxLLMCalls,
 		MaxFileOps:    cfg.Agent.MaxFileOps,
+		MaxHTTPCalls:  cfg.Agent.MaxHTTPCalls,
 		MaxLLMTokens:  cfg.Agent.MaxLLMTokens,
+		MaxCostUSD:    cfg.Agent.MaxCostUSD,
+	}
+}
+
+// PriorAgentRuns returns the agent runs recorded in a thread, oldest first: every answer
+// that carries an agent run, with the user message before it as its goal.
+func PriorAgentRuns(entries []history.History) []types.PriorRun {
+	var runs []types.PriorRun
+	for i, e := range entries {
+		if e.Agent == nil || e.Role != "assistant" {
+			continue
+		}
+		run := types.PriorRun{
+			Answer:  api.ContentText(e.Content),
+			Effects: e.Agent.Effects,
+		}
+		if i > 0 && entries[i-1].Role == "user" {
+			run.Goal = api.ContentText(entries[i-1].Content)
+		}
+		runs = append(runs, run)
+	}
+	return runs
+}
+
+// ResolveAgentMode picks the agent mode from the flag or the config, normalizing its aliases.
+func ResolveAgentMode(flagMode, cfgMode string) (string, error) {
+	mode := strings.ToLower(strings.TrimSpace(flagMode))
+	if mode == "" {
+		mode = strings.ToLower(strings.TrimSpace(cfgMode))
+	}
+	if mode == "" {
+		mode = "react"
+	}
+
+	// allow some aliases, normalize to "react" or "plan"
+	switch mode {
+	case "react":
+		return "react", nil
+	case "plan":
+		return "plan", nil
+	case "plan_execute", "plan-execute":
+		return "plan", nil
+	default:
+		return "", fmt.Errorf("unknown agent mode %q (expected react|plan)", mode)
+	}
+}
+
+// ParseToolKinds turns the agent.allowed_tools entries into tool kinds.
+func ParseToolKinds(in []string) ([]types.ToolKind, error) {
+	out := make([]types.ToolKind, 0, len(in))
+	seen := map[types.ToolKind]bool{}
+
+	for _, raw := range in {
+		s := strings.ToLower(strings.TrimSpace(raw))
+		if s == "" {
+			continue
+		}
+
+		var k types.ToolKind
+		switch s {
+		case "shell":
+			k = types.ToolShell
+		case "llm":
+			k = types.ToolLLM
+		case "files", "file":
+			k = types.ToolFiles
+		case "http":
+			k = types.ToolHTTP
+		case "memory":
+			k = types.ToolMemory
+		case "delegate":
+			k = types.ToolDelegate
+		default:
+			return nil, fmt.Errorf("unknown agent.allowed_tools entry %q (expected shell|llm|files|http|memory|delegate)", raw)
+		}
+
+		if !seen[k] {
+			seen[k] = true
+			out = append(out, k)
+		}
+	}
+
+	// If config is empty, decide your behavior. I’d rather error than silently allow all.
+	if len(out) == 0 {
+		return nil, errors.New("agent.allowed_tools is empty (expected at least one of shell|llm|files|http|memory|delegate)")
 	}
+
+	return out, nil
 }
 
 func ColorToAnsi(color string) (string, string) {
@@ -183,6 +287,9 @@ func ValidateFlags(model string, flags map[string]bool) error {
 	if !flags["agent"] && flags["agent-mode"] {
 		return errors.New("the --agent-mode flag cannot be used without the --agent flag")
 	}
+	if !flags["agent"] && flags["agent-policy-explain"] {
+		return errors.New("the --agent-policy-explain flag cannot be used without the --agent flag")
+	}
 	if flags["audio"] && !strings.Contains(model, AudioPattern) {
 		return errors.New("the --audio flag cannot be used without a compatible model, ie gpt-4o-audio-preview (see --list-models)")
 	}
@@ -1,10 +1,22 @@
 package utils_test
 
 import (
+	"context"
 	"fmt"
 	"github.com/kardolus/chatgpt-cli/agent/core"
+	"github.com/kardolus/chatgpt-cli/agent/types"
+	"github.com/kardolus/chatgpt-cli/api"
+	"github.com/kardolus/chatgpt-cli/cache"
 	"github.com/kardolus/chatgpt-cli/cmd/chatgpt/utils"
 	"github.com/kardolus/chatgpt-cli/config"
+	"github.com/kardolus/chatgpt-cli/history"
+	"github.com/kardolus/chatgpt-cli/internal/secrets"
+	"github.com/kardolus/chatgpt-cli/internal/usage"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -241,6 +253,12 @@ func testUtils(t *testing.T, when spec.G, it spec.S) {
 			err := utils.ValidateFlags(defaultModel, flags)
 			Expect(err).To(HaveOccurred())
 		})
+		it("should return an error when --agent-policy-explain is used but --agent is omitted", func() {
+			flags["agent-policy-explain"] = true
+
+			err := utils.ValidateFlags(defaultModel, flags)
+			Expect(err).To(MatchError(ContainSubstring("--agent-policy-explain flag cannot be used without the --agent flag")))
+		})
 		it("should NOT return an error when --agent-mode and --agent are both used", func() {
 			flags["agent-mode"] = true
 			flags["agent"] = true
@@ -531,4 +549,674 @@ func testUtils(t *testing.T, when spec.G, it spec.S) {
 			}))
 		})
 	})
+
+	when("CheckAgentCost()", func() {
+		it("refuses a cost budget for a model without a price", func() {
+			cfg := config.Config{Model: "llama3:70b", Agent: config.AgentConfig{MaxCostUSD: 1}}
+			Expect(utils.CheckAgentCost(cfg)).To(MatchError(ContainSubstring(`model "llama3:70b" has no price`)))
+
+			cfg.Usage.Prices = map[string]usage.Price{"llama3:70b": {Input: 1, Output: 2}}
+			Expect(utils.CheckAgentCost(cfg)).To(Succeed())
+
+			cfg = config.Config{Model: "llama3:70b"}
+			Expect(utils.CheckAgentCost(cfg)).To(Succeed())
+
+			cfg = config.Config{Model: "gpt-4o", Agent: config.AgentConfig{MaxCostUSD: 1}}
+			Expect(utils.CheckAgentCost(cfg)).To(Succeed())
+		})
+	})
+
+	when("PriorAgentRuns()", func() {
+		it("returns the agent runs of a thread with their goals and effects", func() {
+			entries := []history.History{
+				{Message: api.Message{Role: "system", Content: "You are helpful"}},
+				{Message: api.Message{Role: "user", Content: "hi"}},
+				{Message: api.Message{Role: "assistant", Content: "hello"}},
+				{Message: api.Message{Role: "user", Content: "add a Sum function"}},
+				{
+					Message: api.Message{Role: "assistant", Content: "Added Sum"},
+					Agent:   &history.AgentRun{Mode: "react", Effects: []string{"file.write math.go"}},
+				},
+				{Message: api.Message{Role: "user", Content: "what does it do?"}},
+				{Message: api.Message{Role: "assistant", Content: "It adds"}, Agent: &history.AgentRun{Mode: "plan"}},
+			}
+
+			Expect(utils.PriorAgentRuns(entries)).To(Equal([]types.PriorRun{
+				{Goal: "add a Sum function", Answer: "Added Sum", Effects: []string{"file.write math.go"}},
+				{Goal: "what does it do?", Answer: "It adds"},
+			}))
+		})
+
+		it("returns nothing for a thread without agent runs", func() {
+			Expect(utils.PriorAgentRuns(nil)).To(BeEmpty())
+		})
+	})
+
+	when("ParseSlashCommand()", func() {
+		it("splits a known command from its argument", func() {
+			name, arg, ok := utils.ParseSlashCommand("  /model   gpt-4o-mini ")
+			Expect(ok).To(BeTrue())
+			Expect(name).To(Equal(utils.SlashModel))
+			Expect(arg).To(Equal("gpt-4o-mini"))
+		})
+
+		it("accepts commands without arguments", func() {
+			name, arg, ok := utils.ParseSlashCommand("/retry")
+			Expect(ok).To(BeTrue())
+			Expect(name).To(Equal(utils.SlashRetry))
+			Expect(arg).To(BeEmpty())
+		})
+
+		it("ignores unknown commands and regular input", func() {
+			_, _, ok := utils.ParseSlashCommand("/usr/bin is a directory")
+			Expect(ok).To(BeFalse())
+
+			_, _, ok = utils.ParseSlashCommand("what is /model?")
+			Expect(ok).To(BeFalse())
+		})
+	})
+
+	when("NewSlashCompleter()", func() {
+		complete := func(line string) []string {
+			completer := utils.NewSlashCompleter(
+				func() []string { return []string{"default", "work"} },
+				func() []string { return []string{"gpt-4o", "gpt-4o-mini"} },
+			)
+			candidates, _ := completer.Do([]rune(line), len(line))
+
+			var out []string
+			for _, c := range candidates {
+				out = append(out, string(c))
+			}
+			return out
+		}
+
+		it("completes command names", func() {
+			Expect(complete("/mo")).To(Equal([]string{"del "}))
+			Expect(complete("/h")).To(ConsistOf("istory ", "elp "))
+		})
+
+		it("completes thread names and model IDs", func() {
+			Expect(complete("/thread w")).To(Equal([]string{"ork "}))
+			Expect(complete("/model gpt-4o-")).To(Equal([]string{"mini "}))
+		})
+	})
+
+	when("ModelIDs()", func() {
+		it("strips the list markers", func() {
+			Expect(utils.ModelIDs([]string{"- gpt-4o", "* gpt-5 (current)"})).To(Equal([]string{"gpt-4o", "gpt-5"}))
+		})
+	})
+
+	when("EditInEditor()", func() {
+		it("returns the file content after the editor exits", func() {
+			t.Setenv("EDITOR", "true")
+
+			out, err := utils.EditInEditor("  last prompt\n")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(out).To(Equal("last prompt"))
+		})
+
+		it("returns an error when the editor fails", func() {
+			t.Setenv("EDITOR", "false")
+
+			_, err := utils.EditInEditor("x")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	when("ExtractCodeBlocks()", func() {
+		it("returns the fenced blocks with their language and path", func() {
+			text := "Intro\n\n```go\npackage main\n```\n\npath: `cmd/run.sh`\n```sh\necho hi\n```\n\n```python path:app.py\nprint(1)\n```\n~~~\nplain\n~~~\n"
+
+			blocks := utils.ExtractCodeBlocks(text)
+			Expect(blocks).To(Equal([]utils.CodeBlock{
+				{Lang: "go", Code: "package main\n"},
+				{Lang: "sh", Path: "cmd/run.sh", Code: "echo hi\n"},
+				{Lang: "python", Path: "app.py", Code: "print(1)\n"},
+				{Code: "plain\n"},
+			}))
+		})
+
+		it("supports the lang:path info string and unterminated fences", func() {
+			blocks := utils.ExtractCodeBlocks("```go:main.go\nfunc main() {}")
+			Expect(blocks).To(Equal([]utils.CodeBlock{{Lang: "go", Path: "main.go", Code: "func main() {}\n"}}))
+		})
+
+		it("filters by language", func() {
+			blocks := utils.ExtractCodeBlocks("```go\na\n```\n```sh\nb\n```\n")
+			Expect(utils.FilterCodeBlocks(blocks, "SH")).To(Equal([]utils.CodeBlock{{Lang: "sh", Code: "b\n"}}))
+			Expect(utils.FilterCodeBlocks(blocks, utils.AnyLanguage)).To(HaveLen(2))
+		})
+	})
+
+	when("FindPatches()", func() {
+		it("splits multi-file diffs and applies them", func() {
+			text := "Here you go:\n```diff\n" +
+				"diff --git a/a.txt b/a.txt\n--- a/a.txt\n+++ b/a.txt\n@@ -1,2 +1,2 @@\n one\n-two\n+TWO\n" +
+				"--- /dev/null\n+++ b/new.txt\n@@ -0,0 +1,1 @@\n+hello\n" +
+				"```\n"
+
+			patches, err := utils.FindPatches(text)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(patches).To(HaveLen(2))
+
+			Expect(patches[0].Path).To(Equal("a.txt"))
+			out, err := patches[0].Apply([]byte("one\ntwo\n"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(out)).To(Equal("one\nTWO\n"))
+
+			Expect(patches[1].Path).To(Equal("new.txt"))
+			Expect(patches[1].NewFile).To(BeTrue())
+			out, err = patches[1].Apply(nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(out)).To(Equal("hello\n"))
+		})
+
+		it("does not mistake removed '-- ' lines for headers", func() {
+			patches, err := utils.SplitUnifiedDiff("--- a/q.sql\n+++ b/q.sql\n@@ -1,2 +1,1 @@\n--- old comment\n select 1;\n", "")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(patches).To(HaveLen(1))
+
+			out, err := patches[0].Apply([]byte("-- old comment\nselect 1;\n"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(out)).To(Equal("select 1;\n"))
+		})
+
+		it("uses the path annotation for headerless diffs and full-content blocks", func() {
+			text := "path: main.go\n```diff\n@@ -1 +1 @@\n-a\n+b\n```\n\nfile: README.md\n```md\n# Title\n```\n"
+
+			patches, err := utils.FindPatches(text)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(patches).To(Equal([]utils.FilePatch{
+				{Path: "main.go", Diff: "@@ -1 +1 @@\n-a\n+b\n"},
+				{Path: "README.md", Content: "# Title\n"},
+			}))
+			Expect(patches[1].Preview()).To(Equal("+++ README.md (full content)\n+# Title\n"))
+		})
+
+		it("accepts a bare diff without fences", func() {
+			patches, err := utils.FindPatches("--- a/x\n+++ b/x\n@@ -1 +1 @@\n-a\n+b\n")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(patches).To(HaveLen(1))
+			Expect(patches[0].Path).To(Equal("x"))
+		})
+
+		it("errors on a headerless diff without a path", func() {
+			_, err := utils.FindPatches("```diff\n@@ -1 +1 @@\n-a\n+b\n```\n")
+			Expect(err).To(MatchError("unified diff has no file header and no path annotation"))
+		})
+	})
+
+	when("ResolvePatchPath()", func() {
+		it("resolves relative paths and rejects escapes", func() {
+			p, err := utils.ResolvePatchPath("/work", "a/b.go")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(p).To(Equal("/work/a/b.go"))
+
+			_, err = utils.ResolvePatchPath("/work", "../etc/passwd")
+			Expect(err).To(HaveOccurred())
+
+			_, err = utils.ResolvePatchPath("/work", "/etc/passwd")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	when("OSC52()", func() {
+		it("base64 encodes the text into the clipboard sequence", func() {
+			Expect(utils.OSC52("hi")).To(Equal("\033]52;c;aGk=\a"))
+		})
+	})
+
+	when("CollectFiles()", func() {
+		var root string
+
+		write := func(rel, content string) {
+			path := filepath.Join(root, filepath.FromSlash(rel))
+			Expect(os.MkdirAll(filepath.Dir(path), 0o755)).To(Succeed())
+			Expect(os.WriteFile(path, []byte(content), 0o644)).To(Succeed())
+		}
+
+		rel := func(paths []string) []string {
+			out := make([]string, 0, len(paths))
+			for _, p := range paths {
+				r, err := filepath.Rel(root, p)
+				Expect(err).NotTo(HaveOccurred())
+				out = append(out, filepath.ToSlash(r))
+			}
+			return out
+		}
+
+		it.Before(func() {
+			root = t.TempDir()
+			write(".gitignore", "*.log\nbuild/\n!keep.log\n")
+			write("main.go", "package main")
+			write("debug.log", "noise")
+			write("keep.log", "keep")
+			write("build/out.go", "package build")
+			write("pkg/a.go", "package pkg")
+			write("pkg/.gitignore", "/gen.go\n")
+			write("pkg/gen.go", "package pkg")
+			write("pkg/sub/b.go", "package sub")
+			write(".git/HEAD", "ref")
+		})
+
+		it("walks directories and honors nested .gitignore files", func() {
+			paths, err := utils.CollectFiles(nil, []string{root})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(rel(paths)).To(ConsistOf(".gitignore", "main.go", "keep.log", "pkg/.gitignore", "pkg/a.go", "pkg/sub/b.go"))
+		})
+
+		it("expands ** patterns", func() {
+			paths, err := utils.CollectFiles([]string{filepath.Join(root, "**", "*.go")}, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(rel(paths)).To(ConsistOf("main.go", "pkg/a.go", "pkg/sub/b.go"))
+		})
+
+		it("includes ignored files that are named explicitly", func() {
+			paths, err := utils.CollectFiles([]string{filepath.Join(root, "debug.log")}, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(rel(paths)).To(Equal([]string{"debug.log"}))
+		})
+
+		it("de-duplicates files matched more than once", func() {
+			paths, err := utils.CollectFiles([]string{filepath.Join(root, "main.go"), filepath.Join(root, "*.go")}, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(rel(paths)).To(Equal([]string{"main.go"}))
+		})
+
+		it("returns an error when a pattern matches nothing", func() {
+			_, err := utils.CollectFiles([]string{filepath.Join(root, "*.rs")}, nil)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	when("BuildFileContext()", func() {
+		it("delimits each file with its path and skips binaries", func() {
+			dir := t.TempDir()
+			text := filepath.Join(dir, "a.txt")
+			binary := filepath.Join(dir, "b.bin")
+			Expect(os.WriteFile(text, []byte("hello"), 0o644)).To(Succeed())
+			Expect(os.WriteFile(binary, []byte{0x00, 0x01, 0x02}, 0o644)).To(Succeed())
+
+			fc := utils.BuildFileContext([]string{text, binary}, 0)
+			Expect(fc.Blocks).To(Equal([]string{utils.FileBlock(text, "hello")}))
+			Expect(fc.Blocks[0]).To(HavePrefix(fmt.Sprintf("<file path=%q>\n", filepath.ToSlash(text))))
+			Expect(fc.Blocks[0]).To(HaveSuffix("hello\n</file>"))
+			Expect(fc.Skipped).To(HaveLen(1))
+			Expect(fc.Skipped[0]).To(ContainSubstring("binary"))
+		})
+
+		it("converts PDF documents to text", func() {
+			path := filepath.Join(t.TempDir(), "contract.pdf")
+			pdf := "%PDF-1.4\n" +
+				"1 0 obj << /Type /Catalog /Pages 2 0 R >> endobj\n" +
+				"2 0 obj << /Type /Pages /Kids [3 0 R] /Count 1 >> endobj\n" +
+				"3 0 obj << /Type /Page /Parent 2 0 R /Contents 4 0 R >> endobj\n" +
+				"4 0 obj << >> stream\nBT (Governing law: Delaware) Tj ET\nendstream endobj\n" +
+				"%%EOF\n\x00\xff"
+			Expect(os.WriteFile(path, []byte(pdf), 0o644)).To(Succeed())
+
+			fc := utils.BuildFileContext([]string{path}, 0)
+			Expect(fc.Skipped).To(BeEmpty())
+			Expect(fc.Blocks).To(Equal([]string{utils.FileBlock(path, "Governing law: Delaware")}))
+		})
+
+		it("converts HTML pages to text and keeps markup snippets as is", func() {
+			dir := t.TempDir()
+			page := filepath.Join(dir, "terms.html")
+			snippet := filepath.Join(dir, "nav.html")
+			Expect(os.WriteFile(page, []byte("<!DOCTYPE html><html><body><h1>Terms</h1><p>No refunds.</p></body></html>"), 0o644)).To(Succeed())
+			Expect(os.WriteFile(snippet, []byte(`<div class="nav"><a href="/">Home</a></div>`), 0o644)).To(Succeed())
+
+			fc := utils.BuildFileContext([]string{page, snippet}, 0)
+			Expect(fc.Skipped).To(BeEmpty())
+			Expect(fc.Blocks).To(Equal([]string{
+				utils.FileBlock(page, "Terms\n\nNo refunds."),
+				utils.FileBlock(snippet, `<div class="nav"><a href="/">Home</a></div>`),
+			}))
+		})
+
+		it("reads large documents whole and cuts large text files", func() {
+			dir := t.TempDir()
+			pdf := filepath.Join(dir, "contract.pdf")
+			text := filepath.Join(dir, "huge.log")
+			Expect(os.WriteFile(pdf, []byte("%PDF-1.4\n"+
+				"1 0 obj << /Type /Catalog /Pages 2 0 R >> endobj\n"+
+				"2 0 obj << /Type /Pages /Kids [3 0 R] /Count 1 >> endobj\n"+
+				"3 0 obj << /Type /Page /Parent 2 0 R /Contents 4 0 R >> endobj\n"+
+				"5 0 obj << /Length 0 >> stream\n"+strings.Repeat("x", utils.MaxContextFileSize)+"\nendstream endobj\n"+
+				"4 0 obj << >> stream\nBT (Governing law: Delaware) Tj ET\nendstream endobj\n"+
+				"%%EOF\n\x00\xff"), 0o644)).To(Succeed())
+			Expect(os.WriteFile(text, []byte(strings.Repeat("a line of text\n", utils.MaxContextFileSize/10)), 0o644)).To(Succeed())
+
+			fc := utils.BuildFileContext([]string{pdf, text}, 0)
+			Expect(fc.Skipped).To(BeEmpty())
+			Expect(fc.Blocks[0]).To(ContainSubstring("Governing law: Delaware"))
+			Expect(fc.Blocks[1]).To(HaveSuffix("[... rest of the file omitted, it is larger than 4 MB ...]\n</file>"))
+			Expect(fc.Truncated).To(Equal([]string{text}))
+		})
+
+		it("keeps small files whole and truncates the large ones to fit the budget", func() {
+			dir := t.TempDir()
+			small := filepath.Join(dir, "small.txt")
+			large := filepath.Join(dir, "large.txt")
+			Expect(os.WriteFile(small, []byte("tiny file"), 0o644)).To(Succeed())
+			Expect(os.WriteFile(large, []byte(strings.Repeat("a line of text\n", 500)), 0o644)).To(Succeed())
+
+			fc := utils.BuildFileContext([]string{small, large}, 200)
+			Expect(fc.Truncated).To(Equal([]string{large}))
+			Expect(fc.Blocks[0]).To(ContainSubstring("tiny file"))
+			Expect(fc.Blocks[1]).To(ContainSubstring("lines omitted to fit the context window"))
+
+			overhead := utils.EstimateTokens(utils.FileBlock(large, ""))
+			Expect(utils.EstimateTokens(fc.Blocks[1]) - overhead).To(BeNumerically("<=", 200))
+		})
+	})
+
+	when("TruncateToTokens()", func() {
+		it("keeps the head and the tail", func() {
+			lines := make([]string, 100)
+			for i := range lines {
+				lines[i] = fmt.Sprintf("line %d", i)
+			}
+			out := utils.TruncateToTokens(strings.Join(lines, "\n"), 40)
+			Expect(out).To(HavePrefix("line 0\n"))
+			Expect(out).To(HaveSuffix("line 99"))
+			Expect(out).To(ContainSubstring("lines omitted"))
+		})
+
+		it("returns short input unchanged", func() {
+			Expect(utils.TruncateToTokens("short", 10)).To(Equal("short"))
+		})
+	})
+
+	when("AudioPlayer()", func() {
+		it("plays the audio with the first player on the PATH", func() {
+			dir := t.TempDir()
+			played := filepath.Join(dir, "played.wav")
+			script := "#!/bin/sh\n/bin/cp \"$2\" \"" + played + "\"\n"
+			Expect(os.WriteFile(filepath.Join(dir, "aplay"), []byte(script), 0o755)).To(Succeed())
+			t.Setenv("PATH", dir)
+
+			play, err := utils.AudioPlayer()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(play([]byte("RIFF"))).To(Succeed())
+			Expect(os.ReadFile(played)).To(Equal([]byte("RIFF")))
+		})
+
+		it("fails when no player is installed", func() {
+			t.Setenv("PATH", t.TempDir())
+
+			_, err := utils.AudioPlayer()
+			Expect(err).To(MatchError(ContainSubstring("no audio player found")))
+		})
+	})
+
+	when("ResolveAPIKey()", func() {
+		var resolver *secrets.Resolver
+
+		it.Before(func() {
+			resolver = &secrets.Resolver{Backend: memoryBackend{"openai": "sk-stored", "work": "sk-work"}}
+		})
+
+		it("prefers api_key, then api_key_file, then api_key_command", func() {
+			keyFile := filepath.Join(t.TempDir(), "key")
+			Expect(os.WriteFile(keyFile, []byte("sk-file\n"), 0o600)).To(Succeed())
+
+			cfg := config.Config{Name: "openai", APIKey: "${keyring:work}", APIKeyFile: keyFile, APIKeyCommand: "echo sk-command"}
+			Expect(utils.ResolveAPIKey(context.Background(), cfg, resolver)).To(Equal("sk-work"))
+
+			cfg.APIKey = ""
+			Expect(utils.ResolveAPIKey(context.Background(), cfg, resolver)).To(Equal("sk-file"))
+
+			cfg.APIKeyFile = ""
+			Expect(utils.ResolveAPIKey(context.Background(), cfg, resolver)).To(Equal("sk-command"))
+		})
+
+		it("falls back to the key stored with --login", func() {
+			Expect(utils.ResolveAPIKey(context.Background(), config.Config{Name: "openai"}, resolver)).To(Equal("sk-stored"))
+
+			_, err := utils.ResolveAPIKey(context.Background(), config.Config{Name: "perplexity"}, resolver)
+			Expect(err).To(MatchError(utils.APIKeyRequired))
+		})
+	})
+
+	when("Doctor.Run()", func() {
+		var (
+			home   string
+			server *httptest.Server
+		)
+
+		it.Before(func() {
+			home = t.TempDir()
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusUnauthorized)
+			}))
+		})
+
+		it.After(func() {
+			server.Close()
+		})
+
+		findings := func(report utils.DoctorReport, severity utils.Severity) []string {
+			var result []string
+			for _, f := range report {
+				if f.Severity == severity {
+					result = append(result, f.Check+": "+f.Message)
+				}
+			}
+			return result
+		}
+
+		validConfig := func() config.Config {
+			return config.Config{
+				Name:   "openai",
+				APIKey: "key",
+				URL:    server.URL,
+				Agent: config.AgentConfig{
+					Mode:           "react",
+					WorkDir:        home,
+					AllowedTools:   []string{"shell", "files"},
+					AllowedFileOps: []string{"read", "write"},
+				},
+			}
+		}
+
+		newDoctor := func(cfg config.Config) utils.Doctor {
+			return utils.Doctor{
+				Config:     cfg,
+				ConfigPath: filepath.Join(home, "config.yaml"),
+				DataHome:   filepath.Join(home, "history"),
+				CacheHome:  filepath.Join(home, "cache"),
+				LookupEnv:  func(string) (string, bool) { return "", false },
+			}
+		}
+
+		it("reports no problems for a valid setup", func() {
+			Expect(os.WriteFile(filepath.Join(home, "config.yaml"), []byte("model: gpt-4o\n"), 0o644)).To(Succeed())
+			Expect(os.MkdirAll(filepath.Join(home, "history"), 0o755)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(home, "history", "default.json"), []byte("[]"), 0o644)).To(Succeed())
+
+			report := newDoctor(validConfig()).Run(context.Background())
+
+			Expect(findings(report, utils.SeverityError)).To(BeEmpty())
+			Expect(findings(report, utils.SeverityWarning)).To(BeEmpty())
+			Expect(findings(report, utils.SeverityOK)).To(ContainElements(
+				"config: "+filepath.Join(home, "config.yaml")+" is valid",
+				"url: "+server.URL+" is reachable (401 Unauthorized)",
+				"history: "+filepath.Join(home, "history")+", 1 file, 2 B",
+				"cache: "+filepath.Join(home, "cache")+" does not exist yet",
+				"mcp sessions: no cached MCP sessions",
+			))
+			Expect(report.String()).To(HaveSuffix("No problems found."))
+		})
+
+		it("warns about the agent settings of a project config", func() {
+			project := filepath.Join(home, ".chatgpt-cli.yaml")
+			Expect(os.WriteFile(project, []byte("model: gpt-4o\nagent:\n  allowed_tools: [shell]\n  policy_file: p.yaml\n"), 0o644)).To(Succeed())
+
+			doctor := newDoctor(validConfig())
+			doctor.ProjectConfigPath = project
+			Expect(findings(doctor.Run(context.Background()), utils.SeverityWarning)).To(ContainElement(
+				"project: ignoring agent.allowed_tools, agent.policy_file: the project is not trusted (use --trust-project or add it to trusted_projects)"))
+
+			doctor.ProjectTrusted = true
+			Expect(findings(doctor.Run(context.Background()), utils.SeverityWarning)).To(ContainElement(
+				"project: the trusted project sets agent.allowed_tools, agent.policy_file"))
+
+			Expect(os.WriteFile(project, []byte("model: gpt-4o\n"), 0o644)).To(Succeed())
+			Expect(findings(doctor.Run(context.Background()), utils.SeverityWarning)).NotTo(ContainElement(HavePrefix("project:")))
+		})
+
+		it("flags bad settings", func() {
+			Expect(os.WriteFile(filepath.Join(home, "config.yaml"), []byte("modle: gpt-4o\nmax_tokens: lots\n"), 0o644)).To(Succeed())
+
+			cfg := validConfig()
+			cfg.CommandPromptColor = "purple"
+			cfg.APIKey = ""
+			cfg.APIKeyFile = filepath.Join(home, "missing")
+			cfg.Agent.Mode = "swarm"
+			cfg.Agent.AllowedTools = []string{"browser"}
+			cfg.Agent.AllowedFileOps = []string{"chmod"}
+			cfg.Agent.AllowedHTTPMethods = []string{"get", "FETCH"}
+			cfg.Agent.AllowedDomains = []string{"go.dev", "https://example.com/docs"}
+			cfg.Agent.MaxSteps = -1
+			cfg.Agent.WorkDir = ""
+			cfg.Agent.RestrictFilesToWorkDir = true
+			cfg.Agent.PlanJSONPath = "plan.json"
+			cfg.Agent.PolicyFile = filepath.Join(home, "policy.yaml")
+			Expect(os.WriteFile(cfg.Agent.PolicyFile, []byte("rules: [{action: maybe}]\n"), 0o644)).To(Succeed())
+
+			doctor := newDoctor(cfg)
+			doctor.LookupEnv = func(name string) (string, bool) {
+				if name == "OPENAI_TEMPERATURE" {
+					return "warm", true
+				}
+				return "", false
+			}
+
+			report := doctor.Run(context.Background())
+
+			Expect(findings(report, utils.SeverityError)).To(Equal([]string{
+				"config: max_tokens: expected an integer, got \"lots\"",
+				"config: modle: unknown key, did you mean model?",
+				"env: OPENAI_TEMPERATURE=\"warm\" is not a number",
+				"colors: command_prompt_color: invalid color \"purple\" (expected red, green, yellow, blue or magenta)",
+				"api key: api_key_file " + cfg.APIKeyFile + ": failed to open api key file: open " + cfg.APIKeyFile + ": no such file or directory",
+				"agent: agent.allowed_domains entry \"https://example.com/docs\" should be a host name, like example.com",
+				"agent: agent.max_steps is negative (0 means unlimited)",
+				"agent: agent.mode: unknown agent mode \"swarm\" (expected react|plan)",
+				"agent: policy file " + cfg.Agent.PolicyFile + ": rule 1: invalid action \"maybe\" (expected allow|deny|ask)",
+				"agent: unknown agent.allowed_file_ops entry \"chmod\" (expected read|write|patch|replace|list|search|stat|mkdir|move|delete)",
+				"agent: unknown agent.allowed_http_methods entry \"FETCH\" (expected GET|HEAD|POST|PUT|PATCH|DELETE|OPTIONS)",
+				"agent: unknown agent.allowed_tools entry \"browser\" (expected shell|llm|files|http|memory|delegate)",
+			}))
+			Expect(findings(report, utils.SeverityWarning)).To(Equal([]string{
+				"agent: agent.plan_json_path is set but agent.write_plan_json is off",
+				"agent: agent.restrict_files_to_work_dir has no effect while agent.work_dir is empty",
+			}))
+			Expect(report.Count(utils.SeverityError)).To(Equal(12))
+			Expect(report.String()).To(HaveSuffix("12 errors, 2 warnings."))
+		})
+
+		it("warns when the delegate tool is allowed but delegation is off", func() {
+			cfg := validConfig()
+			cfg.Agent.AllowedTools = []string{"shell", "delegate"}
+
+			Expect(findings(newDoctor(cfg).Run(context.Background()), utils.SeverityWarning)).To(ContainElement(
+				"agent: agent.allowed_tools lists delegate but agent.max_delegation_depth is 0, so the agent can't delegate"))
+
+			cfg.Agent.MaxDelegationDepth = 1
+			Expect(findings(newDoctor(cfg).Run(context.Background()), utils.SeverityWarning)).NotTo(ContainElement(ContainSubstring("delegate")))
+		})
+
+		it("flags usage settings that can't be priced", func() {
+			cfg := validConfig()
+			cfg.Model = "llama3:70b"
+			cfg.MaxCostUSD = 1
+			cfg.Agent.MaxCostUSD = 2
+			cfg.Usage.Prices = map[string]usage.Price{
+				"mistral": {Input: -1},
+				"my-gpt":  {Input: 1, Output: 2},
+			}
+
+			report := newDoctor(cfg).Run(context.Background())
+
+			Expect(findings(report, utils.SeverityError)).To(Equal([]string{
+				"usage: usage.prices.mistral has a negative price",
+				"usage: max_cost_usd is set but model llama3:70b has no price, so every request is refused; add it under usage.prices",
+				"usage: agent.max_cost_usd is set but model llama3:70b has no price, so agent runs are refused; add it under usage.prices",
+			}))
+			Expect(findings(report, utils.SeverityWarning)).To(BeEmpty())
+
+			cfg.Model = "my-gpt"
+			cfg.MaxCostUSD = -1
+			report = newDoctor(cfg).Run(context.Background())
+			Expect(findings(report, utils.SeverityError)).To(ContainElement("usage: max_cost_usd is negative (0 means unlimited)"))
+			Expect(findings(report, utils.SeverityWarning)).To(BeEmpty())
+		})
+
+		it("finds the API key stored with --login", func() {
+			cfg := validConfig()
+			cfg.APIKey = ""
+
+			doctor := newDoctor(cfg)
+			doctor.Secrets = &secrets.Resolver{Backend: memoryBackend{"openai": "sk-stored"}}
+
+			report := doctor.Run(context.Background())
+			Expect(findings(report, utils.SeverityOK)).To(ContainElement("api key: API key is stored in memory"))
+
+			doctor.Secrets = &secrets.Resolver{Backend: memoryBackend{}}
+			report = doctor.Run(context.Background())
+			Expect(findings(report, utils.SeverityError)).To(ContainElement(HavePrefix("api key: no API key")))
+		})
+
+		it("reports an unreachable url", func() {
+			cfg := validConfig()
+			server.Close()
+
+			report := newDoctor(cfg).Run(context.Background())
+			Expect(findings(report, utils.SeverityError)).To(ConsistOf(HavePrefix("url: " + cfg.URL + " is unreachable")))
+		})
+
+		it("counts the cached MCP sessions and flags unreadable entries", func() {
+			dir := utils.MCPSessionsDir(filepath.Join(home, "cache"))
+			Expect(os.MkdirAll(dir, 0o700)).To(Succeed())
+
+			store := cache.New(cache.NewFileStore(dir))
+			Expect(store.SetSessionID("http://localhost/mcp", "abc")).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(dir, "broken.json"), []byte("{"), 0o600)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(dir, ".key.123.tmp"), nil, 0o600)).To(Succeed())
+
+			report := newDoctor(validConfig()).Run(context.Background())
+
+			Expect(findings(report, utils.SeverityOK)).To(ContainElement(HavePrefix("mcp sessions: 1 cached session in " + dir + ", last used ")))
+			Expect(findings(report, utils.SeverityWarning)).To(Equal([]string{
+				"mcp sessions: 1 entry can't be read and should be removed",
+				"mcp sessions: 1 temporary file left behind by interrupted writes",
+			}))
+		})
+	})
+}
+
+type memoryBackend map[string]string
+
+func (m memoryBackend) Name() string { return "memory" }
+
+func (m memoryBackend) Get(account string) (string, error) {
+	if secret, ok := m[account]; ok {
+		return secret, nil
+	}
+	return "", secrets.ErrNotFound
+}
+
+func (m memoryBackend) Set(account, secret string) error {
+	m[account] = secret
+	return nil
+}
+
+func (m memoryBackend) Delete(account string) error {
+	delete(m, account)
+	return nil
 }
@@ -1,47 +1,108 @@
 package config
 
+import "github.com/kardolus/chatgpt-cli/internal/usage"
+
 type Config struct {
-	Name                 string            `yaml:"name"`
-	APIKey               string            `yaml:"api_key"`
-	APIKeyFile           string            `yaml:"api_key_file"`
-	Model                string            `yaml:"model"`
-	MaxTokens            int               `yaml:"max_tokens"`
-	ContextWindow        int               `yaml:"context_window"`
-	Role                 string            `yaml:"role"`
-	Temperature          float64           `yaml:"temperature"`
-	TopP                 float64           `yaml:"top_p"`
-	FrequencyPenalty     float64           `yaml:"frequency_penalty"`
-	PresencePenalty      float64           `yaml:"presence_penalty"`
-	Thread               string            `yaml:"thread"`
-	OmitHistory          bool              `yaml:"omit_history"`
-	URL                  string            `yaml:"url"`
-	CompletionsPath      string            `yaml:"completions_path"`
-	ModelsPath           string            `yaml:"models_path"`
-	ResponsesPath        string            `yaml:"responses_path"`
-	SpeechPath           string            `yaml:"speech_path"`
-	ImageGenerationsPath string            `yaml:"image_generations_path"`
-	ImageEditsPath       string            `yaml:"image_edits_path"`
-	TranscriptionsPath   string            `yaml:"transcriptions_path"`
-	AuthHeader           string            `yaml:"auth_header"`
-	AuthTokenPrefix      string            `yaml:"auth_token_prefix"`
-	CommandPrompt        string            `yaml:"command_prompt"`
-	CommandPromptColor   string            `yaml:"command_prompt_color"`
-	OutputPrompt         string            `yaml:"output_prompt"`
-	OutputPromptColor    string            `yaml:"output_prompt_color"`
-	AutoCreateNewThread  bool              `yaml:"auto_create_new_thread"`
-	AutoShellTitle       bool              `yaml:"auto_shell_title"`
-	TrackTokenUsage      bool              `yaml:"track_token_usage"`
-	SkipTLSVerify        bool              `yaml:"skip_tls_verify"`
-	HTTPTimeout          int               `yaml:"http_timeout"`
-	Multiline            bool              `yaml:"multiline"`
-	Web                  bool              `yaml:"web"`
-	WebContextSize       string            `yaml:"web_context_size"`
-	Seed                 int               `yaml:"seed"`
-	Effort               string            `yaml:"effort"`
-	Voice                string            `yaml:"voice"`
-	UserAgent            string            `yaml:"user_agent"`
-	CustomHeaders        map[string]string `yaml:"custom_headers"`
-	Agent                AgentConfig       `yaml:"agent"`
+	Name                 string              `yaml:"name"`
+	APIKey               string              `yaml:"api_key"`
+	APIKeyFile           string              `yaml:"api_key_file"`
+	APIKeyCommand        string              `yaml:"api_key_command"`
+	APIKeyCommandTTL     int                 `yaml:"api_key_command_ttl"`
+	SecretBackend        string              `yaml:"secret_backend"`
+	Model                string              `yaml:"model"`
+	MaxTokens            int                 `yaml:"max_tokens"`
+	ContextWindow        int                 `yaml:"context_window"`
+	Role                 string              `yaml:"role"`
+	Temperature          float64             `yaml:"temperature"`
+	TopP                 float64             `yaml:"top_p"`
+	FrequencyPenalty     float64             `yaml:"frequency_penalty"`
+	PresencePenalty      float64             `yaml:"presence_penalty"`
+	Thread               string              `yaml:"thread"`
+	OmitHistory          bool                `yaml:"omit_history"`
+	URL                  string              `yaml:"url"`
+	CompletionsPath      string              `yaml:"completions_path"`
+	ModelsPath           string              `yaml:"models_path"`
+	ResponsesPath        string              `yaml:"responses_path"`
+	SpeechPath           string              `yaml:"speech_path"`
+	ImageGenerationsPath string              `yaml:"image_generations_path"`
+	ImageEditsPath       string              `yaml:"image_edits_path"`
+	TranscriptionsPath   string              `yaml:"transcriptions_path"`
+	RealtimePath         string              `yaml:"realtime_path"`
+	AuthHeader           string              `yaml:"auth_header"`
+	AuthTokenPrefix      string              `yaml:"auth_token_prefix"`
+	CommandPrompt        string              `yaml:"command_prompt"`
+	CommandPromptColor   string              `yaml:"command_prompt_color"`
+	OutputPrompt         string              `yaml:"output_prompt"`
+	OutputPromptColor    string              `yaml:"output_prompt_color"`
+	AutoCreateNewThread  bool                `yaml:"auto_create_new_thread"`
+	AutoShellTitle       bool                `yaml:"auto_shell_title"`
+	TrackTokenUsage      bool                `yaml:"track_token_usage"`
+	StreamUsage          string              `yaml:"stream_usage"`
+	SkipTLSVerify        bool                `yaml:"skip_tls_verify"`
+	HTTPTimeout          int                 `yaml:"http_timeout"`
+	Multiline            bool                `yaml:"multiline"`
+	RenderMarkdown       bool                `yaml:"render_markdown"`
+	Web                  bool                `yaml:"web"`
+	WebContextSize       string              `yaml:"web_context_size"`
+	Seed                 int                 `yaml:"seed"`
+	Effort               string              `yaml:"effort"`
+	Voice                string              `yaml:"voice"`
+	SpeechModel          string              `yaml:"speech_model"`
+	SpeechSpeed          float64             `yaml:"speech_speed"`
+	SpeechInstructions   string              `yaml:"speech_instructions"`
+	UserAgent            string              `yaml:"user_agent"`
+	CustomHeaders        map[string]string   `yaml:"custom_headers"`
+	TrustedProjects      []string            `yaml:"trusted_projects"`
+	MaxCostUSD           float64             `yaml:"max_cost_usd"`
+	Usage                UsageConfig         `yaml:"usage"`
+	Agent                AgentConfig         `yaml:"agent"`
+	Proxy                ProxyConfig         `yaml:"proxy"`
+	Transcription        TranscriptionConfig `yaml:"transcription"`
+	Image                ImageConfig         `yaml:"image"`
+}
+
+type ImageConfig struct {
+	// Options for --draw; empty values are left to the API defaults.
+	Size         string `yaml:"size"`
+	Quality      string `yaml:"quality"`
+	N            int    `yaml:"n"`
+	Background   string `yaml:"background"`
+	OutputFormat string `yaml:"output_format"`
+}
+
+type TranscriptionConfig struct {
+	// Format is the response_format: json, text, verbose_json, srt or vtt
+	Format   string `yaml:"format"`
+	Language string `yaml:"language"`
+	Prompt   string `yaml:"prompt"`
+
+	// Long WAV recordings are split at silences into chunks of at most ChunkSeconds,
+	// of which Concurrency are uploaded at a time.
+	ChunkSeconds int `yaml:"chunk_seconds"`
+	Concurrency  int `yaml:"concurrency"`
+}
+
+type UsageConfig struct {
+	// Ledger records the tokens and cost of every request under the data home.
+	Ledger bool `yaml:"ledger"`
+
+	// Team is recorded with every request, so usage can be reported per team.
+	Team string `yaml:"team"`
+
+	// Prices override or add to the built-in price table, in USD per million tokens.
+	Prices map[string]usage.Price `yaml:"prices"`
+}
+
+type ProxyConfig struct {
+	// ModelAliases maps a model name sent by a client to the upstream model name.
+	ModelAliases map[string]string `yaml:"model_aliases"`
+
+	// Response cache for non-streaming requests (TTL in seconds)
+	Cache    bool `yaml:"cache"`
+	CacheTTL int  `yaml:"cache_ttl"`
+
+	// Token is the bearer token clients must send. It is required to serve beyond localhost.
+	Token string `yaml:"token"`
 }
 
 type AgentConfig struct {
@@ -56,13 +117,37 @@ type AgentConfig struct {
 	MaxShellCalls int `yaml:"max_shell_calls"`
 	MaxLLMCalls   int `yaml:"max_llm_calls"`
 	MaxFileOps    int `yaml:"max_file_ops"`
+	MaxHTTPCalls  int `yaml:"max_http_calls"`
 	MaxLLMTokens  int `yaml:"max_llm_tokens"`
 
+	// MaxCostUSD caps what the LLM calls of a run may cost (0 = unlimited)
+	MaxCostUSD float64 `yaml:"max_cost_usd"`
+
 	// Safety/policy
 	AllowedTools           []string `yaml:"allowed_tools"`
 	DeniedShellCommands    []string `yaml:"denied_shell_commands"`
 	AllowedFileOps         []string `yaml:"allowed_file_ops"`
 	RestrictFilesToWorkDir bool     `yaml:"restrict_files_to_work_dir"`
+	PolicyFile             string   `yaml:"policy_file"`
+
+	// HTTP tool
+	AllowedDomains       []string `yaml:"allowed_domains"`
+	AllowedHTTPMethods   []string `yaml:"allowed_http_methods"`
+	MaxHTTPResponseBytes int      `yaml:"max_http_response_bytes"`
+
+	// Plan mode: how many independent steps may run at once, and how many times a failed
+	// plan may be revised (0 = never)
+	MaxParallelSteps int `yaml:"max_parallel_steps"`
+	MaxReplans       int `yaml:"max_replans"`
+
+	// Project memory: facts the agent keeps across runs, in memory_file (default: a file
+	// per work dir under the cache home), capped at memory_max_bytes
+	MemoryEnabled  bool   `yaml:"memory_enabled"`
+	MemoryFile     string `yaml:"memory_file"`
+	MemoryMaxBytes int    `yaml:"memory_max_bytes"`
+
+	// Sub-agents: how deep delegate steps may nest (0 = no delegation)
+	MaxDelegationDepth int `yaml:"max_delegation_depth"`
 
 	// Logging / artifacts
 	WritePlanJSON bool   `yaml:"write_plan_json"`
@@ -118,18 +118,22 @@ func replaceByEnvironment(configuration Config) Config {
 		if value := os.Getenv(prefix + strings.ToUpper(tag)); value != "" {
 			field := v.Field(i)
 
+			// Values that don't parse keep the configured setting, --doctor reports them.
 			switch field.Kind() {
 			case reflect.String:
 				field.SetString(value)
 			case reflect.Int:
-				intValue, _ := strconv.Atoi(value)
-				field.SetInt(int64(intValue))
+				if intValue, err := strconv.Atoi(value); err == nil {
+					field.SetInt(int64(intValue))
+				}
 			case reflect.Bool:
-				boolValue, _ := strconv.ParseBool(value)
-				field.SetBool(boolValue)
+				if boolValue, err := strconv.ParseBool(value); err == nil {
+					field.SetBool(boolValue)
+				}
 			case reflect.Float64:
-				floatValue, _ := strconv.ParseFloat(value, 64)
-				field.SetFloat(floatValue)
+				if floatValue, err := strconv.ParseFloat(value, 64); err == nil {
+					field.SetFloat(floatValue)
+				}
 			}
 		}
 	}
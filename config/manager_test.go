@@ -223,6 +223,21 @@ func testConfig(t *testing.T, when spec.G, it spec.S) {
 		Expect(subject.Config.OutputPrompt).To(Equal("env-output-prompt"))
 	})
 
+	it("should keep the configured value when an environment variable doesn't parse", func() {
+		Expect(os.Setenv(envPrefix+"MAX_TOKENS", "lots")).To(Succeed())
+		Expect(os.Setenv(envPrefix+"TEMPERATURE", "warm")).To(Succeed())
+		Expect(os.Setenv(envPrefix+"OMIT_HISTORY", "sure")).To(Succeed())
+
+		mockConfigStore.EXPECT().ReadDefaults().Return(defaultConfig).Times(1)
+		mockConfigStore.EXPECT().Read().Return(config.Config{OmitHistory: true}, nil).Times(1)
+
+		subject := config.NewManager(mockConfigStore).WithEnvironment()
+
+		Expect(subject.Config.MaxTokens).To(Equal(defaultMaxTokens))
+		Expect(subject.Config.Temperature).To(Equal(defaultTemperature))
+		Expect(subject.Config.OmitHistory).To(BeTrue())
+	})
+
 	it("should prioritize environment variables over user-provided config", func() {
 		Expect(os.Setenv(envPrefix+"API_KEY", "env-api-key")).To(Succeed())
 		Expect(os.Setenv(envPrefix+"MODEL", "env-model")).To(Succeed())
@@ -0,0 +1,208 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const ProjectConfigName = ".chatgpt-cli.yaml"
+
+// ProjectKeys are the top-level settings a project configuration may change. Everything
+// else, such as the URL or the API key, stays under the control of the user so that a
+// cloned repository can't redirect requests or credentials.
+var ProjectKeys = []string{"model", "role", "thread", "custom_headers", "agent"}
+
+// TrustedProjectKeys are the project keys that are only applied when the user trusts the
+// project, since they decide what the agent may run on the user's machine.
+var TrustedProjectKeys = []string{"agent"}
+
+// ProjectConfig is a .chatgpt-cli.yaml found in the working directory or one of its parents.
+type ProjectConfig struct {
+	Path     string
+	Settings map[string]interface{}
+
+	// Trusted is set when the user trusts the project with the keys in TrustedProjectKeys.
+	Trusted bool
+
+	// Ignored lists the keys of the file that are not in ProjectKeys, Untrusted the keys in
+	// TrustedProjectKeys that were left out because the project isn't trusted.
+	Ignored   []string
+	Untrusted []string
+}
+
+// FindProjectConfig walks up from dir to the root of the filesystem and returns the path
+// of the first project configuration, or an empty string when there is none.
+func FindProjectConfig(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+
+	for {
+		path := filepath.Join(dir, ProjectConfigName)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path, nil
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", nil
+		}
+		dir = parent
+	}
+}
+
+// LoadProjectConfig finds and reads the project configuration for dir. It returns nil
+// when there is none. trusted tells whether the user trusts the project in the given
+// directory; without trust the keys in TrustedProjectKeys are left out.
+func LoadProjectConfig(dir string, trusted func(projectDir string) bool) (*ProjectConfig, error) {
+	path, err := FindProjectConfig(dir)
+	if err != nil || path == "" {
+		return nil, err
+	}
+
+	settings, err := ReadSettings(path)
+	if err != nil {
+		return nil, err
+	}
+
+	project := &ProjectConfig{Path: path, Settings: map[string]interface{}{}}
+	project.Trusted = trusted != nil && trusted(filepath.Dir(path))
+
+	for key, value := range settings {
+		switch {
+		case !containsKey(ProjectKeys, key):
+			project.Ignored = append(project.Ignored, key)
+		case containsKey(TrustedProjectKeys, key) && !project.Trusted:
+			project.Untrusted = append(project.Untrusted, key)
+		default:
+			project.Settings[key] = value
+		}
+	}
+	sort.Strings(project.Ignored)
+	sort.Strings(project.Untrusted)
+
+	return project, nil
+}
+
+// IsTrustedDir reports whether dir is one of the trusted directories or inside one of them.
+func IsTrustedDir(dir string, trusted []string) bool {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return false
+	}
+	for _, t := range trusted {
+		t = strings.TrimSpace(t)
+		if t == "" {
+			continue
+		}
+		if strings.HasPrefix(t, "~/") {
+			if home, err := os.UserHomeDir(); err == nil {
+				t = filepath.Join(home, t[2:])
+			}
+		}
+		t, err := filepath.Abs(t)
+		if err != nil {
+			continue
+		}
+		if rel, err := filepath.Rel(t, dir); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// ReadSettings reads a YAML configuration file into a map with lower-case keys, the way
+// viper stores them.
+func ReadSettings(path string) (map[string]interface{}, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var settings map[string]interface{}
+	if err := yaml.Unmarshal(data, &settings); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return lowerKeys(settings), nil
+}
+
+// HasKey reports whether the dotted key, or one of its parents, is set in settings.
+func HasKey(settings map[string]interface{}, key string) bool {
+	current := settings
+	for _, part := range strings.Split(strings.ToLower(key), ".") {
+		value, ok := current[part]
+		if !ok {
+			return false
+		}
+		next, ok := value.(map[string]interface{})
+		if !ok {
+			return true
+		}
+		current = next
+	}
+	return true
+}
+
+// AnnotateSources renders settings as YAML with the source of every value, as returned by
+// source for its dotted key, in a line comment.
+func AnnotateSources(settings map[string]interface{}, source func(key string) string) ([]byte, error) {
+	var root yaml.Node
+	if err := root.Encode(settings); err != nil {
+		return nil, err
+	}
+	if root.Kind != yaml.MappingNode {
+		return nil, errors.New("settings are not a mapping")
+	}
+
+	annotate(&root, "", source)
+	return yaml.Marshal(&root)
+}
+
+func annotate(node *yaml.Node, prefix string, source func(key string) string) {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+
+		path := key.Value
+		if prefix != "" {
+			path = prefix + "." + key.Value
+		}
+
+		if value.Kind == yaml.MappingNode && len(value.Content) > 0 {
+			annotate(value, path, source)
+			continue
+		}
+		comment := source(path)
+		if value.Kind == yaml.ScalarNode {
+			value.LineComment = comment
+		} else {
+			// Comments on block sequences end up after the next key, keep them on this one.
+			key.LineComment = comment
+		}
+	}
+}
+
+func containsKey(keys []string, key string) bool {
+	for _, k := range keys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+func lowerKeys(settings map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(settings))
+	for key, value := range settings {
+		if nested, ok := value.(map[string]interface{}); ok {
+			value = lowerKeys(nested)
+		}
+		result[strings.ToLower(key)] = value
+	}
+	return result
+}
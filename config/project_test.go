@@ -0,0 +1,117 @@
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kardolus/chatgpt-cli/config"
+	. "github.com/onsi/gomega"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+)
+
+func TestUnitProjectConfig(t *testing.T) {
+	spec.Run(t, "Project configuration", testProjectConfig, spec.Report(report.Terminal{}))
+}
+
+func testProjectConfig(t *testing.T, when spec.G, it spec.S) {
+	var root string
+
+	it.Before(func() {
+		RegisterTestingT(t)
+		root = t.TempDir()
+	})
+
+	when("LoadProjectConfig()", func() {
+		it("finds the closest file walking up and keeps only the project keys", func() {
+			nested := filepath.Join(root, "repo", "pkg", "sub")
+			Expect(os.MkdirAll(nested, 0o755)).To(Succeed())
+
+			content := "model: gpt-4o-mini\nURL: http://example.com\nagent:\n  Allowed_Tools: [files]\ncustom_headers:\n  X-Team: core\n"
+			Expect(os.WriteFile(filepath.Join(root, "repo", config.ProjectConfigName), []byte(content), 0o644)).To(Succeed())
+
+			project, err := config.LoadProjectConfig(nested, func(string) bool { return true })
+			Expect(err).NotTo(HaveOccurred())
+			Expect(project.Path).To(Equal(filepath.Join(root, "repo", config.ProjectConfigName)))
+			Expect(project.Settings).To(HaveKeyWithValue("model", "gpt-4o-mini"))
+			Expect(project.Settings).To(HaveKey("agent"))
+			Expect(project.Settings).NotTo(HaveKey("url"))
+			Expect(project.Ignored).To(Equal([]string{"url"}))
+			Expect(project.Untrusted).To(BeEmpty())
+
+			Expect(config.HasKey(project.Settings, "agent.allowed_tools")).To(BeTrue())
+			Expect(config.HasKey(project.Settings, "custom_headers.x-team")).To(BeTrue())
+			Expect(config.HasKey(project.Settings, "agent.mode")).To(BeFalse())
+			Expect(config.HasKey(project.Settings, "role")).To(BeFalse())
+		})
+
+		it("leaves out the agent settings of a project that isn't trusted", func() {
+			content := "model: gpt-4o-mini\nagent:\n  allowed_tools: [shell]\n"
+			Expect(os.WriteFile(filepath.Join(root, config.ProjectConfigName), []byte(content), 0o644)).To(Succeed())
+
+			var asked string
+			project, err := config.LoadProjectConfig(root, func(dir string) bool {
+				asked = dir
+				return false
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(asked).To(Equal(root))
+			Expect(project.Trusted).To(BeFalse())
+			Expect(project.Settings).To(HaveKeyWithValue("model", "gpt-4o-mini"))
+			Expect(project.Settings).NotTo(HaveKey("agent"))
+			Expect(project.Untrusted).To(Equal([]string{"agent"}))
+
+			project, err = config.LoadProjectConfig(root, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(project.Settings).NotTo(HaveKey("agent"))
+		})
+
+		it("returns nil without a project file", func() {
+			project, err := config.LoadProjectConfig(root, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(project).To(BeNil())
+		})
+
+		it("reports invalid YAML", func() {
+			Expect(os.WriteFile(filepath.Join(root, config.ProjectConfigName), []byte("model: [unclosed"), 0o644)).To(Succeed())
+
+			_, err := config.LoadProjectConfig(root, nil)
+			Expect(err).To(MatchError(ContainSubstring("failed to parse")))
+		})
+	})
+
+	when("IsTrustedDir()", func() {
+		it("trusts the listed directories and everything below them", func() {
+			repo := filepath.Join(root, "work", "repo")
+
+			Expect(config.IsTrustedDir(repo, []string{filepath.Join(root, "work")})).To(BeTrue())
+			Expect(config.IsTrustedDir(repo, []string{"", repo})).To(BeTrue())
+			Expect(config.IsTrustedDir(repo, []string{filepath.Join(root, "work", "repo2")})).To(BeFalse())
+			Expect(config.IsTrustedDir(filepath.Join(root, "work"), []string{repo})).To(BeFalse())
+			Expect(config.IsTrustedDir(repo, nil)).To(BeFalse())
+		})
+	})
+
+	when("AnnotateSources()", func() {
+		it("adds the source of every value as a comment", func() {
+			settings := map[string]interface{}{
+				"model": "gpt-4o",
+				"agent": map[string]interface{}{
+					"mode":          "plan",
+					"allowed_tools": []string{"files"},
+				},
+			}
+
+			out, err := config.AnnotateSources(settings, func(key string) string {
+				return "# " + key
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(out)).To(Equal("agent:\n" +
+				"    allowed_tools: # agent.allowed_tools\n" +
+				"        - files\n" +
+				"    mode: plan # agent.mode\n" +
+				"model: gpt-4o # model\n"))
+		})
+	})
+}
@@ -25,6 +25,7 @@ const (
 	openAIImageGenerationsPath = "/v1/images/generations"
 	openAIImageEditsPath       = "/v1/images/edits"
 	openAIModelsPath           = "/v1/models"
+	openAIRealtimePath         = "/v1/realtime"
 	openAIAuthHeader           = "Authorization"
 	openAIAuthTokenPrefix      = "Bearer "
 	openAIRole                 = "You are a helpful assistant."
@@ -119,6 +120,10 @@ func (f *FileIO) List() ([]string, error) {
 	}
 
 	for _, file := range files {
+		// the data home also holds e.g. the usage ledger
+		if file.IsDir() || filepath.Ext(file.Name()) != ".json" {
+			continue
+		}
 		result = append(result, file.Name())
 	}
 
@@ -149,6 +154,7 @@ func (f *FileIO) ReadDefaults() Config {
 		ImageGenerationsPath: openAIImageGenerationsPath,
 		ImageEditsPath:       openAIImageEditsPath,
 		ModelsPath:           openAIModelsPath,
+		RealtimePath:         openAIRealtimePath,
 		AuthHeader:           openAIAuthHeader,
 		AuthTokenPrefix:      openAIAuthTokenPrefix,
 		Thread:               openAIThread,
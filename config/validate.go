@@ -0,0 +1,229 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Issue is a problem with a single setting, identified by its dotted key.
+type Issue struct {
+	Key     string
+	Message string
+}
+
+func (i Issue) String() string {
+	return i.Key + ": " + i.Message
+}
+
+// Validate checks settings, as returned by ReadSettings, against the fields of Config. It
+// reports unknown keys, with a suggestion when one looks like a typo of a known key, and
+// values that viper would silently turn into a zero value.
+func Validate(settings map[string]interface{}) []Issue {
+	var issues []Issue
+	validateStruct(reflect.TypeOf(Config{}), settings, "", &issues)
+
+	sort.Slice(issues, func(i, j int) bool {
+		return issues[i].Key < issues[j].Key
+	})
+	return issues
+}
+
+// ValidateEnvironment checks the environment variables that override top-level settings,
+// named after the upper-cased prefix and key such as OPENAI_MAX_TOKENS, for values that
+// don't parse as the type of the setting.
+func ValidateEnvironment(prefix string, lookup func(string) (string, bool)) []Issue {
+	var issues []Issue
+
+	t := reflect.TypeOf(Config{})
+	for i := 0; i < t.NumField(); i++ {
+		key := t.Field(i).Tag.Get("yaml")
+		name := strings.ToUpper(prefix + "_" + key)
+
+		value, ok := lookup(name)
+		if !ok || value == "" {
+			continue
+		}
+		if err := parseScalar(t.Field(i).Type.Kind(), value); err != nil {
+			issues = append(issues, Issue{Key: key, Message: fmt.Sprintf("%s=%q is not %s", name, value, describeKind(t.Field(i).Type))})
+		}
+	}
+	return issues
+}
+
+func validateStruct(t reflect.Type, settings map[string]interface{}, prefix string, issues *[]Issue) {
+	fields := map[string]reflect.Type{}
+	for i := 0; i < t.NumField(); i++ {
+		fields[t.Field(i).Tag.Get("yaml")] = t.Field(i).Type
+	}
+
+	for key, value := range settings {
+		path := key
+		if prefix != "" {
+			path = prefix + "." + key
+		}
+
+		fieldType, ok := fields[key]
+		if !ok {
+			message := "unknown key"
+			if match := closestKey(key, fields); match != "" {
+				if prefix != "" {
+					match = prefix + "." + match
+				}
+				message += fmt.Sprintf(", did you mean %s?", match)
+			}
+			*issues = append(*issues, Issue{Key: path, Message: message})
+			continue
+		}
+
+		// An empty value, e.g. "role:", leaves the default in place.
+		if value == nil {
+			continue
+		}
+
+		if fieldType.Kind() == reflect.Struct {
+			nested, ok := value.(map[string]interface{})
+			if !ok {
+				*issues = append(*issues, Issue{Key: path, Message: "expected a mapping, got " + describeValue(value)})
+				continue
+			}
+			validateStruct(fieldType, nested, path, issues)
+			continue
+		}
+
+		if !matchesType(fieldType, value) {
+			*issues = append(*issues, Issue{Key: path, Message: fmt.Sprintf("expected %s, got %s", describeKind(fieldType), describeValue(value))})
+		}
+	}
+}
+
+func matchesType(t reflect.Type, value interface{}) bool {
+	switch t.Kind() {
+	case reflect.String:
+		// A bare true or false would end up as "true" or "false", quote it instead.
+		_, isBool := value.(bool)
+		return isScalar(value) && !isBool
+	case reflect.Int, reflect.Bool, reflect.Float64:
+		if !isScalar(value) {
+			return false
+		}
+		if s, ok := value.(string); ok {
+			return parseScalar(t.Kind(), s) == nil
+		}
+		if _, ok := value.(bool); ok {
+			return t.Kind() == reflect.Bool
+		}
+		if f, ok := value.(float64); ok {
+			return t.Kind() == reflect.Float64 || (t.Kind() == reflect.Int && f == float64(int64(f)))
+		}
+		return t.Kind() != reflect.Bool
+	case reflect.Slice:
+		list, ok := value.([]interface{})
+		if !ok {
+			return false
+		}
+		for _, item := range list {
+			if !isScalar(item) {
+				return false
+			}
+		}
+		return true
+	case reflect.Map:
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		for _, item := range m {
+			if item != nil && !isScalar(item) {
+				return false
+			}
+		}
+		return true
+	}
+	return true
+}
+
+func parseScalar(kind reflect.Kind, value string) error {
+	var err error
+	switch kind {
+	case reflect.Int:
+		_, err = strconv.Atoi(value)
+	case reflect.Bool:
+		_, err = strconv.ParseBool(value)
+	case reflect.Float64:
+		_, err = strconv.ParseFloat(value, 64)
+	}
+	return err
+}
+
+func isScalar(value interface{}) bool {
+	switch value.(type) {
+	case string, bool, int, int64, uint64, float64:
+		return true
+	}
+	return false
+}
+
+func describeKind(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Int:
+		return "an integer"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Float64:
+		return "a number"
+	case reflect.Slice:
+		return "a list"
+	case reflect.Map, reflect.Struct:
+		return "a mapping"
+	}
+	return t.String()
+}
+
+func describeValue(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return strconv.Quote(v)
+	case []interface{}:
+		return "a list"
+	case map[string]interface{}:
+		return "a mapping"
+	}
+	return fmt.Sprint(value)
+}
+
+// closestKey returns the key in fields within two edits of key, if any.
+func closestKey(key string, fields map[string]reflect.Type) string {
+	best, bestDistance := "", 3
+	for name := range fields {
+		if d := editDistance(key, name); d < bestDistance || (d == bestDistance && name < best) {
+			best, bestDistance = name, d
+		}
+	}
+	return best
+}
+
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
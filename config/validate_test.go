@@ -0,0 +1,108 @@
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kardolus/chatgpt-cli/config"
+	. "github.com/onsi/gomega"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+)
+
+func TestUnitValidate(t *testing.T) {
+	spec.Run(t, "Configuration validation", testValidate, spec.Report(report.Terminal{}))
+}
+
+func testValidate(t *testing.T, when spec.G, it spec.S) {
+	it.Before(func() {
+		RegisterTestingT(t)
+	})
+
+	read := func(content string) map[string]interface{} {
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		Expect(os.WriteFile(path, []byte(content), 0o644)).To(Succeed())
+
+		settings, err := config.ReadSettings(path)
+		Expect(err).NotTo(HaveOccurred())
+		return settings
+	}
+
+	when("Validate()", func() {
+		it("accepts a valid configuration", func() {
+			settings := read(`model: gpt-4o
+max_tokens: "4096"
+temperature: 1
+omit_history: false
+thread:
+custom_headers:
+  X-Team: core
+agent:
+  mode: plan
+  allowed_tools: [shell, files]
+proxy:
+  model_aliases:
+    fast: gpt-4o-mini
+`)
+			Expect(config.Validate(settings)).To(BeEmpty())
+		})
+
+		it("reports unknown keys with a suggestion", func() {
+			settings := read("modle: gpt-4o\ncolour: red\nagent:\n  max_step: 3\n")
+
+			Expect(config.Validate(settings)).To(Equal([]config.Issue{
+				{Key: "agent.max_step", Message: "unknown key, did you mean agent.max_steps?"},
+				{Key: "colour", Message: "unknown key"},
+				{Key: "modle", Message: "unknown key, did you mean model?"},
+			}))
+		})
+
+		it("reports values of the wrong type", func() {
+			settings := read(`max_tokens: lots
+context_window: 1.5
+temperature: warm
+omit_history: 3
+role: true
+custom_headers: [a, b]
+agent:
+  allowed_tools: shell
+  max_steps: 10
+image: square
+`)
+
+			issues := config.Validate(settings)
+			Expect(issues).To(HaveLen(8))
+			Expect(issues).To(ContainElements(
+				config.Issue{Key: "max_tokens", Message: `expected an integer, got "lots"`},
+				config.Issue{Key: "context_window", Message: "expected an integer, got 1.5"},
+				config.Issue{Key: "temperature", Message: `expected a number, got "warm"`},
+				config.Issue{Key: "omit_history", Message: "expected a boolean, got 3"},
+				config.Issue{Key: "role", Message: "expected a string, got true"},
+				config.Issue{Key: "custom_headers", Message: "expected a mapping, got a list"},
+				config.Issue{Key: "agent.allowed_tools", Message: `expected a list, got "shell"`},
+				config.Issue{Key: "image", Message: `expected a mapping, got "square"`},
+			))
+		})
+	})
+
+	when("ValidateEnvironment()", func() {
+		it("reports variables that don't parse", func() {
+			env := map[string]string{
+				"OPENAI_MAX_TOKENS":   "lots",
+				"OPENAI_TEMPERATURE":  "0.5",
+				"OPENAI_OMIT_HISTORY": "sure",
+				"OPENAI_MODEL":        "gpt-4o",
+			}
+			lookup := func(name string) (string, bool) {
+				value, ok := env[name]
+				return value, ok
+			}
+
+			Expect(config.ValidateEnvironment("openai", lookup)).To(Equal([]config.Issue{
+				{Key: "max_tokens", Message: `OPENAI_MAX_TOKENS="lots" is not an integer`},
+				{Key: "omit_history", Message: `OPENAI_OMIT_HISTORY="sure" is not a boolean`},
+			}))
+		})
+	})
+}
@@ -8,4 +8,16 @@ import (
 type History struct {
 	api.Message
 	Timestamp time.Time `json:"timestamp,omitempty"`
+
+	// Tokens is the total usage of the request that returned an answer, if the API reported it.
+	Tokens int `json:"tokens,omitempty"`
+
+	// Agent is set on the answers of agent runs.
+	Agent *AgentRun `json:"agent,omitempty"`
+}
+
+// AgentRun records what an agent run did, one short line per side effect.
+type AgentRun struct {
+	Mode    string   `json:"mode,omitempty"`
+	Effects []string `json:"effects,omitempty"`
 }
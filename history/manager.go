@@ -38,7 +38,7 @@ func (h *Manager) ParseUserHistory(thread string) ([]string, error) {
 
 	for _, entry := range historyEntries {
 		if entry.Role == userRole {
-			if s, ok := entry.Content.(string); ok {
+			if s := api.ContentText(entry.Content); s != "" {
 				result = append(result, s)
 			}
 		}
@@ -62,7 +62,7 @@ func (h *Manager) Print(thread string) (string, error) {
 
 	for _, entry := range historyEntries {
 		if entry.Role == userRole && lastRole == userRole {
-			concatenatedMessage += entry.Content.(string)
+			concatenatedMessage += describeContent(entry.Content)
 		} else {
 			if lastRole == userRole && concatenatedMessage != "" {
 				result += formatHistory(History{
@@ -73,11 +73,12 @@ func (h *Manager) Print(thread string) (string, error) {
 			}
 
 			if entry.Role == userRole {
-				concatenatedMessage = entry.Content.(string)
+				concatenatedMessage = describeContent(entry.Content)
 			} else {
 				result += formatHistory(History{
 					Message:   entry.Message,
 					Timestamp: entry.Timestamp,
+					Tokens:    entry.Tokens,
 				})
 			}
 		}
@@ -97,9 +98,9 @@ func (h *Manager) Print(thread string) (string, error) {
 
 func formatHistory(entry History) string {
 	var (
-		emoji     string
-		prefix    string
-		timestamp string
+		emoji  string
+		prefix string
+		detail string
 	)
 
 	switch entry.Role {
@@ -110,7 +111,7 @@ func formatHistory(entry History) string {
 		emoji = "👤"
 		prefix = "---\n"
 		if !entry.Timestamp.IsZero() {
-			timestamp = fmt.Sprintf(" [%s]", entry.Timestamp.Format("2006-01-02 15:04:05"))
+			detail = fmt.Sprintf(" [%s]", entry.Timestamp.Format("2006-01-02 15:04:05"))
 		}
 	case functionRole:
 		emoji = "🔌"
@@ -118,7 +119,44 @@ func formatHistory(entry History) string {
 	case assistantRole:
 		emoji = "🤖"
 		prefix = "\n"
+		if entry.Tokens > 0 {
+			detail = fmt.Sprintf(" [%d tokens]", entry.Tokens)
+		}
+	}
+
+	return fmt.Sprintf("%s**%s** %s%s:\n%s\n", prefix, strings.ToUpper(entry.Role), emoji, detail, describeContent(entry.Content))
+}
+
+// describeContent renders message content for display. Media parts of a multimodal
+// message are shown as numbered placeholders such as "[image 2]" or "[file 1: input.pdf]".
+func describeContent(content interface{}) string {
+	parts, ok := api.ContentParts(content)
+	if !ok {
+		return fmt.Sprint(content)
 	}
 
-	return fmt.Sprintf("%s**%s** %s%s:\n%s\n", prefix, strings.ToUpper(entry.Role), emoji, timestamp, entry.Content)
+	var (
+		lines  []string
+		counts = map[string]int{}
+	)
+	for _, p := range parts {
+		switch p.Type {
+		case api.TextPartType:
+			lines = append(lines, p.Text)
+		case api.ImagePartType:
+			counts["image"]++
+			lines = append(lines, fmt.Sprintf("[image %d]", counts["image"]))
+		case api.AudioPartType:
+			counts["audio"]++
+			lines = append(lines, fmt.Sprintf("[audio %d]", counts["audio"]))
+		case api.FilePartType:
+			counts["file"]++
+			if p.File != nil && p.File.Filename != "" {
+				lines = append(lines, fmt.Sprintf("[file %d: %s]", counts["file"], p.File.Filename))
+			} else {
+				lines = append(lines, fmt.Sprintf("[file %d]", counts["file"]))
+			}
+		}
+	}
+	return strings.Join(lines, "\n")
 }
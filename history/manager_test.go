@@ -141,6 +141,13 @@ func testHistory(t *testing.T, when spec.G, it spec.S) {
 				{
 					Message: api.Message{Role: "assistant", Content: "assistant message"},
 				},
+				{
+					Message: api.Message{Role: "user", Content: "user message 2"},
+				},
+				{
+					Message: api.Message{Role: "assistant", Content: "assistant message 2"},
+					Tokens:  42,
+				},
 			}
 
 			mockHistoryStore.EXPECT().ReadThread(threadName).Return(historyEntries, nil).Times(1)
@@ -151,6 +158,7 @@ func testHistory(t *testing.T, when spec.G, it spec.S) {
 			Expect(result).To(ContainSubstring("\n---\n**FUNCTION** 🔌:\nfunction message\n"))
 			Expect(result).To(ContainSubstring("\n---\n**USER** 👤:\nuser message\n"))
 			Expect(result).To(ContainSubstring("**ASSISTANT** 🤖:\nassistant message\n"))
+			Expect(result).To(ContainSubstring("**ASSISTANT** 🤖 [42 tokens]:\nassistant message 2\n"))
 		})
 
 		it("handles the final user message concatenation", func() {
@@ -169,5 +177,24 @@ func testHistory(t *testing.T, when spec.G, it spec.S) {
 			Expect(err).NotTo(HaveOccurred())
 			Expect(result).To(ContainSubstring("**USER** 👤:\nfirst message second message\n"))
 		})
+
+		it("shows numbered placeholders for the media parts of a message", func() {
+			historyEntries := []history.History{
+				{
+					Message: api.Message{Role: "user", Content: []api.ContentPart{
+						{Type: api.TextPartType, Text: "compare these"},
+						{Type: api.ImagePartType, ImageURL: &api.ImageURL{URL: "https://example.com/a.png"}},
+						{Type: api.ImagePartType, ImageURL: &api.ImageURL{URL: "https://example.com/b.png"}},
+						{Type: api.FilePartType, File: &api.File{Filename: "input.pdf", FileData: "data:application/pdf;base64,JVBERi0="}},
+					}},
+				},
+			}
+
+			mockHistoryStore.EXPECT().ReadThread(threadName).Return(historyEntries, nil).Times(1)
+
+			result, err := subject.Print(threadName)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result).To(ContainSubstring("**USER** 👤:\ncompare these\n[image 1]\n[image 2]\n[file 1: input.pdf]\n"))
+		})
 	})
 }
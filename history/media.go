@@ -0,0 +1,177 @@
+package history
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/kardolus/chatgpt-cli/api"
+)
+
+const (
+	mediaDir     = "media"
+	mediaRef     = "media:"
+	dataScheme   = "data:"
+	missingMedia = "[%s missing from the thread's media store]"
+)
+
+// storeMedia moves the base64 images, audio and files in entries to blobs in the media
+// directory, named by the hash of their content, and replaces them by a reference. A
+// thread file doesn't grow by the size of every attachment and an attachment sent in
+// several threads is stored once. Only the entries that change are copied.
+func (f *FileIO) storeMedia(entries []History) ([]History, error) {
+	var result []History
+	for i, entry := range entries {
+		parts, ok := api.ContentParts(entry.Content)
+		if !ok || !hasInlineMedia(parts) {
+			continue
+		}
+		if result == nil {
+			result = append([]History(nil), entries...)
+		}
+
+		kept := make([]api.ContentPart, len(parts))
+		for j, part := range parts {
+			kept[j] = part
+			payload := inlinePayload(part)
+			if payload == "" {
+				continue
+			}
+
+			ref, err := f.writeBlob(payload)
+			if err != nil {
+				return nil, err
+			}
+			switch {
+			case part.ImageURL != nil:
+				kept[j].ImageURL = &api.ImageURL{URL: ref}
+			case part.InputAudio != nil:
+				kept[j].InputAudio = &api.InputAudio{Data: ref, Format: part.InputAudio.Format}
+			case part.File != nil:
+				kept[j].File = &api.File{Filename: part.File.Filename, FileData: ref}
+			}
+		}
+		result[i].Content = kept
+	}
+
+	if result == nil {
+		return entries, nil
+	}
+	return result, nil
+}
+
+// loadMedia replaces the media references in entries by the content of their blobs. A
+// blob that can no longer be read is replaced by a note, so the rest of the thread can
+// still be sent.
+func (f *FileIO) loadMedia(entries []History) []History {
+	for i, entry := range entries {
+		parts, ok := api.ContentParts(entry.Content)
+		if !ok || !hasMediaRef(parts) {
+			continue
+		}
+
+		for j, part := range parts {
+			kind, ref := mediaReference(part)
+			if ref == "" {
+				continue
+			}
+
+			data, err := os.ReadFile(f.blobPath(ref))
+			switch {
+			case err != nil:
+				parts[j] = api.ContentPart{Type: api.TextPartType, Text: fmt.Sprintf(missingMedia, kind)}
+			case part.ImageURL != nil:
+				parts[j].ImageURL = &api.ImageURL{URL: string(data)}
+			case part.InputAudio != nil:
+				parts[j].InputAudio = &api.InputAudio{Data: string(data), Format: part.InputAudio.Format}
+			case part.File != nil:
+				parts[j].File = &api.File{Filename: part.File.Filename, FileData: string(data)}
+			}
+		}
+		entries[i].Content = parts
+	}
+	return entries
+}
+
+// writeBlob stores payload unless a blob with the same content exists and returns its reference.
+func (f *FileIO) writeBlob(payload string) (string, error) {
+	sum := sha256.Sum256([]byte(payload))
+	ref := mediaRef + hex.EncodeToString(sum[:])
+
+	path := f.blobPath(ref)
+	if _, err := os.Stat(path); err == nil {
+		return ref, nil
+	}
+
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", err
+	}
+
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.WriteString(payload); err != nil {
+		_ = tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	return ref, os.Rename(tmp.Name(), path)
+}
+
+func (f *FileIO) blobPath(ref string) string {
+	return filepath.Join(f.historyDir, mediaDir, filepath.Base(strings.TrimPrefix(ref, mediaRef)))
+}
+
+func hasInlineMedia(parts []api.ContentPart) bool {
+	for _, part := range parts {
+		if inlinePayload(part) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func hasMediaRef(parts []api.ContentPart) bool {
+	for _, part := range parts {
+		if _, ref := mediaReference(part); ref != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// inlinePayload returns the base64 data a part carries, or an empty string. Image URLs
+// other than data URLs are kept in the thread file.
+func inlinePayload(part api.ContentPart) string {
+	switch {
+	case part.ImageURL != nil && strings.HasPrefix(part.ImageURL.URL, dataScheme):
+		return part.ImageURL.URL
+	case part.InputAudio != nil && part.InputAudio.Data != "" && !strings.HasPrefix(part.InputAudio.Data, mediaRef):
+		return part.InputAudio.Data
+	case part.File != nil && part.File.FileData != "" && !strings.HasPrefix(part.File.FileData, mediaRef):
+		return part.File.FileData
+	}
+	return ""
+}
+
+// mediaReference returns the kind of media a part refers to and the reference, if any.
+func mediaReference(part api.ContentPart) (string, string) {
+	switch {
+	case part.ImageURL != nil && strings.HasPrefix(part.ImageURL.URL, mediaRef):
+		return "image", part.ImageURL.URL
+	case part.InputAudio != nil && strings.HasPrefix(part.InputAudio.Data, mediaRef):
+		return "audio", part.InputAudio.Data
+	case part.File != nil && strings.HasPrefix(part.File.FileData, mediaRef):
+		return strings.TrimSpace("file " + part.File.Filename), part.File.FileData
+	}
+	return "", ""
+}
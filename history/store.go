@@ -66,14 +66,25 @@ func (f *FileIO) WithDirectory(historyDir string) *FileIO {
 }
 
 func (f *FileIO) Read() ([]History, error) {
-	return parseFile(f.getPath(f.thread))
+	return f.ReadThread(f.thread)
 }
 
 func (f *FileIO) ReadThread(thread string) ([]History, error) {
-	return parseFile(f.getPath(thread))
+	entries, err := parseFile(f.getPath(thread))
+	if err != nil {
+		return nil, err
+	}
+	return f.loadMedia(entries), nil
 }
 
+// Write saves the thread. Inline media is kept in the media directory next to the thread
+// files and the thread file refers to it, see storeMedia.
 func (f *FileIO) Write(historyEntries []History) error {
+	historyEntries, err := f.storeMedia(historyEntries)
+	if err != nil {
+		return err
+	}
+
 	data, err := json.Marshal(historyEntries)
 	if err != nil {
 		return err
@@ -1,10 +1,14 @@
 package history_test
 
 import (
+	"github.com/kardolus/chatgpt-cli/api"
 	"github.com/kardolus/chatgpt-cli/history"
 	. "github.com/onsi/gomega"
 	"github.com/sclevine/spec"
 	"github.com/sclevine/spec/report"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -27,4 +31,88 @@ func testStore(t *testing.T, when spec.G, it spec.S) {
 			Expect(subject.GetThread()).To(Equal(thread))
 		})
 	})
+
+	when("Write()", func() {
+		const (
+			image = "data:image/png;base64,iVBORw0KGgo="
+			pdf   = "data:application/pdf;base64,JVBERi0xLjQ="
+		)
+
+		var (
+			dir     string
+			entries []history.History
+		)
+
+		it.Before(func() {
+			dir = t.TempDir()
+			subject = (&history.FileIO{}).WithDirectory(dir)
+			subject.SetThread("default")
+
+			entries = []history.History{
+				{Message: api.Message{Role: "system", Content: "be brief"}},
+				{Message: api.Message{Role: "user", Content: []api.ContentPart{
+					{Type: api.TextPartType, Text: "compare these"},
+					{Type: api.ImagePartType, ImageURL: &api.ImageURL{URL: image}},
+					{Type: api.ImagePartType, ImageURL: &api.ImageURL{URL: "https://example.com/b.png"}},
+					{Type: api.AudioPartType, InputAudio: &api.InputAudio{Data: "UklGRg==", Format: "wav"}},
+					{Type: api.FilePartType, File: &api.File{Filename: "input.pdf", FileData: pdf}},
+				}}},
+			}
+		})
+
+		it("keeps inline media out of the thread file and restores it on read", func() {
+			Expect(subject.Write(entries)).To(Succeed())
+
+			data, err := os.ReadFile(filepath.Join(dir, "default.json"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(data)).NotTo(ContainSubstring("base64"))
+			Expect(string(data)).NotTo(ContainSubstring("UklGRg=="))
+			Expect(string(data)).To(ContainSubstring("https://example.com/b.png"))
+
+			blobs, err := os.ReadDir(filepath.Join(dir, "media"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(blobs).To(HaveLen(3))
+
+			parts, ok := api.ContentParts(entries[1].Content)
+			Expect(ok).To(BeTrue())
+			Expect(parts[1].ImageURL.URL).To(Equal(image), "the entries passed in are not changed")
+
+			read, err := subject.Read()
+			Expect(err).NotTo(HaveOccurred())
+			parts, ok = api.ContentParts(read[1].Content)
+			Expect(ok).To(BeTrue())
+			Expect(parts).To(Equal([]api.ContentPart{
+				{Type: api.TextPartType, Text: "compare these"},
+				{Type: api.ImagePartType, ImageURL: &api.ImageURL{URL: image}},
+				{Type: api.ImagePartType, ImageURL: &api.ImageURL{URL: "https://example.com/b.png"}},
+				{Type: api.AudioPartType, InputAudio: &api.InputAudio{Data: "UklGRg==", Format: "wav"}},
+				{Type: api.FilePartType, File: &api.File{Filename: "input.pdf", FileData: pdf}},
+			}))
+		})
+
+		it("stores media shared between threads once", func() {
+			Expect(subject.Write(entries)).To(Succeed())
+			subject.SetThread("other")
+			Expect(subject.Write(entries)).To(Succeed())
+
+			blobs, err := os.ReadDir(filepath.Join(dir, "media"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(blobs).To(HaveLen(3))
+		})
+
+		it("notes media whose blob is gone instead of failing the thread", func() {
+			Expect(subject.Write(entries)).To(Succeed())
+			blobs, err := os.ReadDir(filepath.Join(dir, "media"))
+			Expect(err).NotTo(HaveOccurred())
+			for _, blob := range blobs {
+				Expect(os.Remove(filepath.Join(dir, "media", blob.Name()))).To(Succeed())
+			}
+
+			read, err := subject.Read()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(read).To(HaveLen(2))
+			text := api.ContentText(read[1].Content)
+			Expect(strings.Count(text, "missing from the thread's media store")).To(Equal(3))
+		})
+	})
 }
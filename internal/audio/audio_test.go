@@ -0,0 +1,269 @@
+package audio_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/kardolus/chatgpt-cli/internal/audio"
+	. "github.com/onsi/gomega"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+)
+
+func TestUnitAudio(t *testing.T) {
+	spec.Run(t, "Testing the audio package", testAudio, spec.Report(report.Terminal{}))
+}
+
+const sampleRate = 8000
+
+// buildWAV renders 16-bit mono audio: a 440Hz tone for every positive duration and
+// silence for every negative one.
+func buildWAV(parts ...time.Duration) []byte {
+	var samples []int16
+	for _, p := range parts {
+		n := int(p.Abs().Seconds() * sampleRate)
+		for i := 0; i < n; i++ {
+			var v int16
+			if p > 0 {
+				v = int16(8000 * math.Sin(2*math.Pi*440*float64(i)/sampleRate))
+			}
+			samples = append(samples, v)
+		}
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("RIFF")
+	_ = binary.Write(&buf, binary.LittleEndian, uint32(36+2*len(samples)))
+	buf.WriteString("WAVEfmt ")
+	for _, v := range []any{uint32(16), uint16(1), uint16(1), uint32(sampleRate), uint32(2 * sampleRate), uint16(2), uint16(16)} {
+		_ = binary.Write(&buf, binary.LittleEndian, v)
+	}
+	buf.WriteString("data")
+	_ = binary.Write(&buf, binary.LittleEndian, uint32(2*len(samples)))
+	_ = binary.Write(&buf, binary.LittleEndian, samples)
+	return buf.Bytes()
+}
+
+// buildOgg renders an Ogg Opus stream with the OpusHead and OpusTags header pages and one
+// page per granule position given. Checksums are left out, JoinOgg recomputes them.
+func buildOgg(serial uint32, granules ...uint64) []byte {
+	var out []byte
+	page := func(flags byte, granule uint64, seq uint32, packet string) {
+		header := make([]byte, 27)
+		copy(header, "OggS")
+		header[5] = flags
+		binary.LittleEndian.PutUint64(header[6:14], granule)
+		binary.LittleEndian.PutUint32(header[14:18], serial)
+		binary.LittleEndian.PutUint32(header[18:22], seq)
+		header[26] = 1
+		out = append(out, header...)
+		out = append(out, byte(len(packet)))
+		out = append(out, packet...)
+	}
+
+	page(0x02, 0, 0, "OpusHead\x01\x01\x38\x01\x80\xbb\x00\x00\x00\x00\x00")
+	page(0, 0, 1, "OpusTagsvendor")
+	for i, g := range granules {
+		flags := byte(0)
+		if i == len(granules)-1 {
+			flags = 0x04
+		}
+		page(flags, g, uint32(i+2), "audio")
+	}
+	return out
+}
+
+type oggPage struct {
+	flags   byte
+	granule uint64
+	serial  uint32
+	seq     uint32
+	crc     uint32
+	raw     []byte
+}
+
+func parseOgg(data []byte) []oggPage {
+	var pages []oggPage
+	for pos := 0; pos < len(data); {
+		n := 27 + int(data[pos+26])
+		for _, l := range data[pos+27 : pos+n] {
+			n += int(l)
+		}
+		raw := data[pos : pos+n]
+		pages = append(pages, oggPage{
+			flags:   raw[5],
+			granule: binary.LittleEndian.Uint64(raw[6:14]),
+			serial:  binary.LittleEndian.Uint32(raw[14:18]),
+			seq:     binary.LittleEndian.Uint32(raw[18:22]),
+			crc:     binary.LittleEndian.Uint32(raw[22:26]),
+			raw:     raw,
+		})
+		pos += n
+	}
+	return pages
+}
+
+func oggCRC(page []byte) uint32 {
+	page = append([]byte(nil), page...)
+	copy(page[22:26], []byte{0, 0, 0, 0})
+
+	var crc uint32
+	for _, b := range page {
+		crc ^= uint32(b) << 24
+		for i := 0; i < 8; i++ {
+			if crc&0x80000000 != 0 {
+				crc = crc<<1 ^ 0x04c11db7
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+func testAudio(t *testing.T, when spec.G, it spec.S) {
+	it.Before(func() {
+		RegisterTestingT(t)
+	})
+
+	when("ParseWAV()", func() {
+		it("reads the format and duration", func() {
+			w, err := audio.ParseWAV(buildWAV(1500 * time.Millisecond))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(w.Channels).To(Equal(1))
+			Expect(w.SampleRate).To(Equal(sampleRate))
+			Expect(w.BitsPerSample).To(Equal(16))
+			Expect(w.ByteRate()).To(Equal(2 * sampleRate))
+			Expect(w.Duration()).To(Equal(1500 * time.Millisecond))
+		})
+
+		it("rejects other files", func() {
+			Expect(audio.IsWAV([]byte("ID3\x03\x00"))).To(BeFalse())
+
+			_, err := audio.ParseWAV([]byte("ID3\x03\x00"))
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	when("Split()", func() {
+		it("returns the recording as is when it is short enough", func() {
+			data := buildWAV(time.Second)
+			w, err := audio.ParseWAV(data)
+			Expect(err).NotTo(HaveOccurred())
+
+			chunks := w.Split(2 * time.Second)
+			Expect(chunks).To(HaveLen(1))
+			Expect(chunks[0].Data).To(Equal(data))
+		})
+
+		it("cuts at the silence closest before the limit", func() {
+			w, err := audio.ParseWAV(buildWAV(800*time.Millisecond, -300*time.Millisecond, 600*time.Millisecond))
+			Expect(err).NotTo(HaveOccurred())
+
+			chunks := w.Split(time.Second)
+			Expect(chunks).To(HaveLen(2))
+			Expect(chunks[0].Start).To(BeZero())
+			Expect(chunks[1].Start).To(Equal(825 * time.Millisecond))
+
+			var total time.Duration
+			for _, c := range chunks {
+				part, err := audio.ParseWAV(c.Data)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(part.SampleRate).To(Equal(sampleRate))
+				Expect(part.Duration()).To(BeNumerically("<=", time.Second))
+				total += part.Duration()
+			}
+			Expect(total).To(Equal(w.Duration()))
+		})
+
+		it("still cuts recordings without any silence", func() {
+			w, err := audio.ParseWAV(buildWAV(2500 * time.Millisecond))
+			Expect(err).NotTo(HaveOccurred())
+
+			chunks := w.Split(time.Second)
+			Expect(chunks).To(HaveLen(3))
+			for _, c := range chunks {
+				part, err := audio.ParseWAV(c.Data)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(part.Duration()).To(BeNumerically("<=", time.Second))
+			}
+		})
+	})
+
+	when("JoinWAV()", func() {
+		it("concatenates the samples", func() {
+			joined, err := audio.JoinWAV([][]byte{buildWAV(time.Second), buildWAV(-500 * time.Millisecond)})
+			Expect(err).NotTo(HaveOccurred())
+
+			w, err := audio.ParseWAV(joined)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(w.Duration()).To(Equal(1500 * time.Millisecond))
+		})
+	})
+
+	when("PCM16()", func() {
+		it("resamples to mono 16-bit samples and back into a WAV file", func() {
+			w, err := audio.ParseWAV(buildWAV(time.Second, -time.Second))
+			Expect(err).NotTo(HaveOccurred())
+
+			pcm := w.PCM16(24000)
+			Expect(pcm).To(HaveLen(2 * 48000))
+			Expect(pcm[48000:]).To(Equal(make([]byte, 48000)))
+
+			encoded, err := audio.ParseWAV(audio.EncodePCM16(pcm, 1, 24000))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(encoded.SampleRate).To(Equal(24000))
+			Expect(encoded.BitsPerSample).To(Equal(16))
+			Expect(encoded.Duration()).To(Equal(2 * time.Second))
+		})
+	})
+
+	when("JoinMP3()", func() {
+		it("keeps the first ID3 tag and drops the other tags and info frames", func() {
+			id3 := []byte("ID3\x04\x00\x00\x00\x00\x00\x02ab")
+			// MPEG-1 layer III, 128kbit/s, 44.1kHz: 417 byte frames.
+			frame := func(fill byte) []byte {
+				f := bytes.Repeat([]byte{fill}, 417)
+				copy(f, []byte{0xff, 0xfb, 0x90, 0x00})
+				return f
+			}
+			info := frame(0)
+			copy(info[36:], "Xing")
+
+			part := func(fill byte) []byte {
+				out := append(append(append([]byte{}, id3...), info...), frame(fill)...)
+				return append(out, append([]byte("TAG"), make([]byte, 125)...)...)
+			}
+
+			joined := audio.JoinMP3([][]byte{part(1), part(2)})
+			Expect(joined).To(Equal(append(append(append([]byte{}, id3...), frame(1)...), frame(2)...)))
+		})
+	})
+
+	when("JoinOgg()", func() {
+		it("merges the streams into one logical stream", func() {
+			joined, err := audio.JoinOgg([][]byte{buildOgg(7, 960, 1920), buildOgg(9, 960)})
+			Expect(err).NotTo(HaveOccurred())
+
+			pages := parseOgg(joined)
+			Expect(pages).To(HaveLen(5))
+			for i, p := range pages {
+				Expect(p.serial).To(Equal(uint32(7)))
+				Expect(p.seq).To(Equal(uint32(i)))
+				Expect(p.crc).To(Equal(oggCRC(p.raw)))
+			}
+			Expect(pages[0].flags).To(Equal(byte(0x02)))
+			Expect(pages[3].flags).To(BeZero())
+			Expect(pages[4].flags).To(Equal(byte(0x04)))
+			Expect(pages[4].granule).To(Equal(uint64(1920 + 960)))
+		})
+
+		it("rejects other data", func() {
+			_, err := audio.JoinOgg([][]byte{[]byte("not ogg")})
+			Expect(err).To(HaveOccurred())
+		})
+	})
+}
@@ -0,0 +1,87 @@
+package audio
+
+import "bytes"
+
+var (
+	// mp3Bitrates holds the layer III bitrates in kbit/s for MPEG-1 and MPEG-2/2.5.
+	mp3Bitrates = [2][16]int{
+		{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 0},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0},
+	}
+	mp3SampleRates = [4][3]int{
+		{11025, 12000, 8000},  // MPEG-2.5
+		{},                    // reserved
+		{22050, 24000, 16000}, // MPEG-2
+		{44100, 48000, 32000}, // MPEG-1
+	}
+)
+
+// JoinMP3 concatenates MP3 files. MPEG audio frames are independent, so only the ID3
+// tags and the Xing/Info frame, which describes the length of a single file, are dropped
+// from the parts; the first ID3v2 tag is kept.
+func JoinMP3(parts [][]byte) []byte {
+	var out []byte
+	for i, part := range parts {
+		tag := id3v2Length(part)
+		if i == 0 {
+			out = append(out, part[:tag]...)
+		}
+		part = part[tag:]
+
+		if n := len(part); n >= 128 && string(part[n-128:n-125]) == "TAG" {
+			part = part[:n-128]
+		}
+		if n := mp3FrameLength(part); n > 0 && n <= len(part) && isInfoFrame(part[:n]) {
+			part = part[n:]
+		}
+		out = append(out, part...)
+	}
+	return out
+}
+
+func id3v2Length(data []byte) int {
+	if len(data) < 10 || string(data[:3]) != "ID3" {
+		return 0
+	}
+	size := int(data[6]&0x7f)<<21 | int(data[7]&0x7f)<<14 | int(data[8]&0x7f)<<7 | int(data[9]&0x7f)
+	if data[5]&0x10 != 0 {
+		size += 10 // footer
+	}
+	if 10+size > len(data) {
+		return len(data)
+	}
+	return 10 + size
+}
+
+// mp3FrameLength returns the length of the layer III frame at the start of data, or 0
+// when data doesn't start with one.
+func mp3FrameLength(data []byte) int {
+	if len(data) < 4 || data[0] != 0xff || data[1]&0xe0 != 0xe0 || (data[1]>>1)&0x03 != 0x01 {
+		return 0
+	}
+
+	version := (data[1] >> 3) & 0x03
+	if version == 1 {
+		return 0
+	}
+	rateIndex := (data[2] >> 2) & 0x03
+	if rateIndex == 3 {
+		return 0
+	}
+
+	table, factor := 1, 72
+	if version == 3 {
+		table, factor = 0, 144
+	}
+	bitrate := mp3Bitrates[table][data[2]>>4] * 1000
+	if bitrate == 0 {
+		return 0
+	}
+	padding := int(data[2]>>1) & 0x01
+
+	return factor*bitrate/mp3SampleRates[version][rateIndex] + padding
+}
+
+func isInfoFrame(frame []byte) bool {
+	return bytes.Contains(frame, []byte("Xing")) || bytes.Contains(frame, []byte("Info"))
+}
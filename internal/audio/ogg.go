@@ -0,0 +1,156 @@
+package audio
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+const (
+	oggBOS = 0x02
+	oggEOS = 0x04
+
+	// oggHeaderPackets is the number of header packets of an Ogg Opus stream: OpusHead and OpusTags.
+	oggHeaderPackets = 2
+)
+
+var oggCRCTable = func() (table [256]uint32) {
+	for i := range table {
+		r := uint32(i) << 24
+		for j := 0; j < 8; j++ {
+			if r&0x80000000 != 0 {
+				r = r<<1 ^ 0x04c11db7
+			} else {
+				r <<= 1
+			}
+		}
+		table[i] = r
+	}
+	return table
+}()
+
+// JoinOgg joins Ogg Opus files into a single logical stream. The headers of all but the
+// first file are dropped and the remaining pages are renumbered, with their granule
+// positions shifted past the end of the preceding files.
+func JoinOgg(parts [][]byte) ([]byte, error) {
+	var (
+		out     []byte
+		serial  uint32
+		seq     uint32
+		offset  uint64
+		lastEOS = -1
+	)
+
+	for i, part := range parts {
+		pages, err := oggPages(part)
+		if err != nil {
+			return nil, fmt.Errorf("part %d: %w", i+1, err)
+		}
+		if i == 0 {
+			serial = binary.LittleEndian.Uint32(pages[0][14:18])
+		} else {
+			pages = skipOggHeaders(pages)
+		}
+
+		var last uint64
+		for _, page := range pages {
+			page = append([]byte(nil), page...)
+
+			if i > 0 {
+				page[5] &^= oggBOS
+			}
+			page[5] &^= oggEOS
+
+			// A granule position of -1 marks a page on which no packet ends.
+			if granule := binary.LittleEndian.Uint64(page[6:14]); granule != ^uint64(0) {
+				last = granule
+				binary.LittleEndian.PutUint64(page[6:14], granule+offset)
+			}
+			binary.LittleEndian.PutUint32(page[14:18], serial)
+			binary.LittleEndian.PutUint32(page[18:22], seq)
+			seq++
+
+			lastEOS = len(out)
+			out = append(out, page...)
+		}
+		offset += last
+	}
+
+	if lastEOS < 0 {
+		return nil, errors.New("nothing to join")
+	}
+	out[lastEOS+5] |= oggEOS
+
+	for pos := 0; pos < len(out); {
+		n := oggPageLength(out[pos:])
+		setOggCRC(out[pos : pos+n])
+		pos += n
+	}
+	return out, nil
+}
+
+// oggPages splits a physical Ogg stream into its pages.
+func oggPages(data []byte) ([][]byte, error) {
+	var pages [][]byte
+	for pos := 0; pos < len(data); {
+		n := oggPageLength(data[pos:])
+		if n == 0 {
+			return nil, errors.New("not an Ogg stream")
+		}
+		pages = append(pages, data[pos:pos+n])
+		pos += n
+	}
+	if len(pages) == 0 {
+		return nil, errors.New("empty Ogg stream")
+	}
+	return pages, nil
+}
+
+// oggPageLength returns the length of the page at the start of data, or 0 when data
+// doesn't start with a complete page.
+func oggPageLength(data []byte) int {
+	if len(data) < 27 || string(data[:4]) != "OggS" {
+		return 0
+	}
+	segments := int(data[26])
+	if len(data) < 27+segments {
+		return 0
+	}
+
+	n := 27 + segments
+	for _, lacing := range data[27 : 27+segments] {
+		n += int(lacing)
+	}
+	if n > len(data) {
+		return 0
+	}
+	return n
+}
+
+// skipOggHeaders drops the pages holding the header packets. Ogg Opus requires the first
+// audio packet to start on a fresh page.
+func skipOggHeaders(pages [][]byte) [][]byte {
+	packets := 0
+	for i, page := range pages {
+		segments := int(page[26])
+		for _, lacing := range page[27 : 27+segments] {
+			if lacing < 255 {
+				packets++
+			}
+		}
+		if packets >= oggHeaderPackets {
+			return pages[i+1:]
+		}
+	}
+	return nil
+}
+
+func setOggCRC(page []byte) {
+	binary.LittleEndian.PutUint32(page[22:26], 0)
+
+	var crc uint32
+	for _, b := range page {
+		crc = crc<<8 ^ oggCRCTable[byte(crc>>24)^b]
+	}
+	binary.LittleEndian.PutUint32(page[22:26], crc)
+}
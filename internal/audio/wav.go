@@ -0,0 +1,294 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+const (
+	formatPCM        = 1
+	formatFloat      = 3
+	formatExtensible = 0xFFFE
+
+	// silenceWindow is the resolution at which the quietest cut point is searched.
+	silenceWindow = 50 * time.Millisecond
+)
+
+// WAV is a RIFF/WAVE file holding uncompressed PCM or float samples.
+type WAV struct {
+	Channels      int
+	SampleRate    int
+	BitsPerSample int
+	Float         bool
+	Data          []byte
+
+	// format is the raw fmt chunk, copied verbatim into every chunk produced by Split.
+	format []byte
+}
+
+// Chunk is a self-contained WAV file cut out of a longer recording.
+type Chunk struct {
+	Start time.Duration
+	Data  []byte
+}
+
+// IsWAV reports whether data starts with a RIFF/WAVE header.
+func IsWAV(data []byte) bool {
+	return len(data) >= 12 && string(data[:4]) == "RIFF" && string(data[8:12]) == "WAVE"
+}
+
+// ParseWAV decodes the fmt and data chunks of a WAV file. Other chunks are ignored.
+func ParseWAV(data []byte) (*WAV, error) {
+	if !IsWAV(data) {
+		return nil, errors.New("not a WAV file")
+	}
+
+	w := &WAV{}
+	for pos := 12; pos+8 <= len(data); {
+		id := string(data[pos : pos+4])
+		size := int(binary.LittleEndian.Uint32(data[pos+4 : pos+8]))
+		pos += 8
+
+		// Streaming encoders leave the size at 0 or 0xFFFFFFFF, take whatever is there.
+		if size > len(data)-pos || (id == "data" && size == 0) {
+			size = len(data) - pos
+		}
+		body := data[pos : pos+size]
+
+		switch id {
+		case "fmt ":
+			if err := w.parseFormat(body); err != nil {
+				return nil, err
+			}
+		case "data":
+			w.Data = body
+		}
+
+		pos += size + size%2
+	}
+
+	if w.format == nil {
+		return nil, errors.New("WAV file has no fmt chunk")
+	}
+	if w.Data == nil {
+		return nil, errors.New("WAV file has no data chunk")
+	}
+	return w, nil
+}
+
+func (w *WAV) parseFormat(body []byte) error {
+	if len(body) < 16 {
+		return errors.New("WAV fmt chunk is too short")
+	}
+
+	tag := binary.LittleEndian.Uint16(body[0:2])
+	if tag == formatExtensible && len(body) >= 26 {
+		tag = binary.LittleEndian.Uint16(body[24:26])
+	}
+	if tag != formatPCM && tag != formatFloat {
+		return fmt.Errorf("unsupported WAV encoding %#x", tag)
+	}
+
+	w.Channels = int(binary.LittleEndian.Uint16(body[2:4]))
+	w.SampleRate = int(binary.LittleEndian.Uint32(body[4:8]))
+	w.BitsPerSample = int(binary.LittleEndian.Uint16(body[14:16]))
+	w.Float = tag == formatFloat
+	w.format = body
+
+	switch {
+	case w.Channels == 0 || w.SampleRate == 0:
+		return errors.New("WAV file has no channels or sample rate")
+	case w.Float && w.BitsPerSample != 32:
+		return fmt.Errorf("unsupported float WAV with %d bits per sample", w.BitsPerSample)
+	case w.BitsPerSample != 8 && w.BitsPerSample != 16 && w.BitsPerSample != 24 && w.BitsPerSample != 32:
+		return fmt.Errorf("unsupported WAV with %d bits per sample", w.BitsPerSample)
+	}
+	return nil
+}
+
+// ByteRate is the number of data bytes per second of audio.
+func (w *WAV) ByteRate() int {
+	return w.frameSize() * w.SampleRate
+}
+
+// Duration is the length of the recording.
+func (w *WAV) Duration() time.Duration {
+	return w.frameTime(w.frames())
+}
+
+// Split cuts the recording into chunks of at most maxLength. Each cut is placed at the
+// quietest moment in the last quarter of the chunk, so that words are rarely cut in half.
+func (w *WAV) Split(maxLength time.Duration) []Chunk {
+	total := w.frames()
+	maxFrames := int(int64(maxLength) * int64(w.SampleRate) / int64(time.Second))
+	if maxFrames <= 0 || total <= maxFrames {
+		return []Chunk{{Start: 0, Data: w.encode(0, total)}}
+	}
+
+	var chunks []Chunk
+	for start := 0; start < total; {
+		end := total
+		if total-start > maxFrames {
+			end = w.quietestFrame(start+maxFrames-maxFrames/4, start+maxFrames)
+		}
+		chunks = append(chunks, Chunk{Start: w.frameTime(start), Data: w.encode(start, end)})
+		start = end
+	}
+	return chunks
+}
+
+// quietestFrame returns the middle of the window with the least energy in [from, to).
+func (w *WAV) quietestFrame(from, to int) int {
+	window := int(int64(silenceWindow) * int64(w.SampleRate) / int64(time.Second))
+	if window < 1 {
+		window = 1
+	}
+
+	best, bestEnergy := to, math.Inf(1)
+	for start := from; start+window <= to; start += window {
+		if e := w.energy(start, start+window); e < bestEnergy {
+			best, bestEnergy = start+window/2, e
+		}
+	}
+	return best
+}
+
+// energy is the mean squared amplitude of all channels over the frames [from, to).
+func (w *WAV) energy(from, to int) float64 {
+	bytesPerSample := w.BitsPerSample / 8
+	samples := w.Data[from*w.frameSize() : to*w.frameSize()]
+
+	var sum float64
+	n := 0
+	for i := 0; i+bytesPerSample <= len(samples); i += bytesPerSample {
+		v := w.sample(samples[i : i+bytesPerSample])
+		sum += v * v
+		n++
+	}
+	if n == 0 {
+		return 0
+	}
+	return sum / float64(n)
+}
+
+// sample returns a single sample scaled to [-1, 1].
+func (w *WAV) sample(b []byte) float64 {
+	switch {
+	case w.Float:
+		return float64(math.Float32frombits(binary.LittleEndian.Uint32(b)))
+	case w.BitsPerSample == 8:
+		return (float64(b[0]) - 128) / 128
+	case w.BitsPerSample == 16:
+		return float64(int16(binary.LittleEndian.Uint16(b))) / (1 << 15)
+	case w.BitsPerSample == 24:
+		v := int32(b[0]) | int32(b[1])<<8 | int32(int8(b[2]))<<16
+		return float64(v) / (1 << 23)
+	default:
+		return float64(int32(binary.LittleEndian.Uint32(b))) / (1 << 31)
+	}
+}
+
+// encode writes the frames [from, to) as a complete WAV file.
+func (w *WAV) encode(from, to int) []byte {
+	data := w.Data[from*w.frameSize() : to*w.frameSize()]
+
+	var buf bytes.Buffer
+	buf.WriteString("RIFF")
+	_ = binary.Write(&buf, binary.LittleEndian, uint32(4+8+len(w.format)+len(w.format)%2+8+len(data)))
+	buf.WriteString("WAVE")
+	buf.WriteString("fmt ")
+	_ = binary.Write(&buf, binary.LittleEndian, uint32(len(w.format)))
+	buf.Write(w.format)
+	if len(w.format)%2 == 1 {
+		buf.WriteByte(0)
+	}
+	buf.WriteString("data")
+	_ = binary.Write(&buf, binary.LittleEndian, uint32(len(data)))
+	buf.Write(data)
+	return buf.Bytes()
+}
+
+func (w *WAV) frameSize() int {
+	return w.Channels * w.BitsPerSample / 8
+}
+
+func (w *WAV) frames() int {
+	return len(w.Data) / w.frameSize()
+}
+
+func (w *WAV) frameTime(frame int) time.Duration {
+	return time.Duration(int64(frame) * int64(time.Second) / int64(w.SampleRate))
+}
+
+// JoinWAV concatenates WAV files that share the same format into one.
+func JoinWAV(parts [][]byte) ([]byte, error) {
+	var joined *WAV
+	for i, part := range parts {
+		w, err := ParseWAV(part)
+		if err != nil {
+			return nil, fmt.Errorf("part %d: %w", i+1, err)
+		}
+
+		if joined == nil {
+			joined = &WAV{Channels: w.Channels, SampleRate: w.SampleRate, BitsPerSample: w.BitsPerSample, Float: w.Float, format: w.format}
+		} else if w.Channels != joined.Channels || w.SampleRate != joined.SampleRate || w.BitsPerSample != joined.BitsPerSample || w.Float != joined.Float {
+			return nil, fmt.Errorf("part %d has a different audio format", i+1)
+		}
+		joined.Data = append(joined.Data, w.Data...)
+	}
+
+	if joined == nil {
+		return nil, errors.New("nothing to join")
+	}
+	return joined.encode(0, joined.frames()), nil
+}
+
+// PCM16 returns the recording as 16-bit little-endian mono samples at the given rate, the
+// raw format expected by streaming APIs. Channels are averaged and the rate is converted by
+// linear interpolation.
+func (w *WAV) PCM16(sampleRate int) []byte {
+	frames := w.frames()
+	bytesPerSample := w.BitsPerSample / 8
+
+	mono := make([]float64, frames)
+	for f := range mono {
+		frame := w.Data[f*w.frameSize() : (f+1)*w.frameSize()]
+		var sum float64
+		for c := 0; c < w.Channels; c++ {
+			sum += w.sample(frame[c*bytesPerSample : (c+1)*bytesPerSample])
+		}
+		mono[f] = sum / float64(w.Channels)
+	}
+
+	n := int(int64(frames) * int64(sampleRate) / int64(w.SampleRate))
+	out := make([]byte, 0, 2*n)
+	for i := 0; i < n; i++ {
+		pos := float64(i) * float64(w.SampleRate) / float64(sampleRate)
+		j := int(pos)
+		v := mono[j]
+		if j+1 < frames {
+			v += (mono[j+1] - v) * (pos - float64(j))
+		}
+		v = math.Max(-1, math.Min(1, v))
+		out = binary.LittleEndian.AppendUint16(out, uint16(int16(math.Round(v*math.MaxInt16))))
+	}
+	return out
+}
+
+// EncodePCM16 wraps raw 16-bit little-endian samples in a WAV header.
+func EncodePCM16(data []byte, channels, sampleRate int) []byte {
+	format := make([]byte, 16)
+	binary.LittleEndian.PutUint16(format[0:2], formatPCM)
+	binary.LittleEndian.PutUint16(format[2:4], uint16(channels))
+	binary.LittleEndian.PutUint32(format[4:8], uint32(sampleRate))
+	binary.LittleEndian.PutUint32(format[8:12], uint32(sampleRate*channels*2))
+	binary.LittleEndian.PutUint16(format[12:14], uint16(channels*2))
+	binary.LittleEndian.PutUint16(format[14:16], 16)
+
+	w := &WAV{Channels: channels, SampleRate: sampleRate, BitsPerSample: 16, Data: data[:len(data)-len(data)%(2*channels)], format: format}
+	return w.encode(0, w.frames())
+}
@@ -0,0 +1,112 @@
+// Package document converts PDF, DOCX and HTML documents to plain text so they can be
+// used as chat context.
+package document
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+type Kind string
+
+const (
+	KindPDF     Kind = "pdf"
+	KindDOCX    Kind = "docx"
+	KindHTML    Kind = "html"
+	KindImage   Kind = "image"
+	KindText    Kind = "text"
+	KindUnknown Kind = "unknown"
+
+	MimePDF  = "application/pdf"
+	MimeDOCX = "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
+	MimeHTML = "text/html"
+
+	docxBody = "word/document.xml"
+)
+
+// Detect sniffs the content type of data. DOCX files are recognized as zip archives
+// that contain a Word document body. Only whole HTML pages, which open with a doctype or
+// an html element, are reported as HTML; markup snippets are text.
+func Detect(data []byte) Kind {
+	mime := http.DetectContentType(data)
+
+	switch {
+	case strings.HasPrefix(mime, MimePDF):
+		return KindPDF
+	case strings.HasPrefix(mime, "image/"):
+		return KindImage
+	case strings.HasPrefix(mime, "application/zip"):
+		if isDOCX(data) {
+			return KindDOCX
+		}
+	case strings.HasPrefix(mime, "text/"):
+		if isHTMLPage(data) {
+			return KindHTML
+		}
+		return KindText
+	}
+	return KindUnknown
+}
+
+// MimeType returns the MIME type of a document kind.
+func (k Kind) MimeType() string {
+	switch k {
+	case KindPDF:
+		return MimePDF
+	case KindDOCX:
+		return MimeDOCX
+	case KindHTML:
+		return MimeHTML
+	}
+	return ""
+}
+
+// ToText extracts the text of a PDF, DOCX or HTML document.
+func ToText(data []byte) (string, error) {
+	switch kind := Detect(data); kind {
+	case KindPDF:
+		return PDFText(data)
+	case KindDOCX:
+		return DOCXText(data)
+	case KindHTML:
+		return HTMLText(data)
+	default:
+		return "", fmt.Errorf("unsupported document type: %s", http.DetectContentType(data))
+	}
+}
+
+func isHTMLPage(data []byte) bool {
+	head := bytes.TrimLeft(data[:min(len(data), 512)], "\xef\xbb\xbf \t\r\n")
+	head = bytes.ToLower(head)
+	return bytes.HasPrefix(head, []byte("<!doctype html")) || bytes.HasPrefix(head, []byte("<html"))
+}
+
+func isDOCX(data []byte) bool {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return false
+	}
+	for _, f := range zr.File {
+		if f.Name == docxBody {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	trailingSpaceRe = regexp.MustCompile(`[ \t]+\n`)
+	blankLinesRe    = regexp.MustCompile(`\n{3,}`)
+)
+
+// tidy trims trailing whitespace on every line and collapses runs of blank lines.
+func tidy(s string) string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	s = trailingSpaceRe.ReplaceAllString(s, "\n")
+	s = blankLinesRe.ReplaceAllString(s, "\n\n")
+	return strings.TrimSpace(s)
+}
@@ -0,0 +1,215 @@
+package document_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"testing"
+
+	"github.com/kardolus/chatgpt-cli/internal/document"
+	. "github.com/onsi/gomega"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+)
+
+func TestUnitDocument(t *testing.T) {
+	spec.Run(t, "Testing the document converters", testDocument, spec.Report(report.Terminal{}))
+}
+
+// buildPDF lays out objects numbered from 1 the way a PDF writer would; empty strings
+// leave a gap for objects stored in an object stream. The xref table is omitted since
+// readers must cope with it being wrong anyway.
+func buildPDF(objects ...string) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.7\n%\xe2\xe3\xcf\xd3\n")
+	for i, obj := range objects {
+		if obj == "" {
+			continue
+		}
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	buf.WriteString("trailer\n<< /Root 1 0 R >>\n%%EOF\n")
+	return buf.Bytes()
+}
+
+func stream(dict, data string) string {
+	return fmt.Sprintf("<< %s /Length %d >>\nstream\n%s\nendstream", dict, len(data), data)
+}
+
+func deflate(data string) string {
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	_, _ = w.Write([]byte(data))
+	_ = w.Close()
+	return buf.String()
+}
+
+func buildDOCX(body string) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, _ := zw.Create("word/document.xml")
+	_, _ = w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?>` +
+		`<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body>` +
+		body + `</w:body></w:document>`))
+	_ = zw.Close()
+	return buf.Bytes()
+}
+
+func testDocument(t *testing.T, when spec.G, it spec.S) {
+	it.Before(func() {
+		RegisterTestingT(t)
+	})
+
+	when("Detect()", func() {
+		it("recognizes the supported document types", func() {
+			Expect(document.Detect(buildPDF("<< /Type /Catalog >>"))).To(Equal(document.KindPDF))
+			Expect(document.Detect(buildDOCX(""))).To(Equal(document.KindDOCX))
+			Expect(document.Detect([]byte("<!DOCTYPE html><html><body>hi</body></html>"))).To(Equal(document.KindHTML))
+			Expect(document.Detect([]byte("\x89PNG\r\n\x1a\n"))).To(Equal(document.KindImage))
+			Expect(document.Detect([]byte("plain text"))).To(Equal(document.KindText))
+		})
+
+		it("treats markup snippets that are not whole pages as text", func() {
+			Expect(document.Detect([]byte("\xef\xbb\xbf\n<HTML><body>hi</body></HTML>"))).To(Equal(document.KindHTML))
+			Expect(document.Detect([]byte("<p>Why is this paragraph <b>bold</b>?</p>"))).To(Equal(document.KindText))
+			Expect(document.Detect([]byte("<!-- header partial -->\n<div class=\"nav\"></div>"))).To(Equal(document.KindText))
+		})
+
+		it("does not mistake other zip archives for Word documents", func() {
+			var buf bytes.Buffer
+			zw := zip.NewWriter(&buf)
+			_, _ = zw.Create("readme.txt")
+			_ = zw.Close()
+
+			Expect(document.Detect(buf.Bytes())).To(Equal(document.KindUnknown))
+		})
+	})
+
+	when("PDFText()", func() {
+		it("extracts the text of every page in page-tree order", func() {
+			pdf := buildPDF(
+				"<< /Type /Catalog /Pages 2 0 R >>",
+				"<< /Type /Pages /Kids [4 0 R 3 0 R] /Count 2 /Resources << /Font << /F1 5 0 R >> >> >>",
+				"<< /Type /Page /Parent 2 0 R /Contents 6 0 R >>",
+				"<< /Type /Page /Parent 2 0 R /Contents 7 0 R >>",
+				"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>",
+				stream("", "BT /F1 12 Tf 72 700 Td (Second page) Tj ET"),
+				stream("", "BT /F1 12 Tf 72 700 Td (Master Services Agreement) Tj 0 -14 Td [(Term:)-250(12 months)] TJ T* (Fee \\(net\\)) Tj ET"),
+			)
+
+			text, err := document.PDFText(pdf)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(text).To(Equal("Master Services Agreement\nTerm: 12 months\nFee (net)\n\nSecond page"))
+		})
+
+		it("decodes Flate streams, object streams and ToUnicode CMaps", func() {
+			cmap := "/CIDInit /ProcSet findresource begin begincmap\n" +
+				"1 begincodespacerange <0000> <FFFF> endcodespacerange\n" +
+				"1 beginbfchar <0003> <0020> endbfchar\n" +
+				"1 beginbfrange <0010> <0012> <0041> endbfrange\n" +
+				"endcmap end"
+			content := "BT /F1 11 Tf 1 0 0 1 72 720 Tm <001000110012000300100010> Tj 1 0 0 1 72 700 Tm <0012> Tj ET"
+
+			// Objects 3 (page) and 4 (font) live in the object stream.
+			page := "<< /Type /Page /Parent 2 0 R /Contents 6 0 R /Resources << /Font << /F1 4 0 R >> >> >>"
+			font := "<< /Type /Font /Subtype /Type0 /Encoding /Identity-H /ToUnicode 7 0 R >>"
+			header := fmt.Sprintf("3 0 4 %d ", len(page)+1)
+			objStm := header + page + " " + font
+			first := len(header)
+
+			pdf := buildPDF(
+				"<< /Type /Catalog /Pages 2 0 R >>",
+				"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+				"",
+				"",
+				stream(fmt.Sprintf("/Type /ObjStm /N 2 /First %d /Filter /FlateDecode", first), deflate(objStm)),
+				stream("/Filter /FlateDecode", deflate(content)),
+				stream("/Filter [/FlateDecode]", deflate(cmap)),
+			)
+
+			text, err := document.PDFText(pdf)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(text).To(Equal("ABC AA\nC"))
+		})
+
+		it("follows form XObjects", func() {
+			pdf := buildPDF(
+				"<< /Type /Catalog /Pages 2 0 R >>",
+				"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+				"<< /Type /Page /Parent 2 0 R /Contents 4 0 R /Resources << /XObject << /X1 5 0 R >> >> >>",
+				stream("", "q /X1 Do Q"),
+				stream("/Type /XObject /Subtype /Form", "BT (Signed by both parties) Tj ET"),
+			)
+
+			text, err := document.PDFText(pdf)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(text).To(Equal("Signed by both parties"))
+		})
+
+		it("reports PDFs without text", func() {
+			pdf := buildPDF(
+				"<< /Type /Catalog /Pages 2 0 R >>",
+				"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+				"<< /Type /Page /Parent 2 0 R /Contents 4 0 R >>",
+				stream("", "q 100 0 0 100 0 0 cm /Im1 Do Q"),
+			)
+
+			_, err := document.PDFText(pdf)
+			Expect(err).To(MatchError(ContainSubstring("no extractable text")))
+		})
+
+		it("refuses encrypted PDFs", func() {
+			pdf := append(buildPDF("<< /Type /Catalog /Pages 2 0 R >>"), []byte("trailer << /Encrypt 9 0 R >>")...)
+
+			_, err := document.PDFText(pdf)
+			Expect(err).To(MatchError(document.ErrEncryptedPDF))
+		})
+	})
+
+	when("DOCXText()", func() {
+		it("returns one paragraph per line", func() {
+			docx := buildDOCX(`<w:p><w:r><w:t>Section 1.</w:t></w:r><w:r><w:tab/><w:t xml:space="preserve">Definitions </w:t></w:r></w:p>` +
+				`<w:p><w:r><w:t>Line one</w:t><w:br/><w:t>Line two</w:t></w:r></w:p>`)
+
+			text, err := document.DOCXText(docx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(text).To(Equal("Section 1.\tDefinitions\nLine one\nLine two"))
+		})
+	})
+
+	when("HTMLText()", func() {
+		it("keeps the readable text and drops scripts and styles", func() {
+			page := `<html><head><title>t</title><style>p{}</style></head><body>
+				<h1>Contract</h1>
+				<p>The <b>parties</b> agree:</p>
+				<ul><li>to pay</li><li>to deliver</li></ul>
+				<script>alert(1)</script>
+			</body></html>`
+
+			text, err := document.HTMLText([]byte(page))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(text).To(Equal("Contract\n\nThe parties agree:\n\n- to pay\n- to deliver"))
+		})
+
+		it("keeps the space between adjacent inline elements", func() {
+			text, err := document.HTMLText([]byte(`<p><a href="/a">Terms</a> <em>and</em>
+				<b>Conditions</b></p>`))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(text).To(Equal("Terms and Conditions"))
+		})
+	})
+
+	when("ToText()", func() {
+		it("dispatches on the detected type", func() {
+			text, err := document.ToText(buildDOCX(`<w:p><w:r><w:t>hello</w:t></w:r></w:p>`))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(text).To(Equal("hello"))
+		})
+
+		it("rejects unsupported types", func() {
+			_, err := document.ToText([]byte("\x89PNG\r\n\x1a\n"))
+			Expect(err).To(HaveOccurred())
+		})
+	})
+}
@@ -0,0 +1,98 @@
+package document
+
+import (
+	"bytes"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+var (
+	skippedElements = map[string]bool{
+		"script": true, "style": true, "noscript": true, "template": true, "svg": true, "head": true,
+	}
+	blockElements = map[string]bool{
+		"p": true, "div": true, "section": true, "article": true, "header": true, "footer": true,
+		"main": true, "nav": true, "aside": true, "ul": true, "ol": true, "table": true, "tr": true,
+		"blockquote": true, "pre": true, "h1": true, "h2": true, "h3": true, "h4": true, "h5": true,
+		"h6": true, "hr": true, "dl": true, "dt": true, "dd": true, "figure": true, "form": true,
+	}
+)
+
+// HTMLText returns the readable text of an HTML page. Scripts, styles and the head are
+// dropped, block elements start new lines and list items are prefixed with "- ".
+func HTMLText(data []byte) (string, error) {
+	doc, err := html.Parse(bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	var walk func(n *html.Node, pre bool)
+	walk = func(n *html.Node, pre bool) {
+		switch n.Type {
+		case html.TextNode:
+			if pre {
+				sb.WriteString(n.Data)
+				return
+			}
+			text := strings.Join(strings.Fields(n.Data), " ")
+			if text == "" {
+				// Whitespace between two inline elements still separates their words.
+				if n.Data != "" && !atLineStart(&sb) {
+					sb.WriteString(" ")
+				}
+				return
+			}
+			if startsWithSpace(n.Data) && !atLineStart(&sb) {
+				sb.WriteString(" ")
+			}
+			sb.WriteString(text)
+			if endsWithSpace(n.Data) {
+				sb.WriteString(" ")
+			}
+			return
+		case html.ElementNode:
+			if skippedElements[n.Data] {
+				return
+			}
+			switch {
+			case n.Data == "br":
+				sb.WriteString("\n")
+			case n.Data == "li":
+				sb.WriteString("\n- ")
+			case n.Data == "td" || n.Data == "th":
+				sb.WriteString("\t")
+			case blockElements[n.Data]:
+				sb.WriteString("\n\n")
+			}
+			if n.Data == "pre" {
+				pre = true
+			}
+		}
+
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c, pre)
+		}
+
+		if n.Type == html.ElementNode && blockElements[n.Data] {
+			sb.WriteString("\n\n")
+		}
+	}
+	walk(doc, false)
+
+	return tidy(sb.String()), nil
+}
+
+func atLineStart(sb *strings.Builder) bool {
+	s := sb.String()
+	return s == "" || strings.HasSuffix(s, "\n") || strings.HasSuffix(s, " ") || strings.HasSuffix(s, "\t")
+}
+
+func startsWithSpace(s string) bool {
+	return s != "" && strings.TrimLeft(s, " \t\r\n") != s
+}
+
+func endsWithSpace(s string) bool {
+	return s != "" && strings.TrimRight(s, " \t\r\n") != s
+}
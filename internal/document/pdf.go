@@ -0,0 +1,899 @@
+package document
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+const (
+	maxFormDepth     = 8
+	maxPageTreeDepth = 32
+
+	// tjSpaceThreshold is the TJ adjustment (in thousandths of a text space unit) above
+	// which a gap between two strings is rendered as a space.
+	tjSpaceThreshold = 200
+)
+
+var (
+	ErrEncryptedPDF = errors.New("encrypted PDFs are not supported")
+
+	objHeaderRe = regexp.MustCompile(`(\d+)\s+(\d+)\s+obj\b`)
+)
+
+// PDFText extracts the text of a PDF page by page. It handles Flate-compressed and
+// uncompressed content streams, object streams, ToUnicode CMaps and form XObjects.
+// Layout is approximated: text positioned on a new line starts a new line, large gaps
+// become spaces and pages are separated by a blank line.
+func PDFText(data []byte) (string, error) {
+	if !bytes.HasPrefix(bytes.TrimLeft(data, " \t\r\n"), []byte("%PDF-")) {
+		return "", errors.New("not a PDF document")
+	}
+
+	f := parsePDF(data)
+	if f.encrypted {
+		return "", ErrEncryptedPDF
+	}
+
+	pages := f.pages()
+	if len(pages) == 0 {
+		return "", errors.New("no pages found in PDF")
+	}
+
+	var texts []string
+	for _, page := range pages {
+		ex := &textExtractor{file: f, cmaps: map[int]*cmap{}}
+		ex.run(f.contents(page), f.resources(page), 0)
+		if text := tidy(ex.sb.String()); text != "" {
+			texts = append(texts, text)
+		}
+	}
+
+	if len(texts) == 0 {
+		return "", errors.New("the PDF contains no extractable text (it may be a scanned image)")
+	}
+	return strings.Join(texts, "\n\n"), nil
+}
+
+// pdf object model
+
+type pdfName string
+
+type pdfRef int
+
+type pdfKeyword string
+
+type pdfDict map[pdfName]interface{}
+
+type pdfStream struct {
+	dict pdfDict
+	raw  []byte
+}
+
+type pdfFile struct {
+	objects   map[int]interface{}
+	encrypted bool
+}
+
+func parsePDF(data []byte) *pdfFile {
+	f := &pdfFile{objects: map[int]interface{}{}}
+
+	pos := 0
+	for _, m := range objHeaderRe.FindAllSubmatchIndex(data, -1) {
+		if m[0] < pos {
+			continue // inside a stream we already consumed
+		}
+		num, _ := strconv.Atoi(string(data[m[2]:m[3]]))
+
+		lx := &lexer{data: data, pos: m[1]}
+		obj := lx.parseObject()
+
+		if dict, ok := obj.(pdfDict); ok {
+			save := lx.pos
+			if tok := lx.next(); tok == pdfKeyword("stream") {
+				start := lx.pos
+				if start < len(data) && data[start] == '\r' {
+					start++
+				}
+				if start < len(data) && data[start] == '\n' {
+					start++
+				}
+				end := streamEnd(data, start, dict)
+				obj = &pdfStream{dict: dict, raw: data[start:end]}
+				lx.pos = end
+			} else {
+				lx.pos = save
+			}
+		}
+
+		f.objects[num] = obj
+		pos = lx.pos
+	}
+
+	// Objects compressed into object streams (PDF 1.5+).
+	for _, obj := range f.objects {
+		s, ok := obj.(*pdfStream)
+		if !ok || s.dict["Type"] != pdfName("ObjStm") {
+			continue
+		}
+		f.expandObjectStream(s)
+	}
+
+	f.encrypted = bytes.Contains(data, []byte("/Encrypt"))
+	return f
+}
+
+func streamEnd(data []byte, start int, dict pdfDict) int {
+	if n, ok := dict["Length"].(float64); ok {
+		end := start + int(n)
+		if end <= len(data) && bytes.HasPrefix(bytes.TrimLeft(data[end:], " \t\r\n"), []byte("endstream")) {
+			return end
+		}
+	}
+
+	i := bytes.Index(data[start:], []byte("endstream"))
+	if i < 0 {
+		return len(data)
+	}
+	end := start + i
+	if end > start && data[end-1] == '\n' {
+		end--
+	}
+	if end > start && data[end-1] == '\r' {
+		end--
+	}
+	return end
+}
+
+func (f *pdfFile) expandObjectStream(s *pdfStream) {
+	data, err := f.decode(s)
+	if err != nil {
+		return
+	}
+	n, _ := s.dict["N"].(float64)
+	first, _ := s.dict["First"].(float64)
+	if int(first) > len(data) {
+		return
+	}
+
+	header := &lexer{data: data[:int(first)]}
+	for i := 0; i < int(n); i++ {
+		num, ok1 := header.parseObject().(float64)
+		off, ok2 := header.parseObject().(float64)
+		if !ok1 || !ok2 {
+			return
+		}
+		if _, exists := f.objects[int(num)]; exists {
+			continue
+		}
+		start := int(first) + int(off)
+		if start >= len(data) {
+			continue
+		}
+		lx := &lexer{data: data, pos: start}
+		f.objects[int(num)] = lx.parseObject()
+	}
+}
+
+func (f *pdfFile) resolve(v interface{}) interface{} {
+	for i := 0; i < 16; i++ {
+		ref, ok := v.(pdfRef)
+		if !ok {
+			return v
+		}
+		v = f.objects[int(ref)]
+	}
+	return nil
+}
+
+func (f *pdfFile) dict(v interface{}) pdfDict {
+	switch d := f.resolve(v).(type) {
+	case pdfDict:
+		return d
+	case *pdfStream:
+		return d.dict
+	}
+	return nil
+}
+
+func (f *pdfFile) decode(s *pdfStream) ([]byte, error) {
+	var filters []interface{}
+	switch v := f.resolve(s.dict["Filter"]).(type) {
+	case nil:
+		return s.raw, nil
+	case pdfName:
+		filters = []interface{}{v}
+	case []interface{}:
+		filters = v
+	}
+
+	data := s.raw
+	for _, filter := range filters {
+		switch f.resolve(filter) {
+		case pdfName("FlateDecode"), pdfName("Fl"):
+			r, err := zlib.NewReader(bytes.NewReader(data))
+			if err != nil {
+				return nil, err
+			}
+			// Truncated streams are common; keep what could be inflated.
+			out, err := io.ReadAll(r)
+			if err != nil && len(out) == 0 {
+				return nil, err
+			}
+			data = out
+		default:
+			return nil, fmt.Errorf("unsupported stream filter %v", filter)
+		}
+	}
+	return data, nil
+}
+
+// pages returns the page dictionaries in document order, following the page tree from
+// the catalog. Without a usable catalog, pages are returned in object number order.
+func (f *pdfFile) pages() []pdfDict {
+	var pages []pdfDict
+
+	var walk func(node pdfDict, depth int)
+	walk = func(node pdfDict, depth int) {
+		if node == nil || depth > maxPageTreeDepth {
+			return
+		}
+		switch node["Type"] {
+		case pdfName("Page"):
+			pages = append(pages, node)
+		default:
+			kids, _ := f.resolve(node["Kids"]).([]interface{})
+			for _, kid := range kids {
+				walk(f.dict(kid), depth+1)
+			}
+		}
+	}
+
+	nums := make([]int, 0, len(f.objects))
+	for num := range f.objects {
+		nums = append(nums, num)
+	}
+	sort.Ints(nums)
+
+	for _, num := range nums {
+		if d := f.dict(pdfRef(num)); d != nil && d["Type"] == pdfName("Catalog") {
+			walk(f.dict(d["Pages"]), 0)
+			break
+		}
+	}
+
+	if len(pages) == 0 {
+		for _, num := range nums {
+			if d := f.dict(pdfRef(num)); d != nil && d["Type"] == pdfName("Page") {
+				pages = append(pages, d)
+			}
+		}
+	}
+	return pages
+}
+
+// resources returns the resource dictionary of a page, inherited from its ancestors
+// when the page does not define one.
+func (f *pdfFile) resources(page pdfDict) pdfDict {
+	for node, depth := page, 0; node != nil && depth < maxPageTreeDepth; node, depth = f.dict(node["Parent"]), depth+1 {
+		if res := f.dict(node["Resources"]); res != nil {
+			return res
+		}
+	}
+	return nil
+}
+
+func (f *pdfFile) contents(page pdfDict) []byte {
+	var parts []interface{}
+	switch v := f.resolve(page["Contents"]).(type) {
+	case []interface{}:
+		parts = v
+	case *pdfStream:
+		parts = []interface{}{v}
+	}
+
+	var buf bytes.Buffer
+	for _, p := range parts {
+		s, ok := f.resolve(p).(*pdfStream)
+		if !ok {
+			continue
+		}
+		data, err := f.decode(s)
+		if err != nil {
+			continue
+		}
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
+
+// text extraction
+
+type textExtractor struct {
+	file  *pdfFile
+	cmaps map[int]*cmap
+	sb    strings.Builder
+	lastY float64
+	hasY  bool
+}
+
+func (ex *textExtractor) run(content []byte, resources pdfDict, depth int) {
+	var (
+		font     *cmap
+		operands []interface{}
+		lx       = &lexer{data: content}
+	)
+
+	fonts := ex.file.dict(resources["Font"])
+	xobjects := ex.file.dict(resources["XObject"])
+
+	for {
+		obj := lx.parseObject()
+		if obj == nil && lx.eof() {
+			return
+		}
+
+		op, ok := obj.(pdfKeyword)
+		if !ok {
+			operands = append(operands, obj)
+			continue
+		}
+
+		switch op {
+		case "BI":
+			lx.skipInlineImage()
+		case "Tf":
+			if len(operands) >= 2 {
+				if name, ok := operands[0].(pdfName); ok {
+					font = ex.fontCMap(fonts[name])
+				}
+			}
+		case "Td", "TD":
+			if len(operands) >= 2 {
+				tx, _ := operands[0].(float64)
+				ty, _ := operands[1].(float64)
+				if ty != 0 {
+					ex.newline()
+				} else if tx > 0 {
+					ex.space()
+				}
+			}
+		case "Tm":
+			if len(operands) >= 6 {
+				y, _ := operands[5].(float64)
+				if ex.hasY && math.Abs(y-ex.lastY) > 0.5 {
+					ex.newline()
+				} else if ex.hasY {
+					ex.space()
+				}
+				ex.lastY, ex.hasY = y, true
+			}
+		case "T*":
+			ex.newline()
+		case "Tj":
+			if len(operands) >= 1 {
+				ex.show(operands[0], font)
+			}
+		case "'":
+			ex.newline()
+			if len(operands) >= 1 {
+				ex.show(operands[0], font)
+			}
+		case "\"":
+			ex.newline()
+			if len(operands) >= 3 {
+				ex.show(operands[2], font)
+			}
+		case "TJ":
+			if len(operands) >= 1 {
+				items, _ := operands[0].([]interface{})
+				for _, item := range items {
+					if n, ok := item.(float64); ok {
+						if -n > tjSpaceThreshold {
+							ex.space()
+						}
+						continue
+					}
+					ex.show(item, font)
+				}
+			}
+		case "Do":
+			if len(operands) >= 1 && depth < maxFormDepth {
+				if name, ok := operands[0].(pdfName); ok {
+					ex.form(xobjects[name], resources, depth)
+				}
+			}
+		}
+		operands = operands[:0]
+	}
+}
+
+func (ex *textExtractor) form(ref interface{}, parent pdfDict, depth int) {
+	s, ok := ex.file.resolve(ref).(*pdfStream)
+	if !ok || s.dict["Subtype"] != pdfName("Form") {
+		return
+	}
+	data, err := ex.file.decode(s)
+	if err != nil {
+		return
+	}
+	res := ex.file.dict(s.dict["Resources"])
+	if res == nil {
+		res = parent
+	}
+	ex.run(data, res, depth+1)
+}
+
+func (ex *textExtractor) show(v interface{}, font *cmap) {
+	s, ok := v.(pdfString)
+	if !ok {
+		return
+	}
+	ex.sb.WriteString(font.decode([]byte(s)))
+}
+
+func (ex *textExtractor) newline() {
+	if ex.sb.Len() > 0 && !strings.HasSuffix(ex.sb.String(), "\n") {
+		ex.sb.WriteString("\n")
+	}
+}
+
+func (ex *textExtractor) space() {
+	s := ex.sb.String()
+	if s != "" && !strings.HasSuffix(s, " ") && !strings.HasSuffix(s, "\n") {
+		ex.sb.WriteString(" ")
+	}
+}
+
+func (ex *textExtractor) fontCMap(ref interface{}) *cmap {
+	num := -1
+	if r, ok := ref.(pdfRef); ok {
+		num = int(r)
+		if cm, ok := ex.cmaps[num]; ok {
+			return cm
+		}
+	}
+
+	var cm *cmap
+	if font := ex.file.dict(ref); font != nil {
+		if s, ok := ex.file.resolve(font["ToUnicode"]).(*pdfStream); ok {
+			if data, err := ex.file.decode(s); err == nil {
+				cm = parseCMap(data)
+			}
+		}
+		if cm == nil && strings.HasPrefix(string(pdfNameOf(font["Encoding"])), "Identity") {
+			cm = &cmap{codeLen: 2, chars: map[uint32]string{}}
+		}
+	}
+
+	if num >= 0 {
+		ex.cmaps[num] = cm
+	}
+	return cm
+}
+
+func pdfNameOf(v interface{}) pdfName {
+	n, _ := v.(pdfName)
+	return n
+}
+
+// cmap maps character codes to Unicode text, as described by a ToUnicode stream.
+type cmap struct {
+	codeLen int
+	chars   map[uint32]string
+}
+
+func parseCMap(data []byte) *cmap {
+	cm := &cmap{codeLen: 1, chars: map[uint32]string{}}
+	lx := &lexer{data: data}
+
+	var operands []interface{}
+	for {
+		obj := lx.parseObject()
+		if obj == nil && lx.eof() {
+			break
+		}
+
+		kw, ok := obj.(pdfKeyword)
+		if !ok {
+			operands = append(operands, obj)
+			continue
+		}
+
+		switch kw {
+		case "endcodespacerange":
+			if len(operands) >= 1 {
+				if s, ok := operands[0].(pdfString); ok && len(s) > 0 {
+					cm.codeLen = len(s)
+				}
+			}
+		case "endbfchar":
+			for i := 0; i+1 < len(operands); i += 2 {
+				src, ok1 := operands[i].(pdfString)
+				dst, ok2 := operands[i+1].(pdfString)
+				if ok1 && ok2 {
+					cm.chars[codeOf(src)] = utf16BE(dst)
+				}
+			}
+		case "endbfrange":
+			for i := 0; i+2 < len(operands); i += 3 {
+				lo, ok1 := operands[i].(pdfString)
+				hi, ok2 := operands[i+1].(pdfString)
+				if ok1 && ok2 {
+					cm.addRange(codeOf(lo), codeOf(hi), operands[i+2])
+				}
+			}
+		}
+		operands = operands[:0]
+	}
+
+	return cm
+}
+
+func (cm *cmap) addRange(lo, hi uint32, dst interface{}) {
+	if hi < lo || hi-lo > 0xFFFF {
+		return
+	}
+	switch d := dst.(type) {
+	case pdfString:
+		base := []rune(utf16BE(d))
+		if len(base) == 0 {
+			return
+		}
+		for code := lo; code <= hi; code++ {
+			r := append([]rune(nil), base...)
+			r[len(r)-1] += rune(code - lo)
+			cm.chars[code] = string(r)
+		}
+	case []interface{}:
+		for i, item := range d {
+			if s, ok := item.(pdfString); ok && lo+uint32(i) <= hi {
+				cm.chars[lo+uint32(i)] = utf16BE(s)
+			}
+		}
+	}
+}
+
+func (cm *cmap) decode(b []byte) string {
+	if cm == nil {
+		return decodePDFDocString(b)
+	}
+
+	var sb strings.Builder
+	for i := 0; i+cm.codeLen <= len(b); i += cm.codeLen {
+		code := codeOf(b[i : i+cm.codeLen])
+		if s, ok := cm.chars[code]; ok {
+			sb.WriteString(s)
+		} else if cm.codeLen == 1 {
+			sb.WriteRune(rune(code))
+		}
+	}
+	return sb.String()
+}
+
+func codeOf(b []byte) uint32 {
+	var code uint32
+	for _, c := range b {
+		code = code<<8 | uint32(c)
+	}
+	return code
+}
+
+func utf16BE(b []byte) string {
+	if len(b)%2 != 0 {
+		return string(b)
+	}
+	u := make([]uint16, 0, len(b)/2)
+	for i := 0; i+1 < len(b); i += 2 {
+		u = append(u, uint16(b[i])<<8|uint16(b[i+1]))
+	}
+	return string(utf16.Decode(u))
+}
+
+// decodePDFDocString decodes text strings that have no font mapping: UTF-16 when the
+// string starts with a byte order mark, otherwise Latin-1 as an approximation of
+// PDFDocEncoding.
+func decodePDFDocString(b []byte) string {
+	if len(b) >= 2 && b[0] == 0xFE && b[1] == 0xFF {
+		return utf16BE(b[2:])
+	}
+	r := make([]rune, len(b))
+	for i, c := range b {
+		r[i] = rune(c)
+	}
+	return string(r)
+}
+
+// lexer
+
+type pdfString []byte
+
+type lexer struct {
+	data []byte
+	pos  int
+}
+
+func (lx *lexer) eof() bool {
+	lx.skipSpace()
+	return lx.pos >= len(lx.data)
+}
+
+func (lx *lexer) skipSpace() {
+	for lx.pos < len(lx.data) {
+		c := lx.data[lx.pos]
+		if isPDFSpace(c) {
+			lx.pos++
+			continue
+		}
+		if c == '%' {
+			for lx.pos < len(lx.data) && lx.data[lx.pos] != '\n' && lx.data[lx.pos] != '\r' {
+				lx.pos++
+			}
+			continue
+		}
+		return
+	}
+}
+
+// next returns the next token: a number, name, string, keyword or one of the
+// delimiters "[", "]", "<<", ">>" as keywords.
+func (lx *lexer) next() interface{} {
+	lx.skipSpace()
+	if lx.pos >= len(lx.data) {
+		return nil
+	}
+
+	c := lx.data[lx.pos]
+	switch {
+	case c == '/':
+		lx.pos++
+		start := lx.pos
+		for lx.pos < len(lx.data) && !isPDFSpace(lx.data[lx.pos]) && !isPDFDelim(lx.data[lx.pos]) {
+			lx.pos++
+		}
+		return pdfName(decodeName(lx.data[start:lx.pos]))
+	case c == '(':
+		return lx.literalString()
+	case c == '<':
+		if lx.pos+1 < len(lx.data) && lx.data[lx.pos+1] == '<' {
+			lx.pos += 2
+			return pdfKeyword("<<")
+		}
+		return lx.hexString()
+	case c == '>':
+		if lx.pos+1 < len(lx.data) && lx.data[lx.pos+1] == '>' {
+			lx.pos += 2
+			return pdfKeyword(">>")
+		}
+		lx.pos++
+		return lx.next()
+	case c == '[' || c == ']' || c == '{' || c == '}':
+		lx.pos++
+		return pdfKeyword(string(c))
+	case c == ')':
+		lx.pos++
+		return lx.next()
+	case c == '+' || c == '-' || c == '.' || (c >= '0' && c <= '9'):
+		start := lx.pos
+		lx.pos++
+		for lx.pos < len(lx.data) && (lx.data[lx.pos] == '.' || (lx.data[lx.pos] >= '0' && lx.data[lx.pos] <= '9')) {
+			lx.pos++
+		}
+		n, err := strconv.ParseFloat(string(lx.data[start:lx.pos]), 64)
+		if err != nil {
+			return float64(0)
+		}
+		return n
+	default:
+		start := lx.pos
+		for lx.pos < len(lx.data) && !isPDFSpace(lx.data[lx.pos]) && !isPDFDelim(lx.data[lx.pos]) {
+			lx.pos++
+		}
+		if lx.pos == start {
+			lx.pos++
+		}
+		return pdfKeyword(lx.data[start:lx.pos])
+	}
+}
+
+// parseObject reads a complete object: arrays and dictionaries are assembled, and
+// "n g R" sequences become references.
+func (lx *lexer) parseObject() interface{} {
+	tok := lx.next()
+
+	switch t := tok.(type) {
+	case float64:
+		save := lx.pos
+		if gen, ok := lx.next().(float64); ok && gen == math.Trunc(gen) && t == math.Trunc(t) {
+			if lx.next() == pdfKeyword("R") {
+				return pdfRef(int(t))
+			}
+		}
+		lx.pos = save
+		return t
+	case pdfKeyword:
+		switch t {
+		case "[":
+			var arr []interface{}
+			for !lx.eof() {
+				save := lx.pos
+				if lx.next() == pdfKeyword("]") {
+					return arr
+				}
+				lx.pos = save
+				arr = append(arr, lx.parseObject())
+			}
+			return arr
+		case "<<":
+			dict := pdfDict{}
+			for !lx.eof() {
+				key := lx.next()
+				if key == pdfKeyword(">>") {
+					return dict
+				}
+				name, ok := key.(pdfName)
+				if !ok {
+					continue
+				}
+				dict[name] = lx.parseObject()
+			}
+			return dict
+		case "true":
+			return true
+		case "false":
+			return false
+		case "null":
+			return nil
+		}
+	}
+	return tok
+}
+
+func (lx *lexer) literalString() pdfString {
+	lx.pos++ // (
+	var out []byte
+	depth := 1
+
+	for lx.pos < len(lx.data) {
+		c := lx.data[lx.pos]
+		lx.pos++
+
+		switch c {
+		case '(':
+			depth++
+			out = append(out, c)
+		case ')':
+			depth--
+			if depth == 0 {
+				return out
+			}
+			out = append(out, c)
+		case '\\':
+			if lx.pos >= len(lx.data) {
+				return out
+			}
+			e := lx.data[lx.pos]
+			lx.pos++
+			switch e {
+			case 'n':
+				out = append(out, '\n')
+			case 'r':
+				out = append(out, '\r')
+			case 't':
+				out = append(out, '\t')
+			case 'b':
+				out = append(out, '\b')
+			case 'f':
+				out = append(out, '\f')
+			case '\r':
+				if lx.pos < len(lx.data) && lx.data[lx.pos] == '\n' {
+					lx.pos++
+				}
+			case '\n':
+			default:
+				if e >= '0' && e <= '7' {
+					n := int(e - '0')
+					for i := 0; i < 2 && lx.pos < len(lx.data) && lx.data[lx.pos] >= '0' && lx.data[lx.pos] <= '7'; i++ {
+						n = n*8 + int(lx.data[lx.pos]-'0')
+						lx.pos++
+					}
+					out = append(out, byte(n))
+				} else {
+					out = append(out, e)
+				}
+			}
+		default:
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+func (lx *lexer) hexString() pdfString {
+	lx.pos++ // <
+	var digits []byte
+	for lx.pos < len(lx.data) && lx.data[lx.pos] != '>' {
+		if c := lx.data[lx.pos]; isHex(c) {
+			digits = append(digits, c)
+		}
+		lx.pos++
+	}
+	lx.pos++ // >
+
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	out := make([]byte, len(digits)/2)
+	for i := range out {
+		out[i] = hexVal(digits[2*i])<<4 | hexVal(digits[2*i+1])
+	}
+	return out
+}
+
+// skipInlineImage moves past the binary data of an inline image (BI ... ID data EI).
+func (lx *lexer) skipInlineImage() {
+	i := bytes.Index(lx.data[lx.pos:], []byte("ID"))
+	if i < 0 {
+		lx.pos = len(lx.data)
+		return
+	}
+	lx.pos += i + 2
+	for lx.pos+2 < len(lx.data) {
+		if isPDFSpace(lx.data[lx.pos]) && lx.data[lx.pos+1] == 'E' && lx.data[lx.pos+2] == 'I' &&
+			(lx.pos+3 == len(lx.data) || isPDFSpace(lx.data[lx.pos+3])) {
+			lx.pos += 3
+			return
+		}
+		lx.pos++
+	}
+	lx.pos = len(lx.data)
+}
+
+func decodeName(b []byte) string {
+	if !bytes.Contains(b, []byte("#")) {
+		return string(b)
+	}
+	var out []byte
+	for i := 0; i < len(b); i++ {
+		if b[i] == '#' && i+2 < len(b) && isHex(b[i+1]) && isHex(b[i+2]) {
+			out = append(out, hexVal(b[i+1])<<4|hexVal(b[i+2]))
+			i += 2
+			continue
+		}
+		out = append(out, b[i])
+	}
+	return string(out)
+}
+
+func isPDFSpace(c byte) bool {
+	return c == ' ' || c == '\n' || c == '\r' || c == '\t' || c == '\f' || c == 0
+}
+
+func isPDFDelim(c byte) bool {
+	return strings.IndexByte("()<>[]{}/%", c) >= 0
+}
+
+func isHex(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+func hexVal(c byte) byte {
+	switch {
+	case c >= '0' && c <= '9':
+		return c - '0'
+	case c >= 'a' && c <= 'f':
+		return c - 'a' + 10
+	case c >= 'A' && c <= 'F':
+		return c - 'A' + 10
+	}
+	return 0
+}
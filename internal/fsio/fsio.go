@@ -1,6 +1,10 @@
 package fsio
 
-import "os"
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+)
 
 const DefaultBufferSize = 512
 
@@ -8,11 +12,17 @@ type Reader interface {
 	Open(name string) (*os.File, error)
 	ReadFile(name string) ([]byte, error)
 	ReadBufferFromFile(file *os.File) ([]byte, error)
+	Stat(name string) (os.FileInfo, error)
+	Lstat(name string) (os.FileInfo, error)
+	WalkDir(root string, fn fs.WalkDirFunc) error
 }
 
 type Writer interface {
 	Create(name string) (*os.File, error)
 	Write(file *os.File, buf []byte) error
+	MkdirAll(path string, perm os.FileMode) error
+	Rename(oldpath, newpath string) error
+	Remove(name string) error
 }
 
 type RealReader struct {
@@ -33,6 +43,12 @@ func (r *RealReader) ReadBufferFromFile(file *os.File) ([]byte, error) {
 	return buf, err
 }
 
+func (r *RealReader) Stat(name string) (os.FileInfo, error) { return os.Stat(name) }
+
+func (r *RealReader) Lstat(name string) (os.FileInfo, error) { return os.Lstat(name) }
+
+func (r *RealReader) WalkDir(root string, fn fs.WalkDirFunc) error { return filepath.WalkDir(root, fn) }
+
 type RealWriter struct{}
 
 func (w *RealWriter) Create(name string) (*os.File, error) { return os.Create(name) }
@@ -41,3 +57,9 @@ func (w *RealWriter) Write(file *os.File, buf []byte) error {
 	_, err := file.Write(buf)
 	return err
 }
+
+func (w *RealWriter) MkdirAll(path string, perm os.FileMode) error { return os.MkdirAll(path, perm) }
+
+func (w *RealWriter) Rename(oldpath, newpath string) error { return os.Rename(oldpath, newpath) }
+
+func (w *RealWriter) Remove(name string) error { return os.Remove(name) }
@@ -0,0 +1,181 @@
+package markdown
+
+import (
+	"strings"
+	"unicode"
+)
+
+// language describes just enough of a language to colour a single line: its keywords
+// and line-comment markers. Block comments are not tracked across lines.
+type language struct {
+	keywords map[string]bool
+	comments []string
+}
+
+var languages = map[string]language{
+	"go": {
+		keywords: words("break case chan const continue default defer else fallthrough for func go goto if import interface map package range return select struct switch type var nil true false"),
+		comments: []string{"//"},
+	},
+	"python": {
+		keywords: words("and as assert async await break class continue def del elif else except finally for from global if import in is lambda nonlocal not or pass raise return try while with yield None True False self"),
+		comments: []string{"#"},
+	},
+	"javascript": {
+		keywords: words("async await break case catch class const continue default delete do else export extends finally for function if import in instanceof let new of return static super switch this throw try typeof var void while yield null undefined true false interface type enum implements"),
+		comments: []string{"//"},
+	},
+	"shell": {
+		keywords: words("if then else elif fi for while until do done case esac in function return local export echo exit set unset source"),
+		comments: []string{"#"},
+	},
+	"java": {
+		keywords: words("abstract boolean break byte case catch char class const continue default do double else enum extends final finally float for if implements import instanceof int interface long new package private protected public return short static super switch synchronized this throw throws try void volatile while null true false var record"),
+		comments: []string{"//"},
+	},
+	"c": {
+		keywords: words("auto break case char const continue default do double else enum extern float for goto if inline int long register return short signed sizeof static struct switch typedef union unsigned void volatile while class namespace template typename public private protected virtual new delete nullptr true false using"),
+		comments: []string{"//"},
+	},
+	"rust": {
+		keywords: words("as async await break const continue crate else enum extern false fn for if impl in let loop match mod move mut pub ref return self Self static struct super trait true type unsafe use where while"),
+		comments: []string{"//"},
+	},
+	"ruby": {
+		keywords: words("alias and begin break case class def defined do else elsif end ensure false for if in module next nil not or redo rescue retry return self super then true undef unless until when while yield require"),
+		comments: []string{"#"},
+	},
+	"sql": {
+		keywords: words("select from where and or not insert into values update set delete create table drop alter index join left right inner outer on group by order having limit offset as distinct null is in like union all primary key foreign references SELECT FROM WHERE AND OR NOT INSERT INTO VALUES UPDATE SET DELETE CREATE TABLE DROP ALTER INDEX JOIN LEFT RIGHT INNER OUTER ON GROUP BY ORDER HAVING LIMIT OFFSET AS DISTINCT NULL IS IN LIKE UNION ALL PRIMARY KEY FOREIGN REFERENCES"),
+		comments: []string{"--"},
+	},
+	"yaml": {
+		keywords: words("true false null yes no"),
+		comments: []string{"#"},
+	},
+	"json": {
+		keywords: words("true false null"),
+	},
+}
+
+var languageAliases = map[string]string{
+	"golang":     "go",
+	"py":         "python",
+	"python3":    "python",
+	"js":         "javascript",
+	"jsx":        "javascript",
+	"ts":         "javascript",
+	"tsx":        "javascript",
+	"typescript": "javascript",
+	"sh":         "shell",
+	"bash":       "shell",
+	"zsh":        "shell",
+	"console":    "shell",
+	"kotlin":     "java",
+	"scala":      "java",
+	"cpp":        "c",
+	"c++":        "c",
+	"cs":         "c",
+	"csharp":     "c",
+	"h":          "c",
+	"rs":         "rust",
+	"rb":         "ruby",
+	"yml":        "yaml",
+	"toml":       "yaml",
+}
+
+// genericLanguage is used for untagged or unknown fences.
+var genericLanguage = language{
+	keywords: words("if else for while return func function def class import package const var let true false null nil None try catch switch case break continue new struct type interface"),
+	comments: []string{"//"},
+}
+
+func words(s string) map[string]bool {
+	out := map[string]bool{}
+	for _, w := range strings.Fields(s) {
+		out[w] = true
+	}
+	return out
+}
+
+func lookupLanguage(name string) language {
+	if alias, ok := languageAliases[name]; ok {
+		name = alias
+	}
+	if lang, ok := languages[name]; ok {
+		return lang
+	}
+	return genericLanguage
+}
+
+// highlight colours keywords, strings, numbers and line comments in a single line of code.
+func highlight(line, lang string) string {
+	l := lookupLanguage(lang)
+	runes := []rune(line)
+
+	var sb strings.Builder
+	for i := 0; i < len(runes); {
+		rest := string(runes[i:])
+
+		if isComment(rest, l.comments) {
+			sb.WriteString(ansiComment + rest + ansiReset)
+			break
+		}
+
+		r := runes[i]
+		switch {
+		case r == '"' || r == '\'' || r == '`':
+			j := i + 1
+			for j < len(runes) && runes[j] != r {
+				if runes[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(runes) {
+				j = len(runes) - 1
+			}
+			sb.WriteString(ansiString + string(runes[i:j+1]) + ansiReset)
+			i = j + 1
+
+		case unicode.IsDigit(r) && (i == 0 || !isIdent(runes[i-1])):
+			j := i
+			for j < len(runes) && (isIdent(runes[j]) || runes[j] == '.') {
+				j++
+			}
+			sb.WriteString(ansiNumber + string(runes[i:j]) + ansiReset)
+			i = j
+
+		case isIdent(r):
+			j := i
+			for j < len(runes) && isIdent(runes[j]) {
+				j++
+			}
+			word := string(runes[i:j])
+			if l.keywords[word] {
+				sb.WriteString(ansiKeyword + word + ansiReset)
+			} else {
+				sb.WriteString(word)
+			}
+			i = j
+
+		default:
+			sb.WriteRune(r)
+			i++
+		}
+	}
+	return sb.String()
+}
+
+func isComment(s string, markers []string) bool {
+	for _, m := range markers {
+		if strings.HasPrefix(s, m) {
+			return true
+		}
+	}
+	return false
+}
+
+func isIdent(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
@@ -0,0 +1,364 @@
+package markdown
+
+import (
+	"bytes"
+	"io"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	DefaultWidth = 80
+
+	ansiReset     = "\033[0m"
+	ansiBold      = "\033[1m"
+	ansiDim       = "\033[2m"
+	ansiItalic    = "\033[3m"
+	ansiUnderline = "\033[4m"
+	ansiHeading   = "\033[1;36m"
+	ansiCode      = "\033[36m"
+	ansiKeyword   = "\033[35m"
+	ansiString    = "\033[32m"
+	ansiNumber    = "\033[33m"
+	ansiComment   = "\033[90m"
+)
+
+type blockKind int
+
+const (
+	blockNone blockKind = iota
+	blockParagraph
+	blockTable
+	blockFence
+)
+
+var (
+	reANSI      = regexp.MustCompile(`\x1b\[[0-9;]*m`)
+	reHeading   = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*\s*$`)
+	reListItem  = regexp.MustCompile(`^(\s*)([-*+]|\d+[.)])\s+(.*)$`)
+	reRule      = regexp.MustCompile(`^\s*([-*_])(\s*([-*_]))*\s*$`)
+	reBold      = regexp.MustCompile(`\*\*([^*]+)\*\*|__([^_]+)__`)
+	reItalic    = regexp.MustCompile(`(^|[^*\w])\*([^*\s][^*]*)\*`)
+	reLink      = regexp.MustCompile(`\[([^\]\x1b]+)\]\(([^)\s]+)\)`)
+	reTableRule = regexp.MustCompile(`^:?-+:?$`)
+)
+
+// Renderer is an io.Writer that renders markdown for a terminal as it arrives. Only
+// the current block is buffered: paragraphs and tables are emitted once they end,
+// everything else (headings, list items, code lines) as soon as the line is complete.
+// Call Flush at the end of a response to emit whatever is still buffered.
+type Renderer struct {
+	out     io.Writer
+	width   int
+	partial []byte
+	block   blockKind
+	lines   []string
+	fence   string
+	lang    string
+}
+
+func NewRenderer(out io.Writer, width int) *Renderer {
+	if width <= 0 {
+		width = DefaultWidth
+	}
+	return &Renderer{out: out, width: width}
+}
+
+// Render renders a complete markdown document.
+func Render(s string, width int) string {
+	var buf bytes.Buffer
+	r := NewRenderer(&buf, width)
+	_, _ = r.Write([]byte(s))
+	_ = r.Flush()
+	return buf.String()
+}
+
+func (r *Renderer) Write(p []byte) (int, error) {
+	r.partial = append(r.partial, p...)
+
+	for {
+		i := bytes.IndexByte(r.partial, '\n')
+		if i < 0 {
+			break
+		}
+		line := strings.TrimSuffix(string(r.partial[:i]), "\r")
+		r.partial = r.partial[i+1:]
+
+		if err := r.processLine(line); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(p), nil
+}
+
+// Flush renders any incomplete line and open block, and resets the renderer so it
+// can be reused for the next response.
+func (r *Renderer) Flush() error {
+	if len(r.partial) > 0 {
+		line := string(r.partial)
+		r.partial = nil
+		if err := r.processLine(line); err != nil {
+			return err
+		}
+	}
+
+	err := r.flushBlock()
+	r.block = blockNone
+	r.fence, r.lang = "", ""
+	return err
+}
+
+func (r *Renderer) processLine(line string) error {
+	trimmed := strings.TrimSpace(line)
+
+	if r.block == blockFence {
+		if strings.HasPrefix(trimmed, r.fence) && strings.Trim(trimmed, r.fence[:1]) == "" {
+			r.block = blockNone
+			return r.emit(ansiDim + line + ansiReset)
+		}
+		return r.emit(highlight(line, r.lang))
+	}
+
+	if r.block == blockTable {
+		if strings.HasPrefix(trimmed, "|") {
+			r.lines = append(r.lines, trimmed)
+			return nil
+		}
+		if err := r.flushBlock(); err != nil {
+			return err
+		}
+	}
+
+	if fence, lang, ok := parseFence(trimmed); ok {
+		if err := r.flushBlock(); err != nil {
+			return err
+		}
+		r.block, r.fence, r.lang = blockFence, fence, lang
+		return r.emit(ansiDim + line + ansiReset)
+	}
+
+	if trimmed == "" {
+		if err := r.flushBlock(); err != nil {
+			return err
+		}
+		return r.emit("")
+	}
+
+	if strings.HasPrefix(trimmed, "|") {
+		if err := r.flushBlock(); err != nil {
+			return err
+		}
+		r.block = blockTable
+		r.lines = append(r.lines, trimmed)
+		return nil
+	}
+
+	if m := reHeading.FindStringSubmatch(trimmed); m != nil {
+		if err := r.flushBlock(); err != nil {
+			return err
+		}
+		style := ansiHeading
+		if len(m[1]) == 1 {
+			style += ansiUnderline
+		}
+		return r.emit(style + inline(m[2], style) + ansiReset)
+	}
+
+	if len(trimmed) >= 3 && reRule.MatchString(trimmed) {
+		if err := r.flushBlock(); err != nil {
+			return err
+		}
+		return r.emit(ansiDim + strings.Repeat("─", r.width) + ansiReset)
+	}
+
+	if m := reListItem.FindStringSubmatch(line); m != nil {
+		if err := r.flushBlock(); err != nil {
+			return err
+		}
+		bullet := m[2]
+		if !strings.ContainsAny(bullet[len(bullet)-1:], ".)") {
+			bullet = "•"
+		}
+		prefix := m[1] + bullet + " "
+		return r.emit(wrap(inline(m[3], ""), r.width, prefix, strings.Repeat(" ", visibleLen(prefix))))
+	}
+
+	if strings.HasPrefix(trimmed, ">") {
+		if err := r.flushBlock(); err != nil {
+			return err
+		}
+		text := strings.TrimSpace(strings.TrimPrefix(trimmed, ">"))
+		bar := ansiDim + "│ " + ansiReset
+		return r.emit(wrap(ansiItalic+inline(text, ansiItalic)+ansiReset, r.width, bar, bar))
+	}
+
+	r.block = blockParagraph
+	r.lines = append(r.lines, trimmed)
+	return nil
+}
+
+func (r *Renderer) flushBlock() error {
+	lines := r.lines
+	kind := r.block
+	r.lines = nil
+	if kind != blockFence {
+		r.block = blockNone
+	}
+
+	switch kind {
+	case blockParagraph:
+		return r.emit(wrap(inline(strings.Join(lines, " "), ""), r.width, "", ""))
+	case blockTable:
+		return r.emit(renderTable(lines))
+	}
+	return nil
+}
+
+func (r *Renderer) emit(s string) error {
+	_, err := io.WriteString(r.out, s+"\n")
+	return err
+}
+
+func parseFence(trimmed string) (fence, lang string, ok bool) {
+	for _, marker := range []string{"```", "~~~"} {
+		if strings.HasPrefix(trimmed, marker) {
+			n := len(trimmed) - len(strings.TrimLeft(trimmed, marker[:1]))
+			info := strings.Fields(trimmed[n:])
+			if len(info) > 0 {
+				lang = strings.ToLower(info[0])
+			}
+			return trimmed[:n], lang, true
+		}
+	}
+	return "", "", false
+}
+
+// inline applies bold, italic, link and code-span styling. restore is re-emitted after
+// each styled span so that an enclosing style (e.g. a heading) continues.
+func inline(s, restore string) string {
+	parts := strings.Split(s, "`")
+	// an unmatched backtick is rendered literally
+	if len(parts)%2 == 0 {
+		parts[len(parts)-2] += "`" + parts[len(parts)-1]
+		parts = parts[:len(parts)-1]
+	}
+
+	var sb strings.Builder
+	for i, part := range parts {
+		if i%2 == 1 {
+			sb.WriteString(ansiCode + part + ansiReset + restore)
+			continue
+		}
+		part = reLink.ReplaceAllString(part, ansiUnderline+"${1}"+ansiReset+restore+" "+ansiDim+"(${2})"+ansiReset+restore)
+		part = reBold.ReplaceAllStringFunc(part, func(m string) string {
+			sub := reBold.FindStringSubmatch(m)
+			return ansiBold + sub[1] + sub[2] + ansiReset + restore
+		})
+		part = reItalic.ReplaceAllString(part, "${1}"+ansiItalic+"${2}"+ansiReset+restore)
+		sb.WriteString(part)
+	}
+	return sb.String()
+}
+
+// wrap word-wraps s to width visible columns. ANSI sequences do not count towards the
+// width and stay attached to their words.
+func wrap(s string, width int, first, rest string) string {
+	words := strings.Fields(s)
+	if len(words) == 0 {
+		return first
+	}
+
+	var (
+		sb      strings.Builder
+		lineLen = visibleLen(first)
+		empty   = true
+	)
+	sb.WriteString(first)
+
+	for _, w := range words {
+		wl := visibleLen(w)
+		if !empty && lineLen+1+wl > width {
+			sb.WriteString("\n" + rest)
+			lineLen = visibleLen(rest)
+			empty = true
+		}
+		if !empty {
+			sb.WriteByte(' ')
+			lineLen++
+		}
+		sb.WriteString(w)
+		lineLen += wl
+		empty = false
+	}
+	return sb.String()
+}
+
+func renderTable(lines []string) string {
+	var rows [][]string
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		line = strings.TrimPrefix(line, "|")
+		line = strings.TrimSuffix(line, "|")
+
+		cells := strings.Split(line, "|")
+		isRule := true
+		for i, c := range cells {
+			cells[i] = strings.TrimSpace(c)
+			if !reTableRule.MatchString(cells[i]) {
+				isRule = false
+			}
+		}
+		if isRule {
+			continue
+		}
+		for i, c := range cells {
+			cells[i] = inline(c, "")
+		}
+		rows = append(rows, cells)
+	}
+
+	var widths []int
+	for _, row := range rows {
+		for i, c := range row {
+			if i >= len(widths) {
+				widths = append(widths, 0)
+			}
+			if l := visibleLen(c); l > widths[i] {
+				widths[i] = l
+			}
+		}
+	}
+
+	sep := ansiDim + " │ " + ansiReset
+	var out []string
+	for n, row := range rows {
+		cells := make([]string, len(widths))
+		for i := range widths {
+			var c string
+			if i < len(row) {
+				c = row[i]
+			}
+			c += strings.Repeat(" ", widths[i]-visibleLen(c))
+			if n == 0 {
+				c = ansiBold + c + ansiReset
+			}
+			cells[i] = c
+		}
+		out = append(out, strings.TrimRight(strings.Join(cells, sep), " "))
+
+		if n == 0 && len(rows) > 1 {
+			rules := make([]string, len(widths))
+			for i, w := range widths {
+				rules[i] = strings.Repeat("─", w)
+			}
+			out = append(out, ansiDim+strings.Join(rules, "─┼─")+ansiReset)
+		}
+	}
+	return strings.Join(out, "\n")
+}
+
+func visibleLen(s string) int {
+	return utf8.RuneCountInString(reANSI.ReplaceAllString(s, ""))
+}
@@ -0,0 +1,120 @@
+package markdown_test
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/kardolus/chatgpt-cli/internal/markdown"
+	. "github.com/onsi/gomega"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+)
+
+func TestUnitMarkdown(t *testing.T) {
+	spec.Run(t, "Testing the markdown renderer", testMarkdown, spec.Report(report.Terminal{}))
+}
+
+var reANSI = regexp.MustCompile(`\x1b\[[0-9;]*m`)
+
+func plain(s string) string {
+	return reANSI.ReplaceAllString(s, "")
+}
+
+func testMarkdown(t *testing.T, when spec.G, it spec.S) {
+	it.Before(func() {
+		RegisterTestingT(t)
+	})
+
+	when("Render()", func() {
+		it("styles headings and strips the markers", func() {
+			out := markdown.Render("# Title\n## Sub\n", 80)
+			Expect(plain(out)).To(Equal("Title\nSub\n"))
+			Expect(out).To(ContainSubstring("\033[1;36m"))
+		})
+
+		it("wraps paragraphs to the given width", func() {
+			out := markdown.Render("one two three\nfour five six\n", 10)
+			Expect(plain(out)).To(Equal("one two\nthree four\nfive six\n"))
+		})
+
+		it("does not count ANSI sequences towards the width", func() {
+			out := markdown.Render("**bold** word here\n", 14)
+			Expect(plain(out)).To(Equal("bold word here\n"))
+		})
+
+		it("renders inline code, bold, italic and links", func() {
+			out := markdown.Render("use `x*y*z` with **care**, *really*, see [docs](http://d)\n", 200)
+			Expect(plain(out)).To(Equal("use x*y*z with care, really, see docs (http://d)\n"))
+			Expect(out).To(ContainSubstring("\033[36mx*y*z\033[0m"))
+			Expect(out).To(ContainSubstring("\033[1mcare\033[0m"))
+			Expect(out).To(ContainSubstring("\033[3mreally\033[0m"))
+		})
+
+		it("renders list items with bullets and hanging indent", func() {
+			out := markdown.Render("- alpha beta gamma\n2. second\n", 12)
+			Expect(plain(out)).To(Equal("• alpha beta\n  gamma\n2. second\n"))
+		})
+
+		it("aligns tables and drops the separator row", func() {
+			out := markdown.Render("| a | bbb |\n|---|:---:|\n| cc | d |\n\nafter\n", 80)
+			Expect(plain(out)).To(Equal("a  │ bbb\n───┼────\ncc │ d\n\nafter\n"))
+		})
+
+		it("highlights fenced code without wrapping it", func() {
+			src := "```go\nfunc main() { return \"hi\" } // done and a very long comment\n```\n"
+			out := markdown.Render(src, 20)
+
+			Expect(plain(out)).To(Equal(src))
+			Expect(out).To(ContainSubstring("\033[35mfunc\033[0m"))
+			Expect(out).To(ContainSubstring("\033[32m\"hi\"\033[0m"))
+			Expect(out).To(ContainSubstring("\033[90m// done"))
+		})
+
+		it("uses the language's comment marker", func() {
+			out := markdown.Render("```python\nx = 1  # note\n```\n", 80)
+			Expect(out).To(ContainSubstring("\033[90m# note"))
+			Expect(out).To(ContainSubstring("\033[33m1\033[0m"))
+		})
+
+		it("does not treat markdown inside code fences as markup", func() {
+			out := markdown.Render("```\n# not a heading\n| not | table |\n```\n", 80)
+			Expect(plain(out)).To(Equal("```\n# not a heading\n| not | table |\n```\n"))
+			Expect(out).NotTo(ContainSubstring("\033[1;36m"))
+		})
+	})
+
+	when("Renderer", func() {
+		it("emits completed lines as they stream in and buffers only the current block", func() {
+			var buf bytes.Buffer
+			subject := markdown.NewRenderer(&buf, 80)
+
+			_, _ = subject.Write([]byte("# Hea"))
+			Expect(buf.Len()).To(BeZero())
+
+			_, _ = subject.Write([]byte("ding\nsome para"))
+			Expect(plain(buf.String())).To(Equal("Heading\n"))
+
+			_, _ = subject.Write([]byte("graph text\n"))
+			Expect(plain(buf.String())).To(Equal("Heading\n"))
+
+			_, _ = subject.Write([]byte("\n```sh\necho hi\n"))
+			Expect(plain(buf.String())).To(Equal("Heading\nsome paragraph text\n\n```sh\necho hi\n"))
+		})
+
+		it("flushes the open block and resets between responses", func() {
+			var buf bytes.Buffer
+			subject := markdown.NewRenderer(&buf, 80)
+
+			_, _ = subject.Write([]byte("```go\nx := 1"))
+			Expect(subject.Flush()).To(Succeed())
+			Expect(plain(buf.String())).To(Equal("```go\nx := 1\n"))
+
+			buf.Reset()
+			_, _ = subject.Write([]byte("# next\n"))
+			Expect(plain(buf.String())).To(Equal("next\n"))
+			Expect(strings.Contains(buf.String(), "\033[1;36m")).To(BeTrue())
+		})
+	})
+}
@@ -0,0 +1,115 @@
+//go:build linux
+
+package secrets
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// Possessor and user may view, read, write, search, link and set attributes. The default
+// only lets the possessor read, which a later process doesn't count as when the user
+// keyring isn't linked into its session keyring.
+const keyPermissions = 0x3f3f0000
+
+// Keyctl stores secrets in the user keyring of the Linux kernel. The keyring lives in
+// memory, so its secrets are gone after a reboot. Entries stored with Put expire after
+// their TTL, which makes it a cache for credential helpers too.
+type Keyctl struct {
+	keyring int
+}
+
+// Ensure Keyctl implements the Backend and Cache interfaces
+var (
+	_ Backend = &Keyctl{}
+	_ Cache   = &Keyctl{}
+)
+
+func NewKeyctl() (*Keyctl, error) {
+	if _, err := unix.KeyctlGetKeyringID(unix.KEY_SPEC_USER_KEYRING, true); err != nil {
+		return nil, fmt.Errorf("keyctl is not available: %w", err)
+	}
+	return &Keyctl{keyring: unix.KEY_SPEC_USER_KEYRING}, nil
+}
+
+func (k *Keyctl) Name() string {
+	return BackendKeyctl
+}
+
+func (k *Keyctl) Get(account string) (string, error) {
+	id, err := k.search(account)
+	if err != nil {
+		return "", err
+	}
+
+	buf := make([]byte, 512)
+	for {
+		n, err := unix.KeyctlBuffer(unix.KEYCTL_READ, id, buf, 0)
+		if err != nil {
+			return "", keyError(account, err)
+		}
+		if n <= len(buf) {
+			return string(buf[:n]), nil
+		}
+		buf = make([]byte, n)
+	}
+}
+
+func (k *Keyctl) Set(account, secret string) error {
+	return k.Put(account, secret, 0)
+}
+
+// Put stores value, removing it after ttl unless ttl is 0.
+func (k *Keyctl) Put(account, value string, ttl time.Duration) error {
+	id, err := unix.AddKey("user", description(account), []byte(value), k.keyring)
+	if err != nil {
+		return fmt.Errorf("failed to add %s to the keyring: %w", account, err)
+	}
+	if err := unix.KeyctlSetperm(id, keyPermissions); err != nil {
+		return fmt.Errorf("failed to set the permissions of %s: %w", account, err)
+	}
+	if ttl > 0 {
+		if _, err := unix.KeyctlInt(unix.KEYCTL_SET_TIMEOUT, id, int(ttl.Seconds()), 0, 0); err != nil {
+			return fmt.Errorf("failed to set the timeout of %s: %w", account, err)
+		}
+	}
+	return nil
+}
+
+func (k *Keyctl) Delete(account string) error {
+	id, err := k.search(account)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if _, err := unix.KeyctlInt(unix.KEYCTL_UNLINK, id, k.keyring, 0, 0); err != nil {
+		return fmt.Errorf("failed to remove %s from the keyring: %w", account, err)
+	}
+	return nil
+}
+
+func (k *Keyctl) search(account string) (int, error) {
+	id, err := unix.KeyctlSearch(k.keyring, "user", description(account), 0)
+	if err != nil {
+		return 0, keyError(account, err)
+	}
+	return id, nil
+}
+
+func description(account string) string {
+	return Service + ":" + account
+}
+
+// keyError turns the errors of missing, expired and revoked keys into ErrNotFound.
+func keyError(account string, err error) error {
+	if errors.Is(err, unix.ENOKEY) || errors.Is(err, unix.EKEYEXPIRED) || errors.Is(err, unix.EKEYREVOKED) {
+		err = ErrNotFound
+	}
+	return fmt.Errorf("keyring %s: %w", account, err)
+}
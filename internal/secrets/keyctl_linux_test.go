@@ -0,0 +1,65 @@
+//go:build linux
+
+package secrets_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/kardolus/chatgpt-cli/internal/secrets"
+	. "github.com/onsi/gomega"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+)
+
+func TestUnitKeyctl(t *testing.T) {
+	spec.Run(t, "Testing the kernel keyring", testKeyctl, spec.Report(report.Terminal{}))
+}
+
+func testKeyctl(t *testing.T, when spec.G, it spec.S) {
+	var (
+		keyring *secrets.Keyctl
+		account string
+	)
+
+	it.Before(func() {
+		RegisterTestingT(t)
+
+		var err error
+		if keyring, err = secrets.NewKeyctl(); err != nil {
+			t.Skip(err)
+		}
+		account = fmt.Sprintf("test-%d", time.Now().UnixNano())
+	})
+
+	it.After(func() {
+		if keyring != nil {
+			Expect(keyring.Delete(account)).To(Succeed())
+		}
+	})
+
+	it("stores, reads and removes secrets", func() {
+		_, err := keyring.Get(account)
+		Expect(errors.Is(err, secrets.ErrNotFound)).To(BeTrue())
+
+		Expect(keyring.Set(account, "first")).To(Succeed())
+		Expect(keyring.Set(account, "second")).To(Succeed())
+		Expect(keyring.Get(account)).To(Equal("second"))
+
+		Expect(keyring.Delete(account)).To(Succeed())
+		_, err = keyring.Get(account)
+		Expect(errors.Is(err, secrets.ErrNotFound)).To(BeTrue())
+	})
+
+	it("expires entries stored with a TTL", func() {
+		Expect(keyring.Put(account, "cached", time.Second)).To(Succeed())
+		Expect(keyring.Get(account)).To(Equal("cached"))
+
+		Eventually(func() bool {
+			_, err := keyring.Get(account)
+			return errors.Is(err, secrets.ErrNotFound)
+		}, 3*time.Second, 100*time.Millisecond).Should(BeTrue())
+	})
+}
@@ -0,0 +1,37 @@
+//go:build !linux
+
+package secrets
+
+import (
+	"errors"
+	"time"
+)
+
+var errNoKeyctl = errors.New("keyctl is only available on Linux")
+
+// Keyctl stores secrets in the Linux kernel keyring, which doesn't exist on this platform.
+type Keyctl struct{}
+
+func NewKeyctl() (*Keyctl, error) {
+	return nil, errNoKeyctl
+}
+
+func (k *Keyctl) Name() string {
+	return BackendKeyctl
+}
+
+func (k *Keyctl) Get(string) (string, error) {
+	return "", errNoKeyctl
+}
+
+func (k *Keyctl) Set(string, string) error {
+	return errNoKeyctl
+}
+
+func (k *Keyctl) Put(string, string, time.Duration) error {
+	return errNoKeyctl
+}
+
+func (k *Keyctl) Delete(string) error {
+	return errNoKeyctl
+}
@@ -0,0 +1,82 @@
+package secrets
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+const secretTool = "secret-tool"
+
+// errNoOutput is returned by run when secret-tool fails without printing anything, which
+// is how lookup reports a secret that doesn't exist.
+var errNoOutput = errors.New("no output")
+
+// SecretService stores secrets in the freedesktop Secret Service (GNOME Keyring, KWallet)
+// through the secret-tool command of libsecret.
+type SecretService struct {
+	// Tool is the secret-tool executable.
+	Tool string
+}
+
+func NewSecretService() *SecretService {
+	return &SecretService{Tool: secretTool}
+}
+
+// Ensure SecretService implements the Backend interface
+var _ Backend = &SecretService{}
+
+func (s *SecretService) Name() string {
+	return BackendSecretService
+}
+
+func (s *SecretService) Get(account string) (string, error) {
+	// secret-tool exits with 1 and prints nothing when there is no such secret.
+	out, err := s.run("", "lookup", "service", Service, "account", account)
+	if errors.Is(err, errNoOutput) {
+		return "", fmt.Errorf("%s: %w", account, ErrNotFound)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	secret := strings.TrimRight(out, "\n")
+	if secret == "" {
+		return "", fmt.Errorf("%s: %w", account, ErrNotFound)
+	}
+	return secret, nil
+}
+
+func (s *SecretService) Set(account, secret string) error {
+	label := fmt.Sprintf("%s (%s)", Service, account)
+	_, err := s.run(secret, "store", "--label", label, "service", Service, "account", account)
+	return err
+}
+
+func (s *SecretService) Delete(account string) error {
+	_, err := s.run("", "clear", "service", Service, "account", account)
+	return err
+}
+
+func (s *SecretService) run(stdin string, args ...string) (string, error) {
+	cmd := exec.Command(s.Tool, args...)
+	cmd.Stdin = strings.NewReader(stdin)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && stdout.Len() == 0 && stderr.Len() == 0 {
+			return "", fmt.Errorf("%s %s: %v, %w", s.Tool, args[0], err, errNoOutput)
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%s %s: %s", s.Tool, args[0], msg)
+		}
+		return "", fmt.Errorf("%s %s: %w", s.Tool, args[0], err)
+	}
+	return stdout.String(), nil
+}
@@ -0,0 +1,177 @@
+// Package secrets keeps credentials out of the configuration files. Secrets are stored in
+// the freedesktop Secret Service or the Linux kernel keyring, or produced by a credential
+// helper command, and configuration values refer to them as ${keyring:name} or
+// ${cmd:command}.
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"strings"
+	"time"
+)
+
+const (
+	// Service namespaces the secrets of the CLI in the backends.
+	Service = "chatgpt-cli"
+
+	BackendSecretService = "secret-service"
+	BackendKeyctl        = "keyctl"
+)
+
+var ErrNotFound = errors.New("secret not found")
+
+// Backend stores secrets by account name.
+type Backend interface {
+	Name() string
+	Get(account string) (string, error)
+	Set(account, secret string) error
+	Delete(account string) error
+}
+
+// Cache keeps the output of credential helper commands for a limited time. Get returns
+// ErrNotFound for missing and expired entries.
+type Cache interface {
+	Get(key string) (string, error)
+	Put(key, value string, ttl time.Duration) error
+	Delete(key string) error
+}
+
+// Open returns the named backend. An empty name picks the Secret Service when secret-tool
+// is installed and falls back to the kernel keyring on Linux.
+func Open(name string) (Backend, error) {
+	switch name {
+	case BackendSecretService:
+		return NewSecretService(), nil
+	case BackendKeyctl:
+		k, err := NewKeyctl()
+		if err != nil {
+			return nil, err
+		}
+		return k, nil
+	case "":
+		if _, err := exec.LookPath(secretTool); err == nil {
+			return NewSecretService(), nil
+		}
+		if k, err := NewKeyctl(); err == nil {
+			return k, nil
+		}
+		return nil, errors.New("no secret storage available, install secret-tool (libsecret) or use Linux keyctl")
+	default:
+		return nil, fmt.Errorf("unknown secret_backend %q (expected %s|%s)", name, BackendSecretService, BackendKeyctl)
+	}
+}
+
+var reference = regexp.MustCompile(`\$\{(keyring|cmd):([^}]+)\}`)
+
+// Resolver looks up secrets and runs credential helpers. Backend and Cache may be nil, in
+// which case keyring references fail and commands run every time.
+type Resolver struct {
+	Backend Backend
+	Cache   Cache
+	TTL     time.Duration
+}
+
+// Lookup returns the secret stored for account.
+func (r *Resolver) Lookup(account string) (string, error) {
+	if r.Backend == nil {
+		return "", fmt.Errorf("can't look up %q: %w", account, ErrNotFound)
+	}
+	return r.Backend.Get(account)
+}
+
+// Command returns the trimmed output of the credential helper command, from the cache when
+// it ran less than TTL ago.
+func (r *Resolver) Command(ctx context.Context, command string) (string, error) {
+	key := cacheKey(command)
+	if r.Cache != nil && r.TTL > 0 {
+		if value, err := r.Cache.Get(key); err == nil {
+			return value, nil
+		}
+	}
+
+	value, err := RunCommand(ctx, command)
+	if err != nil {
+		return "", err
+	}
+
+	if r.Cache != nil && r.TTL > 0 {
+		if err := r.Cache.Put(key, value, r.TTL); err != nil {
+			return "", fmt.Errorf("failed to cache the output of %q: %w", command, err)
+		}
+	}
+	return value, nil
+}
+
+// Forget drops the cached output of command.
+func (r *Resolver) Forget(command string) error {
+	if r.Cache == nil {
+		return nil
+	}
+	return r.Cache.Delete(cacheKey(command))
+}
+
+// Expand replaces the ${keyring:name} and ${cmd:command} references in value.
+func (r *Resolver) Expand(ctx context.Context, value string) (string, error) {
+	var firstErr error
+	result := reference.ReplaceAllStringFunc(value, func(match string) string {
+		parts := reference.FindStringSubmatch(match)
+		kind, arg := parts[1], strings.TrimSpace(parts[2])
+
+		var secret string
+		var err error
+		if kind == "keyring" {
+			secret, err = r.Lookup(arg)
+		} else {
+			secret, err = r.Command(ctx, arg)
+		}
+		if err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("failed to resolve %s: %w", match, err)
+		}
+		return secret
+	})
+	if firstErr != nil {
+		return "", firstErr
+	}
+	return result, nil
+}
+
+// RunCommand runs command through the shell, like a git credential helper, and returns its
+// trimmed output.
+func RunCommand(ctx context.Context, command string) (string, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%q failed: %w: %s", command, err, msg)
+		}
+		return "", fmt.Errorf("%q failed: %w", command, err)
+	}
+
+	value := strings.TrimSpace(stdout.String())
+	if value == "" {
+		return "", fmt.Errorf("%q printed nothing", command)
+	}
+	return value, nil
+}
+
+func cacheKey(command string) string {
+	sum := sha256.Sum256([]byte(command))
+	return "cmd:" + hex.EncodeToString(sum[:8])
+}
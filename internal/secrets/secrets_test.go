@@ -0,0 +1,183 @@
+package secrets_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kardolus/chatgpt-cli/internal/secrets"
+	. "github.com/onsi/gomega"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+)
+
+func TestUnitSecrets(t *testing.T) {
+	spec.Run(t, "Testing the secret storage", testSecrets, spec.Report(report.Terminal{}))
+}
+
+type memoryStore map[string]string
+
+func (m memoryStore) Name() string { return "memory" }
+
+func (m memoryStore) Get(key string) (string, error) {
+	if value, ok := m[key]; ok {
+		return value, nil
+	}
+	return "", secrets.ErrNotFound
+}
+
+func (m memoryStore) Set(key, value string) error {
+	m[key] = value
+	return nil
+}
+
+func (m memoryStore) Put(key, value string, _ time.Duration) error {
+	m[key] = value
+	return nil
+}
+
+func (m memoryStore) Delete(key string) error {
+	delete(m, key)
+	return nil
+}
+
+func testSecrets(t *testing.T, when spec.G, it spec.S) {
+	var dir string
+
+	it.Before(func() {
+		RegisterTestingT(t)
+		dir = t.TempDir()
+	})
+
+	// counter prints a token and records every run in a file.
+	counter := func() (string, func() int) {
+		runs := filepath.Join(dir, "runs")
+		command := `echo run >> "` + runs + `"; echo '  token  '`
+		return command, func() int {
+			data, _ := os.ReadFile(runs)
+			return strings.Count(string(data), "run")
+		}
+	}
+
+	when("Resolver.Command()", func() {
+		it("caches the output for the TTL", func() {
+			command, runs := counter()
+			cache := memoryStore{}
+			resolver := &secrets.Resolver{Cache: cache, TTL: time.Minute}
+
+			for i := 0; i < 2; i++ {
+				value, err := resolver.Command(context.Background(), command)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(value).To(Equal("token"))
+			}
+			Expect(runs()).To(Equal(1))
+			Expect(cache).To(HaveLen(1))
+
+			Expect(resolver.Forget(command)).To(Succeed())
+			Expect(cache).To(BeEmpty())
+		})
+
+		it("runs the command every time without a cache", func() {
+			command, runs := counter()
+			resolver := &secrets.Resolver{}
+
+			for i := 0; i < 2; i++ {
+				_, err := resolver.Command(context.Background(), command)
+				Expect(err).NotTo(HaveOccurred())
+			}
+			Expect(runs()).To(Equal(2))
+		})
+
+		it("reports failures with the error output", func() {
+			resolver := &secrets.Resolver{}
+
+			_, err := resolver.Command(context.Background(), "echo locked >&2; exit 3")
+			Expect(err).To(MatchError(ContainSubstring("exit status 3: locked")))
+
+			_, err = resolver.Command(context.Background(), "true")
+			Expect(err).To(MatchError(ContainSubstring("printed nothing")))
+		})
+	})
+
+	when("Resolver.Expand()", func() {
+		it("replaces keyring and command references", func() {
+			resolver := &secrets.Resolver{Backend: memoryStore{"github": "gh-token"}}
+
+			value, err := resolver.Expand(context.Background(), "Bearer ${keyring:github} ${cmd:echo extra}")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(value).To(Equal("Bearer gh-token extra"))
+
+			value, err = resolver.Expand(context.Background(), "plain value")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(value).To(Equal("plain value"))
+		})
+
+		it("fails on a missing secret", func() {
+			resolver := &secrets.Resolver{Backend: memoryStore{}}
+
+			_, err := resolver.Expand(context.Background(), "Bearer ${keyring:github}")
+			Expect(err).To(MatchError(ContainSubstring("failed to resolve ${keyring:github}")))
+			Expect(errors.Is(err, secrets.ErrNotFound)).To(BeTrue())
+
+			_, err = (&secrets.Resolver{}).Expand(context.Background(), "${keyring:github}")
+			Expect(errors.Is(err, secrets.ErrNotFound)).To(BeTrue())
+		})
+	})
+
+	when("SecretService", func() {
+		it("stores, looks up and clears secrets with secret-tool", func() {
+			store := filepath.Join(dir, "store")
+			Expect(os.Mkdir(store, 0o700)).To(Succeed())
+
+			// A fake secret-tool that keeps one file per account.
+			script := `#!/bin/sh
+cmd=$1; shift
+while [ "$1" = "--label" ]; do shift 2; done
+file="` + store + `/$4"
+case $cmd in
+  store) cat > "$file" ;;
+  lookup) [ -f "$file" ] && cat "$file" || exit 1 ;;
+  clear) rm -f "$file" ;;
+esac
+`
+			tool := filepath.Join(dir, "secret-tool")
+			Expect(os.WriteFile(tool, []byte(script), 0o755)).To(Succeed())
+
+			backend := &secrets.SecretService{Tool: tool}
+			Expect(backend.Name()).To(Equal(secrets.BackendSecretService))
+
+			_, err := backend.Get("openai")
+			Expect(errors.Is(err, secrets.ErrNotFound)).To(BeTrue())
+
+			Expect(backend.Set("openai", "sk-123")).To(Succeed())
+			Expect(backend.Get("openai")).To(Equal("sk-123"))
+
+			Expect(backend.Delete("openai")).To(Succeed())
+			_, err = backend.Get("openai")
+			Expect(errors.Is(err, secrets.ErrNotFound)).To(BeTrue())
+		})
+
+		it("reports a failed store or clear even when secret-tool prints nothing", func() {
+			tool := filepath.Join(dir, "secret-tool")
+			Expect(os.WriteFile(tool, []byte("#!/bin/sh\ncat > /dev/null\nexit 1\n"), 0o755)).To(Succeed())
+			backend := &secrets.SecretService{Tool: tool}
+
+			Expect(backend.Set("openai", "sk-123")).To(MatchError(tool + " store: exit status 1, no output"))
+			Expect(backend.Delete("openai")).To(MatchError(tool + " clear: exit status 1, no output"))
+
+			_, err := backend.Get("openai")
+			Expect(errors.Is(err, secrets.ErrNotFound)).To(BeTrue())
+		})
+	})
+
+	when("Open()", func() {
+		it("rejects unknown backends", func() {
+			_, err := secrets.Open("vault")
+			Expect(err).To(MatchError(ContainSubstring(`unknown secret_backend "vault"`)))
+		})
+	})
+}
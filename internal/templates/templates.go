@@ -0,0 +1,293 @@
+// Package templates loads named prompt templates from the prompts directory of the config
+// home. A template is a text/template body with optional YAML front-matter that sets the
+// model, role and temperature to use and default values for its variables:
+//
+//	---
+//	description: Review a diff
+//	model: gpt-4o
+//	temperature: 0.2
+//	vars:
+//	  lang: go
+//	---
+//	Review the following {{.lang}} diff and point out bugs.
+package templates
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+	"text/template/parse"
+
+	"github.com/kardolus/chatgpt-cli/internal"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	DirName = "prompts"
+
+	frontMatterDelimiter = "---"
+)
+
+// Extensions lists the file extensions recognized as templates, in lookup order.
+var Extensions = []string{".md", ".txt", ".tmpl"}
+
+type Template struct {
+	Name string `yaml:"-"`
+	Path string `yaml:"-"`
+	Body string `yaml:"-"`
+
+	Description string            `yaml:"description"`
+	Model       string            `yaml:"model"`
+	Role        string            `yaml:"role"`
+	Temperature *float64          `yaml:"temperature"`
+	Vars        map[string]string `yaml:"vars"`
+}
+
+// Dir returns the prompts directory in the config home.
+func Dir() (string, error) {
+	home, err := internal.GetConfigHome()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, DirName), nil
+}
+
+// List returns the templates in dir and its subdirectories, sorted by name. Templates in
+// subdirectories are named by their relative path, e.g. team/review.
+func List(dir string) ([]Template, error) {
+	var result []Template
+
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) && path == dir {
+				return fs.SkipDir
+			}
+			return err
+		}
+		if d.IsDir() || !isTemplateFile(path) {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(strings.TrimSuffix(rel, filepath.Ext(rel)))
+
+		t, err := loadFile(name, path)
+		if err != nil {
+			return err
+		}
+		result = append(result, *t)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result, nil
+}
+
+// Load finds the template with the given name in dir, with or without its extension.
+func Load(dir, name string) (*Template, error) {
+	base := filepath.Join(dir, filepath.FromSlash(name))
+
+	candidates := []string{base}
+	for _, ext := range Extensions {
+		candidates = append(candidates, base+ext)
+	}
+
+	for _, path := range candidates {
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return loadFile(strings.TrimSuffix(name, filepath.Ext(name)), path)
+		}
+	}
+	return nil, fmt.Errorf("template %q not found in %s", name, dir)
+}
+
+// Parse splits data into its front-matter and body.
+func Parse(name string, data []byte) (*Template, error) {
+	t := &Template{Name: name}
+
+	text := strings.ReplaceAll(string(data), "\r\n", "\n")
+	if rest, ok := strings.CutPrefix(text, frontMatterDelimiter+"\n"); ok {
+		header, body, found := strings.Cut(rest, "\n"+frontMatterDelimiter+"\n")
+		if !found {
+			header, found = strings.CutSuffix(rest, "\n"+frontMatterDelimiter)
+			body = ""
+		}
+		if !found {
+			return nil, fmt.Errorf("template %s: front-matter is not closed with %s", name, frontMatterDelimiter)
+		}
+		if err := yaml.Unmarshal([]byte(header), t); err != nil {
+			return nil, fmt.Errorf("template %s: invalid front-matter: %w", name, err)
+		}
+		text = body
+	}
+
+	t.Body = text
+	return t, nil
+}
+
+// Variables returns the names of the variables used in the body, sorted.
+func (t *Template) Variables() ([]string, error) {
+	tpl, err := t.parse()
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{}
+	walk(tpl.Tree.Root, seen, true)
+
+	var names []string
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Render executes the body with the default variables overridden by vars. Every variable
+// used in the body must have a value.
+func (t *Template) Render(vars map[string]string) (string, error) {
+	values := map[string]string{}
+	for k, v := range t.Vars {
+		values[k] = v
+	}
+	for k, v := range vars {
+		values[k] = v
+	}
+
+	used, err := t.Variables()
+	if err != nil {
+		return "", err
+	}
+
+	var missing []string
+	for _, name := range used {
+		if _, ok := values[name]; !ok {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return "", fmt.Errorf("template %s needs a value for %s, pass it with --var name=value", t.Name, strings.Join(missing, ", "))
+	}
+
+	tpl, err := t.parse()
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	if err := tpl.Execute(&buf, values); err != nil {
+		return "", fmt.Errorf("template %s: %w", t.Name, err)
+	}
+	return buf.String(), nil
+}
+
+// ParseVars turns name=value pairs into a map.
+func ParseVars(pairs []string) (map[string]string, error) {
+	vars := map[string]string{}
+	for _, pair := range pairs {
+		name, value, ok := strings.Cut(pair, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid variable %q, use name=value", pair)
+		}
+		vars[name] = value
+	}
+	return vars, nil
+}
+
+func (t *Template) parse() (*template.Template, error) {
+	tpl, err := template.New(t.Name).Option("missingkey=error").Parse(t.Body)
+	if err != nil {
+		return nil, fmt.Errorf("template %s: %w", t.Name, err)
+	}
+	return tpl, nil
+}
+
+func loadFile(name, path string) (*Template, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := Parse(name, data)
+	if err != nil {
+		return nil, err
+	}
+	t.Path = path
+	return t, nil
+}
+
+func isTemplateFile(path string) bool {
+	ext := filepath.Ext(path)
+	for _, e := range Extensions {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
+
+// walk collects the top-level variables referenced in the template, such as lang in
+// {{.lang}} or {{$.lang}}. Inside range and with blocks the dot is no longer the variables,
+// so only $-rooted references count there.
+func walk(node parse.Node, seen map[string]bool, atRoot bool) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			walk(child, seen, atRoot)
+		}
+	case *parse.ActionNode:
+		walk(n.Pipe, seen, atRoot)
+	case *parse.IfNode:
+		walk(n.Pipe, seen, atRoot)
+		walk(n.List, seen, atRoot)
+		walk(n.ElseList, seen, atRoot)
+	case *parse.RangeNode:
+		walk(n.Pipe, seen, atRoot)
+		walk(n.List, seen, false)
+		walk(n.ElseList, seen, atRoot)
+	case *parse.WithNode:
+		walk(n.Pipe, seen, atRoot)
+		walk(n.List, seen, false)
+		walk(n.ElseList, seen, atRoot)
+	case *parse.TemplateNode:
+		walk(n.Pipe, seen, atRoot)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, cmd := range n.Cmds {
+			walk(cmd, seen, atRoot)
+		}
+	case *parse.CommandNode:
+		for _, arg := range n.Args {
+			walk(arg, seen, atRoot)
+		}
+	case *parse.ChainNode:
+		walk(n.Node, seen, atRoot)
+	case *parse.FieldNode:
+		if atRoot {
+			seen[n.Ident[0]] = true
+		}
+	case *parse.VariableNode:
+		if n.Ident[0] == "$" && len(n.Ident) > 1 {
+			seen[n.Ident[1]] = true
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package templates_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kardolus/chatgpt-cli/internal/templates"
+	. "github.com/onsi/gomega"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+)
+
+func TestUnitTemplates(t *testing.T) {
+	spec.Run(t, "Testing the prompt templates", testTemplates, spec.Report(report.Terminal{}))
+}
+
+const review = `---
+description: Review a diff
+model: gpt-4o
+role: You are a meticulous reviewer.
+temperature: 0.2
+vars:
+  lang: go
+---
+Review this {{.lang}} diff{{with .focus}}, focusing on {{.}}{{end}}.
+`
+
+func testTemplates(t *testing.T, when spec.G, it spec.S) {
+	var dir string
+
+	it.Before(func() {
+		RegisterTestingT(t)
+		dir = t.TempDir()
+	})
+
+	write := func(name, content string) {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		Expect(os.MkdirAll(filepath.Dir(path), 0o755)).To(Succeed())
+		Expect(os.WriteFile(path, []byte(content), 0o644)).To(Succeed())
+	}
+
+	when("Parse()", func() {
+		it("reads the front-matter", func() {
+			tpl, err := templates.Parse("review", []byte(review))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(tpl.Description).To(Equal("Review a diff"))
+			Expect(tpl.Model).To(Equal("gpt-4o"))
+			Expect(tpl.Role).To(Equal("You are a meticulous reviewer."))
+			Expect(*tpl.Temperature).To(Equal(0.2))
+			Expect(tpl.Vars).To(Equal(map[string]string{"lang": "go"}))
+			Expect(tpl.Body).To(HavePrefix("Review this"))
+		})
+
+		it("takes files without front-matter as the body", func() {
+			tpl, err := templates.Parse("plain", []byte("Summarize this."))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(tpl.Body).To(Equal("Summarize this."))
+			Expect(tpl.Temperature).To(BeNil())
+		})
+
+		it("rejects unclosed front-matter", func() {
+			_, err := templates.Parse("broken", []byte("---\nmodel: gpt-4o\nbody"))
+			Expect(err).To(MatchError(ContainSubstring("not closed")))
+		})
+	})
+
+	when("Render()", func() {
+		it("fills in the variables over their defaults", func() {
+			tpl, err := templates.Parse("review", []byte(review))
+			Expect(err).NotTo(HaveOccurred())
+
+			out, err := tpl.Render(map[string]string{"lang": "python", "focus": "errors"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(out).To(Equal("Review this python diff, focusing on errors.\n"))
+		})
+
+		it("lists every missing variable", func() {
+			tpl, err := templates.Parse("t", []byte("{{.a}} {{if .b}}{{$.c}}{{end}} {{range .d}}{{.ignored}}{{end}}"))
+			Expect(err).NotTo(HaveOccurred())
+
+			vars, err := tpl.Variables()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(vars).To(Equal([]string{"a", "b", "c", "d"}))
+
+			_, err = tpl.Render(map[string]string{"b": "x"})
+			Expect(err).To(MatchError(ContainSubstring("needs a value for a, c, d")))
+		})
+	})
+
+	when("Load() and List()", func() {
+		it("finds templates by name in the directory and its subdirectories", func() {
+			write("review.md", review)
+			write("team/summary.txt", "Summarize.")
+			write("notes.json", "{}")
+
+			tpl, err := templates.Load(dir, "review")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(tpl.Name).To(Equal("review"))
+			Expect(tpl.Path).To(Equal(filepath.Join(dir, "review.md")))
+
+			tpl, err = templates.Load(dir, "team/summary.txt")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(tpl.Name).To(Equal("team/summary"))
+
+			_, err = templates.Load(dir, "missing")
+			Expect(err).To(MatchError(ContainSubstring("not found")))
+
+			list, err := templates.List(dir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(list).To(HaveLen(2))
+			Expect(list[0].Name).To(Equal("review"))
+			Expect(list[1].Name).To(Equal("team/summary"))
+		})
+
+		it("lists nothing when the directory doesn't exist", func() {
+			list, err := templates.List(filepath.Join(dir, "nope"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(list).To(BeEmpty())
+		})
+	})
+
+	when("ParseVars()", func() {
+		it("splits name=value pairs on the first equals sign", func() {
+			vars, err := templates.ParseVars([]string{"lang=go", "query=a=b"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(vars).To(Equal(map[string]string{"lang": "go", "query": "a=b"}))
+
+			_, err = templates.ParseVars([]string{"nope"})
+			Expect(err).To(HaveOccurred())
+		})
+	})
+}
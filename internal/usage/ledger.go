@@ -0,0 +1,269 @@
+package usage
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/kardolus/chatgpt-cli/internal"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	ledgerDir  = "usage"
+	ledgerFile = "ledger.jsonl"
+	dayLayout  = "2006-01-02"
+)
+
+// Record is the usage of one request.
+type Record struct {
+	Time   time.Time `json:"time"`
+	Model  string    `json:"model"`
+	Thread string    `json:"thread,omitempty"`
+	Team   string    `json:"team,omitempty"`
+	Tokens
+
+	// CostUSD is 0 when Priced is false, i.e. the model had no price.
+	CostUSD float64 `json:"cost_usd"`
+	Priced  bool    `json:"priced"`
+}
+
+// NewRecord prices tokens used by model.
+func NewRecord(prices Prices, now time.Time, model string, tokens Tokens) Record {
+	r := Record{Time: now, Model: model, Tokens: tokens}
+	if price, ok := prices.Lookup(model); ok {
+		r.CostUSD = price.Cost(tokens)
+		r.Priced = true
+	}
+	return r
+}
+
+// Ledger keeps the usage of every request as JSON lines, oldest first.
+type Ledger struct {
+	mu   sync.Mutex
+	path string
+}
+
+func NewLedger(path string) *Ledger {
+	return &Ledger{path: path}
+}
+
+// LedgerPath returns where the ledger lives under the data home.
+func LedgerPath() (string, error) {
+	dataHome, err := internal.GetDataHome()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dataHome, ledgerDir, ledgerFile), nil
+}
+
+func (l *Ledger) Path() string {
+	return l.path
+}
+
+func (l *Ledger) Append(r Record) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(l.path), 0o700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Records returns the records since a time, skipping lines it can't parse.
+func (l *Ledger) Records(since time.Time) ([]Record, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	f, err := os.Open(l.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var out []Record
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		var r Record
+		if err := json.Unmarshal(sc.Bytes(), &r); err != nil {
+			continue
+		}
+		if r.Time.Before(since) {
+			continue
+		}
+		out = append(out, r)
+	}
+	return out, sc.Err()
+}
+
+// ParseSince reads a --since value: a day like 2026-10-01 or a duration back from now like
+// 7d or 12h. An empty value means since the beginning.
+func ParseSince(s string, now time.Time) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.ParseInLocation(dayLayout, s, now.Location()); err == nil {
+		return t, nil
+	}
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil && n >= 0 {
+			return now.AddDate(0, 0, -n), nil
+		}
+	}
+	if d, err := time.ParseDuration(s); err == nil && d >= 0 {
+		return now.Add(-d), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid --since %q (expected a day like 2006-01-02 or a duration like 7d or 12h)", s)
+}
+
+// Row is what the requests of one day, model, thread and team used.
+type Row struct {
+	Day      string
+	Model    string
+	Thread   string
+	Team     string
+	Requests int
+	Tokens
+	CostUSD  float64
+	Unpriced int
+}
+
+// Summarize adds up records by day, model, thread and team, ordered by day and then by cost.
+func Summarize(records []Record) []Row {
+	type key struct{ day, model, thread, team string }
+	rows := map[key]*Row{}
+	var order []key
+
+	for _, r := range records {
+		k := key{r.Time.Local().Format(dayLayout), r.Model, r.Thread, r.Team}
+		row, ok := rows[k]
+		if !ok {
+			row = &Row{Day: k.day, Model: k.model, Thread: k.thread, Team: k.team}
+			rows[k] = row
+			order = append(order, k)
+		}
+		row.Requests++
+		row.Tokens.Add(r.Tokens)
+		row.CostUSD += r.CostUSD
+		if !r.Priced {
+			row.Unpriced++
+		}
+	}
+
+	out := make([]Row, 0, len(order))
+	for _, k := range order {
+		out = append(out, *rows[k])
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].Day != out[j].Day {
+			return out[i].Day < out[j].Day
+		}
+		return out[i].CostUSD > out[j].CostUSD
+	})
+	return out
+}
+
+// WriteReport writes the rows of records as a table, followed by the totals per team.
+func WriteReport(w io.Writer, records []Record) error {
+	if len(records) == 0 {
+		_, err := fmt.Fprintln(w, "No usage recorded.")
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "DAY\tMODEL\tTHREAD\tTEAM\tREQUESTS\tINPUT\tCACHED\tOUTPUT\tREASONING\tCOST (USD)")
+
+	var total Row
+	teams := map[string]*Row{}
+	var teamOrder []string
+	for _, r := range Summarize(records) {
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t%d\t%d\t%d\t%d\t%s\n",
+			r.Day, r.Model, dash(r.Thread), dash(r.Team), r.Requests,
+			r.Input, r.CachedInput, r.Output, r.Reasoning, formatCost(r.CostUSD, r.Unpriced))
+
+		for _, sum := range []*Row{&total, teamRow(teams, &teamOrder, r.Team)} {
+			sum.Requests += r.Requests
+			sum.Tokens.Add(r.Tokens)
+			sum.CostUSD += r.CostUSD
+			sum.Unpriced += r.Unpriced
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	_, _ = fmt.Fprintln(w)
+	tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "TEAM\tREQUESTS\tTOKENS\tCOST (USD)")
+	sort.Strings(teamOrder)
+	for _, team := range teamOrder {
+		t := teams[team]
+		_, _ = fmt.Fprintf(tw, "%s\t%d\t%d\t%s\n", dash(team), t.Requests, t.Total(), formatCost(t.CostUSD, t.Unpriced))
+	}
+	_, _ = fmt.Fprintf(tw, "total\t%d\t%d\t%s\n", total.Requests, total.Total(), formatCost(total.CostUSD, total.Unpriced))
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if total.Unpriced > 0 {
+		requests := fmt.Sprintf("%d requests", total.Unpriced)
+		if total.Unpriced == 1 {
+			requests = "1 request"
+		}
+		_, err := fmt.Fprintf(w, "\n* %s used models without a price; add them under usage.prices.\n", requests)
+		return err
+	}
+	return nil
+}
+
+func teamRow(teams map[string]*Row, order *[]string, team string) *Row {
+	if r, ok := teams[team]; ok {
+		return r
+	}
+	r := &Row{Team: team}
+	teams[team] = r
+	*order = append(*order, team)
+	return r
+}
+
+func formatCost(usd float64, unpriced int) string {
+	s := fmt.Sprintf("%.4f", usd)
+	if unpriced > 0 {
+		s += "*"
+	}
+	return s
+}
+
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,110 @@
+package usage
+
+import "strings"
+
+// Price is what a model costs in USD per million tokens. CachedInput defaults to Input and
+// Reasoning to Output when they are zero.
+type Price struct {
+	Input       float64 `yaml:"input" mapstructure:"input"`
+	CachedInput float64 `yaml:"cached_input" mapstructure:"cached_input"`
+	Output      float64 `yaml:"output" mapstructure:"output"`
+	Reasoning   float64 `yaml:"reasoning" mapstructure:"reasoning"`
+}
+
+// Tokens is what a request used. CachedInput is part of Input and Reasoning part of Output,
+// the way the API reports them.
+type Tokens struct {
+	Input       int `json:"input_tokens"`
+	CachedInput int `json:"cached_input_tokens,omitempty"`
+	Output      int `json:"output_tokens"`
+	Reasoning   int `json:"reasoning_tokens,omitempty"`
+}
+
+func (t Tokens) Total() int {
+	return t.Input + t.Output
+}
+
+func (t *Tokens) Add(o Tokens) {
+	t.Input += o.Input
+	t.CachedInput += o.CachedInput
+	t.Output += o.Output
+	t.Reasoning += o.Reasoning
+}
+
+// Cost returns what tokens cost in USD.
+func (p Price) Cost(t Tokens) float64 {
+	cachedPrice := p.CachedInput
+	if cachedPrice == 0 {
+		cachedPrice = p.Input
+	}
+	reasoningPrice := p.Reasoning
+	if reasoningPrice == 0 {
+		reasoningPrice = p.Output
+	}
+
+	cached := min(t.CachedInput, t.Input)
+	reasoning := min(t.Reasoning, t.Output)
+
+	return (float64(t.Input-cached)*p.Input +
+		float64(cached)*cachedPrice +
+		float64(t.Output-reasoning)*p.Output +
+		float64(reasoning)*reasoningPrice) / 1e6
+}
+
+// DefaultPrices are the list prices of the OpenAI models, in USD per million tokens.
+var DefaultPrices = Prices{
+	"gpt-5":         {Input: 1.25, CachedInput: 0.125, Output: 10},
+	"gpt-5-mini":    {Input: 0.25, CachedInput: 0.025, Output: 2},
+	"gpt-5-nano":    {Input: 0.05, CachedInput: 0.005, Output: 0.4},
+	"gpt-4.1":       {Input: 2, CachedInput: 0.5, Output: 8},
+	"gpt-4.1-mini":  {Input: 0.4, CachedInput: 0.1, Output: 1.6},
+	"gpt-4.1-nano":  {Input: 0.1, CachedInput: 0.025, Output: 0.4},
+	"gpt-4o":        {Input: 2.5, CachedInput: 1.25, Output: 10},
+	"gpt-4o-mini":   {Input: 0.15, CachedInput: 0.075, Output: 0.6},
+	"gpt-4-turbo":   {Input: 10, Output: 30},
+	"gpt-4":         {Input: 30, Output: 60},
+	"gpt-3.5-turbo": {Input: 0.5, Output: 1.5},
+	"o1":            {Input: 15, CachedInput: 7.5, Output: 60},
+	"o1-mini":       {Input: 1.1, CachedInput: 0.55, Output: 4.4},
+	"o1-pro":        {Input: 150, Output: 600},
+	"o3":            {Input: 2, CachedInput: 0.5, Output: 8},
+	"o3-mini":       {Input: 1.1, CachedInput: 0.55, Output: 4.4},
+	"o3-pro":        {Input: 20, Output: 80},
+	"o4-mini":       {Input: 1.1, CachedInput: 0.275, Output: 4.4},
+}
+
+// Prices maps model names to their price.
+type Prices map[string]Price
+
+// NewPrices returns the default prices with overrides on top, e.g. for other providers or
+// negotiated rates.
+func NewPrices(overrides map[string]Price) Prices {
+	p := make(Prices, len(DefaultPrices)+len(overrides))
+	for model, price := range DefaultPrices {
+		p[model] = price
+	}
+	for model, price := range overrides {
+		p[strings.ToLower(strings.TrimSpace(model))] = price
+	}
+	return p
+}
+
+// Lookup returns the price of model. Snapshots like gpt-4o-2024-08-06 get the price of the
+// longest model name they start with.
+func (p Prices) Lookup(model string) (Price, bool) {
+	model = strings.ToLower(strings.TrimSpace(model))
+	if price, ok := p[model]; ok {
+		return price, true
+	}
+
+	best := ""
+	for name := range p {
+		if len(name) > len(best) && strings.HasPrefix(model, name+"-") {
+			best = name
+		}
+	}
+	if best == "" {
+		return Price{}, false
+	}
+	return p[best], true
+}
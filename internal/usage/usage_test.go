@@ -0,0 +1,167 @@
+package usage_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kardolus/chatgpt-cli/internal/usage"
+	. "github.com/onsi/gomega"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+)
+
+func TestUnitUsage(t *testing.T) {
+	spec.Run(t, "Testing the usage ledger", testUsage, spec.Report(report.Terminal{}))
+}
+
+func testUsage(t *testing.T, when spec.G, it spec.S) {
+	it.Before(func() {
+		RegisterTestingT(t)
+	})
+
+	when("Price.Cost()", func() {
+		it("prices cached input and reasoning output on their own", func() {
+			p := usage.Price{Input: 2, CachedInput: 0.5, Output: 8, Reasoning: 10}
+
+			cost := p.Cost(usage.Tokens{Input: 1_000_000, CachedInput: 400_000, Output: 500_000, Reasoning: 100_000})
+			Expect(cost).To(BeNumerically("~", 0.6*2+0.4*0.5+0.4*8+0.1*10, 1e-9))
+		})
+
+		it("falls back to the input and output prices", func() {
+			p := usage.Price{Input: 1, Output: 4}
+
+			cost := p.Cost(usage.Tokens{Input: 1_000_000, CachedInput: 1_000_000, Output: 1_000_000, Reasoning: 1_000_000})
+			Expect(cost).To(BeNumerically("~", 5, 1e-9))
+		})
+	})
+
+	when("Prices.Lookup()", func() {
+		it("finds snapshots by their longest model name", func() {
+			prices := usage.NewPrices(nil)
+
+			mini, ok := prices.Lookup("gpt-4o-mini-2024-07-18")
+			Expect(ok).To(BeTrue())
+			Expect(mini).To(Equal(usage.DefaultPrices["gpt-4o-mini"]))
+
+			full, ok := prices.Lookup("GPT-4o-2024-08-06")
+			Expect(ok).To(BeTrue())
+			Expect(full).To(Equal(usage.DefaultPrices["gpt-4o"]))
+
+			_, ok = prices.Lookup("gpt-4omni")
+			Expect(ok).To(BeFalse())
+		})
+
+		it("lets overrides replace and add prices", func() {
+			prices := usage.NewPrices(map[string]usage.Price{
+				"GPT-4o":     {Input: 1, Output: 2},
+				"llama3:70b": {Input: 0.1, Output: 0.1},
+			})
+
+			p, _ := prices.Lookup("gpt-4o")
+			Expect(p).To(Equal(usage.Price{Input: 1, Output: 2}))
+			_, ok := prices.Lookup("llama3:70b")
+			Expect(ok).To(BeTrue())
+			Expect(usage.DefaultPrices["gpt-4o"].Input).To(Equal(2.5))
+		})
+	})
+
+	when("Ledger", func() {
+		var (
+			ledger *usage.Ledger
+			day1   time.Time
+			day2   time.Time
+		)
+
+		it.Before(func() {
+			ledger = usage.NewLedger(filepath.Join(t.TempDir(), "usage", "ledger.jsonl"))
+			day1 = time.Date(2026, 10, 1, 12, 0, 0, 0, time.Local)
+			day2 = day1.AddDate(0, 0, 1)
+		})
+
+		record := func(now time.Time, model, thread, team string, tokens usage.Tokens) usage.Record {
+			r := usage.NewRecord(usage.NewPrices(nil), now, model, tokens)
+			r.Thread = thread
+			r.Team = team
+			return r
+		}
+
+		it("reads back what it appended since a time, skipping bad lines", func() {
+			Expect(ledger.Append(record(day1, "gpt-4o", "t1", "", usage.Tokens{Input: 10, Output: 5}))).To(Succeed())
+
+			f, err := os.OpenFile(ledger.Path(), os.O_APPEND|os.O_WRONLY, 0)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = f.WriteString("not json\n")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(f.Close()).To(Succeed())
+
+			Expect(ledger.Append(record(day2, "my-model", "t1", "", usage.Tokens{Input: 1}))).To(Succeed())
+
+			records, err := ledger.Records(time.Time{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(records).To(HaveLen(2))
+			Expect(records[0].Priced).To(BeTrue())
+			Expect(records[0].CostUSD).To(BeNumerically(">", 0))
+			Expect(records[1].Priced).To(BeFalse())
+
+			records, err = ledger.Records(day2)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(records).To(HaveLen(1))
+			Expect(records[0].Model).To(Equal("my-model"))
+		})
+
+		it("reports nothing without a ledger", func() {
+			records, err := ledger.Records(time.Time{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(records).To(BeEmpty())
+
+			var b strings.Builder
+			Expect(usage.WriteReport(&b, records)).To(Succeed())
+			Expect(b.String()).To(Equal("No usage recorded.\n"))
+		})
+
+		it("sums up by day, model, thread and team", func() {
+			records := []usage.Record{
+				record(day1, "gpt-4o", "t1", "search", usage.Tokens{Input: 1_000_000}),
+				record(day1, "gpt-4o", "t1", "search", usage.Tokens{Output: 100_000}),
+				record(day1, "gpt-4o-mini", "t2", "", usage.Tokens{Input: 1_000_000}),
+				record(day2, "my-model", "t1", "search", usage.Tokens{Input: 7}),
+			}
+
+			rows := usage.Summarize(records)
+			Expect(rows).To(HaveLen(3))
+			Expect(rows[0].Day).To(Equal("2026-10-01"))
+			Expect(rows[0].Model).To(Equal("gpt-4o"))
+			Expect(rows[0].Requests).To(Equal(2))
+			Expect(rows[0].Tokens).To(Equal(usage.Tokens{Input: 1_000_000, Output: 100_000}))
+			Expect(rows[0].CostUSD).To(BeNumerically("~", 3.5, 1e-9))
+			Expect(rows[1].Model).To(Equal("gpt-4o-mini"))
+			Expect(rows[2].Unpriced).To(Equal(1))
+
+			var b strings.Builder
+			Expect(usage.WriteReport(&b, records)).To(Succeed())
+			out := b.String()
+			Expect(out).To(ContainSubstring("2026-10-01  gpt-4o "))
+			Expect(out).To(MatchRegexp(`search\s+3\s+1100007\s+3\.5000\*`))
+			Expect(out).To(MatchRegexp(`-\s+1\s+1000000\s+0\.1500\n`))
+			Expect(out).To(MatchRegexp(`total\s+4\s+2100007\s+3\.6500\*`))
+			Expect(out).To(ContainSubstring("* 1 request used models without a price"))
+		})
+	})
+
+	when("ParseSince()", func() {
+		now := time.Date(2026, 10, 18, 9, 30, 0, 0, time.UTC)
+
+		it("reads days and durations", func() {
+			Expect(usage.ParseSince("", now)).To(Equal(time.Time{}))
+			Expect(usage.ParseSince("2026-10-01", now)).To(Equal(time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)))
+			Expect(usage.ParseSince("7d", now)).To(Equal(now.AddDate(0, 0, -7)))
+			Expect(usage.ParseSince("12h", now)).To(Equal(now.Add(-12 * time.Hour)))
+
+			_, err := usage.ParseSince("last week", now)
+			Expect(err).To(MatchError(ContainSubstring("invalid --since")))
+		})
+	})
+}
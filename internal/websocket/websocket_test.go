@@ -0,0 +1,114 @@
+package websocket_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kardolus/chatgpt-cli/internal/websocket"
+	. "github.com/onsi/gomega"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+)
+
+func TestUnitWebSocket(t *testing.T) {
+	spec.Run(t, "Testing the WebSocket client", testWebSocket, spec.Report(report.Terminal{}))
+}
+
+func wsURL(server *httptest.Server) string {
+	return "ws" + strings.TrimPrefix(server.URL, "http")
+}
+
+func testWebSocket(t *testing.T, when spec.G, it spec.S) {
+	it.Before(func() {
+		RegisterTestingT(t)
+	})
+
+	when("Dial()", func() {
+		it("exchanges text and binary messages of any size with the server", func() {
+			var gotHeader string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotHeader = r.Header.Get("Authorization")
+				conn, err := websocket.Accept(w, r)
+				if err != nil {
+					return
+				}
+				defer conn.Close()
+
+				for {
+					typ, msg, err := conn.ReadMessage()
+					if err != nil {
+						return
+					}
+					_ = conn.WriteMessage(typ, append([]byte("echo: "), msg...))
+				}
+			}))
+			defer server.Close()
+
+			conn, err := websocket.Dial(context.Background(), wsURL(server), http.Header{"Authorization": {"Bearer key"}}, nil)
+			Expect(err).NotTo(HaveOccurred())
+			defer conn.Close()
+			Expect(gotHeader).To(Equal("Bearer key"))
+
+			for _, msg := range [][]byte{[]byte("hello"), bytes.Repeat([]byte("a"), 300), bytes.Repeat([]byte("b"), 70000)} {
+				Expect(conn.WriteMessage(websocket.TextMessage, msg)).To(Succeed())
+
+				typ, reply, err := conn.ReadMessage()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(typ).To(Equal(websocket.TextMessage))
+				Expect(reply).To(Equal(append([]byte("echo: "), msg...)))
+			}
+
+			Expect(conn.WriteMessage(websocket.BinaryMessage, []byte{0, 1, 2})).To(Succeed())
+			typ, reply, err := conn.ReadMessage()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(typ).To(Equal(websocket.BinaryMessage))
+			Expect(reply).To(Equal([]byte("echo: \x00\x01\x02")))
+		})
+
+		it("reports the status and body of a refused upgrade", func() {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusUnauthorized)
+				_, _ = w.Write([]byte(`{"error":{"message":"Incorrect API key provided"}}`))
+			}))
+			defer server.Close()
+
+			_, err := websocket.Dial(context.Background(), wsURL(server), nil, nil)
+
+			var handshakeErr *websocket.HandshakeError
+			Expect(errors.As(err, &handshakeErr)).To(BeTrue())
+			Expect(handshakeErr.StatusCode).To(Equal(http.StatusUnauthorized))
+			Expect(string(handshakeErr.Body)).To(ContainSubstring("Incorrect API key"))
+		})
+
+		it("rejects other schemes", func() {
+			_, err := websocket.Dial(context.Background(), "http://localhost", nil, nil)
+			Expect(err).To(MatchError(ContainSubstring("unsupported scheme")))
+		})
+	})
+
+	when("ReadMessage()", func() {
+		it("returns a CloseError when the server closes the connection", func() {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				conn, err := websocket.Accept(w, r)
+				if err != nil {
+					return
+				}
+				_ = conn.Close()
+			}))
+			defer server.Close()
+
+			conn, err := websocket.Dial(context.Background(), wsURL(server), nil, nil)
+			Expect(err).NotTo(HaveOccurred())
+
+			_, _, err = conn.ReadMessage()
+			var closeErr *websocket.CloseError
+			Expect(errors.As(err, &closeErr)).To(BeTrue())
+			Expect(closeErr.Code).To(Equal(websocket.CloseNormal))
+		})
+	})
+}
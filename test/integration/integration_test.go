@@ -14,6 +14,7 @@ import (
 	"github.com/sclevine/spec"
 	"github.com/sclevine/spec/report"
 	"io"
+	"io/fs"
 	"log"
 	"os"
 	"os/exec"
@@ -530,8 +531,9 @@ func testIntegration(t *testing.T, when spec.G, it spec.S) {
 			output := string(session.Err.Contents())
 			Expect(output).To(ContainSubstring(fmt.Sprintf("Warning: config.yaml doesn't exist in %s, create it", configHomeDir)))
 
-			// Unset the variable to prevent pollution
+			// Unset the variable and remove the data home the query created to prevent pollution
 			Expect(os.Unsetenv(internal.ConfigHomeEnv)).To(Succeed())
+			Expect(os.RemoveAll(configHomeDir)).To(Succeed())
 		})
 
 		it("should NOT warn when config.yaml does not exist and OPENAI_CONFIG_HOME is NOT set", func() {
@@ -1390,6 +1392,18 @@ func (osReader) ReadBufferFromFile(file *os.File) ([]byte, error) {
 	return io.ReadAll(file)
 }
 
+func (osReader) Stat(name string) (os.FileInfo, error) {
+	return os.Stat(name)
+}
+
+func (osReader) Lstat(name string) (os.FileInfo, error) {
+	return os.Lstat(name)
+}
+
+func (osReader) WalkDir(root string, fn fs.WalkDirFunc) error {
+	return filepath.WalkDir(root, fn)
+}
+
 func (r osReader) ReadFile(name string) ([]byte, error) {
 	f, err := r.Open(name)
 	if err != nil {
@@ -1412,3 +1426,15 @@ func (osWriter) Write(f *os.File, data []byte) error {
 	_, err := f.Write(data)
 	return err
 }
+
+func (osWriter) MkdirAll(path string, perm os.FileMode) error {
+	return os.MkdirAll(path, perm)
+}
+
+func (osWriter) Rename(oldpath, newpath string) error {
+	return os.Rename(oldpath, newpath)
+}
+
+func (osWriter) Remove(name string) error {
+	return os.Remove(name)
+}